@@ -112,11 +112,22 @@ func (bd *BSONDump) Close() error {
 }
 
 func formatJSON(doc *bson.Raw, pretty bool) ([]byte, error) {
+	return formatJSONAt(doc, pretty, -1, 0)
+}
+
+// formatJSONAt formats doc as extended JSON. If offset is not negative, the
+// document is wrapped with its byte offset in the file and its index.
+func formatJSONAt(doc *bson.Raw, pretty bool, offset int64, index int) ([]byte, error) {
 	extendedJSON, err := bson.MarshalExtJSON(doc, true, false)
 	if err != nil {
 		return nil, fmt.Errorf("error converting BSON to extended JSON: %v", err)
 	}
 
+	if offset >= 0 {
+		wrapped := fmt.Sprintf(`{"offset":%d,"index":%d,"document":`, offset, index)
+		extendedJSON = append(append([]byte(wrapped), extendedJSON...), '}')
+	}
+
 	if pretty {
 		var jsonFormatted bytes.Buffer
 		if err := json.Indent(&jsonFormatted, extendedJSON, "", "\t"); err != nil {
@@ -139,13 +150,20 @@ func (bd *BSONDump) JSON() (int, error) {
 		panic("Tried to call JSON() before opening file")
 	}
 
+	var offset int64
 	for {
 		result := bson.Raw(bd.InputSource.LoadNext())
 		if result == nil {
 			break
 		}
 
-		if bytes, err := formatJSON(&result, bd.OutputOptions.Pretty); err != nil {
+		docOffset := int64(-1)
+		if bd.OutputOptions.WithOffsets {
+			docOffset = offset
+		}
+		offset += int64(len(result))
+
+		if bytes, err := formatJSONAt(&result, bd.OutputOptions.Pretty, docOffset, numFound); err != nil {
 			log.Logvf(log.Always, "unable to dump document %v: %v", numFound+1, err)
 
 			//if objcheck is turned on, stop now. otherwise keep on dumpin'
@@ -183,11 +201,14 @@ func (bd *BSONDump) Debug() (int, error) {
 		panic("Tried to call Debug() before opening file")
 	}
 
+	var offset int64
 	for {
 		result := bson.Raw(bd.InputSource.LoadNext())
 		if result == nil {
 			break
 		}
+		docOffset := offset
+		offset += int64(len(result))
 
 		if bd.OutputOptions.ObjCheck {
 			validated := bson.M{}
@@ -197,6 +218,9 @@ func (bd *BSONDump) Debug() (int, error) {
 				return numFound, fmt.Errorf("failed to validate bson during objcheck: %v", err)
 			}
 		}
+		if bd.OutputOptions.WithOffsets {
+			fmt.Fprintf(bd.OutputWriter, "# offset: %v index: %v\n", docOffset, numFound)
+		}
 		err := printBSON(result, 0, bd.OutputWriter)
 		if err != nil {
 			log.Logvf(log.Always, "encountered error debugging BSON data: %v", err)
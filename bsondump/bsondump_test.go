@@ -8,15 +8,64 @@ package bsondump
 
 import (
 	"bytes"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"runtime"
+	"strings"
 	"testing"
 
+	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/testtype"
 	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
+func TestWithOffsets(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a BSON file of several documents", t, func() {
+		first := marshalD(bson.E{Key: "a", Value: int32(1)})
+		second := marshalD(bson.E{Key: "b", Value: "xyz"})
+		input := bytes.Join([][]byte{first, second}, nil)
+
+		out := &bytes.Buffer{}
+		newDumper := func(opts *OutputOptions) *BSONDump {
+			opts.WithOffsets = true
+			return &BSONDump{
+				OutputOptions: opts,
+				OutputWriter:  WriteNopCloser{out},
+				InputSource:   db.NewBSONSource(ioutil.NopCloser(bytes.NewReader(input))),
+			}
+		}
+
+		Convey("JSON output should wrap each document with its offset and index", func() {
+			numFound, err := newDumper(&OutputOptions{Type: JSONOutputType}).JSON()
+			So(err, ShouldBeNil)
+			So(numFound, ShouldEqual, 2)
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			So(lines, ShouldResemble, []string{
+				`{"offset":0,"index":0,"document":{"a":{"$numberInt":"1"}}}`,
+				fmt.Sprintf(`{"offset":%v,"index":1,"document":{"b":"xyz"}}`, len(first)),
+			})
+		})
+
+		Convey("pretty JSON output should still be valid JSON", func() {
+			_, err := newDumper(&OutputOptions{Type: JSONOutputType, Pretty: true}).JSON()
+			So(err, ShouldBeNil)
+			So(out.String(), ShouldContainSubstring, fmt.Sprintf("\"offset\": %v,\n\t\"index\": 1,", len(first)))
+		})
+
+		Convey("debug output should precede each document with a comment line", func() {
+			_, err := newDumper(&OutputOptions{Type: DebugOutputType}).Debug()
+			So(err, ShouldBeNil)
+			So(out.String(), ShouldStartWith, "# offset: 0 index: 0\n--- new object ---")
+			So(out.String(), ShouldContainSubstring, fmt.Sprintf("# offset: %v index: 1\n", len(first)))
+		})
+	})
+}
+
 func TestBsondump(t *testing.T) {
 	executable := "../bin/bsondump"
 	if runtime.GOOS == "windows" {
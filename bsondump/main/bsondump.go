@@ -11,6 +11,7 @@ import (
 	"os"
 
 	"github.com/mongodb/mongo-tools/bsondump"
+	"github.com/mongodb/mongo-tools/common/completion"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/signals"
 	"github.com/mongodb/mongo-tools/common/util"
@@ -27,7 +28,7 @@ func main() {
 	if err != nil {
 		log.Logvf(log.Always, "%v", err)
 		log.Logvf(log.Always, util.ShortUsage("bsondump"))
-		os.Exit(util.ExitFailure)
+		os.Exit(util.ExitValidationFailure)
 	}
 
 	// print help, if specified
@@ -40,6 +41,16 @@ func main() {
 		return
 	}
 
+	// print the effective config, if specified
+	if opts.PrintEffectiveConfig() {
+		return
+	}
+
+	// generate shell completions, if requested
+	if _, ok := opts.CompletionArgs(); ok {
+		os.Exit(completion.Main(opts.ToolOptions))
+	}
+
 	signals.Handle()
 
 	dumper, err := bsondump.New(opts)
@@ -58,8 +69,12 @@ func main() {
 	log.Logvf(log.DebugLow, "running bsondump with --objcheck: %v", opts.ObjCheck)
 
 	var numFound int
-	if opts.Type == bsondump.DebugOutputType {
+	if opts.Validate {
+		numFound, err = dumper.Validate()
+	} else if opts.Type == bsondump.DebugOutputType {
 		numFound, err = dumper.Debug()
+	} else if opts.Type == bsondump.SchemaOutputType {
+		numFound, err = dumper.Schema()
 	} else {
 		numFound, err = dumper.JSON()
 	}
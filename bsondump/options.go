@@ -27,17 +27,24 @@ type Options struct {
 
 // Types out output supported by the --type option
 const (
-	DebugOutputType = "debug"
-	JSONOutputType  = "json"
+	DebugOutputType  = "debug"
+	JSONOutputType   = "json"
+	SchemaOutputType = "schema"
 )
 
 type OutputOptions struct {
 	// Format to display the BSON data file
-	Type string `long:"type" value-name:"<type>" default:"json" default-mask:"-" description:"type of output: debug, json"`
+	Type string `long:"type" value-name:"<type>" default:"json" default-mask:"-" description:"type of output: debug, json, schema (a JSON Schema inferred from all documents)"`
 
 	// Validate each BSON document before displaying
 	ObjCheck bool `long:"objcheck" description:"validate BSON during processing"`
 
+	// Check each BSON document for spec violations instead of displaying it
+	Validate bool `long:"validate" description:"check each document for BSON spec violations and report them instead of dumping; exits with an error if any are found"`
+
+	// Annotate each document with its position in the BSON file
+	WithOffsets bool `long:"withOffsets" description:"prefix each document with its byte offset in the file and its index (counting from 0); wraps each JSON document as {\"offset\": ..., \"index\": ..., \"document\": ...} and adds a comment line before each debug document"`
+
 	// Display JSON data with indents
 	Pretty bool `long:"pretty" description:"output JSON formatted to be human-readable"`
 
@@ -78,10 +85,21 @@ func ParseOptions(rawArgs []string, versionStr, gitCommit string) (Options, erro
 		outputOpts.BSONFileName = args[0]
 	}
 
+	if outputOpts.Validate && outputOpts.Type != "" && outputOpts.Type != JSONOutputType {
+		return Options{}, fmt.Errorf("cannot use --validate with --type=%v", outputOpts.Type)
+	}
+
+	if outputOpts.WithOffsets && outputOpts.Validate {
+		return Options{}, fmt.Errorf("cannot use --withOffsets with --validate, which already reports document offsets")
+	}
+	if outputOpts.WithOffsets && outputOpts.Type == SchemaOutputType {
+		return Options{}, fmt.Errorf("cannot use --withOffsets with --type=%v", SchemaOutputType)
+	}
+
 	switch outputOpts.Type {
-	case "", DebugOutputType, JSONOutputType:
+	case "", DebugOutputType, JSONOutputType, SchemaOutputType:
 		return Options{toolOpts, outputOpts}, nil
 	default:
-		return Options{}, fmt.Errorf("unsupported output type '%v'. Must be either '%v' or '%v'", DebugOutputType, JSONOutputType, outputOpts.Type)
+		return Options{}, fmt.Errorf("unsupported output type '%v'. Must be one of '%v', '%v' or '%v'", outputOpts.Type, DebugOutputType, JSONOutputType, SchemaOutputType)
 	}
 }
@@ -0,0 +1,240 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+const (
+	// maxEnumValues is the most distinct values a string field may have for
+	// them to be suggested as an enum.
+	maxEnumValues = 10
+	// minEnumRepeats is how many times each distinct value of a string field
+	// must occur on average for the values to be suggested as an enum, so
+	// that fields which merely have few samples are not mistaken for enums.
+	minEnumRepeats = 2
+)
+
+// bsonTypeAliases maps BSON types to the aliases used by $jsonSchema's
+// bsonType keyword.
+var bsonTypeAliases = map[bsontype.Type]string{
+	bsontype.Double:           "double",
+	bsontype.String:           "string",
+	bsontype.EmbeddedDocument: "object",
+	bsontype.Array:            "array",
+	bsontype.Binary:           "binData",
+	bsontype.Undefined:        "undefined",
+	bsontype.ObjectID:         "objectId",
+	bsontype.Boolean:          "bool",
+	bsontype.DateTime:         "date",
+	bsontype.Null:             "null",
+	bsontype.Regex:            "regex",
+	bsontype.DBPointer:        "dbPointer",
+	bsontype.JavaScript:       "javascript",
+	bsontype.Symbol:           "symbol",
+	bsontype.CodeWithScope:    "javascriptWithScope",
+	bsontype.Int32:            "int",
+	bsontype.Timestamp:        "timestamp",
+	bsontype.Int64:            "long",
+	bsontype.Decimal128:       "decimal",
+	bsontype.MinKey:           "minKey",
+	bsontype.MaxKey:           "maxKey",
+}
+
+// schemaNode accumulates what has been seen of the values at one position in
+// the documents: a field, the elements of an array, or the documents
+// themselves.
+type schemaNode struct {
+	count int
+	types map[string]int
+
+	// fields of the object values seen, in the order first seen
+	objects    int
+	fields     map[string]*schemaNode
+	fieldOrder []string
+
+	// elements of the array values seen
+	items *schemaNode
+
+	// distinct string values seen, until there are too many for an enum
+	enum         map[string]int
+	enumOverflow bool
+}
+
+func newSchemaNode() *schemaNode {
+	return &schemaNode{
+		types:  map[string]int{},
+		fields: map[string]*schemaNode{},
+		enum:   map[string]int{},
+	}
+}
+
+func (n *schemaNode) observe(value bson.RawValue) {
+	n.count++
+	alias, ok := bsonTypeAliases[value.Type]
+	if !ok {
+		alias = fmt.Sprintf("unknown(0x%02x)", byte(value.Type))
+	}
+	n.types[alias]++
+
+	switch value.Type {
+	case bsontype.EmbeddedDocument:
+		n.observeDocument(value.Document())
+	case bsontype.Array:
+		if n.items == nil {
+			n.items = newSchemaNode()
+		}
+		values, _ := value.Array().Values()
+		for _, elem := range values {
+			n.items.observe(elem)
+		}
+	case bsontype.String:
+		if !n.enumOverflow {
+			n.enum[value.StringValue()]++
+			if len(n.enum) > maxEnumValues {
+				n.enumOverflow = true
+				n.enum = nil
+			}
+		}
+	}
+}
+
+func (n *schemaNode) observeDocument(doc bson.Raw) {
+	n.objects++
+	elements, _ := doc.Elements()
+	for _, elem := range elements {
+		key := elem.Key()
+		field, ok := n.fields[key]
+		if !ok {
+			field = newSchemaNode()
+			n.fields[key] = field
+			n.fieldOrder = append(n.fieldOrder, key)
+		}
+		field.observe(elem.Value())
+	}
+}
+
+// schema returns the $jsonSchema describing the values seen. A field is
+// required if it was present in every object seen at its position.
+func (n *schemaNode) schema() bson.D {
+	var schema bson.D
+
+	types := make([]string, 0, len(n.types))
+	for alias := range n.types {
+		types = append(types, alias)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if n.types[types[i]] != n.types[types[j]] {
+			return n.types[types[i]] > n.types[types[j]]
+		}
+		return types[i] < types[j]
+	})
+	if len(types) == 1 {
+		schema = append(schema, bson.E{Key: "bsonType", Value: types[0]})
+	} else if len(types) > 1 {
+		schema = append(schema, bson.E{Key: "bsonType", Value: types})
+	}
+
+	if n.objects > 0 {
+		var required []string
+		properties := bson.D{}
+		for _, key := range n.fieldOrder {
+			field := n.fields[key]
+			if field.count == n.objects {
+				required = append(required, key)
+			}
+			properties = append(properties, bson.E{Key: key, Value: field.schema()})
+		}
+		if len(required) > 0 {
+			schema = append(schema, bson.E{Key: "required", Value: required})
+		}
+		schema = append(schema, bson.E{Key: "properties", Value: properties})
+	}
+
+	if n.items != nil && n.items.count > 0 {
+		schema = append(schema, bson.E{Key: "items", Value: n.items.schema()})
+	}
+
+	if values := n.enumCandidates(); values != nil {
+		schema = append(schema, bson.E{Key: "enum", Value: values})
+	}
+	return schema
+}
+
+// enumCandidates returns the distinct values of a field that only ever held
+// a few distinct strings, or nil if it is not a likely enum.
+func (n *schemaNode) enumCandidates() []string {
+	if n.enumOverflow || len(n.enum) == 0 || len(n.types) != 1 {
+		return nil
+	}
+	if n.count < minEnumRepeats*len(n.enum) {
+		return nil
+	}
+	values := make([]string, 0, len(n.enum))
+	for value := range n.enum {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return values
+}
+
+// Schema iterates through the BSON file and infers a JSON Schema describing
+// the documents it finds, which it prints as a {$jsonSchema: ...} validator.
+// Fields present in every document at their position are marked required,
+// and string fields with a few repeated values are given enum candidates.
+// It returns the number of documents processed and a non-nil error if one is
+// encountered before the end of the file is reached.
+func (bd *BSONDump) Schema() (int, error) {
+	numFound := 0
+
+	if bd.InputSource == nil {
+		panic("Tried to call Schema() before opening file")
+	}
+
+	root := newSchemaNode()
+	for {
+		result := bson.Raw(bd.InputSource.LoadNext())
+		if result == nil {
+			break
+		}
+		if err := result.Validate(); err != nil {
+			log.Logvf(log.Always, "unable to read document %v: %v", numFound+1, err)
+			if bd.OutputOptions.ObjCheck {
+				return numFound, err
+			}
+			numFound++
+			continue
+		}
+		root.observe(bson.RawValue{Type: bsontype.EmbeddedDocument, Value: result})
+		numFound++
+	}
+	if err := bd.InputSource.Err(); err != nil {
+		return numFound, err
+	}
+
+	out, err := bson.MarshalExtJSON(bson.D{{Key: "$jsonSchema", Value: root.schema()}}, false, false)
+	if err != nil {
+		return numFound, fmt.Errorf("error converting schema to JSON: %v", err)
+	}
+	if bd.OutputOptions.Pretty {
+		var jsonFormatted bytes.Buffer
+		if err = json.Indent(&jsonFormatted, out, "", "\t"); err != nil {
+			return numFound, fmt.Errorf("error prettifying schema: %v", err)
+		}
+		out = jsonFormatted.Bytes()
+	}
+	_, err = bd.OutputWriter.Write(append(out, '\n'))
+	return numFound, err
+}
@@ -0,0 +1,78 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestSchema(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a BSON file of similar documents", t, func() {
+		var input []byte
+		for i, status := range []string{"new", "done", "new", "done", "new"} {
+			doc := bson.D{
+				{Key: "_id", Value: int32(i)},
+				{Key: "status", Value: status},
+				{Key: "tags", Value: bson.A{"a", int64(i)}},
+				{Key: "address", Value: bson.D{{Key: "city", Value: "x"}}},
+			}
+			if i%2 == 0 {
+				doc = append(doc, bson.E{Key: "note", Value: "note"})
+				doc[3].Value = bson.D{{Key: "city", Value: "x"}, {Key: "zip", Value: fmt.Sprint(i)}}
+			}
+			raw, err := bson.Marshal(doc)
+			So(err, ShouldBeNil)
+			input = append(input, raw...)
+		}
+
+		out := &bytes.Buffer{}
+		bd := &BSONDump{
+			OutputOptions: &OutputOptions{Type: SchemaOutputType},
+			OutputWriter:  WriteNopCloser{out},
+			InputSource:   db.NewBSONSource(ioutil.NopCloser(bytes.NewReader(input))),
+		}
+		numFound, err := bd.Schema()
+		So(err, ShouldBeNil)
+		So(numFound, ShouldEqual, 5)
+
+		var validator struct {
+			Schema bson.M `bson:"$jsonSchema"`
+		}
+		So(bson.UnmarshalExtJSON(out.Bytes(), false, &validator), ShouldBeNil)
+		schema := validator.Schema
+		properties := schema["properties"].(bson.M)
+
+		Convey("fields in every document should be required", func() {
+			So(schema["bsonType"], ShouldEqual, "object")
+			So(schema["required"], ShouldResemble, bson.A{"_id", "status", "tags", "address"})
+			address := properties["address"].(bson.M)
+			So(address["required"], ShouldResemble, bson.A{"city"})
+		})
+
+		Convey("each field should have its BSON types", func() {
+			So(properties["_id"].(bson.M)["bsonType"], ShouldEqual, "int")
+			items := properties["tags"].(bson.M)["items"].(bson.M)
+			So(items["bsonType"], ShouldResemble, bson.A{"long", "string"})
+		})
+
+		Convey("repeated string values should be suggested as an enum", func() {
+			So(properties["status"].(bson.M)["enum"], ShouldResemble, bson.A{"done", "new"})
+			So(properties["note"].(bson.M)["enum"], ShouldResemble, bson.A{"note"})
+			So(properties["address"].(bson.M)["properties"].(bson.M)["zip"].(bson.M), ShouldNotContainKey, "enum")
+		})
+	})
+}
@@ -0,0 +1,369 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"unicode/utf8"
+)
+
+// Types of BSON spec violations reported by --validate.
+const (
+	ViolationMalformed          = "malformed document"
+	ViolationInvalidUTF8Key     = "invalid UTF-8 key"
+	ViolationInvalidUTF8String  = "invalid UTF-8 string"
+	ViolationDuplicateKey       = "duplicate key"
+	ViolationNULInString        = "NUL in string"
+	ViolationInvalidBoolean     = "invalid boolean"
+	ViolationInvalidSubtype     = "invalid binary subtype"
+	ViolationInvalidBinarySize  = "mis-sized binary"
+	ViolationMisSizedDecimal128 = "mis-sized decimal128"
+)
+
+// maxReportedViolations is the number of occurrences of each type of
+// violation that are listed in the report; all occurrences are counted.
+const maxReportedViolations = 10
+
+// violation is a single spec violation found in a document.
+type violation struct {
+	kind   string
+	field  string
+	detail string
+}
+
+// validationReport counts the violations of each type found in a BSON file
+// and records where the first few of them occurred.
+type validationReport struct {
+	counts      map[string]int
+	occurrences map[string][]string
+	documents   int
+}
+
+func newValidationReport() *validationReport {
+	return &validationReport{
+		counts:      map[string]int{},
+		occurrences: map[string][]string{},
+	}
+}
+
+func (r *validationReport) add(docNum int, offset int64, violations []violation) {
+	if len(violations) > 0 {
+		r.documents++
+	}
+	for _, v := range violations {
+		r.counts[v.kind]++
+		if len(r.occurrences[v.kind]) >= maxReportedViolations {
+			continue
+		}
+		where := fmt.Sprintf("document %v at offset %v", docNum, offset)
+		if v.field != "" {
+			where += fmt.Sprintf(", field '%v'", v.field)
+		}
+		if v.detail != "" {
+			where += ": " + v.detail
+		}
+		r.occurrences[v.kind] = append(r.occurrences[v.kind], where)
+	}
+}
+
+func (r *validationReport) total() int {
+	total := 0
+	for _, count := range r.counts {
+		total += count
+	}
+	return total
+}
+
+func (r *validationReport) write(out io.Writer, numFound int) error {
+	kinds := make([]string, 0, len(r.counts))
+	for kind := range r.counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "%v documents checked, %v with violations\n", numFound, r.documents)
+	for _, kind := range kinds {
+		fmt.Fprintf(buf, "%v: %v\n", kind, r.counts[kind])
+		for _, where := range r.occurrences[kind] {
+			fmt.Fprintf(buf, "\t%v\n", where)
+		}
+		if r.counts[kind] > len(r.occurrences[kind]) {
+			fmt.Fprintf(buf, "\t... and %v more\n", r.counts[kind]-len(r.occurrences[kind]))
+		}
+	}
+	_, err := out.Write(buf.Bytes())
+	return err
+}
+
+// Validate iterates through the BSON file and checks each document it finds
+// for violations of the BSON spec that lenient decoders accept, then writes a
+// report of the violations found by type, with the offset of the document
+// each was found in.
+// It returns the number of documents processed and a non-nil error if any
+// violations are found or the file cannot be read to the end.
+func (bd *BSONDump) Validate() (int, error) {
+	numFound := 0
+
+	if bd.InputSource == nil {
+		panic("Tried to call Validate() before opening file")
+	}
+
+	report := newValidationReport()
+	var offset int64
+	for {
+		doc := bd.InputSource.LoadNext()
+		if doc == nil {
+			break
+		}
+		numFound++
+		report.add(numFound, offset, validateDocument(doc))
+		offset += int64(len(doc))
+	}
+	readErr := bd.InputSource.Err()
+	if readErr != nil {
+		report.add(numFound+1, offset, []violation{{kind: ViolationMalformed, detail: readErr.Error()}})
+	}
+
+	if err := report.write(bd.OutputWriter, numFound); err != nil {
+		return numFound, err
+	}
+	if total := report.total(); total > 0 {
+		return numFound, fmt.Errorf("found %v BSON spec violation(s)", total)
+	}
+	return numFound, nil
+}
+
+// validateDocument returns the spec violations in a single document. A
+// structural violation stops validation of the document, since the rest of it
+// cannot be parsed reliably.
+func validateDocument(doc []byte) []violation {
+	v := &documentValidator{}
+	v.document(doc, "")
+	return v.violations
+}
+
+type documentValidator struct {
+	violations []violation
+}
+
+func (v *documentValidator) report(kind, field, format string, args ...interface{}) {
+	v.violations = append(v.violations, violation{kind: kind, field: field, detail: fmt.Sprintf(format, args...)})
+}
+
+func joinField(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// document validates an embedded document or array, returning false if it is
+// structurally invalid.
+func (v *documentValidator) document(doc []byte, path string) bool {
+	if len(doc) < 5 {
+		v.report(ViolationMalformed, path, "document of %v bytes is too short", len(doc))
+		return false
+	}
+	if size := int32(binary.LittleEndian.Uint32(doc)); int(size) != len(doc) {
+		v.report(ViolationMalformed, path, "document length %v does not match its %v bytes", size, len(doc))
+		return false
+	}
+	if doc[len(doc)-1] != 0 {
+		v.report(ViolationMalformed, path, "document is not NUL-terminated")
+		return false
+	}
+
+	end := len(doc) - 1
+	keys := map[string]bool{}
+	pos := 4
+	for pos < end {
+		elemType := doc[pos]
+		pos++
+		keyEnd := bytes.IndexByte(doc[pos:end], 0)
+		if keyEnd < 0 {
+			v.report(ViolationMalformed, path, "unterminated key")
+			return false
+		}
+		key := string(doc[pos : pos+keyEnd])
+		pos += keyEnd + 1
+		field := joinField(path, key)
+
+		if !utf8.ValidString(key) {
+			v.report(ViolationInvalidUTF8Key, field, "")
+		}
+		if keys[key] {
+			v.report(ViolationDuplicateKey, field, "")
+		}
+		keys[key] = true
+
+		size, ok := v.value(elemType, doc[pos:end], field)
+		if !ok {
+			return false
+		}
+		pos += size
+	}
+	return true
+}
+
+// value validates a single value of the given type at the start of buf, and
+// returns its size. It returns false if the value is structurally invalid.
+func (v *documentValidator) value(elemType byte, buf []byte, field string) (int, bool) {
+	fixed := func(size int, name string) (int, bool) {
+		if len(buf) < size {
+			kind := ViolationMalformed
+			if name == "decimal128" {
+				kind = ViolationMisSizedDecimal128
+			}
+			v.report(kind, field, "%v needs %v bytes but only %v remain", name, size, len(buf))
+			return 0, false
+		}
+		return size, true
+	}
+
+	switch elemType {
+	case 0x01, 0x09, 0x11, 0x12: // double, datetime, timestamp, int64
+		return fixed(8, "value")
+	case 0x02, 0x0D, 0x0E: // string, JavaScript code, symbol
+		return v.str(buf, field)
+	case 0x03, 0x04: // embedded document, array
+		size, ok := v.length(buf, field, 5)
+		if !ok || !v.document(buf[:size], field) {
+			return 0, false
+		}
+		return size, true
+	case 0x05: // binary
+		return v.binary(buf, field)
+	case 0x06, 0x0A, 0x7F, 0xFF: // undefined, null, max key, min key
+		return 0, true
+	case 0x07: // ObjectId
+		return fixed(12, "ObjectId")
+	case 0x08: // boolean
+		size, ok := fixed(1, "boolean")
+		if ok && buf[0] > 1 {
+			v.report(ViolationInvalidBoolean, field, "value 0x%02x", buf[0])
+		}
+		return size, ok
+	case 0x0B: // regular expression: pattern and options cstrings
+		size := 0
+		for i := 0; i < 2; i++ {
+			n := bytes.IndexByte(buf[size:], 0)
+			if n < 0 {
+				v.report(ViolationMalformed, field, "unterminated regular expression")
+				return 0, false
+			}
+			if !utf8.Valid(buf[size : size+n]) {
+				v.report(ViolationInvalidUTF8String, field, "regular expression")
+			}
+			size += n + 1
+		}
+		return size, true
+	case 0x0C: // DBPointer: string and ObjectId
+		size, ok := v.str(buf, field)
+		if !ok {
+			return 0, false
+		}
+		if len(buf) < size+12 {
+			v.report(ViolationMalformed, field, "DBPointer ObjectId is truncated")
+			return 0, false
+		}
+		return size + 12, true
+	case 0x0F: // code with scope: total length, string and document
+		size, ok := v.length(buf, field, 14)
+		if !ok {
+			return 0, false
+		}
+		codeSize, ok := v.str(buf[4:size], field)
+		if !ok {
+			return 0, false
+		}
+		if !v.document(buf[4+codeSize:size], joinField(field, "$scope")) {
+			return 0, false
+		}
+		return size, true
+	case 0x10: // int32
+		return fixed(4, "int32")
+	case 0x13: // decimal128
+		return fixed(16, "decimal128")
+	}
+	v.report(ViolationMalformed, field, "unknown element type 0x%02x", elemType)
+	return 0, false
+}
+
+// length reads the int32 length prefix of a value that includes its own
+// length, checking that it is at least min and fits in buf.
+func (v *documentValidator) length(buf []byte, field string, min int) (int, bool) {
+	if len(buf) < 4 {
+		v.report(ViolationMalformed, field, "length is truncated")
+		return 0, false
+	}
+	size := int(int32(binary.LittleEndian.Uint32(buf)))
+	if size < min || size > len(buf) {
+		v.report(ViolationMalformed, field, "length %v is out of range", size)
+		return 0, false
+	}
+	return size, true
+}
+
+// str validates a length-prefixed, NUL-terminated UTF-8 string.
+func (v *documentValidator) str(buf []byte, field string) (int, bool) {
+	if len(buf) < 4 {
+		v.report(ViolationMalformed, field, "string length is truncated")
+		return 0, false
+	}
+	size := int(int32(binary.LittleEndian.Uint32(buf)))
+	if size < 1 || 4+size > len(buf) {
+		v.report(ViolationMalformed, field, "string length %v is out of range", size)
+		return 0, false
+	}
+	contents := buf[4 : 4+size]
+	if contents[size-1] != 0 {
+		v.report(ViolationMalformed, field, "string is not NUL-terminated")
+		return 0, false
+	}
+	contents = contents[:size-1]
+	if i := bytes.IndexByte(contents, 0); i >= 0 {
+		v.report(ViolationNULInString, field, "NUL at byte %v of %v", i, len(contents))
+	}
+	if !utf8.Valid(contents) {
+		v.report(ViolationInvalidUTF8String, field, "")
+	}
+	return 4 + size, true
+}
+
+// binary validates binary data, including the sizes the spec requires of
+// some subtypes.
+func (v *documentValidator) binary(buf []byte, field string) (int, bool) {
+	if len(buf) < 5 {
+		v.report(ViolationMalformed, field, "binary header is truncated")
+		return 0, false
+	}
+	size := int(int32(binary.LittleEndian.Uint32(buf)))
+	if size < 0 || 5+size > len(buf) {
+		v.report(ViolationMalformed, field, "binary length %v is out of range", size)
+		return 0, false
+	}
+	subtype := buf[4]
+	data := buf[5 : 5+size]
+	switch {
+	case subtype == 0x02: // old binary, with a redundant inner length
+		if size < 4 || int(int32(binary.LittleEndian.Uint32(data))) != size-4 {
+			v.report(ViolationInvalidBinarySize, field, "subtype 0x02 inner length does not match")
+		}
+	case subtype == 0x03 || subtype == 0x04 || subtype == 0x05: // UUID, MD5
+		if size != 16 {
+			v.report(ViolationInvalidBinarySize, field, "subtype 0x%02x must be 16 bytes, not %v", subtype, size)
+		}
+	case subtype > 0x08 && subtype < 0x80:
+		v.report(ViolationInvalidSubtype, field, "subtype 0x%02x", subtype)
+	}
+	return 5 + size, true
+}
@@ -0,0 +1,114 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func marshalD(elems ...bson.E) []byte {
+	doc, err := bson.Marshal(bson.D(elems))
+	So(err, ShouldBeNil)
+	return doc
+}
+
+// rawDocument builds a document with a single element of the given type and
+// value bytes, for values the driver will not produce.
+func rawDocument(elemType byte, key string, value []byte) []byte {
+	size := 4 + 1 + len(key) + 1 + len(value) + 1
+	doc := []byte{byte(size), 0, 0, 0, elemType}
+	doc = append(doc, key...)
+	doc = append(doc, 0)
+	doc = append(doc, value...)
+	return append(doc, 0)
+}
+
+func TestValidateDocument(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	kinds := func(violations []violation) []string {
+		var out []string
+		for _, v := range violations {
+			out = append(out, v.kind)
+		}
+		return out
+	}
+
+	Convey("Documents produced by the driver should be valid", t, func() {
+		doc := marshalD(
+			bson.E{Key: "a", Value: int32(1)},
+			bson.E{Key: "sub", Value: bson.D{{Key: "b", Value: []interface{}{"x", 2.5}}}},
+			bson.E{Key: "id", Value: primitive.Binary{Subtype: 4, Data: make([]byte, 16)}},
+			bson.E{Key: "code", Value: primitive.CodeWithScope{Code: "f()", Scope: bson.D{{Key: "x", Value: 1}}}},
+			bson.E{Key: "re", Value: primitive.Regex{Pattern: "^a", Options: "i"}},
+		)
+		So(validateDocument(doc), ShouldBeEmpty)
+	})
+
+	Convey("Each kind of violation should be detected", t, func() {
+		So(kinds(validateDocument(marshalD(bson.E{Key: "a", Value: 1}, bson.E{Key: "a", Value: 2}))),
+			ShouldResemble, []string{ViolationDuplicateKey})
+		So(kinds(validateDocument(marshalD(bson.E{Key: "\xff", Value: 1}))),
+			ShouldResemble, []string{ViolationInvalidUTF8Key})
+		So(kinds(validateDocument(marshalD(bson.E{Key: "s", Value: "a\x00b"}))),
+			ShouldResemble, []string{ViolationNULInString})
+		So(kinds(validateDocument(marshalD(bson.E{Key: "s", Value: "\xfe"}))),
+			ShouldResemble, []string{ViolationInvalidUTF8String})
+		So(kinds(validateDocument(marshalD(bson.E{Key: "b", Value: primitive.Binary{Subtype: 0x20, Data: []byte{1}}}))),
+			ShouldResemble, []string{ViolationInvalidSubtype})
+		So(kinds(validateDocument(marshalD(bson.E{Key: "u", Value: primitive.Binary{Subtype: 4, Data: []byte{1, 2, 3}}}))),
+			ShouldResemble, []string{ViolationInvalidBinarySize})
+		So(kinds(validateDocument(rawDocument(0x08, "t", []byte{2}))),
+			ShouldResemble, []string{ViolationInvalidBoolean})
+		So(kinds(validateDocument(rawDocument(0x13, "d", make([]byte, 8)))),
+			ShouldResemble, []string{ViolationMisSizedDecimal128})
+		So(kinds(validateDocument(rawDocument(0x42, "x", nil))),
+			ShouldResemble, []string{ViolationMalformed})
+	})
+
+	Convey("Violations in nested documents should name the full field path", t, func() {
+		doc := marshalD(bson.E{Key: "a", Value: bson.D{{Key: "b", Value: 1}, {Key: "b", Value: 2}}})
+		violations := validateDocument(doc)
+		So(violations, ShouldHaveLength, 1)
+		So(violations[0].field, ShouldEqual, "a.b")
+	})
+}
+
+func TestValidate(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a BSON file containing valid and invalid documents", t, func() {
+		valid := marshalD(bson.E{Key: "a", Value: 1})
+		invalid := marshalD(bson.E{Key: "a", Value: 1}, bson.E{Key: "a", Value: 2})
+		input := bytes.Join([][]byte{valid, invalid, valid}, nil)
+
+		out := &bytes.Buffer{}
+		bd := &BSONDump{
+			OutputOptions: &OutputOptions{Validate: true},
+			OutputWriter:  WriteNopCloser{out},
+			InputSource:   db.NewBSONSource(ioutil.NopCloser(bytes.NewReader(input))),
+		}
+
+		Convey("the violations should be reported with their document offsets", func() {
+			numFound, err := bd.Validate()
+			So(err, ShouldNotBeNil)
+			So(numFound, ShouldEqual, 3)
+			So(out.String(), ShouldContainSubstring, "3 documents checked, 1 with violations")
+			So(out.String(), ShouldContainSubstring, "duplicate key: 1")
+			So(out.String(), ShouldContainSubstring, fmt.Sprintf("document 2 at offset %v, field 'a'", len(valid)))
+		})
+	})
+}
@@ -3,6 +3,7 @@ package bsonutil
 import (
 	"math"
 	"math/big"
+	"sort"
 
 	"github.com/mongodb/mongo-tools/common/log"
 	"go.mongodb.org/mongo-driver/bson"
@@ -79,10 +80,8 @@ func IsIndexKeysEqual(indexKey1 bson.D, indexKey2 bson.D) bool {
 // All other strings that aren't one of ["2d", "geoHaystack", "2dsphere", "hashed", "text", ""]
 // will cause the index build to fail. See TOOLS-2412 for more information.
 //
-// This function logs the keys that are converted.
-func ConvertLegacyIndexKeys(indexKey bson.D, ns string) {
-	var converted bool
-	originalJSONString := CreateExtJSONString(indexKey)
+// It returns whether any of the values were converted.
+func ConvertLegacyIndexKeys(indexKey bson.D) (converted bool) {
 	for j, elem := range indexKey {
 		switch v := elem.Value.(type) {
 		case int:
@@ -124,32 +123,24 @@ func ConvertLegacyIndexKeys(indexKey bson.D, ns string) {
 			converted = true
 		}
 	}
-	if converted {
-		newJSONString := CreateExtJSONString(indexKey)
-		log.Logvf(log.Always, "convertLegacyIndexes: converted index values '%s' to '%s' on collection '%s'",
-			originalJSONString, newJSONString, ns)
-	}
+	return converted
 }
 
 // ConvertLegacyIndexOptions removes options that don't match a known list of index options.
 // It is preferable to use the ignoreUnknownIndexOptions on the createIndex command to
 // force the server to do this task. But that option was only added in 4.1.9. So for
 // pre 3.4 indexes being added to servers 3.4 - 4.2, we must strip the options in the client.
-// This function processes the indexes Options inside collection dump.
-func ConvertLegacyIndexOptions(indexOptions bson.M) {
-	var converted bool
-	originalJSONString := CreateExtJSONString(indexOptions)
+// This function processes the indexes Options inside collection dump, and
+// returns the names of the options removed, sorted.
+func ConvertLegacyIndexOptions(indexOptions bson.M) (removed []string) {
 	for key := range indexOptions {
 		if _, ok := validIndexOptions[key]; !ok {
 			delete(indexOptions, key)
-			converted = true
+			removed = append(removed, key)
 		}
 	}
-	if converted {
-		newJSONString := CreateExtJSONString(indexOptions)
-		log.Logvf(log.Always, "convertLegacyIndexes: converted index options '%s' to '%s'",
-			originalJSONString, newJSONString)
-	}
+	sort.Strings(removed)
+	return removed
 }
 
 // ConvertLegacyIndexOptionsFromOp removes options that don't match a known list of index options.
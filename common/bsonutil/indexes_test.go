@@ -59,7 +59,7 @@ func TestConvertLegacyIndexKeys(t *testing.T) {
 	Convey("Converting legacy Indexes", t, func() {
 		index1Key := bson.D{{"foo", int32(0)}, {"int32field", int32(2)},
 			{"int64field", int64(-3)}, {"float64field", float64(-1)}, {"float64field", float64(-1.1)}}
-		ConvertLegacyIndexKeys(index1Key, "test")
+		So(ConvertLegacyIndexKeys(index1Key), ShouldBeTrue)
 		So(index1Key, ShouldResemble, bson.D{{"foo", int32(1)}, {"int32field", int32(2)}, {"int64field", int64(-3)},
 			{"float64field", float64(-1)}, {"float64field", float64(-1.1)}})
 
@@ -68,15 +68,18 @@ func TestConvertLegacyIndexKeys(t *testing.T) {
 		decimalOne, _ := primitive.ParseDecimal128("1")
 		decimalZero1, _ := primitive.ParseDecimal128("0.00")
 		index2Key := bson.D{{"key1", decimalNOne}, {"key2", decimalZero}, {"key3", decimalOne}, {"key4", decimalZero1}}
-		ConvertLegacyIndexKeys(index2Key, "test")
+		So(ConvertLegacyIndexKeys(index2Key), ShouldBeTrue)
 		So(index2Key, ShouldResemble, bson.D{{"key1", decimalNOne}, {"key2", int32(1)}, {"key3", decimalOne}, {"key4", int32(1)}})
 
 		index3Key := bson.D{{"key1", ""}, {"key2", "2dsphere"}}
-		ConvertLegacyIndexKeys(index3Key, "test")
+		So(ConvertLegacyIndexKeys(index3Key), ShouldBeTrue)
 		So(index3Key, ShouldResemble, bson.D{{"key1", int32(1)}, {"key2", "2dsphere"}})
 
 		index4Key := bson.D{{"key1", bson.E{"invalid", 1}}, {"key2", primitive.Binary{}}}
-		ConvertLegacyIndexKeys(index4Key, "test")
+		So(ConvertLegacyIndexKeys(index4Key), ShouldBeTrue)
 		So(index4Key, ShouldResemble, bson.D{{"key1", int32(1)}, {"key2", int32(1)}})
+
+		index5Key := bson.D{{"key1", int32(1)}, {"key2", "text"}}
+		So(ConvertLegacyIndexKeys(index5Key), ShouldBeFalse)
 	})
 }
@@ -0,0 +1,445 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// Package completion generates shell completion scripts for the tools from
+// their option definitions, e.g. "mongodump completion bash", and lists the
+// database and collection names the scripts complete.
+package completion
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// namesCommand is the hidden argument of "completion" with which the scripts
+// ask the tool for database or collection names, followed by the kind of
+// name and the words of the command line before the word being completed.
+// The words are given either separately after "--" or as the command line
+// after "--line".
+const namesCommand = options.CompletionNamesArg
+
+// namesTimeout limits the time spent connecting to list names, so that
+// completion does not hang on an unreachable server.
+const namesTimeout = 2 * time.Second
+
+// Shells lists the shells that scripts are generated for.
+var Shells = options.CompletionShells
+
+// Main generates a completion script or lists names for a tool whose first
+// argument was "completion", and returns the tool's exit code.
+func Main(opts *options.ToolOptions) int {
+	args, _ := opts.CompletionArgs()
+	if len(args) >= 2 && args[0] == namesCommand {
+		if err := printNames(opts, args[1], commandWords(args[2:]), os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "error listing names: %v\n", err)
+			return util.ExitFailure
+		}
+		return util.ExitSuccess
+	}
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "usage: %v completion %v\n", opts.AppName, strings.Join(Shells, "|"))
+		return util.ExitFailure
+	}
+	if err := WriteScript(os.Stdout, args[0], opts.AppName, opts.CompletionOptions()); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return util.ExitFailure
+	}
+	return util.ExitSuccess
+}
+
+// WriteScript writes the completion script for the given shell of the tool
+// with the given options.
+func WriteScript(out io.Writer, shell, tool string, opts []options.CompletionOption) error {
+	switch shell {
+	case "bash":
+		writeBash(out, tool, opts)
+	case "zsh":
+		writeZsh(out, tool, opts)
+	case "fish":
+		writeFish(out, tool, opts)
+	case "powershell":
+		writePowerShell(out, tool, opts)
+	default:
+		return fmt.Errorf("unsupported shell '%v': choose one of %v", shell, strings.Join(Shells, ", "))
+	}
+	return nil
+}
+
+// summary shortens an option's description to its first clause, for the
+// shells that show descriptions alongside completions.
+func summary(description string) string {
+	for _, sep := range []string{", e.g.", "; ", " (", ": ", ". "} {
+		if i := strings.Index(description, sep); i > 0 {
+			description = description[:i]
+		}
+	}
+	if runes := []rune(description); len(runes) > 80 {
+		description = string(runes[:77]) + "..."
+	}
+	return description
+}
+
+// flagNames returns the option's flags, e.g. "-d" and "--db".
+func flagNames(o options.CompletionOption) []string {
+	var names []string
+	if o.Short != "" {
+		names = append(names, "-"+o.Short)
+	}
+	if o.Long != "" {
+		names = append(names, "--"+o.Long)
+	}
+	return names
+}
+
+func writeBash(out io.Writer, tool string, opts []options.CompletionOption) {
+	fn := "_" + tool
+	fmt.Fprintf(out, "# bash completion for %v, generated by \"%v completion bash\"\n\n", tool, tool)
+
+	fmt.Fprintf(out, "%v_names() {\n", fn)
+	fmt.Fprintf(out, "    local IFS=$'\\n'\n")
+	fmt.Fprintf(out, "    COMPREPLY=($(compgen -W \"$(%v completion %v \"$1\" --line \"${COMP_LINE:0:COMP_POINT}\" 2>/dev/null)\" -- \"$cur\"))\n", tool, namesCommand)
+	fmt.Fprintf(out, "}\n\n")
+
+	fmt.Fprintf(out, "%v() {\n", fn)
+	fmt.Fprintf(out, "    local cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	fmt.Fprintf(out, "    # bash splits --option=value into three words\n")
+	fmt.Fprintf(out, "    if [[ \"$cur\" == \"=\" ]]; then\n")
+	fmt.Fprintf(out, "        cur=\"\"\n")
+	fmt.Fprintf(out, "    elif [[ \"$prev\" == \"=\" && $COMP_CWORD -gt 1 ]]; then\n")
+	fmt.Fprintf(out, "        prev=\"${COMP_WORDS[COMP_CWORD-2]}\"\n")
+	fmt.Fprintf(out, "    fi\n")
+	fmt.Fprintf(out, "    case \"$prev\" in\n")
+	var words []string
+	for _, o := range opts {
+		names := flagNames(o)
+		words = append(words, names...)
+		var completion string
+		switch {
+		case len(o.Choices) > 0:
+			completion = fmt.Sprintf("COMPREPLY=($(compgen -W \"%v\" -- \"$cur\"))", strings.Join(o.Choices, " "))
+		case o.Complete == options.CompleteDatabase || o.Complete == options.CompleteCollection:
+			completion = fmt.Sprintf("%v_names %v", fn, o.Complete)
+		default:
+			// values are completed as file names by "complete -o default"
+			continue
+		}
+		fmt.Fprintf(out, "        %v)\n", strings.Join(names, "|"))
+		fmt.Fprintf(out, "            %v\n", completion)
+		fmt.Fprintf(out, "            return\n")
+		fmt.Fprintf(out, "            ;;\n")
+	}
+	fmt.Fprintf(out, "    esac\n")
+	fmt.Fprintf(out, "    if [[ \"$cur\" == -* ]]; then\n")
+	fmt.Fprintf(out, "        COMPREPLY=($(compgen -W \"%v\" -- \"$cur\"))\n", strings.Join(words, " "))
+	fmt.Fprintf(out, "    fi\n")
+	fmt.Fprintf(out, "}\n\n")
+	fmt.Fprintf(out, "complete -o default -F %v %v\n", fn, tool)
+}
+
+// zshQuote quotes s for a single-quoted zsh word.
+func zshQuote(s string) string {
+	return strings.Replace(s, "'", `'\''`, -1)
+}
+
+func writeZsh(out io.Writer, tool string, opts []options.CompletionOption) {
+	fn := "_" + tool
+	fmt.Fprintf(out, "#compdef %v\n", tool)
+	fmt.Fprintf(out, "# zsh completion for %v, generated by \"%v completion zsh\"\n\n", tool, tool)
+
+	fmt.Fprintf(out, "%v_names() {\n", fn)
+	fmt.Fprintf(out, "  local -a names\n")
+	fmt.Fprintf(out, "  names=(${(f)\"$(%v completion %v $1 -- ${(Q)words[1,CURRENT-1]} 2>/dev/null)\"})\n", tool, namesCommand)
+	fmt.Fprintf(out, "  compadd -a names\n")
+	fmt.Fprintf(out, "}\n\n")
+
+	fmt.Fprintf(out, "%v() {\n", fn)
+	fmt.Fprintf(out, "  _arguments \\\n")
+	descriptionEscaper := strings.NewReplacer("[", `\[`, "]", `\]`)
+	for _, o := range opts {
+		var specs []string
+		if o.Short != "" {
+			spec := "-" + o.Short
+			if o.TakesValue {
+				spec += "+"
+			}
+			specs = append(specs, spec)
+		}
+		if o.Long != "" {
+			spec := "--" + o.Long
+			if o.TakesValue {
+				spec += "="
+			}
+			specs = append(specs, spec)
+		}
+
+		var prefix string
+		switch {
+		case o.Repeatable:
+			prefix = "'*'"
+		case len(specs) > 1:
+			prefix = fmt.Sprintf("'(%v)'", strings.Join(flagNames(o), " "))
+		}
+		flags := "'" + specs[0] + "'"
+		if len(specs) > 1 {
+			flags = "{" + strings.Join(specs, ",") + "}"
+		}
+
+		spec := "[" + descriptionEscaper.Replace(summary(o.Description)) + "]"
+		if o.TakesValue {
+			message := o.Long
+			if message == "" {
+				message = o.Short
+			}
+			var action string
+			switch {
+			case len(o.Choices) > 0:
+				action = "(" + strings.Join(o.Choices, " ") + ")"
+			case o.Complete == options.CompleteFile:
+				action = "_files"
+			case o.Complete == options.CompleteDatabase || o.Complete == options.CompleteCollection:
+				action = fn + "_names " + o.Complete
+			default:
+				action = " "
+			}
+			spec += ":" + message + ":" + action
+		}
+		fmt.Fprintf(out, "    %v%v'%v' \\\n", prefix, flags, zshQuote(spec))
+	}
+	fmt.Fprintf(out, "    '*:argument:_files'\n")
+	fmt.Fprintf(out, "}\n\n")
+	fmt.Fprintf(out, "%v \"$@\"\n", fn)
+}
+
+// fishQuote quotes s as a single-quoted fish string.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+func writeFish(out io.Writer, tool string, opts []options.CompletionOption) {
+	fn := "__" + tool + "_names"
+	fmt.Fprintf(out, "# fish completion for %v, generated by \"%v completion fish\"\n\n", tool, tool)
+
+	fmt.Fprintf(out, "function %v\n", fn)
+	fmt.Fprintf(out, "    %v completion %v $argv[1] -- (commandline -opc) 2>/dev/null\n", tool, namesCommand)
+	fmt.Fprintf(out, "end\n\n")
+
+	for _, o := range opts {
+		line := "complete -c " + tool
+		if o.Long != "" {
+			line += " -l " + o.Long
+		}
+		if o.Short != "" {
+			line += " -s " + o.Short
+		}
+		line += " -d " + fishQuote(summary(o.Description))
+		if o.TakesValue {
+			switch {
+			case len(o.Choices) > 0:
+				line += " -x -a " + fishQuote(strings.Join(o.Choices, " "))
+			case o.Complete == options.CompleteFile:
+				line += " -r -F"
+			case o.Complete == options.CompleteDatabase || o.Complete == options.CompleteCollection:
+				line += " -x -a " + fishQuote("("+fn+" "+o.Complete+")")
+			default:
+				line += " -x"
+			}
+		}
+		fmt.Fprintln(out, line)
+	}
+}
+
+// powerShellQuote quotes s as a single-quoted PowerShell string.
+func powerShellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+func writePowerShell(out io.Writer, tool string, opts []options.CompletionOption) {
+	fmt.Fprintf(out, "# PowerShell completion for %v, generated by \"%v completion powershell\"\n\n", tool, tool)
+	fmt.Fprintf(out, "Register-ArgumentCompleter -Native -CommandName %v -ScriptBlock {\n", powerShellQuote(tool))
+	fmt.Fprintf(out, "    param($wordToComplete, $commandAst, $cursorPosition)\n")
+	fmt.Fprintf(out, "    $words = @($commandAst.CommandElements | Where-Object { $_.Extent.EndOffset -lt $cursorPosition } | ForEach-Object { $_.ToString() })\n")
+	fmt.Fprintf(out, "    $prev = $words[-1]\n")
+	fmt.Fprintf(out, "    $values = switch -Exact ($prev) {\n")
+	for _, o := range opts {
+		if !o.TakesValue {
+			continue
+		}
+		var values string
+		switch {
+		case len(o.Choices) > 0:
+			quoted := make([]string, len(o.Choices))
+			for i, choice := range o.Choices {
+				quoted[i] = powerShellQuote(choice)
+			}
+			values = strings.Join(quoted, ", ")
+		case o.Complete == options.CompleteDatabase || o.Complete == options.CompleteCollection:
+			values = fmt.Sprintf("& %v completion %v %v -- @words 2>$null", powerShellQuote(tool), namesCommand, o.Complete)
+		default:
+			continue
+		}
+		for _, name := range flagNames(o) {
+			fmt.Fprintf(out, "        %v { %v }\n", powerShellQuote(name), values)
+		}
+	}
+	fmt.Fprintf(out, "        default { $null }\n")
+	fmt.Fprintf(out, "    }\n")
+	fmt.Fprintf(out, "    if ($null -ne $values) {\n")
+	fmt.Fprintf(out, "        $values | Where-Object { $_ -like \"$wordToComplete*\" } | ForEach-Object {\n")
+	fmt.Fprintf(out, "            [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)\n")
+	fmt.Fprintf(out, "        }\n")
+	fmt.Fprintf(out, "        return\n")
+	fmt.Fprintf(out, "    }\n")
+	fmt.Fprintf(out, "    if ($wordToComplete -notlike '-*') {\n")
+	fmt.Fprintf(out, "        return\n")
+	fmt.Fprintf(out, "    }\n")
+	fmt.Fprintf(out, "    @(\n")
+	for _, o := range opts {
+		for _, name := range flagNames(o) {
+			fmt.Fprintf(out, "        ,@(%v, %v)\n", powerShellQuote(name), powerShellQuote(summary(o.Description)))
+		}
+	}
+	fmt.Fprintf(out, "    ) | Where-Object { $_[0] -like \"$wordToComplete*\" } | ForEach-Object {\n")
+	fmt.Fprintf(out, "        [System.Management.Automation.CompletionResult]::new($_[0], $_[0], 'ParameterName', $_[1])\n")
+	fmt.Fprintf(out, "    }\n")
+	fmt.Fprintf(out, "}\n")
+}
+
+// commandWords returns the words of the command line given to namesCommand,
+// either separately after "--" or as a single line after "--line".
+func commandWords(args []string) []string {
+	if len(args) == 2 && args[0] == "--line" {
+		return splitCommandLine(args[1])
+	}
+	if len(args) > 0 && args[0] == "--" {
+		return args[1:]
+	}
+	return args
+}
+
+// splitCommandLine splits a shell command line into words, removing quotes
+// and backslash escapes. A trailing unfinished word, which is being
+// completed, is dropped.
+func splitCommandLine(line string) []string {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	return words
+}
+
+// connectionGiven returns whether the words of a command line say which
+// server to connect to, which names are only listed for.
+func connectionGiven(words []string) bool {
+	for _, word := range words {
+		for _, prefix := range []string{"mongodb://", "mongodb+srv://", "--uri", "--host", "-h"} {
+			if strings.HasPrefix(word, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// printNames prints the names of the given kind, options.CompleteDatabase
+// or options.CompleteCollection, one per line, from the server that the
+// words of a command line of the tool connect to. Nothing is printed unless
+// the command line is complete enough to connect without prompting for a
+// password and, for collections, names a database.
+func printNames(opts *options.ToolOptions, kind string, words []string, out io.Writer) error {
+	// the first word is the tool itself
+	if len(words) > 0 {
+		words = words[1:]
+	}
+	// the last word is the option whose value is being completed, e.g. -c
+	if n := len(words); n > 0 && strings.HasPrefix(words[n-1], "-") && !strings.Contains(words[n-1], "=") {
+		words = words[:n-1]
+	}
+	if !connectionGiven(words) {
+		return nil
+	}
+	// the command line being completed is usually incomplete, and warnings
+	// about it would garble the completions
+	if _, err := opts.ParseArgs(words); err != nil {
+		return nil
+	}
+	if opts.Auth.ShouldAskForPassword() {
+		return nil
+	}
+	if kind == options.CompleteCollection && opts.Namespace.DB == "" {
+		return nil
+	}
+	opts.Connection.Timeout = int(namesTimeout / time.Second)
+	opts.Connection.ServerSelectionTimeout = int(namesTimeout / time.Second)
+
+	provider, err := db.NewSessionProvider(*opts)
+	if err != nil {
+		return err
+	}
+	defer provider.Close()
+	session, err := provider.GetSession()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), namesTimeout)
+	defer cancel()
+
+	var names []string
+	switch kind {
+	case options.CompleteDatabase:
+		names, err = session.ListDatabaseNames(ctx, bson.D{})
+	case options.CompleteCollection:
+		names, err = session.Database(opts.Namespace.DB).ListCollectionNames(ctx, bson.D{})
+	default:
+		return fmt.Errorf("unknown kind of name '%v'", kind)
+	}
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintln(out, name)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package completion
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWriteScript(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	opts := []options.CompletionOption{
+		{Long: "db", Short: "d", Description: "database to use", TakesValue: true, Complete: options.CompleteDatabase},
+		{Long: "type", Description: "the output format, either json or csv", TakesValue: true, Choices: []string{"json", "csv"}},
+		{Long: "out", Short: "o", Description: "output file; if not specified, stdout is used", TakesValue: true, Complete: options.CompleteFile},
+		{Long: "gzip", Description: "compress archive or collection output with Gzip"},
+		{Long: "excludeCollection", Description: "collection to exclude from the dump (may be specified multiple times)", TakesValue: true, Repeatable: true},
+	}
+	script := func(shell string) string {
+		out := &bytes.Buffer{}
+		So(WriteScript(out, shell, "mongotool", opts), ShouldBeNil)
+		return out.String()
+	}
+
+	Convey("bash scripts complete option names, choices and database names", t, func() {
+		bash := script("bash")
+		So(bash, ShouldContainSubstring, `compgen -W "-d --db --type -o --out --gzip --excludeCollection" -- "$cur"`)
+		So(bash, ShouldContainSubstring, "        -d|--db)\n            _mongotool_names database\n")
+		So(bash, ShouldContainSubstring, "        --type)\n            COMPREPLY=($(compgen -W \"json csv\" -- \"$cur\"))\n")
+		So(bash, ShouldContainSubstring, "complete -o default -F _mongotool mongotool\n")
+	})
+
+	Convey("zsh scripts describe each option", t, func() {
+		zsh := script("zsh")
+		So(zsh, ShouldStartWith, "#compdef mongotool\n")
+		So(zsh, ShouldContainSubstring, `'(-d --db)'{-d+,--db=}'[database to use]:db:_mongotool_names database'`)
+		So(zsh, ShouldContainSubstring, `'--type=''[the output format, either json or csv]:type:(json csv)'`)
+		So(zsh, ShouldContainSubstring, `'(-o --out)'{-o+,--out=}'[output file]:out:_files'`)
+		So(zsh, ShouldContainSubstring, `'--gzip''[compress archive or collection output with Gzip]'`)
+		So(zsh, ShouldContainSubstring, `'*''--excludeCollection=''[collection to exclude from the dump]:excludeCollection: '`)
+	})
+
+	Convey("fish scripts have a completion per option", t, func() {
+		fish := script("fish")
+		So(fish, ShouldContainSubstring, "complete -c mongotool -l db -s d -d 'database to use' -x -a '(__mongotool_names database)'\n")
+		So(fish, ShouldContainSubstring, "complete -c mongotool -l type -d 'the output format, either json or csv' -x -a 'json csv'\n")
+		So(fish, ShouldContainSubstring, "complete -c mongotool -l out -s o -d 'output file' -r -F\n")
+		So(fish, ShouldContainSubstring, "complete -c mongotool -l gzip -d 'compress archive or collection output with Gzip'\n")
+	})
+
+	Convey("PowerShell scripts register a completer", t, func() {
+		powershell := script("powershell")
+		So(powershell, ShouldContainSubstring, "Register-ArgumentCompleter -Native -CommandName 'mongotool'")
+		So(powershell, ShouldContainSubstring, "'--db' { & 'mongotool' completion __names database -- @words 2>$null }")
+		So(powershell, ShouldContainSubstring, "'--type' { 'json', 'csv' }")
+		So(powershell, ShouldContainSubstring, ",@('--gzip', 'compress archive or collection output with Gzip')")
+	})
+
+	Convey("other shells are not supported", t, func() {
+		So(WriteScript(&bytes.Buffer{}, "tcsh", "mongotool", opts), ShouldNotBeNil)
+	})
+}
+
+func TestCommandWords(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Command lines are split into words without the word being completed", t, func() {
+		So(splitCommandLine(`mongodump --uri 'mongodb://a:b@host/?x=1' -d "my db" --out=dump\ dir -c us`),
+			ShouldResemble, []string{"mongodump", "--uri", "mongodb://a:b@host/?x=1", "-d", "my db", "--out=dump dir", "-c"})
+		So(splitCommandLine("mongodump --db "), ShouldResemble, []string{"mongodump", "--db"})
+		So(commandWords([]string{"--line", "mongodump -d "}), ShouldResemble, []string{"mongodump", "-d"})
+		So(commandWords([]string{"--", "mongodump", "-d"}), ShouldResemble, []string{"mongodump", "-d"})
+	})
+
+	Convey("Names are only listed for command lines naming a server", t, func() {
+		So(connectionGiven([]string{"--uri=mongodb://host"}), ShouldBeTrue)
+		So(connectionGiven([]string{"mongodb+srv://cluster.example.com"}), ShouldBeTrue)
+		So(connectionGiven([]string{"-h", "host"}), ShouldBeTrue)
+		So(connectionGiven([]string{"--db", "test", "--gzip"}), ShouldBeFalse)
+
+		opts := options.New("mongotool", "", "", "", true, options.EnabledOptions{Auth: true, Connection: true, Namespace: true, URI: true})
+		out := &bytes.Buffer{}
+		So(printNames(opts, options.CompleteDatabase, []string{"mongotool", "--db"}, out), ShouldBeNil)
+		So(out.Len(), ShouldEqual, 0)
+	})
+}
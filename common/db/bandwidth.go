@@ -0,0 +1,151 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/text"
+)
+
+// ParseBandwidthLimit parses a --bwLimit of the form <size>/s, such as
+// 50MB/s, into bytes per second.
+func ParseBandwidthLimit(limit string) (int64, error) {
+	trimmed := strings.TrimSpace(limit)
+	if !strings.HasSuffix(strings.ToLower(trimmed), "/s") {
+		return 0, fmt.Errorf("invalid --bwLimit '%v': must be of the form <size>/s, e.g. 50MB/s", limit)
+	}
+	rate, err := text.ParseByteAmount(trimmed[:len(trimmed)-2])
+	if err != nil {
+		return 0, fmt.Errorf("invalid --bwLimit '%v': %v", limit, err)
+	}
+	return rate, nil
+}
+
+// bandwidthLimiter spreads the bytes sent and received over all of a
+// client's connections so that, together, they average no more than rate
+// bytes per second.
+type bandwidthLimiter struct {
+	rate int64
+
+	mu sync.Mutex
+	// next is when the bytes already accounted for will have been
+	// transferred at the limited rate
+	next time.Time
+
+	// now and sleep are replaced in tests
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+func newBandwidthLimiter(rate int64) *bandwidthLimiter {
+	return &bandwidthLimiter{
+		rate:  rate,
+		now:   time.Now,
+		sleep: time.Sleep,
+	}
+}
+
+// reserve accounts for n bytes, and returns how long to wait before
+// transferring them to keep to the rate.
+func (l *bandwidthLimiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.rate))
+	return wait
+}
+
+// wait blocks until n more bytes can be transferred, and returns how long it
+// waited.
+func (l *bandwidthLimiter) wait(n int) time.Duration {
+	if n <= 0 {
+		return 0
+	}
+	d := l.reserve(n)
+	if d > 0 {
+		l.sleep(d)
+	}
+	return d
+}
+
+// limitedDialer dials connections whose reads and writes share a
+// bandwidthLimiter.
+type limitedDialer struct {
+	dialer  *net.Dialer
+	limiter *bandwidthLimiter
+}
+
+// DialContext implements the driver's ContextDialer interface.
+func (d *limitedDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := d.dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &limitedConn{Conn: conn, limiter: d.limiter}, nil
+}
+
+// limitedConn is a net.Conn that waits for its limiter before each write,
+// and after each read so that the server is slowed by TCP flow control.
+//
+// The driver sets a deadline before reading or writing each message, on every
+// connection including those that monitor the servers, so the deadline is
+// pushed back by the time spent waiting for the limiter; otherwise a low
+// limit would make operations and heartbeats time out.
+type limitedConn struct {
+	net.Conn
+	limiter *bandwidthLimiter
+
+	// readDeadline and writeDeadline are the deadlines last set, extended by
+	// the waits since
+	readDeadline, writeDeadline time.Time
+}
+
+func (c *limitedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if waited := c.limiter.wait(n); waited > 0 && !c.readDeadline.IsZero() {
+		c.readDeadline = c.readDeadline.Add(waited)
+		if deadlineErr := c.Conn.SetReadDeadline(c.readDeadline); err == nil {
+			err = deadlineErr
+		}
+	}
+	return n, err
+}
+
+func (c *limitedConn) Write(b []byte) (int, error) {
+	if waited := c.limiter.wait(len(b)); waited > 0 && !c.writeDeadline.IsZero() {
+		c.writeDeadline = c.writeDeadline.Add(waited)
+		if err := c.Conn.SetWriteDeadline(c.writeDeadline); err != nil {
+			return 0, err
+		}
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *limitedConn) SetDeadline(t time.Time) error {
+	c.readDeadline, c.writeDeadline = t, t
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *limitedConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline = t
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *limitedConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline = t
+	return c.Conn.SetWriteDeadline(t)
+}
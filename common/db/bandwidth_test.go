@@ -0,0 +1,126 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package db
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseBandwidthLimit(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Bandwidth limits should be parsed as bytes per second", t, func() {
+		rate, err := ParseBandwidthLimit("50MB/s")
+		So(err, ShouldBeNil)
+		So(rate, ShouldEqual, 50*1024*1024)
+
+		rate, err = ParseBandwidthLimit(" 512kb/S ")
+		So(err, ShouldBeNil)
+		So(rate, ShouldEqual, 512*1024)
+
+		Convey("and invalid ones rejected", func() {
+			for _, limit := range []string{"", "50MB", "/s", "fast/s", "0/s", "-1MB/s"} {
+				_, err := ParseBandwidthLimit(limit)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestBandwidthLimiter(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a limiter of 1000 bytes per second on a fake clock", t, func() {
+		now := time.Date(2020, time.March, 2, 0, 0, 0, 0, time.UTC)
+		var slept []time.Duration
+		l := newBandwidthLimiter(1000)
+		l.now = func() time.Time { return now }
+		l.sleep = func(d time.Duration) {
+			slept = append(slept, d)
+			now = now.Add(d)
+		}
+
+		Convey("transfers should be spaced out to keep to the rate", func() {
+			l.wait(500)
+			l.wait(250)
+			l.wait(0)
+			l.wait(100)
+			So(slept, ShouldResemble, []time.Duration{500 * time.Millisecond, 250 * time.Millisecond})
+		})
+
+		Convey("idle time should not be saved up for a burst", func() {
+			l.wait(1000)
+			now = now.Add(time.Minute)
+			l.wait(1000)
+			l.wait(1000)
+			So(slept, ShouldResemble, []time.Duration{time.Second})
+		})
+	})
+}
+
+// deadlineConn is a net.Conn that records the deadlines set on it.
+type deadlineConn struct {
+	net.Conn
+	readDeadline, writeDeadline time.Time
+}
+
+func (c *deadlineConn) Read(b []byte) (int, error)  { return len(b), nil }
+func (c *deadlineConn) Write(b []byte) (int, error) { return len(b), nil }
+func (c *deadlineConn) SetDeadline(t time.Time) error {
+	c.readDeadline, c.writeDeadline = t, t
+	return nil
+}
+func (c *deadlineConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline = t
+	return nil
+}
+func (c *deadlineConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline = t
+	return nil
+}
+
+func TestLimitedConn(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a connection limited to 1000 bytes per second on a fake clock", t, func() {
+		now := time.Date(2020, time.March, 2, 0, 0, 0, 0, time.UTC)
+		l := newBandwidthLimiter(1000)
+		l.now = func() time.Time { return now }
+		l.sleep = func(d time.Duration) { now = now.Add(d) }
+		inner := &deadlineConn{}
+		conn := &limitedConn{Conn: inner, limiter: l}
+
+		Convey("deadlines should be extended by the time spent waiting", func() {
+			deadline := now.Add(time.Second)
+			So(conn.SetDeadline(deadline), ShouldBeNil)
+
+			_, err := conn.Write(make([]byte, 500))
+			So(err, ShouldBeNil)
+			So(inner.writeDeadline, ShouldEqual, deadline)
+			_, err = conn.Write(make([]byte, 500))
+			So(err, ShouldBeNil)
+			So(inner.writeDeadline, ShouldEqual, deadline.Add(500*time.Millisecond))
+
+			_, err = conn.Read(make([]byte, 250))
+			So(err, ShouldBeNil)
+			So(inner.readDeadline, ShouldEqual, deadline.Add(500*time.Millisecond))
+		})
+
+		Convey("no deadline should be set if none was", func() {
+			_, err := conn.Write(make([]byte, 500))
+			So(err, ShouldBeNil)
+			_, err = conn.Write(make([]byte, 500))
+			So(err, ShouldBeNil)
+			So(inner.writeDeadline.IsZero(), ShouldBeTrue)
+		})
+	})
+}
@@ -9,7 +9,9 @@ package db
 import (
 	"context"
 	"fmt"
+	"time"
 
+	"github.com/mongodb/mongo-tools/common/log"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -26,8 +28,20 @@ type BufferedBulkInserter struct {
 	docCount      int
 	bulkWriteOpts *options.BulkWriteOptions
 	upsert        bool
+
+	// how many times, and after what initial delay, to retry a bulk write
+	// that failed with a transient error
+	maxRetries   int
+	retryBackoff time.Duration
+	retries      uint64
+
+	// called with the outcome of each bulk write, if set
+	flushHook func(result *mongo.BulkWriteResult, err error)
 }
 
+// maxRetryBackoff caps the exponentially growing delay between retries.
+const maxRetryBackoff = time.Minute
+
 func newBufferedBulkInserter(collection *mongo.Collection, docLimit int, ordered bool) *BufferedBulkInserter {
 	bb := &BufferedBulkInserter{
 		collection:    collection,
@@ -63,6 +77,33 @@ func (bb *BufferedBulkInserter) SetUpsert(upsert bool) *BufferedBulkInserter {
 	return bb
 }
 
+// SetRetryPolicy makes the inserter retry a bulk write that fails with a
+// transient error up to maxRetries times, doubling the delay between attempts
+// starting from backoff. The whole batch is written again on each retry.
+func (bb *BufferedBulkInserter) SetRetryPolicy(maxRetries int, backoff time.Duration) *BufferedBulkInserter {
+	bb.maxRetries = maxRetries
+	bb.retryBackoff = backoff
+	return bb
+}
+
+// SetFlushHook sets a function that is called with the result of each bulk
+// write, after any retries, before the buffer is reset.
+func (bb *BufferedBulkInserter) SetFlushHook(hook func(result *mongo.BulkWriteResult, err error)) *BufferedBulkInserter {
+	bb.flushHook = hook
+	return bb
+}
+
+// Retries returns the number of times a bulk write has been retried.
+func (bb *BufferedBulkInserter) Retries() uint64 {
+	return bb.retries
+}
+
+// Buffered returns the number of documents waiting to be written by the next
+// flush.
+func (bb *BufferedBulkInserter) Buffered() int {
+	return bb.docCount
+}
+
 // throw away the old bulk and init a new one
 func (bb *BufferedBulkInserter) resetBulk() {
 	bb.writeModels = bb.writeModels[:0]
@@ -124,5 +165,20 @@ func (bb *BufferedBulkInserter) Flush() (*mongo.BulkWriteResult, error) {
 	}
 
 	defer bb.resetBulk()
-	return bb.collection.BulkWrite(context.Background(), bb.writeModels, bb.bulkWriteOpts)
+	result, err := bb.collection.BulkWrite(context.Background(), bb.writeModels, bb.bulkWriteOpts)
+	delay := bb.retryBackoff
+	for attempt := 1; attempt <= bb.maxRetries && IsTransientError(err); attempt++ {
+		log.Logvf(log.Always, "transient error writing batch of %v documents, retrying in %v (attempt %v of %v): %v",
+			bb.docCount, delay, attempt, bb.maxRetries, err)
+		time.Sleep(delay)
+		if delay *= 2; delay > maxRetryBackoff {
+			delay = maxRetryBackoff
+		}
+		bb.retries++
+		result, err = bb.collection.BulkWrite(context.Background(), bb.writeModels, bb.bulkWriteOpts)
+	}
+	if bb.flushHook != nil {
+		bb.flushHook(result, err)
+	}
+	return result, err
 }
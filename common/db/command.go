@@ -9,11 +9,13 @@ package db
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/mongodb/mongo-tools/common/bsonutil"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	mopt "go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 // Query flags
@@ -160,6 +162,50 @@ func (sp *SessionProvider) GetNodeType() (NodeType, error) {
 	return Standalone, nil
 }
 
+// ClusterTime returns the operationTime the server reports for an isMaster
+// command, which can be used to pin subsequent reads to a point in time.
+// Standalone servers do not report an operationTime.
+func (sp *SessionProvider) ClusterTime() (primitive.Timestamp, error) {
+	session, err := sp.GetSession()
+	if err != nil {
+		return primitive.Timestamp{}, err
+	}
+	reply := struct {
+		OperationTime primitive.Timestamp `bson:"operationTime"`
+	}{}
+	result := session.Database("admin").RunCommand(
+		context.Background(),
+		&bson.M{"ismaster": 1},
+	)
+	if result.Err() != nil {
+		return primitive.Timestamp{}, result.Err()
+	}
+	if err = result.Decode(&reply); err != nil {
+		return primitive.Timestamp{}, err
+	}
+	if reply.OperationTime.T == 0 && reply.OperationTime.I == 0 {
+		return primitive.Timestamp{}, fmt.Errorf("server did not report a cluster time; a replica set or sharded cluster is required")
+	}
+	return reply.OperationTime, nil
+}
+
+// CanSelectServer returns nil if a server matching the given read preference
+// can be selected within the timeout, and the selection error otherwise.
+func (sp *SessionProvider) CanSelectServer(pref *readpref.ReadPref, timeout time.Duration) error {
+	session, err := sp.GetSession()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	result := session.Database("admin").RunCommand(
+		ctx,
+		&bson.M{"ping": 1},
+		mopt.RunCmd().SetReadPreference(pref),
+	)
+	return result.Err()
+}
+
 // IsReplicaSet returns a boolean which is true if the connected server is part
 // of a replica set.
 func (sp *SessionProvider) IsReplicaSet() (bool, error) {
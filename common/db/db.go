@@ -17,10 +17,13 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
+	"os"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/mongodb/mongo-tools/common/exitcode"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/password"
@@ -77,6 +80,22 @@ const (
 
 var ignorableWriteErrorCodes = map[int]bool{ErrDuplicateKeyCode: true, ErrFailedDocumentValidation: true}
 
+// transientErrorCodes are server error codes caused by network problems,
+// elections, or shutdowns, after which an operation may succeed if retried.
+var transientErrorCodes = map[int]bool{
+	6:     true, // HostUnreachable
+	7:     true, // HostNotFound
+	89:    true, // NetworkTimeout
+	91:    true, // ShutdownInProgress
+	189:   true, // PrimarySteppedDown
+	9001:  true, // SocketException
+	10107: true, // NotWritablePrimary
+	11600: true, // InterruptedAtShutdown
+	11602: true, // InterruptedDueToReplStateChange
+	13435: true, // NotPrimaryNoSecondaryOk
+	13436: true, // NotPrimaryOrSecondary
+}
+
 const (
 	continueThroughErrorFormat = "continuing through error: %v"
 )
@@ -87,6 +106,9 @@ type SessionProvider struct {
 
 	// the master client used for operations
 	client *mongo.Client
+
+	// the file TLS session secrets are written to with --tlsKeyLogFile
+	keyLog *os.File
 }
 
 // Returns a mongo.Client connected to the database server for which the
@@ -110,6 +132,10 @@ func (sp *SessionProvider) Close() {
 		_ = sp.client.Disconnect(context.Background())
 		sp.client = nil
 	}
+	if sp.keyLog != nil {
+		_ = sp.keyLog.Close()
+		sp.keyLog = nil
+	}
 }
 
 // DB provides a database with the default read preference
@@ -128,21 +154,40 @@ func NewSessionProvider(opts options.ToolOptions) (*SessionProvider, error) {
 		opts.Auth.Password = pass
 	}
 
-	client, err := configureClient(opts)
+	var keyLog *os.File
+	if opts.SSL != nil && opts.UseSSL && opts.TLSKeyLogFile != "" {
+		var err error
+		keyLog, err = os.OpenFile(opts.TLSKeyLogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, exitcode.Validation(fmt.Errorf("error configuring the connector: error opening TLS key log file: %w", err))
+		}
+	}
+	provider, err := newSessionProvider(opts, keyLog)
+	if err != nil && keyLog != nil {
+		_ = keyLog.Close()
+	}
+	return provider, err
+}
+
+// newSessionProvider constructs a session provider with a connected client,
+// which writes TLS session secrets to keyLog if it is not nil. The provider
+// closes keyLog when it is closed.
+func newSessionProvider(opts options.ToolOptions, keyLog *os.File) (*SessionProvider, error) {
+	client, err := configureClient(opts, keyLog)
 	if err != nil {
-		return nil, fmt.Errorf("error configuring the connector: %v", err)
+		return nil, exitcode.Validation(fmt.Errorf("error configuring the connector: %w", err))
 	}
 	err = client.Connect(context.Background())
 	if err != nil {
-		return nil, err
+		return nil, exitcode.Connection(err)
 	}
 	err = client.Ping(context.Background(), nil)
 	if err != nil {
-		return nil, fmt.Errorf("could not connect to server: %v", err)
+		return nil, exitcode.Connection(fmt.Errorf("could not connect to server: %w", err))
 	}
 
 	// create the provider
-	return &SessionProvider{client: client}, nil
+	return &SessionProvider{client: client, keyLog: keyLog}, nil
 }
 
 // addClientCertFromFile adds a client certificate to the configuration given a path to the
@@ -282,7 +327,8 @@ func addCACertsFromFile(cfg *tls.Config, file string) error {
 }
 
 // configure the client according to the options set in the uri and in the provided ToolOptions, with ToolOptions having precedence.
-func configureClient(opts options.ToolOptions) (*mongo.Client, error) {
+// TLS session secrets are written to keyLog if it is not nil.
+func configureClient(opts options.ToolOptions, keyLog *os.File) (*mongo.Client, error) {
 	if opts.URI == nil || opts.URI.ConnectionString == "" {
 		// XXX Normal operations shouldn't ever reach here because a URI should
 		// be created in options parsing, but tests still manually construct
@@ -324,6 +370,17 @@ func configureClient(opts options.ToolOptions) (*mongo.Client, error) {
 		clientopt.SetWriteConcern(writeconcern.New(writeconcern.WMajority()))
 	}
 
+	if opts.BandwidthLimit != "" {
+		rate, err := ParseBandwidthLimit(opts.BandwidthLimit)
+		if err != nil {
+			return nil, err
+		}
+		clientopt.SetDialer(&limitedDialer{
+			dialer:  &net.Dialer{Timeout: time.Duration(opts.Timeout) * time.Second},
+			limiter: newBandwidthLimiter(rate),
+		})
+	}
+
 	if opts.Compressors != "" && opts.Compressors != "none" {
 		clientopt.SetCompressors(strings.Split(opts.Compressors, ","))
 	}
@@ -441,9 +498,6 @@ func configureClient(opts options.ToolOptions) (*mongo.Client, error) {
 
 	if opts.SSL != nil && opts.UseSSL {
 		// Error on unsupported features
-		if opts.SSLFipsMode {
-			return nil, fmt.Errorf("FIPS mode not supported")
-		}
 		if opts.SSLCRLFile != "" {
 			return nil, fmt.Errorf("CRL files are not supported on this platform")
 		}
@@ -453,6 +507,24 @@ func configureClient(opts options.ToolOptions) (*mongo.Client, error) {
 			tlsConfig.InsecureSkipVerify = true
 		}
 
+		if opts.UseFIPSMode() {
+			if opts.TLSKeyLogFile != "" {
+				return nil, fmt.Errorf("--tlsKeyLogFile cannot be used in FIPS mode")
+			}
+			if err := configureFIPS(tlsConfig); err != nil {
+				return nil, err
+			}
+		}
+
+		if keyLog != nil {
+			log.Logvf(log.Always, "WARNING: writing TLS session secrets to %v; anyone with this file can decrypt captured traffic", opts.TLSKeyLogFile)
+			tlsConfig.KeyLogWriter = keyLog
+		}
+
+		if opts.TLSRequireOCSPStapling {
+			tlsConfig.VerifyConnection = requireStapledOCSPResponse
+		}
+
 		var x509Subject string
 		var keyPasswd string
 		var err error
@@ -489,6 +561,15 @@ func configureClient(opts options.ToolOptions) (*mongo.Client, error) {
 	return mongo.NewClient(clientopt)
 }
 
+// requireStapledOCSPResponse rejects TLS connections to servers which did not
+// staple an OCSP response. The driver verifies stapled responses itself.
+func requireStapledOCSPResponse(state tls.ConnectionState) error {
+	if len(state.OCSPResponse) == 0 {
+		return fmt.Errorf("server did not staple an OCSP response to its certificate")
+	}
+	return nil
+}
+
 // FilterError determines whether an error needs to be propagated back to the user or can be continued through. If an
 // error cannot be ignored, a non-nil error is returned. If an error can be continued through, it is logged and nil is
 // returned.
@@ -543,6 +624,52 @@ func CanIgnoreError(err error) bool {
 	return false
 }
 
+// IsTransientError returns whether the given error was caused by a network
+// error, a primary stepdown, or a server shutdown, such that the operation
+// which produced it may succeed if it is retried.
+func IsTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	switch mongoErr := err.(type) {
+	case mongo.CommandError:
+		return mongoErr.HasErrorLabel("NetworkError") ||
+			mongoErr.HasErrorLabel("RetryableWriteError") ||
+			transientErrorCodes[int(mongoErr.Code)]
+	case mongo.WriteException:
+		if mongoErr.HasErrorLabel("NetworkError") || mongoErr.HasErrorLabel("RetryableWriteError") {
+			return true
+		}
+		if mongoErr.WriteConcernError != nil && transientErrorCodes[mongoErr.WriteConcernError.Code] {
+			return true
+		}
+		for _, writeErr := range mongoErr.WriteErrors {
+			if transientErrorCodes[writeErr.Code] {
+				return true
+			}
+		}
+	case mongo.BulkWriteException:
+		if mongoErr.HasErrorLabel("NetworkError") || mongoErr.HasErrorLabel("RetryableWriteError") {
+			return true
+		}
+		if mongoErr.WriteConcernError != nil && transientErrorCodes[mongoErr.WriteConcernError.Code] {
+			return true
+		}
+		for _, writeErr := range mongoErr.WriteErrors {
+			if transientErrorCodes[writeErr.Code] {
+				return true
+			}
+		}
+	}
+
+	errStr := err.Error()
+	return strings.Contains(errStr, ErrLostConnection) ||
+		strings.Contains(errStr, ErrNoReachableServers) ||
+		strings.Contains(errStr, ErrNotMaster) ||
+		strings.HasSuffix(errStr, ErrConnectionRefusedSuffix)
+}
+
 // IsMMAPV1 returns whether the storage engine is MMAPV1. Also returns false
 // if the storage engine type cannot be determined for some reason.
 func IsMMAPV1(database *mongo.Database, collectionName string) (bool, error) {
@@ -8,6 +8,7 @@ package db
 
 import (
 	"context"
+	"errors"
 	"io/ioutil"
 	"os"
 	"testing"
@@ -18,6 +19,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/testtype"
 	. "github.com/smartystreets/goconvey/convey"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // var block and functions copied from testutil to avoid import cycle
@@ -133,7 +135,7 @@ func TestConfigureClientForSRV(t *testing.T) {
 		_, err := toolOptions.ParseArgs([]string{"--uri", "mongodb://foo/?authSource=admin", "--username", "bar"})
 		So(err, ShouldBeNil)
 
-		_, err = configureClient(*toolOptions)
+		_, err = configureClient(*toolOptions, nil)
 		So(err, ShouldBeNil)
 	})
 
@@ -449,7 +451,30 @@ func TestConfigureClientMultipleHosts(t *testing.T) {
 		_, err := toolOptions.ParseArgs([]string{"--uri", "mongodb://localhost:27017,localhost:27018/test"})
 		So(err, ShouldBeNil)
 
-		_, err = configureClient(*toolOptions)
+		_, err = configureClient(*toolOptions, nil)
 		So(err, ShouldBeNil)
 	})
 }
+
+func TestIsTransientError(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Transient errors should be detected", t, func() {
+		So(IsTransientError(nil), ShouldBeFalse)
+		So(IsTransientError(errors.New("something else")), ShouldBeFalse)
+		So(IsTransientError(errors.New(ErrLostConnection)), ShouldBeTrue)
+		So(IsTransientError(mongo.CommandError{Code: 91}), ShouldBeTrue)
+		So(IsTransientError(mongo.CommandError{Code: 11600}), ShouldBeTrue)
+		So(IsTransientError(mongo.CommandError{Labels: []string{"NetworkError"}}), ShouldBeTrue)
+		So(IsTransientError(mongo.CommandError{Code: ErrDuplicateKeyCode}), ShouldBeFalse)
+
+		stepdown := mongo.BulkWriteException{
+			WriteConcernError: &mongo.WriteConcernError{Code: 189},
+		}
+		So(IsTransientError(stepdown), ShouldBeTrue)
+		duplicate := mongo.BulkWriteException{
+			WriteErrors: []mongo.BulkWriteError{{WriteError: mongo.WriteError{Code: ErrDuplicateKeyCode}}},
+		}
+		So(IsTransientError(duplicate), ShouldBeFalse)
+	})
+}
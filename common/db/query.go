@@ -8,10 +8,18 @@ import (
 
 // DeferredQuery represents a deferred query
 type DeferredQuery struct {
-	Coll      *mongo.Collection
-	Filter    interface{}
-	Hint      interface{}
-	LogReplay bool
+	Coll       *mongo.Collection
+	Filter     interface{}
+	Hint       interface{}
+	Projection interface{}
+	LogReplay  bool
+
+	// BatchSize, if positive, limits the number of documents in each batch
+	// returned by the server.
+	BatchSize int32
+	// NoCursorTimeout keeps the server from closing the cursor while it is
+	// idle, e.g. when the client pauses between batches.
+	NoCursorTimeout bool
 }
 
 // Count issues a EstimatedDocumentCount command when there is no Filter in the query and a CountDocuments command otherwise.
@@ -43,9 +51,18 @@ func (q *DeferredQuery) Iter() (*mongo.Cursor, error) {
 	if q.Hint != nil {
 		opts.SetHint(q.Hint)
 	}
+	if q.Projection != nil {
+		opts.SetProjection(q.Projection)
+	}
 	if q.LogReplay {
 		opts.SetOplogReplay(true)
 	}
+	if q.BatchSize > 0 {
+		opts.SetBatchSize(q.BatchSize)
+	}
+	if q.NoCursorTimeout {
+		opts.SetNoCursorTimeout(true)
+	}
 	filter := q.Filter
 	if filter == nil {
 		filter = bson.D{}
@@ -8,6 +8,7 @@ package db
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/mongodb/mongo-tools/common/json"
@@ -31,7 +32,11 @@ const (
 // NewReadPreference takes a string (command line read preference argument) and a ConnString (from the command line
 // URI argument) and returns a ReadPref. If both are provided, preference is given to the command line argument. If
 // both are empty, a default read preference of primary will be returned.
+//
+// The command line argument may be a bare mode (e.g. 'nearest'), a json object (e.g. '{mode: "nearest"}'), or a
+// mode followed by the remaining json fields (e.g. 'secondary, tagSets: [{backup: "true"}], maxStalenessSeconds: 120').
 func NewReadPreference(rp string, cs *connstring.ConnString) (*readpref.ReadPref, error) {
+	rp = strings.TrimSpace(rp)
 	if rp == "" && (cs == nil || cs.ReadPreference == "") {
 		return readpref.Primary(), nil
 	}
@@ -40,6 +45,11 @@ func NewReadPreference(rp string, cs *connstring.ConnString) (*readpref.ReadPref
 		return readPrefFromConnString(cs)
 	}
 
+	if i := strings.Index(rp, ","); rp[0] != '{' && i >= 0 {
+		// expand the "<mode>, <field>: <value>, ..." shorthand into a json object
+		rp = fmt.Sprintf("{mode: %q, %s}", strings.TrimSpace(rp[:i]), rp[i+1:])
+	}
+
 	var mode string
 	var options []readpref.Option
 	if rp[0] != '{' {
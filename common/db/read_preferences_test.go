@@ -97,5 +97,23 @@ func TestNewReadPreference(t *testing.T) {
 			So(set, ShouldBeTrue)
 			So(maxStaleness, ShouldEqual, 123*time.Second)
 		})
+
+		Convey("Specifying a mode followed by json fields on the command line should set it correctly", func() {
+			rp := "secondaryPreferred, tagSets: [{backup: \"true\"}], maxStalenessSeconds: 120"
+			pref, err := NewReadPreference(rp, cs)
+			So(err, ShouldBeNil)
+			So(pref.Mode(), ShouldEqual, readpref.SecondaryPreferredMode)
+
+			tagSets := pref.TagSets()
+			So(len(tagSets), ShouldEqual, 1)
+			So(tagSets[0], ShouldResemble, tag.Set{tag.Tag{Name: "backup", Value: "true"}})
+
+			maxStaleness, set := pref.MaxStaleness()
+			So(set, ShouldBeTrue)
+			So(maxStaleness, ShouldEqual, 120*time.Second)
+
+			_, err = NewReadPreference("secondary, tagSets: [{backup:", nil)
+			So(err, ShouldNotBeNil)
+		})
 	})
 }
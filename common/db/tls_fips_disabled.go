@@ -0,0 +1,20 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// +build !boringcrypto
+
+package db
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+// configureFIPS returns an error, since FIPS mode requires the tools to be
+// built against a FIPS-validated crypto backend with the boringcrypto tag.
+func configureFIPS(config *tls.Config) error {
+	return fmt.Errorf("FIPS mode not supported: tool not built with a FIPS-validated crypto backend")
+}
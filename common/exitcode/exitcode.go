@@ -0,0 +1,137 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// Package exitcode determines the exit code of a tool from the error it
+// ended with, so that scripts wrapping a tool can tell why it failed without
+// parsing its log output. The exit codes are defined in the util package.
+package exitcode
+
+import (
+	"errors"
+
+	"github.com/mongodb/mongo-tools/common/signals"
+	"github.com/mongodb/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/auth"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+// Server error codes that mean authentication or authorization failed.
+const (
+	errCodeUnauthorized         = 13
+	errCodeAuthenticationFailed = 18
+)
+
+// Error is an error that determines the exit code of a tool.
+type Error struct {
+	Code int
+	Err  error
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func withCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err}
+}
+
+// Validation marks err as caused by invalid options or input, unless it
+// already has a more specific exit code, as when validating the options
+// needs the server.
+func Validation(err error) error {
+	if Of(err) != util.ExitFailure {
+		return err
+	}
+	return withCode(util.ExitValidationFailure, err)
+}
+
+// Connection marks err as a failure to connect to the server. Since the
+// driver authenticates as it connects, an err caused by authentication is
+// marked as an auth failure instead.
+func Connection(err error) error {
+	if IsAuthError(err) {
+		return withCode(util.ExitAuthFailure, err)
+	}
+	return withCode(util.ExitConnectionFailure, err)
+}
+
+// Partial marks err as ending an operation that was partly applied. It
+// leaves an auth failure or abort as it is, since those say more about why
+// the operation stopped.
+func Partial(err error) error {
+	switch Of(err) {
+	case util.ExitAuthFailure, util.ExitAborted:
+		return err
+	}
+	return withCode(util.ExitPartialSuccess, err)
+}
+
+// IsAuthError returns whether err was caused by the server rejecting the
+// credentials given, or by the user lacking a privilege.
+func IsAuthError(err error) bool {
+	var authErr *auth.Error
+	if errors.As(err, &authErr) {
+		return true
+	}
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) {
+		return commandErr.Code == errCodeUnauthorized || commandErr.Code == errCodeAuthenticationFailed
+	}
+	return false
+}
+
+// classes are the short names of the exit codes used in reports.
+var classes = map[int]string{
+	util.ExitSuccess:           "success",
+	util.ExitFailure:           "failure",
+	util.ExitValidationFailure: "validation",
+	util.ExitConnectionFailure: "connection",
+	util.ExitAuthFailure:       "auth",
+	util.ExitPartialSuccess:    "partial",
+	util.ExitAborted:           "aborted",
+}
+
+// Class returns a short name for the exit code of err, such as "connection"
+// or "auth", for reports that list errors.
+func Class(err error) string {
+	return classes[Of(err)]
+}
+
+// Of returns the exit code for a tool that ended with err. Any error is
+// reported as an abort once the tool has received a signal.
+func Of(err error) int {
+	if err == nil {
+		return util.ExitSuccess
+	}
+	if signals.Interrupted() {
+		return util.ExitAborted
+	}
+	var codeErr *Error
+	if errors.As(err, &codeErr) {
+		return codeErr.Code
+	}
+	if errors.Is(err, util.ErrTerminated) {
+		return util.ExitAborted
+	}
+	if IsAuthError(err) {
+		return util.ExitAuthFailure
+	}
+	var connErr topology.ConnectionError
+	if errors.As(err, &connErr) || errors.Is(err, mongo.ErrClientDisconnected) {
+		return util.ExitConnectionFailure
+	}
+	return util.ExitFailure
+}
@@ -0,0 +1,62 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package exitcode
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/mongodb/mongo-tools/common/util"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/auth"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+func TestOf(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("The exit code for an error", t, func() {
+		plain := errors.New("something went wrong")
+
+		Convey("should be success for no error and failure for an unclassified one", func() {
+			So(Of(nil), ShouldEqual, util.ExitSuccess)
+			So(Of(plain), ShouldEqual, util.ExitFailure)
+		})
+
+		Convey("should be the code it was marked with, through wrapping", func() {
+			So(Of(Validation(plain)), ShouldEqual, util.ExitValidationFailure)
+			So(Of(Connection(plain)), ShouldEqual, util.ExitConnectionFailure)
+			So(Of(Partial(plain)), ShouldEqual, util.ExitPartialSuccess)
+			So(Of(fmt.Errorf("error connecting to host: %w", Connection(plain))), ShouldEqual, util.ExitConnectionFailure)
+			So(Of(util.SetupError{Err: Validation(plain)}), ShouldEqual, util.ExitValidationFailure)
+		})
+
+		Convey("should classify errors from the driver", func() {
+			So(Of(topology.ConnectionError{Wrapped: plain}), ShouldEqual, util.ExitConnectionFailure)
+			So(Of(topology.ConnectionError{Wrapped: &auth.Error{}}), ShouldEqual, util.ExitAuthFailure)
+			So(Of(mongo.CommandError{Code: 18, Name: "AuthenticationFailed"}), ShouldEqual, util.ExitAuthFailure)
+			So(Of(mongo.CommandError{Code: 13, Name: "Unauthorized"}), ShouldEqual, util.ExitAuthFailure)
+			So(Of(mongo.CommandError{Code: 26, Name: "NamespaceNotFound"}), ShouldEqual, util.ExitFailure)
+			So(Of(fmt.Errorf("error reading: %w", util.ErrTerminated)), ShouldEqual, util.ExitAborted)
+		})
+
+		Convey("should keep a more specific cause when marked", func() {
+			So(Of(Connection(&auth.Error{})), ShouldEqual, util.ExitAuthFailure)
+			So(Of(Validation(Connection(plain))), ShouldEqual, util.ExitConnectionFailure)
+			So(Of(Partial(mongo.CommandError{Code: 13})), ShouldEqual, util.ExitAuthFailure)
+			So(Of(Partial(Connection(plain))), ShouldEqual, util.ExitPartialSuccess)
+		})
+
+		Convey("should keep its message", func() {
+			So(Validation(plain).Error(), ShouldEqual, plain.Error())
+			So(Validation(nil), ShouldBeNil)
+		})
+	})
+}
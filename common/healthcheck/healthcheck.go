@@ -0,0 +1,251 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// Package healthcheck implements the --healthCheck mode of the tools, which
+// validates the connection, credentials and privileges needed for an
+// operation without performing it.
+package healthcheck
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Resource is a resource that privileges are granted on, as in a role's
+// privileges. An empty DB or Collection stands for every database or every
+// collection.
+type Resource struct {
+	DB          string `bson:"db"`
+	Collection  string `bson:"collection"`
+	Cluster     bool   `bson:"cluster"`
+	AnyResource bool   `bson:"anyResource"`
+}
+
+func (r Resource) String() string {
+	switch {
+	case r.AnyResource:
+		return "any resource"
+	case r.Cluster:
+		return "the cluster"
+	case r.DB == "" && r.Collection == "":
+		return "all databases"
+	case r.Collection == "":
+		return fmt.Sprintf("database %v", r.DB)
+	case r.DB == "":
+		return fmt.Sprintf("collection %v in all databases", r.Collection)
+	}
+	return fmt.Sprintf("collection %v.%v", r.DB, r.Collection)
+}
+
+// Requirement is a set of actions that a tool needs to perform on a resource
+// for its intended operation.
+type Requirement struct {
+	Resource Resource
+	Actions  []string
+	// Purpose describes why the tool needs the actions, e.g. "read the
+	// collections to dump".
+	Purpose string
+}
+
+// Privilege is a privilege held by the authenticated user, as reported by
+// the connectionStatus command.
+type Privilege struct {
+	Resource Resource `bson:"resource"`
+	Actions  []string `bson:"actions"`
+}
+
+// Check is the outcome of one step of a health check.
+type Check struct {
+	Name   string
+	Passed bool
+	// Skipped checks are those that could not be run because an earlier
+	// check failed, or that do not apply.
+	Skipped bool
+	Detail  string
+}
+
+// Report is the outcome of a health check.
+type Report struct {
+	Checks []Check
+}
+
+// OK returns whether no check failed.
+func (r *Report) OK() bool {
+	for _, check := range r.Checks {
+		if !check.Passed && !check.Skipped {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Report) add(name string, passed bool, format string, args ...interface{}) {
+	r.Checks = append(r.Checks, Check{Name: name, Passed: passed, Detail: fmt.Sprintf(format, args...)})
+}
+
+func (r *Report) skip(name string, format string, args ...interface{}) {
+	r.Checks = append(r.Checks, Check{Name: name, Skipped: true, Detail: fmt.Sprintf(format, args...)})
+}
+
+// Write prints one line for each check of the report, followed by the
+// overall result.
+func (r *Report) Write(w io.Writer) {
+	for _, check := range r.Checks {
+		status := "FAIL"
+		if check.Skipped {
+			status = "SKIP"
+		} else if check.Passed {
+			status = " OK "
+		}
+		fmt.Fprintf(w, "[%v] %v: %v\n", status, check.Name, check.Detail)
+	}
+	if r.OK() {
+		fmt.Fprintln(w, "health check passed")
+	} else {
+		fmt.Fprintln(w, "health check failed")
+	}
+}
+
+// connectionStatus holds the fields of the connectionStatus command used by
+// the health check.
+type connectionStatus struct {
+	AuthInfo struct {
+		AuthenticatedUsers []struct {
+			User string `bson:"user"`
+			DB   string `bson:"db"`
+		} `bson:"authenticatedUsers"`
+		AuthenticatedUserPrivileges []Privilege `bson:"authenticatedUserPrivileges"`
+	} `bson:"authInfo"`
+}
+
+// Run connects to the server with opts, authenticating if credentials are
+// given, and checks that the authenticated user holds each of the required
+// privileges.
+func Run(opts options.ToolOptions, requirements []Requirement) *Report {
+	report := &Report{}
+
+	sessionProvider, err := db.NewSessionProvider(opts)
+	if err != nil {
+		report.add("connect", false, "%v", err)
+		report.skip("authenticate", "not connected")
+		return report
+	}
+	defer sessionProvider.Close()
+
+	version, err := sessionProvider.ServerVersion()
+	if err != nil {
+		version = "unknown version"
+	}
+	report.add("connect", true, "connected to server version %v", version)
+
+	var status connectionStatus
+	command := bson.D{{Key: "connectionStatus", Value: 1}, {Key: "showPrivileges", Value: true}}
+	if err = sessionProvider.Run(command, &status, "admin"); err != nil {
+		report.add("authenticate", false, "error running connectionStatus: %v", err)
+		return report
+	}
+	users := status.AuthInfo.AuthenticatedUsers
+	if len(users) == 0 {
+		if opts.Auth != nil && opts.Auth.IsSet() {
+			report.add("authenticate", false, "credentials were given but no user is authenticated")
+		} else {
+			report.skip("authenticate", "no credentials given; privileges are not checked")
+		}
+		return report
+	}
+	names := make([]string, len(users))
+	for i, user := range users {
+		names[i] = user.User + "@" + user.DB
+	}
+	report.add("authenticate", true, "authenticated as %v", strings.Join(names, ", "))
+
+	for _, requirement := range requirements {
+		name := fmt.Sprintf("privileges on %v", requirement.Resource)
+		if missing := MissingActions(status.AuthInfo.AuthenticatedUserPrivileges, requirement); len(missing) > 0 {
+			report.add(name, false, "missing %v, needed to %v", strings.Join(missing, ", "), requirement.Purpose)
+		} else {
+			report.add(name, true, "%v, needed to %v", strings.Join(requirement.Actions, ", "), requirement.Purpose)
+		}
+	}
+	return report
+}
+
+// Main runs a health check for a tool, prints its report to stdout and
+// returns the tool's exit code.
+func Main(opts options.ToolOptions, requirements []Requirement) int {
+	report := Run(opts, requirements)
+	report.Write(os.Stdout)
+	return report.ExitCode()
+}
+
+// ExitCode returns the exit code for the first failed check: a connection
+// failure if the tool could not connect, and otherwise an auth failure.
+func (r *Report) ExitCode() int {
+	for _, check := range r.Checks {
+		if check.Passed || check.Skipped {
+			continue
+		}
+		if check.Name == "connect" {
+			return util.ExitConnectionFailure
+		}
+		return util.ExitAuthFailure
+	}
+	return util.ExitSuccess
+}
+
+// MissingActions returns the actions of requirement that none of privileges
+// grant on its resource.
+func MissingActions(privileges []Privilege, requirement Requirement) []string {
+	var missing []string
+	for _, action := range requirement.Actions {
+		granted := false
+		for _, privilege := range privileges {
+			if covers(privilege.Resource, requirement.Resource) && hasAction(privilege.Actions, action) {
+				granted = true
+				break
+			}
+		}
+		if !granted {
+			missing = append(missing, action)
+		}
+	}
+	return missing
+}
+
+func hasAction(actions []string, action string) bool {
+	for _, a := range actions {
+		if a == action || a == "anyAction" {
+			return true
+		}
+	}
+	return false
+}
+
+// covers returns whether a privilege granted on resource applies to all of
+// required. Privileges on every collection do not apply to system
+// collections, which must be named.
+func covers(resource, required Resource) bool {
+	if resource.AnyResource {
+		return true
+	}
+	if resource.Cluster || required.Cluster || required.AnyResource {
+		return resource.Cluster && required.Cluster
+	}
+	if resource.DB != "" && resource.DB != required.DB {
+		return false
+	}
+	if resource.Collection != "" {
+		return resource.Collection == required.Collection
+	}
+	return !strings.HasPrefix(required.Collection, "system.")
+}
@@ -0,0 +1,96 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package healthcheck
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/mongodb/mongo-tools/common/util"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMissingActions(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With the privileges of a user", t, func() {
+		var status connectionStatus
+		raw, err := bson.Marshal(bson.D{{Key: "authInfo", Value: bson.D{
+			{Key: "authenticatedUsers", Value: bson.A{bson.D{{Key: "user", Value: "u"}, {Key: "db", Value: "admin"}}}},
+			{Key: "authenticatedUserPrivileges", Value: bson.A{
+				bson.D{{Key: "resource", Value: bson.D{{Key: "db", Value: "sales"}, {Key: "collection", Value: ""}}},
+					{Key: "actions", Value: bson.A{"find", "listCollections"}}},
+				bson.D{{Key: "resource", Value: bson.D{{Key: "db", Value: ""}, {Key: "collection", Value: "audit"}}},
+					{Key: "actions", Value: bson.A{"insert"}}},
+				bson.D{{Key: "resource", Value: bson.D{{Key: "cluster", Value: true}}},
+					{Key: "actions", Value: bson.A{"serverStatus"}}},
+			}},
+		}}})
+		So(err, ShouldBeNil)
+		So(bson.Unmarshal(raw, &status), ShouldBeNil)
+		privileges := status.AuthInfo.AuthenticatedUserPrivileges
+		So(privileges, ShouldHaveLength, 3)
+
+		missing := func(resource Resource, actions ...string) []string {
+			return MissingActions(privileges, Requirement{Resource: resource, Actions: actions})
+		}
+
+		Convey("database privileges should cover its collections and the database itself", func() {
+			So(missing(Resource{DB: "sales", Collection: "orders"}, "find"), ShouldBeEmpty)
+			So(missing(Resource{DB: "sales"}, "find", "listCollections"), ShouldBeEmpty)
+			So(missing(Resource{DB: "sales", Collection: "orders"}, "find", "insert"), ShouldResemble, []string{"insert"})
+		})
+
+		Convey("but not system collections, other databases or all databases", func() {
+			So(missing(Resource{DB: "sales", Collection: "system.js"}, "find"), ShouldResemble, []string{"find"})
+			So(missing(Resource{DB: "hr", Collection: "orders"}, "find"), ShouldResemble, []string{"find"})
+			So(missing(Resource{}, "find"), ShouldResemble, []string{"find"})
+		})
+
+		Convey("collection privileges in every database should cover only that collection", func() {
+			So(missing(Resource{DB: "hr", Collection: "audit"}, "insert"), ShouldBeEmpty)
+			So(missing(Resource{DB: "hr", Collection: "other"}, "insert"), ShouldResemble, []string{"insert"})
+		})
+
+		Convey("cluster privileges should only cover the cluster", func() {
+			So(missing(Resource{Cluster: true}, "serverStatus", "top"), ShouldResemble, []string{"top"})
+			So(missing(Resource{DB: "admin"}, "serverStatus"), ShouldResemble, []string{"serverStatus"})
+		})
+
+		Convey("anyAction on anyResource should cover everything", func() {
+			root := []Privilege{{Resource: Resource{AnyResource: true}, Actions: []string{"anyAction"}}}
+			So(MissingActions(root, Requirement{Resource: Resource{Cluster: true}, Actions: []string{"top"}}), ShouldBeEmpty)
+			So(MissingActions(root, Requirement{Resource: Resource{DB: "a", Collection: "system.users"}, Actions: []string{"find"}}), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestReport(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("A report should list each check and pass only if none failed", t, func() {
+		report := &Report{}
+		report.add("connect", true, "connected to server version %v", "6.0.0")
+		report.skip("authenticate", "no credentials given")
+		So(report.OK(), ShouldBeTrue)
+
+		So(report.ExitCode(), ShouldEqual, util.ExitSuccess)
+
+		report.add("privileges on collection a.b", false, "missing find, needed to read it")
+		So(report.OK(), ShouldBeFalse)
+		So(report.ExitCode(), ShouldEqual, util.ExitAuthFailure)
+
+		out := &bytes.Buffer{}
+		report.Write(out)
+		So(out.String(), ShouldEqual, "[ OK ] connect: connected to server version 6.0.0\n"+
+			"[SKIP] authenticate: no credentials given\n"+
+			"[FAIL] privileges on collection a.b: missing find, needed to read it\n"+
+			"health check failed\n")
+	})
+}
@@ -390,6 +390,12 @@ func (mgr *Manager) Intents() []*Intent {
 	return allIntents
 }
 
+// SourceNamespaces returns the namespaces of the intents that are restored
+// to the destination namespace dst.
+func (mgr *Manager) SourceNamespaces(dst string) []string {
+	return mgr.destinations[dst]
+}
+
 func (mgr *Manager) IntentForNamespace(ns string) *Intent {
 	intent := mgr.intents[ns]
 	if intent != nil {
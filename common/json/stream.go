@@ -15,10 +15,19 @@ import (
 	"io"
 )
 
+// ErrValueTooLarge is returned by a Decoder when a JSON value does not fit in
+// its MaxBuffer.
+var ErrValueTooLarge = errors.New("JSON value is larger than the maximum parse buffer")
+
 // A Decoder reads and decodes JSON objects from an input stream.
 type Decoder struct {
-	R    io.Reader
-	Buf  []byte
+	R   io.Reader
+	Buf []byte
+
+	// MaxBuffer, if positive, is the most bytes the decoder buffers, which
+	// bounds the size of a single JSON value it can read.
+	MaxBuffer int
+
 	d    decodeState
 	scan scanner
 	err  error
@@ -161,9 +170,18 @@ Input:
 		// Make room to read more into the buffer.
 		const minRead = 512
 		if cap(dec.Buf)-len(dec.Buf) < minRead {
-			newBuf := make([]byte, len(dec.Buf), 2*cap(dec.Buf)+minRead)
-			copy(newBuf, dec.Buf)
-			dec.Buf = newBuf
+			newCap := 2*cap(dec.Buf) + minRead
+			if dec.MaxBuffer > 0 && newCap > dec.MaxBuffer {
+				newCap = dec.MaxBuffer
+			}
+			if newCap > cap(dec.Buf) {
+				newBuf := make([]byte, len(dec.Buf), newCap)
+				copy(newBuf, dec.Buf)
+				dec.Buf = newBuf
+			} else if len(dec.Buf) == cap(dec.Buf) {
+				dec.err = ErrValueTooLarge
+				return 0, dec.err
+			}
 		}
 
 		// Read.  Delay error for next iteration (after scan).
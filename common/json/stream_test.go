@@ -120,6 +120,30 @@ func TestDecoderBuffered(t *testing.T) {
 	}
 }
 
+func TestDecoderMaxBuffer(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	small := `{"a": 1}`
+	large := `{"a": "` + strings.Repeat("x", 2000) + `"}`
+	d := NewDecoder(strings.NewReader(small + " " + small + " " + large))
+	d.MaxBuffer = 1024
+	for i := 0; i < 2; i++ {
+		value, err := d.ScanObject()
+		if err != nil {
+			t.Fatalf("value %v: %v", i, err)
+		}
+		if strings.TrimSpace(string(value)) != small {
+			t.Errorf("value %v = %q; want %q", i, value, small)
+		}
+	}
+	if _, err := d.ScanObject(); err != ErrValueTooLarge {
+		t.Errorf("scanning value larger than MaxBuffer: got %v; want %v", err, ErrValueTooLarge)
+	}
+	if cap(d.Buf) > d.MaxBuffer {
+		t.Errorf("buffer capacity = %v; want at most %v", cap(d.Buf), d.MaxBuffer)
+	}
+}
+
 func nlines(s string, n int) string {
 	if n <= 0 {
 		return ""
@@ -0,0 +1,135 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package options
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+)
+
+// completionCommand is the first argument that makes a tool generate shell
+// completions rather than run, e.g. "mongodump completion bash". It is only
+// taken as such when followed by one of CompletionShells or by
+// CompletionNamesArg, so that it can still name e.g. a dump directory.
+const completionCommand = "completion"
+
+// CompletionNamesArg is the hidden argument of "completion" with which the
+// completion scripts ask the tool for database or collection names.
+const CompletionNamesArg = "__names"
+
+// CompletionShells lists the shells that completion scripts are generated for.
+var CompletionShells = []string{"bash", "zsh", "fish", "powershell"}
+
+// isCompletionCommand returns true if args ask for shell completions.
+func isCompletionCommand(args []string) bool {
+	if len(args) < 2 || args[0] != completionCommand {
+		return false
+	}
+	if args[1] == CompletionNamesArg {
+		return true
+	}
+	if len(args) != 2 {
+		return false
+	}
+	for _, shell := range CompletionShells {
+		if args[1] == shell {
+			return true
+		}
+	}
+	return false
+}
+
+// Kinds of values completed for an option.
+const (
+	CompleteNothing    = ""
+	CompleteFile       = "file"
+	CompleteDatabase   = "database"
+	CompleteCollection = "collection"
+)
+
+// CompletionOption describes an option of a tool for shell completion.
+type CompletionOption struct {
+	Long        string
+	Short       string
+	Description string
+	// TakesValue is false for flags, whose value is optional if any
+	TakesValue bool
+	// Repeatable is true for options that may be given more than once
+	Repeatable bool
+	// Choices are the allowed values, if they are limited
+	Choices []string
+	// Complete is the kind of value completed, e.g. CompleteFile
+	Complete string
+}
+
+// eachOption calls fn for every option of the tool.
+func (opts *ToolOptions) eachOption(fn func(option *flags.Option)) {
+	var visit func(group *flags.Group)
+	visit = func(group *flags.Group) {
+		for _, option := range group.Options() {
+			fn(option)
+		}
+		for _, child := range group.Groups() {
+			visit(child)
+		}
+	}
+	visit(opts.parser.Group)
+}
+
+// completedValues returns the kind of value completed for option.
+func completedValues(option *flags.Option) string {
+	switch option.LongName {
+	case "db":
+		return CompleteDatabase
+	case "collection":
+		return CompleteCollection
+	}
+	valueName := strings.ToLower(option.ValueName)
+	longName := strings.ToLower(option.LongName)
+	for _, hint := range []string{"file", "path", "dir"} {
+		if strings.Contains(valueName, hint) || strings.HasSuffix(longName, hint) {
+			return CompleteFile
+		}
+	}
+	return CompleteNothing
+}
+
+// CompletionOptions returns the options shown in the tool's help, which
+// shell completions are generated from.
+func (opts *ToolOptions) CompletionOptions() []CompletionOption {
+	var completions []CompletionOption
+	opts.eachOption(func(option *flags.Option) {
+		if option.Hidden || option.LongName == "" && option.ShortName == 0 {
+			return
+		}
+		kind := option.Field().Type.Kind()
+		completion := CompletionOption{
+			Long:        option.LongName,
+			Description: option.Description,
+			TakesValue:  kind != reflect.Bool && !option.OptionalArgument,
+			Repeatable:  kind == reflect.Slice || kind == reflect.Map,
+			Choices:     option.Choices,
+		}
+		if option.ShortName != 0 {
+			completion.Short = string(option.ShortName)
+		}
+		if completion.TakesValue {
+			completion.Complete = completedValues(option)
+		}
+		completions = append(completions, completion)
+	})
+	return completions
+}
+
+// CompletionArgs returns the arguments following "completion", if it was
+// given as the first argument instead of options, followed by a shell or by
+// CompletionNamesArg.
+func (opts *ToolOptions) CompletionArgs() ([]string, bool) {
+	return opts.completionArgs, opts.completionRequested
+}
@@ -0,0 +1,212 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package options
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/yaml.v2"
+)
+
+// configEnvVar matches a reference to an environment variable in a config
+// file value, e.g. ${MONGO_PASSWORD}, or an escaped '$${'.
+var configEnvVar = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// interpolateEnv replaces each ${VAR} in value with the value of the
+// environment variable VAR, which must be set, and each $${ with ${.
+func interpolateEnv(value string) (string, error) {
+	var err error
+	expanded := configEnvVar.ReplaceAllStringFunc(value, func(ref string) string {
+		if ref == "$${" {
+			return "${"
+		}
+		name := configEnvVar.FindStringSubmatch(ref)[1]
+		envValue, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %v is not set", name)
+		}
+		return envValue
+	})
+	return expanded, err
+}
+
+// escapeEnv escapes each ${ in value as $${, so that reading value back from
+// a config file does not interpolate it.
+func escapeEnv(value string) string {
+	return strings.Replace(value, "${", "$${", -1)
+}
+
+// configScalar returns a scalar config file value as a string, with
+// environment variables interpolated.
+func configScalar(key string, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		expanded, err := interpolateEnv(v)
+		if err != nil {
+			return "", fmt.Errorf("error in value of %v: %v", key, err)
+		}
+		return expanded, nil
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(v), nil
+	case nil:
+		return "", fmt.Errorf("no value given for %v", key)
+	}
+	return "", fmt.Errorf("value of %v must be a string, number or boolean", key)
+}
+
+// configArgs converts the options in a config file to the equivalent command
+// line arguments, e.g. "--db=test". Each key is the long name of an option.
+// A list sets an option that may be repeated once for each element, and a
+// boolean option is set by true and left unset by false.
+func (opts *ToolOptions) configArgs(config map[string]interface{}) ([]string, error) {
+	// sort the keys so that errors are reported consistently
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var args []string
+	for _, key := range keys {
+		if key == "config" {
+			return nil, fmt.Errorf("a config file cannot set config")
+		}
+		option := opts.parser.FindOptionByLongName(key)
+		if option == nil {
+			return nil, fmt.Errorf("%v is not an option of %v", key, opts.AppName)
+		}
+
+		values, ok := config[key].([]interface{})
+		if !ok {
+			values = []interface{}{config[key]}
+		} else if kind := option.Field().Type.Kind(); kind != reflect.Slice && kind != reflect.Map {
+			return nil, fmt.Errorf("%v cannot be given more than once", key)
+		}
+		for _, value := range values {
+			str, err := configScalar(key, value)
+			if err != nil {
+				return nil, err
+			}
+			if option.Field().Type.Kind() != reflect.Bool {
+				args = append(args, "--"+key+"="+str)
+				continue
+			}
+			set, err := strconv.ParseBool(str)
+			if err != nil {
+				return nil, fmt.Errorf("value of %v must be true or false", key)
+			}
+			if set {
+				args = append(args, "--"+key)
+			}
+		}
+	}
+	return args, nil
+}
+
+// isSensitiveOption returns whether an option holds a password, which is not
+// printed by PrintEffectiveConfig.
+func isSensitiveOption(longName string) bool {
+	return strings.HasSuffix(strings.ToLower(longName), "password")
+}
+
+// configValue returns the value of an option to be printed in a config file,
+// or false if the option is not set.
+func configValue(option *flags.Option) (interface{}, bool) {
+	value := reflect.ValueOf(option.Value())
+	if value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	if !value.IsValid() || value.IsZero() || value.Kind() == reflect.Func {
+		return nil, false
+	}
+	if value.Kind() == reflect.Slice {
+		elems := make([]interface{}, value.Len())
+		for i := range elems {
+			elems[i] = fmt.Sprint(value.Index(i).Interface())
+		}
+		return elems, len(elems) > 0
+	}
+	v := value.Interface()
+	switch v.(type) {
+	case string, bool, int, int64, float64:
+	default:
+		// e.g. a time.Duration is printed as "5m0s" rather than in nanoseconds
+		v = fmt.Sprint(v)
+	}
+	if len(option.Default) == 1 && fmt.Sprint(v) == option.Default[0] {
+		return nil, false
+	}
+	return v, true
+}
+
+// effectiveConfig returns the options in effect, which differ from their
+// defaults, as the contents of a config file.
+func (opts *ToolOptions) effectiveConfig() yaml.MapSlice {
+	var config yaml.MapSlice
+	opts.eachOption(func(option *flags.Option) {
+		switch option.LongName {
+		case "", "config", "printEffectiveConfig":
+			return
+		}
+		if option.Hidden {
+			return
+		}
+		value, ok := configValue(option)
+		if !ok {
+			return
+		}
+		switch {
+		case isSensitiveOption(option.LongName):
+			value = "<redacted>"
+		case option.LongName == "uri":
+			value = util.SanitizeURI(value.(string))
+		}
+		switch v := value.(type) {
+		case string:
+			value = escapeEnv(v)
+		case []interface{}:
+			for i := range v {
+				v[i] = escapeEnv(v[i].(string))
+			}
+		}
+		config = append(config, yaml.MapItem{Key: option.LongName, Value: value})
+	})
+	return config
+}
+
+// writeEffectiveConfig writes the options in effect to out in the format of
+// a config file.
+func (opts *ToolOptions) writeEffectiveConfig(out io.Writer) error {
+	data, err := yaml.Marshal(opts.effectiveConfig())
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+// PrintEffectiveConfig prints the options in effect, from the --config file
+// and the command line, to stdout in the format of a config file, with
+// passwords redacted. Returns whether or not the --printEffectiveConfig flag
+// is specified.
+func (opts *ToolOptions) PrintEffectiveConfig() bool {
+	if opts.General.PrintEffectiveConfig {
+		if err := opts.writeEffectiveConfig(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "error printing effective config: %v\n", err)
+		}
+	}
+	return opts.General.PrintEffectiveConfig
+}
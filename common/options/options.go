@@ -21,6 +21,7 @@ import (
 	flags "github.com/jessevdk/go-flags"
 	"github.com/mongodb/mongo-tools/common/failpoint"
 	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/password"
 	"github.com/mongodb/mongo-tools/common/util"
 	"github.com/pkg/errors"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -96,6 +97,11 @@ type ToolOptions struct {
 
 	// Will attempt to parse positional arguments as connection strings if true
 	parsePositionalArgsAsURI bool
+
+	// arguments following "completion", if it was given as the first
+	// argument to generate shell completions
+	completionArgs      []string
+	completionRequested bool
 }
 
 type Namespace struct {
@@ -112,7 +118,9 @@ func (ns Namespace) String() string {
 type General struct {
 	Help       bool   `long:"help" description:"print usage"`
 	Version    bool   `long:"version" description:"print the tool version and exit"`
-	ConfigPath string `long:"config" description:"path to a configuration file"`
+	ConfigPath string `long:"config" value-name:"<filename>" description:"path to a YAML configuration file setting any option by its long name, e.g. 'db: test'; values may refer to environment variables as ${VAR}, and a literal '${' is written as '$${', e.g. in a password; options given on the command line override it"`
+
+	PrintEffectiveConfig bool `long:"printEffectiveConfig" description:"print the options in effect, from the configuration file and the command line, in the format of a configuration file with passwords redacted, and exit"`
 
 	MaxProcs   int    `long:"numThreads" hidden:"true"`
 	Failpoints string `long:"failpoints" hidden:"true"`
@@ -152,6 +160,9 @@ type Connection struct {
 	TCPKeepAliveSeconds    int    `long:"TCPKeepAliveSeconds" default:"30" hidden:"true" description:"seconds between TCP keep alives"`
 	ServerSelectionTimeout int    `long:"serverSelectionTimeout" hidden:"true" description:"seconds to wait for server selection; 0 means driver default"`
 	Compressors            string `long:"compressors" default:"none" hidden:"true" value-name:"<snappy,...>" description:"comma-separated list of compressors to enable. Use 'none' to disable."`
+	BandwidthLimit         string `long:"bwLimit" value-name:"<size>/s" description:"most bytes per second to send and receive over the network, across all connections, e.g. 50MB/s (defaults to no limit)"`
+
+	HealthCheck bool `long:"healthCheck" description:"connect, authenticate and check that the user has the privileges needed for the operation, then print a report and exit without performing it"`
 }
 
 // Struct holding ssl-related options
@@ -163,8 +174,20 @@ type SSL struct {
 	SSLCRLFile          string `long:"sslCRLFile" value-name:"<filename>" description:"the .pem file containing the certificate revocation list"`
 	SSLAllowInvalidCert bool   `long:"sslAllowInvalidCertificates" hidden:"true" description:"bypass the validation for server certificates"`
 	SSLAllowInvalidHost bool   `long:"sslAllowInvalidHostnames" hidden:"true" description:"bypass the validation for server name"`
-	SSLFipsMode         bool   `long:"sslFIPSMode" description:"use FIPS mode of the installed openssl library"`
+	SSLFipsMode         bool   `long:"sslFIPSMode" description:"alias for --tlsFIPSMode"`
 	TLSInsecure         bool   `long:"tlsInsecure" description:"bypass the validation for server's certificate chain and host name"`
+	TLSFIPSMode         bool   `long:"tlsFIPSMode" description:"restrict TLS to FIPS-approved protocol versions, cipher suites and curves (requires a build with a FIPS-validated crypto backend)"`
+	TLSKeyLogFile       string `long:"tlsKeyLogFile" value-name:"<filename>" hidden:"true" description:"append TLS session secrets to the given file in NSS key log format, for debugging with a packet analyzer"`
+
+	SSLPEMKeyPasswordSource string `long:"sslPEMKeyPasswordSource" value-name:"<source>" description:"read the password to decrypt the sslPEMKeyFile from env:<VAR>, vault://<path>[#<field>] or awssm://<secret-id>[#<field>]"`
+
+	TLSDisableOCSPEndpointCheck bool `long:"tlsDisableOCSPEndpointCheck" description:"do not contact OCSP responders to check the revocation status of the server's certificate"`
+	TLSRequireOCSPStapling      bool `long:"tlsRequireOCSPStapling" description:"fail the connection if the server does not staple an OCSP response to its certificate"`
+}
+
+// UseFIPSMode returns true if either FIPS mode option was specified.
+func (ssl *SSL) UseFIPSMode() bool {
+	return ssl.SSLFipsMode || ssl.TLSFIPSMode
 }
 
 // Struct holding auth-related options
@@ -174,6 +197,7 @@ type Auth struct {
 	Source          string `long:"authenticationDatabase" value-name:"<database-name>" description:"database that holds the user's credentials"`
 	Mechanism       string `long:"authenticationMechanism" value-name:"<mechanism>" description:"authentication mechanism to use"`
 	AWSSessionToken string `long:"awsSessionToken" value-name:"<aws-session-token>" description:"session token to authenticate via AWS IAM"`
+	PasswordSource  string `long:"passwordSource" value-name:"<source>" description:"read the password for authentication from env:<VAR>, vault://<path>[#<field>] or awssm://<secret-id>[#<field>]"`
 }
 
 // Struct for Kerberos/GSSAPI-specific options
@@ -443,6 +467,14 @@ func (opts *ToolOptions) AddToExtraOptionsRegistry(extraOpts ExtraOptions) {
 // any values in the config file. Returns any extra args not accounted for by parsing,
 // as well as an error if the parsing returns an error.
 func (opts *ToolOptions) ParseArgs(args []string) ([]string, error) {
+	// the tool generates shell completions rather than running, see
+	// CompletionArgs
+	if isCompletionCommand(args) {
+		opts.completionArgs = args[1:]
+		opts.completionRequested = true
+		return []string{}, nil
+	}
+
 	LogSensitiveOptionWarnings(args)
 
 	if err := opts.ParseConfigFile(args); err != nil {
@@ -467,6 +499,11 @@ func (opts *ToolOptions) ParseArgs(args []string) ([]string, error) {
 
 	failpoint.ParseFailpoints(opts.Failpoints)
 
+	err = opts.resolvePasswordSources()
+	if err != nil {
+		return []string{}, err
+	}
+
 	err = opts.NormalizeOptionsAndURI()
 	if err != nil {
 		return []string{}, err
@@ -526,9 +563,10 @@ func LogSensitiveOptionWarnings(args []string) {
 }
 
 // ParseConfigFile iterates over args to find a --config option. If not found, we return.
-// If found, we read the contents of the specified config file in YAML format. We parse
-// any values corresponding to --password, --uri and --sslPEMKeyPassword, and store them
-// in the opts.
+// If found, we read the contents of the specified config file in YAML format. Each key
+// is the long name of an option, e.g. password, uri or sslPEMKeyPassword, and ${VAR}
+// in its value is replaced by the environment variable VAR. The options are parsed
+// into opts, before the command line args which override them.
 // This also applies to --destinationPassword for mongomirror only.
 func (opts *ToolOptions) ParseConfigFile(args []string) error {
 	// Get config file path from the arguments, if specified.
@@ -549,30 +587,65 @@ func (opts *ToolOptions) ParseConfigFile(args []string) error {
 	}
 
 	// Unmarshal the config file as a top-level YAML file.
-	var config struct {
-		Password            string `yaml:"password"`
-		ConnectionString    string `yaml:"uri"`
-		SSLPEMKeyPassword   string `yaml:"sslPEMKeyPassword"`
-		DestinationPassword string `yaml:"destinationPassword"`
-	}
+	var config map[string]interface{}
 	err = yaml.UnmarshalStrict(configBytes, &config)
 	if err != nil {
 		return errors.Wrapf(err, "error parsing config file %s", opts.General.ConfigPath)
 	}
 
-	// Assign each parsed value to its respective ToolOptions field.
-	opts.Auth.Password = config.Password
-	opts.URI.ConnectionString = config.ConnectionString
-	opts.SSL.SSLPEMKeyPassword = config.SSLPEMKeyPassword
-
 	// Mongomirror has an extra option to set.
-	for _, extraOpt := range opts.URI.extraOptionsRegistry {
-		if destinationAuth, ok := extraOpt.(DestinationAuthOptions); ok {
-			destinationAuth.SetDestinationPassword(config.DestinationPassword)
-			break
+	if destinationPassword, ok := config["destinationPassword"]; ok && opts.parser.FindOptionByLongName("destinationPassword") == nil {
+		delete(config, "destinationPassword")
+		for _, extraOpt := range opts.URI.extraOptionsRegistry {
+			if destinationAuth, ok := extraOpt.(DestinationAuthOptions); ok {
+				value, err := configScalar("destinationPassword", destinationPassword)
+				if err != nil {
+					return errors.Wrapf(err, "error parsing config file %s", opts.General.ConfigPath)
+				}
+				destinationAuth.SetDestinationPassword(value)
+				break
+			}
 		}
 	}
 
+	// Parse the options as if they were given on the command line.
+	configArgs, err := opts.configArgs(config)
+	if err != nil {
+		return errors.Wrapf(err, "error parsing config file %s", opts.General.ConfigPath)
+	}
+	if _, err = opts.parser.ParseArgs(configArgs); err != nil {
+		return errors.Wrapf(err, "error parsing config file %s", opts.General.ConfigPath)
+	}
+
+	return nil
+}
+
+// resolvePasswordSources fills in the authentication and sslPEMKeyFile
+// passwords from any external secret sources specified with --passwordSource
+// or --sslPEMKeyPasswordSource.
+func (opts *ToolOptions) resolvePasswordSources() error {
+	if opts.Auth.PasswordSource != "" {
+		if opts.Auth.Password != "" {
+			return fmt.Errorf("illegal argument combination: cannot specify --password and --passwordSource")
+		}
+		pass, err := password.FromSource(opts.Auth.PasswordSource)
+		if err != nil {
+			return errors.Wrap(err, "error reading --passwordSource")
+		}
+		opts.Auth.Password = pass
+	}
+
+	if opts.SSL.SSLPEMKeyPasswordSource != "" {
+		if opts.SSL.SSLPEMKeyPassword != "" {
+			return fmt.Errorf("illegal argument combination: cannot specify --sslPEMKeyPassword and --sslPEMKeyPasswordSource")
+		}
+		pass, err := password.FromSource(opts.SSL.SSLPEMKeyPasswordSource)
+		if err != nil {
+			return errors.Wrap(err, "error reading --sslPEMKeyPasswordSource")
+		}
+		opts.SSL.SSLPEMKeyPassword = pass
+	}
+
 	return nil
 }
 
@@ -977,6 +1050,20 @@ func (opts *ToolOptions) setOptionsFromURI(cs connstring.ConnString) error {
 		opts.TLSInsecure = cs.SSLInsecure
 	}
 
+	// ignore opts.TLSDisableOCSPEndpointCheck being false due to zero-value problem (TOOLS-2459 PR for details)
+	if opts.TLSDisableOCSPEndpointCheck && cs.SSLDisableOCSPEndpointCheckSet {
+		if !cs.SSLDisableOCSPEndpointCheck {
+			return ConflictingArgsErrorFormat("tlsDisableOCSPEndpointCheck", "false", "true", "--tlsDisableOCSPEndpointCheck")
+		}
+	}
+	if opts.TLSDisableOCSPEndpointCheck && !cs.SSLDisableOCSPEndpointCheckSet {
+		cs.SSLDisableOCSPEndpointCheck = true
+		cs.SSLDisableOCSPEndpointCheckSet = true
+	}
+	if !opts.TLSDisableOCSPEndpointCheck && cs.SSLDisableOCSPEndpointCheckSet {
+		opts.TLSDisableOCSPEndpointCheck = cs.SSLDisableOCSPEndpointCheck
+	}
+
 	if strings.ToLower(cs.AuthMechanism) == "gssapi" {
 		if !BuiltWithGSSAPI {
 			return fmt.Errorf("cannot specify gssapiservicename: tool not built with kerberos support")
@@ -0,0 +1,192 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package password
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+)
+
+const (
+	envSourcePrefix   = "env:"
+	vaultSourcePrefix = "vault://"
+	awsSMSourcePrefix = "awssm://"
+
+	defaultVaultAddr   = "https://127.0.0.1:8200"
+	defaultSecretField = "password"
+)
+
+var secretSourceClient = &http.Client{Timeout: 30 * time.Second}
+
+// FromSource resolves a secret from an external source. The source may be
+// "env:<VAR>" to read an environment variable, "vault://<path>[#<field>]" to
+// read a field of a HashiCorp Vault secret (the "password" field by default),
+// or "awssm://<secret-id>[#<field>]" to read an AWS Secrets Manager secret, or
+// a field of one that holds a JSON object. Vault is configured with the usual
+// VAULT_ADDR, VAULT_TOKEN and VAULT_NAMESPACE environment variables; AWS
+// credentials and region come from the standard AWS environment variables and
+// shared configuration files.
+func FromSource(source string) (string, error) {
+	switch {
+	case strings.HasPrefix(source, envSourcePrefix):
+		return fromEnv(strings.TrimPrefix(source, envSourcePrefix))
+	case strings.HasPrefix(source, vaultSourcePrefix):
+		path, field := splitSecretField(strings.TrimPrefix(source, vaultSourcePrefix))
+		if field == "" {
+			field = defaultSecretField
+		}
+		return fromVault(path, field)
+	case strings.HasPrefix(source, awsSMSourcePrefix):
+		id, field := splitSecretField(strings.TrimPrefix(source, awsSMSourcePrefix))
+		return fromAWSSecretsManager(id, field)
+	}
+	return "", fmt.Errorf("unsupported secret source '%v': must begin with %v, %v or %v",
+		source, envSourcePrefix, vaultSourcePrefix, awsSMSourcePrefix)
+}
+
+// splitSecretField splits a "<name>#<field>" reference into its parts.
+func splitSecretField(ref string) (string, string) {
+	if i := strings.LastIndex(ref, "#"); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, ""
+}
+
+func fromEnv(name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("no environment variable specified")
+	}
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %v is not set", name)
+	}
+	return value, nil
+}
+
+func fromVault(path, field string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("no vault secret path specified")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		return "", fmt.Errorf("VAULT_TOKEN must be set to read from vault")
+	}
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		addr = defaultVaultAddr
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimSuffix(addr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	var reply struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err = doSecretRequest(req, &reply); err != nil {
+		return "", fmt.Errorf("error reading vault secret %v: %v", path, err)
+	}
+
+	// version 2 of the key/value engine nests the secret under data.data
+	data := reply.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+	value, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("vault secret %v has no string field '%v'", path, field)
+	}
+	return value, nil
+}
+
+func fromAWSSecretsManager(id, field string) (string, error) {
+	if id == "" {
+		return "", fmt.Errorf("no AWS secret id specified")
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error creating AWS session: %v", err)
+	}
+	config := sess.ClientConfig("secretsmanager")
+	if config.SigningRegion == "" {
+		return "", fmt.Errorf("an AWS region must be configured to read from AWS Secrets Manager")
+	}
+
+	body, err := json.Marshal(map[string]string{"SecretId": id})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest("POST", config.Endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	signer := v4.NewSigner(config.Config.Credentials)
+	if _, err = signer.Sign(req, bytes.NewReader(body), "secretsmanager", config.SigningRegion, time.Now()); err != nil {
+		return "", fmt.Errorf("error signing AWS request: %v", err)
+	}
+
+	var reply struct {
+		SecretString *string `json:"SecretString"`
+	}
+	if err = doSecretRequest(req, &reply); err != nil {
+		return "", fmt.Errorf("error reading AWS secret %v: %v", id, err)
+	}
+	if reply.SecretString == nil {
+		return "", fmt.Errorf("AWS secret %v does not hold a string value", id)
+	}
+	if field == "" {
+		return *reply.SecretString, nil
+	}
+
+	var fields map[string]interface{}
+	if err = json.Unmarshal([]byte(*reply.SecretString), &fields); err != nil {
+		return "", fmt.Errorf("AWS secret %v is not a JSON object: %v", id, err)
+	}
+	value, ok := fields[field].(string)
+	if !ok {
+		return "", fmt.Errorf("AWS secret %v has no string field '%v'", id, field)
+	}
+	return value, nil
+}
+
+// doSecretRequest sends the request and decodes a successful JSON reply into
+// out.
+func doSecretRequest(req *http.Request, out interface{}) error {
+	resp, err := secretSourceClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return json.Unmarshal(body, out)
+}
@@ -0,0 +1,78 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package password
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPasswordFromSource(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With an env source", t, func() {
+		os.Setenv("MONGO_TOOLS_TEST_PWD", testPwd)
+		defer os.Unsetenv("MONGO_TOOLS_TEST_PWD")
+
+		pass, err := FromSource("env:MONGO_TOOLS_TEST_PWD")
+		So(err, ShouldBeNil)
+		So(pass, ShouldEqual, testPwd)
+
+		_, err = FromSource("env:MONGO_TOOLS_TEST_UNSET_PWD")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("With a vault source", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Vault-Token") != "token" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			switch r.URL.Path {
+			case "/v1/secret/data/mongo":
+				w.Write([]byte(`{"data": {"data": {"password": "` + testPwd + `", "other": "abc"}}}`))
+			case "/v1/kv/mongo":
+				w.Write([]byte(`{"data": {"password": "` + testPwd + `"}}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+
+		os.Setenv("VAULT_ADDR", server.URL)
+		os.Setenv("VAULT_TOKEN", "token")
+		defer os.Unsetenv("VAULT_ADDR")
+		defer os.Unsetenv("VAULT_TOKEN")
+
+		pass, err := FromSource("vault://secret/data/mongo")
+		So(err, ShouldBeNil)
+		So(pass, ShouldEqual, testPwd)
+
+		pass, err = FromSource("vault://secret/data/mongo#other")
+		So(err, ShouldBeNil)
+		So(pass, ShouldEqual, "abc")
+
+		pass, err = FromSource("vault://kv/mongo")
+		So(err, ShouldBeNil)
+		So(pass, ShouldEqual, testPwd)
+
+		_, err = FromSource("vault://secret/data/mongo#missing")
+		So(err, ShouldNotBeNil)
+		_, err = FromSource("vault://secret/data/missing")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("An unknown source should fail", t, func() {
+		_, err := FromSource("file:///etc/passwd")
+		So(err, ShouldNotBeNil)
+	})
+}
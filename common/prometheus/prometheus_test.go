@@ -0,0 +1,23 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEscapeLabelValue(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Backslashes, quotes and newlines should be escaped", t, func() {
+		So(EscapeLabelValue(`db.coll`), ShouldEqual, `db.coll`)
+		So(EscapeLabelValue(`a\b"c`+"\n"), ShouldEqual, `a\\b\"c\n`)
+	})
+}
@@ -0,0 +1,191 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// Package runmanifest records each run of a tool in a token file, so that
+// automation can detect a rerun of a run that already completed, or of one
+// that may have been partially applied, and avoid applying it twice.
+package runmanifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+)
+
+// States of a run recorded in its token file.
+const (
+	StateStarted   = "started"
+	StateCompleted = "completed"
+	StateFailed    = "failed"
+)
+
+// ErrAlreadyApplied is returned by Begin with --ifNotAlreadyApplied when the
+// same run already completed.
+var ErrAlreadyApplied = errors.New("run already completed, skipping")
+
+// Options defines the options shared by tools that record their runs.
+type Options struct {
+	Dir                 string `long:"runManifest" value-name:"<directory-path>" description:"directory in which to record a token file for this run, identified by the tool, its target and its parameters, along with whether the run completed"`
+	IfNotAlreadyApplied bool   `long:"ifNotAlreadyApplied" description:"skip this run if its token file shows that the same run already completed, and refuse to run if the same run started but did not complete (requires --runManifest)"`
+}
+
+// Name returns a human-readable group name for run manifest options.
+func (*Options) Name() string {
+	return "run manifest"
+}
+
+// Run is a run of a tool as recorded in its token file.
+type Run struct {
+	Tool       string          `json:"tool"`
+	Target     string          `json:"target"`
+	Parameters json.RawMessage `json:"parameters"`
+	Token      string          `json:"token"`
+	State      string          `json:"state"`
+	StartedAt  time.Time       `json:"startedAt"`
+	FinishedAt *time.Time      `json:"finishedAt,omitempty"`
+	Error      string          `json:"error,omitempty"`
+
+	path string
+}
+
+// Begin records that a run of tool against target with the given parameters
+// has started, which must marshal to JSON and must not contain secrets. It
+// returns a nil Run if no --runManifest directory is set.
+//
+// With --ifNotAlreadyApplied, the token file of a previous run with the same
+// tool, target and parameters is checked first: Begin returns
+// ErrAlreadyApplied if that run completed, and an error if it started but
+// did not complete, since it may have been partially applied.
+func Begin(opts *Options, tool, target string, parameters interface{}) (*Run, error) {
+	if opts == nil || opts.Dir == "" {
+		if opts != nil && opts.IfNotAlreadyApplied {
+			return nil, fmt.Errorf("--ifNotAlreadyApplied requires --runManifest")
+		}
+		return nil, nil
+	}
+
+	params, err := json.Marshal(parameters)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding run parameters: %v", err)
+	}
+	run := &Run{
+		Tool:       tool,
+		Target:     target,
+		Parameters: params,
+		Token:      token(tool, target, params),
+		State:      StateStarted,
+		StartedAt:  time.Now().UTC(),
+	}
+	run.path = filepath.Join(opts.Dir, fmt.Sprintf("%v-%v.json", tool, run.Token[:16]))
+
+	if opts.IfNotAlreadyApplied {
+		previous, err := load(run.path)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case previous == nil:
+		case previous.State == StateCompleted:
+			log.Logvf(log.Always, "the same run of %v against %v completed at %v, as recorded in %v",
+				tool, target, previous.FinishedAt.Format(time.RFC3339), run.path)
+			return nil, ErrAlreadyApplied
+		default:
+			return nil, fmt.Errorf("the same run of %v against %v started at %v but is recorded as %v in %v; "+
+				"it may have been partially applied, so check the target and remove the token file to run again",
+				tool, target, previous.StartedAt.Format(time.RFC3339), previous.State, run.path)
+		}
+	}
+
+	if err = os.MkdirAll(opts.Dir, 0750); err != nil {
+		return nil, fmt.Errorf("error creating run manifest directory: %v", err)
+	}
+	if err = run.save(); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// Finish records whether the run completed, given the error it ended with.
+// It does nothing for a nil Run.
+func (run *Run) Finish(runErr error) error {
+	if run == nil {
+		return nil
+	}
+	finishedAt := time.Now().UTC()
+	run.FinishedAt = &finishedAt
+	run.State = StateCompleted
+	if runErr != nil {
+		run.State = StateFailed
+		run.Error = runErr.Error()
+	}
+	return run.save()
+}
+
+// Abandon removes the token file of a run that failed before it applied
+// anything, such as when it could not connect, so that it can be rerun. It
+// does nothing for a nil Run.
+func (run *Run) Abandon() error {
+	if run == nil {
+		return nil
+	}
+	if err := os.Remove(util.ToUniversalPath(run.path)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing token file: %v", err)
+	}
+	return nil
+}
+
+// token identifies a run by its tool, target and parameters.
+func token(tool, target string, params []byte) string {
+	hash := sha256.New()
+	for _, part := range [][]byte{[]byte(tool), []byte(target), params} {
+		hash.Write(part)
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// load reads the token file at path. It returns nil if the file does not
+// exist.
+func load(path string) (*Run, error) {
+	data, err := ioutil.ReadFile(util.ToUniversalPath(path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading token file: %v", err)
+	}
+	run := &Run{}
+	if err = json.Unmarshal(data, run); err != nil {
+		return nil, fmt.Errorf("error parsing token file %v: %v", path, err)
+	}
+	return run, nil
+}
+
+// save writes the token file, replacing it atomically so that a partially
+// written file is never read back.
+func (run *Run) save() error {
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding token file: %v", err)
+	}
+	tmp := run.path + ".tmp"
+	if err = ioutil.WriteFile(util.ToUniversalPath(tmp), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing token file: %v", err)
+	}
+	if err = os.Rename(util.ToUniversalPath(tmp), util.ToUniversalPath(run.path)); err != nil {
+		return fmt.Errorf("error writing token file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package runmanifest
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRunManifest(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a run manifest directory", t, func() {
+		dir, err := ioutil.TempDir("", "runmanifest")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		opts := &Options{Dir: filepath.Join(dir, "runs")}
+		params := map[string]interface{}{"file": "users.json", "mode": "insert"}
+		target := "mongodb://localhost/"
+
+		Convey("no token file is written without a directory", func() {
+			run, err := Begin(&Options{}, "mongoimport", target, params)
+			So(err, ShouldBeNil)
+			So(run, ShouldBeNil)
+			So(run.Finish(nil), ShouldBeNil)
+
+			_, err = Begin(&Options{IfNotAlreadyApplied: true}, "mongoimport", target, params)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("a run is recorded as started and then completed", func() {
+			run, err := Begin(opts, "mongoimport", target, params)
+			So(err, ShouldBeNil)
+			recorded, err := load(run.path)
+			So(err, ShouldBeNil)
+			So(recorded.State, ShouldEqual, StateStarted)
+			So(recorded.Token, ShouldEqual, run.Token)
+
+			So(run.Finish(nil), ShouldBeNil)
+			recorded, err = load(run.path)
+			So(err, ShouldBeNil)
+			So(recorded.State, ShouldEqual, StateCompleted)
+			So(recorded.FinishedAt, ShouldNotBeNil)
+
+			Convey("so the same run is skipped with --ifNotAlreadyApplied", func() {
+				opts.IfNotAlreadyApplied = true
+				_, err := Begin(opts, "mongoimport", target, params)
+				So(err, ShouldEqual, ErrAlreadyApplied)
+			})
+
+			Convey("but a run with other parameters or another target is not", func() {
+				opts.IfNotAlreadyApplied = true
+				other, err := Begin(opts, "mongoimport", target, map[string]interface{}{"file": "orders.json"})
+				So(err, ShouldBeNil)
+				So(other.Token, ShouldNotEqual, run.Token)
+				other, err = Begin(opts, "mongoimport", "mongodb://other/", params)
+				So(err, ShouldBeNil)
+				So(other.Token, ShouldNotEqual, run.Token)
+			})
+		})
+
+		Convey("a run that failed or did not finish is refused with --ifNotAlreadyApplied", func() {
+			run, err := Begin(opts, "mongorestore", target, params)
+			So(err, ShouldBeNil)
+
+			opts.IfNotAlreadyApplied = true
+			_, err = Begin(opts, "mongorestore", target, params)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "recorded as started")
+
+			So(run.Finish(errors.New("insertion error")), ShouldBeNil)
+			_, err = Begin(opts, "mongorestore", target, params)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "recorded as failed")
+
+			Convey("unless it was abandoned before applying anything", func() {
+				So(run.Abandon(), ShouldBeNil)
+				_, err = Begin(opts, "mongorestore", target, params)
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+}
@@ -12,9 +12,19 @@ import (
 
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 )
 
+// interrupted is set to 1 once a signal has been received.
+var interrupted int32
+
+// Interrupted returns whether the program has received a signal that it
+// listens for.
+func Interrupted() bool {
+	return atomic.LoadInt32(&interrupted) == 1
+}
+
 // Handle is like HandleWithInterrupt but it doesn't take a finalizer and will
 // exit immediately after the first signal is received.
 func Handle() chan struct{} {
@@ -44,6 +54,7 @@ func handleSignals(finalizer func(), finishedChan chan struct{}) {
 	if finalizer != nil {
 		select {
 		case sig := <-sigChan:
+			atomic.StoreInt32(&interrupted, 1)
 			// first signal use finalizer to terminate cleanly
 			log.Logvf(log.Always, "signal '%s' received; attempting to shut down", sig)
 			finalizer()
@@ -53,9 +64,10 @@ func handleSignals(finalizer func(), finishedChan chan struct{}) {
 	}
 	select {
 	case sig := <-sigChan:
+		atomic.StoreInt32(&interrupted, 1)
 		// second signal exits immediately
 		log.Logvf(log.Always, "signal '%s' received; forcefully terminating", sig)
-		os.Exit(util.ExitFailure)
+		os.Exit(util.ExitAborted)
 	case <-finishedChan:
 		return
 	}
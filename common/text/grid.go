@@ -13,6 +13,7 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"unicode/utf8"
 )
 
 type Cell struct {
@@ -118,7 +119,8 @@ func (gw *GridWriter) calculateWidths() []int {
 			}
 			// Set the size for the row to be the largest
 			// of all the cells in the column
-			newMin := max(gw.MinWidth, len(gw.Grid[i][j].contents))
+			// widths are counted in characters, as fmt pads them
+			newMin := max(gw.MinWidth, utf8.RuneCountInString(gw.Grid[i][j].contents))
 			if newMin > colWidths[j] {
 				colWidths[j] = newMin
 			}
@@ -113,4 +113,19 @@ func TestWriteGrid(t *testing.T) {
 		gw.EndRow()
 		So(gw.calculateWidths(), ShouldResemble, []int{7, 2, 4, 9})
 	})
+
+	Convey("Test grid writer width calculation with multi-byte characters", t, func() {
+		gw := GridWriter{}
+		gw.WriteCell("▁▄█")
+		gw.WriteCell("ab")
+		gw.EndRow()
+		gw.WriteCell("x")
+		gw.WriteCell("a")
+		gw.EndRow()
+		So(gw.calculateWidths(), ShouldResemble, []int{3, 2})
+
+		buf := bytes.Buffer{}
+		gw.Flush(&buf)
+		So(buf.String(), ShouldEqual, "▁▄█ab\n  x a\n")
+	})
 }
@@ -9,6 +9,8 @@ package text
 import (
 	"fmt"
 	"math"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -29,10 +31,50 @@ func FormatByteAmount(size int64) string {
 	return formatUnitAmount(binary, size, 3, longByteUnits)
 }
 
+// byteAmountUnits are the suffixes accepted by ParseByteAmount, longest first
+// so that "KB" is not mistaken for "B".
+var byteAmountUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30}, {"TIB", 1 << 40},
+	{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"TB", 1 << 40},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+	{"B", 1},
+}
+
+// ParseByteAmount parses a positive byte count with an optional unit suffix,
+// such as 512MB or 1GB, where units are powers of 1024. Underscores may
+// separate groups of digits.
+func ParseByteAmount(arg string) (int64, error) {
+	number, multiplier := strings.ToUpper(strings.TrimSpace(arg)), int64(1)
+	for _, unit := range byteAmountUnits {
+		if strings.HasSuffix(number, unit.suffix) {
+			number, multiplier = strings.TrimSpace(strings.TrimSuffix(number, unit.suffix)), unit.multiplier
+			break
+		}
+	}
+	size, err := strconv.ParseInt(strings.Replace(number, "_", "", -1), 10, 64)
+	if err != nil || size <= 0 || strings.HasPrefix(number, "_") || strings.HasSuffix(number, "_") {
+		return 0, fmt.Errorf("invalid size '%v'", arg)
+	}
+	if size > (1<<63-1)/multiplier {
+		return 0, fmt.Errorf("size '%v' is too large", arg)
+	}
+	return size * multiplier, nil
+}
+
 // FormatMegabyteAmount is equivalent to FormatByteAmount but expects
 // an amount of MB instead of bytes.
 func FormatMegabyteAmount(size int64) string {
-	return formatUnitAmount(binary, size*1024*1024, 3, shortByteUnits)
+	return FormatShortByteAmount(size * 1024 * 1024)
+}
+
+// FormatShortByteAmount is equivalent to FormatByteAmount but uses single
+// letter units.
+//  e.g. 12.4G, 0B, 124.5K
+func FormatShortByteAmount(size int64) string {
+	return formatUnitAmount(binary, size, 3, shortByteUnits)
 }
 
 // FormatBits takes in a bit (not byte) count and returns a formatted string
@@ -72,3 +114,65 @@ func round(result float64, precision int) float64 {
 	// round(x) == floor(x + 0.5)
 	return math.Floor(result*divisor+0.5) / divisor
 }
+
+// UnitScale formats a series of amounts, such as a column of sizes, in a
+// single unit so that they can be compared at a glance. The unit is the one
+// FormatShortByteAmount or FormatBits would choose for the largest amount
+// fitted so far, so it only ever grows.
+type UnitScale struct {
+	base  int64
+	units []string
+	max   int64
+}
+
+// NewShortByteScale returns a UnitScale for byte amounts, using the units of
+// FormatShortByteAmount.
+func NewShortByteScale() *UnitScale {
+	return &UnitScale{base: binary, units: shortByteUnits}
+}
+
+// NewBitScale returns a UnitScale for bit amounts, using the units of
+// FormatBits.
+func NewBitScale() *UnitScale {
+	return &UnitScale{base: decimal, units: shortBitUnits}
+}
+
+// Fit widens the scale, if needed, to the unit that size is shown in.
+func (s *UnitScale) Fit(size int64) {
+	if size < 0 {
+		size = -size
+	}
+	if size > s.max {
+		s.max = size
+	}
+}
+
+// shifts returns the number of times the base is divided into amounts.
+func (s *UnitScale) shifts() int {
+	var shifts int
+	for result := float64(s.max); result >= float64(s.base) && shifts < len(s.units)-1; shifts++ {
+		result /= float64(s.base)
+	}
+	return shifts
+}
+
+// Unit returns the unit amounts are formatted in.
+func (s *UnitScale) Unit() string {
+	return s.units[s.shifts()]
+}
+
+// Format formats size in the scale's unit, without the unit, and with enough
+// decimal digits to show the largest amount fitted with three digits.
+//  e.g. 0.50 and 2.25 on a scale fitted to 2.25G
+func (s *UnitScale) Format(size int64) string {
+	shifts := s.shifts()
+	if shifts == 0 {
+		return fmt.Sprintf("%d", size)
+	}
+	divisor := math.Pow(float64(s.base), float64(shifts))
+	var precision int
+	if digits := 1 + int(math.Log10(float64(s.max)/divisor)); digits < 3 {
+		precision = 3 - digits
+	}
+	return strconv.FormatFloat(float64(size)/divisor, 'f', precision, 64)
+}
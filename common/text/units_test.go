@@ -113,3 +113,59 @@ func TestBitFormatPrecision(t *testing.T) {
 		})
 	})
 }
+
+func TestParseByteAmount(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Byte amounts should accept units that are powers of 1024", t, func() {
+		for arg, expected := range map[string]int64{
+			"100": 100, "100B": 100, "2k": 2048, "512MB": 512 << 20, "1GB": 1 << 30, "1 GiB": 1 << 30, "3T": 3 << 40, "1_000": 1000,
+		} {
+			size, err := ParseByteAmount(arg)
+			So(err, ShouldBeNil)
+			So(size, ShouldEqual, expected)
+		}
+		for _, arg := range []string{"", "GB", "0", "-1MB", "1.5GB", "1PB", "9999999999TB", "_1KB"} {
+			_, err := ParseByteAmount(arg)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestUnitScale(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a byte scale", t, func() {
+		scale := NewShortByteScale()
+
+		Convey("amounts are shown in the unit of the largest fitted", func() {
+			scale.Fit(512 * 1024)
+			scale.Fit(int64(2.25 * 1024 * 1024 * 1024))
+			So(scale.Unit(), ShouldEqual, "G")
+			So(scale.Format(512*1024*1024), ShouldEqual, "0.50")
+			So(scale.Format(int64(2.25*1024*1024*1024)), ShouldEqual, "2.25")
+		})
+
+		Convey("the unit does not shrink when smaller amounts are fitted", func() {
+			scale.Fit(300 * 1024 * 1024)
+			scale.Fit(10)
+			So(scale.Unit(), ShouldEqual, "M")
+			So(scale.Format(300*1024*1024), ShouldEqual, "300")
+			So(scale.Format(10*1024*1024), ShouldEqual, "10")
+		})
+
+		Convey("amounts below the base are shown whole", func() {
+			scale.Fit(999)
+			So(scale.Unit(), ShouldEqual, "B")
+			So(scale.Format(999), ShouldEqual, "999")
+		})
+	})
+
+	Convey("With a bit scale", t, func() {
+		scale := NewBitScale()
+		scale.Fit(12500)
+		So(scale.Unit(), ShouldEqual, "k")
+		So(scale.Format(12500), ShouldEqual, "12.5")
+		So(scale.Format(900), ShouldEqual, "0.9")
+	})
+}
@@ -10,9 +10,25 @@ import (
 	"errors"
 )
 
+// The exit codes of the tools, which scripts wrapping a tool can use to tell
+// why it failed. The exitcode package determines the exit code for an error.
 const (
+	// ExitSuccess means the tool completed its operation.
 	ExitSuccess int = iota
+	// ExitFailure means the tool failed for a reason not listed below.
 	ExitFailure
+	// ExitValidationFailure means the options or input were invalid.
+	ExitValidationFailure
+	// ExitConnectionFailure means the tool could not connect to the server.
+	ExitConnectionFailure
+	// ExitAuthFailure means authentication failed, or the user is not
+	// authorized to perform the operation.
+	ExitAuthFailure
+	// ExitPartialSuccess means the tool failed after part of its operation
+	// was already applied, such as some documents written.
+	ExitPartialSuccess
+	// ExitAborted means the tool was interrupted by a signal.
+	ExitAborted
 )
 
 var (
@@ -35,3 +51,8 @@ type SetupError struct {
 func (se SetupError) Error() string {
 	return se.Err.Error()
 }
+
+// Unwrap returns the underlying error, which determines the exit code.
+func (se SetupError) Unwrap() error {
+	return se.Err
+}
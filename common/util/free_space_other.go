@@ -0,0 +1,19 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// +build !linux,!darwin,!freebsd,!windows,!solaris
+
+package util
+
+import (
+	"errors"
+)
+
+// FreeSpace returns the number of bytes available to the current user on the
+// filesystem holding path. It is not supported on this platform.
+func FreeSpace(path string) (uint64, error) {
+	return 0, errors.New("checking free space is not supported on this platform")
+}
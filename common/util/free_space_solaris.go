@@ -0,0 +1,21 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package util
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// FreeSpace returns the number of bytes available to the current user on the
+// filesystem holding path.
+func FreeSpace(path string) (uint64, error) {
+	var stat unix.Statvfs_t
+	if err := unix.Statvfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return stat.Bavail * stat.Frsize, nil
+}
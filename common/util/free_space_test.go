@@ -0,0 +1,30 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package util
+
+import (
+	"os"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFreeSpace(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Free space is reported for an existing directory", t, func() {
+		free, err := FreeSpace(os.TempDir())
+		So(err, ShouldBeNil)
+		So(free, ShouldBeGreaterThan, 0)
+	})
+
+	Convey("Free space cannot be reported for a missing directory", t, func() {
+		_, err := FreeSpace("/does/not/exist")
+		So(err, ShouldNotBeNil)
+	})
+}
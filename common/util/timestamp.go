@@ -7,6 +7,10 @@
 package util
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -19,3 +23,35 @@ func TimestampGreaterThan(lhs, rhs primitive.Timestamp) bool {
 func TimestampLessThan(lhs, rhs primitive.Timestamp) bool {
 	return lhs.T < rhs.T || lhs.T == rhs.T && lhs.I < rhs.I
 }
+
+// ParseTimestampFlag takes in a string the form of <time_t>:<ordinal>,
+// where <time_t> is the seconds since the UNIX epoch, and <ordinal> represents
+// a counter of operations in the oplog that occurred in the specified second.
+// It parses this timestamp string and returns a bson.MongoTimestamp type.
+func ParseTimestampFlag(ts string) (primitive.Timestamp, error) {
+	var seconds, increment int
+	timestampFields := strings.Split(ts, ":")
+	if len(timestampFields) > 2 {
+		return primitive.Timestamp{}, fmt.Errorf("too many : characters")
+	}
+
+	seconds, err := strconv.Atoi(timestampFields[0])
+	if err != nil {
+		return primitive.Timestamp{}, fmt.Errorf("error parsing timestamp seconds: %v", err)
+	}
+
+	// parse the increment field if it exists
+	if len(timestampFields) == 2 {
+		if len(timestampFields[1]) > 0 {
+			increment, err = strconv.Atoi(timestampFields[1])
+			if err != nil {
+				return primitive.Timestamp{}, fmt.Errorf("error parsing timestamp increment: %v", err)
+			}
+		} else {
+			// handle the case where the user writes "<time_t>:" with no ordinal
+			increment = 0
+		}
+	}
+
+	return primitive.Timestamp{T: uint32(seconds), I: uint32(increment)}, nil
+}
@@ -0,0 +1,216 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+)
+
+// CheckpointFileName is the name of the checkpoint written to the root of a
+// dump directory when a dump is interrupted or fails.
+const CheckpointFileName = "dump-checkpoint.json"
+
+// Checkpoint records which namespaces of a partial dump were dumped
+// completely, so that a later run with --resume only dumps the rest. The
+// files of incomplete namespaces are dumped again from the start.
+type Checkpoint struct {
+	ToolVersion string    `json:"toolVersion,omitempty"`
+	Time        time.Time `json:"time"`
+	DB          string    `json:"db,omitempty"`
+	Collection  string    `json:"collection,omitempty"`
+	Gzip        bool      `json:"gzip,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Completed   []string  `json:"completed"`
+	Incomplete  []string  `json:"incomplete"`
+}
+
+// dumpProgress tracks which of the namespaces being dumped have been dumped
+// completely. It is safe for concurrent use, and its methods do nothing on a
+// nil dumpProgress.
+type dumpProgress struct {
+	mu        sync.Mutex
+	completed map[string]bool
+}
+
+func newDumpProgress() *dumpProgress {
+	return &dumpProgress{completed: make(map[string]bool)}
+}
+
+// expect records that the collection of each regular intent is to be dumped.
+func (p *dumpProgress) expect(all []*intents.Intent) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, intent := range all {
+		if intent.IsSpecialCollection() || intent.IsOplog() {
+			continue
+		}
+		if _, ok := p.completed[intent.Namespace()]; !ok {
+			p.completed[intent.Namespace()] = false
+		}
+	}
+}
+
+// complete records that ns has been dumped completely.
+func (p *dumpProgress) complete(ns string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.completed[ns]; ok {
+		p.completed[ns] = true
+	}
+}
+
+// isComplete returns whether ns has been dumped completely, by this run or by
+// the one it resumes.
+func (p *dumpProgress) isComplete(ns string) bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.completed[ns]
+}
+
+// namespaces returns the sorted completed and incomplete namespaces.
+func (p *dumpProgress) namespaces() (completed, incomplete []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	completed, incomplete = []string{}, []string{}
+	for ns, done := range p.completed {
+		if done {
+			completed = append(completed, ns)
+		} else {
+			incomplete = append(incomplete, ns)
+		}
+	}
+	sort.Strings(completed)
+	sort.Strings(incomplete)
+	return completed, incomplete
+}
+
+// checkpointPath returns where the checkpoint is kept: the root of the dump
+// directory. It returns an empty string for dumps that cannot be resumed,
+// which are those written to an archive or to stdout, and those capturing
+// the oplog, which would no longer be a point-in-time snapshot.
+func (dump *MongoDump) checkpointPath() string {
+	switch {
+	case dump.OutputOptions.Archive != "" || dump.OutputOptions.Out == "-" || dump.OutputOptions.Oplog:
+		return ""
+	case dump.OutputOptions.Out == "":
+		return filepath.Join("dump", CheckpointFileName)
+	}
+	return filepath.Join(dump.OutputOptions.Out, CheckpointFileName)
+}
+
+// loadCheckpoint reads the checkpoint of the dump being resumed, and records
+// its completed namespaces so that they are not dumped again. A missing
+// checkpoint means that there is nothing to resume, and everything is dumped.
+func (dump *MongoDump) loadCheckpoint() error {
+	path := dump.checkpointPath()
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		log.Logvf(log.Always, "no checkpoint found at %v, dumping all namespaces", path)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading checkpoint: %v", err)
+	}
+
+	var checkpoint Checkpoint
+	if err = json.Unmarshal(data, &checkpoint); err != nil {
+		return fmt.Errorf("error parsing checkpoint %v: %v", path, err)
+	}
+	if checkpoint.DB != dump.ToolOptions.Namespace.DB || checkpoint.Collection != dump.ToolOptions.Namespace.Collection {
+		return fmt.Errorf("checkpoint %v is for a dump of db '%v' and collection '%v', not db '%v' and collection '%v'",
+			path, checkpoint.DB, checkpoint.Collection, dump.ToolOptions.Namespace.DB, dump.ToolOptions.Namespace.Collection)
+	}
+	if checkpoint.Gzip != dump.OutputOptions.Gzip {
+		return fmt.Errorf("checkpoint %v is for a dump with --gzip set to %v", path, checkpoint.Gzip)
+	}
+
+	for _, ns := range checkpoint.Completed {
+		dump.progress.completed[ns] = true
+	}
+	log.Logvf(log.Always, "resuming dump from checkpoint %v: %v %v already dumped",
+		path, len(checkpoint.Completed), pluralizeNamespaces(len(checkpoint.Completed)))
+	return nil
+}
+
+// WriteCheckpoint records the outcome of the dump for --resume. If the dump
+// failed, or was interrupted, after deciding which namespaces to dump, it
+// writes a checkpoint listing the completed and incomplete namespaces. If
+// the dump succeeded, any checkpoint left by an earlier run is removed. It
+// does nothing for dumps that cannot be resumed.
+func (dump *MongoDump) WriteCheckpoint(dumpErr error) error {
+	path := dump.checkpointPath()
+	if path == "" || dump.progress == nil {
+		return nil
+	}
+
+	if dumpErr == nil {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing checkpoint: %v", err)
+		}
+		return nil
+	}
+
+	completed, incomplete := dump.progress.namespaces()
+	if len(completed) == 0 && len(incomplete) == 0 {
+		return nil
+	}
+	checkpoint := Checkpoint{
+		ToolVersion: dump.ToolOptions.VersionStr,
+		Time:        time.Now(),
+		DB:          dump.ToolOptions.Namespace.DB,
+		Collection:  dump.ToolOptions.Namespace.Collection,
+		Gzip:        dump.OutputOptions.Gzip,
+		Error:       dumpErr.Error(),
+		Completed:   completed,
+		Incomplete:  incomplete,
+	}
+
+	data, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding checkpoint: %v", err)
+	}
+	if err = os.MkdirAll(filepath.Dir(path), defaultPermissions); err != nil {
+		return fmt.Errorf("error creating directory for checkpoint: %v", err)
+	}
+	// write to a temporary file first, so that an existing checkpoint is
+	// never left half-written
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing checkpoint: %v", err)
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error writing checkpoint: %v", err)
+	}
+
+	log.Logvf(log.Always, "wrote checkpoint to %v: %v %v dumped, %v incomplete; rerun with --resume to finish the dump",
+		path, len(completed), pluralizeNamespaces(len(completed)), len(incomplete))
+	return nil
+}
+
+func pluralizeNamespaces(count int) string {
+	return util.Pluralize(count, "namespace", "namespaces")
+}
@@ -0,0 +1,91 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/mongodb/mongo-tools/common/util"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDumpCheckpoint(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a MongoDump interrupted after dumping one of three namespaces", t, func() {
+		dir, err := ioutil.TempDir("", "mongodump_checkpoint")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		md := simpleMongoDumpInstance()
+		md.ToolOptions.Namespace.DB = "db"
+		md.OutputOptions.Out = dir
+		md.progress = newDumpProgress()
+		md.progress.expect([]*intents.Intent{
+			{DB: "db", C: "a"},
+			{DB: "db", C: "b"},
+			{DB: "db", C: "c"},
+			{DB: "db", C: "system.profile"},
+		})
+		md.progress.complete("db.b")
+		path := filepath.Join(dir, CheckpointFileName)
+
+		Convey("the checkpoint should list the completed and incomplete namespaces", func() {
+			So(md.WriteCheckpoint(util.ErrTerminated), ShouldBeNil)
+
+			data, err := ioutil.ReadFile(path)
+			So(err, ShouldBeNil)
+			var checkpoint Checkpoint
+			So(json.Unmarshal(data, &checkpoint), ShouldBeNil)
+			So(checkpoint.DB, ShouldEqual, "db")
+			So(checkpoint.Error, ShouldEqual, util.ErrTerminated.Error())
+			So(checkpoint.Completed, ShouldResemble, []string{"db.b"})
+			So(checkpoint.Incomplete, ShouldResemble, []string{"db.a", "db.c"})
+
+			Convey("and a resumed dump should skip the completed namespaces", func() {
+				resumed := simpleMongoDumpInstance()
+				resumed.ToolOptions.Namespace.DB = "db"
+				resumed.OutputOptions.Out = dir
+				resumed.progress = newDumpProgress()
+				So(resumed.loadCheckpoint(), ShouldBeNil)
+				So(resumed.progress.isComplete("db.b"), ShouldBeTrue)
+				So(resumed.progress.isComplete("db.a"), ShouldBeFalse)
+
+				Convey("and remove the checkpoint once it succeeds", func() {
+					So(resumed.WriteCheckpoint(nil), ShouldBeNil)
+					_, err := os.Stat(path)
+					So(os.IsNotExist(err), ShouldBeTrue)
+				})
+			})
+
+			Convey("and a dump of another database should not resume it", func() {
+				other := simpleMongoDumpInstance()
+				other.ToolOptions.Namespace.DB = "other"
+				other.OutputOptions.Out = dir
+				other.progress = newDumpProgress()
+				err := other.loadCheckpoint()
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "is for a dump of db 'db'")
+			})
+		})
+
+		Convey("no checkpoint should be written for an archive", func() {
+			md.OutputOptions.Out = ""
+			md.OutputOptions.Archive = filepath.Join(dir, "dump.archive")
+			So(md.WriteCheckpoint(fmt.Errorf("error")), ShouldBeNil)
+			_, err := os.Stat(path)
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+	})
+}
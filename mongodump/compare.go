@@ -0,0 +1,730 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/options"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	mopt "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Ways of comparing documents with --compareDocuments.
+const (
+	CompareDocumentsNone   = "none"
+	CompareDocumentsSample = "sample"
+	CompareDocumentsFull   = "full"
+)
+
+// maxReportedIDs is the most documents of each namespace whose _id is
+// reported when they differ between the source and the target.
+const maxReportedIDs = 10
+
+// boundarySamplesPerRange is the number of _ids sampled for each range of a
+// full comparison, one of which becomes the boundary between two ranges.
+const boundarySamplesPerRange = 4
+
+// sampleLookupBatchSize is the number of sampled documents that are looked up
+// in the target at once.
+const sampleLookupBatchSize = 100
+
+// Ways in which a document can differ between the source and the target.
+const (
+	documentMissing   = "missing from the target"
+	documentExtra     = "only in the target"
+	documentDifferent = "different in the target"
+)
+
+// comparing returns whether the selected namespaces are to be compared with
+// another deployment rather than dumped.
+func (dump *MongoDump) comparing() bool {
+	return dump.CompareOptions != nil && dump.CompareOptions.CompareTo != ""
+}
+
+// validateCompareOptions checks that --compareTo is only combined with
+// options that select what to compare.
+func (dump *MongoDump) validateCompareOptions() error {
+	switch {
+	case dump.OutputOptions.Out != "" || dump.OutputOptions.Archive != "":
+		return fmt.Errorf("--compareTo cannot be used with --out or --archive, since nothing is dumped")
+	case dump.OutputOptions.Oplog:
+		return fmt.Errorf("--compareTo cannot be used with --oplog")
+	case dump.OutputOptions.DumpDBUsersAndRoles:
+		return fmt.Errorf("--compareTo cannot be used with --dumpDbUsersAndRoles")
+	case dump.OutputOptions.ViewsAsCollections:
+		return fmt.Errorf("--compareTo cannot be used with --viewsAsCollections, since views are not compared")
+	case dump.OutputOptions.Resume:
+		return fmt.Errorf("--compareTo cannot be used with --resume")
+	case dump.CompareOptions.CompareSampleSize <= 0:
+		return fmt.Errorf("--compareSampleSize must be positive")
+	case dump.CompareOptions.CompareRangeSize <= 0:
+		return fmt.Errorf("--compareRangeSize must be positive")
+	}
+	if _, err := options.NewURI(dump.CompareOptions.CompareTo); err != nil {
+		return fmt.Errorf("invalid --compareTo: %v", err)
+	}
+	return nil
+}
+
+// targetSessionProvider returns a session provider for the deployment at
+// --compareTo. Its credentials and TLS settings are taken from the connection
+// string alone; the other connection options are those of the source.
+func (dump *MongoDump) targetSessionProvider() (*db.SessionProvider, error) {
+	opts := options.New(dump.ToolOptions.AppName, dump.ToolOptions.VersionStr, dump.ToolOptions.GitCommit, "", false,
+		options.EnabledOptions{Auth: true, Connection: true, URI: true})
+	connection := *dump.ToolOptions.Connection
+	connection.Host, connection.Port = "", ""
+	opts.Connection = &connection
+	opts.URI.ConnectionString = dump.CompareOptions.CompareTo
+	if err := opts.NormalizeOptionsAndURI(); err != nil {
+		return nil, fmt.Errorf("invalid --compareTo: %v", err)
+	}
+	return db.NewSessionProvider(*opts)
+}
+
+// Compare compares the namespaces selected by --db and --collection with the
+// same namespaces of the deployment at --compareTo, such as one restored from
+// a dump, and logs each difference found. The document counts and indexes of
+// each collection are compared, and then its documents according to
+// --compareDocuments, reading them with --query and --excludeFields on both
+// sides. Views are not compared. It returns an error if any namespace
+// differs.
+func (dump *MongoDump) Compare() error {
+	defer dump.SessionProvider.Close()
+
+	exists, err := dump.verifyCollectionExists()
+	if err != nil {
+		return fmt.Errorf("error verifying collection info: %v", err)
+	}
+	if !exists {
+		return fmt.Errorf("namespace with DB %s and collection %s does not exist",
+			dump.ToolOptions.Namespace.DB, dump.ToolOptions.Namespace.Collection)
+	}
+
+	if err = dump.parseQueryAndProjection(); err != nil {
+		return err
+	}
+
+	targetProvider, err := dump.targetSessionProvider()
+	if err != nil {
+		return fmt.Errorf("error connecting to --compareTo: %v", err)
+	}
+	defer targetProvider.Close()
+	target, err := targetProvider.GetSession()
+	if err != nil {
+		return fmt.Errorf("error connecting to --compareTo: %v", err)
+	}
+	source, err := dump.SessionProvider.GetSession()
+	if err != nil {
+		return fmt.Errorf("error getting a client session: %v", err)
+	}
+
+	if err = dump.createNamespaceIntents(); err != nil {
+		return fmt.Errorf("error creating intents to compare: %v", err)
+	}
+	namespaces := dump.manager.Intents()
+	sort.Slice(namespaces, func(i, j int) bool {
+		return namespaces[i].Namespace() < namespaces[j].Namespace()
+	})
+
+	compared, differing := 0, 0
+	for _, intent := range namespaces {
+		if intent.IsView() {
+			log.Logvf(log.Info, "not comparing %v, it is a view", intent.Namespace())
+			continue
+		}
+		result, err := dump.compareNamespace(source, target, intent)
+		if err != nil {
+			return fmt.Errorf("error comparing %v: %v", intent.Namespace(), err)
+		}
+		compared++
+		if !result.log() {
+			differing++
+		}
+	}
+
+	log.Logvf(log.Always, "compared %v namespaces with --compareTo, %v differ", compared, differing)
+	if differing > 0 {
+		return fmt.Errorf("%v of %v namespaces differ from --compareTo", differing, compared)
+	}
+	return nil
+}
+
+// namespaceComparison holds the differences found between a namespace in the
+// source and in the target.
+type namespaceComparison struct {
+	namespace   string
+	missing     bool
+	sourceCount int64
+	targetCount int64
+	indexes     []string
+	documents   documentComparison
+}
+
+// documentComparison counts the source documents compared and those that
+// differ from the target, and describes the first maxReportedIDs that do.
+type documentComparison struct {
+	compared  int64
+	missing   int64
+	extra     int64
+	different int64
+	examples  []string
+}
+
+// record counts a document that differs in the given way.
+func (c *documentComparison) record(id string, difference string) {
+	switch difference {
+	case documentMissing:
+		c.missing++
+	case documentExtra:
+		c.extra++
+	default:
+		c.different++
+	}
+	if len(c.examples) < maxReportedIDs {
+		c.examples = append(c.examples, fmt.Sprintf("document with _id %v is %v", id, difference))
+	}
+}
+
+// merge adds the documents counted by other to c.
+func (c *documentComparison) merge(other documentComparison) {
+	c.compared += other.compared
+	c.missing += other.missing
+	c.extra += other.extra
+	c.different += other.different
+	for _, example := range other.examples {
+		if len(c.examples) < maxReportedIDs {
+			c.examples = append(c.examples, example)
+		}
+	}
+}
+
+// discrepancies returns a description of each difference found, or nothing
+// if the namespace is the same in the target.
+func (c namespaceComparison) discrepancies() []string {
+	if c.missing {
+		return []string{"missing from the target"}
+	}
+	var found []string
+	if c.sourceCount != c.targetCount {
+		found = append(found, fmt.Sprintf("%v documents in the source but %v in the target", c.sourceCount, c.targetCount))
+	}
+	found = append(found, c.indexes...)
+	d := c.documents
+	if d.missing+d.extra+d.different > 0 {
+		found = append(found, fmt.Sprintf("of %v documents compared, %v are missing from the target, %v are only in the target and %v are different",
+			d.compared, d.missing, d.extra, d.different))
+		found = append(found, d.examples...)
+	}
+	return found
+}
+
+// log logs the differences found, and returns whether there were none.
+func (c namespaceComparison) log() bool {
+	found := c.discrepancies()
+	for _, discrepancy := range found {
+		log.Logvf(log.Always, "%v: %v", c.namespace, discrepancy)
+	}
+	if len(found) == 0 {
+		log.Logvf(log.Always, "%v: matches (%v documents, %v compared)", c.namespace, c.sourceCount, c.documents.compared)
+	}
+	return len(found) == 0
+}
+
+// compareNamespace compares the collection of intent in source and target.
+func (dump *MongoDump) compareNamespace(source, target *mongo.Client, intent *intents.Intent) (namespaceComparison, error) {
+	result := namespaceComparison{namespace: intent.Namespace()}
+	sourceColl := source.Database(intent.DB).Collection(intent.C)
+	targetColl := target.Database(intent.DB).Collection(intent.C)
+
+	info, err := db.GetCollectionInfo(targetColl)
+	if err != nil {
+		return result, fmt.Errorf("error getting collection info from the target: %v", err)
+	}
+	if info == nil {
+		result.missing = true
+		return result, nil
+	}
+
+	filter := dump.query
+	if filter == nil {
+		filter = bson.D{}
+	}
+	if result.sourceCount, err = sourceColl.CountDocuments(context.Background(), filter); err != nil {
+		return result, fmt.Errorf("error counting documents in the source: %v", err)
+	}
+	if result.targetCount, err = targetColl.CountDocuments(context.Background(), filter); err != nil {
+		return result, fmt.Errorf("error counting documents in the target: %v", err)
+	}
+
+	sourceIndexes, err := listIndexSpecs(sourceColl)
+	if err != nil {
+		return result, fmt.Errorf("error listing indexes in the source: %v", err)
+	}
+	targetIndexes, err := listIndexSpecs(targetColl)
+	if err != nil {
+		return result, fmt.Errorf("error listing indexes in the target: %v", err)
+	}
+	result.indexes, err = compareIndexSpecs(sourceIndexes, targetIndexes)
+	if err != nil {
+		return result, err
+	}
+
+	switch dump.CompareOptions.CompareDocuments {
+	case CompareDocumentsSample:
+		result.documents, err = dump.compareSample(sourceColl, targetColl)
+	case CompareDocumentsFull:
+		result.documents, err = dump.compareRanges(sourceColl, targetColl, result.sourceCount)
+	}
+	return result, err
+}
+
+// listIndexSpecs returns the specifications of the indexes of coll.
+func listIndexSpecs(coll *mongo.Collection) ([]bson.D, error) {
+	cursor, err := db.GetIndexes(coll)
+	if err != nil {
+		return nil, err
+	}
+	var specs []bson.D
+	if err = cursor.All(context.Background(), &specs); err != nil {
+		return nil, err
+	}
+	return specs, nil
+}
+
+// compareIndexSpecs returns a description of each index that is missing from
+// target, only in target, or has a different key or options in target.
+// Indexes are matched by name.
+func compareIndexSpecs(source, target []bson.D) ([]string, error) {
+	targetSpecs := make(map[string]string, len(target))
+	for _, spec := range target {
+		name, canonical, err := canonicalIndexSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		targetSpecs[name] = canonical
+	}
+
+	var found []string
+	sourceNames := make(map[string]bool, len(source))
+	for _, spec := range source {
+		name, canonical, err := canonicalIndexSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		sourceNames[name] = true
+		targetSpec, ok := targetSpecs[name]
+		switch {
+		case !ok:
+			found = append(found, fmt.Sprintf("index %v %v is missing from the target", name, canonical))
+		case targetSpec != canonical:
+			found = append(found, fmt.Sprintf("index %v is %v in the source but %v in the target", name, canonical, targetSpec))
+		}
+	}
+	for _, spec := range target {
+		name, canonical, _ := canonicalIndexSpec(spec)
+		if !sourceNames[name] {
+			found = append(found, fmt.Sprintf("index %v %v is only in the target", name, canonical))
+		}
+	}
+	return found, nil
+}
+
+// canonicalIndexSpec returns the name of the index that spec describes, and
+// its key and options as Extended JSON that is the same for equivalent
+// indexes: the index version and namespace are left out, the options are
+// sorted by name and numbers are compared as doubles, since a restore may
+// create an index with options in another order or of another numeric type.
+func canonicalIndexSpec(spec bson.D) (string, string, error) {
+	var name string
+	var canonical bson.D
+	for _, elem := range spec {
+		switch elem.Key {
+		case "name":
+			name, _ = elem.Value.(string)
+		case "v", "ns":
+		case "key":
+			key, ok := elem.Value.(bson.D)
+			if !ok {
+				canonical = append(canonical, elem)
+				continue
+			}
+			normalized := make(bson.D, len(key))
+			for i, field := range key {
+				normalized[i] = bson.E{Key: field.Key, Value: normalizeNumber(field.Value)}
+			}
+			canonical = append(canonical, bson.E{Key: elem.Key, Value: normalized})
+		default:
+			canonical = append(canonical, bson.E{Key: elem.Key, Value: normalizeNumber(elem.Value)})
+		}
+	}
+	sort.SliceStable(canonical, func(i, j int) bool {
+		return canonical[i].Key < canonical[j].Key
+	})
+	out, err := bson.MarshalExtJSON(canonical, false, false)
+	if err != nil {
+		return "", "", fmt.Errorf("error encoding specification of index %v: %v", name, err)
+	}
+	return name, string(out), nil
+}
+
+// normalizeNumber returns value as a float64 if it is a number.
+func normalizeNumber(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case int:
+		return float64(v)
+	}
+	return value
+}
+
+// documentIterator returns the next document of a sequence, or nil once
+// there are none left.
+type documentIterator func() (bson.Raw, error)
+
+// cursorIterator returns a documentIterator over the documents of cursor.
+// Each document is only valid until the next is read.
+func cursorIterator(cursor *mongo.Cursor) documentIterator {
+	return func() (bson.Raw, error) {
+		if cursor.Next(context.Background()) {
+			return cursor.Current, nil
+		}
+		return nil, cursor.Err()
+	}
+}
+
+// documentKey returns a key identifying the _id of doc by its type and value,
+// and the _id as text.
+func documentKey(doc bson.Raw) (string, string, error) {
+	id, err := doc.LookupErr("_id")
+	if err != nil {
+		return "", "", fmt.Errorf("document has no _id: %v", doc)
+	}
+	return string(byte(id.Type)) + string(id.Value), id.String(), nil
+}
+
+// diffDocuments compares the documents of source and target, which are both
+// in _id order, and records those that differ in result. The two are read in
+// step while their documents are identical; from the first difference on,
+// the rest of target is hashed by _id to tell which documents are missing,
+// only in the target, or different. Documents are compared byte for byte, so
+// a document with the same fields in another order differs.
+func diffDocuments(source, target documentIterator, result *documentComparison) error {
+	for {
+		s, err := source()
+		if err != nil {
+			return err
+		}
+		t, err := target()
+		if err != nil {
+			return err
+		}
+		if s == nil && t == nil {
+			return nil
+		}
+		if s == nil || t == nil || !bytes.Equal(s, t) {
+			return diffRemaining(s, t, source, target, result)
+		}
+		result.compared++
+	}
+}
+
+// targetDocument is the hash and _id of a document read from the target.
+type targetDocument struct {
+	id   string
+	hash [sha256.Size]byte
+	seen bool
+}
+
+// diffRemaining compares s and the rest of source with t and the rest of
+// target, in any order.
+func diffRemaining(s, t bson.Raw, source, target documentIterator, result *documentComparison) error {
+	var order []string
+	targetDocs := make(map[string]*targetDocument)
+	for t != nil {
+		key, id, err := documentKey(t)
+		if err != nil {
+			return err
+		}
+		order = append(order, key)
+		targetDocs[key] = &targetDocument{id: id, hash: sha256.Sum256(t)}
+		if t, err = target(); err != nil {
+			return err
+		}
+	}
+
+	for s != nil {
+		key, id, err := documentKey(s)
+		if err != nil {
+			return err
+		}
+		result.compared++
+		targetDoc, ok := targetDocs[key]
+		switch {
+		case !ok:
+			result.record(id, documentMissing)
+		case targetDoc.hash != sha256.Sum256(s):
+			result.record(id, documentDifferent)
+		}
+		if ok {
+			targetDoc.seen = true
+		}
+		if s, err = source(); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range order {
+		if targetDoc := targetDocs[key]; !targetDoc.seen {
+			result.record(targetDoc.id, documentExtra)
+		}
+	}
+	return nil
+}
+
+// compareSample looks up a random sample of the source's documents in the
+// target. Documents only in the target are not found this way, but are
+// reflected in the document counts.
+func (dump *MongoDump) compareSample(source, target *mongo.Collection) (documentComparison, error) {
+	var result documentComparison
+	var pipeline mongo.Pipeline
+	if len(dump.query) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: dump.query}})
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$sample", Value: bson.D{{Key: "size", Value: dump.CompareOptions.CompareSampleSize}}}})
+	if dump.projection != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$project", Value: dump.projection}})
+	}
+	cursor, err := source.Aggregate(context.Background(), pipeline, mopt.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return result, fmt.Errorf("error sampling documents in the source: %v", err)
+	}
+	defer cursor.Close(context.Background())
+
+	batch := make([]bson.Raw, 0, sampleLookupBatchSize)
+	for cursor.Next(context.Background()) {
+		batch = append(batch, append(bson.Raw(nil), cursor.Current...))
+		if len(batch) < sampleLookupBatchSize {
+			continue
+		}
+		if err = dump.lookUpSample(target, batch, &result); err != nil {
+			return result, err
+		}
+		batch = batch[:0]
+	}
+	if err = cursor.Err(); err != nil {
+		return result, fmt.Errorf("error sampling documents in the source: %v", err)
+	}
+	return result, dump.lookUpSample(target, batch, &result)
+}
+
+// lookUpSample finds the documents of sample in the target by _id, and
+// records those that are missing or different.
+func (dump *MongoDump) lookUpSample(target *mongo.Collection, sample []bson.Raw, result *documentComparison) error {
+	if len(sample) == 0 {
+		return nil
+	}
+	ids := make(bson.A, 0, len(sample))
+	for _, doc := range sample {
+		ids = append(ids, doc.Lookup("_id"))
+	}
+	filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}
+	if len(dump.query) > 0 {
+		filter = bson.D{{Key: "$and", Value: bson.A{dump.query, filter}}}
+	}
+	findOpts := mopt.Find()
+	if dump.projection != nil {
+		findOpts.SetProjection(dump.projection)
+	}
+	cursor, err := target.Find(context.Background(), filter, findOpts)
+	if err != nil {
+		return fmt.Errorf("error looking up sampled documents in the target: %v", err)
+	}
+	defer cursor.Close(context.Background())
+
+	found := make(map[string]bson.Raw, len(sample))
+	for cursor.Next(context.Background()) {
+		key, _, err := documentKey(cursor.Current)
+		if err != nil {
+			return err
+		}
+		found[key] = append(bson.Raw(nil), cursor.Current...)
+	}
+	if err = cursor.Err(); err != nil {
+		return fmt.Errorf("error looking up sampled documents in the target: %v", err)
+	}
+	return diffSample(sample, found, result)
+}
+
+// diffSample records each document of sample that is missing from found,
+// which holds the target's documents by documentKey, or different there.
+func diffSample(sample []bson.Raw, found map[string]bson.Raw, result *documentComparison) error {
+	for _, doc := range sample {
+		key, id, err := documentKey(doc)
+		if err != nil {
+			return err
+		}
+		result.compared++
+		targetDoc, ok := found[key]
+		switch {
+		case !ok:
+			result.record(id, documentMissing)
+		case !bytes.Equal(doc, targetDoc):
+			result.record(id, documentDifferent)
+		}
+	}
+	return nil
+}
+
+// compareRanges compares every document of the source with the target, in
+// ranges of _id of about --compareRangeSize documents, up to
+// --numParallelCollections ranges at a time.
+func (dump *MongoDump) compareRanges(source, target *mongo.Collection, count int64) (documentComparison, error) {
+	var result documentComparison
+	boundaries, err := dump.rangeBoundaries(source, count)
+	if err != nil {
+		return result, err
+	}
+
+	// range i holds the _ids from boundaries[i-1] up to boundaries[i]
+	ranges := len(boundaries) + 1
+	results := make([]documentComparison, ranges)
+	errs := make([]error, ranges)
+	jobs := make(chan int, ranges)
+	for i := 0; i < ranges; i++ {
+		jobs <- i
+	}
+	close(jobs)
+
+	workers := dump.OutputOptions.NumParallelCollections
+	if workers > ranges {
+		workers = ranges
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				var min, max *bson.RawValue
+				if i > 0 {
+					min = &boundaries[i-1]
+				}
+				if i < len(boundaries) {
+					max = &boundaries[i]
+				}
+				errs[i] = dump.compareRange(source, target, min, max, &results[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := range results {
+		if errs[i] != nil {
+			return result, errs[i]
+		}
+		result.merge(results[i])
+	}
+	return result, nil
+}
+
+// rangeBoundaries returns the _ids that split the count documents of coll
+// into ranges of about --compareRangeSize documents, in _id order. They are
+// taken from a sorted random sample of its _ids.
+func (dump *MongoDump) rangeBoundaries(coll *mongo.Collection, count int64) ([]bson.RawValue, error) {
+	size := int64(dump.CompareOptions.CompareRangeSize)
+	ranges := (count + size - 1) / size
+	if ranges <= 1 {
+		return nil, nil
+	}
+
+	var pipeline mongo.Pipeline
+	if len(dump.query) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: dump.query}})
+	}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$sample", Value: bson.D{{Key: "size", Value: ranges * boundarySamplesPerRange}}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+		bson.D{{Key: "$project", Value: bson.D{{Key: "_id", Value: 1}}}},
+	)
+	cursor, err := coll.Aggregate(context.Background(), pipeline, mopt.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, fmt.Errorf("error sampling _id ranges in the source: %v", err)
+	}
+	defer cursor.Close(context.Background())
+
+	var ids []bson.RawValue
+	for cursor.Next(context.Background()) {
+		id := cursor.Current.Lookup("_id")
+		ids = append(ids, bson.RawValue{Type: id.Type, Value: append([]byte(nil), id.Value...)})
+	}
+	if err = cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error sampling _id ranges in the source: %v", err)
+	}
+	return pickBoundaries(ids, boundarySamplesPerRange), nil
+}
+
+// pickBoundaries returns every nth of the sorted ids, leaving out repeats,
+// since a random sample can hold the same document more than once.
+func pickBoundaries(ids []bson.RawValue, n int) []bson.RawValue {
+	var boundaries []bson.RawValue
+	for i := n; i < len(ids); i += n {
+		if len(boundaries) > 0 && boundaries[len(boundaries)-1].Equal(ids[i]) {
+			continue
+		}
+		boundaries = append(boundaries, ids[i])
+	}
+	return boundaries
+}
+
+// compareRange compares the documents of source and target whose _id is at
+// least min and less than max, where nil is unbounded. The range is read
+// with min and max bounds on the _id index, so that _ids of different types
+// are ordered as in the index rather than only matching their own type.
+func (dump *MongoDump) compareRange(source, target *mongo.Collection, min, max *bson.RawValue, result *documentComparison) error {
+	idIndex := bson.D{{Key: "_id", Value: 1}}
+	findOpts := mopt.Find().SetHint(idIndex).SetSort(idIndex)
+	if min != nil {
+		findOpts.SetMin(bson.D{{Key: "_id", Value: *min}})
+	}
+	if max != nil {
+		findOpts.SetMax(bson.D{{Key: "_id", Value: *max}})
+	}
+	if dump.projection != nil {
+		findOpts.SetProjection(dump.projection)
+	}
+	filter := dump.query
+	if filter == nil {
+		filter = bson.D{}
+	}
+
+	sourceCursor, err := source.Find(context.Background(), filter, findOpts)
+	if err != nil {
+		return fmt.Errorf("error reading documents from the source: %v", err)
+	}
+	defer sourceCursor.Close(context.Background())
+	targetCursor, err := target.Find(context.Background(), filter, findOpts)
+	if err != nil {
+		return fmt.Errorf("error reading documents from the target: %v", err)
+	}
+	defer targetCursor.Close(context.Background())
+
+	return diffDocuments(cursorIterator(sourceCursor), cursorIterator(targetCursor), result)
+}
@@ -0,0 +1,249 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func rawDocs(docs ...bson.D) []bson.Raw {
+	raws := make([]bson.Raw, len(docs))
+	for i, doc := range docs {
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			panic(err)
+		}
+		raws[i] = raw
+	}
+	return raws
+}
+
+func sliceIterator(docs []bson.Raw) documentIterator {
+	return func() (bson.Raw, error) {
+		if len(docs) == 0 {
+			return nil, nil
+		}
+		doc := docs[0]
+		docs = docs[1:]
+		return doc, nil
+	}
+}
+
+func TestDiffDocuments(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("When comparing a range of documents", t, func() {
+		source := rawDocs(
+			bson.D{{Key: "_id", Value: 1}, {Key: "a", Value: "x"}},
+			bson.D{{Key: "_id", Value: 2}, {Key: "a", Value: "y"}},
+			bson.D{{Key: "_id", Value: 3}, {Key: "a", Value: "z"}},
+			bson.D{{Key: "_id", Value: 4}, {Key: "a", Value: "w"}},
+		)
+
+		Convey("identical documents match", func() {
+			var result documentComparison
+			So(diffDocuments(sliceIterator(source), sliceIterator(source), &result), ShouldBeNil)
+			So(result.compared, ShouldEqual, 4)
+			So(result.missing+result.extra+result.different, ShouldEqual, 0)
+		})
+
+		Convey("missing, extra and different documents are found", func() {
+			target := rawDocs(
+				bson.D{{Key: "_id", Value: 1}, {Key: "a", Value: "x"}},
+				bson.D{{Key: "_id", Value: 3}, {Key: "a", Value: "changed"}},
+				bson.D{{Key: "_id", Value: 4}, {Key: "a", Value: "w"}},
+				bson.D{{Key: "_id", Value: 5}, {Key: "a", Value: "v"}},
+			)
+			var result documentComparison
+			So(diffDocuments(sliceIterator(source), sliceIterator(target), &result), ShouldBeNil)
+			So(result.compared, ShouldEqual, 4)
+			So(result.missing, ShouldEqual, 1)
+			So(result.extra, ShouldEqual, 1)
+			So(result.different, ShouldEqual, 1)
+			So(result.examples, ShouldResemble, []string{
+				`document with _id {"$numberInt":"2"} is missing from the target`,
+				`document with _id {"$numberInt":"3"} is different in the target`,
+				`document with _id {"$numberInt":"5"} is only in the target`,
+			})
+		})
+
+		Convey("an _id of another type is a different document", func() {
+			target := rawDocs(
+				bson.D{{Key: "_id", Value: int64(1)}, {Key: "a", Value: "x"}},
+			)
+			var result documentComparison
+			So(diffDocuments(sliceIterator(source[:1]), sliceIterator(target), &result), ShouldBeNil)
+			So(result.missing, ShouldEqual, 1)
+			So(result.extra, ShouldEqual, 1)
+		})
+
+		Convey("the same fields in another order differ", func() {
+			target := rawDocs(bson.D{{Key: "a", Value: "x"}, {Key: "_id", Value: 1}})
+			var result documentComparison
+			So(diffDocuments(sliceIterator(source[:1]), sliceIterator(target), &result), ShouldBeNil)
+			So(result.different, ShouldEqual, 1)
+		})
+
+		Convey("only the first differences are described", func() {
+			var result documentComparison
+			So(diffDocuments(sliceIterator(nil), sliceIterator(rawDocs(
+				bson.D{{Key: "_id", Value: 1}}, bson.D{{Key: "_id", Value: 2}}, bson.D{{Key: "_id", Value: 3}},
+				bson.D{{Key: "_id", Value: 4}}, bson.D{{Key: "_id", Value: 5}}, bson.D{{Key: "_id", Value: 6}},
+				bson.D{{Key: "_id", Value: 7}}, bson.D{{Key: "_id", Value: 8}}, bson.D{{Key: "_id", Value: 9}},
+				bson.D{{Key: "_id", Value: 10}}, bson.D{{Key: "_id", Value: 11}},
+			)), &result), ShouldBeNil)
+			So(result.extra, ShouldEqual, 11)
+			So(len(result.examples), ShouldEqual, maxReportedIDs)
+		})
+	})
+}
+
+func TestDiffSample(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Sampled documents missing from or different in the target are recorded", t, func() {
+		sample := rawDocs(
+			bson.D{{Key: "_id", Value: "a"}, {Key: "n", Value: 1}},
+			bson.D{{Key: "_id", Value: "b"}, {Key: "n", Value: 2}},
+			bson.D{{Key: "_id", Value: "c"}, {Key: "n", Value: 3}},
+		)
+		found := make(map[string]bson.Raw)
+		for _, doc := range rawDocs(
+			bson.D{{Key: "_id", Value: "a"}, {Key: "n", Value: 1}},
+			bson.D{{Key: "_id", Value: "c"}, {Key: "n", Value: 4}},
+		) {
+			key, _, err := documentKey(doc)
+			So(err, ShouldBeNil)
+			found[key] = doc
+		}
+
+		var result documentComparison
+		So(diffSample(sample, found, &result), ShouldBeNil)
+		So(result.compared, ShouldEqual, 3)
+		So(result.missing, ShouldEqual, 1)
+		So(result.different, ShouldEqual, 1)
+		So(result.examples, ShouldResemble, []string{
+			`document with _id "b" is missing from the target`,
+			`document with _id "c" is different in the target`,
+		})
+	})
+}
+
+func TestCompareIndexSpecs(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("When comparing index specifications", t, func() {
+		idIndex := bson.D{{Key: "v", Value: 2}, {Key: "key", Value: bson.D{{Key: "_id", Value: 1}}}, {Key: "name", Value: "_id_"}}
+
+		Convey("the version, namespace, option order and numeric types are ignored", func() {
+			source := []bson.D{idIndex, {
+				{Key: "v", Value: 1},
+				{Key: "key", Value: bson.D{{Key: "a", Value: 1}, {Key: "b", Value: -1}}},
+				{Key: "name", Value: "a_1_b_-1"},
+				{Key: "ns", Value: "test.c"},
+				{Key: "unique", Value: true},
+				{Key: "expireAfterSeconds", Value: int32(60)},
+			}}
+			target := []bson.D{idIndex, {
+				{Key: "v", Value: 2},
+				{Key: "expireAfterSeconds", Value: int64(60)},
+				{Key: "key", Value: bson.D{{Key: "a", Value: 1.0}, {Key: "b", Value: int64(-1)}}},
+				{Key: "unique", Value: true},
+				{Key: "name", Value: "a_1_b_-1"},
+			}}
+			found, err := compareIndexSpecs(source, target)
+			So(err, ShouldBeNil)
+			So(found, ShouldBeEmpty)
+		})
+
+		Convey("missing, extra and different indexes are found", func() {
+			source := []bson.D{idIndex,
+				{{Key: "key", Value: bson.D{{Key: "a", Value: 1}, {Key: "b", Value: 1}}}, {Key: "name", Value: "ab"}},
+				{{Key: "key", Value: bson.D{{Key: "c", Value: 1}}}, {Key: "name", Value: "c_1"}},
+			}
+			target := []bson.D{idIndex,
+				{{Key: "key", Value: bson.D{{Key: "b", Value: 1}, {Key: "a", Value: 1}}}, {Key: "name", Value: "ab"}},
+				{{Key: "key", Value: bson.D{{Key: "d", Value: 1}}}, {Key: "name", Value: "d_1"}, {Key: "sparse", Value: true}},
+			}
+			found, err := compareIndexSpecs(source, target)
+			So(err, ShouldBeNil)
+			So(found, ShouldResemble, []string{
+				`index ab is {"key":{"a":1.0,"b":1.0}} in the source but {"key":{"b":1.0,"a":1.0}} in the target`,
+				`index c_1 {"key":{"c":1.0}} is missing from the target`,
+				`index d_1 {"key":{"d":1.0},"sparse":true} is only in the target`,
+			})
+		})
+	})
+}
+
+func TestPickBoundaries(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Range boundaries are every nth sampled _id, without repeats", t, func() {
+		var ids []bson.RawValue
+		for _, n := range []int32{1, 2, 3, 4, 4, 5, 6, 7, 8, 8, 9} {
+			ids = append(ids, bson.RawValue{Type: bson.TypeInt32, Value: []byte{byte(n), 0, 0, 0}})
+		}
+		boundaries := pickBoundaries(ids, 2)
+		var values []int32
+		for _, boundary := range boundaries {
+			values = append(values, boundary.Int32())
+		}
+		So(values, ShouldResemble, []int32{3, 4, 6, 8, 9})
+		So(pickBoundaries(ids[:2], 4), ShouldBeEmpty)
+	})
+}
+
+func TestValidateCompareOptions(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With --compareTo", t, func() {
+		dump := MongoDump{
+			ToolOptions:  &options.ToolOptions{Namespace: &options.Namespace{}},
+			InputOptions: &InputOptions{},
+			OutputOptions: &OutputOptions{
+				NumParallelCollections: 4,
+			},
+			CompareOptions: &CompareOptions{
+				CompareTo:         "mongodb://localhost:27018",
+				CompareDocuments:  CompareDocumentsSample,
+				CompareSampleSize: 1000,
+				CompareRangeSize:  10000,
+			},
+		}
+
+		Convey("the default options are valid", func() {
+			So(dump.ValidateOptions(), ShouldBeNil)
+		})
+
+		Convey("output options are rejected", func() {
+			dump.OutputOptions.Out = "dump"
+			So(dump.ValidateOptions(), ShouldNotBeNil)
+			dump.OutputOptions.Out = ""
+			dump.OutputOptions.Oplog = true
+			So(dump.ValidateOptions(), ShouldNotBeNil)
+		})
+
+		Convey("the sample and range sizes must be positive", func() {
+			dump.CompareOptions.CompareSampleSize = 0
+			So(dump.ValidateOptions(), ShouldNotBeNil)
+			dump.CompareOptions.CompareSampleSize = 1
+			dump.CompareOptions.CompareRangeSize = -1
+			So(dump.ValidateOptions(), ShouldNotBeNil)
+		})
+
+		Convey("the connection string must be valid", func() {
+			dump.CompareOptions.CompareTo = "localhost:27018"
+			So(dump.ValidateOptions(), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,156 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// DiagnosticsDirName is the folder of a dump directory that --supportBundle
+// writes diagnostic data to.
+const DiagnosticsDirName = "diagnostics"
+
+// diagnosticCommands are the commands whose output is saved by
+// --supportBundle, each to a file named after the command.
+var diagnosticCommands = []struct {
+	name string
+	cmd  bson.D
+}{
+	{"buildInfo", bson.D{{"buildInfo", 1}}},
+	{"serverStatus", bson.D{{"serverStatus", 1}}},
+	{"replSetGetStatus", bson.D{{"replSetGetStatus", 1}}},
+	{"currentOp", bson.D{{"currentOp", 1}, {"$all", true}}},
+}
+
+// diagnosticsPath returns the folder diagnostic data is written to.
+func (dump *MongoDump) diagnosticsPath() string {
+	out := dump.OutputOptions.Out
+	if out == "" {
+		out = "dump"
+	}
+	return filepath.Join(out, DiagnosticsDirName)
+}
+
+// DumpDiagnostics writes the output of buildInfo, serverStatus,
+// replSetGetStatus and currentOp, along with the contents of each dumped
+// database's system.profile collection, to the diagnostics folder of the dump.
+// Data that cannot be collected, e.g. replSetGetStatus on a standalone server,
+// is skipped with a warning.
+func (dump *MongoDump) DumpDiagnostics() error {
+	dir := dump.diagnosticsPath()
+	log.Logvf(log.Always, "writing diagnostics to %v", dir)
+	if err := os.MkdirAll(dir, defaultPermissions); err != nil {
+		return fmt.Errorf("error creating diagnostics directory: %v", err)
+	}
+
+	session, err := dump.SessionProvider.GetSession()
+	if err != nil {
+		return err
+	}
+
+	for _, diagnostic := range diagnosticCommands {
+		result, err := session.Database("admin").RunCommand(context.Background(), diagnostic.cmd).DecodeBytes()
+		if err != nil {
+			dump.diagnosticsWarning("could not run %v: %v", diagnostic.name, err)
+			continue
+		}
+		out, err := bson.MarshalExtJSON(result, false, false)
+		if err != nil {
+			return fmt.Errorf("error converting %v output to JSON: %v", diagnostic.name, err)
+		}
+		var indented bytes.Buffer
+		if err = json.Indent(&indented, out, "", "  "); err != nil {
+			return fmt.Errorf("error formatting %v output: %v", diagnostic.name, err)
+		}
+		indented.WriteByte('\n')
+		path := filepath.Join(dir, diagnostic.name+".json")
+		if err = ioutil.WriteFile(path, indented.Bytes(), 0644); err != nil {
+			return fmt.Errorf("error writing %v: %v", path, err)
+		}
+	}
+
+	if dump.isMongos {
+		log.Logvf(log.Always, "not writing system.profile contents when connected to a mongos")
+		return nil
+	}
+	dbs := []string{dump.ToolOptions.DB}
+	if dump.ToolOptions.DB == "" {
+		if dbs, err = dump.SessionProvider.DatabaseNames(); err != nil {
+			dump.diagnosticsWarning("could not list databases to read system.profile: %v", err)
+			return nil
+		}
+	}
+	for _, dbName := range dbs {
+		if err = dump.dumpProfile(session, dbName, dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dumpProfile writes the contents of dbName.system.profile as relaxed
+// extended JSON, one document per line. Nothing is written if the collection
+// is empty or does not exist.
+func (dump *MongoDump) dumpProfile(session *mongo.Client, dbName, dir string) (err error) {
+	cursor, err := session.Database(dbName).Collection("system.profile").Find(context.Background(), bson.D{})
+	if err != nil {
+		dump.diagnosticsWarning("could not read %v.system.profile: %v", dbName, err)
+		return nil
+	}
+	defer cursor.Close(context.Background())
+
+	path := filepath.Join(dir, dbName+".system.profile.json")
+	var file *os.File
+	var out *bufio.Writer
+	defer func() {
+		if file == nil {
+			return
+		}
+		if flushErr := out.Flush(); err == nil {
+			err = flushErr
+		}
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	for cursor.Next(context.Background()) {
+		if file == nil {
+			if file, err = os.Create(path); err != nil {
+				return fmt.Errorf("error creating %v: %v", path, err)
+			}
+			out = bufio.NewWriter(file)
+		}
+		var doc []byte
+		if doc, err = bson.MarshalExtJSON(cursor.Current, false, false); err != nil {
+			return fmt.Errorf("error converting %v.system.profile document to JSON: %v", dbName, err)
+		}
+		if _, err = out.Write(append(doc, '\n')); err != nil {
+			return fmt.Errorf("error writing %v: %v", path, err)
+		}
+	}
+	if err = cursor.Err(); err != nil {
+		dump.diagnosticsWarning("error reading %v.system.profile: %v", dbName, err)
+	}
+	return nil
+}
+
+func (dump *MongoDump) diagnosticsWarning(format string, args ...interface{}) {
+	log.Logvf(log.Always, "warning: "+format, args...)
+	dump.report.warn("", format, args...)
+}
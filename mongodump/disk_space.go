@@ -0,0 +1,136 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/text"
+	"github.com/mongodb/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// diskSpaceCheckInterval is how often free space is checked during a dump
+// with --checkDiskSpace.
+const diskSpaceCheckInterval = time.Second
+
+// outputVolumePath returns an existing path on the volume the dump is written
+// to, or "" if it is written to standard output.
+func (dump *MongoDump) outputVolumePath() string {
+	path := dump.OutputOptions.Out
+	switch {
+	case dump.OutputOptions.Archive == "-" || dump.OutputOptions.Out == "-":
+		return ""
+	case dump.OutputOptions.Archive != "":
+		path = filepath.Dir(dump.OutputOptions.Archive)
+	case path == "":
+		path = "dump"
+	}
+
+	// the output directory may not have been created yet
+	for {
+		if _, err := os.Stat(util.ToUniversalPath(path)); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
+
+// estimateDumpSize estimates the size of the dump from the data size that
+// collStats reports for each collection, scaled by --diskSpaceMultiplier.
+// Views and the oplog are not counted, since their size is not known ahead,
+// nor are users, roles and other special collections.
+func (dump *MongoDump) estimateDumpSize() (int64, error) {
+	session, err := dump.SessionProvider.GetSession()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, intent := range dump.manager.Intents() {
+		if intent.IsOplog() || intent.IsView() || intent.IsSpecialCollection() {
+			continue
+		}
+		var stats struct {
+			Size int64 `bson:"size"`
+		}
+		collStats := bson.D{{Key: "collStats", Value: intent.C}}
+		err = session.Database(intent.DB).RunCommand(context.Background(), collStats).Decode(&stats)
+		if err != nil {
+			return 0, fmt.Errorf("error getting the size of %v: %v", intent.Namespace(), err)
+		}
+		total += stats.Size
+	}
+	return int64(float64(total) * dump.OutputOptions.DiskSpaceMultiplier), nil
+}
+
+// checkDiskSpace checks that the volume holding path has room for the
+// estimated size of the dump while keeping --minFreeSpace free.
+func (dump *MongoDump) checkDiskSpace(path string) error {
+	estimate, err := dump.estimateDumpSize()
+	if err != nil {
+		return fmt.Errorf("error estimating the size of the dump: %v", err)
+	}
+	free, err := util.FreeSpace(path)
+	if err != nil {
+		return fmt.Errorf("error checking free space on the volume holding %v: %v", path, err)
+	}
+	if uint64(estimate+dump.minFreeSpace) > free {
+		return fmt.Errorf("not enough free space on the volume holding %v: the dump needs an estimated %v and "+
+			"--minFreeSpace keeps %v free, but only %v is available",
+			path, text.FormatByteAmount(estimate), text.FormatByteAmount(dump.minFreeSpace), text.FormatByteAmount(int64(free)))
+	}
+	log.Logvf(log.Info, "the dump needs an estimated %v, and %v is available on the volume holding %v",
+		text.FormatByteAmount(estimate), text.FormatByteAmount(int64(free)), path)
+	return nil
+}
+
+// monitorDiskSpace checks the free space on the volume holding path while the
+// dump runs, and shuts the dump down if it falls below --minFreeSpace. It
+// returns a function that stops monitoring and returns the error the dump
+// was shut down with, if any.
+func (dump *MongoDump) monitorDiskSpace(path string) (stop func() error) {
+	quit := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		ticker := time.NewTicker(diskSpaceCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-quit:
+				done <- nil
+				return
+			case <-ticker.C:
+			}
+			free, err := util.FreeSpace(path)
+			if err != nil {
+				log.Logvf(log.DebugLow, "error checking free space on the volume holding %v: %v", path, err)
+				continue
+			}
+			if free < uint64(dump.minFreeSpace) {
+				err = fmt.Errorf("aborted the dump: free space on the volume holding %v fell to %v, below --minFreeSpace %v",
+					path, text.FormatByteAmount(int64(free)), text.FormatByteAmount(dump.minFreeSpace))
+				log.Logvf(log.Always, "%v", err)
+				dump.shutdownIntentsNotifier.Notify()
+				done <- err
+				return
+			}
+		}
+	}()
+	return func() error {
+		close(quit)
+		return <-done
+	}
+}
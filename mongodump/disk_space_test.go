@@ -0,0 +1,46 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOutputVolumePath(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With an output directory", t, func() {
+		dir, err := ioutil.TempDir("", "mongodump_disk_space")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		md := simpleMongoDumpInstance()
+
+		Convey("free space is checked on the nearest directory that exists", func() {
+			md.OutputOptions.Out = filepath.Join(dir, "not", "created", "yet")
+			So(md.outputVolumePath(), ShouldEqual, dir)
+		})
+
+		Convey("free space is checked next to an archive file", func() {
+			md.OutputOptions.Out = ""
+			md.OutputOptions.Archive = filepath.Join(dir, "dump.archive")
+			So(md.outputVolumePath(), ShouldEqual, dir)
+		})
+
+		Convey("free space is not checked when writing to standard output", func() {
+			md.OutputOptions.Out = ""
+			md.OutputOptions.Archive = "-"
+			So(md.outputVolumePath(), ShouldEqual, "")
+		})
+	})
+}
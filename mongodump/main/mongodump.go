@@ -8,11 +8,18 @@
 package main
 
 import (
+	"errors"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/mongodb/mongo-tools/common/completion"
+	"github.com/mongodb/mongo-tools/common/exitcode"
+	"github.com/mongodb/mongo-tools/common/healthcheck"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/runmanifest"
 	"github.com/mongodb/mongo-tools/common/signals"
 	"github.com/mongodb/mongo-tools/common/util"
 	"github.com/mongodb/mongo-tools/mongodump"
@@ -34,7 +41,7 @@ func main() {
 	if err != nil {
 		log.Logvf(log.Always, "error parsing command line options: %s", err.Error())
 		log.Logvf(log.Always, util.ShortUsage("mongodump"))
-		os.Exit(util.ExitFailure)
+		os.Exit(util.ExitValidationFailure)
 	}
 
 	// print help, if specified
@@ -47,21 +54,72 @@ func main() {
 		return
 	}
 
+	// print the effective config, if specified
+	if opts.PrintEffectiveConfig() {
+		return
+	}
+
+	// generate shell completions, if requested
+	if _, ok := opts.CompletionArgs(); ok {
+		os.Exit(completion.Main(opts.ToolOptions))
+	}
+
+	// check the connection, credentials and privileges without running
+	if opts.HealthCheck {
+		os.Exit(healthcheck.Main(*opts.ToolOptions, opts.HealthCheckRequirements()))
+	}
+
 	// init logger
 	log.SetVerbosity(opts.Verbosity)
 
 	// verify uri options and log them
 	opts.URI.LogUnsupportedOptions()
 
+	if opts.CompareTo != "" {
+		os.Exit(compare(opts))
+	}
+
 	// kick off the progress bar manager
 	progressManager := progress.NewBarWriter(log.Writer(0), progressBarWaitTime, progressBarLength, false)
 	progressManager.Start()
 	defer progressManager.Stop()
 
+	if opts.Every > 0 {
+		os.Exit(schedule(opts, progressManager))
+	}
+
+	if err = dumpOnce(opts, progressManager); err != nil {
+		log.Logvf(log.Always, "Failed: %v", err)
+		os.Exit(exitcode.Of(err))
+	}
+}
+
+// errInitFailed wraps errors initializing a dump, such as invalid options,
+// which end a schedule if the first dump fails with them.
+type errInitFailed struct{ error }
+
+func (err errInitFailed) Unwrap() error { return err.error }
+
+// dumpOnce runs a single dump with opts, recording it in the run manifest.
+func dumpOnce(opts mongodump.Options, progressManager *progress.BarWriter) error {
+	run, err := runmanifest.Begin(opts.RunManifest, "mongodump", util.SanitizeURI(opts.URI.ConnectionString), map[string]interface{}{
+		"namespace": opts.Namespace,
+		"input":     opts.InputOptions,
+		"output":    opts.OutputOptions,
+	})
+	if err == runmanifest.ErrAlreadyApplied {
+		log.Logvf(log.Always, "%v", err)
+		return nil
+	}
+	if err != nil {
+		return errInitFailed{err}
+	}
+
 	dump := mongodump.MongoDump{
 		ToolOptions:     opts.ToolOptions,
 		OutputOptions:   opts.OutputOptions,
 		InputOptions:    opts.InputOptions,
+		CompareOptions:  opts.CompareOptions,
 		ProgressManager: progressManager,
 	}
 
@@ -69,12 +127,112 @@ func main() {
 	defer close(finishedChan)
 
 	if err = dump.Init(); err != nil {
-		log.Logvf(log.Always, "Failed: %v", err)
-		os.Exit(util.ExitFailure)
+		run.Abandon()
+		return errInitFailed{err}
+	}
+
+	err = dump.Dump()
+	if reportErr := dump.WriteReport(err); reportErr != nil {
+		if err != nil {
+			log.Logvf(log.Always, "%v", reportErr)
+		} else {
+			err = reportErr
+		}
+	}
+	if checkpointErr := dump.WriteCheckpoint(err); checkpointErr != nil {
+		if err != nil {
+			log.Logvf(log.Always, "%v", checkpointErr)
+		} else {
+			err = checkpointErr
+		}
+	}
+	if finishErr := run.Finish(err); finishErr != nil {
+		log.Logvf(log.Always, "error recording run: %v", finishErr)
+	}
+	return err
+}
+
+// schedule runs a dump at every --every interval until interrupted, each to
+// its own timestamped output, and prunes the oldest outputs beyond --retain.
+// A dump that fails is logged and its output removed, and the next one is
+// still taken, unless the first one cannot even start. It returns the exit code.
+func schedule(opts mongodump.Options, progressManager *progress.BarWriter) int {
+	// signals received during a dump interrupt it through its own handler;
+	// this channel also ends the schedule, whether a dump is running or not
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(sigChan)
+
+	baseOutput := opts.OutputOptions
+	next := time.Now()
+	for first := true; ; first = false {
+		scheduled := opts
+		scheduled.OutputOptions = mongodump.ScheduledOutputOptions(baseOutput, next)
+		log.Logvf(log.Always, "starting scheduled dump to %v", scheduledOutput(scheduled.OutputOptions))
+		err := dumpOnce(scheduled, progressManager)
+		var initErr errInitFailed
+		switch {
+		case first && errors.As(err, &initErr):
+			log.Logvf(log.Always, "Failed: %v", initErr.error)
+			return exitcode.Of(initErr.error)
+		case err != nil:
+			log.Logvf(log.Always, "scheduled dump to %v failed: %v", scheduledOutput(scheduled.OutputOptions), err)
+			if err = mongodump.RemoveScheduledDump(scheduled.OutputOptions); err != nil {
+				log.Logvf(log.Always, "%v", err)
+			}
+		case opts.Retain > 0:
+			if _, err = mongodump.PruneScheduledDumps(baseOutput, opts.Retain); err != nil {
+				log.Logvf(log.Always, "%v", err)
+			}
+		}
+		if signals.Interrupted() {
+			return util.ExitAborted
+		}
+
+		// skip the intervals missed by a dump that took longer than one
+		next = next.Add(opts.Every)
+		for !next.After(time.Now()) {
+			next = next.Add(opts.Every)
+		}
+		log.Logvf(log.Always, "next scheduled dump at %v", next.Format(time.RFC3339))
+		select {
+		case <-time.After(time.Until(next)):
+		case sig := <-sigChan:
+			log.Logvf(log.Always, "signal '%s' received; stopping scheduled dumps", sig)
+			return util.ExitSuccess
+		}
+	}
+}
+
+// scheduledOutput returns the directory or archive a scheduled dump writes.
+func scheduledOutput(opts *mongodump.OutputOptions) string {
+	if opts.Archive != "" {
+		return opts.Archive
 	}
+	return opts.Out
+}
 
-	if err = dump.Dump(); err != nil {
+// compare compares the selected namespaces with the deployment at
+// --compareTo instead of dumping them, and returns the exit code.
+func compare(opts mongodump.Options) int {
+	dump := mongodump.MongoDump{
+		ToolOptions:     opts.ToolOptions,
+		OutputOptions:   opts.OutputOptions,
+		InputOptions:    opts.InputOptions,
+		CompareOptions:  opts.CompareOptions,
+		ProgressManager: progress.NewBarWriter(log.Writer(0), progressBarWaitTime, progressBarLength, false),
+	}
+
+	finishedChan := signals.HandleWithInterrupt(dump.HandleInterrupt)
+	defer close(finishedChan)
+
+	err := dump.Init()
+	if err == nil {
+		err = dump.Compare()
+	}
+	if err != nil {
 		log.Logvf(log.Always, "Failed: %v", err)
-		os.Exit(util.ExitFailure)
+		return exitcode.Of(err)
 	}
+	return util.ExitSuccess
 }
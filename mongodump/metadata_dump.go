@@ -19,10 +19,18 @@ import (
 
 // Metadata holds information about a collection's options and indexes.
 type Metadata struct {
-	Options        bson.M   `bson:"options,omitempty"`
-	Indexes        []bson.D `bson:"indexes"`
-	UUID           string   `bson:"uuid,omitempty"`
-	CollectionName string   `bson:"collectionName"`
+	Options        bson.M             `bson:"options,omitempty"`
+	Indexes        []bson.D           `bson:"indexes"`
+	UUID           string             `bson:"uuid,omitempty"`
+	CollectionName string             `bson:"collectionName"`
+	ShardKey       *ShardKey          `bson:"shardKey,omitempty"`
+	Chunks         *ChunkDistribution `bson:"chunks,omitempty"`
+	Zones          []ZoneRange        `bson:"zones,omitempty"`
+	// Projection is the --excludeFields projection the documents were
+	// dumped with, if any.
+	Projection bson.D `bson:"projection,omitempty"`
+	// Stats is the storage statistics snapshot recorded with --collectStats.
+	Stats *StorageStats `bson:"stats,omitempty"`
 }
 
 // IndexDocumentFromDB is used internally to preserve key ordering.
@@ -53,6 +61,10 @@ func (dump *MongoDump) dumpMetadata(intent *intents.Intent, buffer resettableOut
 	// bson or metadata file name, in which case the collection name can be found here.
 	meta.CollectionName = intent.C
 
+	// Record the fields left out of the dumped documents, so that it is clear
+	// that they are not complete.
+	meta.Projection = dump.projectionFor(intent)
+
 	// Second, we read the collection's index information by either calling
 	// listIndexes (pre-2.7 systems) or querying system.indexes.
 	// We keep a running list of all the indexes
@@ -95,6 +107,20 @@ func (dump *MongoDump) dumpMetadata(intent *intents.Intent, buffer resettableOut
 		}
 	}
 
+	if (dump.OutputOptions.DumpShardKeys || dump.OutputOptions.DumpChunkDistribution) && !intent.IsView() {
+		err = dump.addShardingMetadata(session, intent.Namespace(), &meta)
+		if err != nil {
+			return fmt.Errorf("error reading sharding metadata for collection `%v`: %v", intent.Namespace(), err)
+		}
+	}
+
+	if dump.OutputOptions.CollectStats && !dump.OutputOptions.ViewsAsCollections && !intent.IsView() {
+		err = dump.collectStats(session, intent, &meta)
+		if err != nil {
+			return fmt.Errorf("error reading storage statistics for collection `%v`: %v", intent.Namespace(), err)
+		}
+	}
+
 	// Finally, we send the results to the writer as JSON bytes
 	jsonBytes, err := bson.MarshalExtJSON(meta, true, false)
 	if err != nil {
@@ -13,11 +13,13 @@ import (
 	"github.com/mongodb/mongo-tools/common/archive"
 	"github.com/mongodb/mongo-tools/common/auth"
 	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/exitcode"
 	"github.com/mongodb/mongo-tools/common/failpoint"
 	"github.com/mongodb/mongo-tools/common/intents"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/text"
 	"github.com/mongodb/mongo-tools/common/util"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -44,6 +46,18 @@ const (
 
 const defaultPermissions = 0755
 
+// readPreferenceProbeTimeout bounds how long mongodump waits for a server
+// matching each read preference in the fallback chain.
+const readPreferenceProbeTimeout = 5 * time.Second
+
+// Settings of --lowImpact, which limit the load a dump puts on the server.
+const (
+	lowImpactReadPreference         = "secondaryPreferred"
+	lowImpactBatchSize              = 1000
+	lowImpactSleepBetweenBatches    = 100 * time.Millisecond
+	lowImpactNumParallelCollections = 1
+)
+
 // MongoDump is a container for the user-specified options and
 // internal state used for running mongodump.
 type MongoDump struct {
@@ -51,6 +65,9 @@ type MongoDump struct {
 	ToolOptions   *options.ToolOptions
 	InputOptions  *InputOptions
 	OutputOptions *OutputOptions
+	// CompareOptions, if set with a --compareTo, make Compare compare the
+	// selected namespaces with another deployment.
+	CompareOptions *CompareOptions
 
 	// Skip dumping users and roles, regardless of namespace, when true.
 	SkipUsersAndRoles bool
@@ -61,6 +78,7 @@ type MongoDump struct {
 	SessionProvider *db.SessionProvider
 	manager         *intents.Manager
 	query           bson.D
+	projection      bson.D
 	oplogCollection string
 	oplogStart      primitive.Timestamp
 	oplogEnd        primitive.Timestamp
@@ -76,6 +94,19 @@ type MongoDump struct {
 	// This is initialized to os.Stdout if unset.
 	OutputWriter io.Writer
 
+	// per-namespace results written to the run report
+	report *dumpReport
+
+	// namespaces dumped completely, written to the checkpoint for --resume
+	progress *dumpProgress
+
+	// free space to keep on the output volume, set with --minFreeSpace
+	minFreeSpace int64
+
+	// dbStats of each database, recorded in the metadata with --collectStats
+	dbStats     map[string]*DatabaseStats
+	dbStatsLock sync.Mutex
+
 	// XXX Unused?!?
 	// readPrefMode mgo.Mode
 	// readPrefTags []bson.D
@@ -123,8 +154,44 @@ func (dump *MongoDump) ValidateOptions() error {
 		return fmt.Errorf("--out not allowed when --archive is specified")
 	case dump.OutputOptions.Out == "-" && dump.OutputOptions.Gzip:
 		return fmt.Errorf("compression can't be used when dumping a single collection to standard output")
+	case dump.OutputOptions.SupportBundle && (dump.OutputOptions.Archive != "" || dump.OutputOptions.Out == "-"):
+		return fmt.Errorf("--supportBundle requires dumping to a directory")
+	case dump.OutputOptions.Resume && (dump.OutputOptions.Archive != "" || dump.OutputOptions.Out == "-"):
+		return fmt.Errorf("--resume requires dumping to a directory")
+	case dump.OutputOptions.Resume && dump.OutputOptions.Oplog:
+		return fmt.Errorf("--resume cannot be used with --oplog, since a resumed dump is not a point-in-time snapshot")
+	case dump.OutputOptions.Every < 0:
+		return fmt.Errorf("--every must be positive")
+	case dump.OutputOptions.Every > 0 && (dump.OutputOptions.Archive == "-" || dump.OutputOptions.Out == "-"):
+		return fmt.Errorf("--every requires dumping to a directory or an archive file")
+	case dump.OutputOptions.Every > 0 && dump.OutputOptions.Resume:
+		return fmt.Errorf("--every cannot be used with --resume")
+	case dump.OutputOptions.Every > 0 && dump.comparing():
+		return fmt.Errorf("--every cannot be used with --compareTo")
+	case dump.OutputOptions.Retain < 0:
+		return fmt.Errorf("--retain must not be negative")
+	case dump.OutputOptions.Retain > 0 && dump.OutputOptions.Every == 0:
+		return fmt.Errorf("--retain requires --every")
 	case dump.OutputOptions.NumParallelCollections <= 0:
 		return fmt.Errorf("numParallelCollections must be positive")
+	case dump.InputOptions.SleepBetweenBatches < 0:
+		return fmt.Errorf("--sleepBetweenBatches must not be negative")
+	case dump.OutputOptions.CheckDiskSpace && dump.OutputOptions.DiskSpaceMultiplier <= 0:
+		return fmt.Errorf("--diskSpaceMultiplier must be positive")
+	}
+
+	if dump.comparing() {
+		if err := dump.validateCompareOptions(); err != nil {
+			return err
+		}
+	}
+
+	if dump.OutputOptions.CheckDiskSpace {
+		minFreeSpace, err := text.ParseByteAmount(dump.OutputOptions.MinFreeSpace)
+		if err != nil {
+			return fmt.Errorf("invalid --minFreeSpace: %v", err)
+		}
+		dump.minFreeSpace = minFreeSpace
 	}
 	return nil
 }
@@ -139,21 +206,31 @@ func (dump *MongoDump) Init() error {
 
 	err := dump.ValidateOptions()
 	if err != nil {
-		return fmt.Errorf("bad option: %v", err)
+		return exitcode.Validation(fmt.Errorf("bad option: %v", err))
 	}
 	if dump.OutputWriter == nil {
 		dump.OutputWriter = os.Stdout
 	}
+	if dump.InputOptions.LowImpact {
+		dump.applyLowImpact()
+	}
 
 	pref, err := db.NewReadPreference(dump.InputOptions.ReadPreference, dump.ToolOptions.URI.ParsedConnString())
 	if err != nil {
-		return fmt.Errorf("error parsing --readPreference : %v", err)
+		return exitcode.Validation(fmt.Errorf("error parsing --readPreference : %v", err))
 	}
 	dump.ToolOptions.ReadPreference = pref
 
 	dump.SessionProvider, err = db.NewSessionProvider(*dump.ToolOptions)
 	if err != nil {
-		return fmt.Errorf("can't create session: %v", err)
+		return fmt.Errorf("can't create session: %w", err)
+	}
+
+	if len(dump.InputOptions.ReadPreferenceFallback) > 0 {
+		pref, err = dump.selectReadPreference(pref)
+		if err != nil {
+			return err
+		}
 	}
 
 	dump.isMongos, err = dump.SessionProvider.IsMongos()
@@ -165,16 +242,86 @@ func (dump *MongoDump) Init() error {
 		return fmt.Errorf("can't use --oplog option when dumping from a mongos")
 	}
 
+	if !dump.isMongos && dump.OutputOptions.DumpShardKeys {
+		return fmt.Errorf("can only use --dumpShardKeys when dumping from a mongos")
+	}
+
+	if !dump.isMongos && dump.OutputOptions.DumpChunkDistribution {
+		return fmt.Errorf("can only use --dumpChunkDistribution when dumping from a mongos")
+	}
+
 	// warn if we are trying to dump from a secondary in a sharded cluster
 	if dump.isMongos && pref != readpref.Primary() {
 		log.Logvf(log.Always, db.WarningNonPrimaryMongosConnection)
 	}
 
 	dump.manager = intents.NewIntentManager()
+	dump.report = newDumpReport()
+	dump.progress = newDumpProgress()
 
 	return nil
 }
 
+// applyLowImpact fills in the settings of --lowImpact that are not given
+// explicitly, including the number of collections dumped in parallel. The
+// batch size is set on each query by DumpIntent.
+func (dump *MongoDump) applyLowImpact() {
+	cs := dump.ToolOptions.URI.ParsedConnString()
+	if dump.InputOptions.ReadPreference == "" && (cs == nil || cs.ReadPreference == "") {
+		dump.InputOptions.ReadPreference = lowImpactReadPreference
+	}
+	if dump.InputOptions.SleepBetweenBatches == 0 {
+		dump.InputOptions.SleepBetweenBatches = lowImpactSleepBetweenBatches
+	}
+	if !dump.OutputOptions.numParallelCollectionsGiven {
+		dump.OutputOptions.NumParallelCollections = lowImpactNumParallelCollections
+	}
+	log.Logvf(log.Info, "dumping with low impact: read preference %v, batches of %v documents %v apart, %v collection at a time",
+		dump.InputOptions.ReadPreference, lowImpactBatchSize, dump.InputOptions.SleepBetweenBatches,
+		dump.OutputOptions.NumParallelCollections)
+}
+
+// selectReadPreference walks the --readPreference fallback chain and returns
+// the first read preference for which a server can be selected. If it differs
+// from the preferred one, the session provider is recreated to use it.
+func (dump *MongoDump) selectReadPreference(preferred *readpref.ReadPref) (*readpref.ReadPref, error) {
+	candidates := []*readpref.ReadPref{preferred}
+	for _, rp := range dump.InputOptions.ReadPreferenceFallback {
+		pref, err := db.NewReadPreference(rp, nil)
+		if err != nil {
+			return nil, exitcode.Validation(fmt.Errorf("error parsing --readPreferenceFallback '%v': %w", rp, err))
+		}
+		candidates = append(candidates, pref)
+	}
+
+	timeout := readPreferenceProbeTimeout
+	if dump.ToolOptions.ServerSelectionTimeout > 0 {
+		timeout = time.Duration(dump.ToolOptions.ServerSelectionTimeout) * time.Second
+	}
+
+	var err error
+	for i, pref := range candidates {
+		err = dump.SessionProvider.CanSelectServer(pref, timeout)
+		if err != nil {
+			log.Logvf(log.Info, "no server available for read preference %v: %v", pref, err)
+			continue
+		}
+		if i == 0 {
+			return pref, nil
+		}
+
+		log.Logvf(log.Always, "falling back to read preference %v", pref)
+		dump.SessionProvider.Close()
+		dump.ToolOptions.ReadPreference = pref
+		dump.SessionProvider, err = db.NewSessionProvider(*dump.ToolOptions)
+		if err != nil {
+			return nil, fmt.Errorf("can't create session: %w", err)
+		}
+		return pref, nil
+	}
+	return nil, fmt.Errorf("no server available for --readPreference or any --readPreferenceFallback: %w", err)
+}
+
 func (dump *MongoDump) verifyCollectionExists() (bool, error) {
 	// Running MongoDump against a DB with no collection specified works. In this case, return true so the process
 	// can continue.
@@ -191,6 +338,46 @@ func (dump *MongoDump) verifyCollectionExists() (bool, error) {
 	return collInfo != nil, nil
 }
 
+// parseQueryAndProjection sets the filter and projection that documents are
+// read with from --query or --queryFile and --excludeFields.
+func (dump *MongoDump) parseQueryAndProjection() error {
+	if dump.InputOptions.HasQuery() {
+		content, err := dump.InputOptions.GetQuery()
+		if err != nil {
+			return err
+		}
+		var query bson.D
+		err = bson.UnmarshalExtJSON(content, false, &query)
+		if err != nil {
+			return fmt.Errorf("error parsing query as Extended JSON: %v", err)
+		}
+		dump.query = query
+	}
+
+	if dump.InputOptions.ExcludeFields != "" {
+		projection, err := excludedFieldsProjection(dump.InputOptions.ExcludeFields)
+		if err != nil {
+			return err
+		}
+		dump.projection = projection
+	}
+	return nil
+}
+
+// createNamespaceIntents creates an intent for each collection selected by
+// --db and --collection.
+func (dump *MongoDump) createNamespaceIntents() error {
+	switch {
+	case dump.ToolOptions.DB == "" && dump.ToolOptions.Collection == "":
+		return dump.CreateAllIntents()
+	case dump.ToolOptions.DB != "" && dump.ToolOptions.Collection == "":
+		return dump.CreateIntentsForDatabase(dump.ToolOptions.DB)
+	case dump.ToolOptions.DB != "" && dump.ToolOptions.Collection != "":
+		return dump.CreateCollectionIntent(dump.ToolOptions.DB, dump.ToolOptions.Collection)
+	}
+	return nil
+}
+
 // Dump handles some final options checking and executes MongoDump.
 func (dump *MongoDump) Dump() (err error) {
 	defer dump.SessionProvider.Close()
@@ -209,17 +396,8 @@ func (dump *MongoDump) Dump() (err error) {
 
 	dump.shutdownIntentsNotifier = newNotifier()
 
-	if dump.InputOptions.HasQuery() {
-		content, err := dump.InputOptions.GetQuery()
-		if err != nil {
-			return err
-		}
-		var query bson.D
-		err = bson.UnmarshalExtJSON(content, false, &query)
-		if err != nil {
-			return fmt.Errorf("error parsing query as Extended JSON: %v", err)
-		}
-		dump.query = query
+	if err = dump.parseQueryAndProjection(); err != nil {
+		return err
 	}
 
 	if !dump.SkipUsersAndRoles && dump.OutputOptions.DumpDBUsersAndRoles {
@@ -280,18 +458,16 @@ func (dump *MongoDump) Dump() (err error) {
 		return fmt.Errorf("error connecting to host: %v", err)
 	}
 
-	// switch on what kind of execution to do
-	switch {
-	case dump.ToolOptions.DB == "" && dump.ToolOptions.Collection == "":
-		err = dump.CreateAllIntents()
-	case dump.ToolOptions.DB != "" && dump.ToolOptions.Collection == "":
-		err = dump.CreateIntentsForDatabase(dump.ToolOptions.DB)
-	case dump.ToolOptions.DB != "" && dump.ToolOptions.Collection != "":
-		err = dump.CreateCollectionIntent(dump.ToolOptions.DB, dump.ToolOptions.Collection)
+	if dump.OutputOptions.Resume {
+		if err = dump.loadCheckpoint(); err != nil {
+			return err
+		}
 	}
-	if err != nil {
+
+	if err = dump.createNamespaceIntents(); err != nil {
 		return fmt.Errorf("error creating intents to dump: %v", err)
 	}
+	dump.progress.expect(dump.manager.Intents())
 
 	if dump.OutputOptions.Oplog {
 		err = dump.CreateOplogIntents()
@@ -307,6 +483,29 @@ func (dump *MongoDump) Dump() (err error) {
 		}
 	}
 
+	if dump.OutputOptions.CheckDiskSpace {
+		volume := dump.outputVolumePath()
+		if volume == "" {
+			log.Logvf(log.Always, "not checking disk space, since the dump is written to standard output")
+		} else {
+			if err = dump.checkDiskSpace(volume); err != nil {
+				return err
+			}
+			stopMonitor := dump.monitorDiskSpace(volume)
+			defer func() {
+				if lowSpaceErr := stopMonitor(); lowSpaceErr != nil {
+					err = lowSpaceErr
+				}
+			}()
+		}
+	}
+
+	if dump.OutputOptions.SupportBundle {
+		if err = dump.DumpDiagnostics(); err != nil {
+			return fmt.Errorf("error dumping diagnostics: %v", err)
+		}
+	}
+
 	// IO Phase I
 	// metadata, users, roles, and versions
 
@@ -322,6 +521,7 @@ func (dump *MongoDump) Dump() (err error) {
 		serverVersion, err := dump.SessionProvider.ServerVersion()
 		if err != nil {
 			log.Logvf(log.Always, "warning, couldn't get version information from server: %v", err)
+			dump.report.warn("", "couldn't get version information from server: %v", err)
 			serverVersion = "unknown"
 		}
 		dump.archive.Prelude, err = archive.NewPrelude(dump.manager, dump.OutputOptions.NumParallelCollections, serverVersion, dump.ToolOptions.VersionStr)
@@ -501,18 +701,22 @@ func (dump *MongoDump) DumpIntents() error {
 					}
 				}
 				dump.manager.Finish(intent)
+				dump.progress.complete(intent.Namespace())
 			}
 		}(i)
 	}
 
-	// wait until all goroutines are done or one of them errors out
+	// wait until all goroutines are done, stopping the others once one of
+	// them errors out so that their files are closed before returning
+	var firstErr error
 	for i := 0; i < jobs; i++ {
-		if err := <-resultChan; err != nil {
-			return err
+		if err := <-resultChan; err != nil && firstErr == nil {
+			firstErr = err
+			dump.shutdownIntentsNotifier.Notify()
 		}
 	}
 
-	return nil
+	return firstErr
 }
 
 // DumpIntent dumps the specified database's collection.
@@ -552,12 +756,21 @@ func (dump *MongoDump) DumpIntent(intent *intents.Intent, buffer resettableOutpu
 			log.Logvf(log.Always,
 				"failed to determine storage engine, an mmapv1 storage engine could result in"+
 					" inconsistent dump results, error was: %v", err)
+			dump.report.warn("", "failed to determine storage engine: %v", err)
 		} else if isMMAPV1 {
 			dump.storageEngine = storageEngineMMAPV1
 		}
 	}
 
 	findQuery := &db.DeferredQuery{Coll: coll}
+	if dump.InputOptions.LowImpact {
+		findQuery.BatchSize = lowImpactBatchSize
+	}
+	// a cursor left idle between batches must not time out
+	findQuery.NoCursorTimeout = dump.InputOptions.SleepBetweenBatches > 0
+	if projection := dump.projectionFor(intent); projection != nil {
+		findQuery.Projection = projection
+	}
 	switch {
 	case len(dump.query) > 0:
 		findQuery.Filter = dump.query
@@ -629,6 +842,12 @@ func (dump *MongoDump) getCount(query *db.DeferredQuery, intent *intents.Intent)
 func (dump *MongoDump) dumpValidatedQueryToIntent(
 	query *db.DeferredQuery, intent *intents.Intent, buffer resettableOutputBuffer, validator documentValidator) (dumpCount int64, err error) {
 
+	start := time.Now()
+	counter := &countingWriter{}
+	defer func() {
+		dump.report.recordNamespace(intent.Namespace(), dumpCount, counter.n, time.Since(start))
+	}()
+
 	// restore of views from archives require an empty collection as the trigger to create the view
 	// so, we open here before the early return if IsView so that we write an empty collection to the archive
 	err = intent.BSONFile.Open()
@@ -670,14 +889,40 @@ func (dump *MongoDump) dumpValidatedQueryToIntent(
 		}()
 	}
 
-	cursor, err := query.Iter()
-	if err != nil {
-		return
+	counter.Writer = f
+	writer := &lastIDWriter{Writer: counter}
+	// the oplog must be read as quickly as possible so that it does not roll
+	// over before the dump finishes
+	sleep := dump.InputOptions.SleepBetweenBatches
+	if intent.IsOplog() {
+		sleep = 0
+	}
+	// a cursor that fails is replaced by running the query again and
+	// resuming after the last document dumped
+	for restarts := 0; ; restarts++ {
+		var cursor *mongo.Cursor
+		if cursor, err = query.Iter(); err != nil {
+			return
+		}
+		if writer.written {
+			if err = skipThrough(cursor, writer.lastID); err != nil {
+				cursor.Close(context.Background())
+				break
+			}
+		}
+		err = dump.dumpValidatedIterToWriter(cursor, writer, dumpProgressor, validator, sleep)
+		if err == nil || restarts == maxCursorRestarts || !isRestartableCursorError(err) || !writer.canResume() {
+			break
+		}
+		log.Logvf(log.Always, "restarting the query on %v after its cursor failed: %v", intent.Namespace(), err)
+		dump.report.restartCursor(intent.Namespace())
 	}
-	err = dump.dumpValidatedIterToWriter(cursor, f, dumpProgressor, validator)
 	dumpCount, _ = dumpProgressor.Progress()
 	if err != nil {
 		err = fmt.Errorf("error writing data for collection `%v` to disk: %v", intent.Namespace(), err)
+	} else if total > 0 && dumpCount != total {
+		dump.report.warn(intent.Namespace(), "collection count was %v before dumping but %v %v were dumped",
+			total, dumpCount, docPlural(dumpCount))
 	}
 	return
 }
@@ -686,13 +931,13 @@ func (dump *MongoDump) dumpValidatedQueryToIntent(
 // a counter, and dumps the iterator's contents to the writer.
 func (dump *MongoDump) dumpIterToWriter(
 	iter *mongo.Cursor, writer io.Writer, progressCount progress.Updateable) error {
-	return dump.dumpValidatedIterToWriter(iter, writer, progressCount, nil)
+	return dump.dumpValidatedIterToWriter(iter, writer, progressCount, nil, dump.InputOptions.SleepBetweenBatches)
 }
 
 // dumpValidatedIterToWriter takes a cursor, a writer, an Updateable object, and a documentValidator and validates and
-// dumps the iterator's contents to the writer.
+// dumps the iterator's contents to the writer, pausing for sleep before fetching each further batch.
 func (dump *MongoDump) dumpValidatedIterToWriter(
-	iter *mongo.Cursor, writer io.Writer, progressCount progress.Updateable, validator documentValidator) error {
+	iter *mongo.Cursor, writer io.Writer, progressCount progress.Updateable, validator documentValidator, sleep time.Duration) error {
 	defer iter.Close(context.Background())
 	var termErr error
 
@@ -701,34 +946,51 @@ func (dump *MongoDump) dumpValidatedIterToWriter(
 	// which gives a slight speedup on benchmarks
 	buffChan := make(chan []byte)
 	go func() {
+		defer close(buffChan)
 		ctx := context.Background()
+		// send validates the current document and passes it to the writer
+		send := func() bool {
+			if validator != nil {
+				if err := validator(iter.Current); err != nil {
+					termErr = err
+					return false
+				}
+			}
+			out := make([]byte, len(iter.Current))
+			copy(out, iter.Current)
+			buffChan <- out
+			return true
+		}
 		for {
+			// pause before the next document requires fetching another batch
+			if sleep > 0 && iter.RemainingBatchLength() == 0 && iter.ID() != 0 {
+				select {
+				case <-dump.shutdownIntentsNotifier.notified:
+				case <-time.After(sleep):
+				}
+			}
 			select {
 			case <-dump.shutdownIntentsNotifier.notified:
-				log.Logvf(log.DebugHigh, "terminating writes")
+				// finish writing the batch already received from the server
+				// rather than dropping it
+				log.Logvf(log.DebugHigh, "terminating writes after the current batch")
+				for iter.RemainingBatchLength() > 0 && iter.Next(ctx) {
+					if !send() {
+						return
+					}
+				}
 				termErr = util.ErrTerminated
-				close(buffChan)
 				return
 			default:
 				if !iter.Next(ctx) {
 					if err := iter.Err(); err != nil {
 						termErr = err
 					}
-					close(buffChan)
 					return
 				}
-
-				if validator != nil {
-					if err := validator(iter.Current); err != nil {
-						termErr = err
-						close(buffChan)
-						return
-					}
+				if !send() {
+					return
 				}
-
-				out := make([]byte, len(iter.Current))
-				copy(out, iter.Current)
-				buffChan <- out
 			}
 		}
 	}()
@@ -739,7 +1001,7 @@ func (dump *MongoDump) dumpValidatedIterToWriter(
 		buff, alive := <-buffChan
 		if !alive {
 			if iter.Err() != nil {
-				return fmt.Errorf("error reading collection: %v", iter.Err())
+				return fmt.Errorf("error reading collection: %w", iter.Err())
 			}
 			break
 		}
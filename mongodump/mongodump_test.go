@@ -514,6 +514,72 @@ func TestMongoDumpValidateOptions(t *testing.T) {
 			So(err.Error(), ShouldContainSubstring, "cannot dump using a query without a specified collection")
 		})
 
+		Convey("we cannot write a support bundle to an archive", func() {
+			md.OutputOptions.Out = ""
+			md.OutputOptions.Archive = "dump.archive"
+			md.OutputOptions.SupportBundle = true
+
+			err := md.Init()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--supportBundle requires dumping to a directory")
+		})
+
+		Convey("we need a valid amount of free space to keep when checking disk space", func() {
+			md.OutputOptions.CheckDiskSpace = true
+			md.OutputOptions.DiskSpaceMultiplier = 1
+			md.OutputOptions.MinFreeSpace = "lots"
+
+			err := md.Init()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "invalid --minFreeSpace")
+		})
+
+		Convey("we cannot resume a dump that captures the oplog", func() {
+			md.ToolOptions.Namespace.DB = ""
+			md.ToolOptions.Namespace.Collection = ""
+			md.OutputOptions.Oplog = true
+			md.OutputOptions.Resume = true
+
+			err := md.Init()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--resume cannot be used with --oplog")
+		})
+
+		Convey("we cannot sleep for a negative duration between batches", func() {
+			md.InputOptions.SleepBetweenBatches = -time.Second
+
+			err := md.Init()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--sleepBetweenBatches must not be negative")
+		})
+
+	})
+}
+
+func TestMongoDumpLowImpact(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a low impact MongoDump instance", t, func() {
+		md := simpleMongoDumpInstance()
+		md.InputOptions.LowImpact = true
+		md.OutputOptions.NumParallelCollections = 4
+
+		Convey("settings that are not given are filled in", func() {
+			md.applyLowImpact()
+			So(md.InputOptions.ReadPreference, ShouldEqual, "secondaryPreferred")
+			So(md.InputOptions.SleepBetweenBatches, ShouldEqual, 100*time.Millisecond)
+			So(md.OutputOptions.NumParallelCollections, ShouldEqual, 1)
+		})
+
+		Convey("settings that are given are kept", func() {
+			md.InputOptions.ReadPreference = "nearest"
+			md.InputOptions.SleepBetweenBatches = time.Second
+			md.OutputOptions.numParallelCollectionsGiven = true
+			md.applyLowImpact()
+			So(md.InputOptions.ReadPreference, ShouldEqual, "nearest")
+			So(md.InputOptions.SleepBetweenBatches, ShouldEqual, time.Second)
+			So(md.OutputOptions.NumParallelCollections, ShouldEqual, 4)
+		})
 	})
 }
 
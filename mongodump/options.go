@@ -9,8 +9,11 @@ package mongodump
 import (
 	"fmt"
 	"io/ioutil"
+	"time"
 
+	"github.com/mongodb/mongo-tools/common/healthcheck"
 	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/runmanifest"
 )
 
 var Usage = `<options> <connection-string>
@@ -25,10 +28,15 @@ See http://docs.mongodb.com/database-tools/mongodump/ for more information.`
 
 // InputOptions defines the set of options to use in retrieving data from the server.
 type InputOptions struct {
-	Query          string `long:"query" short:"q" description:"query filter, as a v2 Extended JSON string, e.g., '{\"x\":{\"$gt\":1}}'"`
-	QueryFile      string `long:"queryFile" description:"path to a file containing a query filter (v2 Extended JSON)"`
-	ReadPreference string `long:"readPreference" value-name:"<string>|<json>" description:"specify either a preference mode (e.g. 'nearest') or a preference json object (e.g. '{mode: \"nearest\", tagSets: [{a: \"b\"}], maxStalenessSeconds: 123}')"`
-	TableScan      bool   `long:"forceTableScan" description:"force a table scan (do not use $snapshot or hint _id). Deprecated since this is default behavior on WiredTiger"`
+	Query                  string   `long:"query" short:"q" description:"query filter, as a v2 Extended JSON string, e.g., '{\"x\":{\"$gt\":1}}'"`
+	QueryFile              string   `long:"queryFile" description:"path to a file containing a query filter (v2 Extended JSON)"`
+	ReadPreference         string   `long:"readPreference" value-name:"<string>|<json>" description:"specify either a preference mode (e.g. 'nearest'), a preference json object (e.g. '{mode: \"nearest\", tagSets: [{a: \"b\"}], maxStalenessSeconds: 123}'), or a mode followed by json fields (e.g. 'secondary, tagSets: [{backup: \"true\"}]')"`
+	ReadPreferenceFallback []string `long:"readPreferenceFallback" value-name:"<string>|<json>" description:"read preference to fall back to if no server matches --readPreference, in the same format (may be specified multiple times; each is tried in order)"`
+	ExcludeFields          string   `long:"excludeFields" value-name:"<field>[,<field>]*" description:"comma-separated list of fields to leave out of dumped documents, e.g. 'bigBlob,debugTrace', using a projection on the server; the projection is recorded in each collection's metadata"`
+	TableScan              bool     `long:"forceTableScan" description:"force a table scan (do not use $snapshot or hint _id). Deprecated since this is default behavior on WiredTiger"`
+
+	LowImpact           bool          `long:"lowImpact" description:"dump gently enough to run on a busy cluster: read from a secondary where possible ('secondaryPreferred', unless --readPreference or the connection string sets one), fetch collections in batches of 1000 documents, sleep between batches (100ms, unless --sleepBetweenBatches is given) other than those of the oplog, and dump one collection at a time (unless --numParallelCollections is given)"`
+	SleepBetweenBatches time.Duration `long:"sleepBetweenBatches" value-name:"<duration>" description:"pause for the given duration, e.g. 50ms, before fetching each further batch of documents from the server, to limit the load of the dump; cursors are kept open while paused"`
 }
 
 // Name returns a human-readable group name for input options.
@@ -64,6 +72,22 @@ type OutputOptions struct {
 	ExcludedCollectionPrefixes []string `long:"excludeCollectionsWithPrefix" value-name:"<collection-prefix>" description:"exclude all collections from the dump that have the given prefix (may be specified multiple times to exclude additional prefixes)"`
 	NumParallelCollections     int      `long:"numParallelCollections" short:"j" description:"number of collections to dump in parallel" default:"4" default-mask:"-"`
 	ViewsAsCollections         bool     `long:"viewsAsCollections" description:"dump views as normal collections with their produced data, omitting standard collections"`
+	Report                     string   `long:"report" value-name:"<file-path>" description:"path to write a JSON report of the documents and bytes dumped, and of the cursors restarted after failing, per namespace (default: 'dump-report.json' in the output directory; not written for archives or stdout unless specified)"`
+	DumpShardKeys              bool     `long:"dumpShardKeys" description:"record the shard key of each sharded collection in its metadata file, so that mongorestore --createShardedCollections can shard it the same way (requires a mongos)"`
+	DumpChunkDistribution      bool     `long:"dumpChunkDistribution" description:"record the chunk ranges and owning shards, and the zone ranges and the shards in each zone, of each sharded collection in its metadata file, so that mongorestore --preSplitChunks can recreate them (requires a mongos)"`
+	CheckDiskSpace             bool     `long:"checkDiskSpace" description:"before dumping, check that the output volume has room for the estimated size of the dump, and abort the dump if its free space falls below --minFreeSpace while dumping"`
+	DiskSpaceMultiplier        float64  `long:"diskSpaceMultiplier" value-name:"<factor>" default:"1" default-mask:"-" description:"factor applied to the data size that collStats reports for each collection to estimate the size of the dump with --checkDiskSpace, e.g. 0.3 for compressible data dumped with --gzip (defaults to 1)"`
+	MinFreeSpace               string   `long:"minFreeSpace" value-name:"<size>" default:"100MB" default-mask:"-" description:"free space to keep on the output volume with --checkDiskSpace, e.g. 1GB (defaults to 100MB)"`
+	CollectStats               bool     `long:"collectStats" description:"record a snapshot of the dbStats and collStats of each collection (document count, data, storage and index sizes, and storage engine options) in its metadata file, for planning the capacity of a restore target"`
+	SupportBundle              bool     `long:"supportBundle" description:"also write profiling data, a currentOp snapshot, serverStatus, replSetGetStatus and buildInfo output to a 'diagnostics' folder of the dump, for support escalations"`
+	Resume                     bool     `long:"resume" description:"finish a dump that was interrupted or failed, dumping only the namespaces that the 'dump-checkpoint.json' file in the output directory does not list as completed"`
+
+	Every  time.Duration `long:"every" value-name:"<duration>" description:"keep running and start a dump at the given interval, e.g. 6h, each to a timestamped subdirectory of --out or a timestamped archive alongside the --archive path, e.g. 'app-20201019T083000Z.archive' for --archive=app.archive"`
+	Retain int           `long:"retain" value-name:"<count>" description:"with --every, remove the oldest timestamped dumps after each dump, keeping the given number of the newest (0 keeps every dump)"`
+
+	// whether --numParallelCollections was given rather than left at its
+	// default, which --lowImpact lowers
+	numParallelCollectionsGiven bool
 }
 
 // Name returns a human-readable group name for output options.
@@ -71,10 +95,26 @@ func (*OutputOptions) Name() string {
 	return "output"
 }
 
+// CompareOptions defines the options for comparing the namespaces selected
+// for a dump with those of another deployment, instead of dumping them.
+type CompareOptions struct {
+	CompareTo         string `long:"compareTo" value-name:"<connection-string>" description:"instead of dumping, compare the selected namespaces with those of the deployment at this connection string, such as one restored from a dump, and report the document counts, indexes and documents that differ"`
+	CompareDocuments  string `long:"compareDocuments" value-name:"<mode>" choice:"none" choice:"sample" choice:"full" default:"sample" default-mask:"-" description:"how to compare documents with --compareTo: 'sample' looks up a random sample of source documents in the target, 'full' compares every document in ranges of _id, 'none' only compares counts and indexes (defaults to 'sample')"`
+	CompareSampleSize int    `long:"compareSampleSize" value-name:"<count>" default:"1000" default-mask:"-" description:"number of documents of each collection to compare with --compareDocuments=sample (defaults to 1000)"`
+	CompareRangeSize  int    `long:"compareRangeSize" value-name:"<count>" default:"10000" default-mask:"-" description:"approximate number of documents in each _id range compared with --compareDocuments=full; up to --numParallelCollections ranges are compared at once (defaults to 10000)"`
+}
+
+// Name returns a human-readable group name for compare options.
+func (*CompareOptions) Name() string {
+	return "compare"
+}
+
 type Options struct {
 	*options.ToolOptions
 	*InputOptions
 	*OutputOptions
+	*CompareOptions
+	RunManifest *runmanifest.Options
 }
 
 func ParseOptions(rawArgs []string, versionStr, gitCommit string) (Options, error) {
@@ -84,11 +124,18 @@ func ParseOptions(rawArgs []string, versionStr, gitCommit string) (Options, erro
 	opts.AddOptions(inputOpts)
 	outputOpts := &OutputOptions{}
 	opts.AddOptions(outputOpts)
+	compareOpts := &CompareOptions{}
+	opts.AddOptions(compareOpts)
+	runManifestOpts := &runmanifest.Options{}
+	opts.AddOptions(runManifestOpts)
 
 	extraArgs, err := opts.ParseArgs(rawArgs)
 	if err != nil {
 		return Options{}, err
 	}
+	// --lowImpact only lowers -j if it is left at its default
+	jobs := opts.FindOptionByLongName("numParallelCollections")
+	outputOpts.numParallelCollectionsGiven = jobs.IsSet() && !jobs.IsSetDefault()
 
 	if len(extraArgs) > 0 {
 		return Options{}, fmt.Errorf("error parsing positional arguments: " +
@@ -97,5 +144,38 @@ func ParseOptions(rawArgs []string, versionStr, gitCommit string) (Options, erro
 		)
 	}
 
-	return Options{opts, inputOpts, outputOpts}, nil
+	return Options{opts, inputOpts, outputOpts, compareOpts, runManifestOpts}, nil
+}
+
+// HealthCheckRequirements returns the privileges needed to dump with opts,
+// which are checked by --healthCheck.
+func (opts Options) HealthCheckRequirements() []healthcheck.Requirement {
+	ns := opts.ToolOptions.Namespace
+	requirements := []healthcheck.Requirement{{
+		Resource: healthcheck.Resource{DB: ns.DB, Collection: ns.Collection},
+		Actions:  []string{"find"},
+		Purpose:  "read the collections to dump",
+	}}
+	if ns.DB == "" {
+		requirements = append(requirements, healthcheck.Requirement{
+			Resource: healthcheck.Resource{Cluster: true},
+			Actions:  []string{"listDatabases"},
+			Purpose:  "list the databases to dump",
+		})
+	}
+	if ns.Collection == "" {
+		requirements = append(requirements, healthcheck.Requirement{
+			Resource: healthcheck.Resource{DB: ns.DB},
+			Actions:  []string{"listCollections", "listIndexes"},
+			Purpose:  "list the collections and indexes to dump",
+		})
+	}
+	if opts.OutputOptions.Oplog {
+		requirements = append(requirements, healthcheck.Requirement{
+			Resource: healthcheck.Resource{DB: "local", Collection: "oplog.rs"},
+			Actions:  []string{"find"},
+			Purpose:  "read the oplog for --oplog",
+		})
+	}
+	return requirements
 }
@@ -132,3 +132,18 @@ func TestPositionalArgumentParsing(t *testing.T) {
 		}
 	})
 }
+
+func TestNumParallelCollectionsGiven(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+	Convey("--numParallelCollections should only count as given when it is on the command line", t, func() {
+		opts, err := ParseOptions([]string{"--lowImpact"}, "", "")
+		So(err, ShouldBeNil)
+		So(opts.OutputOptions.NumParallelCollections, ShouldEqual, 4)
+		So(opts.OutputOptions.numParallelCollectionsGiven, ShouldBeFalse)
+
+		opts, err = ParseOptions([]string{"--lowImpact", "-j", "8"}, "", "")
+		So(err, ShouldBeNil)
+		So(opts.OutputOptions.NumParallelCollections, ShouldEqual, 8)
+		So(opts.OutputOptions.numParallelCollectionsGiven, ShouldBeTrue)
+	})
+}
@@ -89,6 +89,12 @@ func (f *realBSONFile) Open() (err error) {
 	return nil
 }
 
+// Close syncs the BSON file to disk before closing it, so that the files of
+// namespaces recorded as completed in a checkpoint survive a crash.
+func (f *realBSONFile) Close() error {
+	return syncAndClose(f.WriteCloser)
+}
+
 // realMetadataFile implements intent.file, and corresponds to a Metadata file on disk
 type realMetadataFile struct {
 	io.WriteCloser
@@ -118,6 +124,22 @@ func (f *realMetadataFile) Open() (err error) {
 	return nil
 }
 
+// Close syncs the metadata file to disk before closing it.
+func (f *realMetadataFile) Close() error {
+	return syncAndClose(f.WriteCloser)
+}
+
+// syncAndClose flushes w to disk, if it is a file, and closes it.
+func syncAndClose(w io.WriteCloser) error {
+	if file, ok := w.(*os.File); ok {
+		if err := file.Sync(); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	return w.Close()
+}
+
 // stdoutFile implements the intents.file interface. stdoutFiles are used when single collections
 // are written directly (non-archive-mode) to standard out, via "--dir -"
 type stdoutFile struct {
@@ -274,6 +296,10 @@ func (dump *MongoDump) CreateCollectionIntent(dbName, colName string) error {
 		log.Logvf(log.DebugLow, "skipping dump of %v.%v, it is excluded", dbName, colName)
 		return nil
 	}
+	if dump.progress.isComplete(dbName + "." + colName) {
+		log.Logvf(log.Always, "skipping dump of %v.%v, it was completed before the dump was resumed", dbName, colName)
+		return nil
+	}
 
 	session, err := dump.SessionProvider.GetSession()
 	if err != nil {
@@ -402,6 +428,10 @@ func (dump *MongoDump) CreateIntentsForDatabase(dbName string) error {
 			log.Logvf(log.DebugLow, "skipping dump of %v.%v because it is not a view", dbName, collInfo.Name)
 			continue
 		}
+		if dump.progress.isComplete(dbName + "." + collInfo.Name) {
+			log.Logvf(log.Always, "skipping dump of %v.%v, it was completed before the dump was resumed", dbName, collInfo.Name)
+			continue
+		}
 		intent, err := dump.NewIntentFromOptions(dbName, collInfo)
 		if err != nil {
 			return err
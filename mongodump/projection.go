@@ -0,0 +1,49 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/intents"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// excludedFieldsProjection returns the projection that leaves out each of the
+// comma-separated fields given to --excludeFields.
+func excludedFieldsProjection(fields string) (bson.D, error) {
+	var projection bson.D
+	seen := map[string]bool{}
+	for _, field := range strings.Split(fields, ",") {
+		field = strings.TrimSpace(field)
+		switch {
+		case field == "":
+			return nil, fmt.Errorf("invalid --excludeFields '%v': field names cannot be empty", fields)
+		case field == "_id" || strings.HasPrefix(field, "_id."):
+			return nil, fmt.Errorf("invalid --excludeFields '%v': _id cannot be excluded, since it is needed to restore the documents", fields)
+		case strings.HasPrefix(field, "$"):
+			return nil, fmt.Errorf("invalid --excludeFields '%v': field names cannot start with '$'", fields)
+		case seen[field]:
+			continue
+		}
+		seen[field] = true
+		projection = append(projection, bson.E{Key: field, Value: 0})
+	}
+	return projection, nil
+}
+
+// projectionFor returns the projection applied to the documents dumped for
+// intent, or nil if they are dumped whole. Only regular collections and
+// views are projected; the oplog and special collections, such as users and
+// roles, are always dumped whole.
+func (dump *MongoDump) projectionFor(intent *intents.Intent) bson.D {
+	if len(dump.projection) == 0 || intent.IsOplog() || intent.IsSpecialCollection() {
+		return nil
+	}
+	return dump.projection
+}
@@ -0,0 +1,58 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestExcludedFieldsProjection(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With --excludeFields", t, func() {
+		Convey("each listed field is projected out once", func() {
+			projection, err := excludedFieldsProjection("bigBlob, debugTrace,a.b,bigBlob")
+			So(err, ShouldBeNil)
+			So(projection, ShouldResemble, bson.D{
+				{Key: "bigBlob", Value: 0},
+				{Key: "debugTrace", Value: 0},
+				{Key: "a.b", Value: 0},
+			})
+		})
+
+		Convey("empty field names are rejected", func() {
+			_, err := excludedFieldsProjection("bigBlob,,debugTrace")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("_id cannot be excluded", func() {
+			_, err := excludedFieldsProjection("bigBlob,_id")
+			So(err, ShouldNotBeNil)
+			_, err = excludedFieldsProjection("_id.x")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("field names starting with '$' are rejected", func() {
+			_, err := excludedFieldsProjection("$where")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("only regular collections are projected", func() {
+			md := simpleMongoDumpInstance()
+			md.projection = bson.D{{Key: "bigBlob", Value: 0}}
+
+			So(md.projectionFor(&intents.Intent{DB: "db", C: "c"}), ShouldResemble, md.projection)
+			So(md.projectionFor(&intents.Intent{DB: "local", C: "oplog.rs"}), ShouldBeNil)
+			So(md.projectionFor(&intents.Intent{DB: "admin", C: "system.users"}), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,214 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/log"
+)
+
+// ReportFileName is the name of the report written to the root of a dump
+// directory.
+const ReportFileName = "dump-report.json"
+
+// NamespaceReport describes the data dumped for a single namespace.
+type NamespaceReport struct {
+	Namespace string        `json:"namespace"`
+	Documents int64         `json:"documents"`
+	Bytes     int64         `json:"bytes"`
+	Duration  time.Duration `json:"-"`
+	// CursorRestarts counts how many times the query was run again after
+	// its cursor failed.
+	CursorRestarts int      `json:"cursorRestarts"`
+	Warnings       []string `json:"warnings,omitempty"`
+}
+
+// MarshalJSON reports the duration in seconds.
+func (r NamespaceReport) MarshalJSON() ([]byte, error) {
+	type namespaceReport NamespaceReport
+	return json.Marshal(struct {
+		namespaceReport
+		DurationSeconds float64 `json:"durationSeconds"`
+	}{namespaceReport(r), r.Duration.Seconds()})
+}
+
+// dumpReport collects a NamespaceReport for each dumped namespace, along with
+// warnings that do not belong to any single namespace. It is safe for
+// concurrent use, and its methods do nothing on a nil report.
+type dumpReport struct {
+	mu          sync.Mutex
+	started     time.Time
+	byNamespace map[string]*NamespaceReport
+	warnings    []string
+}
+
+func newDumpReport() *dumpReport {
+	return &dumpReport{
+		started:     time.Now(),
+		byNamespace: make(map[string]*NamespaceReport),
+	}
+}
+
+// recordNamespace adds the outcome of dumping ns.
+func (r *dumpReport) recordNamespace(ns string, documents, size int64, d time.Duration) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	report := r.namespace(ns)
+	report.Documents += documents
+	report.Bytes += size
+	report.Duration += d
+}
+
+// restartCursor records that the query on ns was run again after its cursor
+// failed.
+func (r *dumpReport) restartCursor(ns string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.namespace(ns).CursorRestarts++
+}
+
+// warn records a warning against ns, or against the whole dump if ns is empty.
+func (r *dumpReport) warn(ns string, format string, args ...interface{}) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	warning := fmt.Sprintf(format, args...)
+	if ns == "" {
+		r.warnings = append(r.warnings, warning)
+		return
+	}
+	report := r.namespace(ns)
+	report.Warnings = append(report.Warnings, warning)
+}
+
+func (r *dumpReport) namespace(ns string) *NamespaceReport {
+	report, ok := r.byNamespace[ns]
+	if !ok {
+		report = &NamespaceReport{Namespace: ns}
+		r.byNamespace[ns] = report
+	}
+	return report
+}
+
+// write encodes the report as JSON, recording dumpErr as the outcome.
+func (r *dumpReport) write(w io.Writer, toolVersion string, dumpErr error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	namespaces := make([]NamespaceReport, 0, len(r.byNamespace))
+	for _, report := range r.byNamespace {
+		namespaces = append(namespaces, *report)
+	}
+	sort.Slice(namespaces, func(i, j int) bool {
+		return namespaces[i].Namespace < namespaces[j].Namespace
+	})
+
+	finished := time.Now()
+	out := struct {
+		ToolVersion     string            `json:"toolVersion,omitempty"`
+		StartTime       time.Time         `json:"startTime"`
+		EndTime         time.Time         `json:"endTime"`
+		DurationSeconds float64           `json:"durationSeconds"`
+		Success         bool              `json:"success"`
+		Error           string            `json:"error,omitempty"`
+		Namespaces      []NamespaceReport `json:"namespaces"`
+		Warnings        []string          `json:"warnings,omitempty"`
+	}{
+		ToolVersion:     toolVersion,
+		StartTime:       r.started,
+		EndTime:         finished,
+		DurationSeconds: finished.Sub(r.started).Seconds(),
+		Success:         dumpErr == nil,
+		Namespaces:      namespaces,
+		Warnings:        r.warnings,
+	}
+	if dumpErr != nil {
+		out.Error = dumpErr.Error()
+	}
+
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// reportPath returns where the run report should be written: the --report
+// path if given, or else the root of the dump directory. It returns an empty
+// string when dumping to an archive or to stdout without --report.
+func (dump *MongoDump) reportPath() string {
+	switch {
+	case dump.OutputOptions.Report != "":
+		return dump.OutputOptions.Report
+	case dump.OutputOptions.Archive != "" || dump.OutputOptions.Out == "-":
+		return ""
+	case dump.OutputOptions.Out == "":
+		return filepath.Join("dump", ReportFileName)
+	}
+	return filepath.Join(dump.OutputOptions.Out, ReportFileName)
+}
+
+// WriteReport writes a JSON report of the documents and bytes dumped for each
+// namespace, how long each took, and any warnings raised, along with dumpErr
+// as the outcome of the dump. It does nothing if there is nowhere to write the
+// report or if the dump was never initialized.
+func (dump *MongoDump) WriteReport(dumpErr error) error {
+	path := dump.reportPath()
+	if path == "" || dump.report == nil {
+		return nil
+	}
+
+	var toolVersion string
+	if dump.ToolOptions != nil {
+		toolVersion = dump.ToolOptions.VersionStr
+	}
+
+	buf := &bytes.Buffer{}
+	if err := dump.report.write(buf, toolVersion, dumpErr); err != nil {
+		return fmt.Errorf("error encoding dump report: %v", err)
+	}
+
+	log.Logvf(log.DebugLow, "writing dump report to %v", path)
+	if err := os.MkdirAll(filepath.Dir(path), defaultPermissions); err != nil {
+		return fmt.Errorf("error creating directory for dump report: %v", err)
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("error writing dump report: %v", err)
+	}
+	return nil
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,89 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDumpReport(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a MongoDump that has dumped two namespaces", t, func() {
+		dir, err := ioutil.TempDir("", "mongodump_report")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		md := simpleMongoDumpInstance()
+		md.OutputOptions.Out = dir
+		md.report = newDumpReport()
+		md.report.recordNamespace("db.b", 10, 4096, 2*time.Second)
+		md.report.recordNamespace("db.a", 5, 1024, time.Second)
+		md.report.restartCursor("db.b")
+		md.report.warn("db.a", "collection count was %v before dumping but %v documents were dumped", 6, 5)
+		md.report.warn("", "failed to determine storage engine")
+
+		var report struct {
+			Success    bool
+			Error      string
+			Namespaces []struct {
+				Namespace       string
+				Documents       int64
+				Bytes           int64
+				DurationSeconds float64
+				CursorRestarts  int
+				Warnings        []string
+			}
+			Warnings []string
+		}
+		readReport := func(path string) {
+			data, err := ioutil.ReadFile(path)
+			So(err, ShouldBeNil)
+			So(json.Unmarshal(data, &report), ShouldBeNil)
+		}
+
+		Convey("the report should be written to the dump directory", func() {
+			So(md.WriteReport(nil), ShouldBeNil)
+			readReport(filepath.Join(dir, ReportFileName))
+
+			So(report.Success, ShouldBeTrue)
+			So(len(report.Namespaces), ShouldEqual, 2)
+			So(report.Namespaces[0].Namespace, ShouldEqual, "db.a")
+			So(report.Namespaces[0].Documents, ShouldEqual, 5)
+			So(report.Namespaces[0].Warnings, ShouldHaveLength, 1)
+			So(report.Namespaces[1].Bytes, ShouldEqual, 4096)
+			So(report.Namespaces[1].DurationSeconds, ShouldEqual, 2)
+			So(report.Namespaces[0].CursorRestarts, ShouldEqual, 0)
+			So(report.Namespaces[1].CursorRestarts, ShouldEqual, 1)
+			So(report.Warnings, ShouldResemble, []string{"failed to determine storage engine"})
+		})
+
+		Convey("the report should record a failed dump", func() {
+			md.OutputOptions.Report = filepath.Join(dir, "report.json")
+			So(md.WriteReport(fmt.Errorf("oplog overflow")), ShouldBeNil)
+			readReport(md.OutputOptions.Report)
+
+			So(report.Success, ShouldBeFalse)
+			So(report.Error, ShouldEqual, "oplog overflow")
+		})
+
+		Convey("no report should be written for an archive unless requested", func() {
+			md.OutputOptions.Out = ""
+			md.OutputOptions.Archive = filepath.Join(dir, "dump.archive")
+			So(md.reportPath(), ShouldEqual, "")
+		})
+	})
+}
@@ -0,0 +1,79 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// maxCursorRestarts is how many times the query of a namespace is run
+	// again after its cursor fails.
+	maxCursorRestarts = 3
+
+	cursorNotFoundCode = 43
+)
+
+// isRestartableCursorError returns whether err is a failure of the cursor
+// itself, such as a lost connection or a cursor killed on the server, after
+// which the query may be run again.
+func isRestartableCursorError(err error) bool {
+	var cmdErr mongo.CommandError
+	if !errors.As(err, &cmdErr) {
+		return false
+	}
+	return cmdErr.Code == cursorNotFoundCode || db.IsTransientError(cmdErr)
+}
+
+// lastIDWriter records the _id of the last document written through it, so
+// that the dump of a namespace can be resumed after it.
+type lastIDWriter struct {
+	io.Writer
+	// lastID is the _id of the last document written, and has a zero Type if
+	// none was or if it had no _id.
+	lastID bson.RawValue
+	// written is whether any document has been written.
+	written bool
+}
+
+func (w *lastIDWriter) Write(doc []byte) (int, error) {
+	n, err := w.Writer.Write(doc)
+	if err == nil {
+		w.written = true
+		w.lastID, _ = bson.Raw(doc).LookupErr("_id")
+	}
+	return n, err
+}
+
+// canResume returns whether a restarted query can find where the previous
+// cursor left off.
+func (w *lastIDWriter) canResume() bool {
+	return !w.written || w.lastID.Type != 0
+}
+
+// skipThrough advances cursor past the document with the given _id, which
+// the previous cursor over the same query returned last. Queries run again
+// return documents in the same order, whether that is natural order or the
+// order of the _id index.
+func skipThrough(cursor *mongo.Cursor, id bson.RawValue) error {
+	for cursor.Next(context.Background()) {
+		if current, err := cursor.Current.LookupErr("_id"); err == nil && current.Equal(id) {
+			return nil
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("the last document dumped, with _id %v, is no longer there to resume after", id)
+}
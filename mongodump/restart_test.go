@@ -0,0 +1,55 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestCursorRestart(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Only failures of the cursor itself should restart the query", t, func() {
+		wrap := func(err error) error {
+			return fmt.Errorf("error reading collection: %w", err)
+		}
+		So(isRestartableCursorError(wrap(mongo.CommandError{Code: cursorNotFoundCode})), ShouldBeTrue)
+		So(isRestartableCursorError(wrap(mongo.CommandError{Labels: []string{"NetworkError"}})), ShouldBeTrue)
+		So(isRestartableCursorError(wrap(mongo.CommandError{Code: 189})), ShouldBeTrue)
+		So(isRestartableCursorError(wrap(mongo.CommandError{Code: 13})), ShouldBeFalse)
+		So(isRestartableCursorError(fmt.Errorf("error writing to file: disk full")), ShouldBeFalse)
+	})
+
+	Convey("The _id of the last document written should be recorded", t, func() {
+		w := &lastIDWriter{Writer: &bytes.Buffer{}}
+		So(w.canResume(), ShouldBeTrue)
+
+		for _, id := range []int32{1, 2} {
+			doc, err := bson.Marshal(bson.D{{"_id", id}, {"x", "y"}})
+			So(err, ShouldBeNil)
+			_, err = w.Write(doc)
+			So(err, ShouldBeNil)
+		}
+		So(w.lastID.Int32(), ShouldEqual, 2)
+		So(w.canResume(), ShouldBeTrue)
+
+		Convey("and a document without one should prevent resuming", func() {
+			doc, err := bson.Marshal(bson.D{{"ts", 1}})
+			So(err, ShouldBeNil)
+			_, err = w.Write(doc)
+			So(err, ShouldBeNil)
+			So(w.canResume(), ShouldBeFalse)
+		})
+	})
+}
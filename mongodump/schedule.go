@@ -0,0 +1,137 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/log"
+)
+
+// scheduledDumpTimeFormat is the UTC timestamp that names the output of each
+// dump taken with --every, which sorts in time order.
+const scheduledDumpTimeFormat = "20060102T150405Z"
+
+// defaultOutputDirectory is the directory dumped to without --out.
+const defaultOutputDirectory = "dump"
+
+// splitArchivePath splits an archive path into the part before and the part
+// after the timestamp of scheduled archives, which goes before the first
+// extension of the file name, e.g. "backups/app-" and ".archive.gz".
+func splitArchivePath(archive string) (prefix, suffix string) {
+	dir, name := filepath.Split(archive)
+	if i := strings.Index(name, "."); i > 0 {
+		return dir + name[:i] + "-", name[i:]
+	}
+	return dir + name + "-", ""
+}
+
+// ScheduledOutputOptions returns a copy of opts that dumps to the output of
+// the scheduled dump taken at t: a timestamped subdirectory of the --out
+// directory, or a timestamped archive alongside the --archive path.
+func ScheduledOutputOptions(opts *OutputOptions, t time.Time) *OutputOptions {
+	scheduled := *opts
+	timestamp := t.UTC().Format(scheduledDumpTimeFormat)
+	if opts.Archive != "" {
+		prefix, suffix := splitArchivePath(opts.Archive)
+		scheduled.Archive = prefix + timestamp + suffix
+		return &scheduled
+	}
+	out := opts.Out
+	if out == "" {
+		out = defaultOutputDirectory
+	}
+	scheduled.Out = filepath.Join(out, timestamp)
+	return &scheduled
+}
+
+// scheduledDumps returns the outputs of the scheduled dumps for opts that
+// exist, oldest first.
+func scheduledDumps(opts *OutputOptions) ([]string, error) {
+	var dir, prefix, suffix string
+	if opts.Archive != "" {
+		prefix, suffix = splitArchivePath(opts.Archive)
+		dir, prefix = filepath.Split(prefix)
+	} else {
+		dir = opts.Out
+		if dir == "" {
+			dir = defaultOutputDirectory
+		}
+	}
+	if dir == "" {
+		dir = "."
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var dumps []string
+	for _, entry := range entries {
+		name := entry.Name()
+		// the output must be a directory when dumping to one, and a file when
+		// dumping archives
+		if entry.IsDir() == (opts.Archive != "") {
+			continue
+		}
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) ||
+			len(name) < len(prefix)+len(suffix) {
+			continue
+		}
+		timestamp := name[len(prefix) : len(name)-len(suffix)]
+		if _, err := time.Parse(scheduledDumpTimeFormat, timestamp); err != nil {
+			continue
+		}
+		dumps = append(dumps, filepath.Join(dir, name))
+	}
+	// the timestamps sort in time order
+	sort.Strings(dumps)
+	return dumps, nil
+}
+
+// PruneScheduledDumps removes the oldest outputs of the scheduled dumps for
+// opts, keeping the given number of the newest. It returns the outputs
+// removed.
+func PruneScheduledDumps(opts *OutputOptions, retain int) ([]string, error) {
+	dumps, err := scheduledDumps(opts)
+	if err != nil {
+		return nil, fmt.Errorf("error listing previous dumps: %v", err)
+	}
+	if len(dumps) <= retain {
+		return nil, nil
+	}
+	removed := dumps[:len(dumps)-retain]
+	for _, path := range removed {
+		log.Logvf(log.Always, "removing dump %v to retain the newest %v", path, retain)
+		if err = os.RemoveAll(path); err != nil {
+			return nil, fmt.Errorf("error removing previous dump %v: %v", path, err)
+		}
+	}
+	return removed, nil
+}
+
+// RemoveScheduledDump removes the output of a scheduled dump that failed, so
+// that an incomplete dump is neither kept nor counted towards --retain.
+func RemoveScheduledDump(opts *OutputOptions) error {
+	path := opts.Out
+	if opts.Archive != "" {
+		path = opts.Archive
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return fmt.Errorf("error removing failed dump %v: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestScheduledDumps(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	at := time.Date(2020, 10, 19, 8, 30, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	Convey("Scheduled dumps are written to timestamped outputs", t, func() {
+		So(ScheduledOutputOptions(&OutputOptions{}, at).Out, ShouldEqual, filepath.Join("dump", "20201019T063000Z"))
+		So(ScheduledOutputOptions(&OutputOptions{Out: "backups"}, at).Out, ShouldEqual, filepath.Join("backups", "20201019T063000Z"))
+
+		scheduled := ScheduledOutputOptions(&OutputOptions{Archive: filepath.Join("backups", "app.archive.gz"), Gzip: true}, at)
+		So(scheduled.Archive, ShouldEqual, filepath.Join("backups", "app-20201019T063000Z.archive.gz"))
+		So(scheduled.Out, ShouldEqual, "")
+		So(scheduled.Gzip, ShouldBeTrue)
+		So(ScheduledOutputOptions(&OutputOptions{Archive: "app"}, at).Archive, ShouldEqual, "app-20201019T063000Z")
+	})
+
+	Convey("With previous scheduled dumps", t, func() {
+		dir, err := ioutil.TempDir("", "mongodump_schedule")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		Convey("the oldest dump directories beyond --retain are removed", func() {
+			for _, name := range []string{"20201019T000000Z", "20201019T060000Z", "20201019T120000Z", "manual"} {
+				So(os.MkdirAll(filepath.Join(dir, name, "db"), 0755), ShouldBeNil)
+			}
+			opts := &OutputOptions{Out: dir}
+			removed, err := PruneScheduledDumps(opts, 2)
+			So(err, ShouldBeNil)
+			So(removed, ShouldResemble, []string{filepath.Join(dir, "20201019T000000Z")})
+
+			dumps, err := scheduledDumps(opts)
+			So(err, ShouldBeNil)
+			So(dumps, ShouldResemble, []string{filepath.Join(dir, "20201019T060000Z"), filepath.Join(dir, "20201019T120000Z")})
+		})
+
+		Convey("the oldest archives beyond --retain are removed", func() {
+			for _, name := range []string{"app-20201019T000000Z.archive", "app-20201019T060000Z.archive", "app.archive", "other-20201019T000000Z.archive"} {
+				So(ioutil.WriteFile(filepath.Join(dir, name), nil, 0644), ShouldBeNil)
+			}
+			removed, err := PruneScheduledDumps(&OutputOptions{Archive: filepath.Join(dir, "app.archive")}, 1)
+			So(err, ShouldBeNil)
+			So(removed, ShouldResemble, []string{filepath.Join(dir, "app-20201019T000000Z.archive")})
+
+			entries, err := ioutil.ReadDir(dir)
+			So(err, ShouldBeNil)
+			So(entries, ShouldHaveLength, 3)
+		})
+
+		Convey("the output of a failed dump is removed", func() {
+			failed := ScheduledOutputOptions(&OutputOptions{Out: dir}, at)
+			So(os.MkdirAll(filepath.Join(failed.Out, "db"), 0755), ShouldBeNil)
+			So(RemoveScheduledDump(failed), ShouldBeNil)
+
+			dumps, err := scheduledDumps(&OutputOptions{Out: dir})
+			So(err, ShouldBeNil)
+			So(dumps, ShouldBeEmpty)
+		})
+
+		Convey("nothing is removed without a previous dump", func() {
+			removed, err := PruneScheduledDumps(&OutputOptions{Out: filepath.Join(dir, "missing")}, 1)
+			So(err, ShouldBeNil)
+			So(removed, ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,172 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"context"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ShardKey holds the shard key of a sharded collection, as recorded in
+// config.collections.
+type ShardKey struct {
+	Key    bson.D `bson:"key"`
+	Unique bool   `bson:"unique,omitempty"`
+}
+
+// ChunkRange is a chunk of a sharded collection and the shard that owns it.
+type ChunkRange struct {
+	Min   bson.D `bson:"min"`
+	Max   bson.D `bson:"max"`
+	Shard string `bson:"shard"`
+}
+
+// ShardChunks is the number of chunks of a collection owned by a shard.
+type ShardChunks struct {
+	Shard  string `bson:"shard"`
+	Chunks int    `bson:"chunks"`
+}
+
+// ChunkDistribution summarizes how the chunks of a sharded collection are
+// distributed across shards, and lists the chunk ranges in shard key order.
+type ChunkDistribution struct {
+	Count  int           `bson:"count"`
+	Shards []ShardChunks `bson:"shards"`
+	Ranges []ChunkRange  `bson:"ranges"`
+}
+
+// ZoneRange is a range of a sharded collection assigned to a zone, along
+// with the shards that are tagged with that zone.
+type ZoneRange struct {
+	Zone   string   `bson:"zone"`
+	Min    bson.D   `bson:"min"`
+	Max    bson.D   `bson:"max"`
+	Shards []string `bson:"shards"`
+}
+
+// configCollection holds the fields of a config.collections entry used by
+// mongodump. Chunks are keyed by the collection UUID since 5.0.
+type configCollection struct {
+	ShardKey `bson:",inline"`
+	UUID     *primitive.Binary `bson:"uuid,omitempty"`
+}
+
+// configTag holds a config.tags entry, which assigns a range to a zone.
+type configTag struct {
+	Tag string `bson:"tag"`
+	Min bson.D `bson:"min"`
+	Max bson.D `bson:"max"`
+}
+
+// configShard holds the fields of a config.shards entry used by mongodump.
+type configShard struct {
+	ID   string   `bson:"_id"`
+	Tags []string `bson:"tags"`
+}
+
+// addShardingMetadata adds the shard key and, if requested, the chunk and
+// zone distribution of the namespace to meta. Nothing is added if the
+// namespace is not sharded.
+func (dump *MongoDump) addShardingMetadata(session *mongo.Client, namespace string, meta *Metadata) error {
+	ctx := context.Background()
+	config := session.Database("config")
+
+	var coll configCollection
+	filter := bson.D{{Key: "_id", Value: namespace}, {Key: "dropped", Value: bson.M{"$ne": true}}}
+	err := config.Collection("collections").FindOne(ctx, filter).Decode(&coll)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if dump.OutputOptions.DumpShardKeys {
+		meta.ShardKey = &coll.ShardKey
+	}
+	if !dump.OutputOptions.DumpChunkDistribution {
+		return nil
+	}
+
+	chunkFilter := bson.D{{Key: "ns", Value: namespace}}
+	if coll.UUID != nil {
+		chunkFilter = bson.D{{Key: "$or", Value: bson.A{chunkFilter, bson.D{{Key: "uuid", Value: *coll.UUID}}}}}
+	}
+	byMin := options.Find().SetSort(bson.D{{Key: "min", Value: 1}})
+	cursor, err := config.Collection("chunks").Find(ctx, chunkFilter, byMin)
+	if err != nil {
+		return err
+	}
+	var chunks []ChunkRange
+	if err = cursor.All(ctx, &chunks); err != nil {
+		return err
+	}
+	meta.Chunks = summarizeChunks(chunks)
+
+	cursor, err = config.Collection("tags").Find(ctx, bson.D{{Key: "ns", Value: namespace}}, byMin)
+	if err != nil {
+		return err
+	}
+	var tags []configTag
+	if err = cursor.All(ctx, &tags); err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+
+	cursor, err = config.Collection("shards").Find(ctx, bson.D{{Key: "tags", Value: bson.M{"$exists": true}}})
+	if err != nil {
+		return err
+	}
+	var shards []configShard
+	if err = cursor.All(ctx, &shards); err != nil {
+		return err
+	}
+	meta.Zones = zoneRanges(tags, shards)
+	return nil
+}
+
+// summarizeChunks counts the chunks owned by each shard, in shard order.
+func summarizeChunks(chunks []ChunkRange) *ChunkDistribution {
+	counts := map[string]int{}
+	for _, chunk := range chunks {
+		counts[chunk.Shard]++
+	}
+	distribution := &ChunkDistribution{Count: len(chunks), Shards: []ShardChunks{}, Ranges: chunks}
+	if distribution.Ranges == nil {
+		distribution.Ranges = []ChunkRange{}
+	}
+	for shard, count := range counts {
+		distribution.Shards = append(distribution.Shards, ShardChunks{Shard: shard, Chunks: count})
+	}
+	sort.Slice(distribution.Shards, func(i, j int) bool {
+		return distribution.Shards[i].Shard < distribution.Shards[j].Shard
+	})
+	return distribution
+}
+
+// zoneRanges lists the shards tagged with the zone of each range.
+func zoneRanges(tags []configTag, shards []configShard) []ZoneRange {
+	zoneShards := map[string][]string{}
+	for _, shard := range shards {
+		for _, tag := range shard.Tags {
+			zoneShards[tag] = append(zoneShards[tag], shard.ID)
+		}
+	}
+	zones := make([]ZoneRange, 0, len(tags))
+	for _, tag := range tags {
+		inZone := append([]string{}, zoneShards[tag.Tag]...)
+		sort.Strings(inZone)
+		zones = append(zones, ZoneRange{Zone: tag.Tag, Min: tag.Min, Max: tag.Max, Shards: inZone})
+	}
+	return zones
+}
@@ -0,0 +1,61 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestShardingMetadata(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Chunks are counted per shard", t, func() {
+		chunks := []ChunkRange{
+			{Min: bson.D{{"x", primitive.MinKey{}}}, Max: bson.D{{"x", 0}}, Shard: "shard1"},
+			{Min: bson.D{{"x", 0}}, Max: bson.D{{"x", 100}}, Shard: "shard0"},
+			{Min: bson.D{{"x", 100}}, Max: bson.D{{"x", primitive.MaxKey{}}}, Shard: "shard1"},
+		}
+		distribution := summarizeChunks(chunks)
+		So(distribution.Count, ShouldEqual, 3)
+		So(distribution.Shards, ShouldResemble, []ShardChunks{
+			{Shard: "shard0", Chunks: 1},
+			{Shard: "shard1", Chunks: 2},
+		})
+		So(distribution.Ranges, ShouldResemble, chunks)
+
+		Convey("and a collection without chunks has empty lists", func() {
+			distribution := summarizeChunks(nil)
+			So(distribution.Count, ShouldEqual, 0)
+			So(distribution.Shards, ShouldBeEmpty)
+			So(distribution.Ranges, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Zone ranges list the shards in each zone", t, func() {
+		tags := []configTag{
+			{Tag: "EU", Min: bson.D{{"region", "eu"}}, Max: bson.D{{"region", "eu~"}}},
+			{Tag: "US", Min: bson.D{{"region", "us"}}, Max: bson.D{{"region", "us~"}}},
+			{Tag: "APAC", Min: bson.D{{"region", "ap"}}, Max: bson.D{{"region", "ap~"}}},
+		}
+		shards := []configShard{
+			{ID: "shard2", Tags: []string{"EU"}},
+			{ID: "shard0", Tags: []string{"US", "EU"}},
+		}
+		zones := zoneRanges(tags, shards)
+		So(zones, ShouldHaveLength, 3)
+		So(zones[0].Zone, ShouldEqual, "EU")
+		So(zones[0].Shards, ShouldResemble, []string{"shard0", "shard2"})
+		So(zones[1].Shards, ShouldResemble, []string{"shard0"})
+		So(zones[2].Shards, ShouldBeEmpty)
+		So(zones[2].Min, ShouldResemble, bson.D{{"region", "ap"}})
+	})
+}
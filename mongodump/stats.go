@@ -0,0 +1,98 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mongodb/mongo-tools/common/intents"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// StorageStats is the snapshot of storage statistics recorded with
+// --collectStats in the metadata of a collection, for planning the capacity
+// of a restore target. Sizes are in bytes.
+type StorageStats struct {
+	Database   *DatabaseStats   `bson:"database"`
+	Collection *CollectionStats `bson:"collection"`
+}
+
+// DatabaseStats holds the fields of dbStats recorded with --collectStats.
+type DatabaseStats struct {
+	Collections int64   `bson:"collections"`
+	Views       int64   `bson:"views"`
+	Objects     int64   `bson:"objects"`
+	AvgObjSize  float64 `bson:"avgObjSize"`
+	DataSize    int64   `bson:"dataSize"`
+	StorageSize int64   `bson:"storageSize"`
+	Indexes     int64   `bson:"indexes"`
+	IndexSize   int64   `bson:"indexSize"`
+	TotalSize   int64   `bson:"totalSize,omitempty"`
+	FsUsedSize  int64   `bson:"fsUsedSize,omitempty"`
+	FsTotalSize int64   `bson:"fsTotalSize,omitempty"`
+}
+
+// CollectionStats holds the fields of collStats recorded with --collectStats.
+type CollectionStats struct {
+	Count          int64   `bson:"count"`
+	Size           int64   `bson:"size"`
+	AvgObjSize     float64 `bson:"avgObjSize"`
+	StorageSize    int64   `bson:"storageSize"`
+	NIndexes       int64   `bson:"nindexes"`
+	TotalIndexSize int64   `bson:"totalIndexSize"`
+	IndexSizes     bson.D  `bson:"indexSizes"`
+	Capped         bool    `bson:"capped"`
+	Max            int64   `bson:"max,omitempty"`
+	MaxSize        int64   `bson:"maxSize,omitempty"`
+	// WiredTiger holds the storage engine options the collection was
+	// created with, if it uses WiredTiger.
+	WiredTiger *WiredTigerStats `bson:"wiredTiger,omitempty"`
+}
+
+// WiredTigerStats holds the fields of the wiredTiger section of collStats
+// recorded with --collectStats.
+type WiredTigerStats struct {
+	CreationString string `bson:"creationString"`
+}
+
+// databaseStats returns the dbStats of a database, running the command only
+// once per database for all of its collections.
+func (dump *MongoDump) databaseStats(session *mongo.Client, dbName string) (*DatabaseStats, error) {
+	dump.dbStatsLock.Lock()
+	defer dump.dbStatsLock.Unlock()
+	if stats, ok := dump.dbStats[dbName]; ok {
+		return stats, nil
+	}
+	stats := &DatabaseStats{}
+	err := session.Database(dbName).RunCommand(context.Background(), bson.D{{Key: "dbStats", Value: 1}}).Decode(stats)
+	if err != nil {
+		return nil, err
+	}
+	if dump.dbStats == nil {
+		dump.dbStats = make(map[string]*DatabaseStats)
+	}
+	dump.dbStats[dbName] = stats
+	return stats, nil
+}
+
+// collectStats adds the storage statistics of the intent's collection and
+// its database to meta.
+func (dump *MongoDump) collectStats(session *mongo.Client, intent *intents.Intent, meta *Metadata) error {
+	dbStats, err := dump.databaseStats(session, intent.DB)
+	if err != nil {
+		return fmt.Errorf("error running dbStats: %v", err)
+	}
+	collStats := &CollectionStats{}
+	err = session.Database(intent.DB).RunCommand(context.Background(), bson.D{{Key: "collStats", Value: intent.C}}).Decode(collStats)
+	if err != nil {
+		return fmt.Errorf("error running collStats: %v", err)
+	}
+	meta.Stats = &StorageStats{Database: dbStats, Collection: collStats}
+	return nil
+}
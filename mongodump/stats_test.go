@@ -0,0 +1,61 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongodump
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestStorageStats(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("collStats replies are decoded regardless of number types", t, func() {
+		reply, err := bson.Marshal(bson.D{
+			{Key: "ns", Value: "test.c"},
+			{Key: "size", Value: int32(4096)},
+			{Key: "count", Value: float64(32)},
+			{Key: "avgObjSize", Value: float64(128)},
+			{Key: "storageSize", Value: int64(20480)},
+			{Key: "capped", Value: false},
+			{Key: "wiredTiger", Value: bson.D{
+				{Key: "metadata", Value: bson.D{{Key: "formatVersion", Value: int32(1)}}},
+				{Key: "creationString", Value: "block_compressor=zstd"},
+			}},
+			{Key: "nindexes", Value: int32(1)},
+			{Key: "indexSizes", Value: bson.D{{Key: "_id_", Value: int32(36864)}}},
+			{Key: "totalIndexSize", Value: int32(36864)},
+			{Key: "ok", Value: float64(1)},
+		})
+		So(err, ShouldBeNil)
+		stats := &CollectionStats{}
+		So(bson.Unmarshal(reply, stats), ShouldBeNil)
+		So(stats.Count, ShouldEqual, 32)
+		So(stats.Size, ShouldEqual, 4096)
+		So(stats.StorageSize, ShouldEqual, 20480)
+		So(stats.TotalIndexSize, ShouldEqual, 36864)
+		So(stats.WiredTiger, ShouldResemble, &WiredTigerStats{CreationString: "block_compressor=zstd"})
+	})
+
+	Convey("Statistics are only written to metadata when collected", t, func() {
+		out, err := bson.MarshalExtJSON(Metadata{Indexes: []bson.D{}}, false, false)
+		So(err, ShouldBeNil)
+		So(string(out), ShouldNotContainSubstring, "stats")
+
+		meta := Metadata{
+			Indexes: []bson.D{},
+			Stats:   &StorageStats{Database: &DatabaseStats{Collections: 1}, Collection: &CollectionStats{Count: 3}},
+		}
+		out, err = bson.MarshalExtJSON(meta, false, false)
+		So(err, ShouldBeNil)
+		So(string(out), ShouldContainSubstring, `"stats":{"database":{"collections":1,`)
+		So(string(out), ShouldContainSubstring, `"collection":{"count":3,`)
+	})
+}
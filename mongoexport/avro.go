@@ -0,0 +1,466 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// number of documents the schema is inferred from, if --avroSchema is
+	// not given
+	avroInferenceSampleSize = 1000
+
+	// number of documents written in each block of an Avro container file
+	avroBlockSize = 1000
+)
+
+var avroMagic = []byte{'O', 'b', 'j', 1}
+
+// AvroExportOutput is an implementation of ExportOutput that writes documents
+// to an Avro object container file. Unless a schema is given, it is inferred
+// from the first documents, which are held until it is.
+type AvroExportOutput struct {
+	Out         io.Writer
+	NumExported int64
+
+	// name of the record inferred from the documents
+	name string
+
+	schema     *avroType
+	schemaJSON []byte
+	// whether the schema was inferred, in which case documents must not
+	// have fields it lacks
+	inferred bool
+
+	// documents held until the schema is inferred from them
+	pending []bson.D
+
+	headerWritten bool
+	sync          [16]byte
+	block         []byte
+	blockCount    int64
+}
+
+// NewAvroExportOutput returns an AvroExportOutput that writes documents to out
+// with the given schema and its JSON or, if schema is nil, with a schema
+// inferred from the first documents for a record named name.
+func NewAvroExportOutput(schema *avroType, schemaJSON []byte, name string, out io.Writer) *AvroExportOutput {
+	return &AvroExportOutput{
+		Out:        out,
+		name:       avroName(name),
+		schema:     schema,
+		schemaJSON: schemaJSON,
+		inferred:   schema == nil,
+	}
+}
+
+// WriteHeader is a no-op for Avro exports, whose header is written once the
+// schema is known.
+func (avroExporter *AvroExportOutput) WriteHeader() error {
+	return nil
+}
+
+// WriteFooter writes the documents not yet written, after the header if it
+// has not been written yet.
+func (avroExporter *AvroExportOutput) WriteFooter() error {
+	if err := avroExporter.writeHeader(); err != nil {
+		return err
+	}
+	return avroExporter.writeBlock()
+}
+
+// Flush is a no-op for Avro exports, whose blocks are written once they are
+// full.
+func (avroExporter *AvroExportOutput) Flush() error {
+	return nil
+}
+
+// ExportDocument encodes the document with the schema and adds it to the
+// current block, or holds it until the schema is inferred.
+func (avroExporter *AvroExportOutput) ExportDocument(document bson.D) error {
+	if avroExporter.schema == nil {
+		avroExporter.pending = append(avroExporter.pending, document)
+		if len(avroExporter.pending) < avroInferenceSampleSize {
+			return nil
+		}
+		return avroExporter.writeHeader()
+	}
+	return avroExporter.encode(document)
+}
+
+// writeHeader writes the header of the container file, first inferring the
+// schema from the documents held if needed, and then the documents held.
+func (avroExporter *AvroExportOutput) writeHeader() (err error) {
+	if avroExporter.headerWritten {
+		return nil
+	}
+	if avroExporter.schema == nil {
+		avroExporter.schema = inferAvroSchema(avroExporter.pending, avroExporter.name)
+		if avroExporter.schemaJSON, err = marshalAvroSchema(avroExporter.schema); err != nil {
+			return fmt.Errorf("error encoding Avro schema: %v", err)
+		}
+	}
+	// the sync marker only needs to be unlikely to appear in the data, so it
+	// is derived from the schema to keep the output deterministic
+	avroExporter.sync = md5.Sum(avroExporter.schemaJSON)
+
+	header := append([]byte{}, avroMagic...)
+	header = appendAvroLong(header, 2)
+	header = appendAvroBytes(header, []byte("avro.codec"))
+	header = appendAvroBytes(header, []byte("null"))
+	header = appendAvroBytes(header, []byte("avro.schema"))
+	header = appendAvroBytes(header, avroExporter.schemaJSON)
+	header = appendAvroLong(header, 0)
+	header = append(header, avroExporter.sync[:]...)
+	if _, err = avroExporter.Out.Write(header); err != nil {
+		return err
+	}
+	avroExporter.headerWritten = true
+
+	pending := avroExporter.pending
+	avroExporter.pending = nil
+	for _, document := range pending {
+		if err = avroExporter.encode(document); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encode adds the document to the current block, writing the block once it
+// is full.
+func (avroExporter *AvroExportOutput) encode(document bson.D) error {
+	out, err := appendAvroValue(avroExporter.block, avroExporter.schema, document, avroExporter.inferred)
+	if err != nil {
+		if avroExporter.inferred {
+			return fmt.Errorf("error encoding document #%v with the Avro schema inferred from the first %v documents "+
+				"(use --avroSchema to give a schema): %v", avroExporter.NumExported+1, avroInferenceSampleSize, err)
+		}
+		return fmt.Errorf("error encoding document #%v with the Avro schema: %v", avroExporter.NumExported+1, err)
+	}
+	avroExporter.block = out
+	avroExporter.blockCount++
+	avroExporter.NumExported++
+	if avroExporter.blockCount >= avroBlockSize {
+		return avroExporter.writeBlock()
+	}
+	return nil
+}
+
+// writeBlock writes the documents of the current block.
+func (avroExporter *AvroExportOutput) writeBlock() error {
+	if avroExporter.blockCount == 0 {
+		return nil
+	}
+	prefix := appendAvroLong(nil, avroExporter.blockCount)
+	prefix = appendAvroLong(prefix, int64(len(avroExporter.block)))
+	for _, b := range [][]byte{prefix, avroExporter.block, avroExporter.sync[:]} {
+		if _, err := avroExporter.Out.Write(b); err != nil {
+			return err
+		}
+	}
+	avroExporter.block = avroExporter.block[:0]
+	avroExporter.blockCount = 0
+	return nil
+}
+
+// avroInferringOutput is an ExportOutput for split Avro exports without
+// --avroSchema. It holds the first documents of the export until the schema
+// is inferred from them, and then passes them on to next, so that every part
+// is written with the same schema rather than inferring its own.
+type avroInferringOutput struct {
+	next ExportOutput
+	name string
+	// setSchema is called with the schema once it is inferred, before any
+	// document is passed on
+	setSchema func(schema *avroType, schemaJSON []byte)
+
+	pending  []bson.D
+	inferred bool
+}
+
+func (o *avroInferringOutput) WriteHeader() error {
+	return o.next.WriteHeader()
+}
+
+// ExportDocument passes the document on once the schema is inferred, or
+// else holds it.
+func (o *avroInferringOutput) ExportDocument(document bson.D) error {
+	if o.inferred {
+		return o.next.ExportDocument(document)
+	}
+	o.pending = append(o.pending, document)
+	if len(o.pending) < avroInferenceSampleSize {
+		return nil
+	}
+	return o.infer()
+}
+
+// WriteFooter infers the schema from the documents held, if it has not been
+// inferred yet, and passes them on before finishing the export.
+func (o *avroInferringOutput) WriteFooter() error {
+	if err := o.infer(); err != nil {
+		return err
+	}
+	return o.next.WriteFooter()
+}
+
+func (o *avroInferringOutput) Flush() error {
+	return o.next.Flush()
+}
+
+// infer infers the schema from the documents held and passes them on.
+func (o *avroInferringOutput) infer() error {
+	if o.inferred {
+		return nil
+	}
+	schema := inferAvroSchema(o.pending, o.name)
+	schemaJSON, err := marshalAvroSchema(schema)
+	if err != nil {
+		return fmt.Errorf("error encoding Avro schema: %v", err)
+	}
+	o.setSchema(schema, schemaJSON)
+	o.inferred = true
+
+	pending := o.pending
+	o.pending = nil
+	for _, document := range pending {
+		if err = o.next.ExportDocument(document); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendAvroLong appends n in Avro's zig-zag variable-length encoding.
+func appendAvroLong(out []byte, n int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(out, buf[:binary.PutVarint(buf[:], n)]...)
+}
+
+func appendAvroBytes(out []byte, b []byte) []byte {
+	return append(appendAvroLong(out, int64(len(b))), b...)
+}
+
+// avroAccepts returns whether value can be encoded with t, which is not a
+// union.
+func avroAccepts(t *avroType, value interface{}) bool {
+	switch t.Type {
+	case "null":
+		switch value.(type) {
+		case nil, primitive.Null, primitive.Undefined:
+			return true
+		}
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "int":
+		switch v := value.(type) {
+		case int32:
+			return true
+		case int64:
+			return v >= math.MinInt32 && v <= math.MaxInt32
+		}
+	case "long":
+		switch value.(type) {
+		case int32, int64, primitive.DateTime, primitive.Timestamp:
+			return true
+		}
+	case "float", "double":
+		switch value.(type) {
+		case int32, int64, float64:
+			return true
+		}
+	case "string":
+		_, ok := avroString(value)
+		return ok
+	case "bytes":
+		_, ok := value.(primitive.Binary)
+		return ok
+	case "fixed":
+		v, ok := value.(primitive.Binary)
+		return ok && len(v.Data) == t.Size
+	case "enum":
+		s, ok := value.(string)
+		return ok && avroSymbolIndex(t, s) >= 0
+	case "record", "map":
+		_, ok := value.(bson.D)
+		return ok
+	case "array":
+		_, ok := value.(bson.A)
+		return ok
+	}
+	return false
+}
+
+// avroString returns the string a value is encoded as with a string type:
+// strings as they are, UUIDs in their canonical form, and values of BSON
+// types without an Avro equivalent, such as ObjectIds and decimals, as their
+// string or extended JSON forms.
+func avroString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case primitive.ObjectID:
+		return v.Hex(), true
+	case primitive.Decimal128:
+		return v.String(), true
+	case primitive.Binary:
+		if v.Subtype != bsontype.BinaryUUID || len(v.Data) != 16 {
+			return "", false
+		}
+		d := v.Data
+		return fmt.Sprintf("%x-%x-%x-%x-%x", d[0:4], d[4:6], d[6:8], d[8:10], d[10:16]), true
+	case nil, primitive.Null, primitive.Undefined, bool, int32, int64, float64,
+		primitive.DateTime, primitive.Timestamp, bson.D, bson.A:
+		return "", false
+	}
+	out, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: value}}, false, false)
+	if err != nil {
+		return "", false
+	}
+	// strip the {"v": and } wrapping the value
+	return string(out[5 : len(out)-1]), true
+}
+
+func avroSymbolIndex(t *avroType, symbol string) int {
+	for i, s := range t.Symbols {
+		if s == symbol {
+			return i
+		}
+	}
+	return -1
+}
+
+// appendAvroValue appends value encoded with t. With strict, documents must
+// not have fields that their record lacks.
+func appendAvroValue(out []byte, t *avroType, value interface{}, strict bool) ([]byte, error) {
+	if t.Type == "union" {
+		for i, branch := range t.Branches {
+			if avroAccepts(branch, value) {
+				return appendAvroValue(appendAvroLong(out, int64(i)), branch, value, strict)
+			}
+		}
+		return nil, fmt.Errorf("value %v of type %T matches no branch of the union", value, value)
+	}
+	if !avroAccepts(t, value) {
+		return nil, fmt.Errorf("value %v of type %T cannot be encoded as %v", value, value, t.Type)
+	}
+
+	switch t.Type {
+	case "null":
+		return out, nil
+	case "boolean":
+		if value.(bool) {
+			return append(out, 1), nil
+		}
+		return append(out, 0), nil
+	case "int", "long":
+		return appendAvroLong(out, avroInteger(value)), nil
+	case "float":
+		var buf [4]byte
+		binary.LittleEndian.PutUint32(buf[:], math.Float32bits(float32(avroFloat(value))))
+		return append(out, buf[:]...), nil
+	case "double":
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], math.Float64bits(avroFloat(value)))
+		return append(out, buf[:]...), nil
+	case "string":
+		s, _ := avroString(value)
+		return appendAvroBytes(out, []byte(s)), nil
+	case "bytes":
+		return appendAvroBytes(out, value.(primitive.Binary).Data), nil
+	case "fixed":
+		return append(out, value.(primitive.Binary).Data...), nil
+	case "enum":
+		return appendAvroLong(out, int64(avroSymbolIndex(t, value.(string)))), nil
+	case "array":
+		items := value.(bson.A)
+		var err error
+		if len(items) > 0 {
+			out = appendAvroLong(out, int64(len(items)))
+			for i, item := range items {
+				if out, err = appendAvroValue(out, t.Items, item, strict); err != nil {
+					return nil, fmt.Errorf("element %v: %v", i, err)
+				}
+			}
+		}
+		return appendAvroLong(out, 0), nil
+	case "map":
+		doc := value.(bson.D)
+		var err error
+		if len(doc) > 0 {
+			out = appendAvroLong(out, int64(len(doc)))
+			for _, elem := range doc {
+				out = appendAvroBytes(out, []byte(elem.Key))
+				if out, err = appendAvroValue(out, t.Values, elem.Value, strict); err != nil {
+					return nil, fmt.Errorf("key %v: %v", elem.Key, err)
+				}
+			}
+		}
+		return appendAvroLong(out, 0), nil
+	}
+	return appendAvroRecord(out, t, value.(bson.D), strict)
+}
+
+// appendAvroRecord appends a document encoded with the record type t.
+func appendAvroRecord(out []byte, t *avroType, doc bson.D, strict bool) ([]byte, error) {
+	values := make(map[string]interface{}, len(doc))
+	for _, elem := range doc {
+		values[elem.Key] = elem.Value
+	}
+	var err error
+	for _, field := range t.Fields {
+		value, ok := values[field.Key]
+		if !ok && !field.Type.nullable() {
+			return nil, fmt.Errorf("missing field %v", field.Key)
+		}
+		if out, err = appendAvroValue(out, field.Type, value, strict); err != nil {
+			return nil, fmt.Errorf("field %v: %v", field.Key, err)
+		}
+		delete(values, field.Key)
+	}
+	if strict {
+		for _, elem := range doc {
+			if _, ok := values[elem.Key]; ok {
+				return nil, fmt.Errorf("field %v is not in the schema", elem.Key)
+			}
+		}
+	}
+	return out, nil
+}
+
+func avroInteger(value interface{}) int64 {
+	switch v := value.(type) {
+	case int32:
+		return int64(v)
+	case primitive.DateTime:
+		return int64(v)
+	case primitive.Timestamp:
+		return int64(v.T)<<32 | int64(v.I)
+	}
+	return value.(int64)
+}
+
+func avroFloat(value interface{}) float64 {
+	switch v := value.(type) {
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	}
+	return value.(float64)
+}
@@ -0,0 +1,497 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// avroType is an Avro schema, either inferred from the exported documents
+// or read from --avroSchema.
+type avroType struct {
+	// Type is the Avro type: null, boolean, int, long, float, double, bytes,
+	// string, record, enum, array, map, fixed, or union
+	Type string
+	// Logical is the logical type annotating the type, if any, such as
+	// timestamp-millis or uuid
+	Logical string
+	// Name is the name of a record, enum or fixed type
+	Name string
+
+	Fields   []avroField // record
+	Items    *avroType   // array
+	Values   *avroType   // map
+	Branches []*avroType // union
+	Symbols  []string    // enum
+	Size     int         // fixed
+}
+
+// avroField is a field of an Avro record.
+type avroField struct {
+	Name string
+	// Key is the BSON key the field is read from, which differs from Name if
+	// the key is not a valid Avro name
+	Key  string
+	Type *avroType
+}
+
+// nullable returns whether t accepts null.
+func (t *avroType) nullable() bool {
+	if t.Type == "null" {
+		return true
+	}
+	for _, branch := range t.Branches {
+		if branch.Type == "null" {
+			return true
+		}
+	}
+	return false
+}
+
+// avroName returns key as a valid Avro name, [A-Za-z_][A-Za-z0-9_]*.
+func avroName(key string) string {
+	name := []byte(key)
+	for i, c := range name {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			name[i] = '_'
+		}
+	}
+	if len(name) == 0 || name[0] >= '0' && name[0] <= '9' {
+		return "_" + string(name)
+	}
+	return string(name)
+}
+
+// inferAvroType returns the Avro type of a BSON value. Records are named
+// after name. BSON types without an Avro equivalent, such as ObjectIds and
+// decimals, are mapped to strings.
+func inferAvroType(value interface{}, name string) *avroType {
+	switch v := value.(type) {
+	case nil, primitive.Null, primitive.Undefined:
+		return &avroType{Type: "null"}
+	case bool:
+		return &avroType{Type: "boolean"}
+	case int32:
+		return &avroType{Type: "int"}
+	case int64, primitive.Timestamp:
+		return &avroType{Type: "long"}
+	case float64:
+		return &avroType{Type: "double"}
+	case primitive.DateTime:
+		return &avroType{Type: "long", Logical: "timestamp-millis"}
+	case primitive.Binary:
+		if v.Subtype == bsontype.BinaryUUID && len(v.Data) == 16 {
+			return &avroType{Type: "string", Logical: "uuid"}
+		}
+		return &avroType{Type: "bytes"}
+	case bson.D:
+		return inferAvroRecord(v, name)
+	case bson.A:
+		var items *avroType
+		for _, item := range v {
+			items = mergeAvroTypes(items, inferAvroType(item, name+"_item"))
+		}
+		if items == nil {
+			items = &avroType{Type: "null"}
+		}
+		return &avroType{Type: "array", Items: items}
+	}
+	return &avroType{Type: "string"}
+}
+
+// inferAvroRecord returns the Avro record type of a document.
+func inferAvroRecord(doc bson.D, name string) *avroType {
+	record := &avroType{Type: "record", Name: name}
+	names := make(map[string]bool, len(doc))
+	for _, elem := range doc {
+		fieldName := avroName(elem.Key)
+		for i := 2; names[fieldName]; i++ {
+			fieldName = avroName(elem.Key) + "_" + strconv.Itoa(i)
+		}
+		names[fieldName] = true
+		record.Fields = append(record.Fields, avroField{
+			Name: fieldName,
+			Key:  elem.Key,
+			Type: inferAvroType(elem.Value, name+"_"+fieldName),
+		})
+	}
+	return record
+}
+
+// avroBranchKind groups the types that a union holds at most one of: numbers
+// are widened into one branch, and records and arrays are merged.
+func avroBranchKind(t *avroType) string {
+	if t.Type == "int" || t.Type == "long" || t.Type == "double" {
+		return "number"
+	}
+	return t.Type
+}
+
+// avroBranchOrder orders the branches of inferred unions, with null first
+// so that it can be the default of nullable fields.
+var avroBranchOrder = []string{"null", "boolean", "int", "long", "double", "string", "bytes", "array", "record"}
+
+// mergeAvroTypes returns a type that accepts the values of both a and b.
+// Either may be nil.
+func mergeAvroTypes(a, b *avroType) *avroType {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	var branches []*avroType
+	for _, t := range append(flattenAvroUnion(a), flattenAvroUnion(b)...) {
+		merged := false
+		for i, branch := range branches {
+			if avroBranchKind(branch) == avroBranchKind(t) {
+				branches[i] = mergeAvroBranches(branch, t)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			branches = append(branches, t)
+		}
+	}
+	if len(branches) == 1 {
+		return branches[0]
+	}
+	sort.SliceStable(branches, func(i, j int) bool {
+		return avroBranchRank(branches[i]) < avroBranchRank(branches[j])
+	})
+	return &avroType{Type: "union", Branches: branches}
+}
+
+func flattenAvroUnion(t *avroType) []*avroType {
+	if t.Type == "union" {
+		return t.Branches
+	}
+	return []*avroType{t}
+}
+
+func avroBranchRank(t *avroType) int {
+	for i, name := range avroBranchOrder {
+		if t.Type == name {
+			return i
+		}
+	}
+	return len(avroBranchOrder)
+}
+
+// mergeAvroBranches merges two types of the same branch kind. Logical types
+// are kept only if both types have the same.
+func mergeAvroBranches(a, b *avroType) *avroType {
+	switch a.Type {
+	case "int", "long", "double":
+		if a.Type == b.Type && a.Logical == b.Logical {
+			return a
+		}
+		// widen numbers to the larger type
+		if b.Type == "double" || a.Type == "double" {
+			return &avroType{Type: "double"}
+		}
+		return &avroType{Type: "long"}
+	case "array":
+		return &avroType{Type: "array", Items: mergeAvroTypes(a.Items, b.Items)}
+	case "record":
+		merged := &avroType{Type: "record", Name: a.Name}
+		bFields := make(map[string]avroField, len(b.Fields))
+		for _, field := range b.Fields {
+			bFields[field.Key] = field
+		}
+		null := &avroType{Type: "null"}
+		for _, field := range a.Fields {
+			other, ok := bFields[field.Key]
+			if ok {
+				field.Type = mergeAvroTypes(field.Type, other.Type)
+				delete(bFields, field.Key)
+			} else {
+				field.Type = mergeAvroTypes(field.Type, null)
+			}
+			merged.Fields = append(merged.Fields, field)
+		}
+		for _, field := range b.Fields {
+			if _, ok := bFields[field.Key]; ok {
+				field.Type = mergeAvroTypes(field.Type, null)
+				merged.Fields = append(merged.Fields, field)
+			}
+		}
+		return merged
+	}
+	if a.Logical != b.Logical {
+		return &avroType{Type: a.Type}
+	}
+	return a
+}
+
+// inferAvroSchema returns the schema of a record named name that accepts
+// every document of docs. Fields are sorted by name, _id first, so that the
+// schema does not depend on the order of fields in the documents.
+func inferAvroSchema(docs []bson.D, name string) *avroType {
+	schema := &avroType{Type: "record", Name: name}
+	for i, doc := range docs {
+		if i == 0 {
+			schema = inferAvroRecord(doc, name)
+		} else {
+			schema = mergeAvroBranches(schema, inferAvroRecord(doc, name))
+		}
+	}
+	sortAvroFields(schema)
+	return schema
+}
+
+func sortAvroFields(t *avroType) {
+	switch t.Type {
+	case "record":
+		sort.SliceStable(t.Fields, func(i, j int) bool {
+			if t.Fields[i].Key == "_id" || t.Fields[j].Key == "_id" {
+				return t.Fields[i].Key == "_id" && t.Fields[j].Key != "_id"
+			}
+			return t.Fields[i].Name < t.Fields[j].Name
+		})
+		for _, field := range t.Fields {
+			sortAvroFields(field.Type)
+		}
+	case "array":
+		sortAvroFields(t.Items)
+	case "union":
+		for _, branch := range t.Branches {
+			sortAvroFields(branch)
+		}
+	}
+}
+
+// schemaJSON returns the JSON form of the schema. Nullable fields default
+// to null, and fields read from a key that is not a valid Avro name record
+// the key as bsonKey.
+func (t *avroType) schemaJSON() interface{} {
+	var schema map[string]interface{}
+	switch t.Type {
+	case "union":
+		branches := make([]interface{}, len(t.Branches))
+		for i, branch := range t.Branches {
+			branches[i] = branch.schemaJSON()
+		}
+		return branches
+	case "record":
+		fields := make([]interface{}, len(t.Fields))
+		for i, field := range t.Fields {
+			f := map[string]interface{}{"name": field.Name, "type": field.Type.schemaJSON()}
+			if field.Key != field.Name {
+				f["bsonKey"] = field.Key
+			}
+			if field.Type.nullable() {
+				f["default"] = nil
+			}
+			fields[i] = f
+		}
+		schema = map[string]interface{}{"type": "record", "name": t.Name, "fields": fields}
+	case "array":
+		schema = map[string]interface{}{"type": "array", "items": t.Items.schemaJSON()}
+	case "map":
+		schema = map[string]interface{}{"type": "map", "values": t.Values.schemaJSON()}
+	case "enum":
+		schema = map[string]interface{}{"type": "enum", "name": t.Name, "symbols": t.Symbols}
+	case "fixed":
+		schema = map[string]interface{}{"type": "fixed", "name": t.Name, "size": t.Size}
+	default:
+		if t.Logical == "" {
+			return t.Type
+		}
+		schema = map[string]interface{}{"type": t.Type}
+	}
+	if t.Logical != "" {
+		schema["logicalType"] = t.Logical
+	}
+	return schema
+}
+
+// marshalAvroSchema returns the schema as compact JSON, with object keys
+// sorted so that the same schema is always written the same way.
+func marshalAvroSchema(t *avroType) ([]byte, error) {
+	return json.Marshal(t.schemaJSON())
+}
+
+// ReadAvroSchema reads and parses an Avro schema file given with
+// --avroSchema, whose top-level type must be a record. It returns the schema
+// and its compacted JSON.
+func ReadAvroSchema(filename string) (*avroType, []byte, error) {
+	data, err := ioutil.ReadFile(util.ToUniversalPath(filename))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading --avroSchema file: %v", err)
+	}
+	schema, compact, err := parseAvroSchema(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing --avroSchema file %v: %v", filename, err)
+	}
+	return schema, compact, nil
+}
+
+// parseAvroSchema parses a JSON Avro schema whose top-level type is a
+// record.
+func parseAvroSchema(data []byte) (*avroType, []byte, error) {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, nil, err
+	}
+	parser := avroSchemaParser{named: make(map[string]*avroType)}
+	schema, err := parser.parse(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	if schema.Type != "record" {
+		return nil, nil, fmt.Errorf("the schema must be a record, not %v", schema.Type)
+	}
+	compact, err := json.Marshal(raw)
+	return schema, compact, err
+}
+
+// avroSchemaParser parses JSON Avro schemas, resolving references to named
+// types.
+type avroSchemaParser struct {
+	named map[string]*avroType
+}
+
+var avroPrimitiveTypes = map[string]bool{
+	"null": true, "boolean": true, "int": true, "long": true, "float": true, "double": true, "bytes": true, "string": true,
+}
+
+func (p avroSchemaParser) parse(raw interface{}) (*avroType, error) {
+	switch v := raw.(type) {
+	case string:
+		if avroPrimitiveTypes[v] {
+			return &avroType{Type: v}, nil
+		}
+		if named, ok := p.lookup(v); ok {
+			return named, nil
+		}
+		return nil, fmt.Errorf("unknown type '%v'", v)
+	case []interface{}:
+		union := &avroType{Type: "union"}
+		for _, branch := range v {
+			t, err := p.parse(branch)
+			if err != nil {
+				return nil, err
+			}
+			if t.Type == "union" {
+				return nil, fmt.Errorf("unions cannot contain unions")
+			}
+			union.Branches = append(union.Branches, t)
+		}
+		if len(union.Branches) == 0 {
+			return nil, fmt.Errorf("unions must have at least one branch")
+		}
+		return union, nil
+	case map[string]interface{}:
+		return p.parseObject(v)
+	}
+	return nil, fmt.Errorf("invalid schema %v", raw)
+}
+
+// lookup returns the named type with the given name or full name.
+func (p avroSchemaParser) lookup(name string) (*avroType, bool) {
+	if t, ok := p.named[name]; ok {
+		return t, true
+	}
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		t, ok := p.named[name[i+1:]]
+		return t, ok
+	}
+	return nil, false
+}
+
+func (p avroSchemaParser) parseObject(v map[string]interface{}) (*avroType, error) {
+	typeName, _ := v["type"].(string)
+	logical, _ := v["logicalType"].(string)
+	name, _ := v["name"].(string)
+	switch typeName {
+	case "record", "error":
+		if name == "" {
+			return nil, fmt.Errorf("records must have a name")
+		}
+		record := &avroType{Type: "record", Name: name}
+		// register the record first, so that its fields can refer to it
+		p.named[name] = record
+		fields, ok := v["fields"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("record %v must have fields", name)
+		}
+		for _, f := range fields {
+			field, ok := f.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid field in record %v", name)
+			}
+			fieldName, _ := field["name"].(string)
+			if fieldName == "" {
+				return nil, fmt.Errorf("fields of record %v must have a name", name)
+			}
+			key, ok := field["bsonKey"].(string)
+			if !ok {
+				key = fieldName
+			}
+			t, err := p.parse(field["type"])
+			if err != nil {
+				return nil, fmt.Errorf("field %v of record %v: %v", fieldName, name, err)
+			}
+			record.Fields = append(record.Fields, avroField{Name: fieldName, Key: key, Type: t})
+		}
+		return record, nil
+	case "enum":
+		enum := &avroType{Type: "enum", Name: name}
+		symbols, _ := v["symbols"].([]interface{})
+		for _, symbol := range symbols {
+			s, ok := symbol.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid symbol in enum %v", name)
+			}
+			enum.Symbols = append(enum.Symbols, s)
+		}
+		p.named[name] = enum
+		return enum, nil
+	case "fixed":
+		size, ok := v["size"].(float64)
+		if !ok || size < 0 {
+			return nil, fmt.Errorf("fixed %v must have a size", name)
+		}
+		fixed := &avroType{Type: "fixed", Name: name, Size: int(size), Logical: logical}
+		p.named[name] = fixed
+		return fixed, nil
+	case "array":
+		items, err := p.parse(v["items"])
+		if err != nil {
+			return nil, err
+		}
+		return &avroType{Type: "array", Items: items, Logical: logical}, nil
+	case "map":
+		values, err := p.parse(v["values"])
+		if err != nil {
+			return nil, err
+		}
+		return &avroType{Type: "map", Values: values, Logical: logical}, nil
+	}
+	t, err := p.parse(v["type"])
+	if err != nil {
+		return nil, err
+	}
+	if logical != "" {
+		annotated := *t
+		annotated.Logical = logical
+		return &annotated, nil
+	}
+	return t, nil
+}
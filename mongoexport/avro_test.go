@@ -0,0 +1,136 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"bytes"
+	"crypto/md5"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestInferAvroSchema(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With documents of varying shapes", t, func() {
+		uuid := primitive.Binary{Subtype: bsontype.BinaryUUID, Data: make([]byte, 16)}
+		docs := []bson.D{
+			{
+				{Key: "name", Value: "a"},
+				{Key: "_id", Value: int32(1)},
+				{Key: "created", Value: primitive.DateTime(0)},
+				{Key: "total", Value: int32(1)},
+				{Key: "user-id", Value: uuid},
+			},
+			{
+				{Key: "_id", Value: int64(2)},
+				{Key: "created", Value: primitive.DateTime(0)},
+				{Key: "total", Value: 1.5},
+				{Key: "user-id", Value: uuid},
+				{Key: "tags", Value: bson.A{"x"}},
+			},
+		}
+
+		Convey("fields are sorted, widened and nullable if missing", func() {
+			schema, err := marshalAvroSchema(inferAvroSchema(docs, "orders"))
+			So(err, ShouldBeNil)
+			So(string(schema), ShouldEqual, `{"fields":[`+
+				`{"name":"_id","type":"long"},`+
+				`{"name":"created","type":{"logicalType":"timestamp-millis","type":"long"}},`+
+				`{"default":null,"name":"name","type":["null","string"]},`+
+				`{"default":null,"name":"tags","type":["null",{"items":"string","type":"array"}]},`+
+				`{"name":"total","type":"double"},`+
+				`{"bsonKey":"user-id","name":"user_id","type":{"logicalType":"uuid","type":"string"}}`+
+				`],"name":"orders","type":"record"}`)
+		})
+
+		Convey("documents are encoded with the inferred schema", func() {
+			schema := inferAvroSchema(docs, "orders")
+			out, err := appendAvroValue(nil, schema, docs[1], true)
+			So(err, ShouldBeNil)
+			So(out[:5], ShouldResemble, []byte{
+				0x04, // _id: 2
+				0x00, // created: 0
+				0x00, // name: null branch
+				0x02, // tags: array branch
+				0x02, // one element
+			})
+
+			_, err = appendAvroValue(nil, schema, bson.D{{Key: "_id", Value: int32(1)}, {Key: "extra", Value: true}}, true)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestAvroExportOutput(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Documents are written to an Avro container file", t, func() {
+		out := &bytes.Buffer{}
+		output := NewAvroExportOutput(nil, nil, "my.orders", out)
+		So(output.WriteHeader(), ShouldBeNil)
+		So(output.ExportDocument(bson.D{{Key: "_id", Value: int32(1)}, {Key: "name", Value: "ab"}}), ShouldBeNil)
+		So(output.WriteFooter(), ShouldBeNil)
+		So(output.Flush(), ShouldBeNil)
+		So(output.NumExported, ShouldEqual, 1)
+
+		schema := `{"fields":[{"name":"_id","type":"int"},{"name":"name","type":"string"}],"name":"my_orders","type":"record"}`
+		sync := md5.Sum([]byte(schema))
+		expected := []byte("Obj\x01")
+		expected = appendAvroLong(expected, 2)
+		expected = appendAvroBytes(expected, []byte("avro.codec"))
+		expected = appendAvroBytes(expected, []byte("null"))
+		expected = appendAvroBytes(expected, []byte("avro.schema"))
+		expected = appendAvroBytes(expected, []byte(schema))
+		expected = append(expected, 0)
+		expected = append(expected, sync[:]...)
+		expected = append(expected, 0x02, 0x08, 0x02, 0x04, 'a', 'b')
+		expected = append(expected, sync[:]...)
+		So(out.Bytes(), ShouldResemble, expected)
+	})
+
+	Convey("Documents are written with a given schema", t, func() {
+		schema, compact, err := parseAvroSchema([]byte(`{
+			"type": "record", "name": "order",
+			"fields": [
+				{"name": "id", "bsonKey": "_id", "type": "string"},
+				{"name": "status", "type": {"type": "enum", "name": "status", "symbols": ["open", "closed"]}},
+				{"name": "total", "type": ["null", "float"], "default": null},
+				{"name": "attrs", "type": {"type": "map", "values": "long"}}
+			]
+		}`))
+		So(err, ShouldBeNil)
+		So(string(compact), ShouldStartWith, `{"fields":[`)
+
+		oid, _ := primitive.ObjectIDFromHex("5f8d0d55b54764421b7156c3")
+		doc := bson.D{
+			{Key: "_id", Value: oid},
+			{Key: "status", Value: "closed"},
+			{Key: "attrs", Value: bson.D{{Key: "n", Value: int32(-1)}}},
+			{Key: "ignored", Value: true},
+		}
+		out, err := appendAvroValue(nil, schema, doc, false)
+		So(err, ShouldBeNil)
+		expected := appendAvroBytes(nil, []byte("5f8d0d55b54764421b7156c3"))
+		expected = append(expected, 0x02, 0x00, 0x02, 0x02, 'n', 0x01, 0x00)
+		So(out, ShouldResemble, expected)
+
+		doc[1].Value = "pending"
+		_, err = appendAvroValue(nil, schema, doc, false)
+		So(err, ShouldNotBeNil)
+
+		_, _, err = parseAvroSchema([]byte(`"string"`))
+		So(err, ShouldNotBeNil)
+		_, _, err = parseAvroSchema([]byte(`{"type": "record", "name": "r", "fields": [{"name": "a", "type": "unknown"}]}`))
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,84 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// smallDocument is typical of the collections of small documents for which
+// the cost of exporting each document dominates.
+func smallDocument(b *testing.B) bson.Raw {
+	doc, err := bson.Marshal(bson.D{
+		{"_id", primitive.NewObjectID()},
+		{"name", "Ada Lovelace"},
+		{"age", int32(36)},
+		{"score", 97.5},
+		{"tags", bson.A{"math", "computing"}},
+		{"address", bson.D{{"city", "London"}, {"zip", "W1"}}},
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return doc
+}
+
+// BenchmarkJSONExportDecoded measures exporting documents decoded from the
+// cursor, as done when fields are masked.
+func BenchmarkJSONExportDecoded(b *testing.B) {
+	testtype.SkipUnlessBenchmarkType(b, testtype.UnitTestType)
+
+	raw := smallDocument(b)
+	output := NewJSONExportOutput(false, false, ioutil.Discard, Relaxed)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var doc bson.D
+		if err := bson.Unmarshal(raw, &doc); err != nil {
+			b.Fatal(err)
+		}
+		if err := output.ExportDocument(doc); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkJSONExportRaw measures exporting documents straight from the
+// cursor's raw BSON.
+func BenchmarkJSONExportRaw(b *testing.B) {
+	testtype.SkipUnlessBenchmarkType(b, testtype.UnitTestType)
+
+	raw := smallDocument(b)
+	output := NewJSONExportOutput(false, false, ioutil.Discard, Relaxed)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := exportRawDocument(output, raw); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkCSVExport measures exporting documents to CSV.
+func BenchmarkCSVExport(b *testing.B) {
+	testtype.SkipUnlessBenchmarkType(b, testtype.UnitTestType)
+
+	raw := smallDocument(b)
+	output := NewCSVExportOutput([]string{"_id", "name", "age", "address.city"}, true, ioutil.Discard)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := exportRawDocument(output, raw); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -35,16 +35,19 @@ type CSVExportOutput struct {
 	NoHeaderLine bool
 
 	csvWriter *csv.Writer
+
+	// row is reused for every document, since the csv.Writer copies it
+	row []string
 }
 
 // NewCSVExportOutput returns a CSVExportOutput configured to write output to the
 // given io.Writer, extracting the specified fields only.
 func NewCSVExportOutput(fields []string, noHeaderLine bool, out io.Writer) *CSVExportOutput {
 	return &CSVExportOutput{
-		fields,
-		0,
-		noHeaderLine,
-		csv.NewWriter(out),
+		Fields:       fields,
+		NoHeaderLine: noHeaderLine,
+		csvWriter:    csv.NewWriter(out),
+		row:          make([]string, 0, len(fields)),
 	}
 }
 
@@ -71,7 +74,7 @@ func (csvExporter *CSVExportOutput) Flush() error {
 
 // ExportDocument writes a line to output with the CSV representation of a document.
 func (csvExporter *CSVExportOutput) ExportDocument(document bson.D) error {
-	rowOut := make([]string, 0, len(csvExporter.Fields))
+	rowOut := csvExporter.row[:0]
 	extendedDoc, err := bsonutil.ConvertBSONValueToLegacyExtJSON(document)
 	if err != nil {
 		return err
@@ -96,6 +99,7 @@ func (csvExporter *CSVExportOutput) ExportDocument(document bson.D) error {
 		}
 	}
 	csvExporter.csvWriter.Write(rowOut)
+	csvExporter.row = rowOut
 	csvExporter.NumExported++
 	return csvExporter.csvWriter.Error()
 }
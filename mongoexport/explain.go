@@ -0,0 +1,102 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// planProblemStages describes the plan stages that make an export expensive:
+// reading every document of the collection, or sorting the results in memory
+// rather than reading them in order from an index.
+var planProblemStages = map[string]string{
+	"COLLSCAN": "a full collection scan",
+	"SORT":     "an in-memory sort",
+}
+
+// checkQueryPlan explains the find that reads the documents to export, and
+// warns if the plan scans the whole collection or sorts in memory, or fails
+// if --requireIndexed is set. Exports without a query or sort are expected to
+// read the whole collection, so they are only checked with --requireIndexed.
+func (exp *MongoExport) checkQueryPlan() error {
+	if exp.InputOpts == nil || exp.InputOpts.ForceTableScan {
+		return nil
+	}
+	requireIndexed := exp.InputOpts.RequireIndexed
+	if !requireIndexed && !exp.InputOpts.HasQuery() && exp.InputOpts.Sort == "" {
+		return nil
+	}
+
+	coll, query, findOpts, err := exp.getFind()
+	if err != nil {
+		return err
+	}
+	explain := bson.D{
+		{Key: "explain", Value: findCommand(coll, query, findOpts)},
+		{Key: "verbosity", Value: "queryPlanner"},
+	}
+	plan, err := coll.Database().RunCommand(nil, explain).DecodeBytes()
+	if err != nil {
+		if requireIndexed {
+			return fmt.Errorf("error explaining the export query for --requireIndexed: %v", err)
+		}
+		log.Logvf(log.Always, "warning: could not explain the export query: %v", err)
+		return nil
+	}
+
+	problems := planProblems(plan)
+	if len(problems) == 0 {
+		return nil
+	}
+	msg := fmt.Sprintf("the export query on %v.%v uses %v",
+		exp.ToolOptions.Namespace.DB, exp.ToolOptions.Namespace.Collection, strings.Join(problems, " and "))
+	if requireIndexed {
+		return fmt.Errorf("%v, which --requireIndexed does not allow", msg)
+	}
+	log.Logvf(log.Always, "warning: %v; use --requireIndexed to fail such exports", msg)
+	return nil
+}
+
+// planProblems returns descriptions of the problem stages in the winning plan
+// of the explain output, in the order they are found.
+// The plans of each shard of a sharded cluster, of the $cursor stage of a view
+// and of the slot based execution engine are all searched, but rejected plans
+// are not.
+func planProblems(explain bson.Raw) []string {
+	found := map[string]bool{}
+	var problems []string
+	var walk func(doc bson.Raw)
+	walk = func(doc bson.Raw) {
+		elems, err := doc.Elements()
+		if err != nil {
+			return
+		}
+		for _, elem := range elems {
+			value := elem.Value()
+			switch {
+			case elem.Key() == "rejectedPlans":
+			case elem.Key() == "stage" && value.Type == bsontype.String:
+				stage := value.StringValue()
+				if desc, ok := planProblemStages[stage]; ok && !found[stage] {
+					found[stage] = true
+					problems = append(problems, desc)
+				}
+			case value.Type == bsontype.EmbeddedDocument:
+				walk(value.Document())
+			case value.Type == bsontype.Array:
+				walk(value.Array())
+			}
+		}
+	}
+	walk(explain)
+	return problems
+}
@@ -0,0 +1,94 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func explainOutput(winningPlan bson.D, rejectedPlans ...bson.D) bson.Raw {
+	rejected := bson.A{}
+	for _, plan := range rejectedPlans {
+		rejected = append(rejected, plan)
+	}
+	raw, err := bson.Marshal(bson.D{
+		{Key: "queryPlanner", Value: bson.D{
+			{Key: "namespace", Value: "test.orders"},
+			{Key: "winningPlan", Value: winningPlan},
+			{Key: "rejectedPlans", Value: rejected},
+		}},
+		{Key: "ok", Value: 1},
+	})
+	So(err, ShouldBeNil)
+	return raw
+}
+
+func TestPlanProblems(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	collScan := bson.D{{Key: "stage", Value: "COLLSCAN"}, {Key: "direction", Value: "forward"}}
+	ixScan := bson.D{
+		{Key: "stage", Value: "FETCH"},
+		{Key: "inputStage", Value: bson.D{{Key: "stage", Value: "IXSCAN"}, {Key: "indexName", Value: "status_1"}}},
+	}
+
+	Convey("Plans reading from an index have no problems", t, func() {
+		So(planProblems(explainOutput(ixScan, collScan)), ShouldBeEmpty)
+	})
+
+	Convey("Full collection scans and in-memory sorts are problems", t, func() {
+		So(planProblems(explainOutput(collScan)), ShouldResemble, []string{"a full collection scan"})
+
+		sorted := bson.D{
+			{Key: "stage", Value: "SORT"},
+			{Key: "sortPattern", Value: bson.D{{Key: "total", Value: 1}}},
+			{Key: "inputStage", Value: collScan},
+		}
+		So(planProblems(explainOutput(sorted, ixScan)), ShouldResemble,
+			[]string{"an in-memory sort", "a full collection scan"})
+	})
+
+	Convey("The plans of each shard are searched", t, func() {
+		sharded := bson.D{
+			{Key: "stage", Value: "SHARD_MERGE"},
+			{Key: "shards", Value: bson.A{
+				bson.D{{Key: "shardName", Value: "rs0"}, {Key: "winningPlan", Value: ixScan}},
+				bson.D{{Key: "shardName", Value: "rs1"}, {Key: "winningPlan", Value: collScan}},
+			}},
+		}
+		So(planProblems(explainOutput(sharded)), ShouldResemble, []string{"a full collection scan"})
+	})
+
+	Convey("The query plans of the slot based execution engine are searched", t, func() {
+		sbe := bson.D{
+			{Key: "queryPlan", Value: collScan},
+			{Key: "slotBasedPlan", Value: bson.D{{Key: "stages", Value: "[1] scan s4 s5 ..."}}},
+		}
+		So(planProblems(explainOutput(sbe)), ShouldResemble, []string{"a full collection scan"})
+	})
+}
+
+func TestRequireIndexedSettings(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("--requireIndexed should be rejected with --forceTableScan", t, func() {
+		exp := &MongoExport{
+			ToolOptions: &options.ToolOptions{Namespace: &options.Namespace{DB: "test", Collection: "orders"}},
+			OutputOpts:  &OutputFormatOptions{Type: JSON, JSONFormat: Relaxed},
+			InputOpts:   &InputOptions{RequireIndexed: true},
+		}
+		So(exp.validateSettings(), ShouldBeNil)
+
+		exp.InputOpts.ForceTableScan = true
+		So(exp.validateSettings(), ShouldNotBeNil)
+	})
+}
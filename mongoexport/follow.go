@@ -0,0 +1,208 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	mopt "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// followedOperations are the change events written by --follow. Other
+// events, such as drops and renames, are only logged.
+var followedOperations = map[string]bool{
+	"insert":  true,
+	"update":  true,
+	"replace": true,
+	"delete":  true,
+}
+
+// validateFollowSettings checks that --follow is only combined with options
+// that apply to change events as well as to the initial export.
+func (exp *MongoExport) validateFollowSettings() error {
+	if !exp.InputOpts.Follow {
+		if exp.InputOpts.ResumeTokenFile != "" {
+			return fmt.Errorf("--resumeTokenFile can only be used with --follow")
+		}
+		return nil
+	}
+	switch {
+	case exp.OutputOpts.Type != JSON || exp.template != nil:
+		return fmt.Errorf("--follow can only be used with --type=json, without --template")
+	case exp.OutputOpts.JSONArray:
+		return fmt.Errorf("--follow cannot be used with --jsonArray")
+	case exp.isSplit():
+		return fmt.Errorf("--follow cannot be used with --splitSize or --splitDocs")
+	case exp.InputOpts.HasQuery() || exp.OutputOpts.Fields != "":
+		return fmt.Errorf("--follow cannot be used with --query, --queryFile or --fields, since change events are not filtered")
+	case exp.unwinder != nil || exp.masker != nil:
+		return fmt.Errorf("--follow cannot be used with --unwind or --maskFields, since change events are not transformed")
+	}
+	return nil
+}
+
+// HandleInterrupt stops following the change stream once the current event
+// is written. It does not stop the initial export.
+func (exp *MongoExport) HandleInterrupt() {
+	if exp.stopFollowing != nil {
+		log.Logv(log.Always, "interrupted, stopping after the current change event")
+		exp.stopFollowing()
+	}
+}
+
+// readResumeToken returns the resume token saved in --resumeTokenFile, or nil
+// if there is none yet.
+func (exp *MongoExport) readResumeToken() (bson.D, error) {
+	path := exp.InputOpts.ResumeTokenFile
+	if path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(util.ToUniversalPath(path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading --resumeTokenFile: %v", err)
+	}
+	var token bson.D
+	if err = bson.UnmarshalExtJSON(data, true, &token); err != nil {
+		return nil, fmt.Errorf("error parsing resume token in %v: %v", path, err)
+	}
+	return token, nil
+}
+
+// writeResumeToken saves token to --resumeTokenFile, if set, replacing the
+// file so that it always holds a whole token.
+func (exp *MongoExport) writeResumeToken(token bson.Raw) error {
+	path := exp.InputOpts.ResumeTokenFile
+	if path == "" || token == nil {
+		return nil
+	}
+	data, err := bson.MarshalExtJSON(token, true, false)
+	if err != nil {
+		return fmt.Errorf("error encoding resume token: %v", err)
+	}
+	path = util.ToUniversalPath(path)
+	if err = os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return fmt.Errorf("error creating directory for --resumeTokenFile: %v", err)
+	}
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing --resumeTokenFile: %v", err)
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error writing --resumeTokenFile: %v", err)
+	}
+	return nil
+}
+
+// followStartTime returns the time the change stream starts at when there is
+// no resume token: the time of the snapshot read, or else the current cluster
+// time, read before the initial export so that no change is missed. Changes
+// made during the initial export may be written twice.
+func (exp *MongoExport) followStartTime() (*primitive.Timestamp, error) {
+	if exp.isSnapshotRead() {
+		startAt := exp.atClusterTime
+		return &startAt, nil
+	}
+	startAt, err := exp.SessionProvider.ClusterTime()
+	if err != nil {
+		return nil, fmt.Errorf("error determining cluster time to follow changes from: %v", err)
+	}
+	return &startAt, nil
+}
+
+// follow opens a change stream on the namespace, resuming after resumeToken
+// if set or else starting at startAt, and writes each insert, update, replace
+// and delete event to output until interrupted. The output is flushed, and the
+// resume token saved, whenever the stream has caught up. It returns the number
+// of events written.
+func (exp *MongoExport) follow(output ExportOutput, resumeToken bson.D, startAt *primitive.Timestamp) (int64, error) {
+	ctx := exp.followCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if ctx.Err() != nil {
+		return 0, nil
+	}
+
+	session, err := exp.SessionProvider.GetSession()
+	if err != nil {
+		return 0, err
+	}
+	coll := session.Database(exp.ToolOptions.Namespace.DB).Collection(exp.ToolOptions.Namespace.Collection)
+	streamOpts := mopt.ChangeStream().SetFullDocument(mopt.UpdateLookup)
+	if resumeToken != nil {
+		streamOpts.SetResumeAfter(resumeToken)
+	} else {
+		streamOpts.SetStartAtOperationTime(startAt)
+	}
+	stream, err := coll.Watch(ctx, mongo.Pipeline{}, streamOpts)
+	if err != nil {
+		if ctx.Err() != nil {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("error opening change stream: %v", err)
+	}
+	defer stream.Close(context.Background())
+	log.Logvf(log.Always, "following changes to %v until interrupted", exp.ToolOptions.Namespace)
+
+	// checkpoint flushes the events written so far before recording that
+	// they need not be followed again
+	checkpoint := func() error {
+		if err := output.Flush(); err != nil {
+			return err
+		}
+		return exp.writeResumeToken(stream.ResumeToken())
+	}
+	if err = checkpoint(); err != nil {
+		return 0, err
+	}
+
+	var count int64
+	for {
+		ok := stream.TryNext(ctx)
+		if !ok && stream.Err() == nil {
+			if err = checkpoint(); err != nil {
+				return count, err
+			}
+			ok = stream.Next(ctx)
+		}
+		if !ok {
+			break
+		}
+
+		operationType, _ := stream.Current.Lookup("operationType").StringValueOK()
+		if operationType == "invalidate" {
+			if err = checkpoint(); err != nil {
+				return count, err
+			}
+			return count, fmt.Errorf("change stream invalidated, since %v was dropped or renamed", exp.ToolOptions.Namespace)
+		}
+		if !followedOperations[operationType] {
+			log.Logvf(log.Info, "skipping %v event", operationType)
+			continue
+		}
+		if err = exportRawDocument(output, stream.Current); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err = stream.Err(); err != nil && ctx.Err() == nil {
+		return count, fmt.Errorf("error following change stream: %v", err)
+	}
+	return count, checkpoint()
+}
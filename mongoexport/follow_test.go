@@ -0,0 +1,110 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestFollowSettings(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	newExport := func() *MongoExport {
+		return &MongoExport{
+			ToolOptions: &options.ToolOptions{Namespace: &options.Namespace{DB: "test", Collection: "users"}},
+			OutputOpts:  &OutputFormatOptions{Type: JSON, JSONFormat: Relaxed},
+			InputOpts:   &InputOptions{Follow: true},
+		}
+	}
+
+	Convey("--follow should be allowed for line-delimited JSON output", t, func() {
+		exp := newExport()
+		exp.InputOpts.ResumeTokenFile = "token.json"
+		So(exp.validateSettings(), ShouldBeNil)
+	})
+
+	Convey("--follow should be rejected with options that do not apply to change events", t, func() {
+		exp := newExport()
+		exp.OutputOpts.Type = CSV
+		exp.OutputOpts.Fields = "a"
+		So(exp.validateSettings(), ShouldNotBeNil)
+
+		exp = newExport()
+		exp.OutputOpts.JSONArray = true
+		So(exp.validateSettings(), ShouldNotBeNil)
+
+		exp = newExport()
+		exp.InputOpts.Query = "{a: 1}"
+		So(exp.validateSettings(), ShouldNotBeNil)
+
+		exp = newExport()
+		exp.OutputOpts.MaskFields = "ssn"
+		So(exp.validateSettings(), ShouldNotBeNil)
+	})
+
+	Convey("--resumeTokenFile should require --follow", t, func() {
+		exp := newExport()
+		exp.InputOpts.Follow = false
+		exp.InputOpts.ResumeTokenFile = "token.json"
+		So(exp.validateSettings(), ShouldNotBeNil)
+	})
+}
+
+func TestResumeTokenFile(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a --resumeTokenFile that does not exist yet", t, func() {
+		dir, err := ioutil.TempDir("", "mongoexport_follow")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		exp := &MongoExport{InputOpts: &InputOptions{Follow: true, ResumeTokenFile: filepath.Join(dir, "state", "token.json")}}
+		token, err := exp.readResumeToken()
+		So(err, ShouldBeNil)
+		So(token, ShouldBeNil)
+
+		Convey("a saved token should be read back", func() {
+			raw, err := bson.Marshal(bson.D{{Key: "_data", Value: "8263A1B2C3000000012B022C0100296E5A1004"}})
+			So(err, ShouldBeNil)
+			So(exp.writeResumeToken(raw), ShouldBeNil)
+
+			token, err := exp.readResumeToken()
+			So(err, ShouldBeNil)
+			So(token, ShouldResemble, bson.D{{Key: "_data", Value: "8263A1B2C3000000012B022C0100296E5A1004"}})
+		})
+
+		Convey("--out should be appended to once there is a token to resume from", func() {
+			exp.OutputOpts = &OutputFormatOptions{OutputFile: filepath.Join(dir, "out.json")}
+			write := func(data string) {
+				out, err := exp.GetOutputWriter()
+				So(err, ShouldBeNil)
+				_, err = out.Write([]byte(data))
+				So(err, ShouldBeNil)
+				So(out.Close(), ShouldBeNil)
+			}
+			write("initial\n")
+			write("replaced\n")
+
+			raw, err := bson.Marshal(bson.D{{Key: "_data", Value: "8263A1B2C3000000012B022C0100296E5A1004"}})
+			So(err, ShouldBeNil)
+			So(exp.writeResumeToken(raw), ShouldBeNil)
+			write("resumed\n")
+
+			data, err := ioutil.ReadFile(exp.OutputOpts.OutputFile)
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, "replaced\nresumed\n")
+		})
+	})
+}
@@ -14,6 +14,13 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 )
 
+// separators written between documents in array and pretty mode
+var (
+	arraySeparator       = []byte(",")
+	prettySeparator      = []byte("\n")
+	arrayPrettySeparator = []byte(",\n")
+)
+
 // JSONExportOutput is an implementation of ExportOutput that writes documents
 // to the output in JSON format.
 type JSONExportOutput struct {
@@ -25,17 +32,20 @@ type JSONExportOutput struct {
 	Out          io.Writer
 	NumExported  int64
 	JSONFormat   JSONFormat
+
+	// buffers reused to encode each document
+	buf    []byte
+	pretty bytes.Buffer
 }
 
 // NewJSONExportOutput creates a new JSONExportOutput in array mode if specified,
 // configured to write data to the given io.Writer.
 func NewJSONExportOutput(arrayOutput bool, prettyOutput bool, out io.Writer, jsonFormat JSONFormat) *JSONExportOutput {
 	return &JSONExportOutput{
-		arrayOutput,
-		prettyOutput,
-		out,
-		0,
-		jsonFormat,
+		ArrayOutput:  arrayOutput,
+		PrettyOutput: prettyOutput,
+		Out:          out,
+		JSONFormat:   jsonFormat,
 	}
 }
 
@@ -78,46 +88,53 @@ func (jsonExporter *JSONExportOutput) Flush() error {
 // ExportDocument converts the given document to extended JSON, and writes it
 // to the output.
 func (jsonExporter *JSONExportOutput) ExportDocument(document bson.D) error {
-	if jsonExporter.ArrayOutput || jsonExporter.PrettyOutput {
-		if jsonExporter.NumExported >= 1 {
-			if jsonExporter.ArrayOutput {
-				if _, err := jsonExporter.Out.Write([]byte(",")); err != nil {
-					return err
-				}
-			}
-			if jsonExporter.PrettyOutput {
-				if _, err := jsonExporter.Out.Write([]byte("\n")); err != nil {
-					return err
-				}
-			}
-		}
+	return jsonExporter.export(document)
+}
 
-		jsonOut, err := bson.MarshalExtJSON(document, jsonExporter.JSONFormat == Canonical, false)
-		if err != nil {
-			return err
-		}
+// ExportRawDocument converts the given raw BSON document to extended JSON
+// without decoding it first, and writes it to the output.
+func (jsonExporter *JSONExportOutput) ExportRawDocument(document bson.Raw) error {
+	return jsonExporter.export(document)
+}
 
-		if jsonExporter.PrettyOutput {
-			var jsonFormatted bytes.Buffer
-			if err = json.Indent(&jsonFormatted, jsonOut, "", "\t"); err != nil {
+// export encodes the document into the buffer reused for every document, and
+// writes it preceded by its separator.
+func (jsonExporter *JSONExportOutput) export(document interface{}) error {
+	if jsonExporter.NumExported >= 1 {
+		var separator []byte
+		switch {
+		case jsonExporter.ArrayOutput && jsonExporter.PrettyOutput:
+			separator = arrayPrettySeparator
+		case jsonExporter.ArrayOutput:
+			separator = arraySeparator
+		case jsonExporter.PrettyOutput:
+			separator = prettySeparator
+		}
+		if separator != nil {
+			if _, err := jsonExporter.Out.Write(separator); err != nil {
 				return err
 			}
-			jsonOut = jsonFormatted.Bytes()
 		}
+	}
 
-		if _, err = jsonExporter.Out.Write(jsonOut); err != nil {
-			return err
-		}
-	} else {
-		extendedDoc, err := bson.MarshalExtJSON(document, jsonExporter.JSONFormat == Canonical, false)
-		if err != nil {
+	out, err := bson.MarshalExtJSONAppend(jsonExporter.buf[:0], document, jsonExporter.JSONFormat == Canonical, false)
+	if err != nil {
+		return err
+	}
+	jsonExporter.buf = out
+	if jsonExporter.PrettyOutput {
+		jsonExporter.pretty.Reset()
+		if err = json.Indent(&jsonExporter.pretty, out, "", "\t"); err != nil {
 			return err
 		}
+		out = jsonExporter.pretty.Bytes()
+	} else if !jsonExporter.ArrayOutput {
+		out = append(out, '\n')
+		jsonExporter.buf = out
+	}
 
-		extendedDoc = append(extendedDoc, '\n')
-		if _, err = jsonExporter.Out.Write(extendedDoc); err != nil {
-			return err
-		}
+	if _, err = jsonExporter.Out.Write(out); err != nil {
+		return err
 	}
 	jsonExporter.NumExported++
 	return nil
@@ -9,6 +9,7 @@ package mongoexport
 import (
 	"bytes"
 	"testing"
+	"time"
 
 	"github.com/mongodb/mongo-tools/common/json"
 	"github.com/mongodb/mongo-tools/common/testtype"
@@ -94,3 +95,43 @@ func TestJSONArray(t *testing.T) {
 
 	})
 }
+
+func TestJSONRawDocument(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Raw documents should export exactly as decoded ones do", t, func() {
+		docs := []bson.D{
+			{{"_id", primitive.NewObjectID()}, {"n", int32(1)}, {"l", int64(1 << 40)}, {"f", 1.5}},
+			{{"s", "text"}, {"d", primitive.NewDateTimeFromTime(time.Unix(1600000000, 0))},
+				{"sub", bson.D{{"a", bson.A{1, "two", nil}}}}, {"dec", primitive.NewDecimal128(0, 5)}},
+		}
+		for _, format := range []JSONFormat{Relaxed, Canonical} {
+			for _, mode := range []struct{ array, pretty bool }{{false, false}, {true, false}, {false, true}, {true, true}} {
+				decodedOut, rawOut := &bytes.Buffer{}, &bytes.Buffer{}
+				decoded := NewJSONExportOutput(mode.array, mode.pretty, decodedOut, format)
+				raw := NewJSONExportOutput(mode.array, mode.pretty, rawOut, format)
+				So(decoded.WriteHeader(), ShouldBeNil)
+				So(raw.WriteHeader(), ShouldBeNil)
+				for _, doc := range docs {
+					rawDoc, err := bson.Marshal(doc)
+					So(err, ShouldBeNil)
+					So(decoded.ExportDocument(doc), ShouldBeNil)
+					So(raw.ExportRawDocument(rawDoc), ShouldBeNil)
+				}
+				So(decoded.WriteFooter(), ShouldBeNil)
+				So(raw.WriteFooter(), ShouldBeNil)
+				So(rawOut.String(), ShouldEqual, decodedOut.String())
+			}
+		}
+	})
+
+	Convey("Raw documents should be decoded for outputs that cannot write them", t, func() {
+		out := &bytes.Buffer{}
+		rawDoc, err := bson.Marshal(bson.D{{"a", int32(1)}, {"b", "x"}})
+		So(err, ShouldBeNil)
+		csvExporter := NewCSVExportOutput([]string{"a", "b"}, true, out)
+		So(exportRawDocument(csvExporter, rawDoc), ShouldBeNil)
+		So(csvExporter.Flush(), ShouldBeNil)
+		So(out.String(), ShouldEqual, "1,x\n")
+	})
+}
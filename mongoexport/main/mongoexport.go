@@ -10,6 +10,9 @@ package main
 import (
 	"os"
 
+	"github.com/mongodb/mongo-tools/common/completion"
+	"github.com/mongodb/mongo-tools/common/exitcode"
+	"github.com/mongodb/mongo-tools/common/healthcheck"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/signals"
 	"github.com/mongodb/mongo-tools/common/util"
@@ -26,10 +29,14 @@ func main() {
 	if err != nil {
 		log.Logvf(log.Always, "error parsing command line options: %v", err)
 		log.Logvf(log.Always, util.ShortUsage("mongoexport"))
-		os.Exit(util.ExitFailure)
+		os.Exit(util.ExitValidationFailure)
 	}
 
-	signals.Handle()
+	// with --follow, the first interrupt stops following changes once the
+	// exporter is set up, rather than exiting
+	if !opts.Follow {
+		signals.Handle()
+	}
 
 	// print help, if specified
 	if opts.PrintHelp(false) {
@@ -41,6 +48,21 @@ func main() {
 		return
 	}
 
+	// print the effective config, if specified
+	if opts.PrintEffectiveConfig() {
+		return
+	}
+
+	// generate shell completions, if requested
+	if _, ok := opts.CompletionArgs(); ok {
+		os.Exit(completion.Main(opts.ToolOptions))
+	}
+
+	// check the connection, credentials and privileges without running
+	if opts.HealthCheck {
+		os.Exit(healthcheck.Main(*opts.ToolOptions, opts.HealthCheckRequirements()))
+	}
+
 	exporter, err := mongoexport.New(opts)
 	if err != nil {
 		log.Logvf(log.Always, "%v", err)
@@ -49,10 +71,15 @@ func main() {
 			log.Logv(log.Always, se.Message)
 		}
 
-		os.Exit(util.ExitFailure)
+		os.Exit(exitcode.Of(err))
 	}
 	defer exporter.Close()
 
+	if opts.Follow {
+		finishedChan := signals.HandleWithInterrupt(exporter.HandleInterrupt)
+		defer close(finishedChan)
+	}
+
 	writer, err := exporter.GetOutputWriter()
 	if err != nil {
 		log.Logvf(log.Always, "error opening output stream: %v", err)
@@ -67,7 +94,11 @@ func main() {
 	numDocs, err := exporter.Export(writer)
 	if err != nil {
 		log.Logvf(log.Always, "Failed: %v", err)
-		os.Exit(util.ExitFailure)
+		// some records may already have been written
+		if numDocs > 0 {
+			err = exitcode.Partial(err)
+		}
+		os.Exit(exitcode.Of(err))
 	}
 
 	if numDocs == 1 {
@@ -0,0 +1,180 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Ways of masking a field accepted by --maskFields.
+const (
+	maskRedact = "redact"
+	maskHash   = "hash"
+	maskLast4  = "last4"
+)
+
+// redactedValue replaces the values of fields masked with maskRedact.
+const redactedValue = "REDACTED"
+
+// maskedField is a field to mask and how to mask it.
+type maskedField struct {
+	path []string
+	mode string
+}
+
+// fieldMasker masks the values of fields in exported documents.
+type fieldMasker struct {
+	fields []maskedField
+	key    []byte
+}
+
+// newFieldMasker parses a --maskFields argument, a comma-separated list of
+// <field>[:<mode>] where mode is redact (the default), hash or last4. The key
+// is required if any field is hashed.
+func newFieldMasker(arg string, key string) (*fieldMasker, error) {
+	masker := &fieldMasker{key: []byte(key)}
+	seen := map[string]bool{}
+	for _, spec := range strings.Split(arg, ",") {
+		field, mode := strings.TrimSpace(spec), maskRedact
+		if i := strings.LastIndex(field, ":"); i >= 0 {
+			field, mode = field[:i], field[i+1:]
+		}
+		if field == "" || strings.HasPrefix(field, "$") || strings.HasPrefix(field, ".") ||
+			strings.HasSuffix(field, ".") || strings.Contains(field, "..") {
+			return nil, fmt.Errorf("invalid field '%v'", field)
+		}
+		switch mode {
+		case maskRedact, maskLast4:
+		case maskHash:
+			if key == "" {
+				return nil, fmt.Errorf("field '%v' is hashed, which requires --maskKey or --maskKeySource", field)
+			}
+		default:
+			return nil, fmt.Errorf("unknown mask '%v' for field '%v', must be one of: %v, %v, %v",
+				mode, field, maskRedact, maskHash, maskLast4)
+		}
+		if seen[field] {
+			return nil, fmt.Errorf("field '%v' is listed more than once", field)
+		}
+		seen[field] = true
+		masker.fields = append(masker.fields, maskedField{path: strings.Split(field, "."), mode: mode})
+	}
+	return masker, nil
+}
+
+// mask returns a copy of document with the masked fields replaced. Fields
+// inside arrays of documents are masked in every element, and an array
+// value is masked element by element.
+func (m *fieldMasker) mask(document bson.D) bson.D {
+	out := copyDocument(document)
+	for _, field := range m.fields {
+		m.maskPath(out, field.path, field.mode)
+	}
+	return out
+}
+
+func (m *fieldMasker) maskPath(document bson.D, path []string, mode string) {
+	for i := range document {
+		if document[i].Key != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			document[i].Value = m.maskValue(document[i].Value, mode)
+		} else {
+			document[i].Value = m.maskNested(document[i].Value, path[1:], mode)
+		}
+	}
+}
+
+func (m *fieldMasker) maskNested(value interface{}, path []string, mode string) interface{} {
+	switch v := value.(type) {
+	case bson.D:
+		m.maskPath(v, path, mode)
+	case bson.A:
+		for i := range v {
+			v[i] = m.maskNested(v[i], path, mode)
+		}
+	}
+	return value
+}
+
+func (m *fieldMasker) maskValue(value interface{}, mode string) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case bson.A:
+		for i := range v {
+			v[i] = m.maskValue(v[i], mode)
+		}
+		return v
+	}
+
+	switch mode {
+	case maskHash:
+		// strings are hashed as they are so that the same value hashes the
+		// same wherever it is exported from; other values are hashed along
+		// with their type
+		data := []byte(nil)
+		if s, ok := value.(string); ok {
+			data = []byte(s)
+		} else {
+			var err error
+			if data, err = bson.MarshalExtJSON(bson.D{{Key: "v", Value: value}}, true, false); err != nil {
+				return redactedValue
+			}
+		}
+		mac := hmac.New(sha256.New, m.key)
+		mac.Write(data)
+		return hex.EncodeToString(mac.Sum(nil))
+	case maskLast4:
+		var s string
+		switch v := value.(type) {
+		case string:
+			s = v
+		case int32, int64, float64:
+			s = fmt.Sprint(v)
+		default:
+			return redactedValue
+		}
+		runes := []rune(s)
+		if len(runes) <= 4 {
+			return strings.Repeat("*", len(runes))
+		}
+		return strings.Repeat("*", len(runes)-4) + string(runes[len(runes)-4:])
+	}
+	return redactedValue
+}
+
+// copyDocument returns a deep copy of the documents and arrays in document,
+// so that masking does not modify the original.
+func copyDocument(document bson.D) bson.D {
+	out := make(bson.D, len(document))
+	for i, elem := range document {
+		out[i] = bson.E{Key: elem.Key, Value: copyValue(elem.Value)}
+	}
+	return out
+}
+
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bson.D:
+		return copyDocument(v)
+	case bson.A:
+		out := make(bson.A, len(v))
+		for i := range v {
+			out[i] = copyValue(v[i])
+		}
+		return out
+	}
+	return value
+}
@@ -0,0 +1,123 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"os"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestNewFieldMasker(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Mask specifications should be parsed", t, func() {
+		masker, err := newFieldMasker("ssn,email:hash,contact.phone:last4", "secret")
+		So(err, ShouldBeNil)
+		So(masker.fields, ShouldResemble, []maskedField{
+			{path: []string{"ssn"}, mode: maskRedact},
+			{path: []string{"email"}, mode: maskHash},
+			{path: []string{"contact", "phone"}, mode: maskLast4},
+		})
+	})
+
+	Convey("Invalid mask specifications should be rejected", t, func() {
+		for _, arg := range []string{"", "a,,b", "a:scramble", "$a", "a..b", "a,a:hash"} {
+			_, err := newFieldMasker(arg, "secret")
+			So(err, ShouldNotBeNil)
+		}
+		_, err := newFieldMasker("email:hash", "")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestFieldMasker(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a field masker", t, func() {
+		masker, err := newFieldMasker("ssn,email:hash,phone:last4,contacts.email:hash,tags:last4", "secret")
+		So(err, ShouldBeNil)
+
+		document := bson.D{
+			{Key: "_id", Value: int32(1)},
+			{Key: "ssn", Value: "123-45-6789"},
+			{Key: "email", Value: "a@example.com"},
+			{Key: "phone", Value: "+15551234567"},
+			{Key: "contacts", Value: bson.A{
+				bson.D{{Key: "email", Value: "a@example.com"}},
+				bson.D{{Key: "email", Value: nil}},
+			}},
+			{Key: "tags", Value: bson.A{"abc", "abcdef"}},
+		}
+		masked := masker.mask(document)
+
+		Convey("fields should be redacted, hashed and partially masked", func() {
+			So(masked[0].Value, ShouldEqual, int32(1))
+			So(masked[1].Value, ShouldEqual, redactedValue)
+			So(masked[2].Value, ShouldHaveLength, 64)
+			So(masked[2].Value, ShouldNotContainSubstring, "example")
+			So(masked[3].Value, ShouldEqual, "********4567")
+		})
+
+		Convey("fields in arrays should be masked element by element", func() {
+			contacts := masked[4].Value.(bson.A)
+			So(contacts[0].(bson.D)[0].Value, ShouldEqual, masked[2].Value)
+			So(contacts[1].(bson.D)[0].Value, ShouldBeNil)
+			So(masked[5].Value, ShouldResemble, bson.A{"***", "**cdef"})
+		})
+
+		Convey("the original document should not be modified", func() {
+			So(document[1].Value, ShouldEqual, "123-45-6789")
+			So(document[4].Value.(bson.A)[0].(bson.D)[0].Value, ShouldEqual, "a@example.com")
+		})
+
+		Convey("hashes should depend on the key", func() {
+			other, err := newFieldMasker("email:hash", "other")
+			So(err, ShouldBeNil)
+			So(other.mask(document)[2].Value, ShouldNotEqual, masked[2].Value)
+		})
+	})
+}
+
+func TestValidateMaskSettings(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	newExport := func() *MongoExport {
+		return &MongoExport{
+			ToolOptions: &options.ToolOptions{Namespace: &options.Namespace{DB: "test", Collection: "users"}},
+			OutputOpts:  &OutputFormatOptions{Type: JSON, JSONFormat: Relaxed},
+			InputOpts:   &InputOptions{},
+		}
+	}
+
+	Convey("The mask key may be read from an external source", t, func() {
+		os.Setenv("MONGOEXPORT_TEST_MASK_KEY", "secret")
+		defer os.Unsetenv("MONGOEXPORT_TEST_MASK_KEY")
+
+		exp := newExport()
+		exp.OutputOpts.MaskFields = "email:hash"
+		exp.OutputOpts.MaskKeySource = "env:MONGOEXPORT_TEST_MASK_KEY"
+		So(exp.validateSettings(), ShouldBeNil)
+		So(string(exp.masker.key), ShouldEqual, "secret")
+
+		exp = newExport()
+		exp.OutputOpts.MaskFields = "email:hash"
+		exp.OutputOpts.MaskKey = "secret"
+		exp.OutputOpts.MaskKeySource = "env:MONGOEXPORT_TEST_MASK_KEY"
+		So(exp.validateSettings(), ShouldNotBeNil)
+	})
+
+	Convey("A mask key should require --maskFields", t, func() {
+		exp := newExport()
+		exp.OutputOpts.MaskKey = "secret"
+		So(exp.validateSettings(), ShouldNotBeNil)
+	})
+}
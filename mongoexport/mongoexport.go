@@ -8,23 +8,30 @@
 package mongoexport
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/mongodb/mongo-tools/common/bsonutil"
 	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/exitcode"
 	"github.com/mongodb/mongo-tools/common/json"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/password"
 	"github.com/mongodb/mongo-tools/common/progress"
 	"github.com/mongodb/mongo-tools/common/util"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	mopt "go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
@@ -32,6 +39,7 @@ import (
 const (
 	CSV                            = "csv"
 	JSON                           = "json"
+	AVRO                           = "avro"
 	watchProgressorUpdateFrequency = 8000
 )
 
@@ -69,6 +77,37 @@ type MongoExport struct {
 
 	// Cached version of the collection info
 	collInfo *db.CollectionInfo
+
+	// Cached result of checking for the MMAPv1 storage engine, see usesMMAPV1
+	isMMAPV1 *bool
+
+	// read concern requested with --readConcern, and for snapshot reads,
+	// the cluster time that every read is pinned to
+	readConcern   *readconcern.ReadConcern
+	atClusterTime primitive.Timestamp
+
+	// limits on the size of each part file, if the output is split
+	splitSize int64
+	splitDocs int64
+
+	// masks applied to each exported document, if --maskFields is set
+	masker *fieldMasker
+
+	// unwinds arrays into one record per element, if --unwind is set
+	unwinder *unwinder
+
+	// formats each document, if --template is set
+	template *template.Template
+
+	// schema of Avro exports and its JSON, if --avroSchema is set or once
+	// the schema shared by the parts of a split export is inferred
+	avroSchema         *avroType
+	avroSchemaJSON     []byte
+	avroSchemaInferred bool
+
+	// cancelled by an interrupt to stop following changes with --follow
+	followCtx     context.Context
+	stopFollowing context.CancelFunc
 }
 
 // ExportOutput is an interface that specifies how a document should be formatted
@@ -90,6 +129,25 @@ type ExportOutput interface {
 	Flush() error
 }
 
+// rawExportOutput is implemented by an ExportOutput that can write documents
+// straight from the raw BSON returned by the server, without decoding them.
+type rawExportOutput interface {
+	ExportRawDocument(bson.Raw) error
+}
+
+// exportRawDocument writes the raw document to output, decoding it first only
+// if output cannot write raw documents.
+func exportRawDocument(output ExportOutput, document bson.Raw) error {
+	if raw, ok := output.(rawExportOutput); ok {
+		return raw.ExportRawDocument(document)
+	}
+	var decoded bson.D
+	if err := bson.Unmarshal(document, &decoded); err != nil {
+		return err
+	}
+	return output.ExportDocument(decoded)
+}
+
 // New constructs a new MongoExport instance from the provided options.
 func New(opts Options) (*MongoExport, error) {
 	exporter := &MongoExport{
@@ -101,7 +159,7 @@ func New(opts Options) (*MongoExport, error) {
 	err := exporter.validateSettings()
 	if err != nil {
 		return nil, util.SetupError{
-			Err:     err,
+			Err:     exitcode.Validation(err),
 			Message: util.ShortUsage("mongoexport"),
 		}
 	}
@@ -130,6 +188,7 @@ func New(opts Options) (*MongoExport, error) {
 
 	exporter.SessionProvider = provider
 	exporter.ProgressManager = progressManager
+	exporter.followCtx, exporter.stopFollowing = context.WithCancel(context.Background())
 	return exporter, nil
 }
 
@@ -172,8 +231,8 @@ func (exp *MongoExport) validateSettings() error {
 		// special error for an empty type value
 		return fmt.Errorf("--type cannot be empty")
 	}
-	if exp.OutputOpts.Type != CSV && exp.OutputOpts.Type != JSON {
-		return fmt.Errorf("invalid output type '%v', choose 'json' or 'csv'", exp.OutputOpts.Type)
+	if exp.OutputOpts.Type != CSV && exp.OutputOpts.Type != JSON && exp.OutputOpts.Type != AVRO {
+		return fmt.Errorf("invalid output type '%v', choose 'json', 'csv' or 'avro'", exp.OutputOpts.Type)
 	}
 
 	if exp.OutputOpts.JSONFormat != Canonical && exp.OutputOpts.JSONFormat != Relaxed {
@@ -184,6 +243,10 @@ func (exp *MongoExport) validateSettings() error {
 		return fmt.Errorf("cannot use --forceTableScan when specifying --query")
 	}
 
+	if exp.InputOpts.RequireIndexed && exp.InputOpts.ForceTableScan {
+		return fmt.Errorf("cannot use --requireIndexed with --forceTableScan")
+	}
+
 	if exp.InputOpts.Query != "" && exp.InputOpts.QueryFile != "" {
 		return fmt.Errorf("either --query or --queryFile can be specified as a query option")
 	}
@@ -205,13 +268,132 @@ func (exp *MongoExport) validateSettings() error {
 			return err
 		}
 	}
+
+	if exp.InputOpts != nil && exp.InputOpts.ReadConcern != "" {
+		exp.readConcern, err = getReadConcernFromArg(exp.InputOpts.ReadConcern)
+		if err != nil {
+			return err
+		}
+	}
+
+	if exp.InputOpts != nil && exp.InputOpts.AtClusterTime != "" {
+		if !exp.isSnapshotRead() {
+			return fmt.Errorf("--atClusterTime can only be used with --readConcern snapshot")
+		}
+		exp.atClusterTime, err = util.ParseTimestampFlag(exp.InputOpts.AtClusterTime)
+		if err != nil {
+			return fmt.Errorf("error parsing --atClusterTime: %v", err)
+		}
+	}
+
+	if exp.OutputOpts.SplitSize != "" {
+		if exp.splitSize, err = parseSize(exp.OutputOpts.SplitSize); err != nil {
+			return fmt.Errorf("error parsing --splitSize: %v", err)
+		}
+	}
+	if exp.OutputOpts.SplitDocs != "" {
+		if exp.splitDocs, err = parseCount(exp.OutputOpts.SplitDocs); err != nil {
+			return fmt.Errorf("error parsing --splitDocs: %v", err)
+		}
+	}
+	if exp.isSplit() && exp.OutputOpts.OutputFile == "" {
+		return fmt.Errorf("--splitSize and --splitDocs require --out")
+	}
+
+	if len(exp.OutputOpts.Unwind) > 0 {
+		if exp.unwinder, err = newUnwinder(exp.OutputOpts.Unwind); err != nil {
+			return fmt.Errorf("error parsing --unwind: %v", err)
+		}
+	}
+
+	if exp.OutputOpts.Template != "" {
+		switch {
+		case exp.OutputOpts.Type != JSON:
+			return fmt.Errorf("--template cannot be used with --type=%v", exp.OutputOpts.Type)
+		case exp.OutputOpts.JSONArray || exp.OutputOpts.Pretty:
+			return fmt.Errorf("--template cannot be used with --jsonArray or --pretty")
+		}
+		if exp.template, err = ParseTemplate(exp.OutputOpts.Template); err != nil {
+			return fmt.Errorf("error parsing --template: %v", err)
+		}
+	}
+
+	if exp.OutputOpts.Type == AVRO {
+		if exp.OutputOpts.JSONArray || exp.OutputOpts.Pretty {
+			return fmt.Errorf("--type=avro cannot be used with --jsonArray or --pretty")
+		}
+		if exp.OutputOpts.AvroSchema != "" {
+			if exp.avroSchema, exp.avroSchemaJSON, err = ReadAvroSchema(exp.OutputOpts.AvroSchema); err != nil {
+				return fmt.Errorf("error reading --avroSchema: %v", err)
+			}
+		}
+	} else if exp.OutputOpts.AvroSchema != "" {
+		return fmt.Errorf("--avroSchema can only be used with --type=avro")
+	}
+
+	if err = exp.validateMaskSettings(); err != nil {
+		return err
+	}
+	return exp.validateFollowSettings()
+}
+
+// validateMaskSettings parses --maskFields, resolving the key for hashed
+// fields from --maskKey or --maskKeySource.
+func (exp *MongoExport) validateMaskSettings() error {
+	key := exp.OutputOpts.MaskKey
+	if exp.OutputOpts.MaskKeySource != "" {
+		if key != "" {
+			return fmt.Errorf("illegal argument combination: cannot specify --maskKey and --maskKeySource")
+		}
+		var err error
+		if key, err = password.FromSource(exp.OutputOpts.MaskKeySource); err != nil {
+			return fmt.Errorf("error reading --maskKeySource: %v", err)
+		}
+	}
+	if exp.OutputOpts.MaskFields == "" {
+		if key != "" {
+			return fmt.Errorf("--maskKey and --maskKeySource require --maskFields")
+		}
+		return nil
+	}
+
+	var err error
+	if exp.masker, err = newFieldMasker(exp.OutputOpts.MaskFields, key); err != nil {
+		return fmt.Errorf("error parsing --maskFields: %v", err)
+	}
+	return nil
+}
+
+// isSplit returns true if the output is split into numbered part files.
+func (exp *MongoExport) isSplit() bool {
+	return exp.splitSize > 0 || exp.splitDocs > 0
+}
+
+// isSnapshotRead returns true if the export reads from a single point in time.
+func (exp *MongoExport) isSnapshotRead() bool {
+	return exp.readConcern != nil && exp.readConcern.GetLevel() == "snapshot"
+}
+
+// pinClusterTime chooses the cluster time that snapshot reads are pinned to,
+// if the user did not provide one.
+func (exp *MongoExport) pinClusterTime() error {
+	if !exp.isSnapshotRead() || exp.atClusterTime.T != 0 || exp.atClusterTime.I != 0 {
+		return nil
+	}
+	clusterTime, err := exp.SessionProvider.ClusterTime()
+	if err != nil {
+		return fmt.Errorf("error determining cluster time for snapshot read: %v", err)
+	}
+	exp.atClusterTime = clusterTime
+	log.Logvf(log.Always, "reading snapshot at cluster time %v:%v", clusterTime.T, clusterTime.I)
 	return nil
 }
 
 // GetOutputWriter opens and returns an io.WriteCloser for the output
 // options or nil if none is set. The caller is responsible for closing it.
+// A split export opens its own part files, so no writer is returned for it.
 func (exp *MongoExport) GetOutputWriter() (io.WriteCloser, error) {
-	if exp.OutputOpts.OutputFile != "" {
+	if exp.OutputOpts.OutputFile != "" && !exp.isSplit() {
 		// If the directory in which the output file is to be
 		// written does not exist, create it
 		fileDir := filepath.Dir(exp.OutputOpts.OutputFile)
@@ -220,7 +402,19 @@ func (exp *MongoExport) GetOutputWriter() (io.WriteCloser, error) {
 			return nil, err
 		}
 
-		file, err := os.Create(util.ToUniversalPath(exp.OutputOpts.OutputFile))
+		// resuming --follow appends to the changes written before, since the
+		// initial export is not repeated
+		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if exp.InputOpts != nil && exp.InputOpts.Follow {
+			resumeToken, err := exp.readResumeToken()
+			if err != nil {
+				return nil, err
+			}
+			if resumeToken != nil {
+				flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+			}
+		}
+		file, err := os.OpenFile(util.ToUniversalPath(exp.OutputOpts.OutputFile), flags, 0666)
 		if err != nil {
 			return nil, err
 		}
@@ -297,12 +491,31 @@ func (exp *MongoExport) getCount() (int64, error) {
 // to export, based on the options given to mongoexport. Also returns the
 // associated session, so that it can be closed once the cursor is used up.
 func (exp *MongoExport) getCursor() (*mongo.Cursor, error) {
+	coll, query, findOpts, err := exp.getFind()
+	if err != nil {
+		return nil, err
+	}
+
+	if exp.isSnapshotRead() {
+		return runSnapshotFind(coll, query, findOpts, exp.atClusterTime)
+	}
+	if exp.readConcern != nil {
+		coll = coll.Database().Collection(coll.Name(),
+			mopt.Collection().SetReadConcern(exp.readConcern))
+	}
+
+	return coll.Find(nil, query, findOpts)
+}
+
+// getFind returns the collection, query and options of the find that reads
+// the documents to export, based on the options given to mongoexport.
+func (exp *MongoExport) getFind() (*mongo.Collection, bson.D, *mopt.FindOptions, error) {
 	findOpts := mopt.Find()
 
 	if exp.InputOpts != nil && exp.InputOpts.Sort != "" {
 		sortD, err := getSortFromArg(exp.InputOpts.Sort)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
 
 		findOpts.SetSort(sortD)
@@ -313,32 +526,20 @@ func (exp *MongoExport) getCursor() (*mongo.Cursor, error) {
 		var err error
 		content, err := exp.InputOpts.GetQuery()
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
 		err = bson.UnmarshalExtJSON(content, false, &query)
 		if err != nil {
-			return nil, fmt.Errorf("error parsing query as Extended JSON: %v", err)
+			return nil, nil, nil, fmt.Errorf("error parsing query as Extended JSON: %v", err)
 		}
 	}
 
 	session, err := exp.SessionProvider.GetSession()
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 	intendedDB := session.Database(exp.ToolOptions.Namespace.DB)
-	isMMAPV1, err := db.IsMMAPV1(intendedDB, exp.ToolOptions.Namespace.Collection)
-	if err != nil {
-		// if we failed to determine storage engine, there is a good change it is because this
-		// collection is a view. We only want to warn if this collection is not a view, since
-		// storage engine does not affect consistency for scans of views.
-		collection := intendedDB.Collection(exp.ToolOptions.Namespace.Collection)
-		collectionInfo, err := db.GetCollectionInfo(collection)
-		if err != nil || !collectionInfo.IsView() {
-			log.Logvf(log.Always,
-				"failed to determine storage engine, an mmapv1 storage engine could"+
-					" result in inconsistent export results, error was: %v", err)
-		}
-	}
+	isMMAPV1 := exp.usesMMAPV1(intendedDB)
 	// shouldHintId is true iff the storage engine is MMAPV1 and the user did not specify
 	// --forceTableScan.
 	shouldHintId := isMMAPV1 && (exp.InputOpts == nil || !exp.InputOpts.ForceTableScan)
@@ -366,11 +567,80 @@ func (exp *MongoExport) getCursor() (*mongo.Cursor, error) {
 		findOpts.SetLimit(exp.InputOpts.Limit)
 	}
 
-	if len(exp.OutputOpts.Fields) > 0 {
-		findOpts.SetProjection(makeFieldSelector(exp.OutputOpts.Fields))
+	fields, err := exp.projectedFields()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(fields) > 0 {
+		findOpts.SetProjection(makeFieldSelector(strings.Join(fields, ",")))
 	}
 
-	return coll.Find(nil, query, findOpts)
+	return coll, query, findOpts, nil
+}
+
+// usesMMAPV1 returns true if the collection to export uses the MMAPv1 storage
+// engine. The storage engine is only checked the first time, as each export
+// may build its find more than once.
+func (exp *MongoExport) usesMMAPV1(intendedDB *mongo.Database) bool {
+	if exp.isMMAPV1 != nil {
+		return *exp.isMMAPV1
+	}
+	isMMAPV1, err := db.IsMMAPV1(intendedDB, exp.ToolOptions.Namespace.Collection)
+	if err != nil {
+		// if we failed to determine storage engine, there is a good change it is because this
+		// collection is a view. We only want to warn if this collection is not a view, since
+		// storage engine does not affect consistency for scans of views.
+		collection := intendedDB.Collection(exp.ToolOptions.Namespace.Collection)
+		collectionInfo, err := db.GetCollectionInfo(collection)
+		if err != nil || !collectionInfo.IsView() {
+			log.Logvf(log.Always,
+				"failed to determine storage engine, an mmapv1 storage engine could"+
+					" result in inconsistent export results, error was: %v", err)
+		}
+	}
+	exp.isMMAPV1 = &isMMAPV1
+	return isMMAPV1
+}
+
+// runSnapshotFind issues a find command equivalent to coll.Find(query, findOpts)
+// with a snapshot read concern pinned at atClusterTime. The driver cannot set
+// atClusterTime on a find, so the command is built by hand.
+func runSnapshotFind(coll *mongo.Collection, query bson.D, findOpts *mopt.FindOptions, atClusterTime primitive.Timestamp) (*mongo.Cursor, error) {
+	cmd := append(findCommand(coll, query, findOpts), bson.E{"readConcern", bson.D{
+		{"level", "snapshot"},
+		{"atClusterTime", atClusterTime},
+	}})
+	return coll.Database().RunCommandCursor(nil, cmd)
+}
+
+// findCommand returns the find command equivalent to coll.Find(query, findOpts).
+func findCommand(coll *mongo.Collection, query bson.D, findOpts *mopt.FindOptions) bson.D {
+	cmd := bson.D{
+		{"find", coll.Name()},
+		{"filter", query},
+	}
+	if findOpts.Sort != nil {
+		cmd = append(cmd, bson.E{"sort", findOpts.Sort})
+	}
+	if findOpts.Projection != nil {
+		cmd = append(cmd, bson.E{"projection", findOpts.Projection})
+	}
+	if findOpts.Hint != nil {
+		cmd = append(cmd, bson.E{"hint", findOpts.Hint})
+	}
+	if findOpts.Skip != nil && *findOpts.Skip > 0 {
+		cmd = append(cmd, bson.E{"skip", *findOpts.Skip})
+	}
+	if findOpts.Limit != nil && *findOpts.Limit != 0 {
+		limit := *findOpts.Limit
+		if limit < 0 {
+			// a negative limit asks for a single batch, as with Find
+			limit = -limit
+			cmd = append(cmd, bson.E{"singleBatch", true})
+		}
+		cmd = append(cmd, bson.E{"limit", limit})
+	}
+	return cmd
 }
 
 // verifyCollectionExists checks if the collection exists. If it does, a copy of the collection info will be cached
@@ -409,6 +679,10 @@ func (exp *MongoExport) exportInternal(out io.Writer) (int64, error) {
 		return 0, err
 	}
 
+	if err = exp.checkQueryPlan(); err != nil {
+		return 0, err
+	}
+
 	max, err := exp.getCount()
 	if err != nil {
 		return 0, err
@@ -425,12 +699,13 @@ func (exp *MongoExport) exportInternal(out io.Writer) (int64, error) {
 	if err != nil {
 		return 0, err
 	}
+	if closer, ok := exportOutput.(io.Closer); ok {
+		defer closer.Close()
+	}
 
-	cursor, err := exp.getCursor()
-	if err != nil {
+	if err = exp.pinClusterTime(); err != nil {
 		return 0, err
 	}
-	defer cursor.Close(nil)
 
 	// Write headers
 	err = exportOutput.WriteHeader()
@@ -438,36 +713,89 @@ func (exp *MongoExport) exportInternal(out io.Writer) (int64, error) {
 		return 0, err
 	}
 
-	docsCount := int64(0)
-
-	// Write document content
-	for cursor.Next(nil) {
-		var result bson.D
-		if err := cursor.Decode(&result); err != nil {
-			return docsCount, err
-		}
-
-		err := exportOutput.ExportDocument(result)
+	var recordsCount int64
+	if exp.InputOpts != nil && exp.InputOpts.Follow {
+		resumeToken, err := exp.readResumeToken()
 		if err != nil {
-			return docsCount, err
+			return 0, err
 		}
-		docsCount++
-		if docsCount%watchProgressorUpdateFrequency == 0 {
-			watchProgressor.Set(docsCount)
+		var startAt *primitive.Timestamp
+		if resumeToken != nil {
+			log.Logvf(log.Always, "resuming change stream from %v, skipping the initial export", exp.InputOpts.ResumeTokenFile)
+		} else {
+			if startAt, err = exp.followStartTime(); err != nil {
+				return 0, err
+			}
+			if recordsCount, err = exp.exportDocuments(exportOutput, watchProgressor); err != nil {
+				return recordsCount, err
+			}
 		}
-	}
-	watchProgressor.Set(docsCount)
-	if err := cursor.Err(); err != nil {
-		return docsCount, err
+		eventsCount, err := exp.follow(exportOutput, resumeToken, startAt)
+		recordsCount += eventsCount
+		if err != nil {
+			return recordsCount, err
+		}
+	} else if recordsCount, err = exp.exportDocuments(exportOutput, watchProgressor); err != nil {
+		return recordsCount, err
 	}
 
 	// Write footers
 	err = exportOutput.WriteFooter()
 	if err != nil {
-		return docsCount, err
+		return recordsCount, err
 	}
 	exportOutput.Flush()
-	return docsCount, nil
+	return recordsCount, nil
+}
+
+// exportDocuments writes the documents to export to exportOutput, and returns
+// the number of records written.
+func (exp *MongoExport) exportDocuments(exportOutput ExportOutput, watchProgressor *progress.CountProgressor) (int64, error) {
+	cursor, err := exp.getCursor()
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(nil)
+
+	// docsCount is the number of documents read, and recordsCount the number
+	// of records written, which differ if arrays are unwound.
+	docsCount := int64(0)
+	recordsCount := int64(0)
+
+	// Write document content. Documents are written straight from the
+	// cursor's raw BSON unless they must be decoded to be unwound or masked.
+	for cursor.Next(nil) {
+		if exp.masker == nil && exp.unwinder == nil {
+			if err = exportRawDocument(exportOutput, cursor.Current); err != nil {
+				return recordsCount, err
+			}
+			recordsCount++
+		} else {
+			var result bson.D
+			if err = cursor.Decode(&result); err != nil {
+				return recordsCount, err
+			}
+			records := []bson.D{result}
+			if exp.unwinder != nil {
+				records = exp.unwinder.unwind(result)
+			}
+			for _, record := range records {
+				if exp.masker != nil {
+					record = exp.masker.mask(record)
+				}
+				if err = exportOutput.ExportDocument(record); err != nil {
+					return recordsCount, err
+				}
+				recordsCount++
+			}
+		}
+		docsCount++
+		if docsCount%watchProgressorUpdateFrequency == 0 {
+			watchProgressor.Set(docsCount)
+		}
+	}
+	watchProgressor.Set(docsCount)
+	return recordsCount, cursor.Err()
 }
 
 // Export executes the entire export operation. It returns an integer of the count
@@ -480,20 +808,80 @@ func (exp *MongoExport) Export(out io.Writer) (int64, error) {
 
 // getExportOutput returns an implementation of ExportOutput which can handle
 // transforming BSON documents into the appropriate output format and writing
-// them to an output stream.
+// them to an output stream. A split export ignores out and writes to part
+// files named after --out instead.
 func (exp *MongoExport) getExportOutput(out io.Writer) (ExportOutput, error) {
+	if !exp.isSplit() {
+		return exp.newExportOutput(out)
+	}
+	// check the format options before any part file is created
+	if _, err := exp.newExportOutput(ioutil.Discard); err != nil {
+		return nil, err
+	}
+	split := &splitExportOutput{
+		newOutput:  exp.newExportOutput,
+		outputFile: exp.OutputOpts.OutputFile,
+		maxDocs:    exp.splitDocs,
+		maxBytes:   exp.splitSize,
+		manifest: splitManifest{
+			Namespace: exp.ToolOptions.Namespace.String(),
+			Type:      exp.outputType(),
+		},
+	}
+	if exp.outputType() == AVRO && exp.avroSchema == nil {
+		// infer the schema once, from the first documents of the export, and
+		// write every part with it
+		return &avroInferringOutput{
+			next: split,
+			name: avroName(exp.ToolOptions.Namespace.Collection),
+			setSchema: func(schema *avroType, schemaJSON []byte) {
+				exp.avroSchema, exp.avroSchemaJSON, exp.avroSchemaInferred = schema, schemaJSON, true
+			},
+		}, nil
+	}
+	return split, nil
+}
+
+// outputType returns the output format: json, csv or, with --template,
+// template.
+func (exp *MongoExport) outputType() string {
+	if exp.template != nil {
+		return "template"
+	}
+	return exp.OutputOpts.Type
+}
+
+// projectedFields returns the fields the server should project documents to:
+// those given with --fields or, for CSV, with --fieldFile. It returns nil if
+// whole documents are exported.
+func (exp *MongoExport) projectedFields() ([]string, error) {
+	// TODO what if user specifies *both* --fields and --fieldFile?
+	switch {
+	case len(exp.OutputOpts.Fields) > 0:
+		return strings.Split(exp.OutputOpts.Fields, ","), nil
+	case exp.OutputOpts.Type == CSV && exp.OutputOpts.FieldFile != "":
+		return util.GetFieldsFromFile(exp.OutputOpts.FieldFile)
+	}
+	return nil, nil
+}
+
+// newExportOutput returns the ExportOutput for the output format, writing to
+// out.
+func (exp *MongoExport) newExportOutput(out io.Writer) (ExportOutput, error) {
+	if exp.template != nil {
+		return NewTemplateExportOutput(exp.template, out), nil
+	}
+	if exp.OutputOpts.Type == AVRO {
+		output := NewAvroExportOutput(exp.avroSchema, exp.avroSchemaJSON, exp.ToolOptions.Namespace.Collection, out)
+		output.inferred = output.inferred || exp.avroSchemaInferred
+		return output, nil
+	}
 	if exp.OutputOpts.Type == CSV {
-		// TODO what if user specifies *both* --fields and --fieldFile?
-		var fields []string
-		var err error
-		if len(exp.OutputOpts.Fields) > 0 {
-			fields = strings.Split(exp.OutputOpts.Fields, ",")
-		} else if exp.OutputOpts.FieldFile != "" {
-			fields, err = util.GetFieldsFromFile(exp.OutputOpts.FieldFile)
-			if err != nil {
-				return nil, err
-			}
-		} else {
+		fields, err := exp.projectedFields()
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) == 0 {
 			return nil, fmt.Errorf("CSV mode requires a field list")
 		}
 
@@ -529,6 +917,26 @@ func getObjectFromByteArg(queryRaw []byte) (map[string]interface{}, error) {
 	return parsedJSON, nil
 }
 
+// getReadConcernFromArg takes either a read concern level or a JSON object
+// with a level field, and returns the corresponding read concern.
+func getReadConcernFromArg(readConcernRaw string) (*readconcern.ReadConcern, error) {
+	level := readConcernRaw
+	if strings.HasPrefix(strings.TrimSpace(readConcernRaw), "{") {
+		parsed := struct {
+			Level string `json:"level"`
+		}{}
+		if err := json.Unmarshal([]byte(readConcernRaw), &parsed); err != nil {
+			return nil, fmt.Errorf("read concern '%v' is not valid JSON: %v", readConcernRaw, err)
+		}
+		level = parsed.Level
+	}
+	switch level {
+	case "local", "available", "majority", "linearizable", "snapshot":
+		return readconcern.New(readconcern.Level(level)), nil
+	}
+	return nil, fmt.Errorf("invalid read concern level '%v'", level)
+}
+
 // getSortFromArg takes a sort specification in JSON and returns it as a bson.D
 // object which preserves the ordering of the keys as they appear in the input.
 func getSortFromArg(queryRaw string) (bson.D, error) {
@@ -107,6 +107,25 @@ func TestFieldSelect(t *testing.T) {
 	})
 }
 
+func TestReadConcernArg(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Using getReadConcernFromArg should parse levels and JSON objects", t, func() {
+		rc, err := getReadConcernFromArg("majority")
+		So(err, ShouldBeNil)
+		So(rc.GetLevel(), ShouldEqual, "majority")
+
+		rc, err = getReadConcernFromArg(`{level: "snapshot"}`)
+		So(err, ShouldBeNil)
+		So(rc.GetLevel(), ShouldEqual, "snapshot")
+
+		_, err = getReadConcernFromArg("eventual")
+		So(err, ShouldNotBeNil)
+		_, err = getReadConcernFromArg("{level:")
+		So(err, ShouldNotBeNil)
+	})
+}
+
 // Test exporting a collection with autoIndexId:false.  As of MongoDB 4.0,
 // this is only allowed on the 'local' database.
 func TestMongoExportTOOLS2174(t *testing.T) {
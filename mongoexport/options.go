@@ -11,6 +11,7 @@ import (
 	"io/ioutil"
 
 	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/healthcheck"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 )
@@ -32,7 +33,7 @@ type OutputFormatOptions struct {
 	FieldFile string `long:"fieldFile" value-name:"<filename>" description:"file with field names - 1 per line"`
 
 	// Type selects the type of output to export as (json or csv).
-	Type string `long:"type" value-name:"<type>" default:"json" default-mask:"-" description:"the output format, either json or csv"`
+	Type string `long:"type" value-name:"<type>" default:"json" default-mask:"-" description:"the output format, either json, csv or avro"`
 
 	// Deprecated: allow legacy --csv option in place of --type=csv
 	CSVOutputType bool `long:"csv" hidden:"true"`
@@ -49,6 +50,30 @@ type OutputFormatOptions struct {
 	// NoHeaderLine, if set, will export CSV data without a list of field names at the first line.
 	NoHeaderLine bool `long:"noHeaderLine" description:"export CSV data without a list of field names at the first line"`
 
+	// SplitSize, if set, splits the output into numbered part files of about this many bytes.
+	SplitSize string `long:"splitSize" value-name:"<size>" description:"split the output into sequentially numbered part files of about this size, e.g. 512MB or 1GB, and write a manifest listing the parts; requires --out"`
+
+	// SplitDocs, if set, splits the output into numbered part files of at most this many documents.
+	SplitDocs string `long:"splitDocs" value-name:"<count>" description:"split the output into sequentially numbered part files of at most this many documents, e.g. 10_000_000, and write a manifest listing the parts; requires --out"`
+
+	// MaskFields lists fields whose values are redacted, hashed or partially masked in the output.
+	MaskFields string `long:"maskFields" value-name:"<field>[:<mode>][,<field>[:<mode>]]*" description:"comma separated list of fields to mask in the output, e.g. 'ssn,email:hash,phone:last4'. Modes are redact (the default), which replaces the value with 'REDACTED', hash, which replaces it with a keyed HMAC-SHA256 of the value so that equal values can still be matched, and last4, which replaces all but the last 4 characters with '*'"`
+
+	// MaskKey is the key for hashed fields in --maskFields.
+	MaskKey string `long:"maskKey" value-name:"<key>" description:"the secret key for fields masked with hash"`
+
+	// MaskKeySource is an external source for the key for hashed fields in --maskFields.
+	MaskKeySource string `long:"maskKeySource" value-name:"<source>" description:"read the secret key for fields masked with hash from env:<VAR>, vault://<path>[#<field>] or awssm://<secret-id>[#<field>]"`
+
+	// Unwind lists array fields that are output as one record per element.
+	Unwind []string `long:"unwind" value-name:"<field>" description:"output one record for each element of the array at the given field, repeating the document's other fields, e.g. to export nested arrays as CSV rows. A document whose array is empty is output once without the field. May be repeated to unwind several arrays, including arrays inside the elements of a previously unwound array"`
+
+	// AvroSchema is the schema of Avro exports, inferred from the first documents if not given.
+	AvroSchema string `long:"avroSchema" value-name:"<filename>" description:"with --type=avro, the Avro schema (.avsc) to write documents with; if not given, a schema is inferred from the first 1000 documents. Fields are read from the BSON key in each field's \"bsonKey\" attribute, if any, or else from its name"`
+
+	// Template formats each document with a Go text/template instead of as JSON or CSV.
+	Template string `long:"template" value-name:"<template>" description:"format each document as a line with a Go text/template instead of as JSON or CSV, e.g. '{{._id}},{{.user.name}},{{.total | number | printf \"%.2f\"}}'. Documents are exposed as maps, dates as time values and ObjectIds as hex strings. Helper functions are date (e.g. {{date \"2006-01-02\" .created}}), unix, number, json, sql (an SQL literal), default, upper and lower"`
+
 	// JSONFormat specifies what extended JSON format to export (canonical or relaxed). Defaults to relaxed.
 	JSONFormat JSONFormat `long:"jsonFormat" value-name:"<type>" default:"relaxed" description:"the extended JSON format to output, either canonical or relaxed (defaults to 'relaxed')"`
 }
@@ -60,15 +85,20 @@ func (*OutputFormatOptions) Name() string {
 
 // InputOptions defines the set of options to use in retrieving data from the server.
 type InputOptions struct {
-	Query          string `long:"query" value-name:"<json>" short:"q" description:"query filter, as a JSON string, e.g., '{x:{$gt:1}}'"`
-	QueryFile      string `long:"queryFile" value-name:"<filename>" description:"path to a file containing a query filter (JSON)"`
-	SlaveOk        bool   `long:"slaveOk" short:"k" description:"allow secondary reads if available" default-mask:"-"`
-	ReadPreference string `long:"readPreference" value-name:"<string>|<json>" description:"specify either a preference mode (e.g. 'nearest') or a preference json object (e.g. '{mode: \"nearest\", tagSets: [{a: \"b\"}], maxStalenessSeconds: 123}')"`
-	ForceTableScan bool   `long:"forceTableScan" description:"force a table scan (do not use $snapshot or hint _id). Deprecated since this is default behavior on WiredTiger"`
-	Skip           int64  `long:"skip" value-name:"<count>" description:"number of documents to skip"`
-	Limit          int64  `long:"limit" value-name:"<count>" description:"limit the number of documents to export"`
-	Sort           string `long:"sort" value-name:"<json>" description:"sort order, as a JSON string, e.g. '{x:1}'"`
-	AssertExists   bool   `long:"assertExists" description:"if specified, export fails if the collection does not exist"`
+	Query           string `long:"query" value-name:"<json>" short:"q" description:"query filter, as a JSON string, e.g., '{x:{$gt:1}}'"`
+	QueryFile       string `long:"queryFile" value-name:"<filename>" description:"path to a file containing a query filter (JSON)"`
+	SlaveOk         bool   `long:"slaveOk" short:"k" description:"allow secondary reads if available" default-mask:"-"`
+	ReadPreference  string `long:"readPreference" value-name:"<string>|<json>" description:"specify either a preference mode (e.g. 'nearest') or a preference json object (e.g. '{mode: \"nearest\", tagSets: [{a: \"b\"}], maxStalenessSeconds: 123}')"`
+	ForceTableScan  bool   `long:"forceTableScan" description:"force a table scan (do not use $snapshot or hint _id). Deprecated since this is default behavior on WiredTiger"`
+	Skip            int64  `long:"skip" value-name:"<count>" description:"number of documents to skip"`
+	Limit           int64  `long:"limit" value-name:"<count>" description:"limit the number of documents to export"`
+	Sort            string `long:"sort" value-name:"<json>" description:"sort order, as a JSON string, e.g. '{x:1}'"`
+	AssertExists    bool   `long:"assertExists" description:"if specified, export fails if the collection does not exist"`
+	RequireIndexed  bool   `long:"requireIndexed" description:"if specified, export fails before writing any output if the query or sort would scan the whole collection or sort in memory rather than use an index. Without it, such exports only log a warning"`
+	ReadConcern     string `long:"readConcern" value-name:"<level>|<json>" description:"read concern for the export, either a level (e.g. 'majority' or 'snapshot') or a json object (e.g. '{level: \"snapshot\"}'). With 'snapshot', the whole export reads from a single point in time"`
+	AtClusterTime   string `long:"atClusterTime" value-name:"<seconds>[:ordinal]" description:"cluster time to read the snapshot at; only valid with --readConcern snapshot. Defaults to the current cluster time"`
+	Follow          bool   `long:"follow" description:"after exporting the collection, follow its change stream and write each insert, update, replace and delete event, as JSON with its operationType, until interrupted. Changes made during the export may be written twice. Requires a replica set or sharded cluster"`
+	ResumeTokenFile string `long:"resumeTokenFile" value-name:"<filename>" description:"with --follow, save the change stream's resume token to this file, and if it already holds one, skip the export and resume following the changes after it, appending them to --out"`
 }
 
 // Name returns a human-readable group name for input options.
@@ -148,3 +178,17 @@ func ParseOptions(rawArgs []string, versionStr, gitCommit string) (Options, erro
 		extraArgs,
 	}, nil
 }
+
+// HealthCheckRequirements returns the privileges needed to export with opts,
+// which are checked by --healthCheck.
+func (opts Options) HealthCheckRequirements() []healthcheck.Requirement {
+	actions := []string{"find"}
+	if opts.InputOptions.Follow {
+		actions = append(actions, "changeStream")
+	}
+	return []healthcheck.Requirement{{
+		Resource: healthcheck.Resource{DB: opts.ToolOptions.Namespace.DB, Collection: opts.ToolOptions.Namespace.Collection},
+		Actions:  actions,
+		Purpose:  "read the collection to export",
+	}}
+}
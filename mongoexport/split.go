@@ -0,0 +1,257 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// manifestSuffix replaces the extension of the --out file to name the
+// manifest written alongside the parts of a split export.
+const manifestSuffix = ".manifest.json"
+
+// sizeUnits are the suffixes accepted by --splitSize, longest first so that
+// "KB" is not mistaken for "B".
+var sizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30}, {"TIB", 1 << 40},
+	{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"TB", 1 << 40},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+	{"B", 1},
+}
+
+// parseSize parses a positive byte count with an optional unit suffix, such
+// as 512MB or 1GB, where units are powers of 1024.
+func parseSize(arg string) (int64, error) {
+	number, multiplier := strings.ToUpper(strings.TrimSpace(arg)), int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(number, unit.suffix) {
+			number, multiplier = strings.TrimSpace(strings.TrimSuffix(number, unit.suffix)), unit.multiplier
+			break
+		}
+	}
+	size, err := parseCount(number)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size '%v'", arg)
+	}
+	if size > (1<<63-1)/multiplier {
+		return 0, fmt.Errorf("size '%v' is too large", arg)
+	}
+	return size * multiplier, nil
+}
+
+// parseCount parses a positive integer that may use underscores to separate
+// groups of digits, such as 10_000_000.
+func parseCount(arg string) (int64, error) {
+	count, err := strconv.ParseInt(strings.Replace(arg, "_", "", -1), 10, 64)
+	if err != nil || count <= 0 || strings.HasPrefix(arg, "_") || strings.HasSuffix(arg, "_") {
+		return 0, fmt.Errorf("invalid count '%v'", arg)
+	}
+	return count, nil
+}
+
+// splitPart describes a single part file of a split export.
+type splitPart struct {
+	File      string `json:"file"`
+	Documents int64  `json:"documents"`
+	Bytes     int64  `json:"bytes"`
+}
+
+// splitManifest lists the part files of a split export in order, so that
+// loaders can verify that they have all of the parts.
+type splitManifest struct {
+	Namespace string      `json:"namespace"`
+	Type      string      `json:"type"`
+	Documents int64       `json:"documents"`
+	Bytes     int64       `json:"bytes"`
+	Parts     []splitPart `json:"parts"`
+}
+
+// countingWriter counts the bytes written to the underlying writer.
+type countingWriter struct {
+	io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// splitExportOutput is an ExportOutput that writes documents to a sequence of
+// numbered part files, each of which is a complete output file of its own.
+// A new part is started once the current part holds maxDocs documents or at
+// least maxBytes bytes, so a part may exceed maxBytes by up to one document.
+type splitExportOutput struct {
+	// newOutput returns the ExportOutput used to format a single part.
+	newOutput func(io.Writer) (ExportOutput, error)
+	// outputFile is the --out path that part and manifest names derive from.
+	outputFile string
+	maxDocs    int64
+	maxBytes   int64
+
+	file     *os.File
+	counter  *countingWriter
+	current  ExportOutput
+	manifest splitManifest
+}
+
+// partPath returns the path of the part with the given 1-based number,
+// inserting the number before the extension of the --out file, e.g.
+// out.json becomes out.00001.json.
+func (s *splitExportOutput) partPath(number int) string {
+	ext := filepath.Ext(s.outputFile)
+	return fmt.Sprintf("%v.%05d%v", strings.TrimSuffix(s.outputFile, ext), number, ext)
+}
+
+// manifestPath returns the path of the manifest, e.g. out.manifest.json for
+// out.json.
+func (s *splitExportOutput) manifestPath() string {
+	return strings.TrimSuffix(s.outputFile, filepath.Ext(s.outputFile)) + manifestSuffix
+}
+
+func (s *splitExportOutput) partFull() bool {
+	part := s.manifest.Parts[len(s.manifest.Parts)-1]
+	return (s.maxDocs > 0 && part.Documents >= s.maxDocs) ||
+		(s.maxBytes > 0 && s.counter.n >= s.maxBytes)
+}
+
+// startPart creates the next part file and writes its header.
+func (s *splitExportOutput) startPart() error {
+	path := s.partPath(len(s.manifest.Parts) + 1)
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+	file, err := os.Create(util.ToUniversalPath(path))
+	if err != nil {
+		return err
+	}
+	log.Logvf(log.Info, "writing part %v", path)
+	counter := &countingWriter{Writer: file}
+	current, err := s.newOutput(counter)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file, s.counter, s.current = file, counter, current
+	s.manifest.Parts = append(s.manifest.Parts, splitPart{File: filepath.Base(path)})
+	return s.current.WriteHeader()
+}
+
+// finishPart writes the footer of the current part and closes its file.
+func (s *splitExportOutput) finishPart() error {
+	if s.current == nil {
+		return nil
+	}
+	err := s.current.WriteFooter()
+	if err == nil {
+		err = s.current.Flush()
+	}
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	part := &s.manifest.Parts[len(s.manifest.Parts)-1]
+	part.Bytes = s.counter.n
+	s.manifest.Bytes += part.Bytes
+	s.current, s.file, s.counter = nil, nil, nil
+	return err
+}
+
+// WriteHeader is a no-op, since parts are only created once there is a
+// document to write to them.
+func (s *splitExportOutput) WriteHeader() error {
+	return nil
+}
+
+// ExportDocument writes the document to the current part, first starting a
+// new part if the current one is full.
+func (s *splitExportOutput) ExportDocument(document bson.D) error {
+	return s.export(func(current ExportOutput) error {
+		return current.ExportDocument(document)
+	})
+}
+
+// ExportRawDocument writes the raw document to the current part, as
+// ExportDocument does.
+func (s *splitExportOutput) ExportRawDocument(document bson.Raw) error {
+	return s.export(func(current ExportOutput) error {
+		return exportRawDocument(current, document)
+	})
+}
+
+// export writes a document to the current part with write, first starting a
+// new part if the current one is full.
+func (s *splitExportOutput) export(write func(ExportOutput) error) error {
+	if s.current != nil && s.partFull() {
+		if err := s.finishPart(); err != nil {
+			return err
+		}
+	}
+	if s.current == nil {
+		if err := s.startPart(); err != nil {
+			return err
+		}
+	}
+	if err := write(s.current); err != nil {
+		return err
+	}
+	s.manifest.Parts[len(s.manifest.Parts)-1].Documents++
+	s.manifest.Documents++
+	return nil
+}
+
+// WriteFooter finishes the last part and writes the manifest. An export
+// with no documents still writes a single, empty part.
+func (s *splitExportOutput) WriteFooter() error {
+	if len(s.manifest.Parts) == 0 {
+		if err := s.startPart(); err != nil {
+			return err
+		}
+	}
+	if err := s.finishPart(); err != nil {
+		return err
+	}
+
+	out, err := json.MarshalIndent(s.manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding manifest: %v", err)
+	}
+	if err = ioutil.WriteFile(util.ToUniversalPath(s.manifestPath()), append(out, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing manifest: %v", err)
+	}
+	log.Logvf(log.Always, "wrote %v part(s) and manifest %v", len(s.manifest.Parts), s.manifestPath())
+	return nil
+}
+
+// Flush is a no-op, since each part is flushed when it is finished.
+func (s *splitExportOutput) Flush() error {
+	return nil
+}
+
+// Close closes the current part file, if any, when the export stops early.
+func (s *splitExportOutput) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.current, s.file, s.counter = nil, nil, nil
+	return err
+}
@@ -0,0 +1,198 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseSplitLimits(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Sizes should accept units that are powers of 1024", t, func() {
+		for arg, expected := range map[string]int64{
+			"100": 100, "100B": 100, "2k": 2048, "512MB": 512 << 20, "1GB": 1 << 30, "1 GiB": 1 << 30, "3T": 3 << 40,
+		} {
+			size, err := parseSize(arg)
+			So(err, ShouldBeNil)
+			So(size, ShouldEqual, expected)
+		}
+		for _, arg := range []string{"", "GB", "0", "-1MB", "1.5GB", "1PB", "9999999999TB"} {
+			_, err := parseSize(arg)
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("Counts should accept underscores between digits", t, func() {
+		count, err := parseCount("10_000_000")
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 10000000)
+		for _, arg := range []string{"", "0", "-5", "_10", "10_", "1e6"} {
+			_, err := parseCount(arg)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestValidateSplitSettings(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	newExport := func(out string) *MongoExport {
+		return &MongoExport{
+			ToolOptions: &options.ToolOptions{Namespace: &options.Namespace{DB: "test", Collection: "users"}},
+			OutputOpts:  &OutputFormatOptions{Type: JSON, JSONFormat: Relaxed, OutputFile: out},
+			InputOpts:   &InputOptions{},
+		}
+	}
+
+	Convey("--splitSize and --splitDocs should be parsed and require --out", t, func() {
+		exp := newExport("users.json")
+		exp.OutputOpts.SplitSize = "1GB"
+		exp.OutputOpts.SplitDocs = "10_000"
+		So(exp.validateSettings(), ShouldBeNil)
+		So(exp.splitSize, ShouldEqual, 1<<30)
+		So(exp.splitDocs, ShouldEqual, 10000)
+
+		exp = newExport("users.json")
+		exp.OutputOpts.SplitDocs = "lots"
+		So(exp.validateSettings(), ShouldNotBeNil)
+
+		exp = newExport("")
+		exp.OutputOpts.SplitSize = "1GB"
+		So(exp.validateSettings(), ShouldNotBeNil)
+	})
+}
+
+func TestSplitExportOutput(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a split JSON export output", t, func() {
+		dir, err := ioutil.TempDir("", "mongoexport_split")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		exp := &MongoExport{
+			ToolOptions: &options.ToolOptions{Namespace: &options.Namespace{DB: "test", Collection: "users"}},
+			OutputOpts:  &OutputFormatOptions{Type: JSON, JSONFormat: Relaxed, OutputFile: filepath.Join(dir, "out", "users.json")},
+		}
+		exp.splitDocs = 2
+		output, err := exp.getExportOutput(nil)
+		So(err, ShouldBeNil)
+		So(output.WriteHeader(), ShouldBeNil)
+
+		readManifest := func() splitManifest {
+			var manifest splitManifest
+			raw, err := ioutil.ReadFile(filepath.Join(dir, "out", "users.manifest.json"))
+			So(err, ShouldBeNil)
+			So(json.Unmarshal(raw, &manifest), ShouldBeNil)
+			return manifest
+		}
+
+		Convey("documents should be split into numbered parts listed in the manifest", func() {
+			for i := 0; i < 5; i++ {
+				So(output.ExportDocument(bson.D{{Key: "_id", Value: int32(i)}}), ShouldBeNil)
+			}
+			So(output.WriteFooter(), ShouldBeNil)
+
+			manifest := readManifest()
+			So(manifest.Namespace, ShouldEqual, "test.users")
+			So(manifest.Documents, ShouldEqual, 5)
+			So(len(manifest.Parts), ShouldEqual, 3)
+			So(manifest.Parts[0].File, ShouldEqual, "users.00001.json")
+			So(manifest.Parts[2].File, ShouldEqual, "users.00003.json")
+			So(manifest.Parts[2].Documents, ShouldEqual, 1)
+
+			var total int64
+			for _, part := range manifest.Parts {
+				raw, err := ioutil.ReadFile(filepath.Join(dir, "out", part.File))
+				So(err, ShouldBeNil)
+				So(int64(len(raw)), ShouldEqual, part.Bytes)
+				So(int64(strings.Count(string(raw), "\n")), ShouldEqual, part.Documents)
+				total += part.Bytes
+			}
+			So(manifest.Bytes, ShouldEqual, total)
+
+			raw, err := ioutil.ReadFile(filepath.Join(dir, "out", "users.00002.json"))
+			So(err, ShouldBeNil)
+			So(string(raw), ShouldEqual, "{\"_id\":2}\n{\"_id\":3}\n")
+		})
+
+		Convey("an export with no documents should write a single empty part", func() {
+			So(output.WriteFooter(), ShouldBeNil)
+			manifest := readManifest()
+			So(len(manifest.Parts), ShouldEqual, 1)
+			So(manifest.Parts[0].Documents, ShouldEqual, 0)
+		})
+	})
+
+	Convey("Parts should be started once they reach the split size", t, func() {
+		dir, err := ioutil.TempDir("", "mongoexport_split")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		exp := &MongoExport{
+			ToolOptions: &options.ToolOptions{Namespace: &options.Namespace{DB: "test", Collection: "users"}},
+			OutputOpts:  &OutputFormatOptions{Type: JSON, JSONFormat: Relaxed, OutputFile: filepath.Join(dir, "data")},
+		}
+		exp.splitSize = 20
+		output, err := exp.getExportOutput(nil)
+		So(err, ShouldBeNil)
+		for i := 0; i < 4; i++ {
+			// each document is 11 bytes of output
+			So(output.ExportDocument(bson.D{{Key: "_id", Value: int32(i)}}), ShouldBeNil)
+		}
+		So(output.WriteFooter(), ShouldBeNil)
+
+		_, err = os.Stat(filepath.Join(dir, "data.00002"))
+		So(err, ShouldBeNil)
+		_, err = os.Stat(filepath.Join(dir, "data.00003"))
+		So(os.IsNotExist(err), ShouldBeTrue)
+		_, err = os.Stat(filepath.Join(dir, "data.manifest.json"))
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestSplitAvroExportOutput(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Every part of a split Avro export should be written with the same inferred schema", t, func() {
+		dir, err := ioutil.TempDir("", "mongoexport_split")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		exp := &MongoExport{
+			ToolOptions: &options.ToolOptions{Namespace: &options.Namespace{DB: "test", Collection: "users"}},
+			OutputOpts:  &OutputFormatOptions{Type: AVRO, OutputFile: filepath.Join(dir, "users.avro")},
+		}
+		exp.splitDocs = 2
+		output, err := exp.getExportOutput(nil)
+		So(err, ShouldBeNil)
+		So(output.WriteHeader(), ShouldBeNil)
+		So(output.ExportDocument(bson.D{{Key: "_id", Value: int32(1)}}), ShouldBeNil)
+		So(output.ExportDocument(bson.D{{Key: "_id", Value: int32(2)}}), ShouldBeNil)
+		So(output.ExportDocument(bson.D{{Key: "_id", Value: int32(3)}, {Key: "name", Value: "c"}}), ShouldBeNil)
+		So(output.WriteFooter(), ShouldBeNil)
+
+		So(exp.avroSchemaJSON, ShouldNotBeNil)
+		So(string(exp.avroSchemaJSON), ShouldContainSubstring, `"name":"name"`)
+		for _, part := range []string{"users.00001.avro", "users.00002.avro"} {
+			raw, err := ioutil.ReadFile(filepath.Join(dir, part))
+			So(err, ShouldBeNil)
+			So(string(raw), ShouldContainSubstring, string(exp.avroSchemaJSON))
+		}
+	})
+}
@@ -0,0 +1,222 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// templateFuncs are the helper functions available to --template, in
+// addition to the text/template builtins.
+var templateFuncs = template.FuncMap{
+	// date formats a date with a Go layout, e.g. {{date "2006-01-02" .created}}
+	"date": func(layout string, value interface{}) (string, error) {
+		t, ok := value.(time.Time)
+		if !ok {
+			return "", fmt.Errorf("date: expected a date but got %T", value)
+		}
+		return t.Format(layout), nil
+	},
+	// unix returns a date as seconds since the Unix epoch
+	"unix": func(value interface{}) (int64, error) {
+		t, ok := value.(time.Time)
+		if !ok {
+			return 0, fmt.Errorf("unix: expected a date but got %T", value)
+		}
+		return t.Unix(), nil
+	},
+	// number converts any BSON number to a float64, e.g. for printf "%.2f"
+	"number": templateNumber,
+	// json returns a value as relaxed extended JSON
+	"json": func(value interface{}) (string, error) {
+		out, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: value}}, false, false)
+		if err != nil {
+			return "", err
+		}
+		// strip the {"v": and } wrapping the value
+		return string(out[5 : len(out)-1]), nil
+	},
+	// sql quotes a value as an SQL literal, e.g. 'O''Brien', or NULL
+	"sql": func(value interface{}) string {
+		switch v := value.(type) {
+		case nil:
+			return "NULL"
+		case bool:
+			return strings.ToUpper(strconv.FormatBool(v))
+		case int32, int64, float64:
+			return fmt.Sprint(v)
+		case time.Time:
+			return "'" + v.Format("2006-01-02 15:04:05.000") + "'"
+		}
+		return "'" + strings.Replace(fmt.Sprint(value), "'", "''", -1) + "'"
+	},
+	// default returns def if value is missing or null
+	"default": func(def, value interface{}) interface{} {
+		if value == nil {
+			return def
+		}
+		return value
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	// orEmpty is appended to every action that prints a value
+	"orEmpty": func(value interface{}) interface{} {
+		if value == nil {
+			return ""
+		}
+		return value
+	},
+}
+
+// templateNumber converts a BSON number to a float64.
+func templateNumber(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case int32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case primitive.Decimal128:
+		return strconv.ParseFloat(v.String(), 64)
+	case nil:
+		return 0, nil
+	}
+	return 0, fmt.Errorf("number: expected a number but got %T", value)
+}
+
+// ParseTemplate parses the --template argument. Missing and null fields are
+// printed as empty strings rather than as "<no value>".
+func ParseTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("template").Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			printNilAsEmpty(t.Tree.Root)
+		}
+	}
+	return tmpl, nil
+}
+
+// printNilAsEmpty pipes the value of each action under node that prints one
+// to orEmpty, so that nil values are printed as empty strings.
+func printNilAsEmpty(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			printNilAsEmpty(child)
+		}
+	case *parse.ActionNode:
+		// actions that declare variables print nothing
+		if len(n.Pipe.Decl) > 0 {
+			return
+		}
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      n.Pos,
+			Args:     []parse.Node{parse.NewIdentifier("orEmpty").SetPos(n.Pos)},
+		})
+	case *parse.IfNode:
+		printNilAsEmpty(n.List)
+		printNilAsEmpty(n.ElseList)
+	case *parse.RangeNode:
+		printNilAsEmpty(n.List)
+		printNilAsEmpty(n.ElseList)
+	case *parse.WithNode:
+		printNilAsEmpty(n.List)
+		printNilAsEmpty(n.ElseList)
+	}
+}
+
+// templateValue converts a BSON value to the form exposed to templates:
+// documents become maps, so that fields can be addressed as .user.name, dates
+// become time.Time and ObjectIds their hex string.
+func templateValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bson.D:
+		doc := make(map[string]interface{}, len(v))
+		for _, elem := range v {
+			doc[elem.Key] = templateValue(elem.Value)
+		}
+		return doc
+	case bson.A:
+		arr := make([]interface{}, len(v))
+		for i, elem := range v {
+			arr[i] = templateValue(elem)
+		}
+		return arr
+	case primitive.DateTime:
+		return time.Unix(int64(v)/1e3, int64(v)%1e3*1e6).UTC()
+	case primitive.ObjectID:
+		return v.Hex()
+	case primitive.Null, primitive.Undefined:
+		return nil
+	}
+	return value
+}
+
+// TemplateExportOutput is an implementation of ExportOutput that writes each
+// document as a line formatted by a Go text/template.
+type TemplateExportOutput struct {
+	Template    *template.Template
+	NumExported int64
+
+	out *bufio.Writer
+}
+
+// NewTemplateExportOutput returns a TemplateExportOutput that writes each
+// document formatted by tmpl to out.
+func NewTemplateExportOutput(tmpl *template.Template, out io.Writer) *TemplateExportOutput {
+	return &TemplateExportOutput{
+		Template: tmpl,
+		out:      bufio.NewWriter(out),
+	}
+}
+
+// WriteHeader is a no-op for template exports.
+func (templateExporter *TemplateExportOutput) WriteHeader() error {
+	return nil
+}
+
+// WriteFooter is a no-op for template exports.
+func (templateExporter *TemplateExportOutput) WriteFooter() error {
+	return nil
+}
+
+// Flush writes any pending data to the output.
+func (templateExporter *TemplateExportOutput) Flush() error {
+	return templateExporter.out.Flush()
+}
+
+// ExportDocument executes the template for the document, and writes the
+// result to the output followed by a newline.
+func (templateExporter *TemplateExportOutput) ExportDocument(document bson.D) error {
+	err := templateExporter.Template.Execute(templateExporter.out, templateValue(document))
+	if err != nil {
+		return fmt.Errorf("error executing --template: %v", err)
+	}
+	if err = templateExporter.out.WriteByte('\n'); err != nil {
+		return err
+	}
+	templateExporter.NumExported++
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestTemplateExportOutput(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	oid, _ := primitive.ObjectIDFromHex("5f8d0d55b54764421b7156c3")
+	created := time.Date(2020, 10, 19, 8, 30, 0, 0, time.UTC)
+	doc := bson.D{
+		{Key: "_id", Value: oid},
+		{Key: "user", Value: bson.D{{Key: "name", Value: "O'Brien"}}},
+		{Key: "total", Value: int32(42)},
+		{Key: "created", Value: primitive.NewDateTimeFromTime(created)},
+		{Key: "tags", Value: bson.A{"a", "b"}},
+		{Key: "note", Value: primitive.Null{}},
+	}
+
+	export := func(text string) (string, error) {
+		tmpl, err := ParseTemplate(text)
+		So(err, ShouldBeNil)
+		out := &bytes.Buffer{}
+		output := NewTemplateExportOutput(tmpl, out)
+		if err = output.ExportDocument(doc); err != nil {
+			return "", err
+		}
+		So(output.Flush(), ShouldBeNil)
+		return out.String(), nil
+	}
+
+	Convey("Documents are formatted by the template, one per line", t, func() {
+		out, err := export(`{{._id}},{{.user.name}},{{.total | number | printf "%.2f"}}`)
+		So(err, ShouldBeNil)
+		So(out, ShouldEqual, "5f8d0d55b54764421b7156c3,O'Brien,42.00\n")
+	})
+
+	Convey("Helper functions format dates, arrays and SQL literals", t, func() {
+		out, err := export(`{{date "2006-01-02" .created}} {{unix .created}} {{json .tags}} {{upper .user.name}}`)
+		So(err, ShouldBeNil)
+		So(out, ShouldEqual, `2020-10-19 1603096200 ["a","b"] O'BRIEN`+"\n")
+
+		out, err = export(`INSERT INTO users VALUES ({{sql .user.name}}, {{sql .total}}, {{sql .note}}, {{sql .missing}});`)
+		So(err, ShouldBeNil)
+		So(out, ShouldEqual, "INSERT INTO users VALUES ('O''Brien', 42, NULL, NULL);\n")
+
+		out, err = export(`{{default "none" .note}}`)
+		So(err, ShouldBeNil)
+		So(out, ShouldEqual, "none\n")
+	})
+
+	Convey("Missing and null fields are printed as empty strings", t, func() {
+		out, err := export(`{{.missing}},{{.note}},{{.user.missing}},{{if .total}}{{.note}}{{end}},{{range .tags}}{{.}}{{end}}`)
+		So(err, ShouldBeNil)
+		So(out, ShouldEqual, ",,,,ab\n")
+
+		out, err = export(`{{define "name"}}{{.missing}}{{end}}[{{template "name" .user}}]{{$n := .note}}[{{$n}}]`)
+		So(err, ShouldBeNil)
+		So(out, ShouldEqual, "[][]\n")
+	})
+
+	Convey("Errors executing the template are reported", t, func() {
+		_, err := export(`{{date "2006" .total}}`)
+		So(err, ShouldNotBeNil)
+
+		_, err = ParseTemplate(`{{.total`)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,104 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// unwinder flattens arrays in exported documents into one record per array
+// element, as the $unwind aggregation stage does, so that nested documents
+// can be exported as relational rows.
+type unwinder struct {
+	// paths are unwound in order, so a later path may unwind an array
+	// inside the elements of an earlier one.
+	paths [][]string
+}
+
+// newUnwinder parses the --unwind arguments, each a dotted path to an array.
+func newUnwinder(args []string) (*unwinder, error) {
+	u := &unwinder{}
+	seen := map[string]bool{}
+	for _, arg := range args {
+		field := strings.TrimSpace(arg)
+		if field == "" || strings.HasPrefix(field, "$") || strings.HasPrefix(field, ".") ||
+			strings.HasSuffix(field, ".") || strings.Contains(field, "..") {
+			return nil, fmt.Errorf("invalid field '%v'", arg)
+		}
+		if seen[field] {
+			return nil, fmt.Errorf("field '%v' is given more than once", field)
+		}
+		seen[field] = true
+		u.paths = append(u.paths, strings.Split(field, "."))
+	}
+	return u, nil
+}
+
+// unwind returns one document for each combination of the elements of the
+// arrays at the unwound paths, each with the array replaced by its element
+// and the other fields of the document repeated. A document whose array is
+// empty is returned once without the field, and one with no array at a path,
+// or a value that is not an array, is returned as it is.
+func (u *unwinder) unwind(document bson.D) []bson.D {
+	documents := []bson.D{document}
+	for _, path := range u.paths {
+		var unwound []bson.D
+		for _, doc := range documents {
+			unwound = append(unwound, unwindPath(doc, path)...)
+		}
+		documents = unwound
+	}
+	return documents
+}
+
+func unwindPath(document bson.D, path []string) []bson.D {
+	for i, elem := range document {
+		if elem.Key != path[0] {
+			continue
+		}
+		if len(path) > 1 {
+			sub, ok := elem.Value.(bson.D)
+			if !ok {
+				return []bson.D{document}
+			}
+			subDocuments := unwindPath(sub, path[1:])
+			unwound := make([]bson.D, 0, len(subDocuments))
+			for _, subDocument := range subDocuments {
+				unwound = append(unwound, withFieldValue(document, i, subDocument))
+			}
+			return unwound
+		}
+
+		array, ok := elem.Value.(bson.A)
+		if !ok {
+			return []bson.D{document}
+		}
+		if len(array) == 0 {
+			without := make(bson.D, 0, len(document)-1)
+			without = append(without, document[:i]...)
+			return []bson.D{append(without, document[i+1:]...)}
+		}
+		unwound := make([]bson.D, 0, len(array))
+		for _, value := range array {
+			unwound = append(unwound, withFieldValue(document, i, value))
+		}
+		return unwound
+	}
+	return []bson.D{document}
+}
+
+// withFieldValue returns a copy of document with the value of its i'th field
+// replaced by value.
+func withFieldValue(document bson.D, i int, value interface{}) bson.D {
+	out := make(bson.D, len(document))
+	copy(out, document)
+	out[i].Value = value
+	return out
+}
@@ -0,0 +1,96 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestNewUnwinder(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Unwound fields should be parsed as paths", t, func() {
+		u, err := newUnwinder([]string{"orders", "orders.items"})
+		So(err, ShouldBeNil)
+		So(u.paths, ShouldResemble, [][]string{{"orders"}, {"orders", "items"}})
+	})
+
+	Convey("Invalid fields should be rejected", t, func() {
+		for _, args := range [][]string{{""}, {"$a"}, {"a..b"}, {"a."}, {"a", "a"}} {
+			_, err := newUnwinder(args)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestUnwind(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	document := bson.D{
+		{Key: "_id", Value: int32(1)},
+		{Key: "customer", Value: bson.D{
+			{Key: "name", Value: "ann"},
+			{Key: "orders", Value: bson.A{
+				bson.D{{Key: "n", Value: int32(1)}, {Key: "items", Value: bson.A{"a", "b"}}},
+				bson.D{{Key: "n", Value: int32(2)}, {Key: "items", Value: bson.A{}}},
+			}},
+		}},
+		{Key: "note", Value: "x"},
+	}
+
+	Convey("Each element of an array should be output as its own record", t, func() {
+		u, _ := newUnwinder([]string{"customer.orders"})
+		records := u.unwind(document)
+		So(records, ShouldHaveLength, 2)
+		So(records[0], ShouldResemble, bson.D{
+			{Key: "_id", Value: int32(1)},
+			{Key: "customer", Value: bson.D{
+				{Key: "name", Value: "ann"},
+				{Key: "orders", Value: bson.D{{Key: "n", Value: int32(1)}, {Key: "items", Value: bson.A{"a", "b"}}}},
+			}},
+			{Key: "note", Value: "x"},
+		})
+		So(records[1][1].Value.(bson.D)[1].Value, ShouldResemble, bson.D{{Key: "n", Value: int32(2)}, {Key: "items", Value: bson.A{}}})
+
+		Convey("without modifying the original document", func() {
+			So(document[1].Value.(bson.D)[1].Value, ShouldHaveSameTypeAs, bson.A{})
+		})
+	})
+
+	Convey("Nested arrays should be unwound in turn", t, func() {
+		u, _ := newUnwinder([]string{"customer.orders", "customer.orders.items"})
+		records := u.unwind(document)
+		So(records, ShouldHaveLength, 3)
+		order := func(record bson.D) bson.D {
+			return record[1].Value.(bson.D)[1].Value.(bson.D)
+		}
+		So(order(records[0]), ShouldResemble, bson.D{{Key: "n", Value: int32(1)}, {Key: "items", Value: "a"}})
+		So(order(records[1]), ShouldResemble, bson.D{{Key: "n", Value: int32(1)}, {Key: "items", Value: "b"}})
+		So(order(records[2]), ShouldResemble, bson.D{{Key: "n", Value: int32(2)}})
+	})
+
+	Convey("Documents without an array at the path should be output as they are", t, func() {
+		u, _ := newUnwinder([]string{"note", "missing", "note.sub"})
+		So(u.unwind(document), ShouldResemble, []bson.D{document})
+	})
+
+	Convey("Unwound records should be written as CSV rows", t, func() {
+		u, _ := newUnwinder([]string{"customer.orders", "customer.orders.items"})
+		out := &bytes.Buffer{}
+		csvOutput := NewCSVExportOutput([]string{"_id", "customer.name", "customer.orders.n", "customer.orders.items"}, true, out)
+		for _, record := range u.unwind(document) {
+			So(csvOutput.ExportDocument(record), ShouldBeNil)
+		}
+		So(csvOutput.Flush(), ShouldBeNil)
+		So(out.String(), ShouldEqual, "1,ann,1,a\n1,ann,1,b\n1,ann,2,\n")
+	})
+}
@@ -0,0 +1,450 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+	driverOptions "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Archive formats supported by export-archive and import-archive, chosen by
+// the extension of the archive's name.
+const (
+	tarFormat   = "tar"
+	tarGzFormat = "tar.gz"
+	zipFormat   = "zip"
+)
+
+const (
+	// archiveIndexName is the first entry of an archive, describing the
+	// GridFS file stored in each of the other entries.
+	archiveIndexName = "index.json"
+	// archiveFilesDir is the folder of an archive holding file contents.
+	archiveFilesDir = "files"
+)
+
+// archiveIndex is the contents of an archive's index, written as canonical
+// extended JSON so that _id and metadata values keep their BSON types.
+type archiveIndex struct {
+	Files []archiveIndexEntry `bson:"files"`
+}
+
+// archiveIndexEntry describes a GridFS file stored in an archive. It is also
+// decoded directly from documents in the files collection.
+type archiveIndexEntry struct {
+	Path        string      `bson:"path"`
+	ID          interface{} `bson:"_id"`
+	Filename    string      `bson:"filename"`
+	Length      int64       `bson:"length"`
+	ChunkSize   int32       `bson:"chunkSize"`
+	UploadDate  time.Time   `bson:"uploadDate"`
+	ContentType string      `bson:"contentType,omitempty"`
+	Metadata    bson.Raw    `bson:"metadata,omitempty"`
+}
+
+// archiveFormat returns the format of the archive with the given name.
+func archiveFormat(name string) (string, error) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz"):
+		return tarGzFormat, nil
+	case strings.HasSuffix(lower, ".tar"):
+		return tarFormat, nil
+	case strings.HasSuffix(lower, ".zip"):
+		return zipFormat, nil
+	}
+	return "", fmt.Errorf("unsupported archive '%v': name must end in .tar, .tar.gz, .tgz or .zip", name)
+}
+
+// archiveEntryPath returns the path within an archive to store the contents
+// of the GridFS file with the given name. Paths are kept relative to the
+// files folder, and a numeric suffix is added when several files, such as
+// revisions of the same file, would share a path.
+func archiveEntryPath(filename string, used map[string]bool) string {
+	cleaned := strings.TrimPrefix(path.Clean("/"+filename), "/")
+	if cleaned == "" {
+		cleaned = "unnamed"
+	}
+	entryPath := path.Join(archiveFilesDir, cleaned)
+	for i := 1; used[entryPath]; i++ {
+		entryPath = fmt.Sprintf("%v/%v.%d", archiveFilesDir, cleaned, i)
+	}
+	used[entryPath] = true
+	return entryPath
+}
+
+// archiveWriter writes entries to a tar or zip archive.
+type archiveWriter interface {
+	writeEntry(name string, size int64, modTime time.Time, r io.Reader) error
+	// Close finishes the archive and closes the underlying writer.
+	Close() error
+}
+
+func newArchiveWriter(w io.WriteCloser, format string) archiveWriter {
+	switch format {
+	case zipFormat:
+		return &zipArchiveWriter{zw: zip.NewWriter(w), out: w}
+	case tarGzFormat:
+		gz := gzip.NewWriter(w)
+		return &tarArchiveWriter{tw: tar.NewWriter(gz), gz: gz, out: w}
+	}
+	return &tarArchiveWriter{tw: tar.NewWriter(w), out: w}
+}
+
+type tarArchiveWriter struct {
+	tw  *tar.Writer
+	gz  *gzip.Writer
+	out io.Closer
+}
+
+func (w *tarArchiveWriter) writeEntry(name string, size int64, modTime time.Time, r io.Reader) error {
+	header := &tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  modTime,
+		Typeflag: tar.TypeReg,
+	}
+	if err := w.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := io.Copy(w.tw, r)
+	return err
+}
+
+func (w *tarArchiveWriter) Close() error {
+	err := w.tw.Close()
+	if w.gz != nil {
+		if gzErr := w.gz.Close(); err == nil {
+			err = gzErr
+		}
+	}
+	if closeErr := w.out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+type zipArchiveWriter struct {
+	zw  *zip.Writer
+	out io.Closer
+}
+
+func (w *zipArchiveWriter) writeEntry(name string, _ int64, modTime time.Time, r io.Reader) error {
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modTime,
+	}
+	entry, err := w.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, r)
+	return err
+}
+
+func (w *zipArchiveWriter) Close() error {
+	err := w.zw.Close()
+	if closeErr := w.out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// archiveReader reads the regular file entries of a tar or zip archive in
+// order. next returns io.EOF once all entries have been read.
+type archiveReader interface {
+	next() (name string, r io.Reader, err error)
+}
+
+// archiveSource is what an archive is read from; zip archives need random
+// access to their contents.
+type archiveSource interface {
+	io.Reader
+	io.ReaderAt
+}
+
+func newArchiveReader(src archiveSource, size int64, format string) (archiveReader, error) {
+	switch format {
+	case zipFormat:
+		zr, err := zip.NewReader(src, size)
+		if err != nil {
+			return nil, err
+		}
+		return &zipArchiveReader{files: zr.File}, nil
+	case tarGzFormat:
+		gz, err := gzip.NewReader(src)
+		if err != nil {
+			return nil, err
+		}
+		return &tarArchiveReader{tr: tar.NewReader(gz)}, nil
+	}
+	return &tarArchiveReader{tr: tar.NewReader(src)}, nil
+}
+
+type tarArchiveReader struct {
+	tr *tar.Reader
+}
+
+func (r *tarArchiveReader) next() (string, io.Reader, error) {
+	for {
+		header, err := r.tr.Next()
+		if err != nil {
+			return "", nil, err
+		}
+		if header.Typeflag == tar.TypeReg {
+			return header.Name, r.tr, nil
+		}
+	}
+}
+
+type zipArchiveReader struct {
+	files   []*zip.File
+	current io.ReadCloser
+}
+
+func (r *zipArchiveReader) next() (string, io.Reader, error) {
+	if r.current != nil {
+		r.current.Close()
+		r.current = nil
+	}
+	for len(r.files) > 0 {
+		file := r.files[0]
+		r.files = r.files[1:]
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return "", nil, err
+		}
+		r.current = rc
+		return file.Name, rc, nil
+	}
+	return "", nil, io.EOF
+}
+
+// handleExportArchive contains the logic for the 'export-archive' command,
+// which writes the GridFS files whose names begin with the optional filename
+// prefix to a local archive, preceded by an index describing each file.
+func (mf *MongoFiles) handleExportArchive() (err error) {
+	format, err := archiveFormat(mf.ArchiveName)
+	if err != nil {
+		return err
+	}
+
+	query := bson.M{}
+	if mf.FileName != "" {
+		query = bson.M{"filename": bson.M{"$regex": "^" + regexp.QuoteMeta(mf.FileName)}}
+	}
+	cursor, err := mf.bucket.Find(query)
+	if err != nil {
+		return fmt.Errorf("error retrieving list of GridFS files: %v", err)
+	}
+	var index archiveIndex
+	err = cursor.All(context.Background(), &index.Files)
+	if err != nil {
+		return fmt.Errorf("error retrieving list of GridFS files: %v", err)
+	}
+	used := map[string]bool{}
+	for i := range index.Files {
+		index.Files[i].Path = archiveEntryPath(index.Files[i].Filename, used)
+	}
+	indexJSON, err := marshalArchiveIndex(index)
+	if err != nil {
+		return err
+	}
+
+	localFile, err := os.Create(mf.ArchiveName)
+	if err != nil {
+		return fmt.Errorf("error while opening archive '%v': %v", mf.ArchiveName, err)
+	}
+	archive := newArchiveWriter(localFile, format)
+	dc := util.DeferredCloser{Closer: archive}
+	defer dc.CloseWithErrorCapture(&err)
+
+	if err = archive.writeEntry(archiveIndexName, int64(len(indexJSON)), time.Now(), bytes.NewReader(indexJSON)); err != nil {
+		return fmt.Errorf("error writing index to archive '%v': %v", mf.ArchiveName, err)
+	}
+	for _, entry := range index.Files {
+		if err = mf.exportToArchive(archive, entry); err != nil {
+			return err
+		}
+	}
+
+	log.Logvf(log.Always, "exported %v file(s) to %v", len(index.Files), mf.ArchiveName)
+	return nil
+}
+
+func (mf *MongoFiles) exportToArchive(archive archiveWriter, entry archiveIndexEntry) (err error) {
+	stream, err := mf.bucket.OpenDownloadStream(entry.ID)
+	if err != nil {
+		return fmt.Errorf("could not open download stream for '%v': %v", entry.Filename, err)
+	}
+	dc := util.DeferredCloser{Closer: stream}
+	defer dc.CloseWithErrorCapture(&err)
+
+	log.Logvf(log.Info, "exporting '%v' to %v", entry.Filename, entry.Path)
+	if err = archive.writeEntry(entry.Path, entry.Length, entry.UploadDate, stream); err != nil {
+		return fmt.Errorf("error writing '%v' to archive '%v': %v", entry.Filename, mf.ArchiveName, err)
+	}
+	return nil
+}
+
+// handleImportArchive contains the logic for the 'import-archive' command,
+// which stores each file of an archive written by 'export-archive' into
+// GridFS with the _id, filename and metadata recorded in the archive's index.
+func (mf *MongoFiles) handleImportArchive() (err error) {
+	format, err := archiveFormat(mf.ArchiveName)
+	if err != nil {
+		return err
+	}
+
+	localFile, err := os.Open(mf.ArchiveName)
+	if err != nil {
+		return fmt.Errorf("error while opening archive '%v': %v", mf.ArchiveName, err)
+	}
+	dc := util.DeferredCloser{Closer: localFile}
+	defer dc.CloseWithErrorCapture(&err)
+	info, err := localFile.Stat()
+	if err != nil {
+		return fmt.Errorf("error while opening archive '%v': %v", mf.ArchiveName, err)
+	}
+
+	archive, err := newArchiveReader(localFile, info.Size(), format)
+	if err != nil {
+		return fmt.Errorf("error reading archive '%v': %v", mf.ArchiveName, err)
+	}
+	index, err := readArchiveIndex(archive)
+	if err != nil {
+		return fmt.Errorf("error reading archive '%v': %v", mf.ArchiveName, err)
+	}
+
+	byPath := make(map[string]archiveIndexEntry, len(index.Files))
+	for _, entry := range index.Files {
+		byPath[entry.Path] = entry
+	}
+
+	imported := 0
+	for {
+		name, contents, err := archive.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading archive '%v': %v", mf.ArchiveName, err)
+		}
+		entry, ok := byPath[name]
+		if !ok {
+			log.Logvf(log.Always, "skipping '%v', which is not listed in the archive's index", name)
+			continue
+		}
+		delete(byPath, name)
+		if err = mf.importFromArchive(entry, contents); err != nil {
+			return err
+		}
+		imported++
+	}
+	if len(byPath) > 0 {
+		return fmt.Errorf("archive '%v' is missing %v file(s) listed in its index", mf.ArchiveName, len(byPath))
+	}
+
+	log.Logvf(log.Always, "imported %v file(s) from %v", imported, mf.ArchiveName)
+	return nil
+}
+
+func (mf *MongoFiles) importFromArchive(entry archiveIndexEntry, contents io.Reader) (err error) {
+	if mf.StorageOptions.Replace {
+		existing, err := mf.findGFSFiles(bson.M{"$or": []bson.M{{"_id": entry.ID}, {"filename": entry.Filename}}})
+		if err != nil {
+			return err
+		}
+		for _, gridFile := range existing {
+			if err = gridFile.Delete(); err != nil {
+				return err
+			}
+		}
+	}
+
+	uploadOpts := driverOptions.GridFSUpload()
+	if entry.ChunkSize > 0 {
+		uploadOpts.SetChunkSizeBytes(entry.ChunkSize)
+	}
+	if entry.Metadata != nil {
+		uploadOpts.SetMetadata(entry.Metadata)
+	} else if entry.ContentType != "" {
+		uploadOpts.SetMetadata(gfsFileMetadata{ContentType: entry.ContentType})
+	}
+
+	stream, err := mf.bucket.OpenUploadStreamWithID(entry.ID, entry.Filename, uploadOpts)
+	if err != nil {
+		return fmt.Errorf("could not open upload stream for '%v': %v", entry.Filename, err)
+	}
+	dc := util.DeferredCloser{Closer: stream}
+	defer dc.CloseWithErrorCapture(&err)
+
+	log.Logvf(log.Info, "importing '%v' from %v", entry.Filename, entry.Path)
+	if _, err = io.Copy(stream, contents); err != nil {
+		return fmt.Errorf("error while storing '%v' into GridFS: %v", entry.Filename, err)
+	}
+	return nil
+}
+
+func marshalArchiveIndex(index archiveIndex) ([]byte, error) {
+	if index.Files == nil {
+		index.Files = []archiveIndexEntry{}
+	}
+	out, err := bson.MarshalExtJSON(index, true, false)
+	if err != nil {
+		return nil, fmt.Errorf("error converting archive index to JSON: %v", err)
+	}
+	var indented bytes.Buffer
+	if err = json.Indent(&indented, out, "", "  "); err != nil {
+		return nil, fmt.Errorf("error formatting archive index: %v", err)
+	}
+	indented.WriteByte('\n')
+	return indented.Bytes(), nil
+}
+
+// readArchiveIndex reads the index, which must be the first entry of the
+// archive so that tar archives can be imported in a single pass.
+func readArchiveIndex(archive archiveReader) (archiveIndex, error) {
+	var index archiveIndex
+	name, r, err := archive.next()
+	if err == io.EOF || (err == nil && name != archiveIndexName) {
+		return index, fmt.Errorf("not a mongofiles archive: %v must be its first entry", archiveIndexName)
+	}
+	if err != nil {
+		return index, err
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return index, err
+	}
+	if err = bson.UnmarshalExtJSON(data, true, &index); err != nil {
+		return index, fmt.Errorf("error parsing %v: %v", archiveIndexName, err)
+	}
+	return index, nil
+}
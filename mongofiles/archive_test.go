@@ -0,0 +1,168 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type closingBuffer struct {
+	bytes.Buffer
+}
+
+func (*closingBuffer) Close() error { return nil }
+
+func TestArchiveFormats(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Archive formats are chosen by extension", t, func() {
+		for name, expected := range map[string]string{
+			"out.tar": tarFormat, "out.TGZ": tarGzFormat, "out.tar.gz": tarGzFormat, "out.zip": zipFormat,
+		} {
+			format, err := archiveFormat(name)
+			So(err, ShouldBeNil)
+			So(format, ShouldEqual, expected)
+		}
+		_, err := archiveFormat("out.rar")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Archive entries should be read back in the order they were written", t, func() {
+		for _, format := range []string{tarFormat, tarGzFormat, zipFormat} {
+			buf := &closingBuffer{}
+			archive := newArchiveWriter(buf, format)
+			So(archive.writeEntry("index.json", 2, time.Now(), bytes.NewReader([]byte("{}"))), ShouldBeNil)
+			So(archive.writeEntry("files/a/b.txt", 5, time.Now(), bytes.NewReader([]byte("hello"))), ShouldBeNil)
+			So(archive.Close(), ShouldBeNil)
+
+			reader, err := newArchiveReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()), format)
+			So(err, ShouldBeNil)
+			var names, contents []string
+			for {
+				name, r, err := reader.next()
+				if err == io.EOF {
+					break
+				}
+				So(err, ShouldBeNil)
+				data, err := ioutil.ReadAll(r)
+				So(err, ShouldBeNil)
+				names = append(names, name)
+				contents = append(contents, string(data))
+			}
+			So(names, ShouldResemble, []string{"index.json", "files/a/b.txt"})
+			So(contents, ShouldResemble, []string{"{}", "hello"})
+		}
+	})
+}
+
+func TestArchiveIndex(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Archive paths should stay inside the files folder and be unique", t, func() {
+		used := map[string]bool{}
+		So(archiveEntryPath("images/cat.png", used), ShouldEqual, "files/images/cat.png")
+		So(archiveEntryPath("/images/cat.png", used), ShouldEqual, "files/images/cat.png.1")
+		So(archiveEntryPath("../../etc/passwd", used), ShouldEqual, "files/etc/passwd")
+		So(archiveEntryPath("", used), ShouldEqual, "files/unnamed")
+	})
+
+	Convey("The index should keep the BSON types of _id and metadata", t, func() {
+		id := primitive.NewObjectID()
+		metadata, err := bson.Marshal(bson.M{"contentType": "image/png", "size": int64(3)})
+		So(err, ShouldBeNil)
+		index := archiveIndex{Files: []archiveIndexEntry{{
+			Path:       "files/cat.png",
+			ID:         id,
+			Filename:   "cat.png",
+			Length:     3,
+			ChunkSize:  1024,
+			UploadDate: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+			Metadata:   metadata,
+		}}}
+		data, err := marshalArchiveIndex(index)
+		So(err, ShouldBeNil)
+
+		buf := &closingBuffer{}
+		archive := newArchiveWriter(buf, tarFormat)
+		So(archive.writeEntry(archiveIndexName, int64(len(data)), time.Now(), bytes.NewReader(data)), ShouldBeNil)
+		So(archive.Close(), ShouldBeNil)
+		reader, err := newArchiveReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()), tarFormat)
+		So(err, ShouldBeNil)
+
+		parsed, err := readArchiveIndex(reader)
+		So(err, ShouldBeNil)
+		So(parsed.Files, ShouldHaveLength, 1)
+		So(parsed.Files[0].ID, ShouldEqual, id)
+		So(parsed.Files[0].ChunkSize, ShouldEqual, 1024)
+		So(parsed.Files[0].UploadDate.Equal(index.Files[0].UploadDate), ShouldBeTrue)
+		So(parsed.Files[0].Metadata.Lookup("size").Int64(), ShouldEqual, 3)
+	})
+
+	Convey("An archive without an index should be rejected", t, func() {
+		buf := &closingBuffer{}
+		archive := newArchiveWriter(buf, zipFormat)
+		So(archive.writeEntry("files/a", 1, time.Now(), bytes.NewReader([]byte("a"))), ShouldBeNil)
+		So(archive.Close(), ShouldBeNil)
+		reader, err := newArchiveReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()), zipFormat)
+		So(err, ShouldBeNil)
+		_, err = readArchiveIndex(reader)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestArchiveCommands(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.IntegrationTestType)
+
+	Convey("Files exported to an archive should be imported with the same names, sizes and _ids", t, func() {
+		defer tearDownGridFSTestData()
+
+		dir, err := ioutil.TempDir("", "mongofiles_archive")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		for _, name := range []string{"files.tar.gz", "files.zip"} {
+			archiveName := filepath.Join(dir, name)
+			So(tearDownGridFSTestData(), ShouldBeNil)
+			bytesExpected, err := setUpGridFSTestData()
+			So(err, ShouldBeNil)
+
+			mf, err := simpleMongoFilesInstanceCommandOnly(ExportArchive)
+			So(err, ShouldBeNil)
+			mf.ArchiveName = archiveName
+			_, err = mf.Run(false)
+			So(err, ShouldBeNil)
+
+			So(tearDownGridFSTestData(), ShouldBeNil)
+
+			mf, err = simpleMongoFilesInstanceCommandOnly(ImportArchive)
+			So(err, ShouldBeNil)
+			mf.ArchiveName = archiveName
+			_, err = mf.Run(false)
+			So(err, ShouldBeNil)
+
+			filesGotten, err := getFilesAndBytesListFromGridFS()
+			So(err, ShouldBeNil)
+			So(filesGotten, ShouldResemble, bytesExpected)
+
+			mf, err = simpleMongoFilesInstanceWithID(DeleteID, idOfFile("testfile1"))
+			So(err, ShouldBeNil)
+			_, err = mf.Run(false)
+			So(err, ShouldBeNil)
+		}
+	})
+}
@@ -0,0 +1,181 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/password"
+	"github.com/mongodb/mongo-tools/common/text"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// deleteBatchSize is the number of files whose files and chunks documents
+// are removed together by a bulk delete.
+const deleteBatchSize = 100
+
+// hasDeleteSelectors returns whether the files to delete are selected by
+// --regex, --olderThan or --query rather than only by filename.
+func (mf *MongoFiles) hasDeleteSelectors() bool {
+	opts := mf.StorageOptions
+	return opts.Regex != "" || opts.OlderThan != "" || opts.Query != ""
+}
+
+// parseAge parses a duration such as 30d, 12h or 90m; d is taken to be 24
+// hours.
+func parseAge(age string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+	if days := strings.TrimSuffix(age, "d"); days != age {
+		var n float64
+		n, err = strconv.ParseFloat(days, 64)
+		d = time.Duration(n * float64(24*time.Hour))
+	} else {
+		d, err = time.ParseDuration(age)
+	}
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid --olderThan '%v': must be a positive duration such as 30d or 12h", age)
+	}
+	return d, nil
+}
+
+// deleteQuery returns the query on the files collection that selects the
+// files to delete, as of now.
+func (mf *MongoFiles) deleteQuery(now time.Time) (bson.M, error) {
+	opts := mf.StorageOptions
+	var query bson.D
+	if mf.FileName != "" {
+		query = append(query, bson.E{Key: "filename", Value: mf.FileName})
+	}
+	if opts.Regex != "" {
+		query = append(query, bson.E{Key: "filename", Value: bson.D{
+			{Key: "$regex", Value: opts.Regex},
+			{Key: "$options", Value: opts.RegexOptions},
+		}})
+	}
+	if opts.OlderThan != "" {
+		age, err := parseAge(opts.OlderThan)
+		if err != nil {
+			return nil, err
+		}
+		query = append(query, bson.E{Key: "uploadDate", Value: bson.D{{Key: "$lt", Value: now.Add(-age)}}})
+	}
+	if opts.Query != "" {
+		var filter bson.D
+		if err := bson.UnmarshalExtJSON([]byte(opts.Query), false, &filter); err != nil {
+			return nil, fmt.Errorf("error parsing --query: %v", err)
+		}
+		query = append(query, filter...)
+	}
+
+	// each selector is a clause of its own, so that selectors on the same
+	// field, such as a filename and a --regex, must all match
+	clauses := make(bson.A, 0, len(query))
+	for _, elem := range query {
+		clauses = append(clauses, bson.D{elem})
+	}
+	return bson.M{"$and": clauses}, nil
+}
+
+// confirm asks the user whether to go ahead with prompt, returning true if
+// they answer yes. It fails rather than asking if standard input is not a
+// terminal, unless an input was set for testing.
+func (mf *MongoFiles) confirm(prompt string) (bool, error) {
+	in := mf.confirmInput
+	if in == nil {
+		if !password.IsTerminal() {
+			return false, fmt.Errorf("cannot ask for confirmation since standard input is not a terminal; use --yes to delete without confirmation")
+		}
+		in = os.Stdin
+	}
+	fmt.Fprintf(os.Stderr, "%v [y/N] ", prompt)
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+// handleBulkDelete contains the logic for the 'delete' command with
+// --regex, --olderThan or --query: it lists the selected files, asks for
+// confirmation unless --yes is set, and deletes their files and chunks
+// documents in batches. With --dryRun, it only lists them.
+func (mf *MongoFiles) handleBulkDelete() (string, error) {
+	query, err := mf.deleteQuery(time.Now())
+	if err != nil {
+		return "", err
+	}
+	gridFiles, err := mf.findGFSFiles(query)
+	if err != nil {
+		return "", fmt.Errorf("error retrieving list of GridFS files: %v", err)
+	}
+
+	var listing string
+	var total int64
+	for _, gridFile := range gridFiles {
+		listing += fmt.Sprintf("%s\t%d\t%s\n", gridFile.Name, gridFile.Length, gridFile.UploadDate.UTC().Format(time.RFC3339))
+		total += gridFile.Length
+	}
+	summary := fmt.Sprintf("%v files (%v)", len(gridFiles), text.FormatByteAmount(total))
+
+	if mf.StorageOptions.DryRun {
+		log.Logvf(log.Always, "dry run: would delete %v", summary)
+		return listing, nil
+	}
+	if len(gridFiles) == 0 {
+		log.Logv(log.Always, "no files matched; nothing deleted")
+		return "", nil
+	}
+	if !mf.StorageOptions.Yes {
+		fmt.Fprint(os.Stderr, listing)
+		ok, err := mf.confirm(fmt.Sprintf("delete %v from GridFS?", summary))
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			log.Logv(log.Always, "not confirmed; nothing deleted")
+			return "", nil
+		}
+	}
+
+	filesColl := mf.bucket.GetFilesCollection()
+	chunksColl := mf.bucket.GetChunksCollection()
+	var deleted int64
+	for start := 0; start < len(gridFiles); start += deleteBatchSize {
+		end := start + deleteBatchSize
+		if end > len(gridFiles) {
+			end = len(gridFiles)
+		}
+		ids := make(bson.A, 0, end-start)
+		for _, gridFile := range gridFiles[start:end] {
+			ids = append(ids, gridFile.ID)
+		}
+
+		// remove the files documents first, as the driver does, so that a
+		// failure leaves orphaned chunks rather than files missing chunks
+		result, err := filesColl.DeleteMany(context.Background(), bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}})
+		if err != nil {
+			return "", fmt.Errorf("error deleting files after %v of %v were deleted: %v", deleted, len(gridFiles), err)
+		}
+		if _, err = chunksColl.DeleteMany(context.Background(), bson.D{{Key: "files_id", Value: bson.D{{Key: "$in", Value: ids}}}}); err != nil {
+			return "", fmt.Errorf("error deleting chunks after %v of %v files were deleted: %v", deleted, len(gridFiles), err)
+		}
+		deleted += result.DeletedCount
+		log.Logvf(log.Info, "deleted %v of %v files", deleted, len(gridFiles))
+	}
+	log.Logvf(log.Always, "successfully deleted %v of %v from GridFS", deleted, summary)
+	return "", nil
+}
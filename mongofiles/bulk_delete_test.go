@@ -0,0 +1,148 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseAge(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Ages should be parsed in days or as Go durations", t, func() {
+		age, err := parseAge("30d")
+		So(err, ShouldBeNil)
+		So(age, ShouldEqual, 30*24*time.Hour)
+
+		age, err = parseAge("1h30m")
+		So(err, ShouldBeNil)
+		So(age, ShouldEqual, 90*time.Minute)
+
+		for _, invalid := range []string{"", "d", "30", "-1d", "0h", "soon"} {
+			_, err = parseAge(invalid)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestDeleteQuery(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With delete selectors", t, func() {
+		mf := &MongoFiles{StorageOptions: &StorageOptions{
+			GridFSPrefix: "fs",
+			Regex:        "tmp/.*",
+			OlderThan:    "30d",
+			Query:        `{"metadata.owner": "etl"}`,
+		}}
+		now := time.Date(2020, time.March, 31, 0, 0, 0, 0, time.UTC)
+
+		Convey("each selector is a clause of the query", func() {
+			So(mf.ValidateCommand([]string{Delete}), ShouldBeNil)
+			query, err := mf.deleteQuery(now)
+			So(err, ShouldBeNil)
+			So(query, ShouldResemble, bson.M{"$and": bson.A{
+				bson.D{{Key: "filename", Value: bson.D{{Key: "$regex", Value: "tmp/.*"}, {Key: "$options", Value: ""}}}},
+				bson.D{{Key: "uploadDate", Value: bson.D{{Key: "$lt", Value: time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)}}}},
+				bson.D{{Key: "metadata.owner", Value: "etl"}},
+			}})
+		})
+
+		Convey("a filename must match as well", func() {
+			So(mf.ValidateCommand([]string{Delete, "tmp/a"}), ShouldBeNil)
+			query, err := mf.deleteQuery(now)
+			So(err, ShouldBeNil)
+			So(query["$and"].(bson.A)[0], ShouldResemble, bson.D{{Key: "filename", Value: "tmp/a"}})
+		})
+
+		Convey("invalid selectors are rejected", func() {
+			mf.StorageOptions.OlderThan = "a month"
+			So(mf.ValidateCommand([]string{Delete}), ShouldNotBeNil)
+			mf.StorageOptions.OlderThan = ""
+			mf.StorageOptions.Query = "{owner"
+			So(mf.ValidateCommand([]string{Delete}), ShouldNotBeNil)
+		})
+
+		Convey("selectors are only accepted with delete", func() {
+			So(mf.ValidateCommand([]string{List}), ShouldNotBeNil)
+		})
+	})
+
+	Convey("--dryRun and --yes should need selectors", t, func() {
+		mf := &MongoFiles{StorageOptions: &StorageOptions{GridFSPrefix: "fs", DryRun: true}}
+		So(mf.ValidateCommand([]string{Delete, "file"}), ShouldNotBeNil)
+		So(mf.ValidateCommand([]string{Delete}), ShouldNotBeNil)
+	})
+}
+
+func TestConfirm(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Only a yes should confirm", t, func() {
+		for answer, confirmed := range map[string]bool{"y\n": true, "YES": true, "n\n": false, "\n": false, "": false} {
+			mf := &MongoFiles{confirmInput: strings.NewReader(answer)}
+			ok, err := mf.confirm("delete?")
+			So(err, ShouldBeNil)
+			So(ok, ShouldEqual, confirmed)
+		}
+	})
+}
+
+func TestBulkDelete(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.IntegrationTestType)
+
+	Convey("With files in GridFS", t, func() {
+		bytesExpected, err := setUpGridFSTestData()
+		So(err, ShouldBeNil)
+		defer tearDownGridFSTestData()
+
+		mf, err := simpleMongoFilesInstanceCommandOnly(Delete)
+		So(err, ShouldBeNil)
+		mf.StorageOptions.Regex = "^testfile[12]$"
+
+		Convey("a dry run should list the selected files without deleting them", func() {
+			mf.StorageOptions.DryRun = true
+			output, err := mf.Run(false)
+			So(err, ShouldBeNil)
+			So(output, ShouldContainSubstring, "testfile1\t")
+			So(output, ShouldContainSubstring, "testfile2\t")
+			So(output, ShouldNotContainSubstring, "testfile3")
+
+			filesGotten, err := getFilesAndBytesListFromGridFS()
+			So(err, ShouldBeNil)
+			So(filesGotten, ShouldResemble, bytesExpected)
+		})
+
+		Convey("nothing should be deleted unless confirmed", func() {
+			mf.confirmInput = strings.NewReader("n\n")
+			_, err := mf.Run(false)
+			So(err, ShouldBeNil)
+
+			filesGotten, err := getFilesAndBytesListFromGridFS()
+			So(err, ShouldBeNil)
+			So(filesGotten, ShouldResemble, bytesExpected)
+		})
+
+		Convey("the selected files should be deleted once confirmed", func() {
+			mf.confirmInput = strings.NewReader("y\n")
+			_, err := mf.Run(false)
+			So(err, ShouldBeNil)
+
+			filesGotten, err := getFilesAndBytesListFromGridFS()
+			So(err, ShouldBeNil)
+			So(filesGotten, ShouldNotContainKey, "testfile1")
+			So(filesGotten, ShouldNotContainKey, "testfile2")
+			So(filesGotten["testfile3"], ShouldEqual, bytesExpected["testfile3"])
+		})
+	})
+}
@@ -0,0 +1,235 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	driverOptions "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// chunkCopyBatchSize is the number of chunk documents inserted at a time by
+// 'cp'. At the default chunk size of 255 KiB a batch is about 16 MB.
+const chunkCopyBatchSize = 64
+
+// getRevisions returns the files named filename, newest first. Unless
+// --all-revisions is set, only the newest revision is returned.
+func (mf *MongoFiles) getRevisions(filename string) (files []*gfsFile, err error) {
+	opts := driverOptions.GridFSFind().SetSort(bson.D{{Key: "uploadDate", Value: -1}, {Key: "_id", Value: -1}})
+	if !mf.StorageOptions.AllRevisions {
+		opts.SetLimit(1)
+	}
+	cursor, err := mf.bucket.Find(bson.M{"filename": filename}, opts)
+	if err != nil {
+		return nil, err
+	}
+	dc := util.DeferredCloser{Closer: &util.CloserCursor{Cursor: cursor}}
+	defer dc.CloseWithErrorCapture(&err)
+
+	for cursor.Next(context.Background()) {
+		var out *gfsFile
+		if out, err = newGfsFileFromCursor(cursor, mf); err != nil {
+			return nil, err
+		}
+		files = append(files, out)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no such file with name: %v", filename)
+	}
+	return files, nil
+}
+
+// deleteFilesIn deletes the files named filename from the files and chunks
+// collections of a bucket, for --replace.
+func deleteFilesIn(filesColl, chunksColl *mongo.Collection, filename string) error {
+	cursor, err := filesColl.Find(context.Background(), bson.M{"filename": filename})
+	if err != nil {
+		return err
+	}
+	var ids []interface{}
+	for cursor.Next(context.Background()) {
+		ids = append(ids, cursor.Current.Lookup("_id"))
+	}
+	if err = cursor.Close(context.Background()); err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	if _, err = chunksColl.DeleteMany(context.Background(), bson.M{"files_id": bson.M{"$in": ids}}); err != nil {
+		return err
+	}
+	_, err = filesColl.DeleteMany(context.Background(), bson.M{"_id": bson.M{"$in": ids}})
+	return err
+}
+
+// handleMove contains the logic for the 'mv' command, which renames files by
+// updating their files collection documents in place.
+func (mf *MongoFiles) handleMove() error {
+	files, err := mf.getRevisions(mf.FileName)
+	if err != nil {
+		return err
+	}
+
+	if mf.StorageOptions.Replace {
+		err = deleteFilesIn(mf.bucket.GetFilesCollection(), mf.bucket.GetChunksCollection(), mf.NewFileName)
+		if err != nil {
+			return fmt.Errorf("error while removing '%v' from GridFS: %v", mf.NewFileName, err)
+		}
+	}
+
+	for _, file := range files {
+		if err = mf.bucket.Rename(file.ID, mf.NewFileName); err != nil {
+			return fmt.Errorf("error while renaming '%v': %v", mf.FileName, err)
+		}
+	}
+	log.Logvf(log.Always, "renamed %v revision(s) of '%v' to '%v'", len(files), mf.FileName, mf.NewFileName)
+	return nil
+}
+
+// handleCopy contains the logic for the 'cp' command, which copies files to
+// a new name, in the same bucket or the one given by --toBucket, by copying
+// their files and chunks documents rather than downloading and re-uploading
+// their contents.
+func (mf *MongoFiles) handleCopy() error {
+	files, err := mf.getRevisions(mf.FileName)
+	if err != nil {
+		return err
+	}
+
+	database := mf.bucket.GetFilesCollection().Database()
+	filesColl, chunksColl := mf.bucket.GetFilesCollection(), mf.bucket.GetChunksCollection()
+	if mf.StorageOptions.ToBucket != "" {
+		filesColl = database.Collection(mf.StorageOptions.ToBucket + ".files")
+		chunksColl = database.Collection(mf.StorageOptions.ToBucket + ".chunks")
+		if err = createBucketIndexes(filesColl, chunksColl); err != nil {
+			return fmt.Errorf("error creating indexes for GridFS bucket '%v': %v", mf.StorageOptions.ToBucket, err)
+		}
+	}
+
+	if mf.StorageOptions.Replace {
+		if err = deleteFilesIn(filesColl, chunksColl, mf.NewFileName); err != nil {
+			return fmt.Errorf("error while removing '%v' from GridFS: %v", mf.NewFileName, err)
+		}
+	}
+
+	// copy the oldest revision first so that revisions keep their order
+	for i := len(files) - 1; i >= 0; i-- {
+		if err = mf.copyFile(files[i].ID, filesColl, chunksColl); err != nil {
+			return err
+		}
+	}
+	log.Logvf(log.Always, "copied %v revision(s) of '%v' to '%v'", len(files), mf.FileName, mf.NewFileName)
+	return nil
+}
+
+// copyFile copies the file with the given _id to a new file named
+// mf.NewFileName. The files document is inserted after all of the chunks so
+// the copy only becomes visible once it is complete; on failure, the chunks
+// already copied are removed.
+func (mf *MongoFiles) copyFile(id interface{}, filesColl, chunksColl *mongo.Collection) (err error) {
+	var fileDoc bson.D
+	err = mf.bucket.GetFilesCollection().FindOne(context.Background(), bson.M{"_id": id}).Decode(&fileDoc)
+	if err != nil {
+		return fmt.Errorf("error reading '%v': %v", mf.FileName, err)
+	}
+
+	newID := primitive.NewObjectID()
+	defer func() {
+		if err != nil {
+			if _, cleanupErr := chunksColl.DeleteMany(context.Background(), bson.M{"files_id": newID}); cleanupErr != nil {
+				log.Logvf(log.Always, "error removing partially copied chunks of '%v': %v", mf.NewFileName, cleanupErr)
+			}
+		}
+	}()
+
+	cursor, err := mf.bucket.GetChunksCollection().Find(context.Background(), bson.M{"files_id": id},
+		driverOptions.Find().SetSort(bson.D{{Key: "n", Value: 1}}))
+	if err != nil {
+		return fmt.Errorf("error reading chunks of '%v': %v", mf.FileName, err)
+	}
+	dc := util.DeferredCloser{Closer: &util.CloserCursor{Cursor: cursor}}
+	defer dc.CloseWithErrorCapture(&err)
+
+	batch := make([]interface{}, 0, chunkCopyBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := chunksColl.InsertMany(context.Background(), batch)
+		batch = batch[:0]
+		return err
+	}
+	for cursor.Next(context.Background()) {
+		var chunk bson.D
+		if err = cursor.Decode(&chunk); err != nil {
+			return fmt.Errorf("error reading chunks of '%v': %v", mf.FileName, err)
+		}
+		batch = append(batch, withFields(chunk, bson.E{Key: "_id", Value: primitive.NewObjectID()},
+			bson.E{Key: "files_id", Value: newID}))
+		if len(batch) == chunkCopyBatchSize {
+			if err = flush(); err != nil {
+				return fmt.Errorf("error copying chunks of '%v': %v", mf.FileName, err)
+			}
+		}
+	}
+	if err = cursor.Err(); err != nil {
+		return fmt.Errorf("error reading chunks of '%v': %v", mf.FileName, err)
+	}
+	if err = flush(); err != nil {
+		return fmt.Errorf("error copying chunks of '%v': %v", mf.FileName, err)
+	}
+
+	fileDoc = withFields(fileDoc, bson.E{Key: "_id", Value: newID}, bson.E{Key: "filename", Value: mf.NewFileName})
+	if _, err = filesColl.InsertOne(context.Background(), fileDoc); err != nil {
+		return fmt.Errorf("error copying '%v': %v", mf.FileName, err)
+	}
+	return nil
+}
+
+// withFields returns a copy of doc with the given fields set, replacing any
+// existing values in place.
+func withFields(doc bson.D, fields ...bson.E) bson.D {
+	out := make(bson.D, len(doc), len(doc)+len(fields))
+	copy(out, doc)
+	for _, field := range fields {
+		replaced := false
+		for i := range out {
+			if out[i].Key == field.Key {
+				out[i].Value = field.Value
+				replaced = true
+			}
+		}
+		if !replaced {
+			out = append(out, field)
+		}
+	}
+	return out
+}
+
+// createBucketIndexes creates the indexes the GridFS spec requires on a
+// bucket's collections, which the driver would otherwise only create on the
+// first upload to the bucket.
+func createBucketIndexes(filesColl, chunksColl *mongo.Collection) error {
+	_, err := filesColl.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{Key: "filename", Value: 1}, {Key: "uploadDate", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = chunksColl.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "files_id", Value: 1}, {Key: "n", Value: 1}},
+		Options: driverOptions.Index().SetUnique(true),
+	})
+	return err
+}
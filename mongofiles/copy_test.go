@@ -0,0 +1,77 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestWithFields(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("withFields should replace existing fields in place and append new ones", t, func() {
+		doc := bson.D{{Key: "_id", Value: 1}, {Key: "n", Value: 0}}
+		out := withFields(doc, bson.E{Key: "_id", Value: 2}, bson.E{Key: "files_id", Value: 3})
+		So(out, ShouldResemble, bson.D{{Key: "_id", Value: 2}, {Key: "n", Value: 0}, {Key: "files_id", Value: 3}})
+		So(doc[0].Value, ShouldEqual, 1)
+	})
+}
+
+func TestMoveAndCopyCommands(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.IntegrationTestType)
+
+	Convey("With files in GridFS", t, func() {
+		bytesExpected, err := setUpGridFSTestData()
+		So(err, ShouldBeNil)
+		defer tearDownGridFSTestData()
+
+		Convey("mv should rename a file without changing its contents", func() {
+			mf, err := simpleMongoFilesInstanceCommandOnly(Move)
+			So(err, ShouldBeNil)
+			mf.FileName, mf.NewFileName = "testfile1", "renamed"
+			_, err = mf.Run(false)
+			So(err, ShouldBeNil)
+
+			filesGotten, err := getFilesAndBytesListFromGridFS()
+			So(err, ShouldBeNil)
+			So(filesGotten, ShouldNotContainKey, "testfile1")
+			So(filesGotten["renamed"], ShouldEqual, bytesExpected["testfile1"])
+		})
+
+		Convey("cp should copy a file into another bucket", func() {
+			mf, err := simpleMongoFilesInstanceCommandOnly(Copy)
+			So(err, ShouldBeNil)
+			mf.FileName, mf.NewFileName = "testfile2", "copied"
+			mf.StorageOptions.ToBucket = "other"
+			_, err = mf.Run(false)
+			So(err, ShouldBeNil)
+
+			mf, err = simpleMongoFilesInstanceWithFilename(Get, "copied")
+			So(err, ShouldBeNil)
+			mf.StorageOptions.GridFSPrefix = "other"
+			mf.StorageOptions.LocalFileName = "copied_testfile2"
+			_, err = mf.Run(false)
+			So(err, ShouldBeNil)
+			So(fileExists("copied_testfile2"), ShouldBeTrue)
+			defer os.Remove("copied_testfile2")
+
+			contents, err := ioutil.ReadFile("copied_testfile2")
+			So(err, ShouldBeNil)
+			So(len(contents), ShouldEqual, bytesExpected["testfile2"])
+
+			filesGotten, err := getFilesAndBytesListFromGridFS()
+			So(err, ShouldBeNil)
+			So(filesGotten, ShouldResemble, bytesExpected)
+		})
+	})
+}
@@ -0,0 +1,639 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// +build linux
+
+package mongofiles
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"unsafe"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"golang.org/x/sys/unix"
+)
+
+// This file implements the subset of the FUSE kernel protocol needed to serve
+// a gridfsTree read-only. See linux/fuse.h for the protocol definition.
+
+const (
+	fuseMajorVersion = 7
+	// fuseMinorVersion is the newest protocol minor version spoken; the
+	// kernel's version is used if it is older.
+	fuseMinorVersion = 26
+	// fuseMinKernelMinorVersion is the oldest kernel protocol minor version
+	// whose message layouts match the ones below.
+	fuseMinKernelMinorVersion = 12
+	// fuseCompatInitOutSize is the size of the INIT reply before 7.23.
+	fuseCompatInitOutSize = 24
+
+	fuseMaxWrite   = 128 * 1024
+	fuseBufferSize = fuseMaxWrite + 4096
+
+	// fuseCacheTimeout is how long, in seconds, the kernel may cache entries
+	// and attributes. The tree never changes while mounted.
+	fuseCacheTimeout = 60
+
+	fuseOpenKeepCache = 1 << 1
+)
+
+// FUSE request opcodes.
+const (
+	fuseOpLookup      = 1
+	fuseOpForget      = 2
+	fuseOpGetattr     = 3
+	fuseOpSetattr     = 4
+	fuseOpSymlink     = 6
+	fuseOpMknod       = 8
+	fuseOpMkdir       = 9
+	fuseOpUnlink      = 10
+	fuseOpRmdir       = 11
+	fuseOpRename      = 12
+	fuseOpLink        = 13
+	fuseOpOpen        = 14
+	fuseOpRead        = 15
+	fuseOpWrite       = 16
+	fuseOpStatfs      = 17
+	fuseOpRelease     = 18
+	fuseOpFsync       = 20
+	fuseOpSetxattr    = 21
+	fuseOpRemovexattr = 24
+	fuseOpFlush       = 25
+	fuseOpInit        = 26
+	fuseOpOpendir     = 27
+	fuseOpReaddir     = 28
+	fuseOpReleasedir  = 29
+	fuseOpFsyncdir    = 30
+	fuseOpAccess      = 34
+	fuseOpCreate      = 35
+	fuseOpInterrupt   = 36
+	fuseOpDestroy     = 38
+	fuseOpBatchForget = 42
+	fuseOpFallocate   = 43
+	fuseOpRename2     = 45
+)
+
+type fuseInHeader struct {
+	Len     uint32
+	Opcode  uint32
+	Unique  uint64
+	NodeID  uint64
+	UID     uint32
+	GID     uint32
+	PID     uint32
+	Padding uint32
+}
+
+type fuseOutHeader struct {
+	Len    uint32
+	Error  int32
+	Unique uint64
+}
+
+type fuseInitIn struct {
+	Major        uint32
+	Minor        uint32
+	MaxReadahead uint32
+	Flags        uint32
+}
+
+type fuseInitOut struct {
+	Major               uint32
+	Minor               uint32
+	MaxReadahead        uint32
+	Flags               uint32
+	MaxBackground       uint16
+	CongestionThreshold uint16
+	MaxWrite            uint32
+	TimeGran            uint32
+	MaxPages            uint16
+	MapAlignment        uint16
+	Flags2              uint32
+	Unused              [7]uint32
+}
+
+type fuseAttr struct {
+	Ino       uint64
+	Size      uint64
+	Blocks    uint64
+	Atime     uint64
+	Mtime     uint64
+	Ctime     uint64
+	Atimensec uint32
+	Mtimensec uint32
+	Ctimensec uint32
+	Mode      uint32
+	Nlink     uint32
+	UID       uint32
+	GID       uint32
+	Rdev      uint32
+	Blksize   uint32
+	Flags     uint32
+}
+
+type fuseEntryOut struct {
+	NodeID         uint64
+	Generation     uint64
+	EntryValid     uint64
+	AttrValid      uint64
+	EntryValidNsec uint32
+	AttrValidNsec  uint32
+	Attr           fuseAttr
+}
+
+type fuseAttrOut struct {
+	AttrValid     uint64
+	AttrValidNsec uint32
+	Dummy         uint32
+	Attr          fuseAttr
+}
+
+type fuseOpenIn struct {
+	Flags  uint32
+	Unused uint32
+}
+
+type fuseOpenOut struct {
+	Fh        uint64
+	OpenFlags uint32
+	Padding   uint32
+}
+
+type fuseReadIn struct {
+	Fh        uint64
+	Offset    uint64
+	Size      uint32
+	ReadFlags uint32
+	LockOwner uint64
+	Flags     uint32
+	Padding   uint32
+}
+
+type fuseReleaseIn struct {
+	Fh           uint64
+	Flags        uint32
+	ReleaseFlags uint32
+	LockOwner    uint64
+}
+
+type fuseAccessIn struct {
+	Mask    uint32
+	Padding uint32
+}
+
+type fuseStatfsOut struct {
+	Blocks  uint64
+	Bfree   uint64
+	Bavail  uint64
+	Files   uint64
+	Ffree   uint64
+	Bsize   uint32
+	Namelen uint32
+	Frsize  uint32
+	Padding uint32
+	Spare   [6]uint32
+}
+
+type fuseDirent struct {
+	Ino     uint64
+	Off     uint64
+	Namelen uint32
+	Type    uint32
+}
+
+// structBytes returns the memory of the struct at p, of the given size, for
+// writing it to the FUSE device.
+func structBytes(p unsafe.Pointer, size uintptr) []byte {
+	return (*[1 << 16]byte)(p)[:size:size]
+}
+
+// fuseConn serves a gridfsTree over a connection to the FUSE device.
+type fuseConn struct {
+	fd         int
+	mountPoint string
+	// fusermount is the helper the filesystem was mounted with, or "" if
+	// it was mounted directly.
+	fusermount string
+
+	tree     *gridfsTree
+	uid, gid uint32
+
+	handlesLock sync.Mutex
+	handles     map[uint64]*gridfsFileReader
+	nextHandle  uint64
+
+	requests sync.WaitGroup
+}
+
+// mountReadOnly mounts tree read-only at mountPoint, directly when running
+// as root and with the fusermount helper otherwise.
+func mountReadOnly(mountPoint string, tree *gridfsTree) (mountedFS, error) {
+	mountPoint, err := filepath.Abs(mountPoint)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(mountPoint)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%v is not a directory", mountPoint)
+	}
+
+	c := &fuseConn{
+		mountPoint: mountPoint,
+		tree:       tree,
+		uid:        uint32(os.Getuid()),
+		gid:        uint32(os.Getgid()),
+		handles:    map[uint64]*gridfsFileReader{},
+	}
+	if os.Geteuid() == 0 {
+		err = c.mountDirect()
+	} else {
+		err = c.mountWithFusermount()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *fuseConn) mountDirect() error {
+	fd, err := unix.Open("/dev/fuse", unix.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("error opening /dev/fuse: %v", err)
+	}
+	data := fmt.Sprintf("fd=%d,rootmode=%o,user_id=%d,group_id=%d,default_permissions", fd, unix.S_IFDIR, c.uid, c.gid)
+	err = unix.Mount("mongofiles", c.mountPoint, "fuse.mongofiles", unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV, data)
+	if err != nil {
+		_ = unix.Close(fd)
+		return err
+	}
+	c.fd = fd
+	return nil
+}
+
+// mountWithFusermount mounts with the setuid fusermount helper, which passes
+// back the opened FUSE device over a socket.
+func (c *fuseConn) mountWithFusermount() error {
+	helper, err := exec.LookPath("fusermount3")
+	if err != nil {
+		helper, err = exec.LookPath("fusermount")
+	}
+	if err != nil {
+		return fmt.Errorf("fusermount is required to mount without root privileges: %v", err)
+	}
+
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("error creating socket for fusermount: %v", err)
+	}
+	local := os.NewFile(uintptr(fds[0]), "fusermount socket")
+	remote := os.NewFile(uintptr(fds[1]), "fusermount socket")
+	defer local.Close()
+
+	cmd := exec.Command(helper, "-o", "ro,default_permissions,fsname=mongofiles,subtype=mongofiles", "--", c.mountPoint)
+	cmd.Env = append(os.Environ(), "_FUSE_COMMFD=3")
+	cmd.ExtraFiles = []*os.File{remote}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	_ = remote.Close()
+	if err != nil {
+		return fmt.Errorf("%v failed: %v: %v", helper, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	oob := make([]byte, unix.CmsgSpace(4))
+	_, oobn, _, _, err := unix.Recvmsg(int(local.Fd()), make([]byte, 1), oob, 0)
+	if err != nil {
+		return fmt.Errorf("error receiving FUSE device from fusermount: %v", err)
+	}
+	messages, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(messages) == 0 {
+		return fmt.Errorf("fusermount did not pass back the FUSE device")
+	}
+	devices, err := unix.ParseUnixRights(&messages[0])
+	if err != nil || len(devices) == 0 {
+		return fmt.Errorf("fusermount did not pass back the FUSE device")
+	}
+	c.fd = devices[0]
+	c.fusermount = helper
+	return nil
+}
+
+// unmount lazily detaches the filesystem, so that it succeeds even while
+// files in it are open.
+func (c *fuseConn) unmount() error {
+	if c.fusermount == "" {
+		return unix.Unmount(c.mountPoint, unix.MNT_DETACH)
+	}
+	output, err := exec.Command(c.fusermount, "-u", "-z", "--", c.mountPoint).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+// serve reads requests from the FUSE device and answers each of them in its
+// own goroutine, until the filesystem is unmounted.
+func (c *fuseConn) serve() error {
+	defer func() {
+		c.requests.Wait()
+		_ = unix.Close(c.fd)
+	}()
+
+	buf := make([]byte, fuseBufferSize)
+	headerSize := int(unsafe.Sizeof(fuseInHeader{}))
+	for {
+		n, err := unix.Read(c.fd, buf)
+		switch err {
+		case nil:
+		case unix.EINTR, unix.EAGAIN, unix.ENOENT:
+			// the request was interrupted before it was read
+			continue
+		case unix.ENODEV:
+			return nil
+		default:
+			return fmt.Errorf("error reading from FUSE device: %v", err)
+		}
+		if n < headerSize {
+			return fmt.Errorf("short read of %v bytes from FUSE device", n)
+		}
+
+		msg := append([]byte(nil), buf[:n]...)
+		header := (*fuseInHeader)(unsafe.Pointer(&msg[0]))
+		body := msg[headerSize:]
+		switch header.Opcode {
+		case fuseOpInit:
+			if err = c.init(header, body); err != nil {
+				return err
+			}
+		case fuseOpDestroy:
+			c.reply(header, 0, nil)
+			return nil
+		default:
+			c.requests.Add(1)
+			go func() {
+				defer c.requests.Done()
+				c.handle(header, body)
+			}()
+		}
+	}
+}
+
+func (c *fuseConn) init(header *fuseInHeader, body []byte) error {
+	if len(body) < int(unsafe.Sizeof(fuseInitIn{})) {
+		return fmt.Errorf("short FUSE INIT request")
+	}
+	in := (*fuseInitIn)(unsafe.Pointer(&body[0]))
+	if in.Major != fuseMajorVersion || in.Minor < fuseMinKernelMinorVersion {
+		c.reply(header, unix.EPROTO, nil)
+		return fmt.Errorf("unsupported FUSE protocol version %v.%v", in.Major, in.Minor)
+	}
+
+	out := fuseInitOut{
+		Major:        fuseMajorVersion,
+		Minor:        fuseMinorVersion,
+		MaxReadahead: in.MaxReadahead,
+		MaxWrite:     fuseMaxWrite,
+	}
+	size := unsafe.Sizeof(out)
+	if in.Minor < fuseMinorVersion {
+		out.Minor = in.Minor
+	}
+	if out.Minor < 23 {
+		size = fuseCompatInitOutSize
+	}
+	c.reply(header, 0, structBytes(unsafe.Pointer(&out), size))
+	return nil
+}
+
+// handle answers a single request.
+func (c *fuseConn) handle(header *fuseInHeader, body []byte) {
+	switch header.Opcode {
+	case fuseOpForget, fuseOpBatchForget, fuseOpInterrupt:
+		// these get no reply; inode numbers stay valid while mounted
+
+	case fuseOpLookup:
+		dir := c.tree.node(header.NodeID)
+		if dir == nil {
+			c.reply(header, unix.ENOENT, nil)
+			return
+		}
+		if dir.file != nil {
+			c.reply(header, unix.ENOTDIR, nil)
+			return
+		}
+		node := dir.byName[string(bytes.TrimRight(body, "\x00"))]
+		if node == nil {
+			c.reply(header, unix.ENOENT, nil)
+			return
+		}
+		out := fuseEntryOut{
+			NodeID:     node.ino,
+			EntryValid: fuseCacheTimeout,
+			AttrValid:  fuseCacheTimeout,
+			Attr:       c.attr(node),
+		}
+		c.reply(header, 0, structBytes(unsafe.Pointer(&out), unsafe.Sizeof(out)))
+
+	case fuseOpGetattr:
+		node := c.tree.node(header.NodeID)
+		if node == nil {
+			c.reply(header, unix.ENOENT, nil)
+			return
+		}
+		out := fuseAttrOut{AttrValid: fuseCacheTimeout, Attr: c.attr(node)}
+		c.reply(header, 0, structBytes(unsafe.Pointer(&out), unsafe.Sizeof(out)))
+
+	case fuseOpOpen:
+		node := c.tree.node(header.NodeID)
+		if node == nil || len(body) < int(unsafe.Sizeof(fuseOpenIn{})) {
+			c.reply(header, unix.ENOENT, nil)
+			return
+		}
+		if node.file == nil {
+			c.reply(header, unix.EISDIR, nil)
+			return
+		}
+		in := (*fuseOpenIn)(unsafe.Pointer(&body[0]))
+		if in.Flags&unix.O_ACCMODE != unix.O_RDONLY {
+			c.reply(header, unix.EROFS, nil)
+			return
+		}
+		c.handlesLock.Lock()
+		c.nextHandle++
+		out := fuseOpenOut{Fh: c.nextHandle, OpenFlags: fuseOpenKeepCache}
+		c.handles[out.Fh] = newGridFSFileReader(node.file, c.tree.readChunk)
+		c.handlesLock.Unlock()
+		c.reply(header, 0, structBytes(unsafe.Pointer(&out), unsafe.Sizeof(out)))
+
+	case fuseOpRead:
+		if len(body) < int(unsafe.Sizeof(fuseReadIn{})) {
+			c.reply(header, unix.EINVAL, nil)
+			return
+		}
+		in := (*fuseReadIn)(unsafe.Pointer(&body[0]))
+		c.handlesLock.Lock()
+		reader := c.handles[in.Fh]
+		c.handlesLock.Unlock()
+		if reader == nil {
+			c.reply(header, unix.EBADF, nil)
+			return
+		}
+		data := make([]byte, in.Size)
+		n, err := reader.readAt(data, int64(in.Offset))
+		if err != nil {
+			log.Logvf(log.Always, "error reading '%v': %v", reader.file.Name, err)
+			c.reply(header, unix.EIO, nil)
+			return
+		}
+		c.reply(header, 0, data[:n])
+
+	case fuseOpRelease:
+		if len(body) >= int(unsafe.Sizeof(fuseReleaseIn{})) {
+			in := (*fuseReleaseIn)(unsafe.Pointer(&body[0]))
+			c.handlesLock.Lock()
+			delete(c.handles, in.Fh)
+			c.handlesLock.Unlock()
+		}
+		c.reply(header, 0, nil)
+
+	case fuseOpOpendir:
+		node := c.tree.node(header.NodeID)
+		if node == nil {
+			c.reply(header, unix.ENOENT, nil)
+			return
+		}
+		if node.file != nil {
+			c.reply(header, unix.ENOTDIR, nil)
+			return
+		}
+		out := fuseOpenOut{}
+		c.reply(header, 0, structBytes(unsafe.Pointer(&out), unsafe.Sizeof(out)))
+
+	case fuseOpReaddir:
+		node := c.tree.node(header.NodeID)
+		if node == nil || node.file != nil || len(body) < int(unsafe.Sizeof(fuseReadIn{})) {
+			c.reply(header, unix.ENOTDIR, nil)
+			return
+		}
+		in := (*fuseReadIn)(unsafe.Pointer(&body[0]))
+		c.reply(header, 0, c.readdir(node, in.Offset, int(in.Size)))
+
+	case fuseOpStatfs:
+		out := fuseStatfsOut{Files: uint64(len(c.tree.nodes)), Bsize: 512, Frsize: 512, Namelen: 255}
+		for _, node := range c.tree.nodes {
+			if node.file != nil {
+				out.Blocks += uint64(node.file.Length+511) / 512
+			}
+		}
+		c.reply(header, 0, structBytes(unsafe.Pointer(&out), unsafe.Sizeof(out)))
+
+	case fuseOpAccess:
+		if len(body) >= int(unsafe.Sizeof(fuseAccessIn{})) {
+			if in := (*fuseAccessIn)(unsafe.Pointer(&body[0])); in.Mask&unix.W_OK != 0 {
+				c.reply(header, unix.EROFS, nil)
+				return
+			}
+		}
+		c.reply(header, 0, nil)
+
+	case fuseOpReleasedir, fuseOpFlush, fuseOpFsync, fuseOpFsyncdir:
+		c.reply(header, 0, nil)
+
+	case fuseOpSetattr, fuseOpSymlink, fuseOpMknod, fuseOpMkdir, fuseOpUnlink, fuseOpRmdir, fuseOpRename,
+		fuseOpRename2, fuseOpLink, fuseOpWrite, fuseOpCreate, fuseOpSetxattr, fuseOpRemovexattr, fuseOpFallocate:
+		c.reply(header, unix.EROFS, nil)
+
+	default:
+		c.reply(header, unix.ENOSYS, nil)
+	}
+}
+
+// attr returns the attributes of a node: directories and files are readable
+// by everyone and owned by the user that mounted the bucket.
+func (c *fuseConn) attr(node *gridfsNode) fuseAttr {
+	modTime := node.modTime
+	attr := fuseAttr{
+		Ino:       node.ino,
+		Atime:     uint64(modTime.Unix()),
+		Mtime:     uint64(modTime.Unix()),
+		Ctime:     uint64(modTime.Unix()),
+		Atimensec: uint32(modTime.Nanosecond()),
+		Mtimensec: uint32(modTime.Nanosecond()),
+		Ctimensec: uint32(modTime.Nanosecond()),
+		UID:       c.uid,
+		GID:       c.gid,
+	}
+	if node.file == nil {
+		attr.Mode = unix.S_IFDIR | 0555
+		attr.Nlink = 2
+		return attr
+	}
+	attr.Mode = unix.S_IFREG | 0444
+	attr.Nlink = 1
+	attr.Size = uint64(node.file.Length)
+	attr.Blocks = (attr.Size + 511) / 512
+	attr.Blksize = uint32(node.file.ChunkSize)
+	return attr
+}
+
+// readdir returns as many entries of dir as fit in size bytes, starting from
+// the entry at offset; the entries are ".", ".." and then the children.
+func (c *fuseConn) readdir(dir *gridfsNode, offset uint64, size int) []byte {
+	parent := dir.parent
+	if parent == nil {
+		parent = dir
+	}
+	direntSize := int(unsafe.Sizeof(fuseDirent{}))
+
+	var out []byte
+	for i := offset; i < uint64(len(dir.children))+2; i++ {
+		var name string
+		var node *gridfsNode
+		switch i {
+		case 0:
+			name, node = ".", dir
+		case 1:
+			name, node = "..", parent
+		default:
+			node = dir.children[i-2]
+			name = node.name
+		}
+		entry := fuseDirent{Ino: node.ino, Off: i + 1, Namelen: uint32(len(name)), Type: unix.DT_REG}
+		if node.file == nil {
+			entry.Type = unix.DT_DIR
+		}
+		entrySize := (direntSize + len(name) + 7) &^ 7
+		if len(out)+entrySize > size {
+			break
+		}
+		out = append(out, structBytes(unsafe.Pointer(&entry), uintptr(direntSize))...)
+		out = append(out, name...)
+		out = append(out, make([]byte, entrySize-direntSize-len(name))...)
+	}
+	return out
+}
+
+// reply writes the answer to a request, with an error or with out as its
+// body. A reply to a request that was interrupted is dropped by the kernel.
+func (c *fuseConn) reply(header *fuseInHeader, errno unix.Errno, out []byte) {
+	outHeader := fuseOutHeader{Error: -int32(errno), Unique: header.Unique}
+	headerSize := int(unsafe.Sizeof(outHeader))
+	outHeader.Len = uint32(headerSize + len(out))
+	msg := make([]byte, 0, outHeader.Len)
+	msg = append(msg, structBytes(unsafe.Pointer(&outHeader), uintptr(headerSize))...)
+	msg = append(msg, out...)
+	if _, err := unix.Write(c.fd, msg); err != nil && err != unix.ENOENT {
+		log.Logvf(log.DebugLow, "error replying to FUSE request %v: %v", header.Opcode, err)
+	}
+}
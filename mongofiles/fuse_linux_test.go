@@ -0,0 +1,368 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// +build linux
+
+package mongofiles
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/sys/unix"
+)
+
+// fuseTestConn sends requests to a fuseConn over a socket that stands in for
+// the FUSE device and decodes its replies.
+type fuseTestConn struct {
+	fd     int
+	unique uint64
+	served chan error
+}
+
+func newFuseTestConn(tree *gridfsTree) (*fuseTestConn, error) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_SEQPACKET|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	c := &fuseConn{
+		fd:      fds[0],
+		tree:    tree,
+		uid:     1000,
+		gid:     100,
+		handles: map[uint64]*gridfsFileReader{},
+	}
+	conn := &fuseTestConn{fd: fds[1], served: make(chan error, 1)}
+	go func() {
+		conn.served <- c.serve()
+	}()
+	return conn, nil
+}
+
+// send writes a request with the given opcode for the given node, whose body
+// is the little-endian encoding of in.
+func (conn *fuseTestConn) send(opcode uint32, nodeID uint64, in interface{}) uint64 {
+	var body bytes.Buffer
+	switch in := in.(type) {
+	case nil:
+	case string:
+		body.WriteString(in)
+		body.WriteByte(0)
+	default:
+		if err := binary.Write(&body, binary.LittleEndian, in); err != nil {
+			panic(err)
+		}
+	}
+	conn.unique++
+	header := fuseInHeader{
+		Len:    uint32(binary.Size(fuseInHeader{}) + body.Len()),
+		Opcode: opcode,
+		Unique: conn.unique,
+		NodeID: nodeID,
+	}
+	var msg bytes.Buffer
+	_ = binary.Write(&msg, binary.LittleEndian, header)
+	msg.Write(body.Bytes())
+	if _, err := unix.Write(conn.fd, msg.Bytes()); err != nil {
+		panic(err)
+	}
+	return conn.unique
+}
+
+// receive reads the next reply and checks that its length is consistent.
+func (conn *fuseTestConn) receive() (fuseOutHeader, []byte, error) {
+	buf := make([]byte, fuseBufferSize)
+	n, err := unix.Read(conn.fd, buf)
+	if err != nil {
+		return fuseOutHeader{}, nil, err
+	}
+	var header fuseOutHeader
+	if err = binary.Read(bytes.NewReader(buf[:n]), binary.LittleEndian, &header); err != nil {
+		return header, nil, err
+	}
+	if int(header.Len) != n {
+		return header, nil, fmt.Errorf("reply length %v does not match the %v bytes read", header.Len, n)
+	}
+	return header, buf[binary.Size(header):n], nil
+}
+
+// call sends a request and decodes the body of its reply into out, if given.
+func (conn *fuseTestConn) call(opcode uint32, nodeID uint64, in interface{}, out interface{}) (unix.Errno, []byte) {
+	unique := conn.send(opcode, nodeID, in)
+	header, body, err := conn.receive()
+	So(err, ShouldBeNil)
+	So(header.Unique, ShouldEqual, unique)
+	if header.Error == 0 && out != nil {
+		So(len(body), ShouldEqual, binary.Size(out))
+		So(binary.Read(bytes.NewReader(body), binary.LittleEndian, out), ShouldBeNil)
+	}
+	return unix.Errno(-header.Error), body
+}
+
+func (conn *fuseTestConn) close() {
+	_ = unix.Close(conn.fd)
+}
+
+func TestFuseMessageLayout(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("FUSE messages should have the sizes defined by linux/fuse.h", t, func() {
+		messages := map[string]interface{}{
+			"fuse_in_header":  fuseInHeader{},
+			"fuse_out_header": fuseOutHeader{},
+			"fuse_init_in":    fuseInitIn{},
+			"fuse_init_out":   fuseInitOut{},
+			"fuse_attr":       fuseAttr{},
+			"fuse_entry_out":  fuseEntryOut{},
+			"fuse_attr_out":   fuseAttrOut{},
+			"fuse_open_in":    fuseOpenIn{},
+			"fuse_open_out":   fuseOpenOut{},
+			"fuse_read_in":    fuseReadIn{},
+			"fuse_release_in": fuseReleaseIn{},
+			"fuse_access_in":  fuseAccessIn{},
+			"fuse_statfs_out": fuseStatfsOut{},
+			"fuse_dirent":     fuseDirent{},
+		}
+		sizes := map[string]int{}
+		for name, message := range messages {
+			sizes[name] = binary.Size(message)
+		}
+		So(sizes, ShouldResemble, map[string]int{
+			"fuse_in_header":  40,
+			"fuse_out_header": 16,
+			"fuse_init_in":    16,
+			"fuse_init_out":   64,
+			"fuse_attr":       88,
+			"fuse_entry_out":  128,
+			"fuse_attr_out":   104,
+			"fuse_open_in":    8,
+			"fuse_open_out":   16,
+			"fuse_read_in":    40,
+			"fuse_release_in": 24,
+			"fuse_access_in":  8,
+			"fuse_statfs_out": 80,
+			"fuse_dirent":     24,
+		})
+
+		Convey("and be laid out in memory without padding", func() {
+			So(unsafe.Sizeof(fuseInHeader{}), ShouldEqual, 40)
+			So(unsafe.Sizeof(fuseInitOut{}), ShouldEqual, 64)
+			So(unsafe.Sizeof(fuseEntryOut{}), ShouldEqual, 128)
+			So(unsafe.Sizeof(fuseAttrOut{}), ShouldEqual, 104)
+			So(unsafe.Sizeof(fuseReadIn{}), ShouldEqual, 40)
+			So(unsafe.Sizeof(fuseStatfsOut{}), ShouldEqual, 80)
+			So(unsafe.Sizeof(fuseDirent{}), ShouldEqual, 24)
+		})
+	})
+}
+
+func TestFuseConn(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	modTime := time.Date(2020, 1, 1, 0, 0, 0, 5, time.UTC)
+	contents := []byte("hello, world")
+	files := []*gfsFile{
+		{ID: 1, Name: "dir/a.txt", Length: int64(len(contents)), ChunkSize: 5, UploadDate: modTime},
+		{ID: 2, Name: "b.txt", Length: 3, ChunkSize: 5, UploadDate: modTime},
+	}
+
+	Convey("With a GridFS tree served over a FUSE connection", t, func() {
+		tree := newGridFSTree(files, modTime)
+		tree.readChunk = func(file *gfsFile, n int64) ([]byte, error) {
+			start := n * int64(file.ChunkSize)
+			end := start + int64(file.ChunkSize)
+			if end > int64(len(contents)) {
+				end = int64(len(contents))
+			}
+			return contents[start:end], nil
+		}
+		conn, err := newFuseTestConn(tree)
+		So(err, ShouldBeNil)
+		defer conn.close()
+
+		var initOut fuseInitOut
+		errno, _ := conn.call(fuseOpInit, 0, fuseInitIn{Major: 7, Minor: 31, MaxReadahead: 4096}, &initOut)
+		So(errno, ShouldEqual, 0)
+		So(initOut.Major, ShouldEqual, 7)
+		So(initOut.Minor, ShouldEqual, fuseMinorVersion)
+		So(initOut.MaxReadahead, ShouldEqual, 4096)
+		So(initOut.MaxWrite, ShouldEqual, fuseMaxWrite)
+
+		lookup := func(parent uint64, name string) (unix.Errno, fuseEntryOut) {
+			var out fuseEntryOut
+			errno, _ := conn.call(fuseOpLookup, parent, name, &out)
+			return errno, out
+		}
+
+		Convey("LOOKUP should return the entry of a child", func() {
+			errno, dir := lookup(1, "dir")
+			So(errno, ShouldEqual, 0)
+			So(dir.NodeID, ShouldEqual, dir.Attr.Ino)
+			So(dir.EntryValid, ShouldEqual, fuseCacheTimeout)
+			So(dir.Attr.Mode, ShouldEqual, unix.S_IFDIR|0555)
+
+			errno, file := lookup(dir.NodeID, "a.txt")
+			So(errno, ShouldEqual, 0)
+			So(file.Attr.Mode, ShouldEqual, unix.S_IFREG|0444)
+			So(file.Attr.Size, ShouldEqual, len(contents))
+			So(file.Attr.Blksize, ShouldEqual, 5)
+			So(file.Attr.UID, ShouldEqual, 1000)
+			So(file.Attr.GID, ShouldEqual, 100)
+			So(file.Attr.Mtime, ShouldEqual, modTime.Unix())
+			So(file.Attr.Mtimensec, ShouldEqual, 5)
+
+			errno, _ = lookup(1, "missing")
+			So(errno, ShouldEqual, unix.ENOENT)
+			errno, _ = lookup(file.NodeID, "x")
+			So(errno, ShouldEqual, unix.ENOTDIR)
+		})
+
+		Convey("GETATTR should return the attributes of a node", func() {
+			var out fuseAttrOut
+			errno, _ := conn.call(fuseOpGetattr, 1, nil, &out)
+			So(errno, ShouldEqual, 0)
+			So(out.AttrValid, ShouldEqual, fuseCacheTimeout)
+			So(out.Attr.Ino, ShouldEqual, 1)
+			So(out.Attr.Mode, ShouldEqual, unix.S_IFDIR|0555)
+			So(out.Attr.Nlink, ShouldEqual, 2)
+
+			errno, _ = conn.call(fuseOpGetattr, 100, nil, nil)
+			So(errno, ShouldEqual, unix.ENOENT)
+		})
+
+		Convey("OPEN, READ and RELEASE should read a file through a handle", func() {
+			_, dir := lookup(1, "dir")
+			_, file := lookup(dir.NodeID, "a.txt")
+
+			var open fuseOpenOut
+			errno, _ := conn.call(fuseOpOpen, file.NodeID, fuseOpenIn{Flags: unix.O_RDONLY}, &open)
+			So(errno, ShouldEqual, 0)
+			So(open.Fh, ShouldNotEqual, 0)
+			So(open.OpenFlags, ShouldEqual, fuseOpenKeepCache)
+
+			errno, data := conn.call(fuseOpRead, file.NodeID, fuseReadIn{Fh: open.Fh, Offset: 3, Size: 7}, nil)
+			So(errno, ShouldEqual, 0)
+			So(string(data), ShouldEqual, "lo, wor")
+			errno, data = conn.call(fuseOpRead, file.NodeID, fuseReadIn{Fh: open.Fh, Offset: 10, Size: 100}, nil)
+			So(errno, ShouldEqual, 0)
+			So(string(data), ShouldEqual, "ld")
+
+			errno, _ = conn.call(fuseOpRelease, file.NodeID, fuseReleaseIn{Fh: open.Fh}, nil)
+			So(errno, ShouldEqual, 0)
+			errno, _ = conn.call(fuseOpRead, file.NodeID, fuseReadIn{Fh: open.Fh, Size: 1}, nil)
+			So(errno, ShouldEqual, unix.EBADF)
+
+			errno, _ = conn.call(fuseOpOpen, file.NodeID, fuseOpenIn{Flags: unix.O_RDWR}, nil)
+			So(errno, ShouldEqual, unix.EROFS)
+			errno, _ = conn.call(fuseOpOpen, dir.NodeID, fuseOpenIn{Flags: unix.O_RDONLY}, nil)
+			So(errno, ShouldEqual, unix.EISDIR)
+		})
+
+		Convey("OPENDIR and READDIR should list a directory", func() {
+			var open fuseOpenOut
+			errno, _ := conn.call(fuseOpOpendir, 1, fuseOpenIn{}, &open)
+			So(errno, ShouldEqual, 0)
+
+			errno, data := conn.call(fuseOpReaddir, 1, fuseReadIn{Fh: open.Fh, Size: 4096}, nil)
+			So(errno, ShouldEqual, 0)
+			var names []string
+			var types []uint32
+			var lastOff uint64
+			for reader := bytes.NewReader(data); reader.Len() > 0; {
+				var entry fuseDirent
+				So(binary.Read(reader, binary.LittleEndian, &entry), ShouldBeNil)
+				name := make([]byte, (int(entry.Namelen)+7)&^7)
+				_, err := reader.Read(name)
+				So(err, ShouldBeNil)
+				names = append(names, string(name[:entry.Namelen]))
+				types = append(types, entry.Type)
+				lastOff = entry.Off
+			}
+			So(names, ShouldResemble, []string{".", "..", "b.txt", "dir"})
+			So(types, ShouldResemble, []uint32{unix.DT_DIR, unix.DT_DIR, unix.DT_REG, unix.DT_DIR})
+
+			errno, data = conn.call(fuseOpReaddir, 1, fuseReadIn{Fh: open.Fh, Offset: lastOff, Size: 4096}, nil)
+			So(errno, ShouldEqual, 0)
+			So(data, ShouldBeEmpty)
+
+			errno, data = conn.call(fuseOpReaddir, 1, fuseReadIn{Fh: open.Fh, Size: 40}, nil)
+			So(errno, ShouldEqual, 0)
+			So(len(data), ShouldEqual, 32)
+
+			errno, _ = conn.call(fuseOpReleasedir, 1, fuseReleaseIn{Fh: open.Fh}, nil)
+			So(errno, ShouldEqual, 0)
+
+			_, file := lookup(1, "b.txt")
+			errno, _ = conn.call(fuseOpOpendir, file.NodeID, fuseOpenIn{}, nil)
+			So(errno, ShouldEqual, unix.ENOTDIR)
+		})
+
+		Convey("STATFS should count the files and their blocks", func() {
+			var out fuseStatfsOut
+			errno, _ := conn.call(fuseOpStatfs, 1, nil, &out)
+			So(errno, ShouldEqual, 0)
+			So(out.Files, ShouldEqual, 4)
+			So(out.Blocks, ShouldEqual, 2)
+			So(out.Bsize, ShouldEqual, 512)
+			So(out.Namelen, ShouldEqual, 255)
+		})
+
+		Convey("ACCESS should refuse write access", func() {
+			errno, _ := conn.call(fuseOpAccess, 1, fuseAccessIn{Mask: unix.R_OK}, nil)
+			So(errno, ShouldEqual, 0)
+			errno, _ = conn.call(fuseOpAccess, 1, fuseAccessIn{Mask: unix.W_OK}, nil)
+			So(errno, ShouldEqual, unix.EROFS)
+		})
+
+		Convey("requests that modify the filesystem should fail with EROFS", func() {
+			for _, opcode := range []uint32{fuseOpSetattr, fuseOpMkdir, fuseOpUnlink, fuseOpRename, fuseOpWrite, fuseOpCreate} {
+				errno, _ := conn.call(opcode, 1, nil, nil)
+				So(errno, ShouldEqual, unix.EROFS)
+			}
+		})
+
+		Convey("FORGET should get no reply and unknown requests should fail with ENOSYS", func() {
+			conn.send(fuseOpForget, 1, nil)
+			errno, _ := conn.call(1000, 1, nil, nil)
+			So(errno, ShouldEqual, unix.ENOSYS)
+		})
+
+		Convey("DESTROY should stop serving", func() {
+			errno, _ := conn.call(fuseOpDestroy, 0, nil, nil)
+			So(errno, ShouldEqual, 0)
+			So(<-conn.served, ShouldBeNil)
+		})
+	})
+
+	Convey("INIT should reply with the older layout to older kernels", t, func() {
+		conn, err := newFuseTestConn(newGridFSTree(nil, modTime))
+		So(err, ShouldBeNil)
+		defer conn.close()
+
+		conn.send(fuseOpInit, 0, fuseInitIn{Major: 7, Minor: 22})
+		header, body, err := conn.receive()
+		So(err, ShouldBeNil)
+		So(header.Error, ShouldEqual, 0)
+		So(len(body), ShouldEqual, fuseCompatInitOutSize)
+		So(binary.LittleEndian.Uint32(body[4:]), ShouldEqual, 22)
+	})
+
+	Convey("INIT should fail for an unsupported protocol version", t, func() {
+		conn, err := newFuseTestConn(newGridFSTree(nil, modTime))
+		So(err, ShouldBeNil)
+		defer conn.close()
+
+		errno, _ := conn.call(fuseOpInit, 0, fuseInitIn{Major: 8}, nil)
+		So(errno, ShouldEqual, unix.EPROTO)
+		So(<-conn.served, ShouldNotBeNil)
+	})
+}
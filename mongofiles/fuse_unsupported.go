@@ -0,0 +1,17 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// +build !linux
+
+package mongofiles
+
+import (
+	"fmt"
+)
+
+func mountReadOnly(mountPoint string, tree *gridfsTree) (mountedFS, error) {
+	return nil, fmt.Errorf("'%v' is only supported on Linux", Mount)
+}
@@ -32,6 +32,8 @@ type gfsFile struct {
 // Struct representing the metadata associated with a GridFS files collection document.
 type gfsFileMetadata struct {
 	ContentType string `bson:"contentType,omitempty"`
+	// SHA256 is the hex SHA-256 of the content, if put with --verify.
+	SHA256 string `bson:"sha256,omitempty"`
 }
 
 func newGfsFile(ID interface{}, name string, mf *MongoFiles) (*gfsFile, error) {
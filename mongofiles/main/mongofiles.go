@@ -8,6 +8,9 @@
 package main
 
 import (
+	"github.com/mongodb/mongo-tools/common/completion"
+	"github.com/mongodb/mongo-tools/common/exitcode"
+	"github.com/mongodb/mongo-tools/common/healthcheck"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/signals"
 	"github.com/mongodb/mongo-tools/common/util"
@@ -27,11 +30,9 @@ func main() {
 	if err != nil {
 		log.Logvf(log.Always, "error parsing command line options: %s", err.Error())
 		log.Logv(log.Always, util.ShortUsage("mongofiles"))
-		os.Exit(util.ExitFailure)
+		os.Exit(util.ExitValidationFailure)
 	}
 
-	signals.Handle()
-
 	// print help, if specified
 	if opts.PrintHelp(false) {
 		os.Exit(util.ExitSuccess)
@@ -42,20 +43,43 @@ func main() {
 		os.Exit(util.ExitSuccess)
 	}
 
+	// print the effective config, if specified
+	if opts.PrintEffectiveConfig() {
+		os.Exit(util.ExitSuccess)
+	}
+
+	// generate shell completions, if requested
+	if _, ok := opts.CompletionArgs(); ok {
+		os.Exit(completion.Main(opts.ToolOptions))
+	}
+
+	// check the connection, credentials and privileges without running
+	if opts.HealthCheck {
+		os.Exit(healthcheck.Main(*opts.ToolOptions, opts.HealthCheckRequirements()))
+	}
+
 	mf, err := mongofiles.New(opts)
 	if err != nil {
 		log.Logv(log.Always, err.Error())
 		if setupErr, ok := err.(util.SetupError); ok && setupErr.Message != "" {
 			log.Logvf(log.Always, setupErr.Message)
 		}
-		os.Exit(util.ExitFailure)
+		os.Exit(exitcode.Of(err))
 	}
 	defer mf.Close()
 
+	// mount and serve run until interrupted, so the first interrupt stops them
+	if mf.Command == mongofiles.Mount || mf.Command == mongofiles.Serve {
+		finishedChan := signals.HandleWithInterrupt(mf.HandleInterrupt)
+		defer close(finishedChan)
+	} else {
+		signals.Handle()
+	}
+
 	output, err := mf.Run(true)
 	if err != nil {
 		log.Logvf(log.Always, "Failed: %v", err)
-		os.Exit(util.ExitFailure)
+		os.Exit(exitcode.Of(err))
 	}
 	fmt.Printf("%s", output)
 }
@@ -10,12 +10,16 @@ package mongofiles
 import (
 	"context"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/exitcode"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/util"
@@ -36,6 +40,15 @@ const (
 	GetRegex = "get_regex"
 	Delete   = "delete"
 	DeleteID = "delete_id"
+
+	ExportArchive = "export-archive"
+	ImportArchive = "import-archive"
+
+	Move = "mv"
+	Copy = "cp"
+
+	Mount = "mount"
+	Serve = "serve"
 )
 
 // MongoFiles is a container for the user-specified options and
@@ -70,8 +83,32 @@ type MongoFiles struct {
 	// for get_regex
 	FileNameRegex string
 
+	// Local tar or zip archive for export-archive
+	// and import-archive
+	ArchiveName string
+
+	// Destination filename for mv and cp
+	NewFileName string
+
+	// Local directory to mount the bucket at for mount
+	MountPoint string
+
 	// GridFS bucket to operate on
 	bucket *gridfs.Bucket
+
+	// how to stop mount or serve when interrupted
+	running *stoppable
+
+	// where the answer to delete's confirmation is read from, standard
+	// input if nil
+	confirmInput io.Reader
+}
+
+// stoppable tracks how to stop a command that runs until it is interrupted.
+type stoppable struct {
+	sync.Mutex
+	stop        func() error
+	interrupted bool
 }
 
 // New constructs a new mongofiles instance from the provided options. Will fail if cannot connect to server or if the
@@ -80,7 +117,7 @@ func New(opts Options) (*MongoFiles, error) {
 	// create a session provider to connect to the db
 	provider, err := db.NewSessionProvider(*opts.ToolOptions)
 	if err != nil {
-		return nil, util.SetupError{Err: fmt.Errorf("error connecting to host: %v", err)}
+		return nil, util.SetupError{Err: fmt.Errorf("error connecting to host: %w", err)}
 	}
 
 	mf := &MongoFiles{
@@ -88,15 +125,47 @@ func New(opts Options) (*MongoFiles, error) {
 		StorageOptions:  opts.StorageOptions,
 		SessionProvider: provider,
 		InputOptions:    opts.InputOptions,
+		running:         &stoppable{},
 	}
 
 	if err := mf.ValidateCommand(opts.ParsedArgs); err != nil {
-		return nil, util.SetupError{Err: err, Message: util.ShortUsage("mongofiles")}
+		return nil, util.SetupError{Err: exitcode.Validation(err), Message: util.ShortUsage("mongofiles")}
 	}
 
 	return mf, nil
 }
 
+// setStop records how to stop the running command, and stops it at once if
+// mongofiles has already been interrupted.
+func (mf *MongoFiles) setStop(stop func() error) error {
+	if mf.running == nil {
+		mf.running = &stoppable{}
+	}
+	mf.running.Lock()
+	defer mf.running.Unlock()
+	mf.running.stop = stop
+	if mf.running.interrupted {
+		return stop()
+	}
+	return nil
+}
+
+// HandleInterrupt stops a command that runs until it is interrupted, 'mount'
+// or 'serve', which then returns.
+func (mf *MongoFiles) HandleInterrupt() {
+	if mf.running == nil {
+		return
+	}
+	mf.running.Lock()
+	defer mf.running.Unlock()
+	mf.running.interrupted = true
+	if mf.running.stop != nil {
+		if err := mf.running.stop(); err != nil {
+			log.Logvf(log.Always, "error stopping '%v': %v", mf.Command, err)
+		}
+	}
+}
+
 // Close disconnects from the server and cleans up internal mongofiles state.
 func (mf *MongoFiles) Close() {
 	mf.SessionProvider.Close()
@@ -142,6 +211,11 @@ func (mf *MongoFiles) ValidateCommand(args []string) error {
 		if len(args) > 2 {
 			return fmt.Errorf("too many non-URI positional arguments (If you are trying to specify a connection string, it must begin with mongodb:// or mongodb+srv://)")
 		}
+		// a bulk delete selects files by its options, so needs no filename
+		if args[0] == Delete && len(args) == 1 && mf.hasDeleteSelectors() {
+			mf.FileName = ""
+			break
+		}
 		// also make sure the supporting argument isn't literally an
 		// empty string for example, mongofiles get ""
 		if len(args) == 1 || args[1] == "" {
@@ -165,6 +239,53 @@ func (mf *MongoFiles) ValidateCommand(args []string) error {
 		}
 		mf.FileName = args[1]
 		mf.Id = args[2]
+	case ExportArchive, ImportArchive:
+		// export-archive takes an optional prefix which exported filenames
+		// must begin with, like list
+		if (args[0] == ExportArchive && len(args) > 3) || (args[0] == ImportArchive && len(args) > 2) {
+			return fmt.Errorf("too many non-URI positional arguments (If you are trying to specify a connection string, it must begin with mongodb:// or mongodb+srv://)")
+		}
+		if len(args) == 1 || args[1] == "" {
+			return fmt.Errorf("'%v' argument missing", args[0])
+		}
+		if _, err := archiveFormat(args[1]); err != nil {
+			return err
+		}
+		mf.ArchiveName = args[1]
+		if len(args) == 3 {
+			mf.FileName = args[2]
+		}
+	case Move, Copy:
+		if len(args) > 3 {
+			return fmt.Errorf("too many non-URI positional arguments (If you are trying to specify a connection string, it must begin with mongodb:// or mongodb+srv://)")
+		}
+		if len(args) < 3 || args[1] == "" || args[2] == "" {
+			return fmt.Errorf("'%v' argument(s) missing", args[0])
+		}
+		mf.FileName = args[1]
+		mf.NewFileName = args[2]
+		toBucket := mf.StorageOptions.ToBucket
+		if mf.FileName == mf.NewFileName && (toBucket == "" || toBucket == mf.StorageOptions.GridFSPrefix) {
+			return fmt.Errorf("source and destination of '%v' are the same file", args[0])
+		}
+	case Mount:
+		if len(args) > 2 {
+			return fmt.Errorf("too many non-URI positional arguments (If you are trying to specify a connection string, it must begin with mongodb:// or mongodb+srv://)")
+		}
+		if len(args) == 1 || args[1] == "" {
+			return fmt.Errorf("'%v' argument missing", args[0])
+		}
+		if !mf.StorageOptions.ReadOnly {
+			return fmt.Errorf("'%v' only supports read-only mounts; specify --readonly", args[0])
+		}
+		mf.MountPoint = args[1]
+	case Serve:
+		if len(args) > 1 {
+			return fmt.Errorf("too many non-URI positional arguments (If you are trying to specify a connection string, it must begin with mongodb:// or mongodb+srv://)")
+		}
+		if mf.StorageOptions.Listen == "" {
+			mf.StorageOptions.Listen = defaultListenAddress
+		}
 	default:
 		return fmt.Errorf("'%v' is not a valid command (If you are trying to specify a connection string, it must begin with mongodb:// or mongodb+srv://)", args[0])
 	}
@@ -172,6 +293,32 @@ func (mf *MongoFiles) ValidateCommand(args []string) error {
 	if mf.StorageOptions.GridFSPrefix == "" {
 		return fmt.Errorf("--prefix can not be blank")
 	}
+	if mf.StorageOptions.ToBucket != "" && args[0] != Copy {
+		return fmt.Errorf("--toBucket can only be used with '%v'", Copy)
+	}
+	if mf.StorageOptions.AllRevisions && args[0] != Move && args[0] != Copy {
+		return fmt.Errorf("--all-revisions can only be used with '%v' and '%v'", Move, Copy)
+	}
+	if mf.StorageOptions.ReadOnly && args[0] != Mount {
+		return fmt.Errorf("--readonly can only be used with '%v'", Mount)
+	}
+	if args[0] != Serve && (mf.StorageOptions.Listen != "" || mf.StorageOptions.URLPrefix != "" || mf.StorageOptions.BearerTokenFile != "") {
+		return fmt.Errorf("--listen, --urlPrefix and --bearerTokenFile can only be used with '%v'", Serve)
+	}
+	if mf.StorageOptions.Verify && args[0] != Get && args[0] != GetID && args[0] != GetRegex && args[0] != Put && args[0] != PutID {
+		return fmt.Errorf("--verify can only be used with the get and put families of commands")
+	}
+	if args[0] != Delete && (mf.hasDeleteSelectors() || mf.StorageOptions.DryRun || mf.StorageOptions.Yes) {
+		return fmt.Errorf("--regex, --olderThan, --query, --dryRun and --yes can only be used with '%v'", Delete)
+	}
+	if args[0] == Delete {
+		if (mf.StorageOptions.DryRun || mf.StorageOptions.Yes) && !mf.hasDeleteSelectors() {
+			return fmt.Errorf("--dryRun and --yes can only be used with --regex, --olderThan or --query")
+		}
+		if _, err := mf.deleteQuery(time.Now()); err != nil {
+			return err
+		}
+	}
 
 	mf.Command = args[0]
 	return nil
@@ -377,10 +524,37 @@ func (mf *MongoFiles) writeGFSFileToLocal(gridFile *gfsFile) (err error) {
 	dc := util.DeferredCloser{Closer: stream}
 	defer dc.CloseWithErrorCapture(&err)
 
-	if _, err = io.Copy(localFile, stream); err != nil {
+	var verifier *contentVerifier
+	out := io.Writer(localFile)
+	if mf.StorageOptions.Verify {
+		verifier = newContentVerifier(gridFile)
+		if !verifier.hasChecksum() {
+			log.Logvf(log.Always, "warning: '%v' has no stored checksum, so only its length is verified", gridFile.Name)
+		}
+		out = io.MultiWriter(localFile, verifier)
+	}
+
+	// with --verify, don't leave corrupt content behind
+	removeLocalFile := func() {
+		if verifier != nil && localFileName != "-" {
+			localFile.Close()
+			os.Remove(localFileName)
+		}
+	}
+
+	if _, err = io.Copy(out, stream); err != nil {
+		removeLocalFile()
 		return fmt.Errorf("error while writing Data into local file '%v': %v", localFileName, err)
 	}
 
+	if verifier != nil {
+		if err = verifier.verify(); err != nil {
+			removeLocalFile()
+			return err
+		}
+		log.Logvf(log.Info, "verified the content of '%v'", gridFile.Name)
+	}
+
 	log.Logvf(log.Always, fmt.Sprintf("finished writing to %s\n", localFileName))
 	return nil
 }
@@ -425,11 +599,27 @@ func (mf *MongoFiles) put(id interface{}, name string) (bytesWritten int64, err
 	dc := util.DeferredCloser{Closer: stream}
 	defer dc.CloseWithErrorCapture(&err)
 
-	n, err := io.Copy(stream, localFile)
+	content := io.Reader(localFile)
+	var hasher hash.Hash
+	if mf.StorageOptions.Verify {
+		content, hasher = hashingReader(localFile)
+	}
+
+	n, err := io.Copy(stream, content)
 	if err != nil {
 		return n, fmt.Errorf("error while storing '%v' into GridFS: %v", localFileName, err)
 	}
 
+	if hasher != nil {
+		// the files document is only written once the stream is closed
+		if dc.CloseWithErrorCapture(&err); err != nil {
+			return n, err
+		}
+		if err = mf.recordSHA256(gridFile.ID, hasher.Sum(nil)); err != nil {
+			return n, err
+		}
+	}
+
 	return n, nil
 }
 
@@ -499,6 +689,13 @@ func (mf *MongoFiles) Run(displayHost bool) (output string, finalErr error) {
 	if err != nil {
 		return "", err
 	}
+	if mf.StorageOptions.ToBucket != "" {
+		err = util.ValidateFullNamespace(fmt.Sprintf("%s.%s.chunks", mf.StorageOptions.DB,
+			mf.StorageOptions.ToBucket))
+		if err != nil {
+			return "", err
+		}
+	}
 
 	log.Logvf(log.Info, "handling mongofiles '%v' command...", mf.Command)
 
@@ -528,7 +725,29 @@ func (mf *MongoFiles) Run(displayHost bool) (output string, finalErr error) {
 		err = mf.handleDeleteID()
 
 	case Delete:
-		err = mf.deleteAll(mf.FileName)
+		if mf.hasDeleteSelectors() {
+			output, err = mf.handleBulkDelete()
+		} else {
+			err = mf.deleteAll(mf.FileName)
+		}
+
+	case ExportArchive:
+		err = mf.handleExportArchive()
+
+	case ImportArchive:
+		err = mf.handleImportArchive()
+
+	case Move:
+		err = mf.handleMove()
+
+	case Copy:
+		err = mf.handleCopy()
+
+	case Mount:
+		err = mf.handleMount()
+
+	case Serve:
+		err = mf.handleServe()
 	}
 
 	return output, err
@@ -324,6 +324,37 @@ func TestValidArguments(t *testing.T) {
 			}
 		})
 
+		Convey("export-archive should accept an archive and an optional filename prefix", func() {
+			So(mf.ValidateCommand([]string{"export-archive", "out.tar.gz", "images/"}), ShouldBeNil)
+			So(mf.ArchiveName, ShouldEqual, "out.tar.gz")
+			So(mf.FileName, ShouldEqual, "images/")
+
+			err := mf.ValidateCommand([]string{"export-archive", "out.rar"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "unsupported archive")
+		})
+
+		Convey("import-archive should error out when more than 1 positional argument is provided", func() {
+			err := mf.ValidateCommand([]string{"import-archive", "in.zip", "images/"})
+			So(err, ShouldNotBeNil)
+			So(mf.ValidateCommand([]string{"import-archive", "in.zip"}), ShouldBeNil)
+		})
+
+		Convey("mv and cp should require a source and a destination", func() {
+			for _, command := range []string{"mv", "cp"} {
+				So(mf.ValidateCommand([]string{command, "a"}), ShouldNotBeNil)
+				So(mf.ValidateCommand([]string{command, "a", "a"}), ShouldNotBeNil)
+				So(mf.ValidateCommand([]string{command, "a", "b"}), ShouldBeNil)
+				So(mf.NewFileName, ShouldEqual, "b")
+			}
+		})
+
+		Convey("--toBucket should only be accepted by cp", func() {
+			mf.StorageOptions.ToBucket = "other"
+			So(mf.ValidateCommand([]string{"cp", "a", "a"}), ShouldBeNil)
+			So(mf.ValidateCommand([]string{"mv", "a", "b"}), ShouldNotBeNil)
+		})
+
 		Convey("It should error out when a nonsensical command is given", func() {
 			args := []string{"commandnonexistent"}
 
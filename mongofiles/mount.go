@@ -0,0 +1,262 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// mountedFS is a filesystem mounted by the 'mount' command.
+type mountedFS interface {
+	// serve answers requests to the filesystem until it is unmounted.
+	serve() error
+	// unmount detaches the filesystem from its mount point.
+	unmount() error
+}
+
+// gridfsTree is a snapshot of the files in a GridFS bucket arranged as a
+// directory tree, where the parts of each filename separated by '/' are
+// taken as directories. Only the newest revision of each file is included.
+type gridfsTree struct {
+	// nodes holds every node at the index of its inode number less one, so
+	// the root directory is inode 1.
+	nodes []*gridfsNode
+
+	// readChunk returns the data of chunk n of a file.
+	readChunk func(file *gfsFile, n int64) ([]byte, error)
+}
+
+// gridfsNode is a file or directory in a gridfsTree.
+type gridfsNode struct {
+	ino     uint64
+	name    string
+	parent  *gridfsNode
+	modTime time.Time
+
+	// file is the GridFS file shown at this node, or nil for a directory.
+	file *gfsFile
+
+	// children of a directory, sorted by name.
+	children []*gridfsNode
+	byName   map[string]*gridfsNode
+}
+
+// newGridFSTree arranges files into a tree. A file whose path is also needed
+// as a directory, or that cleans to the same path as another file, is shown
+// with a numeric suffix. Directories have the modification time of the newest
+// file below them, or modTime if they hold no files.
+func newGridFSTree(files []*gfsFile, modTime time.Time) *gridfsTree {
+	newest := map[string]*gfsFile{}
+	for _, file := range files {
+		if current, ok := newest[file.Name]; !ok || file.UploadDate.After(current.UploadDate) {
+			newest[file.Name] = file
+		}
+	}
+	names := make([]string, 0, len(newest))
+	for name := range newest {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tree := &gridfsTree{}
+	root := tree.addNode(nil, "", modTime)
+
+	// create every directory first so that files never take their names
+	for _, name := range names {
+		parts := splitGridFSPath(name)
+		dir := root
+		for _, part := range parts[:len(parts)-1] {
+			child := dir.byName[part]
+			if child == nil {
+				child = tree.addNode(dir, part, modTime)
+			}
+			dir = child
+		}
+	}
+
+	for _, name := range names {
+		file := newest[name]
+		parts := splitGridFSPath(name)
+		dir := root
+		for _, part := range parts[:len(parts)-1] {
+			dir = dir.byName[part]
+		}
+		base := parts[len(parts)-1]
+		nodeName := base
+		for i := 1; dir.byName[nodeName] != nil; i++ {
+			nodeName = fmt.Sprintf("%v.%d", base, i)
+		}
+		if nodeName != base {
+			log.Logvf(log.Info, "showing '%v' as '%v', since its path is already in use", name, path.Join(dir.path(), nodeName))
+		}
+		node := tree.addNode(dir, nodeName, file.UploadDate)
+		node.file = file
+		for d := dir; d != nil; d = d.parent {
+			if d.modTime.Equal(modTime) || file.UploadDate.After(d.modTime) {
+				d.modTime = file.UploadDate
+			}
+		}
+	}
+
+	for _, node := range tree.nodes {
+		sort.Slice(node.children, func(i, j int) bool {
+			return node.children[i].name < node.children[j].name
+		})
+	}
+	return tree
+}
+
+// splitGridFSPath returns the parts of a GridFS filename, as a cleaned
+// relative path.
+func splitGridFSPath(filename string) []string {
+	cleaned := strings.TrimPrefix(path.Clean("/"+filename), "/")
+	if cleaned == "" {
+		cleaned = "unnamed"
+	}
+	return strings.Split(cleaned, "/")
+}
+
+func (tree *gridfsTree) addNode(parent *gridfsNode, name string, modTime time.Time) *gridfsNode {
+	node := &gridfsNode{
+		ino:     uint64(len(tree.nodes) + 1),
+		name:    name,
+		parent:  parent,
+		modTime: modTime,
+		byName:  map[string]*gridfsNode{},
+	}
+	tree.nodes = append(tree.nodes, node)
+	if parent != nil {
+		parent.children = append(parent.children, node)
+		parent.byName[name] = node
+	}
+	return node
+}
+
+// node returns the node with the given inode number, or nil if there is none.
+func (tree *gridfsTree) node(ino uint64) *gridfsNode {
+	if ino == 0 || ino > uint64(len(tree.nodes)) {
+		return nil
+	}
+	return tree.nodes[ino-1]
+}
+
+// path returns the path of the node relative to the root directory.
+func (node *gridfsNode) path() string {
+	if node.parent == nil {
+		return ""
+	}
+	return path.Join(node.parent.path(), node.name)
+}
+
+// gridfsFileReader reads the contents of a GridFS file at arbitrary offsets
+// by fetching the chunks that hold them. The last chunk fetched is kept, so
+// sequential reads smaller than a chunk fetch each chunk once.
+type gridfsFileReader struct {
+	file      *gfsFile
+	readChunk func(file *gfsFile, n int64) ([]byte, error)
+
+	mu     sync.Mutex
+	chunkN int64
+	chunk  []byte
+}
+
+func newGridFSFileReader(file *gfsFile, readChunk func(file *gfsFile, n int64) ([]byte, error)) *gridfsFileReader {
+	return &gridfsFileReader{file: file, readChunk: readChunk, chunkN: -1}
+}
+
+// readAt reads into p from offset off of the file. It returns fewer bytes
+// than len(p) only at the end of the file.
+func (r *gridfsFileReader) readAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	chunkSize := int64(r.file.ChunkSize)
+	if chunkSize <= 0 {
+		return 0, fmt.Errorf("invalid chunk size %v for '%v'", chunkSize, r.file.Name)
+	}
+	n := 0
+	for n < len(p) && off+int64(n) < r.file.Length {
+		pos := off + int64(n)
+		chunkN := pos / chunkSize
+		if chunkN != r.chunkN {
+			chunk, err := r.readChunk(r.file, chunkN)
+			if err != nil {
+				return n, err
+			}
+			r.chunkN, r.chunk = chunkN, chunk
+		}
+		within := pos - chunkN*chunkSize
+		if within >= int64(len(r.chunk)) {
+			return n, fmt.Errorf("chunk %v of '%v' is shorter than expected", chunkN, r.file.Name)
+		}
+		n += copy(p[n:], r.chunk[within:])
+	}
+	return n, nil
+}
+
+// readChunk fetches the data of chunk n of a file from the chunks collection.
+func (mf *MongoFiles) readChunk(file *gfsFile, n int64) ([]byte, error) {
+	var chunk struct {
+		Data []byte `bson:"data"`
+	}
+	err := mf.bucket.GetChunksCollection().FindOne(context.Background(),
+		bson.D{{Key: "files_id", Value: file.ID}, {Key: "n", Value: n}}).Decode(&chunk)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("chunk %v of '%v' is missing", n, file.Name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading chunk %v of '%v': %v", n, file.Name, err)
+	}
+	return chunk.Data, nil
+}
+
+// handleMount contains the logic for the 'mount' command, which serves a
+// snapshot of the files in the bucket as a read-only filesystem until it is
+// unmounted or mongofiles is interrupted.
+func (mf *MongoFiles) handleMount() (err error) {
+	files, err := mf.findGFSFiles(bson.M{})
+	if err != nil {
+		return fmt.Errorf("error retrieving list of GridFS files: %v", err)
+	}
+	tree := newGridFSTree(files, time.Now())
+	tree.readChunk = mf.readChunk
+
+	fs, err := mountReadOnly(mf.MountPoint, tree)
+	if err != nil {
+		return fmt.Errorf("error mounting GridFS at %v: %v", mf.MountPoint, err)
+	}
+	defer func() {
+		// don't leave the mount point attached to a filesystem nobody serves
+		if err != nil {
+			if unmountErr := fs.unmount(); unmountErr != nil {
+				log.Logvf(log.DebugLow, "error unmounting %v: %v", mf.MountPoint, unmountErr)
+			}
+		}
+	}()
+
+	if err = mf.setStop(fs.unmount); err != nil {
+		return fmt.Errorf("error unmounting %v: %v", mf.MountPoint, err)
+	}
+	log.Logvf(log.Always, "mounted %v file(s) of GridFS bucket '%v' read-only at %v; unmount it or interrupt mongofiles to stop",
+		len(files), mf.StorageOptions.GridFSPrefix, mf.MountPoint)
+
+	if err = fs.serve(); err != nil {
+		return err
+	}
+	log.Logvf(log.Always, "unmounted %v", mf.MountPoint)
+	return nil
+}
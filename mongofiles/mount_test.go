@@ -0,0 +1,146 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGridFSTree(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	older := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+	mountTime := newer.Add(time.Hour)
+	names := func(node *gridfsNode) []string {
+		var out []string
+		for _, child := range node.children {
+			out = append(out, child.name)
+		}
+		return out
+	}
+
+	Convey("With files whose names contain '/'", t, func() {
+		files := []*gfsFile{
+			{ID: 1, Name: "logs/2020/app.log", Length: 1, UploadDate: older},
+			{ID: 2, Name: "logs/2020/app.log", Length: 2, UploadDate: newer},
+			{ID: 3, Name: "/logs//db.log", Length: 3, UploadDate: older},
+			{ID: 4, Name: "logs", Length: 4, UploadDate: older},
+			{ID: 5, Name: "readme", Length: 5, UploadDate: older},
+		}
+		tree := newGridFSTree(files, mountTime)
+		root := tree.node(1)
+
+		Convey("the parts of the names should become directories", func() {
+			So(names(root), ShouldResemble, []string{"logs", "logs.1", "readme"})
+			logs := root.byName["logs"]
+			So(logs.file, ShouldBeNil)
+			So(names(logs), ShouldResemble, []string{"2020", "db.log"})
+			So(logs.byName["db.log"].file.ID, ShouldEqual, 3)
+		})
+
+		Convey("only the newest revision of a file should be shown", func() {
+			appLog := root.byName["logs"].byName["2020"].byName["app.log"]
+			So(appLog.file.ID, ShouldEqual, 2)
+			So(appLog.path(), ShouldEqual, "logs/2020/app.log")
+		})
+
+		Convey("a file named like a directory should be shown with a suffix", func() {
+			So(root.byName["logs.1"].file.ID, ShouldEqual, 4)
+		})
+
+		Convey("directories should have the time of the newest file below them", func() {
+			So(root.byName["logs"].modTime, ShouldEqual, newer)
+			So(root.modTime, ShouldEqual, newer)
+		})
+
+		Convey("nodes should be found by inode number", func() {
+			for _, node := range tree.nodes {
+				So(tree.node(node.ino), ShouldEqual, node)
+			}
+			So(tree.node(0), ShouldBeNil)
+			So(tree.node(uint64(len(tree.nodes)+1)), ShouldBeNil)
+		})
+	})
+}
+
+func TestGridFSFileReader(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a file stored in chunks", t, func() {
+		contents := bytes.Repeat([]byte("0123456789"), 25)
+		file := &gfsFile{Name: "file", Length: int64(len(contents)), ChunkSize: 64}
+		var fetched []int64
+		readChunk := func(f *gfsFile, n int64) ([]byte, error) {
+			fetched = append(fetched, n)
+			start := n * int64(f.ChunkSize)
+			if start >= int64(len(contents)) {
+				return nil, fmt.Errorf("chunk %v is missing", n)
+			}
+			end := start + int64(f.ChunkSize)
+			if end > int64(len(contents)) {
+				end = int64(len(contents))
+			}
+			return contents[start:end], nil
+		}
+		reader := newGridFSFileReader(file, readChunk)
+
+		Convey("reads across chunks should return the contents at the offset", func() {
+			p := make([]byte, 100)
+			n, err := reader.readAt(p, 50)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 100)
+			So(p, ShouldResemble, contents[50:150])
+			So(fetched, ShouldResemble, []int64{0, 1, 2})
+		})
+
+		Convey("sequential reads should fetch each chunk once", func() {
+			var out []byte
+			p := make([]byte, 16)
+			for off := int64(0); off < file.Length; off += 16 {
+				n, err := reader.readAt(p, off)
+				So(err, ShouldBeNil)
+				out = append(out, p[:n]...)
+			}
+			So(out, ShouldResemble, contents)
+			So(fetched, ShouldResemble, []int64{0, 1, 2, 3})
+		})
+
+		Convey("reads at the end of the file should be short", func() {
+			p := make([]byte, 100)
+			n, err := reader.readAt(p, file.Length-10)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 10)
+			n, err = reader.readAt(p, file.Length)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 0)
+		})
+
+		Convey("a missing chunk should be an error", func() {
+			file.Length += 100
+			_, err := reader.readAt(make([]byte, 10), 260)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestMountValidation(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("--readonly should only be accepted with mount", t, func() {
+		mf := &MongoFiles{StorageOptions: &StorageOptions{GridFSPrefix: "fs", ReadOnly: true}}
+		So(mf.ValidateCommand([]string{Mount, "/mnt/gridfs"}), ShouldBeNil)
+		So(mf.MountPoint, ShouldEqual, "/mnt/gridfs")
+		So(mf.ValidateCommand([]string{List}), ShouldNotBeNil)
+	})
+}
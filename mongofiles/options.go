@@ -10,6 +10,7 @@ import (
 	"fmt"
 
 	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/healthcheck"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 )
@@ -29,8 +30,14 @@ Possible commands include:
 	get       - get files with filenames specified in the supporting arguments
 	get_id    - get a file with the given '_id'
 	get_regex - get files matching the supplied 'regex'
-	delete    - delete all files with filename 'filename'
+	delete    - delete all files with filename 'filename', or the files selected by --regex, --olderThan and --query, after confirmation
 	delete_id - delete a file with the given '_id'
+	export-archive - write files to the .tar, .tar.gz or .zip archive 'filename'; an optional second argument is a prefix which exported filenames must begin with
+	import-archive - add the files of an archive written by export-archive
+	mv        - rename the file 'filename' to the name given by a second argument
+	cp        - copy the file 'filename' to the name given by a second argument, optionally into the bucket given by --toBucket
+	mount     - serve the files as a read-only FUSE filesystem at the directory 'filename', with '/' in filenames separating directories; requires --readonly (Linux only)
+	serve     - serve the newest revision of each file over HTTP at its filename, until interrupted; a path ending in '/' lists files
 
 See http://docs.mongodb.com/database-tools/mongofiles/ for more information.`
 
@@ -107,6 +114,38 @@ type StorageOptions struct {
 	// RegexOptions specifies the options passed to "$regex" queries that are used for get_regex
 	// The default is to use no options, i.e. standard PCRE syntax
 	RegexOptions string `long:"regexOptions" default:"" value-name:"<regex-options>" description:"regex options used for get_regex"`
+
+	// ToBucket specifies the GridFS prefix of the bucket that 'cp' copies files to
+	ToBucket string `long:"toBucket" value-name:"<prefix>" description:"GridFS prefix of the bucket to copy files to with cp (default: the --prefix bucket)"`
+
+	// if set, 'AllRevisions' makes mv and cp operate on every revision of a file rather than only the newest
+	AllRevisions bool `long:"all-revisions" description:"rename or copy all revisions of the file with mv|cp, not only the newest"`
+
+	// if set, 'ReadOnly' mounts the bucket without write access with mount
+	ReadOnly bool `long:"readonly" description:"mount the bucket read-only with mount; currently required"`
+
+	// Listen is the address 'serve' accepts HTTP connections on
+	Listen string `long:"listen" value-name:"<host:port>" description:"address to serve HTTP on with serve (default: localhost:8000)"`
+
+	// URLPrefix is the URL path that 'serve' serves files under
+	URLPrefix string `long:"urlPrefix" value-name:"<path>" description:"URL path to serve files under with serve (default: /)"`
+
+	// BearerTokenFile holds a token that 'serve' requires with each request
+	BearerTokenFile string `long:"bearerTokenFile" value-name:"<filename>" description:"file holding a token that serve requires as an 'Authorization: Bearer' header with each request"`
+
+	// Regex, OlderThan and Query select the files that 'delete' removes
+	Regex     string `long:"regex" value-name:"<regex>" description:"delete the files whose filenames match the regex, using --regexOptions"`
+	OlderThan string `long:"olderThan" value-name:"<duration>" description:"delete the files uploaded longer ago than the given duration, e.g. 30d or 12h"`
+	Query     string `long:"query" value-name:"<json>" description:"delete the files whose files collection documents match the given query (v2 Extended JSON), e.g. '{\"metadata.owner\": \"etl\"}'"`
+
+	// DryRun lists the files that 'delete' would remove without removing them
+	DryRun bool `long:"dryRun" description:"with delete, list the files that --regex, --olderThan and --query select without deleting them"`
+
+	// Verify records the SHA-256 of each file on put, and checks the content of each file against its checksums on get
+	Verify bool `long:"verify" description:"with put, record the SHA-256 of each file's content in its metadata; with get, check each file's content against its length and its recorded SHA-256 or MD5 while writing it, and fail, removing the local file, if it is corrupt"`
+
+	// Yes skips the confirmation that 'delete' asks for before removing the selected files
+	Yes bool `long:"yes" description:"with delete, delete the files that --regex, --olderThan and --query select without asking for confirmation"`
 }
 
 // Name returns a human-readable group name for storage options.
@@ -123,3 +162,35 @@ type InputOptions struct {
 func (*InputOptions) Name() string {
 	return "query"
 }
+
+// HealthCheckRequirements returns the privileges needed to run the command
+// in opts, which are checked by --healthCheck.
+func (opts Options) HealthCheckRequirements() []healthcheck.Requirement {
+	command := ""
+	if len(opts.ParsedArgs) > 0 {
+		command = opts.ParsedArgs[0]
+	}
+	actions := []string{"find"}
+	switch command {
+	case Put, PutID, ImportArchive, Copy:
+		actions = append(actions, "insert", "createIndex")
+		if opts.StorageOptions.Verify {
+			actions = append(actions, "update")
+		}
+	case Delete, DeleteID:
+		actions = append(actions, "remove")
+	case Move:
+		actions = append(actions, "update")
+	}
+	purpose := fmt.Sprintf("run '%v' on the GridFS bucket", command)
+
+	var requirements []healthcheck.Requirement
+	for _, suffix := range []string{".files", ".chunks"} {
+		requirements = append(requirements, healthcheck.Requirement{
+			Resource: healthcheck.Resource{DB: opts.StorageOptions.DB, Collection: opts.StorageOptions.GridFSPrefix + suffix},
+			Actions:  actions,
+			Purpose:  purpose,
+		})
+	}
+	return requirements
+}
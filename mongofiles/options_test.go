@@ -428,6 +428,14 @@ func TestPositionalArgumentParsing(t *testing.T) {
 				InputArgs: []string{"get", "mongodb://foo"},
 				ExpectErr: "'get' argument missing",
 			},
+			{
+				InputArgs: []string{"mount"},
+				ExpectErr: "'mount' argument missing",
+			},
+			{
+				InputArgs: []string{"mount", "/mnt/gridfs"},
+				ExpectErr: "'mount' only supports read-only mounts; specify --readonly",
+			},
 			{
 				InputArgs: []string{"foo", "bar"},
 				ExpectErr: "'foo' is not a valid command (If you are trying to specify a connection string, it must begin with mongodb:// or mongodb+srv://)",
@@ -0,0 +1,213 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	driverOptions "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// defaultListenAddress is the address serve listens on without --listen.
+	defaultListenAddress = "localhost:8000"
+
+	// serveShutdownTimeout is how long serve waits for requests in progress
+	// when it is interrupted.
+	serveShutdownTimeout = 5 * time.Second
+)
+
+// gridfsHandler serves the newest revision of each GridFS file over HTTP at
+// its filename under urlPrefix. A path ending in '/' lists the files whose
+// names begin with the part of the path after urlPrefix.
+type gridfsHandler struct {
+	urlPrefix string
+	// token, if set, must be given as a bearer token with each request.
+	token []byte
+
+	// findFile returns the newest revision of the named file, or nil if
+	// there is none.
+	findFile func(name string) (*gfsFile, error)
+	// listFiles returns the files whose names begin with prefix.
+	listFiles func(prefix string) ([]*gfsFile, error)
+	readChunk func(file *gfsFile, n int64) ([]byte, error)
+}
+
+// normalizeURLPrefix returns the --urlPrefix path with a leading and
+// trailing '/'.
+func normalizeURLPrefix(prefix string) string {
+	trimmed := strings.Trim(prefix, "/")
+	if trimmed == "" {
+		return "/"
+	}
+	return "/" + trimmed + "/"
+}
+
+func (h *gridfsHandler) authorized(r *http.Request) bool {
+	if len(h.token) == 0 {
+		return true
+	}
+	auth := r.Header.Get("Authorization")
+	const scheme = "Bearer "
+	if len(auth) < len(scheme) || !strings.EqualFold(auth[:len(scheme)], scheme) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(auth[len(scheme):]), h.token) == 1
+}
+
+func (h *gridfsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="mongofiles"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, h.urlPrefix) {
+		http.NotFound(w, r)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, h.urlPrefix)
+	if name == "" || strings.HasSuffix(name, "/") {
+		h.serveList(w, name)
+		return
+	}
+
+	file, err := h.findFile(name)
+	if err != nil {
+		log.Logvf(log.Always, "error finding '%v': %v", name, err)
+		http.Error(w, "error finding file", http.StatusInternalServerError)
+		return
+	}
+	if file == nil {
+		http.NotFound(w, r)
+		return
+	}
+	log.Logvf(log.DebugLow, "serving '%v' to %v", name, r.RemoteAddr)
+
+	if file.Metadata.ContentType != "" {
+		w.Header().Set("Content-Type", file.Metadata.ContentType)
+	}
+	if file.Md5 != "" {
+		w.Header().Set("ETag", `"`+file.Md5+`"`)
+	}
+	reader := gridfsReaderAt{newGridFSFileReader(file, h.readChunk)}
+	http.ServeContent(w, r, name, file.UploadDate, io.NewSectionReader(reader, 0, file.Length))
+}
+
+// serveList writes the name and length of each file whose name begins with
+// prefix, in the format of the 'list' command.
+func (h *gridfsHandler) serveList(w http.ResponseWriter, prefix string) {
+	files, err := h.listFiles(prefix)
+	if err != nil {
+		log.Logvf(log.Always, "error listing files beginning with '%v': %v", prefix, err)
+		http.Error(w, "error listing files", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, file := range files {
+		fmt.Fprintf(w, "%s\t%d\n", file.Name, file.Length)
+	}
+}
+
+// gridfsReaderAt adapts a gridfsFileReader to io.ReaderAt.
+type gridfsReaderAt struct {
+	*gridfsFileReader
+}
+
+func (r gridfsReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.readAt(p, off)
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// findNewestFile returns the newest revision of the named file, or nil if
+// there is none.
+func (mf *MongoFiles) findNewestFile(name string) (*gfsFile, error) {
+	var file gfsFile
+	err := mf.bucket.GetFilesCollection().FindOne(context.Background(), bson.M{"filename": name},
+		driverOptions.FindOne().SetSort(bson.D{{Key: "uploadDate", Value: -1}})).Decode(&file)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	file.mf = mf
+	return &file, nil
+}
+
+// handleServe contains the logic for the 'serve' command, which serves the
+// files in the bucket over HTTP until mongofiles is interrupted.
+func (mf *MongoFiles) handleServe() error {
+	handler := &gridfsHandler{
+		urlPrefix: normalizeURLPrefix(mf.StorageOptions.URLPrefix),
+		findFile:  mf.findNewestFile,
+		listFiles: func(prefix string) ([]*gfsFile, error) {
+			return mf.findGFSFiles(bson.M{"filename": bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)}})
+		},
+		readChunk: mf.readChunk,
+	}
+	if mf.StorageOptions.BearerTokenFile != "" {
+		token, err := ioutil.ReadFile(util.ToUniversalPath(mf.StorageOptions.BearerTokenFile))
+		if err != nil {
+			return fmt.Errorf("error reading --bearerTokenFile: %v", err)
+		}
+		handler.token = []byte(strings.TrimSpace(string(token)))
+		if len(handler.token) == 0 {
+			return fmt.Errorf("--bearerTokenFile %v is empty", mf.StorageOptions.BearerTokenFile)
+		}
+	}
+
+	listener, err := net.Listen("tcp", mf.StorageOptions.Listen)
+	if err != nil {
+		return fmt.Errorf("error listening on %v: %v", mf.StorageOptions.Listen, err)
+	}
+	server := &http.Server{Handler: handler}
+	// Serve returns as soon as Shutdown is called, so shutdown is closed once
+	// the requests in progress have finished as well
+	shutdown := make(chan struct{})
+	var shutdownOnce sync.Once
+	stop := func() error {
+		defer shutdownOnce.Do(func() { close(shutdown) })
+		ctx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+		defer cancel()
+		return server.Shutdown(ctx)
+	}
+	if err = mf.setStop(stop); err != nil {
+		_ = listener.Close()
+		return fmt.Errorf("error stopping the HTTP server: %v", err)
+	}
+
+	log.Logvf(log.Always, "serving GridFS bucket '%v' at http://%v%v; interrupt mongofiles to stop",
+		mf.StorageOptions.GridFSPrefix, listener.Addr(), handler.urlPrefix)
+	if err = server.Serve(listener); err != http.ErrServerClosed {
+		return fmt.Errorf("error serving HTTP: %v", err)
+	}
+	<-shutdown
+	log.Logvf(log.Always, "stopped serving GridFS bucket '%v'", mf.StorageOptions.GridFSPrefix)
+	return nil
+}
@@ -0,0 +1,124 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGridFSHandler(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a handler serving GridFS files", t, func() {
+		contents := bytes.Repeat([]byte("abcdefghij"), 30)
+		file := &gfsFile{
+			Name:       "assets/logo.svg",
+			Length:     int64(len(contents)),
+			ChunkSize:  64,
+			UploadDate: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			Metadata:   gfsFileMetadata{ContentType: "image/svg+xml"},
+		}
+		handler := &gridfsHandler{
+			urlPrefix: normalizeURLPrefix("files"),
+			findFile: func(name string) (*gfsFile, error) {
+				if name == file.Name {
+					return file, nil
+				}
+				return nil, nil
+			},
+			listFiles: func(prefix string) ([]*gfsFile, error) {
+				if strings.HasPrefix(file.Name, prefix) {
+					return []*gfsFile{file}, nil
+				}
+				return nil, nil
+			},
+			readChunk: func(f *gfsFile, n int64) ([]byte, error) {
+				start := n * int64(f.ChunkSize)
+				end := start + int64(f.ChunkSize)
+				if end > f.Length {
+					end = f.Length
+				}
+				return contents[start:end], nil
+			},
+		}
+		get := func(method, path string, header http.Header) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, nil)
+			for key, values := range header {
+				req.Header[key] = values
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			return rec
+		}
+
+		Convey("a file should be served with the content type from its metadata", func() {
+			rec := get(http.MethodGet, "/files/assets/logo.svg", nil)
+			So(rec.Code, ShouldEqual, http.StatusOK)
+			So(rec.Header().Get("Content-Type"), ShouldEqual, "image/svg+xml")
+			So(rec.Header().Get("Accept-Ranges"), ShouldEqual, "bytes")
+			So(rec.Body.Bytes(), ShouldResemble, contents)
+		})
+
+		Convey("a range request should be served the part of the file asked for", func() {
+			rec := get(http.MethodGet, "/files/assets/logo.svg", http.Header{"Range": {"bytes=60-129"}})
+			So(rec.Code, ShouldEqual, http.StatusPartialContent)
+			So(rec.Header().Get("Content-Range"), ShouldEqual, "bytes 60-129/300")
+			So(rec.Body.Bytes(), ShouldResemble, contents[60:130])
+		})
+
+		Convey("a path ending in '/' should list files", func() {
+			rec := get(http.MethodGet, "/files/assets/", nil)
+			So(rec.Code, ShouldEqual, http.StatusOK)
+			So(rec.Body.String(), ShouldEqual, "assets/logo.svg\t300\n")
+		})
+
+		Convey("missing files, paths outside the prefix and other methods should be rejected", func() {
+			So(get(http.MethodGet, "/files/missing", nil).Code, ShouldEqual, http.StatusNotFound)
+			So(get(http.MethodGet, "/assets/logo.svg", nil).Code, ShouldEqual, http.StatusNotFound)
+			So(get(http.MethodPut, "/files/assets/logo.svg", nil).Code, ShouldEqual, http.StatusMethodNotAllowed)
+		})
+
+		Convey("with a bearer token, requests without it should be unauthorized", func() {
+			handler.token = []byte("secret")
+			So(get(http.MethodGet, "/files/assets/logo.svg", nil).Code, ShouldEqual, http.StatusUnauthorized)
+			So(get(http.MethodGet, "/files/assets/logo.svg", http.Header{"Authorization": {"Bearer wrong"}}).Code,
+				ShouldEqual, http.StatusUnauthorized)
+			So(get(http.MethodGet, "/files/assets/logo.svg", http.Header{"Authorization": {"Bearer secret"}}).Code,
+				ShouldEqual, http.StatusOK)
+		})
+	})
+}
+
+func TestServeValidation(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("serve should listen on localhost:8000 by default", t, func() {
+		mf := &MongoFiles{StorageOptions: &StorageOptions{GridFSPrefix: "fs"}}
+		So(mf.ValidateCommand([]string{Serve}), ShouldBeNil)
+		So(mf.StorageOptions.Listen, ShouldEqual, "localhost:8000")
+	})
+
+	Convey("serve options should only be accepted with serve", t, func() {
+		mf := &MongoFiles{StorageOptions: &StorageOptions{GridFSPrefix: "fs", URLPrefix: "/files"}}
+		So(mf.ValidateCommand([]string{List}), ShouldNotBeNil)
+	})
+
+	Convey("URL prefixes should begin and end with '/'", t, func() {
+		So(normalizeURLPrefix(""), ShouldEqual, "/")
+		So(normalizeURLPrefix("/"), ShouldEqual, "/")
+		So(normalizeURLPrefix("files"), ShouldEqual, "/files/")
+		So(normalizeURLPrefix("/a/b/"), ShouldEqual, "/a/b/")
+	})
+}
@@ -0,0 +1,97 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// contentVerifier hashes the content of a GridFS file as it is written out,
+// so that it can be checked against the length and checksums stored for the
+// file. The SHA-256 is recorded in the file's metadata by put --verify; the
+// MD5 is recorded by older drivers and tools.
+type contentVerifier struct {
+	file   *gfsFile
+	length int64
+	md5    hash.Hash
+	sha256 hash.Hash
+}
+
+// newContentVerifier returns a verifier for file, which hashes only what the
+// file has checksums for.
+func newContentVerifier(file *gfsFile) *contentVerifier {
+	v := &contentVerifier{file: file}
+	if file.Md5 != "" {
+		v.md5 = md5.New()
+	}
+	if file.Metadata.SHA256 != "" {
+		v.sha256 = sha256.New()
+	}
+	return v
+}
+
+// hasChecksum returns whether the file has a checksum to verify.
+func (v *contentVerifier) hasChecksum() bool {
+	return v.md5 != nil || v.sha256 != nil
+}
+
+func (v *contentVerifier) Write(p []byte) (int, error) {
+	v.length += int64(len(p))
+	if v.md5 != nil {
+		v.md5.Write(p)
+	}
+	if v.sha256 != nil {
+		v.sha256.Write(p)
+	}
+	return len(p), nil
+}
+
+// verify returns an error if the content written does not match the file's
+// length or any of its checksums.
+func (v *contentVerifier) verify() error {
+	if v.length != v.file.Length {
+		return fmt.Errorf("content of '%v' is corrupt: read %v bytes, expected %v", v.file.Name, v.length, v.file.Length)
+	}
+	if v.sha256 != nil {
+		if sum := hex.EncodeToString(v.sha256.Sum(nil)); sum != v.file.Metadata.SHA256 {
+			return fmt.Errorf("content of '%v' is corrupt: SHA-256 is %v, expected %v", v.file.Name, sum, v.file.Metadata.SHA256)
+		}
+	}
+	if v.md5 != nil {
+		if sum := hex.EncodeToString(v.md5.Sum(nil)); sum != v.file.Md5 {
+			return fmt.Errorf("content of '%v' is corrupt: MD5 is %v, expected %v", v.file.Name, sum, v.file.Md5)
+		}
+	}
+	return nil
+}
+
+// hashingReader returns a reader of r that adds what is read to a SHA-256
+// hash, and the hash.
+func hashingReader(r io.Reader) (io.Reader, hash.Hash) {
+	h := sha256.New()
+	return io.TeeReader(r, h), h
+}
+
+// recordSHA256 stores the SHA-256 of a file's content, which is only known
+// once the file is written, in its metadata.
+func (mf *MongoFiles) recordSHA256(id interface{}, sum []byte) error {
+	_, err := mf.bucket.GetFilesCollection().UpdateOne(context.Background(),
+		bson.D{{Key: "_id", Value: id}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "metadata.sha256", Value: hex.EncodeToString(sum)}}}})
+	if err != nil {
+		return fmt.Errorf("error recording SHA-256 of '%v': %v", id, err)
+	}
+	return nil
+}
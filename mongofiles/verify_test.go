@@ -0,0 +1,112 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/mongodb/mongo-tools/common/util"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestContentVerifier(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a file whose checksums are stored", t, func() {
+		file := &gfsFile{
+			Name:   "hello.txt",
+			Length: 5,
+			Md5:    "5d41402abc4b2a76b9719d911017c592",
+			Metadata: gfsFileMetadata{
+				SHA256: "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+			},
+		}
+
+		Convey("its content should verify", func() {
+			v := newContentVerifier(file)
+			So(v.hasChecksum(), ShouldBeTrue)
+			v.Write([]byte("hel"))
+			v.Write([]byte("lo"))
+			So(v.verify(), ShouldBeNil)
+		})
+
+		Convey("corrupt content should not", func() {
+			v := newContentVerifier(file)
+			v.Write([]byte("jello"))
+			So(v.verify(), ShouldNotBeNil)
+
+			file.Metadata.SHA256 = ""
+			v = newContentVerifier(file)
+			v.Write([]byte("jello"))
+			So(v.verify(), ShouldNotBeNil)
+		})
+
+		Convey("truncated content should not", func() {
+			file.Md5, file.Metadata.SHA256 = "", ""
+			v := newContentVerifier(file)
+			So(v.hasChecksum(), ShouldBeFalse)
+			v.Write([]byte("hell"))
+			So(v.verify(), ShouldNotBeNil)
+		})
+	})
+
+	Convey("--verify should only be accepted with get and put", t, func() {
+		mf := &MongoFiles{StorageOptions: &StorageOptions{GridFSPrefix: "fs", Verify: true}}
+		So(mf.ValidateCommand([]string{Get, "file"}), ShouldBeNil)
+		So(mf.ValidateCommand([]string{PutID, "file", "1"}), ShouldBeNil)
+		So(mf.ValidateCommand([]string{Delete, "file"}), ShouldNotBeNil)
+	})
+}
+
+func TestVerifyCommands(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.IntegrationTestType)
+
+	Convey("With a file put with --verify", t, func() {
+		defer tearDownGridFSTestData()
+
+		mf, err := simpleMongoFilesInstanceWithFilename(Put, "lorem_ipsum_287613_bytes.txt")
+		So(err, ShouldBeNil)
+		mf.StorageOptions.LocalFileName = util.ToUniversalPath("testdata/lorem_ipsum_287613_bytes.txt")
+		mf.StorageOptions.Verify = true
+		_, err = mf.Run(false)
+		So(err, ShouldBeNil)
+
+		get := func() error {
+			mf, err := simpleMongoFilesInstanceWithFilename(Get, "lorem_ipsum_287613_bytes.txt")
+			So(err, ShouldBeNil)
+			mf.StorageOptions.LocalFileName = "verified_lorem_ipsum.txt"
+			mf.StorageOptions.Verify = true
+			_, err = mf.Run(false)
+			return err
+		}
+		defer os.Remove("verified_lorem_ipsum.txt")
+
+		Convey("get --verify should write its content", func() {
+			So(get(), ShouldBeNil)
+			contents, err := ioutil.ReadFile("verified_lorem_ipsum.txt")
+			So(err, ShouldBeNil)
+			So(len(contents), ShouldEqual, 287613)
+		})
+
+		Convey("get --verify should fail and remove the local file if a chunk is corrupt", func() {
+			// the same number of bytes, so that only the checksums can tell
+			corrupt := bytes.Repeat([]byte("x"), 255*1024)
+			_, err := mf.bucket.GetChunksCollection().UpdateOne(context.Background(),
+				bson.D{{Key: "n", Value: 0}},
+				bson.D{{Key: "$set", Value: bson.D{{Key: "data", Value: corrupt}}}})
+			So(err, ShouldBeNil)
+			So(get(), ShouldNotBeNil)
+			So(fileExists("verified_lorem_ipsum.txt"), ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,237 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// arrayField is an --arrayFields argument of the form
+// <field>[,<field>]*=><field>: the fields of each row whose values are
+// folded into the array field target.
+type arrayField struct {
+	sources []string
+	target  string
+}
+
+// parseArrayField parses an --arrayFields argument.
+func parseArrayField(arg string) (arrayField, error) {
+	i := strings.Index(arg, "=>")
+	if i < 0 {
+		return arrayField{}, fmt.Errorf("'%v' must be of the form <field>[,<field>]*=><field>", arg)
+	}
+	field := arrayField{sources: strings.Split(arg[:i], ","), target: arg[i+2:]}
+	seen := map[string]bool{}
+	for _, name := range append([]string{field.target}, field.sources...) {
+		if name == "" {
+			return arrayField{}, fmt.Errorf("'%v' contains an empty field name", arg)
+		}
+		if strings.ContainsAny(name, ".$") {
+			return arrayField{}, fmt.Errorf("field '%v' in '%v' must be a top-level field name", name, arg)
+		}
+	}
+	for _, source := range field.sources {
+		if seen[source] {
+			return arrayField{}, fmt.Errorf("field '%v' is repeated in '%v'", source, arg)
+		}
+		seen[source] = true
+	}
+	return field, nil
+}
+
+// rowReshaper folds the fields given by --arrayFields into arrays, either
+// within each row or, with --groupRowsBy, across consecutive rows that share
+// the same values of the group key fields. A group is imported as the fields
+// of its first row, with each array field holding one element per row: the
+// value of its field if it has a single field, or else an embedded document
+// of its fields.
+type rowReshaper struct {
+	arrayFields []arrayField
+	groupBy     []string
+}
+
+// newRowReshaper returns a rowReshaper for the given --arrayFields and
+// --groupRowsBy arguments.
+func newRowReshaper(arrayArgs []string, groupBy string) (*rowReshaper, error) {
+	r := &rowReshaper{}
+	sourceOf := map[string]string{}
+	targets := map[string]bool{}
+	for _, arg := range arrayArgs {
+		field, err := parseArrayField(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --arrayFields argument: %v", err)
+		}
+		if targets[field.target] {
+			return nil, fmt.Errorf("invalid --arrayFields argument: field '%v' is the target of more than one array", field.target)
+		}
+		targets[field.target] = true
+		for _, source := range field.sources {
+			if other, ok := sourceOf[source]; ok {
+				return nil, fmt.Errorf("invalid --arrayFields argument: field '%v' is folded into both '%v' and '%v'", source, other, field.target)
+			}
+			sourceOf[source] = field.target
+		}
+		r.arrayFields = append(r.arrayFields, field)
+	}
+	for _, field := range r.arrayFields {
+		if other, ok := sourceOf[field.target]; ok && other != field.target {
+			return nil, fmt.Errorf("invalid --arrayFields argument: field '%v' is folded into '%v' and cannot also be an array", field.target, other)
+		}
+	}
+
+	if groupBy == "" {
+		return r, nil
+	}
+	if len(r.arrayFields) == 0 {
+		return nil, fmt.Errorf("--groupRowsBy requires --arrayFields to name the fields collected from each row")
+	}
+	r.groupBy = strings.Split(groupBy, ",")
+	if err := validateFields(r.groupBy, false); err != nil {
+		return nil, fmt.Errorf("invalid --groupRowsBy argument: %v", err)
+	}
+	for _, key := range r.groupBy {
+		top := strings.SplitN(key, ".", 2)[0]
+		if _, ok := sourceOf[top]; ok || targets[top] {
+			return nil, fmt.Errorf("invalid --groupRowsBy argument: field '%v' is also used by --arrayFields", key)
+		}
+	}
+	return r, nil
+}
+
+// grouping returns whether rows are grouped, which requires them to be read
+// in order.
+func (r *rowReshaper) grouping() bool {
+	return len(r.groupBy) > 0
+}
+
+// split removes the fields of each array field from document. It returns the
+// remaining fields, with an empty array for each array field at the position
+// of the first of its fields present, or at the end if none are present,
+// along with the index of each array and the fields removed for it.
+func (r *rowReshaper) split(document bson.D) (rest bson.D, positions []int, values []bson.D) {
+	spec := map[string]int{}
+	for i, field := range r.arrayFields {
+		for _, source := range field.sources {
+			spec[source] = i
+		}
+	}
+	positions = make([]int, len(r.arrayFields))
+	for i := range positions {
+		positions[i] = -1
+	}
+	values = make([]bson.D, len(r.arrayFields))
+
+	rest = make(bson.D, 0, len(document)+len(r.arrayFields))
+	for _, elem := range document {
+		i, ok := spec[elem.Key]
+		if !ok {
+			rest = append(rest, elem)
+			continue
+		}
+		if positions[i] < 0 {
+			positions[i] = len(rest)
+			rest = append(rest, bson.E{Key: r.arrayFields[i].target, Value: bson.A{}})
+		}
+		values[i] = append(values[i], elem)
+	}
+	for i, field := range r.arrayFields {
+		if positions[i] < 0 {
+			positions[i] = len(rest)
+			rest = append(rest, bson.E{Key: field.target, Value: bson.A{}})
+		}
+	}
+	return rest, positions, values
+}
+
+// fold returns document with the fields of each array field replaced by an
+// array of their values, in the order they are given in --arrayFields.
+func (r *rowReshaper) fold(document bson.D) bson.D {
+	rest, positions, values := r.split(document)
+	for i, field := range r.arrayFields {
+		array := bson.A{}
+		for _, source := range field.sources {
+			for _, elem := range values[i] {
+				if elem.Key == source {
+					array = append(array, elem.Value)
+				}
+			}
+		}
+		rest[positions[i]].Value = array
+	}
+	return rest
+}
+
+// element returns the array element contributed by a row of a group from the
+// fields removed for field, or false if the row has none of its fields.
+func (field arrayField) element(values bson.D) (interface{}, bool) {
+	if len(values) == 0 {
+		return nil, false
+	}
+	if len(field.sources) == 1 {
+		return values[0].Value, true
+	}
+	return values, true
+}
+
+// groupKey returns the values of the group key fields of document.
+func (r *rowReshaper) groupKey(document bson.D) []interface{} {
+	key := make([]interface{}, len(r.groupBy))
+	for i, field := range r.groupBy {
+		key[i] = getUpsertValue(field, document)
+	}
+	return key
+}
+
+// stream reads rows from in and sends the reshaped documents to out, which it
+// closes once in is closed. It returns early if dying is closed.
+func (r *rowReshaper) stream(in <-chan bson.D, out chan<- bson.D, dying <-chan struct{}) error {
+	defer close(out)
+	send := func(document bson.D) bool {
+		select {
+		case out <- document:
+			return true
+		case <-dying:
+			return false
+		}
+	}
+
+	if !r.grouping() {
+		for document := range in {
+			if !send(r.fold(document)) {
+				return nil
+			}
+		}
+		return nil
+	}
+
+	var group bson.D
+	var groupKey []interface{}
+	var positions []int
+	for document := range in {
+		key := r.groupKey(document)
+		rest, restPositions, values := r.split(document)
+		if group == nil || !reflect.DeepEqual(key, groupKey) {
+			if group != nil && !send(group) {
+				return nil
+			}
+			group, groupKey, positions = rest, key, restPositions
+		}
+		for i, field := range r.arrayFields {
+			if element, ok := field.element(values[i]); ok {
+				group[positions[i]].Value = append(group[positions[i]].Value.(bson.A), element)
+			}
+		}
+	}
+	if group != nil {
+		send(group)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestNewRowReshaper(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Valid arguments should be parsed", t, func() {
+		r, err := newRowReshaper([]string{"tag1,tag2,tag3=>tags", "note=>note"}, "")
+		So(err, ShouldBeNil)
+		So(r.arrayFields, ShouldResemble, []arrayField{
+			{sources: []string{"tag1", "tag2", "tag3"}, target: "tags"},
+			{sources: []string{"note"}, target: "note"},
+		})
+		So(r.grouping(), ShouldBeFalse)
+
+		r, err = newRowReshaper([]string{"sku,qty=>items"}, "order,customer.id")
+		So(err, ShouldBeNil)
+		So(r.groupBy, ShouldResemble, []string{"order", "customer.id"})
+		So(r.grouping(), ShouldBeTrue)
+	})
+
+	Convey("Invalid arguments should be rejected", t, func() {
+		for _, args := range [][]string{
+			{"tags"}, {"=>tags"}, {"a,,b=>tags"}, {"a,b=>"}, {"a,a=>tags"},
+			{"a.b=>tags"}, {"a=>t.ags"}, {"a=>x", "b=>x"}, {"a=>x", "a=>y"}, {"a=>x", "x=>y"},
+		} {
+			_, err := newRowReshaper(args, "")
+			So(err, ShouldNotBeNil)
+		}
+		for _, groupBy := range []string{"a", "x", "x.y", "$k"} {
+			_, err := newRowReshaper([]string{"a,b=>x"}, groupBy)
+			So(err, ShouldNotBeNil)
+		}
+		_, err := newRowReshaper(nil, "k")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+// reshapeCSV imports csv with the given fields through a rowReshaper.
+func reshapeCSV(r *rowReshaper, fields, csv string) []bson.D {
+	reader := NewCSVInputReader(ParseAutoHeaders(strings.Split(fields, ",")), bytes.NewReader([]byte(csv)), os.Stdout, 1, true, false)
+	rows := make(chan bson.D, 10)
+	out := make(chan bson.D, 10)
+	go reader.StreamDocument(r.grouping(), rows)
+	go r.stream(rows, out, make(chan struct{}))
+
+	var documents []bson.D
+	for document := range out {
+		documents = append(documents, document)
+	}
+	return documents
+}
+
+func TestRowReshaperStream(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Array fields should fold the fields of each row in place", t, func() {
+		r, _ := newRowReshaper([]string{"tag1,tag2,tag3=>tags"}, "")
+		documents := reshapeCSV(r, "name,tag3,tag1,tag2,n", "a,z,x,y,1\nb,,x,,2\n")
+		So(documents, ShouldResemble, []bson.D{
+			{{Key: "name", Value: "a"}, {Key: "tags", Value: bson.A{"x", "y", "z"}}, {Key: "n", Value: int32(1)}},
+			{{Key: "name", Value: "b"}, {Key: "tags", Value: bson.A{"x"}}, {Key: "n", Value: int32(2)}},
+		})
+	})
+
+	Convey("Grouped rows should collect one element per row", t, func() {
+		r, _ := newRowReshaper([]string{"sku,qty=>items", "note=>notes"}, "order")
+		documents := reshapeCSV(r, "order,customer,sku,qty,note",
+			"1,ann,s1,2,gift\n1,ann,s2,1,\n2,bob,s1,5,\n1,ann,s3,1,late\n")
+		So(documents, ShouldResemble, []bson.D{
+			{{Key: "order", Value: int32(1)}, {Key: "customer", Value: "ann"}, {Key: "items", Value: bson.A{
+				bson.D{{Key: "sku", Value: "s1"}, {Key: "qty", Value: int32(2)}},
+				bson.D{{Key: "sku", Value: "s2"}, {Key: "qty", Value: int32(1)}},
+			}}, {Key: "notes", Value: bson.A{"gift"}}},
+			{{Key: "order", Value: int32(2)}, {Key: "customer", Value: "bob"}, {Key: "items", Value: bson.A{
+				bson.D{{Key: "sku", Value: "s1"}, {Key: "qty", Value: int32(5)}},
+			}}, {Key: "notes", Value: bson.A{}}},
+			{{Key: "order", Value: int32(1)}, {Key: "customer", Value: "ann"}, {Key: "items", Value: bson.A{
+				bson.D{{Key: "sku", Value: "s3"}, {Key: "qty", Value: int32(1)}},
+			}}, {Key: "notes", Value: bson.A{"late"}}},
+		})
+	})
+}
@@ -0,0 +1,155 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"fmt"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// changeEvent holds the fields of a change stream event, as written by
+// mongoexport --follow or by Atlas triggers, that are needed to apply it.
+type changeEvent struct {
+	operationType     string
+	documentKey       bson.D
+	fullDocument      bson.D
+	updateDescription bson.D
+}
+
+// parseChangeEvent returns the fields of a change event read from the input.
+func parseChangeEvent(document bson.D) (changeEvent, error) {
+	var event changeEvent
+	for _, elem := range document {
+		var ok bool
+		switch elem.Key {
+		case "operationType":
+			event.operationType, ok = elem.Value.(string)
+		case "documentKey":
+			event.documentKey, ok = elem.Value.(bson.D)
+		case "fullDocument":
+			if elem.Value == nil {
+				continue
+			}
+			event.fullDocument, ok = elem.Value.(bson.D)
+		case "updateDescription":
+			event.updateDescription, ok = elem.Value.(bson.D)
+		default:
+			continue
+		}
+		if !ok {
+			return changeEvent{}, fmt.Errorf("invalid change event: '%v' has the wrong type", elem.Key)
+		}
+	}
+	if event.operationType == "" {
+		return changeEvent{}, fmt.Errorf("invalid change event: no operationType")
+	}
+	return event, nil
+}
+
+// updateDocument returns the update that an update event describes: a $set
+// of its updated fields and an $unset of its removed fields. It returns nil
+// if the event changed no fields.
+func (event changeEvent) updateDocument() (bson.D, error) {
+	var updated bson.D
+	var removed []interface{}
+	for _, elem := range event.updateDescription {
+		var ok bool
+		switch elem.Key {
+		case "updatedFields":
+			updated, ok = elem.Value.(bson.D)
+		case "removedFields":
+			switch fields := elem.Value.(type) {
+			case bson.A:
+				removed, ok = fields, true
+			case []interface{}:
+				removed, ok = fields, true
+			}
+		default:
+			continue
+		}
+		if !ok {
+			return nil, fmt.Errorf("invalid change event: updateDescription.%v has the wrong type", elem.Key)
+		}
+	}
+
+	var update bson.D
+	if len(updated) > 0 {
+		update = append(update, bson.E{Key: "$set", Value: updated})
+	}
+	if len(removed) > 0 {
+		unset := make(bson.D, 0, len(removed))
+		for _, field := range removed {
+			name, ok := field.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid change event: updateDescription.removedFields holds a non-string")
+			}
+			unset = append(unset, bson.E{Key: name, Value: ""})
+		}
+		update = append(update, bson.E{Key: "$unset", Value: unset})
+	}
+	return update, nil
+}
+
+// validateChangeStreamSettings checks the options for --type=changestream,
+// whose events are applied in order as they say, rather than according to
+// --mode.
+func (imp *MongoImport) validateChangeStreamSettings() error {
+	switch {
+	case imp.IngestOptions.Mode != "" || imp.IngestOptions.Upsert || imp.IngestOptions.UpsertFields != "":
+		return fmt.Errorf("can not use --mode, --upsert or --upsertFields when input type is %v", ChangeStream)
+	case imp.InputOptions.JSONArray:
+		return fmt.Errorf("can not use --jsonArray when input type is %v", ChangeStream)
+	case imp.IngestOptions.IDStrategy != "" || imp.IngestOptions.DedupeBy != "" || imp.IngestOptions.Staged:
+		return fmt.Errorf("can not use --idStrategy, --dedupeBy or --staged when input type is %v", ChangeStream)
+	}
+	imp.IngestOptions.MaintainInsertionOrder = true
+	return nil
+}
+
+// applyChangeEvent adds the write that applies a change event to inserter.
+// Inserts and replaces are written as upserts of the full document, so
+// applying the same events again is harmless, and an update of a document
+// missing from the target inserts the updated fields. Events of other types,
+// such as drops and renames, are skipped.
+func (imp *MongoImport) applyChangeEvent(inserter *db.BufferedBulkInserter, document bson.D) (*mongo.BulkWriteResult, error) {
+	event, err := parseChangeEvent(document)
+	if err != nil {
+		return nil, err
+	}
+
+	switch event.operationType {
+	case "insert", "replace", "update", "delete":
+		if len(event.documentKey) == 0 {
+			return nil, fmt.Errorf("invalid change event: %v event has no documentKey", event.operationType)
+		}
+	default:
+		log.Logvf(log.Info, "skipping %v event", event.operationType)
+		return nil, nil
+	}
+
+	switch event.operationType {
+	case "insert", "replace":
+		if event.fullDocument == nil {
+			return nil, fmt.Errorf("invalid change event: %v event has no fullDocument", event.operationType)
+		}
+		return inserter.Replace(event.documentKey, event.fullDocument)
+	case "update":
+		update, err := event.updateDocument()
+		if err != nil {
+			return nil, err
+		}
+		if update == nil {
+			return nil, nil
+		}
+		return inserter.Update(event.documentKey, update)
+	}
+	return inserter.Delete(event.documentKey, nil)
+}
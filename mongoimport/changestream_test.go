@@ -0,0 +1,94 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseChangeEvent(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a change event", t, func() {
+		Convey("the fields needed to apply it should be parsed", func() {
+			event, err := parseChangeEvent(bson.D{
+				{Key: "_id", Value: bson.D{{Key: "_data", Value: "token"}}},
+				{Key: "operationType", Value: "insert"},
+				{Key: "documentKey", Value: bson.D{{Key: "_id", Value: int32(1)}}},
+				{Key: "fullDocument", Value: bson.D{{Key: "_id", Value: int32(1)}, {Key: "a", Value: "b"}}},
+			})
+			So(err, ShouldBeNil)
+			So(event.operationType, ShouldEqual, "insert")
+			So(event.documentKey, ShouldResemble, bson.D{{Key: "_id", Value: int32(1)}})
+			So(event.fullDocument, ShouldResemble, bson.D{{Key: "_id", Value: int32(1)}, {Key: "a", Value: "b"}})
+		})
+
+		Convey("a null fullDocument should be allowed", func() {
+			event, err := parseChangeEvent(bson.D{
+				{Key: "operationType", Value: "update"},
+				{Key: "documentKey", Value: bson.D{{Key: "_id", Value: int32(1)}}},
+				{Key: "fullDocument", Value: nil},
+			})
+			So(err, ShouldBeNil)
+			So(event.fullDocument, ShouldBeNil)
+		})
+
+		Convey("an event without an operationType should be rejected", func() {
+			_, err := parseChangeEvent(bson.D{{Key: "documentKey", Value: bson.D{{Key: "_id", Value: int32(1)}}}})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("an event with a field of the wrong type should be rejected", func() {
+			_, err := parseChangeEvent(bson.D{
+				{Key: "operationType", Value: "delete"},
+				{Key: "documentKey", Value: "1"},
+			})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestChangeEventUpdateDocument(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With an update event", t, func() {
+		Convey("updated fields should be set and removed fields unset", func() {
+			event := changeEvent{updateDescription: bson.D{
+				{Key: "updatedFields", Value: bson.D{{Key: "a", Value: int32(2)}}},
+				{Key: "removedFields", Value: bson.A{"b", "c.d"}},
+			}}
+			update, err := event.updateDocument()
+			So(err, ShouldBeNil)
+			So(update, ShouldResemble, bson.D{
+				{Key: "$set", Value: bson.D{{Key: "a", Value: int32(2)}}},
+				{Key: "$unset", Value: bson.D{{Key: "b", Value: ""}, {Key: "c.d", Value: ""}}},
+			})
+		})
+
+		Convey("an update that changed no fields should be nil", func() {
+			event := changeEvent{updateDescription: bson.D{
+				{Key: "updatedFields", Value: bson.D{}},
+				{Key: "removedFields", Value: bson.A{}},
+			}}
+			update, err := event.updateDocument()
+			So(err, ShouldBeNil)
+			So(update, ShouldBeNil)
+		})
+
+		Convey("a removed field that is not a string should be rejected", func() {
+			event := changeEvent{updateDescription: bson.D{
+				{Key: "removedFields", Value: bson.A{int32(1)}},
+			}}
+			_, err := event.updateDocument()
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
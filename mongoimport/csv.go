@@ -43,6 +43,9 @@ type CSVInputReader struct {
 
 	// useArrayIndexFields is whether field names include array indexes
 	useArrayIndexFields bool
+
+	// progress follows how far into the input the documents reach, if set by --stateFile
+	progress *importProgress
 }
 
 // CSVConverter implements the Converter interface for CSV input.
@@ -123,7 +126,7 @@ func (r *CSVInputReader) StreamDocument(ordered bool, readDocs chan bson.D) (ret
 				}
 				return
 			}
-			csvRecordChan <- CSVConverter{
+			var converter Converter = CSVConverter{
 				colSpecs:            r.colSpecs,
 				data:                r.csvRecord,
 				index:               r.numProcessed,
@@ -132,6 +135,10 @@ func (r *CSVInputReader) StreamDocument(ordered bool, readDocs chan bson.D) (ret
 				rejectWriter:        r.csvRejectWriter,
 			}
 			r.numProcessed++
+			if r.progress != nil {
+				converter = trackedConverter{converter, r.progress, r.numProcessed, r.csvReader.Offset()}
+			}
+			csvRecordChan <- converter
 		}
 	}()
 
@@ -113,6 +113,7 @@ type Reader struct {
 	TrimLeadingSpace bool // trim leading space
 	line             int
 	column           int
+	offset           int64
 	r                *bufio.Reader
 	field            bytes.Buffer
 }
@@ -125,6 +126,12 @@ func NewReader(r io.Reader) *Reader {
 	}
 }
 
+// Offset returns the number of bytes of the underlying reader consumed by
+// the records read so far.
+func (r *Reader) Offset() int64 {
+	return r.offset
+}
+
 // error creates a new ParseError based on err.
 func (r *Reader) error(err error) error {
 	return &ParseError{
@@ -180,17 +187,20 @@ func (r *Reader) ReadAll() (records [][]string, err error) {
 // of how far into the line we have read.  r.column will point to the start
 // of this rune, not the end of this rune.
 func (r *Reader) readRune() (rune, error) {
-	r1, _, err := r.r.ReadRune()
+	r1, size, err := r.r.ReadRune()
+	r.offset += int64(size)
 
 	// Handle \r\n here.  We make the simplifying assumption that
 	// anytime \r is followed by \n that it can be folded to \n.
 	// We will not detect files which contain both \r\n and bare \n.
 	if r1 == '\r' {
-		r1, _, err = r.r.ReadRune()
+		r1, size, err = r.r.ReadRune()
 		if err == nil {
 			if r1 != '\n' {
 				r.r.UnreadRune()
 				r1 = '\r'
+			} else {
+				r.offset += int64(size)
 			}
 		}
 	}
@@ -223,12 +233,13 @@ func (r *Reader) parseRecord() (fields []string, err error) {
 	// If we are support comments and it is the comment character
 	// then skip to the end of line.
 
-	r1, _, err := r.r.ReadRune()
+	r1, size, err := r.r.ReadRune()
 	if err != nil {
 		return nil, err
 	}
 
 	if r.Comment != 0 && r1 == r.Comment {
+		r.offset += int64(size)
 		return nil, r.skip('\n')
 	}
 	r.r.UnreadRune()
@@ -0,0 +1,290 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	driverOptions "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// dedupeByHash is the --dedupeBy strategy that skips documents with the same
+// content as a document already imported.
+const dedupeByHash = "hash"
+
+// hashesSuffix is appended to the target collection's name to name the
+// collection that --dedupeBy=hash records the hash of each imported document
+// in.
+const hashesSuffix = ".__import_hashes"
+
+// hashesCollection returns the name of the collection that the hashes of
+// imported documents are recorded in.
+func (imp *MongoImport) hashesCollection() string {
+	return imp.ToolOptions.Collection + hashesSuffix
+}
+
+// documentHash returns the SHA-256 of the BSON encoding of document as read
+// from the input source, so that the same fields with the same values in the
+// same order always have the same hash. An _id is only covered if the input
+// source has one, since it is hashed before --idStrategy assigns one.
+func documentHash(document bson.D) (string, error) {
+	raw, err := bson.Marshal(document)
+	if err != nil {
+		return "", fmt.Errorf("error hashing document: %v", err)
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// deduper drops documents whose hash was recorded by an earlier import, or
+// earlier in this one. Each hash is claimed, by recording it with a unique
+// _id, before its document is passed on to be inserted, so concurrent imports
+// of overlapping files also insert each document only once. A claim stays
+// pending until its document is written, and the claims still pending when
+// the import ends are removed, so that a later import does not skip documents
+// that this one failed to write.
+type deduper struct {
+	// skipped counts the documents dropped as duplicates, updated atomically,
+	// aligned at the beginning of the struct
+	skipped uint64
+
+	batchSize int
+	// claim records each of hashes, and returns whether each was new rather
+	// than already recorded.
+	claim func(hashes []string) ([]bool, error)
+	// unclaim removes the records of hashes.
+	unclaim func(hashes []string) error
+
+	// the hashes claimed whose documents have not been written yet
+	pendingMutex sync.Mutex
+	pending      map[string]bool
+}
+
+// newHashDeduper returns a deduper that records hashes in coll.
+func newHashDeduper(coll *mongo.Collection, batchSize int) *deduper {
+	return &deduper{
+		batchSize: batchSize,
+		claim: func(hashes []string) ([]bool, error) {
+			return claimHashes(coll, hashes)
+		},
+		unclaim: func(hashes []string) error {
+			return unclaimHashes(coll, hashes)
+		},
+	}
+}
+
+// claimHashes inserts a document with each hash as its _id into coll, and
+// returns whether each was inserted rather than failing as a duplicate.
+func claimHashes(coll *mongo.Collection, hashes []string) ([]bool, error) {
+	docs := make([]interface{}, len(hashes))
+	for i, hash := range hashes {
+		docs[i] = bson.D{{Key: "_id", Value: hash}}
+	}
+	claimed := make([]bool, len(hashes))
+	for i := range claimed {
+		claimed[i] = true
+	}
+
+	_, err := coll.InsertMany(context.Background(), docs, driverOptions.InsertMany().SetOrdered(false))
+	if bwe, ok := err.(mongo.BulkWriteException); ok && bwe.WriteConcernError == nil {
+		for _, writeErr := range bwe.WriteErrors {
+			if writeErr.Code != db.ErrDuplicateKeyCode {
+				return nil, fmt.Errorf("error recording document hashes: %v", writeErr)
+			}
+			claimed[writeErr.Index] = false
+		}
+		return claimed, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error recording document hashes: %v", err)
+	}
+	return claimed, nil
+}
+
+// unclaimHashes removes the documents with each hash as their _id from coll.
+func unclaimHashes(coll *mongo.Collection, hashes []string) error {
+	_, err := coll.DeleteMany(context.Background(), bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: hashes}}}})
+	if err != nil {
+		return fmt.Errorf("error removing document hashes: %v", err)
+	}
+	return nil
+}
+
+// stream reads documents from in, in batches, and sends those whose hashes it
+// claims to out, which it closes once in is closed. It returns early if dying
+// is closed.
+func (d *deduper) stream(in <-chan bson.D, out chan<- bson.D, dying <-chan struct{}) error {
+	defer close(out)
+	batch := make([]bson.D, 0, d.batchSize)
+	hashes := make([]string, 0, d.batchSize)
+
+	flush := func() (bool, error) {
+		if len(batch) == 0 {
+			return true, nil
+		}
+		claimed, err := d.claim(hashes)
+		if err != nil {
+			return false, err
+		}
+		d.pendingMutex.Lock()
+		if d.pending == nil {
+			d.pending = make(map[string]bool)
+		}
+		for i, hash := range hashes {
+			if claimed[i] {
+				d.pending[hash] = true
+			}
+		}
+		d.pendingMutex.Unlock()
+		for i, document := range batch {
+			if !claimed[i] {
+				atomic.AddUint64(&d.skipped, 1)
+				continue
+			}
+			select {
+			case out <- document:
+			case <-dying:
+				return false, nil
+			}
+		}
+		batch, hashes = batch[:0], hashes[:0]
+		return true, nil
+	}
+
+	for document := range in {
+		hash, err := documentHash(document)
+		if err != nil {
+			return err
+		}
+		batch = append(batch, document)
+		hashes = append(hashes, hash)
+		if len(batch) < d.batchSize {
+			continue
+		}
+		if ok, err := flush(); !ok {
+			return err
+		}
+	}
+	_, err := flush()
+	return err
+}
+
+// written marks the claims of hashes as kept, since their documents were
+// written.
+func (d *deduper) written(hashes []string) {
+	d.pendingMutex.Lock()
+	defer d.pendingMutex.Unlock()
+	for _, hash := range hashes {
+		delete(d.pending, hash)
+	}
+}
+
+// release removes the claims still pending, in batches, once no more
+// documents are being claimed or written.
+func (d *deduper) release() error {
+	d.pendingMutex.Lock()
+	defer d.pendingMutex.Unlock()
+	if len(d.pending) == 0 {
+		return nil
+	}
+	log.Logvf(log.Info, "removing the recorded hashes of %v document(s) that were not imported", len(d.pending))
+	hashes := make([]string, 0, d.batchSize)
+	for hash := range d.pending {
+		hashes = append(hashes, hash)
+		if len(hashes) < d.batchSize {
+			continue
+		}
+		if err := d.unclaim(hashes); err != nil {
+			return err
+		}
+		hashes = hashes[:0]
+	}
+	if len(hashes) > 0 {
+		if err := d.unclaim(hashes); err != nil {
+			return err
+		}
+	}
+	d.pending = nil
+	return nil
+}
+
+// claimTracker follows the hashes of the documents buffered by an insertion
+// worker's inserter, in order, so that the claims of the documents in each
+// batch can be kept once it is written.
+type claimTracker struct {
+	deduper *deduper
+	ordered bool
+	hashes  []string
+}
+
+// buffer adds the hash of document, which is about to be buffered.
+func (t *claimTracker) buffer(document bson.D) error {
+	hash, err := documentHash(document)
+	if err != nil {
+		return err
+	}
+	t.hashes = append(t.hashes, hash)
+	return nil
+}
+
+// sync drops the hashes of documents that were skipped rather than buffered,
+// given the number of documents now buffered.
+func (t *claimTracker) sync(buffered int) {
+	if len(t.hashes) > buffered {
+		t.hashes = t.hashes[:buffered]
+	}
+}
+
+// flushed is called with the outcome of each bulk write, and keeps the claims
+// of the documents that it wrote. Documents of a batch that failed other than
+// with write errors are treated as not written.
+func (t *claimTracker) flushed(_ *mongo.BulkWriteResult, err error) {
+	defer func() { t.hashes = t.hashes[:0] }()
+	if err == nil {
+		t.deduper.written(t.hashes)
+		return
+	}
+	bwe, ok := err.(mongo.BulkWriteException)
+	if !ok || bwe.WriteConcernError != nil {
+		return
+	}
+	failed := make(map[int]bool, len(bwe.WriteErrors))
+	firstFailed := len(t.hashes)
+	for _, writeErr := range bwe.WriteErrors {
+		failed[writeErr.Index] = true
+		if writeErr.Index < firstFailed {
+			firstFailed = writeErr.Index
+		}
+	}
+	written := make([]string, 0, len(t.hashes))
+	for i, hash := range t.hashes {
+		// an ordered bulk write stops at its first error
+		if failed[i] || (t.ordered && i > firstFailed) {
+			continue
+		}
+		written = append(written, hash)
+	}
+	t.deduper.written(written)
+}
+
+// SkippedCount returns the number of documents skipped by --dedupeBy because
+// they had already been imported.
+func (imp *MongoImport) SkippedCount() uint64 {
+	if imp.deduper == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&imp.deduper.skipped)
+}
@@ -0,0 +1,175 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestDocumentHash(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Documents with the same fields and values should have the same hash", t, func() {
+		a, err := documentHash(bson.D{{Key: "a", Value: int32(1)}, {Key: "b", Value: "x"}})
+		So(err, ShouldBeNil)
+		b, err := documentHash(bson.D{{Key: "a", Value: int32(1)}, {Key: "b", Value: "x"}})
+		So(err, ShouldBeNil)
+		So(a, ShouldEqual, b)
+
+		Convey("but differing values, types or field orders should not", func() {
+			for _, other := range []bson.D{
+				{{Key: "a", Value: int32(2)}, {Key: "b", Value: "x"}},
+				{{Key: "a", Value: int64(1)}, {Key: "b", Value: "x"}},
+				{{Key: "b", Value: "x"}, {Key: "a", Value: int32(1)}},
+				{{Key: "_id", Value: int32(1)}, {Key: "a", Value: int32(1)}, {Key: "b", Value: "x"}},
+			} {
+				hash, err := documentHash(other)
+				So(err, ShouldBeNil)
+				So(hash, ShouldNotEqual, a)
+			}
+		})
+	})
+}
+
+func TestDeduperStream(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a deduper that has already recorded one document", t, func() {
+		recorded := map[string]bool{}
+		seen, err := documentHash(bson.D{{Key: "n", Value: int32(0)}})
+		So(err, ShouldBeNil)
+		recorded[seen] = true
+
+		var batches int
+		d := &deduper{
+			batchSize: 2,
+			claim: func(hashes []string) ([]bool, error) {
+				batches++
+				claimed := make([]bool, len(hashes))
+				for i, hash := range hashes {
+					claimed[i] = !recorded[hash]
+					recorded[hash] = true
+				}
+				return claimed, nil
+			},
+		}
+
+		Convey("it should pass on only the documents not seen before", func() {
+			in := make(chan bson.D, 5)
+			for _, n := range []int32{0, 1, 1, 2, 0} {
+				in <- bson.D{{Key: "n", Value: n}}
+			}
+			close(in)
+			out := make(chan bson.D, 5)
+			So(d.stream(in, out, make(chan struct{})), ShouldBeNil)
+
+			var passed []int32
+			for document := range out {
+				passed = append(passed, document[0].Value.(int32))
+			}
+			So(passed, ShouldResemble, []int32{1, 2})
+			So(d.skipped, ShouldEqual, 3)
+			So(batches, ShouldEqual, 3)
+		})
+	})
+}
+
+func TestDeduperRelease(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a deduper that has claimed four documents", t, func() {
+		var unclaimed []string
+		d := &deduper{
+			batchSize: 2,
+			claim: func(hashes []string) ([]bool, error) {
+				claimed := make([]bool, len(hashes))
+				for i := range claimed {
+					claimed[i] = true
+				}
+				return claimed, nil
+			},
+			unclaim: func(hashes []string) error {
+				unclaimed = append(unclaimed, hashes...)
+				return nil
+			},
+		}
+		in := make(chan bson.D, 4)
+		var documents []bson.D
+		var hashes []string
+		for n := int32(0); n < 4; n++ {
+			document := bson.D{{Key: "n", Value: n}}
+			hash, err := documentHash(document)
+			So(err, ShouldBeNil)
+			documents = append(documents, document)
+			hashes = append(hashes, hash)
+			in <- document
+		}
+		close(in)
+		So(d.stream(in, make(chan bson.D, 4), make(chan struct{})), ShouldBeNil)
+
+		buffer := func(tracker *claimTracker, documents ...bson.D) {
+			for _, document := range documents {
+				So(tracker.buffer(document), ShouldBeNil)
+			}
+		}
+		writeErrors := mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{
+			{WriteError: mongo.WriteError{Index: 1, Code: 121}},
+		}}
+
+		Convey("the claims of documents written are kept and the rest removed", func() {
+			tracker := &claimTracker{deduper: d}
+			buffer(tracker, documents[0], documents[1], documents[2])
+			tracker.flushed(nil, writeErrors)
+			So(tracker.hashes, ShouldBeEmpty)
+
+			So(d.release(), ShouldBeNil)
+			sort.Strings(unclaimed)
+			expected := []string{hashes[1], hashes[3]}
+			sort.Strings(expected)
+			So(unclaimed, ShouldResemble, expected)
+		})
+
+		Convey("an ordered write keeps no claims after its first error", func() {
+			tracker := &claimTracker{deduper: d, ordered: true}
+			buffer(tracker, documents[0], documents[1], documents[2], documents[3])
+			tracker.flushed(nil, writeErrors)
+
+			So(d.release(), ShouldBeNil)
+			So(unclaimed, ShouldHaveLength, 3)
+		})
+
+		Convey("a batch that failed entirely keeps no claims", func() {
+			tracker := &claimTracker{deduper: d}
+			buffer(tracker, documents...)
+			tracker.flushed(nil, fmt.Errorf("connection reset"))
+
+			So(d.release(), ShouldBeNil)
+			So(unclaimed, ShouldHaveLength, 4)
+		})
+
+		Convey("a skipped document is not counted in the batch", func() {
+			tracker := &claimTracker{deduper: d}
+			buffer(tracker, documents[0], documents[1])
+			tracker.sync(1)
+			buffer(tracker, documents[2])
+			tracker.flushed(nil, nil)
+
+			So(d.release(), ShouldBeNil)
+			sort.Strings(unclaimed)
+			expected := []string{hashes[1], hashes[3]}
+			sort.Strings(expected)
+			So(unclaimed, ShouldResemble, expected)
+		})
+	})
+}
@@ -0,0 +1,137 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Strategies accepted by --idStrategy.
+const (
+	idStrategyObjectID  = "objectid"
+	idStrategyUUID      = "uuid"
+	idStrategyHash      = "hash"
+	idStrategyFromField = "fromField"
+)
+
+// idStrategy assigns the _id of each imported document in place of the _id,
+// if any, read from the input source.
+type idStrategy struct {
+	kind string
+	// fields whose values the _id is computed from, for hash and fromField
+	fields []string
+}
+
+// parseIDStrategy parses an --idStrategy argument of the form
+// objectid, uuid, hash:<field>[,<field>]* or fromField:<field>.
+func parseIDStrategy(arg string) (*idStrategy, error) {
+	kind, fieldList := arg, ""
+	if i := strings.Index(arg, ":"); i >= 0 {
+		kind, fieldList = arg[:i], arg[i+1:]
+	}
+
+	switch kind {
+	case idStrategyObjectID, idStrategyUUID:
+		if fieldList != "" {
+			return nil, fmt.Errorf("'%v' does not take a list of fields", kind)
+		}
+		return &idStrategy{kind: kind}, nil
+	case idStrategyHash, idStrategyFromField:
+		if fieldList == "" {
+			return nil, fmt.Errorf("'%v' must be followed by ':<field>'", kind)
+		}
+		fields := strings.Split(fieldList, ",")
+		if kind == idStrategyFromField && len(fields) != 1 {
+			return nil, fmt.Errorf("'%v' takes exactly one field", kind)
+		}
+		if err := validateFields(fields, false); err != nil {
+			return nil, err
+		}
+		for _, field := range fields {
+			if field == "_id" || strings.HasPrefix(field, "_id.") {
+				return nil, fmt.Errorf("'%v' cannot use the _id field", kind)
+			}
+		}
+		return &idStrategy{kind: kind, fields: fields}, nil
+	}
+	return nil, fmt.Errorf("unknown strategy '%v', must be one of: %v, %v, %v:<fields>, %v:<field>",
+		kind, idStrategyObjectID, idStrategyUUID, idStrategyHash, idStrategyFromField)
+}
+
+// random returns whether the strategy assigns a new _id to each document
+// regardless of its contents.
+func (s *idStrategy) random() bool {
+	return s.kind == idStrategyObjectID || s.kind == idStrategyUUID
+}
+
+// assign returns a copy of document with its _id, as the first field, set
+// according to the strategy. It returns an error if a field the _id is
+// computed from is missing from the document.
+func (s *idStrategy) assign(document bson.D) (bson.D, error) {
+	id, err := s.newID(document)
+	if err != nil {
+		return nil, err
+	}
+	out := make(bson.D, 0, len(document)+1)
+	out = append(out, bson.E{Key: "_id", Value: id})
+	for _, elem := range document {
+		if elem.Key != "_id" {
+			out = append(out, elem)
+		}
+	}
+	return out, nil
+}
+
+func (s *idStrategy) newID(document bson.D) (interface{}, error) {
+	switch s.kind {
+	case idStrategyObjectID:
+		return primitive.NewObjectID(), nil
+	case idStrategyUUID:
+		return newUUID()
+	case idStrategyFromField:
+		value := getUpsertValue(s.fields[0], document)
+		if value == nil {
+			return nil, fmt.Errorf("document has no '%v' field to use as its _id", s.fields[0])
+		}
+		return value, nil
+	}
+
+	// The hash covers the field names as well as their values, so documents
+	// only share an _id if all of the natural key fields are equal.
+	key := make(bson.D, 0, len(s.fields))
+	for _, field := range s.fields {
+		value := getUpsertValue(field, document)
+		if value == nil {
+			return nil, fmt.Errorf("document has no '%v' field to compute its _id from", field)
+		}
+		key = append(key, bson.E{Key: field, Value: value})
+	}
+	raw, err := bson.Marshal(key)
+	if err != nil {
+		return nil, fmt.Errorf("error hashing fields %v: %v", s.fields, err)
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// newUUID returns a random (version 4) UUID as BSON binary subtype 4.
+func newUUID() (primitive.Binary, error) {
+	data := make([]byte, 16)
+	if _, err := rand.Read(data); err != nil {
+		return primitive.Binary{}, fmt.Errorf("error generating UUID: %v", err)
+	}
+	data[6] = data[6]&0x0f | 0x40
+	data[8] = data[8]&0x3f | 0x80
+	return primitive.Binary{Subtype: 0x04, Data: data}, nil
+}
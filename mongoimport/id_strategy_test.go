@@ -0,0 +1,106 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseIDStrategy(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Valid strategies should be parsed", t, func() {
+		s, err := parseIDStrategy("objectid")
+		So(err, ShouldBeNil)
+		So(s.kind, ShouldEqual, idStrategyObjectID)
+		So(s.random(), ShouldBeTrue)
+
+		s, err = parseIDStrategy("hash:name,address.zip")
+		So(err, ShouldBeNil)
+		So(s.kind, ShouldEqual, idStrategyHash)
+		So(s.fields, ShouldResemble, []string{"name", "address.zip"})
+		So(s.random(), ShouldBeFalse)
+
+		s, err = parseIDStrategy("fromField:sku")
+		So(err, ShouldBeNil)
+		So(s.fields, ShouldResemble, []string{"sku"})
+	})
+
+	Convey("Invalid strategies should be rejected", t, func() {
+		for _, arg := range []string{
+			"", "random", "uuid:a", "hash", "hash:", "hash:a,a", "hash:_id",
+			"fromField:a,b", "fromField:$a",
+		} {
+			_, err := parseIDStrategy(arg)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestIDStrategyAssign(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	document := bson.D{
+		{Key: "name", Value: "a"},
+		{Key: "_id", Value: int32(1)},
+		{Key: "address", Value: bson.D{{Key: "zip", Value: "12345"}}},
+	}
+
+	Convey("The assigned _id should replace the existing one as the first field", t, func() {
+		s, _ := parseIDStrategy("objectid")
+		out, err := s.assign(document)
+		So(err, ShouldBeNil)
+		So(len(out), ShouldEqual, 3)
+		So(out[0].Key, ShouldEqual, "_id")
+		So(out[0].Value, ShouldHaveSameTypeAs, primitive.ObjectID{})
+		So(out[1:], ShouldResemble, bson.D{document[0], document[2]})
+
+		s, _ = parseIDStrategy("uuid")
+		out, err = s.assign(document)
+		So(err, ShouldBeNil)
+		uuid := out[0].Value.(primitive.Binary)
+		So(uuid.Subtype, ShouldEqual, 0x04)
+		So(len(uuid.Data), ShouldEqual, 16)
+		So(uuid.Data[6]>>4, ShouldEqual, 4)
+	})
+
+	Convey("Hashed _ids should depend only on the given fields", t, func() {
+		s, _ := parseIDStrategy("hash:name,address.zip")
+		first, err := s.assign(document)
+		So(err, ShouldBeNil)
+		second, err := s.assign(append(bson.D{{Key: "extra", Value: true}}, document...))
+		So(err, ShouldBeNil)
+		So(first[0].Value, ShouldEqual, second[0].Value)
+		So(len(first[0].Value.(string)), ShouldEqual, 64)
+
+		other, err := s.assign(bson.D{
+			{Key: "name", Value: "b"},
+			{Key: "address", Value: bson.D{{Key: "zip", Value: "12345"}}},
+		})
+		So(err, ShouldBeNil)
+		So(other[0].Value, ShouldNotEqual, first[0].Value)
+
+		_, err = s.assign(bson.D{{Key: "name", Value: "a"}})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("fromField should copy the value of the given field", t, func() {
+		s, _ := parseIDStrategy("fromField:address.zip")
+		out, err := s.assign(document)
+		So(err, ShouldBeNil)
+		So(out[0], ShouldResemble, bson.E{Key: "_id", Value: "12345"})
+		So(out[1:], ShouldResemble, bson.D{document[0], document[2]})
+
+		_, err = s.assign(bson.D{{Key: "name", Value: "a"}})
+		So(err, ShouldNotBeNil)
+	})
+}
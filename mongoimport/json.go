@@ -7,6 +7,8 @@
 package mongoimport
 
 import (
+	"bytes"
+	stdjson "encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -15,6 +17,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/bsonutil"
 	"github.com/mongodb/mongo-tools/common/json"
 	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/text"
 	"go.mongodb.org/mongo-driver/bson"
 )
 
@@ -57,13 +60,17 @@ type JSONInputReader struct {
 
 	// legacyExtJSON specifies whether or not the legacy extended JSON format should be used.
 	legacyExtJSON bool
+
+	// canonicalExtJSON specifies whether documents must be in canonical extended JSON.
+	canonicalExtJSON bool
 }
 
 // JSONConverter implements the Converter interface for JSON input.
 type JSONConverter struct {
-	data          []byte
-	index         uint64
-	legacyExtJSON bool
+	data             []byte
+	index            uint64
+	legacyExtJSON    bool
+	canonicalExtJSON bool
 }
 
 var (
@@ -131,6 +138,11 @@ func (r *JSONInputReader) StreamDocument(ordered bool, readChan chan bson.D) (re
 				close(rawChan)
 				if err == io.EOF {
 					jsonErrChan <- nil
+				} else if err == json.ErrValueTooLarge {
+					r.numProcessed++
+					jsonErrChan <- fmt.Errorf("error processing document #%v: it is larger than the --maxParseBuffer "+
+						"of %v; raise --maxParseBuffer, or use --jsonArray if the input is a JSON array",
+						r.numProcessed, text.FormatByteAmount(int64(r.decoder.MaxBuffer)))
 				} else {
 					r.numProcessed++
 					jsonErrChan <- fmt.Errorf("error processing document #%v: %v", r.numProcessed, err)
@@ -138,9 +150,10 @@ func (r *JSONInputReader) StreamDocument(ordered bool, readChan chan bson.D) (re
 				return
 			}
 			rawChan <- JSONConverter{
-				data:          rawBytes,
-				index:         r.numProcessed,
-				legacyExtJSON: r.legacyExtJSON,
+				data:             rawBytes,
+				index:            r.numProcessed,
+				legacyExtJSON:    r.legacyExtJSON,
+				canonicalExtJSON: r.canonicalExtJSON,
 			}
 			r.numProcessed++
 		}
@@ -161,8 +174,14 @@ func (c JSONConverter) Convert() (bson.D, error) {
 		return c.convertLegacyExtJSON()
 	}
 
+	if c.canonicalExtJSON {
+		if err := checkCanonicalExtJSON(c.data); err != nil {
+			return nil, fmt.Errorf("document #%v is not canonical extended JSON: %v", c.index, err)
+		}
+	}
+
 	var doc bson.D
-	if err := bson.UnmarshalExtJSON(c.data, false, &doc); err != nil {
+	if err := bson.UnmarshalExtJSON(c.data, c.canonicalExtJSON, &doc); err != nil {
 		return nil, err
 	}
 
@@ -253,12 +272,77 @@ func (r *JSONInputReader) readJSONArraySeparator() error {
 				"JSON object/array in input source", string(readByte))
 		}
 	}
-	// adjust the buffer to account for read bytes
+	// adjust the buffer to account for read bytes, sliding the rest down so
+	// that the buffer is reused rather than reallocated for every document
 	if scanp < len(r.decoder.Buf) {
-		r.decoder.Buf = r.decoder.Buf[scanp:]
+		rest := copy(r.decoder.Buf, r.decoder.Buf[scanp:])
+		r.decoder.Buf = r.decoder.Buf[:rest]
 	} else {
-		r.decoder.Buf = []byte{}
+		r.decoder.Buf = r.decoder.Buf[:0]
 	}
 	r.readOpeningBracket = true
 	return nil
 }
+
+// checkCanonicalExtJSON returns an error if data holds a bare JSON number
+// outside of a $timestamp. Canonical extended JSON wraps every number in
+// $numberInt, $numberLong or $numberDouble, whereas the BSON type a bare
+// number decodes to depends on how it is written, so a long may be read back
+// as a double.
+func checkCanonicalExtJSON(data []byte) error {
+	dec := stdjson.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return checkCanonicalValue(dec, "")
+}
+
+// checkCanonicalValue checks the next value from dec, whose dotted field
+// path is path.
+func checkCanonicalValue(dec *stdjson.Decoder, path string) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch t := token.(type) {
+	case stdjson.Number:
+		return fmt.Errorf("field '%v' holds the bare number %v; use $numberInt, $numberLong or $numberDouble", path, t)
+	case stdjson.Delim:
+		switch t {
+		case '{':
+			for dec.More() {
+				token, err = dec.Token()
+				if err != nil {
+					return err
+				}
+				key, _ := token.(string)
+				if key == "$timestamp" {
+					// the only canonical type wrapper holding bare numbers
+					var timestamp stdjson.RawMessage
+					if err = dec.Decode(&timestamp); err != nil {
+						return err
+					}
+					continue
+				}
+				if err = checkCanonicalValue(dec, joinFieldPath(path, key)); err != nil {
+					return err
+				}
+			}
+		case '[':
+			for i := 0; dec.More(); i++ {
+				if err = checkCanonicalValue(dec, joinFieldPath(path, fmt.Sprint(i))); err != nil {
+					return err
+				}
+			}
+		}
+		// consume the closing delimiter
+		_, err = dec.Token()
+		return err
+	}
+	return nil
+}
+
+func joinFieldPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
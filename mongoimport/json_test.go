@@ -8,9 +8,11 @@ package mongoimport
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/mongodb/mongo-tools/common/testtype"
@@ -78,6 +80,24 @@ func TestJSONArrayStreamDocument(t *testing.T) {
 			So(<-docChan, ShouldResemble, expectedReadTwo)
 		})
 
+		Convey("large arrays should be parsed within the maximum parse buffer", func() {
+			var contents bytes.Buffer
+			contents.WriteString("[")
+			for i := 0; i < 1000; i++ {
+				if i > 0 {
+					contents.WriteString(",\n")
+				}
+				fmt.Fprintf(&contents, `{"i": %v, "s": "%v"}`, i, strings.Repeat("x", 100))
+			}
+			contents.WriteString("]")
+			r := NewJSONInputReader(true, false, &contents, 1)
+			r.decoder.MaxBuffer = 1024
+			docChan := make(chan bson.D, 1000)
+			So(r.StreamDocument(true, docChan), ShouldBeNil)
+			So(len(docChan), ShouldEqual, 1000)
+			So(cap(r.decoder.Buf), ShouldBeLessThanOrEqualTo, 1024)
+		})
+
 		Reset(func() {
 			jsonFile.Close()
 			fileHandle.Close()
@@ -85,6 +105,19 @@ func TestJSONArrayStreamDocument(t *testing.T) {
 	})
 }
 
+func TestJSONMaxParseBuffer(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+	Convey("A document larger than the maximum parse buffer should error out", t, func() {
+		contents := `[{"a": 1}, {"b": 2}]`
+		r := NewJSONInputReader(false, false, strings.NewReader(contents), 1)
+		r.decoder.MaxBuffer = 8
+		err := r.StreamDocument(true, make(chan bson.D, 1))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "--maxParseBuffer")
+		So(err.Error(), ShouldContainSubstring, "--jsonArray")
+	})
+}
+
 func TestJSONPlainStreamDocument(t *testing.T) {
 	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
 	Convey("With a plain JSON input reader", t, func() {
@@ -303,3 +336,33 @@ func TestJSONConvert(t *testing.T) {
 		})
 	}
 }
+
+func TestJSONConvertCanonical(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a converter that requires canonical extended JSON", t, func() {
+		convert := func(data string) (bson.D, error) {
+			return JSONConverter{data: []byte(data), canonicalExtJSON: true}.Convert()
+		}
+
+		Convey("wrapped numbers should keep their types", func() {
+			doc, err := convert(`{"a": {"$numberLong": "1"}, "b": [{"$numberDouble": "1.0"}], ` +
+				`"ts": {"$timestamp": {"t": 1, "i": 2}}}`)
+			So(err, ShouldBeNil)
+			So(doc[0].Value, ShouldEqual, int64(1))
+			So(doc[1].Value, ShouldResemble, bson.A{1.0})
+			So(doc[2].Value, ShouldResemble, primitive.Timestamp{T: 1, I: 2})
+		})
+
+		Convey("bare numbers should be rejected", func() {
+			_, err := convert(`{"a": {"b": [1, 2.5]}}`)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "a.b.0")
+		})
+
+		Convey("relaxed dates should be rejected", func() {
+			_, err := convert(`{"d": {"$date": "2020-01-01T00:00:00Z"}}`)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
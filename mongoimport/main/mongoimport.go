@@ -10,7 +10,11 @@ package main
 import (
 	"os"
 
+	"github.com/mongodb/mongo-tools/common/completion"
+	"github.com/mongodb/mongo-tools/common/exitcode"
+	"github.com/mongodb/mongo-tools/common/healthcheck"
 	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/runmanifest"
 	"github.com/mongodb/mongo-tools/common/signals"
 	"github.com/mongodb/mongo-tools/common/util"
 	"github.com/mongodb/mongo-tools/mongoimport"
@@ -26,7 +30,7 @@ func main() {
 	if err != nil {
 		log.Logvf(log.Always, "error parsing command line options: %v", err)
 		log.Logvf(log.Always, util.ShortUsage("mongoimport"))
-		os.Exit(util.ExitFailure)
+		os.Exit(util.ExitValidationFailure)
 	}
 
 	signals.Handle()
@@ -41,14 +45,47 @@ func main() {
 		return
 	}
 
+	// print the effective config, if specified
+	if opts.PrintEffectiveConfig() {
+		return
+	}
+
+	// generate shell completions, if requested
+	if _, ok := opts.CompletionArgs(); ok {
+		os.Exit(completion.Main(opts.ToolOptions))
+	}
+
+	// check the connection, credentials and privileges without running
+	if opts.HealthCheck {
+		os.Exit(healthcheck.Main(*opts.ToolOptions, opts.HealthCheckRequirements()))
+	}
+
+	run, err := runmanifest.Begin(opts.RunManifest, "mongoimport", util.SanitizeURI(opts.URI.ConnectionString), map[string]interface{}{
+		"namespace": opts.Namespace,
+		"input":     opts.InputOptions,
+		"ingest":    opts.IngestOptions,
+	})
+	if err == runmanifest.ErrAlreadyApplied {
+		log.Logvf(log.Always, "%v", err)
+		return
+	}
+	if err != nil {
+		log.Logvf(log.Always, "Failed: %v", err)
+		os.Exit(util.ExitFailure)
+	}
+
 	m, err := mongoimport.New(opts)
 	if err != nil {
 		log.Logvf(log.Always, err.Error())
-		os.Exit(util.ExitFailure)
+		run.Abandon()
+		os.Exit(exitcode.Of(err))
 	}
 	defer m.Close()
 
 	numDocs, numFailure, err := m.ImportDocuments()
+	if finishErr := run.Finish(err); finishErr != nil {
+		log.Logvf(log.Always, "error recording run: %v", finishErr)
+	}
 	if !opts.Quiet {
 		if err != nil {
 			log.Logvf(log.Always, "Failed: %v", err)
@@ -62,8 +99,18 @@ func main() {
 		} else {
 			log.Logvf(log.Always, "done")
 		}
+		if skipped := m.SkippedCount(); skipped > 0 {
+			log.Logvf(log.Always, "%v document(s) skipped as already imported.", skipped)
+		}
+		if retries := m.RetryCount(); retries > 0 {
+			log.Logvf(log.Always, "%v retry attempt(s) after transient errors.", retries)
+		}
 	}
 	if err != nil {
-		os.Exit(util.ExitFailure)
+		// documents imported before the error are not rolled back
+		if numDocs > 0 {
+			err = exitcode.Partial(err)
+		}
+		os.Exit(exitcode.Of(err))
 	}
 }
@@ -9,14 +9,17 @@ package mongoimport
 
 import (
 	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/exitcode"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/text"
 	"github.com/mongodb/mongo-tools/common/util"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"gopkg.in/tomb.v2"
 
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -31,6 +34,11 @@ const (
 	CSV  = "csv"
 	TSV  = "tsv"
 	JSON = "json"
+	// ChangeStream is JSON input of change stream events, which are applied
+	// to the collection rather than imported as documents.
+	ChangeStream = "changestream"
+	// SQLInsert is the INSERT statements of a SQL dump.
+	SQLInsert = "sqlinsert"
 )
 
 // Modes accepted by mongoimport.
@@ -41,6 +49,9 @@ const (
 	modeDelete = "delete"
 )
 
+// jsonFormatCanonical is the --jsonFormat that requires strictly typed input.
+const jsonFormatCanonical = "canonical"
+
 const (
 	workerBufferSize  = 16
 	progressBarLength = 24
@@ -58,6 +69,10 @@ type MongoImport struct {
 	// Should be updated atomically.
 	failureCount uint64
 
+	// retryCount keeps track of how many times batches were retried after
+	// transient errors, counting each attempt. Should be updated atomically.
+	retryCount uint64
+
 	// generic mongo tool options
 	ToolOptions *options.ToolOptions
 
@@ -77,8 +92,34 @@ type MongoImport struct {
 	// fields to use for upsert operations
 	upsertFields []string
 
+	// how to assign the _id of each document, if set by --idStrategy
+	idStrategy *idStrategy
+
+	// folds fields into arrays, if set by --arrayFields
+	reshaper *rowReshaper
+
+	// skips documents already imported, if set by --dedupeBy
+	deduper *deduper
+
+	// paces and pauses the import, if set by --rateLimit or --pauseWindow
+	throttle *throttle
+
+	// number of documents in the target collection before the import, for
+	// --validateAfter
+	countBefore int64
+
+	// records how far into the input the import has written, if set by
+	// --stateFile
+	progress *importProgress
+
 	// type of node the SessionProvider is connected to
 	nodeType db.NodeType
+
+	// most bytes buffered while parsing JSON, set with --maxParseBuffer
+	maxParseBuffer int64
+
+	// column types of a SQL dump, set with --sqlTypeMap
+	sqlTypeMap map[string]ColumnSpec
 }
 
 type InputReader interface {
@@ -110,12 +151,12 @@ func New(opts Options) (*MongoImport, error) {
 		IngestOptions: opts.IngestOptions,
 	}
 	if err := mi.validateSettings(opts.ParsedArgs); err != nil {
-		return nil, fmt.Errorf("error validating settings: %v", err)
+		return nil, exitcode.Validation(fmt.Errorf("error validating settings: %v", err))
 	}
 
 	sessionProvider, err := db.NewSessionProvider(*opts.ToolOptions)
 	if err != nil {
-		return nil, fmt.Errorf("error connecting to host: %v", err)
+		return nil, fmt.Errorf("error connecting to host: %w", err)
 	}
 
 	mi.SessionProvider = sessionProvider
@@ -146,7 +187,9 @@ func (imp *MongoImport) validateSettings(args []string) error {
 	} else {
 		if !(imp.InputOptions.Type == TSV ||
 			imp.InputOptions.Type == JSON ||
-			imp.InputOptions.Type == CSV) {
+			imp.InputOptions.Type == CSV ||
+			imp.InputOptions.Type == ChangeStream ||
+			imp.InputOptions.Type == SQLInsert) {
 			return fmt.Errorf("unknown type %v", imp.InputOptions.Type)
 		}
 	}
@@ -182,6 +225,13 @@ func (imp *MongoImport) validateSettings(args []string) error {
 		if imp.InputOptions.Legacy {
 			return fmt.Errorf("cannot use --legacy if input type is not JSON")
 		}
+		if imp.InputOptions.JSONFormat != "" {
+			return fmt.Errorf("cannot use --jsonFormat if input type is not JSON")
+		}
+	} else if imp.InputOptions.Type == SQLInsert {
+		if err = imp.validateSQLSettings(); err != nil {
+			return err
+		}
 	} else {
 		// input type is JSON
 		if imp.InputOptions.HeaderLine {
@@ -199,6 +249,26 @@ func (imp *MongoImport) validateSettings(args []string) error {
 		if imp.InputOptions.ColumnsHaveTypes {
 			return fmt.Errorf("can not use --columnsHaveTypes when input type is JSON")
 		}
+		if imp.InputOptions.Legacy && imp.InputOptions.JSONFormat != "" {
+			return fmt.Errorf("incompatible options: --legacy and --jsonFormat")
+		}
+		if imp.InputOptions.MaxParseBuffer != "" {
+			maxParseBuffer, err := text.ParseByteAmount(imp.InputOptions.MaxParseBuffer)
+			if err != nil {
+				return fmt.Errorf("invalid --maxParseBuffer: %v", err)
+			}
+			imp.maxParseBuffer = maxParseBuffer
+		}
+	}
+
+	if imp.InputOptions.Type == ChangeStream {
+		if err = imp.validateChangeStreamSettings(); err != nil {
+			return err
+		}
+	}
+	if imp.InputOptions.Type != SQLInsert &&
+		(imp.InputOptions.SQLTable != "" || imp.InputOptions.SQLTypeMap != "" || imp.InputOptions.SQLDialect != "") {
+		return fmt.Errorf("--sqlTable, --sqlTypeMap and --sqlDialect can only be used with --type=%v", SQLInsert)
 	}
 
 	// deprecated
@@ -234,6 +304,10 @@ func (imp *MongoImport) validateSettings(args []string) error {
 		return fmt.Errorf("invalid --mode argument: %v", imp.IngestOptions.Mode)
 	}
 
+	if err = imp.validateResumeSettings(); err != nil {
+		return err
+	}
+
 	if imp.IngestOptions.Mode != modeInsert {
 		imp.IngestOptions.MaintainInsertionOrder = true
 		log.Logvf(log.Info, "using upsert fields: %v", imp.upsertFields)
@@ -242,6 +316,10 @@ func (imp *MongoImport) validateSettings(args []string) error {
 	if imp.IngestOptions.MaintainInsertionOrder {
 		imp.IngestOptions.StopOnError = true
 		imp.IngestOptions.NumInsertionWorkers = 1
+		// progress is tracked through a single decoder, in input order
+		if imp.IngestOptions.StateFile != "" {
+			imp.IngestOptions.NumDecodingWorkers = 1
+		}
 	} else {
 		// set the number of decoding workers to use for imports
 		if imp.IngestOptions.NumDecodingWorkers <= 0 {
@@ -260,6 +338,62 @@ func (imp *MongoImport) validateSettings(args []string) error {
 		imp.IngestOptions.BulkBufferSize = 1000
 	}
 
+	if imp.IngestOptions.Staged {
+		if imp.IngestOptions.Mode != modeInsert {
+			return fmt.Errorf("--staged can only be used with --mode=%v", modeInsert)
+		}
+		if imp.IngestOptions.Drop {
+			return fmt.Errorf("incompatible options: --drop and --staged; use --dropTarget to replace the collection")
+		}
+	} else if imp.IngestOptions.DropTarget {
+		return fmt.Errorf("--dropTarget can only be used with --staged")
+	}
+
+	if imp.IngestOptions.DedupeBy != "" {
+		if imp.IngestOptions.DedupeBy != dedupeByHash {
+			return fmt.Errorf("invalid --dedupeBy argument: %v", imp.IngestOptions.DedupeBy)
+		}
+		if imp.IngestOptions.Mode != modeInsert {
+			return fmt.Errorf("--dedupeBy can only be used with --mode=%v", modeInsert)
+		}
+		if imp.IngestOptions.Staged {
+			return fmt.Errorf("incompatible options: --dedupeBy and --staged")
+		}
+	}
+
+	if imp.IngestOptions.IDStrategy != "" {
+		if imp.idStrategy, err = parseIDStrategy(imp.IngestOptions.IDStrategy); err != nil {
+			return fmt.Errorf("invalid --idStrategy argument: %v", err)
+		}
+		if imp.idStrategy.random() && imp.IngestOptions.Mode == modeDelete {
+			return fmt.Errorf("--idStrategy=%v cannot be used with --mode=%v", imp.idStrategy.kind, modeDelete)
+		}
+	}
+
+	if len(imp.InputOptions.ArrayFields) > 0 || imp.InputOptions.GroupRowsBy != "" {
+		if imp.InputOptions.Type == JSON || imp.InputOptions.Type == ChangeStream {
+			return fmt.Errorf("can not use --arrayFields or --groupRowsBy when input type is %v", imp.InputOptions.Type)
+		}
+		if imp.reshaper, err = newRowReshaper(imp.InputOptions.ArrayFields, imp.InputOptions.GroupRowsBy); err != nil {
+			return err
+		}
+	}
+
+	if imp.IngestOptions.MaxRetries < 0 {
+		return fmt.Errorf("--maxRetries must not be negative")
+	}
+	if imp.IngestOptions.RetryBackoff < 0 {
+		return fmt.Errorf("--retryBackoff must not be negative")
+	}
+
+	if imp.throttle, err = newThrottle(imp.IngestOptions.RateLimit, imp.IngestOptions.PauseWindows); err != nil {
+		return err
+	}
+
+	if err = imp.validateVerifySettings(); err != nil {
+		return err
+	}
+
 	// ensure we have a valid string to use for the collection
 	if imp.ToolOptions.Collection == "" {
 		log.Logvf(log.Always, "no collection specified")
@@ -275,6 +409,11 @@ func (imp *MongoImport) validateSettings(args []string) error {
 	if err != nil {
 		return fmt.Errorf("invalid collection name: %v", err)
 	}
+	if imp.IngestOptions.Staged {
+		if err = util.ValidateCollectionName(imp.importCollection()); err != nil {
+			return fmt.Errorf("invalid staging collection name: %v", err)
+		}
+	}
 	return nil
 }
 
@@ -327,15 +466,16 @@ func (imp *MongoImport) ImportDocuments() (uint64, uint64, error) {
 		return 0, 0, err
 	}
 
-	if imp.InputOptions.HeaderLine {
-		if imp.InputOptions.ColumnsHaveTypes {
-			err = inputReader.ReadAndValidateTypedHeader(ParsePG(imp.InputOptions.ParseGrace))
-		} else {
-			err = inputReader.ReadAndValidateHeader()
-		}
-		if err != nil {
+	if err = imp.readHeader(inputReader); err != nil {
+		return 0, 0, err
+	}
+
+	if imp.IngestOptions.StateFile != "" {
+		if inputReader, err = imp.trackProgress(source, inputReader); err != nil {
 			return 0, 0, err
 		}
+		// a resumed import reads only the rest of the file
+		fileSize -= imp.progress.base
 	}
 
 	bar := &progress.Bar{
@@ -346,8 +486,26 @@ func (imp *MongoImport) ImportDocuments() (uint64, uint64, error) {
 		IsBytes:   true,
 	}
 	bar.Start()
-	defer bar.Stop()
-	return imp.importDocuments(inputReader)
+	processedCount, failureCount, err := imp.importDocuments(inputReader)
+	bar.Stop()
+	if err == nil && imp.progress != nil {
+		err = imp.progress.complete()
+	}
+	if err == nil && imp.IngestOptions.ValidateAfter != "" {
+		err = imp.verifyImport(processedCount, failureCount)
+	}
+	return processedCount, failureCount, err
+}
+
+// readHeader reads the header line of inputReader, if --headerline is set.
+func (imp *MongoImport) readHeader(inputReader InputReader) error {
+	if !imp.InputOptions.HeaderLine {
+		return nil
+	}
+	if imp.InputOptions.ColumnsHaveTypes {
+		return inputReader.ReadAndValidateTypedHeader(ParsePG(imp.InputOptions.ParseGrace))
+	}
+	return inputReader.ReadAndValidateHeader()
 }
 
 // importDocuments is a helper to ImportDocuments and does all the ingestion
@@ -384,23 +542,111 @@ func (imp *MongoImport) importDocuments(inputReader InputReader) (uint64, uint64
 		if err := collection.Drop(nil); err != nil {
 			return 0, 0, err
 		}
+		if imp.IngestOptions.DedupeBy != "" {
+			hashes := session.Database(imp.ToolOptions.DB).Collection(imp.hashesCollection())
+			if err := hashes.Drop(nil); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+
+	// a staged import replaces the target, so it starts out empty
+	if imp.IngestOptions.ValidateAfter != "" && !imp.IngestOptions.Staged {
+		collection := session.Database(imp.ToolOptions.DB).Collection(imp.ToolOptions.Collection)
+		if imp.countBefore, err = collection.CountDocuments(context.Background(), bson.D{}); err != nil {
+			return 0, 0, fmt.Errorf("error counting documents for --validateAfter: %v", err)
+		}
+	}
+
+	var targetExists bool
+	if imp.IngestOptions.Staged {
+		if targetExists, err = imp.prepareStagedImport(session); err != nil {
+			return 0, 0, err
+		}
 	}
 
 	readDocs := make(chan bson.D, workerBufferSize)
 	processingErrChan := make(chan error)
 	ordered := imp.IngestOptions.MaintainInsertionOrder
+	quorum := 2
 
 	// read and process from the input reader
-	go func() {
-		processingErrChan <- inputReader.StreamDocument(ordered, readDocs)
-	}()
+	if imp.reshaper != nil {
+		// rows must be read in order to be grouped
+		rows := make(chan bson.D, workerBufferSize)
+		go func() {
+			processingErrChan <- inputReader.StreamDocument(ordered || imp.reshaper.grouping(), rows)
+		}()
+		go func() {
+			processingErrChan <- imp.reshaper.stream(rows, readDocs, imp.Dying())
+		}()
+		quorum++
+	} else {
+		go func() {
+			processingErrChan <- inputReader.StreamDocument(ordered, readDocs)
+		}()
+	}
+
+	// skip documents already imported
+	ingestDocs := readDocs
+	// done once the deduper and the insertion workers have finished with the
+	// claimed hashes
+	var deduping sync.WaitGroup
+	if imp.IngestOptions.DedupeBy != "" {
+		hashes := session.Database(imp.ToolOptions.DB).Collection(imp.hashesCollection())
+		imp.deduper = newHashDeduper(hashes, imp.IngestOptions.BulkBufferSize)
+		ingestDocs = make(chan bson.D, workerBufferSize)
+		deduping.Add(2)
+		go func() {
+			err := imp.deduper.stream(readDocs, ingestDocs, imp.Dying())
+			deduping.Done()
+			processingErrChan <- err
+		}()
+		quorum++
+	}
+
+	// keep to the rate limit and pause windows
+	if imp.throttle != nil {
+		throttledDocs := make(chan bson.D, workerBufferSize)
+		go func(in chan bson.D) {
+			processingErrChan <- imp.throttle.stream(in, throttledDocs, imp.Dying())
+		}(ingestDocs)
+		ingestDocs = throttledDocs
+		quorum++
+	}
 
 	// insert documents into the target database
 	go func() {
-		processingErrChan <- imp.ingestDocuments(readDocs)
+		err := imp.ingestDocuments(ingestDocs)
+		if imp.deduper != nil {
+			deduping.Done()
+		}
+		processingErrChan <- err
 	}()
 
-	e1 := channelQuorumError(processingErrChan, 2)
+	e1 := channelQuorumError(processingErrChan, quorum)
+	if imp.deduper != nil {
+		// stop the other stages if one failed, then remove the hashes of
+		// the documents that were not written
+		if e1 != nil {
+			imp.Kill(e1)
+		}
+		deduping.Wait()
+		if err := imp.deduper.release(); err != nil {
+			log.Logvf(log.Always, "%v; documents that were not imported may be skipped by a later --dedupeBy import", err)
+			if e1 == nil {
+				e1 = err
+			}
+		}
+	}
+	if imp.IngestOptions.Staged {
+		if e1 == nil {
+			e1 = imp.finishStagedImport(session, targetExists)
+		}
+		if e1 != nil {
+			imp.abortStagedImport(session)
+		}
+	}
 	processedCount := atomic.LoadUint64(&imp.processedCount)
 	failureCount := atomic.LoadUint64(&imp.failureCount)
 	return processedCount, failureCount, e1
@@ -447,12 +693,27 @@ func (imp *MongoImport) runInsertionWorker(readDocs chan bson.D) (err error) {
 	if err != nil {
 		return fmt.Errorf("error connecting to mongod: %v", err)
 	}
-	collection := session.Database(imp.ToolOptions.DB).Collection(imp.ToolOptions.Collection)
+	collection := session.Database(imp.ToolOptions.DB).Collection(imp.importCollection())
 
 	inserter := db.NewUnorderedBufferedBulkInserter(collection, imp.IngestOptions.BulkBufferSize).
 		SetBypassDocumentValidation(imp.IngestOptions.BypassDocumentValidation).
 		SetOrdered(imp.IngestOptions.MaintainInsertionOrder).
-		SetUpsert(true)
+		SetUpsert(true).
+		SetRetryPolicy(imp.IngestOptions.MaxRetries, imp.IngestOptions.RetryBackoff)
+	defer func() {
+		atomic.AddUint64(&imp.retryCount, inserter.Retries())
+	}()
+
+	// keeps the claimed hashes of the documents written, for --dedupeBy
+	var claims *claimTracker
+	if imp.deduper != nil {
+		claims = &claimTracker{deduper: imp.deduper, ordered: imp.IngestOptions.MaintainInsertionOrder}
+		inserter.SetFlushHook(claims.flushed)
+	}
+
+	// number of documents received since the last batch was written, for
+	// --stateFile
+	var unwritten int
 
 readLoop:
 	for {
@@ -461,17 +722,47 @@ readLoop:
 			if !alive {
 				break readLoop
 			}
+			if claims != nil {
+				if err := claims.buffer(document); err != nil {
+					return err
+				}
+			}
 			err := imp.importDocument(inserter, document)
+			if claims != nil {
+				claims.sync(inserter.Buffered())
+			}
 			if db.FilterError(imp.IngestOptions.StopOnError, err) != nil {
 				return err
 			}
+			if imp.progress != nil {
+				unwritten++
+				if inserter.Buffered() == 0 {
+					if err = imp.progress.written(unwritten); err != nil {
+						return err
+					}
+					unwritten = 0
+				}
+			}
 		case <-imp.Dying():
 			return nil
 		}
 	}
 	result, err := inserter.Flush()
 	imp.updateCounts(result, err)
-	return db.FilterError(imp.IngestOptions.StopOnError, err)
+	if err = db.FilterError(imp.IngestOptions.StopOnError, err); err != nil {
+		return err
+	}
+	if imp.progress != nil {
+		return imp.progress.written(unwritten)
+	}
+	return nil
+}
+
+// RetryCount returns the number of times batches were retried after
+// transient errors during the import. A batch retried several times is
+// counted for each attempt.
+func (imp *MongoImport) RetryCount() uint64 {
+	return atomic.LoadUint64(&imp.retryCount)
 }
 
 func (imp *MongoImport) updateCounts(result *mongo.BulkWriteResult, err error) {
@@ -487,9 +778,22 @@ func (imp *MongoImport) importDocument(inserter *db.BufferedBulkInserter, docume
 	var result *mongo.BulkWriteResult
 	var err error
 
+	if imp.idStrategy != nil {
+		if document, err = imp.idStrategy.assign(document); err != nil {
+			if imp.IngestOptions.StopOnError {
+				return err
+			}
+			log.Logvf(log.Always, "skipping document: %v", err)
+			atomic.AddUint64(&imp.failureCount, 1)
+			return nil
+		}
+	}
+
 	selector := constructUpsertDocument(imp.upsertFields, document)
 
-	if imp.IngestOptions.Mode == modeInsert {
+	if imp.InputOptions.Type == ChangeStream {
+		result, err = imp.applyChangeEvent(inserter, document)
+	} else if imp.IngestOptions.Mode == modeInsert {
 		result, err = inserter.Insert(document)
 	} else if imp.IngestOptions.Mode == modeUpsert {
 		if selector == nil {
@@ -578,10 +882,17 @@ func (imp *MongoImport) getInputReader(in io.Reader) (InputReader, error) {
 	out := os.Stdout
 
 	ignoreBlanks := imp.IngestOptions.IgnoreBlanks && imp.InputOptions.Type != JSON
+	if imp.InputOptions.Type == SQLInsert {
+		return NewSQLInsertInputReader(headers, imp.sqlTypeMap, imp.sqlTable(), imp.InputOptions.SQLDialect, in,
+			imp.IngestOptions.NumDecodingWorkers, imp.IngestOptions.IgnoreBlanks, imp.InputOptions.UseArrayIndexFields), nil
+	}
 	if imp.InputOptions.Type == CSV {
 		return NewCSVInputReader(colSpecs, in, out, imp.IngestOptions.NumDecodingWorkers, ignoreBlanks, imp.InputOptions.UseArrayIndexFields), nil
 	} else if imp.InputOptions.Type == TSV {
 		return NewTSVInputReader(colSpecs, in, out, imp.IngestOptions.NumDecodingWorkers, ignoreBlanks, imp.InputOptions.UseArrayIndexFields), nil
 	}
-	return NewJSONInputReader(imp.InputOptions.JSONArray, imp.InputOptions.Legacy, in, imp.IngestOptions.NumDecodingWorkers), nil
+	jsonReader := NewJSONInputReader(imp.InputOptions.JSONArray, imp.InputOptions.Legacy, in, imp.IngestOptions.NumDecodingWorkers)
+	jsonReader.canonicalExtJSON = imp.InputOptions.JSONFormat == jsonFormatCanonical
+	jsonReader.decoder.MaxBuffer = int(imp.maxParseBuffer)
+	return jsonReader, nil
 }
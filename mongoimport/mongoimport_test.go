@@ -414,6 +414,108 @@ func TestMongoImportValidateSettings(t *testing.T) {
 			imp.InputOptions.Legacy = true
 			So(imp.validateSettings([]string{}), ShouldNotBeNil)
 		})
+
+		Convey("--staged should only be allowed with insert mode and without --drop", func() {
+			imp := NewMockMongoImport()
+			imp.IngestOptions.Staged = true
+			So(imp.validateSettings([]string{}), ShouldBeNil)
+			So(imp.importCollection(), ShouldEqual, imp.ToolOptions.Collection+stagingSuffix)
+
+			imp = NewMockMongoImport()
+			imp.IngestOptions.Staged = true
+			imp.IngestOptions.Mode = modeUpsert
+			So(imp.validateSettings([]string{}), ShouldNotBeNil)
+
+			imp = NewMockMongoImport()
+			imp.IngestOptions.Staged = true
+			imp.IngestOptions.Drop = true
+			So(imp.validateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("--jsonFormat should only be allowed for JSON input without --legacy", func() {
+			imp := NewMockMongoImport()
+			imp.InputOptions.JSONFormat = jsonFormatCanonical
+			So(imp.validateSettings([]string{}), ShouldBeNil)
+
+			imp.InputOptions.Legacy = true
+			So(imp.validateSettings([]string{}), ShouldNotBeNil)
+
+			imp = NewMockMongoImport()
+			imp.InputOptions.Type = CSV
+			imp.InputOptions.HeaderLine = true
+			imp.InputOptions.JSONFormat = jsonFormatCanonical
+			So(imp.validateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("--idStrategy should be parsed and random strategies rejected in delete mode", func() {
+			imp := NewMockMongoImport()
+			imp.IngestOptions.IDStrategy = "hash:a,b"
+			So(imp.validateSettings([]string{}), ShouldBeNil)
+			So(imp.idStrategy.fields, ShouldResemble, []string{"a", "b"})
+
+			imp = NewMockMongoImport()
+			imp.IngestOptions.IDStrategy = "sequence"
+			So(imp.validateSettings([]string{}), ShouldNotBeNil)
+
+			imp = NewMockMongoImport()
+			imp.IngestOptions.IDStrategy = "uuid"
+			imp.IngestOptions.Mode = modeDelete
+			So(imp.validateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("--arrayFields and --groupRowsBy should only be allowed for CSV and TSV", func() {
+			imp := NewMockMongoImport()
+			imp.InputOptions.Type = CSV
+			imp.InputOptions.HeaderLine = true
+			imp.InputOptions.ArrayFields = []string{"sku,qty=>items"}
+			imp.InputOptions.GroupRowsBy = "order"
+			So(imp.validateSettings([]string{}), ShouldBeNil)
+			So(imp.reshaper.grouping(), ShouldBeTrue)
+
+			imp = NewMockMongoImport()
+			imp.InputOptions.ArrayFields = []string{"sku,qty=>items"}
+			So(imp.validateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("--dedupeBy should only be allowed with insert mode and without --staged", func() {
+			imp := NewMockMongoImport()
+			imp.IngestOptions.DedupeBy = dedupeByHash
+			So(imp.validateSettings([]string{}), ShouldBeNil)
+			So(imp.hashesCollection(), ShouldEqual, imp.ToolOptions.Collection+hashesSuffix)
+
+			imp = NewMockMongoImport()
+			imp.IngestOptions.DedupeBy = dedupeByHash
+			imp.IngestOptions.Mode = modeUpsert
+			So(imp.validateSettings([]string{}), ShouldNotBeNil)
+
+			imp = NewMockMongoImport()
+			imp.IngestOptions.DedupeBy = dedupeByHash
+			imp.IngestOptions.Staged = true
+			So(imp.validateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("--type changestream should apply events in order, without --mode", func() {
+			imp := NewMockMongoImport()
+			imp.InputOptions.Type = ChangeStream
+			So(imp.validateSettings([]string{}), ShouldBeNil)
+			So(imp.IngestOptions.MaintainInsertionOrder, ShouldBeTrue)
+
+			imp = NewMockMongoImport()
+			imp.InputOptions.Type = ChangeStream
+			imp.IngestOptions.Mode = modeUpsert
+			So(imp.validateSettings([]string{}), ShouldNotBeNil)
+
+			imp = NewMockMongoImport()
+			imp.InputOptions.Type = ChangeStream
+			imp.IngestOptions.DedupeBy = dedupeByHash
+			So(imp.validateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("--dropTarget should require --staged", func() {
+			imp := NewMockMongoImport()
+			imp.IngestOptions.DropTarget = true
+			So(imp.validateSettings([]string{}), ShouldNotBeNil)
+		})
 	})
 }
 
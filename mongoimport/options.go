@@ -8,10 +8,15 @@ package mongoimport
 
 import (
 	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/healthcheck"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/runmanifest"
 )
 
 var Usage = `<options> <connection-string> <file> 
@@ -43,7 +48,7 @@ type InputOptions struct {
 	ParseGrace string `long:"parseGrace" value-name:"<grace>" default:"stop" description:"controls behavior when type coercion fails - one of: autoCast, skipField, skipRow, stop"`
 
 	// Specifies the file type to import. The default format is JSON, but it’s possible to import CSV and TSV files.
-	Type string `long:"type" value-name:"<type>" default:"json" default-mask:"-" description:"input format to import: json, csv, or tsv"`
+	Type string `long:"type" value-name:"<type>" default:"json" default-mask:"-" description:"input format to import: json, csv, tsv, changestream, which applies the insert, update, replace and delete events written by mongoexport --follow or Atlas triggers to the collection in order, or sqlinsert, which imports the rows of the INSERT statements into one table of a MySQL or Postgres dump (such as written by mysqldump or pg_dump --inserts)"`
 
 	// Indicates that field names include type descriptions
 	ColumnsHaveTypes bool `long:"columnsHaveTypes" description:"indicates that the field list (from --fields, --fieldsFile, or --headerline) specifies types; They must be in the form of '<colName>.<type>(<arg>)'. The type can be one of: auto, binary, boolean, date, date_go, date_ms, date_oracle, decimal, double, int32, int64, string. For each of the date types, the argument is a datetime layout string. For the binary type, the argument can be one of: base32, base64, hex. All other types take an empty argument. Only valid for CSV and TSV imports. e.g. zipcode.string(), thumbnail.binary(base64)"`
@@ -51,6 +56,27 @@ type InputOptions struct {
 	// Indicates that the legacy extended JSON format should be used to parse JSON documents. Defaults to false.
 	Legacy bool `long:"legacy" description:"use the legacy extended JSON format"`
 
+	// Specifies the extended JSON format of the input. Canonical input is decoded strictly so that every value keeps its BSON type.
+	JSONFormat string `long:"jsonFormat" value-name:"<type>" choice:"canonical" choice:"relaxed" description:"the extended JSON format of the input, either canonical or relaxed (defaults to 'relaxed'). With canonical, documents containing values whose BSON type is ambiguous, such as bare numbers, are rejected"`
+
+	// Bounds the memory used to buffer JSON input while parsing it.
+	MaxParseBuffer string `long:"maxParseBuffer" value-name:"<size>" description:"most memory used to buffer JSON input while parsing it, which is also the size of the largest JSON document that can be imported, e.g. 128MB (defaults to no limit)"`
+
+	// Folds the values of several fields into an array field.
+	ArrayFields []string `long:"arrayFields" value-name:"<field>[,<field>]*=><field>" description:"fold the values of the given fields of each row into an array field, e.g. --arrayFields 'tag1,tag2,tag3=>tags'; may be repeated. With --groupRowsBy, each row of a group instead adds one element to the array: the value of the field, or an embedded document of the fields if several are given. Only valid for CSV and TSV imports"`
+
+	// Groups consecutive rows sharing the same key into one document.
+	GroupRowsBy string `long:"groupRowsBy" value-name:"<field>[,<field>]*" description:"import consecutive rows with the same values of the given fields as one document, made of the fields of the first row and the arrays collected from each row by --arrayFields. Only valid for CSV and TSV imports"`
+
+	// Selects the table of a SQL dump whose rows are imported.
+	SQLTable string `long:"sqlTable" value-name:"<table>" description:"table of the SQL dump whose INSERT statements are imported with --type=sqlinsert, optionally qualified by its schema, e.g. public.users (defaults to the collection name)"`
+
+	// Gives the types of the columns of a SQL dump.
+	SQLTypeMap string `long:"sqlTypeMap" value-name:"<filename>" description:"file giving the type of columns imported with --type=sqlinsert, one per line in the form of '<column>.<type>(<arg>)' as with --columnsHaveTypes, e.g. created_at.date_go(2006-01-02 15:04:05). Other columns are typed after their SQL literals: quoted strings as strings, numbers as numbers, TRUE and FALSE as booleans, NULL as null and hex literals as binary"`
+
+	// Selects how quoted strings of a SQL dump are read.
+	SQLDialect string `long:"sqlDialect" value-name:"<dialect>" choice:"mysql" choice:"postgres" description:"dialect of the SQL dump imported with --type=sqlinsert, which sets whether backslashes escape characters in quoted strings, as in MySQL, or only in E'...' strings, as in Postgres (defaults to 'mysql')"`
+
 	UseArrayIndexFields bool `long:"useArrayIndexFields" description:"indicates that field names may include array indexes that should be used to construct arrays during import (e.g. foo.0,foo.1). Indexes must start from 0 and increase sequentially (foo.1,foo.0 would fail)."`
 }
 
@@ -95,6 +121,12 @@ type IngestOptions struct {
 	// Cannot be used simultaneously with write concern options in a URI.
 	WriteConcern string `long:"writeConcern" value-name:"<write-concern-specifier>" default-mask:"-" description:"write concern options e.g. --writeConcern majority, --writeConcern '{w: 3, wtimeout: 500, fsync: true, j: true}'"`
 
+	// Controls how the _id of each imported document is assigned.
+	IDStrategy string `long:"idStrategy" value-name:"<strategy>" description:"assign the _id of each document instead of using the _id in the input source - one of: objectid (a new ObjectId), uuid (a new random UUID), hash:<field>[,<field>]* (the SHA-256 of the given fields, so that re-importing the same data produces the same _ids), fromField:<field> (the value of the given field)"`
+
+	// Skips documents that have already been imported.
+	DedupeBy string `long:"dedupeBy" value-name:"<strategy>" choice:"hash" description:"skip documents that were already imported, so that overlapping files can be imported more than once. hash: record the SHA-256 of each document as read from the input source in a collection named '<collection>.__import_hashes', and skip documents whose hash is already recorded. The hashes of documents that fail to insert, or are not inserted because the import stops, are removed when the import ends"`
+
 	// Indicates that the server should bypass document validation on import.
 	BypassDocumentValidation bool `long:"bypassDocumentValidation" description:"bypass document validation"`
 
@@ -102,6 +134,39 @@ type IngestOptions struct {
 	NumDecodingWorkers int `long:"numDecodingWorkers" default:"0" hidden:"true"`
 
 	BulkBufferSize int `long:"batchSize" default:"1000" hidden:"true"`
+
+	// Number of times to retry a batch that fails with a network error, primary stepdown or server shutdown.
+	MaxRetries int `long:"maxRetries" value-name:"<count>" default:"0" description:"number of times to retry a batch of writes that fails with a network error, primary stepdown or server shutdown. Retried batches are written in full, so documents inserted by the failed attempt may be reported as duplicate key errors"`
+
+	// Initial delay between retries of a failed batch, doubled after each retry.
+	RetryBackoff time.Duration `long:"retryBackoff" value-name:"<duration>" default:"500ms" description:"delay before the first retry of a failed batch, doubled after every subsequent retry (e.g. 500ms, 2s)"`
+
+	// Imports into a temporary collection that is renamed over the target once complete.
+	Staged bool `long:"staged" description:"import into a temporary collection named '<collection>.__import_tmp', build the target collection's indexes on it, then rename it over the target so that readers never see a partial import"`
+
+	// Allows a staged import to replace an existing target collection.
+	DropTarget bool `long:"dropTarget" description:"with --staged, replace the target collection if it already exists"`
+
+	// Limits the number of documents passed on to be written each second.
+	RateLimit int `long:"rateLimit" value-name:"<docs/s>" description:"most documents to write per second, so that a large import does not overload the server (defaults to no limit)"`
+
+	// Daily periods during which the import is paused, or outside of which it is paused.
+	PauseWindows []string `long:"pauseWindow" value-name:"<HH:MM>-<HH:MM>[ exclude|include]" description:"pause the import during a daily window of local time, e.g. '09:00-17:00', or with 'include', outside of it, e.g. '02:00-04:00 include'; the import resumes by itself once the window allows. May be repeated"`
+
+	// Checks the target collection once the import completes.
+	ValidateAfter string `long:"validateAfter" value-name:"<check>" choice:"count" choice:"hash" choice:"full" description:"once the import completes, check the target collection and fail if it does not hold what was imported. count: check that it gained as many documents as were imported. hash: also read the input file again and compare a sample of its documents with the target by _id. full: compare every document of the input file. Documents that failed to import count as missing or different"`
+
+	// Number of documents compared by --validateAfter=hash.
+	ValidateSampleSize int `long:"validateSampleSize" value-name:"<count>" default:"1000" default-mask:"-" description:"about how many documents, spread evenly through the input file, to compare with --validateAfter=hash (defaults to 1000)"`
+
+	// Where to write the result of --validateAfter.
+	ValidateReport string `long:"validateReport" value-name:"<filename>" description:"write the result of --validateAfter to the given file as JSON"`
+
+	// Where to record how far into the input file the import has written.
+	StateFile string `long:"stateFile" value-name:"<filename>" description:"after each batch is written, record in the given file how many records of the input file were imported and the byte offset that follows them, so that an import which fails can be continued with --resume. Requires --file with --type=csv or --type=tsv, and implies --maintainInsertionOrder"`
+
+	// Continues the import recorded in --stateFile.
+	Resume bool `long:"resume" description:"continue the import recorded in --stateFile from the last batch written, rather than from the start of the input file"`
 }
 
 // Name returns a description of the IngestOptions struct.
@@ -114,7 +179,8 @@ type Options struct {
 	*options.ToolOptions
 	*InputOptions
 	*IngestOptions
-	ParsedArgs []string
+	RunManifest *runmanifest.Options
+	ParsedArgs  []string
 }
 
 // ParseOptions reads command line arguments and converts them into options used to configure mongoimport.
@@ -125,6 +191,8 @@ func ParseOptions(rawArgs []string, versionStr, gitCommit string) (Options, erro
 	ingestOpts := &IngestOptions{}
 	opts.AddOptions(inputOpts)
 	opts.AddOptions(ingestOpts)
+	runManifestOpts := &runmanifest.Options{}
+	opts.AddOptions(runManifestOpts)
 
 	extraArgs, err := opts.ParseArgs(rawArgs)
 	if err != nil {
@@ -164,6 +232,64 @@ func ParseOptions(rawArgs []string, versionStr, gitCommit string) (Options, erro
 		opts,
 		inputOpts,
 		ingestOpts,
+		runManifestOpts,
 		extraArgs,
 	}, nil
 }
+
+// HealthCheckRequirements returns the privileges needed to import with opts,
+// which are checked by --healthCheck.
+func (opts Options) HealthCheckRequirements() []healthcheck.Requirement {
+	target := healthcheck.Resource{DB: opts.ToolOptions.Namespace.DB, Collection: opts.ToolOptions.Namespace.Collection}
+	if target.DB == "" {
+		target.DB = "test"
+	}
+	if target.Collection == "" && opts.InputOptions.File != "" {
+		// as in validateSettings, the collection is named after the file
+		target.Collection = strings.TrimSuffix(filepath.Base(opts.InputOptions.File), filepath.Ext(opts.InputOptions.File))
+	}
+
+	mode := opts.IngestOptions.Mode
+	if opts.IngestOptions.Upsert || (mode == "" && opts.IngestOptions.UpsertFields != "") {
+		mode = modeUpsert
+	} else if mode == "" {
+		mode = modeInsert
+	}
+	var actions []string
+	switch {
+	case opts.InputOptions.Type == ChangeStream:
+		actions = []string{"find", "insert", "update", "remove"}
+	case mode == modeUpsert || mode == modeMerge:
+		actions = []string{"find", "insert", "update"}
+	case mode == modeDelete:
+		actions = []string{"find", "remove"}
+	default:
+		actions = []string{"insert"}
+	}
+	if opts.IngestOptions.Drop {
+		actions = append(actions, "dropCollection")
+	}
+	if opts.IngestOptions.Staged {
+		actions = append(actions, "createCollection", "createIndex", "renameCollectionSameDB", "dropCollection")
+	}
+	requirements := []healthcheck.Requirement{{
+		Resource: target,
+		Actions:  actions,
+		Purpose:  fmt.Sprintf("import into the collection with --mode=%v", mode),
+	}}
+	if opts.InputOptions.Type == ChangeStream {
+		requirements[0].Purpose = "apply change events to the collection"
+	}
+	if opts.IngestOptions.DedupeBy != "" {
+		hashActions := []string{"insert"}
+		if opts.IngestOptions.Drop {
+			hashActions = append(hashActions, "dropCollection")
+		}
+		requirements = append(requirements, healthcheck.Requirement{
+			Resource: healthcheck.Resource{DB: target.DB, Collection: target.Collection + hashesSuffix},
+			Actions:  hashActions,
+			Purpose:  "record the hashes of imported documents with --dedupeBy",
+		})
+	}
+	return requirements
+}
@@ -0,0 +1,297 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// importState is the progress of an import, recorded in --stateFile after
+// every batch that is written.
+type importState struct {
+	// File is the input file, and Size its size when the import started.
+	File string `json:"file"`
+	Size int64  `json:"size"`
+	// Records is the number of input records, not counting the header line,
+	// read before the last written batch, and Offset the byte offset in File
+	// just past the last of them.
+	Records uint64 `json:"records"`
+	Offset  int64  `json:"offset"`
+	// Complete is set once every record of File has been written.
+	Complete bool      `json:"complete"`
+	Updated  time.Time `json:"updated"`
+}
+
+// loadImportState reads the state recorded in path.
+func loadImportState(path string) (importState, error) {
+	var state importState
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return state, err
+	}
+	if err = json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("invalid state file %v: %v", path, err)
+	}
+	return state, nil
+}
+
+// saveImportState records state in path. It writes a temporary file which it
+// renames over path, so that path always holds a complete state.
+func saveImportState(path string, state importState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(append(data, '\n'))
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("error writing state file %v: %v", path, err)
+	}
+	return nil
+}
+
+// validateResumeSettings checks the options for --stateFile and --resume.
+// Progress can only be recorded for documents which are read from a file
+// and written one for one, in input order.
+func (imp *MongoImport) validateResumeSettings() error {
+	if imp.IngestOptions.StateFile == "" {
+		if imp.IngestOptions.Resume {
+			return fmt.Errorf("--resume requires --stateFile")
+		}
+		return nil
+	}
+	switch {
+	case imp.InputOptions.File == "":
+		return fmt.Errorf("--stateFile requires --file")
+	case imp.InputOptions.Type != CSV && imp.InputOptions.Type != TSV:
+		return fmt.Errorf("--stateFile can only be used with --type=%v or --type=%v", CSV, TSV)
+	case len(imp.InputOptions.ArrayFields) > 0 || imp.InputOptions.GroupRowsBy != "":
+		return fmt.Errorf("--stateFile cannot be used with --arrayFields or --groupRowsBy")
+	case imp.IngestOptions.DedupeBy != "":
+		return fmt.Errorf("incompatible options: --stateFile and --dedupeBy")
+	case imp.IngestOptions.Staged:
+		return fmt.Errorf("incompatible options: --stateFile and --staged")
+	case imp.IngestOptions.Resume && imp.IngestOptions.Drop:
+		return fmt.Errorf("incompatible options: --resume and --drop")
+	}
+	imp.IngestOptions.MaintainInsertionOrder = true
+	return nil
+}
+
+// inputPosition is how far into the input a document was read.
+type inputPosition struct {
+	records uint64
+	offset  int64
+}
+
+// importProgress follows documents from the input reader to the insertion
+// worker, and records in --stateFile how far into the input the written
+// documents reach. It relies on documents being decoded and written in input
+// order.
+type importProgress struct {
+	path  string
+	state importState
+
+	// base is the byte offset in the file of the start of the input reader
+	base int64
+	// resumed is whether the import continues from the state in path
+	resumed bool
+
+	mu sync.Mutex
+	// pending are the positions of the documents decoded but not yet
+	// written, in order
+	pending []inputPosition
+}
+
+// openImportProgress prepares to record the progress of importing file in
+// path. With resume, the import continues from the state recorded in path;
+// otherwise an unfinished import recorded there is an error, so that its
+// state is not lost by mistake.
+func openImportProgress(path, file string, resume bool) (*importProgress, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	state, err := loadImportState(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	exists := err == nil
+
+	p := &importProgress{path: path}
+	if resume {
+		if !exists {
+			return nil, fmt.Errorf("can not --resume: state file %v does not exist", path)
+		}
+		if state.Complete {
+			return nil, fmt.Errorf("can not --resume: the import of %v recorded in %v is already complete", state.File, path)
+		}
+		if filepath.Clean(state.File) != filepath.Clean(file) {
+			return nil, fmt.Errorf("can not --resume: %v records an import of %v, not %v", path, state.File, file)
+		}
+		if info.Size() < state.Size || state.Offset > info.Size() {
+			return nil, fmt.Errorf("can not --resume: %v is smaller than when its import started", file)
+		}
+		p.state = state
+		p.base = state.Offset
+		p.resumed = true
+		return p, nil
+	}
+
+	if exists && !state.Complete {
+		return nil, fmt.Errorf("state file %v records an unfinished import of %v; use --resume to continue it, or remove the file to start over", path, state.File)
+	}
+	p.state = importState{File: file, Size: info.Size()}
+	// the input reader starts after the byte order mark, if any
+	if p.base, err = bomLength(file); err != nil {
+		return nil, err
+	}
+	p.state.Offset = p.base
+	return p, nil
+}
+
+// bomLength returns the length of the UTF-8 byte order mark at the start of
+// file, or 0 if it has none.
+func bomLength(file string) (int64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	start := make([]byte, len(UTF8_BOM))
+	if _, err = io.ReadFull(f, start); err == nil && bytes.Equal(start, UTF8_BOM) {
+		return int64(len(UTF8_BOM)), nil
+	}
+	return 0, nil
+}
+
+// trackProgress opens --stateFile and has inputReader, whose header line has
+// been read from source, note the position of each document it decodes. When
+// resuming, it returns a new reader of source from the position recorded,
+// with the columns of inputReader.
+func (imp *MongoImport) trackProgress(source io.Reader, inputReader InputReader) (InputReader, error) {
+	p, err := openImportProgress(imp.IngestOptions.StateFile, imp.InputOptions.File, imp.IngestOptions.Resume)
+	if err != nil {
+		return nil, err
+	}
+	imp.progress = p
+
+	var resumed InputReader
+	if p.resumed {
+		seeker, ok := source.(io.Seeker)
+		if !ok {
+			return nil, fmt.Errorf("can not --resume: %v can not be read from an offset", imp.InputOptions.File)
+		}
+		if _, err = seeker.Seek(p.base, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if resumed, err = imp.getInputReader(source); err != nil {
+			return nil, err
+		}
+		log.Logvf(log.Always, "resuming after record %v, at byte %v of %v", p.state.Records, p.base, p.state.File)
+	}
+
+	switch r := inputReader.(type) {
+	case *CSVInputReader:
+		if resumed != nil {
+			next := resumed.(*CSVInputReader)
+			next.colSpecs, next.numProcessed = r.colSpecs, p.state.Records
+			r = next
+		} else {
+			p.state.Offset = p.base + r.csvReader.Offset()
+		}
+		r.progress = p
+		inputReader = r
+	case *TSVInputReader:
+		if resumed != nil {
+			next := resumed.(*TSVInputReader)
+			next.colSpecs, next.numProcessed = r.colSpecs, p.state.Records
+			r = next
+		} else {
+			p.state.Offset = p.base + r.consumed
+		}
+		r.progress = p
+		inputReader = r
+	}
+	return inputReader, p.save()
+}
+
+// decoded notes that a document was decoded from the input reader after it
+// had read records records and consumed bytes.
+func (p *importProgress) decoded(records uint64, consumed int64) {
+	p.mu.Lock()
+	p.pending = append(p.pending, inputPosition{records: records, offset: p.base + consumed})
+	p.mu.Unlock()
+}
+
+// written notes that the next n decoded documents were written, and records
+// the position of the last of them.
+func (p *importProgress) written(n int) error {
+	if n == 0 {
+		return nil
+	}
+	p.mu.Lock()
+	if n > len(p.pending) {
+		n = len(p.pending)
+	}
+	if n > 0 {
+		last := p.pending[n-1]
+		p.pending = p.pending[n:]
+		p.state.Records, p.state.Offset = last.records, last.offset
+	}
+	p.mu.Unlock()
+	return p.save()
+}
+
+// complete records that the whole input was written.
+func (p *importProgress) complete() error {
+	p.state.Complete = true
+	return p.save()
+}
+
+func (p *importProgress) save() error {
+	p.state.Updated = time.Now()
+	return saveImportState(p.path, p.state)
+}
+
+// trackedConverter notes the position of the record it converts with an
+// importProgress once the record has been decoded to a document.
+type trackedConverter struct {
+	Converter
+	progress *importProgress
+	records  uint64
+	consumed int64
+}
+
+func (c trackedConverter) Convert() (bson.D, error) {
+	document, err := c.Converter.Convert()
+	if err == nil && document != nil {
+		c.progress.decoded(c.records, c.consumed)
+	}
+	return document, err
+}
@@ -0,0 +1,175 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// streamTracked reads the input file of imp with progress tracking, and
+// returns the documents read.
+func streamTracked(imp *MongoImport) ([]bson.D, error) {
+	file, err := os.Open(imp.InputOptions.File)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	inputReader, err := imp.getInputReader(file)
+	if err != nil {
+		return nil, err
+	}
+	if err = imp.readHeader(inputReader); err != nil {
+		return nil, err
+	}
+	if inputReader, err = imp.trackProgress(file, inputReader); err != nil {
+		return nil, err
+	}
+	docs := make(chan bson.D, 10)
+	if err = inputReader.StreamDocument(true, docs); err != nil {
+		return nil, err
+	}
+	var read []bson.D
+	for doc := range docs {
+		read = append(read, doc)
+	}
+	return read, nil
+}
+
+func TestResume(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With --stateFile", t, func() {
+		dir, err := ioutil.TempDir("", "mongoimport_resume")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		for _, inputType := range []string{CSV, TSV} {
+			sep := ","
+			if inputType == TSV {
+				sep = "\t"
+			}
+			input := append([]byte{}, UTF8_BOM...)
+			input = append(input, "a"+sep+"b\r\n1"+sep+"x\r\n2"+sep+"y\n3"+sep+"z\n"...)
+			file := filepath.Join(dir, "input."+inputType)
+			So(ioutil.WriteFile(file, input, 0644), ShouldBeNil)
+			stateFile := filepath.Join(dir, inputType+".state")
+
+			newImport := func(resume bool) *MongoImport {
+				imp := NewMockMongoImport()
+				imp.InputOptions.File = file
+				imp.InputOptions.Type = inputType
+				imp.InputOptions.HeaderLine = true
+				imp.IngestOptions.NumDecodingWorkers = 1
+				imp.IngestOptions.StateFile = stateFile
+				imp.IngestOptions.Resume = resume
+				return imp
+			}
+
+			Convey("a "+inputType+" import records how far its written documents reach", func() {
+				imp := newImport(false)
+				docs, err := streamTracked(imp)
+				So(err, ShouldBeNil)
+				So(len(docs), ShouldEqual, 3)
+
+				state, err := loadImportState(stateFile)
+				So(err, ShouldBeNil)
+				So(state.Records, ShouldEqual, 0)
+				So(state.Offset, ShouldEqual, bytes.Index(input, []byte("1"+sep)))
+
+				So(imp.progress.written(2), ShouldBeNil)
+				state, err = loadImportState(stateFile)
+				So(err, ShouldBeNil)
+				So(state.File, ShouldEqual, file)
+				So(state.Records, ShouldEqual, 2)
+				So(state.Offset, ShouldEqual, bytes.Index(input, []byte("3"+sep)))
+				So(state.Complete, ShouldBeFalse)
+
+				Convey("which must be resumed rather than started over", func() {
+					_, err := streamTracked(newImport(false))
+					So(err, ShouldNotBeNil)
+				})
+
+				Convey("and resumes after the last of them", func() {
+					imp := newImport(true)
+					docs, err := streamTracked(imp)
+					So(err, ShouldBeNil)
+					So(docs, ShouldResemble, []bson.D{{{Key: "a", Value: int32(3)}, {Key: "b", Value: "z"}}})
+
+					So(imp.progress.written(1), ShouldBeNil)
+					state, err := loadImportState(stateFile)
+					So(err, ShouldBeNil)
+					So(state.Records, ShouldEqual, 3)
+					So(state.Offset, ShouldEqual, len(input))
+
+					Convey("until the import is complete", func() {
+						So(imp.progress.complete(), ShouldBeNil)
+						_, err := streamTracked(newImport(true))
+						So(err, ShouldNotBeNil)
+
+						docs, err := streamTracked(newImport(false))
+						So(err, ShouldBeNil)
+						So(len(docs), ShouldEqual, 3)
+					})
+				})
+			})
+		}
+
+		Convey("--resume needs a state file to resume from", func() {
+			file := filepath.Join(dir, "input.csv")
+			So(ioutil.WriteFile(file, []byte("a\n1\n"), 0644), ShouldBeNil)
+			_, err := openImportProgress(filepath.Join(dir, "missing.state"), file, true)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestValidateResumeSettings(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("--stateFile and --resume", t, func() {
+		imp := NewMockMongoImport()
+		imp.InputOptions.File = "input.csv"
+		imp.InputOptions.Type = CSV
+
+		Convey("--resume requires --stateFile", func() {
+			imp.IngestOptions.Resume = true
+			So(imp.validateResumeSettings(), ShouldNotBeNil)
+		})
+
+		Convey("--stateFile maintains the insertion order", func() {
+			imp.IngestOptions.StateFile = "import.state"
+			So(imp.validateResumeSettings(), ShouldBeNil)
+			So(imp.IngestOptions.MaintainInsertionOrder, ShouldBeTrue)
+		})
+
+		Convey("--stateFile is rejected for input it can not track", func() {
+			for _, set := range []func(imp *MongoImport){
+				func(imp *MongoImport) { imp.InputOptions.File = "" },
+				func(imp *MongoImport) { imp.InputOptions.Type = JSON },
+				func(imp *MongoImport) { imp.InputOptions.GroupRowsBy = "a" },
+				func(imp *MongoImport) { imp.IngestOptions.DedupeBy = dedupeByHash },
+				func(imp *MongoImport) { imp.IngestOptions.Staged = true },
+				func(imp *MongoImport) { imp.IngestOptions.Resume, imp.IngestOptions.Drop = true, true },
+			} {
+				imp := NewMockMongoImport()
+				imp.InputOptions.File = "input.csv"
+				imp.InputOptions.Type = CSV
+				imp.IngestOptions.StateFile = "import.state"
+				set(imp)
+				So(imp.validateResumeSettings(), ShouldNotBeNil)
+			}
+		})
+	})
+}
@@ -0,0 +1,739 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// SQL dialects of --sqlDialect, which differ in how backslashes in quoted
+// strings are read.
+const (
+	sqlDialectMySQL    = "mysql"
+	sqlDialectPostgres = "postgres"
+)
+
+// sqlValue is a literal in the VALUES of an INSERT statement.
+type sqlValue struct {
+	// text is the unquoted text of the literal, or the hex encoding of a
+	// binary literal
+	text   string
+	quoted bool
+	null   bool
+	binary bool
+}
+
+// sqlRow is a row of values of an INSERT statement, with the columns the
+// statement lists, if any.
+type sqlRow struct {
+	columns []string
+	values  []sqlValue
+}
+
+// sqlScanner reads the INSERT statements of a MySQL or Postgres dump, such as
+// written by mysqldump or pg_dump --inserts, and skips every other statement.
+type sqlScanner struct {
+	r *bufio.Reader
+	// whether backslashes escape characters in every quoted string, as in
+	// MySQL, rather than only in E'...' strings, as in Postgres
+	backslashEscapes bool
+	// table matches the table whose rows are returned
+	table string
+
+	// tables whose rows were skipped, and whether COPY data was skipped,
+	// so that each is only logged once
+	skippedTables map[string]bool
+	skippedCopy   bool
+}
+
+func newSQLScanner(in io.Reader, dialect, table string) *sqlScanner {
+	return &sqlScanner{
+		r:                bufio.NewReader(in),
+		backslashEscapes: dialect != sqlDialectPostgres,
+		table:            table,
+		skippedTables:    make(map[string]bool),
+	}
+}
+
+// peek returns the next byte without consuming it, or 0 at the end of the
+// input.
+func (s *sqlScanner) peek() byte {
+	b, err := s.r.Peek(1)
+	if err != nil {
+		return 0
+	}
+	return b[0]
+}
+
+// next consumes and returns the next byte.
+func (s *sqlScanner) next() (byte, error) {
+	return s.r.ReadByte()
+}
+
+// expect consumes the next byte, which must be c.
+func (s *sqlScanner) expect(c byte) error {
+	b, err := s.next()
+	if err == io.EOF {
+		return fmt.Errorf("unexpected end of input, expected '%c'", c)
+	}
+	if err != nil {
+		return err
+	}
+	if b != c {
+		return fmt.Errorf("expected '%c' but got '%c'", c, b)
+	}
+	return nil
+}
+
+// skipLine consumes the rest of the line.
+func (s *sqlScanner) skipLine() error {
+	_, err := s.r.ReadString('\n')
+	return err
+}
+
+// skipSpace consumes whitespace and comments.
+func (s *sqlScanner) skipSpace() error {
+	for {
+		c := s.peek()
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			s.next()
+		case c == '#':
+			if err := s.skipLine(); err != nil {
+				return err
+			}
+		case c == '-' || c == '/':
+			b, _ := s.r.Peek(2)
+			if string(b) == "--" {
+				if err := s.skipLine(); err != nil {
+					return err
+				}
+			} else if string(b) == "/*" {
+				if err := s.skipBlockComment(); err != nil {
+					return err
+				}
+			} else {
+				return nil
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// skipBlockComment consumes a /* */ comment, including MySQL's /*!...*/
+// conditional statements.
+func (s *sqlScanner) skipBlockComment() error {
+	s.next()
+	s.next()
+	var prev byte
+	for {
+		c, err := s.next()
+		if err != nil {
+			return err
+		}
+		if prev == '*' && c == '/' {
+			return nil
+		}
+		prev = c
+	}
+}
+
+func isSQLWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// readWord consumes an unquoted keyword or identifier, returning "" if the
+// input does not continue with one.
+func (s *sqlScanner) readWord() string {
+	var word []byte
+	for c := s.peek(); c != 0 && isSQLWordByte(c); c = s.peek() {
+		s.next()
+		word = append(word, c)
+	}
+	return string(word)
+}
+
+// readIdentifier consumes an identifier, either unquoted or quoted with
+// backticks or double quotes.
+func (s *sqlScanner) readIdentifier() (string, error) {
+	if err := s.skipSpace(); err != nil {
+		return "", err
+	}
+	if c := s.peek(); c == '`' || c == '"' {
+		s.next()
+		return s.readQuoted(c, false)
+	}
+	word := s.readWord()
+	if word == "" {
+		return "", fmt.Errorf("expected an identifier")
+	}
+	return word, nil
+}
+
+// readQuoted consumes the rest of a string quoted with quote, whose opening
+// quote has been consumed. A doubled quote stands for the quote itself.
+func (s *sqlScanner) readQuoted(quote byte, backslashEscapes bool) (string, error) {
+	var out []byte
+	for {
+		c, err := s.next()
+		if err == io.EOF {
+			return "", fmt.Errorf("unterminated string")
+		}
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case c == quote:
+			if s.peek() != quote {
+				return string(out), nil
+			}
+			s.next()
+		case c == '\\' && backslashEscapes:
+			if c, err = s.next(); err != nil {
+				return "", fmt.Errorf("unterminated string")
+			}
+			switch c {
+			case '0':
+				c = 0
+			case 'b':
+				c = '\b'
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'Z':
+				c = 0x1a
+			}
+		}
+		out = append(out, c)
+	}
+}
+
+// skipStatement consumes the rest of the statement, up to and including its
+// terminating semicolon.
+func (s *sqlScanner) skipStatement() error {
+	for {
+		if err := s.skipSpace(); err != nil {
+			return err
+		}
+		c, err := s.next()
+		if err != nil {
+			return err
+		}
+		switch c {
+		case ';':
+			return nil
+		case '\'', '"', '`':
+			if _, err = s.readQuoted(c, c == '\'' && s.backslashEscapes); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// skipCopyData consumes the rows of a Postgres COPY ... FROM stdin statement,
+// up to the line holding only '\.'.
+func (s *sqlScanner) skipCopyData() error {
+	for {
+		line, err := s.r.ReadString('\n')
+		if strings.TrimRight(line, "\r\n") == `\.` || err != nil {
+			return err
+		}
+	}
+}
+
+// Scan reads the input, emitting each row of the INSERT statements into the
+// table. It returns io.EOF at the end of the input.
+func (s *sqlScanner) Scan(emit func(sqlRow) error) error {
+	for {
+		if err := s.skipSpace(); err != nil {
+			return err
+		}
+		if s.peek() == 0 {
+			return io.EOF
+		}
+		if s.peek() == ';' {
+			s.next()
+			continue
+		}
+		var err error
+		switch keyword := strings.ToUpper(s.readWord()); keyword {
+		case "INSERT", "REPLACE":
+			err = s.readInsert(emit)
+		case "COPY":
+			if !s.skippedCopy {
+				log.Logvf(log.Always, "skipping COPY data, which is not supported; dump Postgres tables with pg_dump --inserts")
+				s.skippedCopy = true
+			}
+			if err = s.skipStatement(); err == nil {
+				err = s.skipCopyData()
+			}
+		default:
+			err = s.skipStatement()
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+	}
+}
+
+// readInsert reads an INSERT statement, whose keyword has been consumed,
+// emitting each of its rows if it inserts into the table.
+func (s *sqlScanner) readInsert(emit func(sqlRow) error) error {
+	// skip modifiers such as IGNORE up to INTO
+	for {
+		if err := s.skipSpace(); err != nil {
+			return err
+		}
+		word := strings.ToUpper(s.readWord())
+		if word == "INTO" {
+			break
+		}
+		if word == "" {
+			return fmt.Errorf("expected INTO in INSERT statement")
+		}
+	}
+
+	var table []string
+	for {
+		part, err := s.readIdentifier()
+		if err != nil {
+			return fmt.Errorf("error reading table name of INSERT statement: %v", err)
+		}
+		table = append(table, part)
+		if s.peek() != '.' {
+			break
+		}
+		s.next()
+	}
+	tableName := strings.Join(table, ".")
+	if !s.matchesTable(table) {
+		if !s.skippedTables[tableName] {
+			log.Logvf(log.Info, "skipping INSERT statements into table %v", tableName)
+			s.skippedTables[tableName] = true
+		}
+		return s.skipStatement()
+	}
+
+	if err := s.skipSpace(); err != nil {
+		return err
+	}
+	var columns []string
+	if s.peek() == '(' {
+		s.next()
+		for {
+			column, err := s.readIdentifier()
+			if err != nil {
+				return fmt.Errorf("error reading columns of INSERT statement into %v: %v", tableName, err)
+			}
+			columns = append(columns, column)
+			if err = s.skipSpace(); err != nil {
+				return err
+			}
+			if s.peek() != ',' {
+				break
+			}
+			s.next()
+		}
+		if err := s.expect(')'); err != nil {
+			return fmt.Errorf("error reading columns of INSERT statement into %v: %v", tableName, err)
+		}
+	}
+
+	if err := s.skipSpace(); err != nil {
+		return err
+	}
+	if keyword := strings.ToUpper(s.readWord()); keyword != "VALUES" && keyword != "VALUE" {
+		log.Logvf(log.Always, "skipping INSERT statement into %v without VALUES", tableName)
+		return s.skipStatement()
+	}
+	for {
+		if err := s.skipSpace(); err != nil {
+			return err
+		}
+		values, err := s.readRow()
+		if err != nil {
+			return fmt.Errorf("error reading VALUES of INSERT statement into %v: %v", tableName, err)
+		}
+		if err = emit(sqlRow{columns: columns, values: values}); err != nil {
+			return err
+		}
+		if err = s.skipSpace(); err != nil {
+			return err
+		}
+		if s.peek() != ',' {
+			break
+		}
+		s.next()
+	}
+	// skip the rest, such as ON DUPLICATE KEY UPDATE or RETURNING clauses
+	return s.skipStatement()
+}
+
+// matchesTable returns whether a table, given as its possibly
+// schema-qualified name, is the one whose rows are imported. A table given
+// without a schema matches in any schema.
+func (s *sqlScanner) matchesTable(table []string) bool {
+	if strings.Contains(s.table, ".") {
+		return strings.Join(table, ".") == s.table
+	}
+	return table[len(table)-1] == s.table
+}
+
+// readRow reads a parenthesized list of values.
+func (s *sqlScanner) readRow() ([]sqlValue, error) {
+	if err := s.expect('('); err != nil {
+		return nil, err
+	}
+	var values []sqlValue
+	for {
+		value, err := s.readValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		if err = s.skipSpace(); err != nil {
+			return nil, err
+		}
+		c, err := s.next()
+		if err != nil {
+			return nil, fmt.Errorf("unterminated row")
+		}
+		if c == ')' {
+			return values, nil
+		}
+		if c != ',' {
+			return nil, fmt.Errorf("expected ',' or ')' but got '%c'", c)
+		}
+	}
+}
+
+// readValue reads a literal: a quoted string, optionally prefixed by E, N,
+// X or a MySQL character set introducer, NULL or an unquoted number, keyword
+// or expression.
+func (s *sqlScanner) readValue() (sqlValue, error) {
+	if err := s.skipSpace(); err != nil {
+		return sqlValue{}, err
+	}
+	prefix := ""
+	if s.peek() != '\'' {
+		prefix = s.readWord()
+	}
+	if s.peek() == '\'' {
+		s.next()
+		escapes := s.backslashEscapes || strings.EqualFold(prefix, "E")
+		text, err := s.readQuoted('\'', escapes)
+		if err != nil {
+			return sqlValue{}, err
+		}
+		value := sqlValue{text: text, quoted: true}
+		switch {
+		case strings.EqualFold(prefix, "X"):
+			value.binary = true
+		case strings.EqualFold(prefix, "_binary"):
+			value.text, value.binary = hex.EncodeToString([]byte(text)), true
+		}
+		// skip a Postgres cast, e.g. '2020-01-01'::date
+		_, err = s.readExpression()
+		return value, err
+	}
+
+	rest, err := s.readExpression()
+	if err != nil {
+		return sqlValue{}, err
+	}
+	text := strings.TrimSpace(prefix + rest)
+	if i := strings.Index(text, "::"); i > 0 {
+		text = strings.TrimSpace(text[:i])
+	}
+	if text == "" {
+		return sqlValue{}, fmt.Errorf("missing value")
+	}
+	if strings.EqualFold(text, "NULL") {
+		return sqlValue{null: true}, nil
+	}
+	if strings.HasPrefix(text, "0x") {
+		return sqlValue{text: text[2:], binary: true}, nil
+	}
+	return sqlValue{text: text}, nil
+}
+
+// readExpression consumes unquoted text up to the ',' or ')' ending a
+// value, keeping the parentheses and quoted strings of expressions such as
+// function calls balanced.
+func (s *sqlScanner) readExpression() (string, error) {
+	var out bytes.Buffer
+	depth := 0
+	for {
+		c := s.peek()
+		switch {
+		case c == 0:
+			return "", fmt.Errorf("unterminated row")
+		case (c == ',' || c == ')') && depth == 0:
+			return out.String(), nil
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == '\'':
+			s.next()
+			text, err := s.readQuoted('\'', s.backslashEscapes)
+			if err != nil {
+				return "", err
+			}
+			out.WriteString("'" + strings.Replace(text, "'", "''", -1) + "'")
+			continue
+		}
+		s.next()
+		out.WriteByte(c)
+	}
+}
+
+// ParseSQLTypeMap reads a --sqlTypeMap file, which gives the type of a column
+// on each line as '<column>.<type>(<arg>)', as --columnsHaveTypes does. Blank
+// lines and lines starting with '#' are ignored.
+func ParseSQLTypeMap(filename string, parseGrace ParseGrace) (map[string]ColumnSpec, error) {
+	data, err := ioutil.ReadFile(util.ToUniversalPath(filename))
+	if err != nil {
+		return nil, fmt.Errorf("error reading --sqlTypeMap file: %v", err)
+	}
+	typeMap := make(map[string]ColumnSpec)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		spec, err := ParseTypedHeader(line, parseGrace)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing --sqlTypeMap file: %v", err)
+		}
+		if _, ok := typeMap[spec.Name]; ok {
+			return nil, fmt.Errorf("error parsing --sqlTypeMap file: column %v is typed more than once", spec.Name)
+		}
+		typeMap[spec.Name] = spec
+	}
+	return typeMap, nil
+}
+
+// validateSQLSettings validates the options of --type=sqlinsert and reads
+// --sqlTypeMap.
+func (imp *MongoImport) validateSQLSettings() error {
+	switch {
+	case imp.InputOptions.HeaderLine:
+		return fmt.Errorf("can not use --headerline when input type is %v", SQLInsert)
+	case imp.InputOptions.ColumnsHaveTypes:
+		return fmt.Errorf("can not use --columnsHaveTypes when input type is %v; use --sqlTypeMap", SQLInsert)
+	case imp.InputOptions.Fields != nil && imp.InputOptions.FieldFile != nil:
+		return fmt.Errorf("incompatible options: --fields and --fieldFile")
+	case imp.InputOptions.FieldFile != nil && *imp.InputOptions.FieldFile == "":
+		return fmt.Errorf("--fieldFile can not be empty string")
+	case imp.InputOptions.Legacy || imp.InputOptions.JSONFormat != "":
+		return fmt.Errorf("cannot use --legacy or --jsonFormat if input type is not JSON")
+	case imp.InputOptions.JSONArray:
+		return fmt.Errorf("cannot use --jsonArray if input type is not JSON")
+	}
+	pg, err := ValidatePG(imp.InputOptions.ParseGrace)
+	if err != nil {
+		return err
+	}
+	if imp.InputOptions.SQLDialect == "" {
+		imp.InputOptions.SQLDialect = sqlDialectMySQL
+	}
+	if imp.InputOptions.SQLTypeMap != "" {
+		imp.sqlTypeMap, err = ParseSQLTypeMap(imp.InputOptions.SQLTypeMap, pg)
+	}
+	return err
+}
+
+// sqlTable returns the table of the SQL dump whose rows are imported.
+func (imp *MongoImport) sqlTable() string {
+	if imp.InputOptions.SQLTable != "" {
+		return imp.InputOptions.SQLTable
+	}
+	return imp.ToolOptions.Collection
+}
+
+// sqlNullParser parses SQL NULLs, whatever the type of their column.
+type sqlNullParser struct{}
+
+func (sqlNullParser) Parse(string) (interface{}, error) {
+	return nil, nil
+}
+
+var (
+	sqlBooleanParser = new(FieldBooleanParser)
+	sqlBinaryParser  = &FieldBinaryParser{beHex}
+	sqlStringParser  = new(FieldStringParser)
+	sqlAutoParser    = new(FieldAutoParser)
+)
+
+// SQLInsertInputReader is a struct that implements the InputReader interface
+// for the INSERT statements of a SQL dump.
+type SQLInsertInputReader struct {
+	// columns names the values of INSERT statements that do not list their
+	// columns
+	columns []string
+
+	// typeMap holds the types of columns given with --sqlTypeMap; other
+	// columns are typed after their literals
+	typeMap map[string]ColumnSpec
+
+	scanner *sqlScanner
+
+	// numProcessed tracks the number of rows processed by the underlying reader
+	numProcessed uint64
+
+	// numDecoders is the number of concurrent goroutines to use for decoding
+	numDecoders int
+
+	// embedded sizeTracker exposes the Size() method to check the number of bytes read so far
+	sizeTracker
+
+	// ignoreBlanks is whether NULL and empty values should be ignored
+	ignoreBlanks bool
+
+	// useArrayIndexFields is whether field names include array indexes
+	useArrayIndexFields bool
+}
+
+// SQLInsertConverter implements the Converter interface for a row of an
+// INSERT statement.
+type SQLInsertConverter struct {
+	row                 sqlRow
+	columns             []string
+	typeMap             map[string]ColumnSpec
+	index               uint64
+	ignoreBlanks        bool
+	useArrayIndexFields bool
+}
+
+// NewSQLInsertInputReader returns a SQLInsertInputReader configured to read
+// the rows inserted into table by the SQL dump in, in the given dialect.
+// The values of statements without a column list are named after columns,
+// or after their position if columns is empty.
+func NewSQLInsertInputReader(columns []string, typeMap map[string]ColumnSpec, table, dialect string, in io.Reader, numDecoders int, ignoreBlanks bool, useArrayIndexFields bool) *SQLInsertInputReader {
+	szCount := newSizeTrackingReader(newBomDiscardingReader(in))
+	return &SQLInsertInputReader{
+		columns:             columns,
+		typeMap:             typeMap,
+		scanner:             newSQLScanner(szCount, dialect, table),
+		numDecoders:         numDecoders,
+		sizeTracker:         szCount,
+		ignoreBlanks:        ignoreBlanks,
+		useArrayIndexFields: useArrayIndexFields,
+	}
+}
+
+// ReadAndValidateHeader is a no-op for SQL input readers.
+func (r *SQLInsertInputReader) ReadAndValidateHeader() error {
+	return nil
+}
+
+// ReadAndValidateTypedHeader is a no-op for SQL input readers.
+func (r *SQLInsertInputReader) ReadAndValidateTypedHeader(parseGrace ParseGrace) error {
+	return nil
+}
+
+// StreamDocument takes a boolean indicating if the documents should be streamed
+// in read order and a channel on which to stream the documents processed from
+// the underlying reader. Returns a non-nil error if streaming fails.
+func (r *SQLInsertInputReader) StreamDocument(ordered bool, readDocs chan bson.D) (retErr error) {
+	sqlRowChan := make(chan Converter, r.numDecoders)
+	sqlErrChan := make(chan error)
+
+	// begin reading from source
+	go func() {
+		err := r.scanner.Scan(func(row sqlRow) error {
+			sqlRowChan <- SQLInsertConverter{
+				row:                 row,
+				columns:             r.columns,
+				typeMap:             r.typeMap,
+				index:               r.numProcessed,
+				ignoreBlanks:        r.ignoreBlanks,
+				useArrayIndexFields: r.useArrayIndexFields,
+			}
+			r.numProcessed++
+			return nil
+		})
+		close(sqlRowChan)
+		if err == io.EOF {
+			sqlErrChan <- nil
+		} else {
+			sqlErrChan <- fmt.Errorf("read error after row #%v: %v", r.numProcessed, err)
+		}
+	}()
+
+	// begin processing read rows
+	go func() {
+		sqlErrChan <- streamDocuments(ordered, r.numDecoders, sqlRowChan, readDocs)
+	}()
+
+	return channelQuorumError(sqlErrChan, 2)
+}
+
+// Convert implements the Converter interface for SQL input. It converts a
+// row to a BSON document, typing each value after --sqlTypeMap or its
+// literal.
+func (c SQLInsertConverter) Convert() (bson.D, error) {
+	columns := c.row.columns
+	if columns == nil {
+		columns = c.columns
+	}
+	if len(columns) == 0 {
+		// as for CSV and TSV, unnamed values are named after their position
+		for i := range c.row.values {
+			columns = append(columns, "field"+strconv.Itoa(i))
+		}
+	}
+	if len(c.row.values) > len(columns) {
+		return nil, fmt.Errorf("row #%v has %v values but %v columns", c.index, len(c.row.values), len(columns))
+	}
+
+	colSpecs := make([]ColumnSpec, 0, len(columns))
+	tokens := make([]string, len(c.row.values))
+	for i, value := range c.row.values {
+		tokens[i] = value.text
+		spec, ok := c.typeMap[columns[i]]
+		if !ok {
+			spec = ParseAutoHeaders([]string{columns[i]})[0]
+			switch {
+			case value.binary:
+				spec.Parser = sqlBinaryParser
+			case value.quoted:
+				spec.Parser = sqlStringParser
+			case strings.EqualFold(value.text, "TRUE") || strings.EqualFold(value.text, "FALSE"):
+				spec.Parser = sqlBooleanParser
+			default:
+				spec.Parser = sqlAutoParser
+			}
+		}
+		if value.null {
+			spec.Parser = sqlNullParser{}
+		}
+		colSpecs = append(colSpecs, spec)
+	}
+
+	document, err := tokensToBSON(colSpecs, tokens, c.index, c.ignoreBlanks, c.useArrayIndexFields)
+	if _, ok := err.(coercionError); ok {
+		return nil, nil
+	}
+	return document, err
+}
@@ -0,0 +1,182 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// readSQLDocuments returns the documents read from contents by a
+// SQLInsertInputReader.
+func readSQLDocuments(contents, table, dialect string, typeMap map[string]ColumnSpec, columns ...string) ([]bson.D, error) {
+	r := NewSQLInsertInputReader(columns, typeMap, table, dialect, strings.NewReader(contents), 1, false, false)
+	docChan := make(chan bson.D, 100)
+	if err := r.StreamDocument(true, docChan); err != nil {
+		return nil, err
+	}
+	// the channel is closed once the documents are read in order
+	var docs []bson.D
+	for doc := range docChan {
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+func TestSQLInsertStreamDocument(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a mysqldump file", t, func() {
+		contents := `-- MySQL dump 10.13
+/*!40101 SET NAMES utf8mb4 */;
+DROP TABLE IF EXISTS ` + "`users`" + `;
+CREATE TABLE ` + "`users`" + ` (
+  ` + "`id`" + ` int NOT NULL,
+  ` + "`name`" + ` varchar(64) COMMENT 'full name; or nickname',
+  PRIMARY KEY (` + "`id`" + `)
+);
+LOCK TABLES ` + "`users`" + ` WRITE;
+INSERT INTO ` + "`users`" + ` (` + "`id`, `name`, `zip`, `active`, `avatar`, `note`" + `) VALUES (1,'O\'Brien','02134',TRUE,X'CAFE',NULL),(2,'a, b)\\c','',0,0x0102,'it''s');
+INSERT INTO ` + "`orders`" + ` VALUES (1,'skipped');
+UNLOCK TABLES;
+`
+
+		Convey("rows of the table are imported, typed after their literals", func() {
+			docs, err := readSQLDocuments(contents, "users", sqlDialectMySQL, nil)
+			So(err, ShouldBeNil)
+			So(docs, ShouldResemble, []bson.D{
+				{{"id", int32(1)}, {"name", "O'Brien"}, {"zip", "02134"}, {"active", true},
+					{"avatar", []byte{0xca, 0xfe}}, {"note", nil}},
+				{{"id", int32(2)}, {"name", `a, b)\c`}, {"zip", ""}, {"active", int32(0)},
+					{"avatar", []byte{0x01, 0x02}}, {"note", "it's"}},
+			})
+		})
+
+		Convey("columns are typed with a type map", func() {
+			typeMap := func(parseGrace ParseGrace) map[string]ColumnSpec {
+				typeMap := map[string]ColumnSpec{}
+				for _, header := range []string{"id.int64()", "active.boolean()", "zip.int32()"} {
+					spec, err := ParseTypedHeader(header, parseGrace)
+					So(err, ShouldBeNil)
+					typeMap[spec.Name] = spec
+				}
+				return typeMap
+			}
+			// the empty zip of the second row cannot be parsed as an int32
+			docs, err := readSQLDocuments(contents, "users", sqlDialectMySQL, typeMap(pgSkipField))
+			So(err, ShouldBeNil)
+			So(docs[0][0], ShouldResemble, bson.E{"id", int64(1)})
+			So(docs[0][2], ShouldResemble, bson.E{"zip", int32(2134)})
+			So(docs[0][3], ShouldResemble, bson.E{"active", true})
+			So(docs[1][2], ShouldResemble, bson.E{"active", false})
+
+			_, err = readSQLDocuments(contents, "users", sqlDialectMySQL, typeMap(pgStop))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("statements without a column list use the given columns", func() {
+			docs, err := readSQLDocuments(contents, "orders", sqlDialectMySQL, nil, "_id", "status")
+			So(err, ShouldBeNil)
+			So(docs, ShouldResemble, []bson.D{{{"_id", int32(1)}, {"status", "skipped"}}})
+
+			docs, err = readSQLDocuments(contents, "orders", sqlDialectMySQL, nil)
+			So(err, ShouldBeNil)
+			So(docs, ShouldResemble, []bson.D{{{"field0", int32(1)}, {"field1", "skipped"}}})
+
+			_, err = readSQLDocuments(contents, "orders", sqlDialectMySQL, nil, "_id")
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("With a pg_dump --inserts file", t, func() {
+		contents := `--
+-- PostgreSQL database dump
+--
+SET standard_conforming_strings = on;
+COPY public.skipped (id) FROM stdin;
+1
+\.
+INSERT INTO public.events (id, path, at, amount, flags) VALUES (1, 'C:\tmp', '2020-10-19 08:30:00'::timestamp, -1.5, E'a\tb');
+INSERT INTO audit.events VALUES (7);
+`
+		docs, err := readSQLDocuments(contents, "public.events", sqlDialectPostgres, nil)
+		So(err, ShouldBeNil)
+		So(docs, ShouldResemble, []bson.D{
+			{{"id", int32(1)}, {"path", `C:\tmp`}, {"at", "2020-10-19 08:30:00"}, {"amount", -1.5}, {"flags", "a\tb"}},
+		})
+
+		spec, err := ParseTypedHeader("at.date_go(2006-01-02 15:04:05)", pgStop)
+		So(err, ShouldBeNil)
+		docs, err = readSQLDocuments(contents, "events", sqlDialectPostgres, map[string]ColumnSpec{"at": spec})
+		So(err, ShouldBeNil)
+		So(docs, ShouldHaveLength, 2)
+		So(docs[0][2], ShouldResemble, bson.E{"at", time.Date(2020, 10, 19, 8, 30, 0, 0, time.UTC)})
+	})
+
+	Convey("Malformed statements are reported", t, func() {
+		_, err := readSQLDocuments(`INSERT INTO t (a) VALUES (1, 'unterminated);`, "t", sqlDialectMySQL, nil)
+		So(err, ShouldNotBeNil)
+		_, err = readSQLDocuments(`INSERT INTO t (a) VALUES 1;`, "t", sqlDialectMySQL, nil)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestParseSQLTypeMap(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a --sqlTypeMap file", t, func() {
+		dir, err := ioutil.TempDir("", "sqltypemap")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		filename := filepath.Join(dir, "types")
+
+		Convey("columns are typed after each line", func() {
+			So(ioutil.WriteFile(filename, []byte("# users\nid.int64()\n\ncreated.date_go(2006-01-02)\n"), 0644), ShouldBeNil)
+			typeMap, err := ParseSQLTypeMap(filename, pgStop)
+			So(err, ShouldBeNil)
+			So(typeMap, ShouldHaveLength, 2)
+			So(typeMap["id"].TypeName, ShouldEqual, "int64")
+			So(typeMap["created"].TypeName, ShouldEqual, "date_go")
+		})
+
+		Convey("invalid and duplicate columns are rejected", func() {
+			So(ioutil.WriteFile(filename, []byte("id\n"), 0644), ShouldBeNil)
+			_, err := ParseSQLTypeMap(filename, pgStop)
+			So(err, ShouldNotBeNil)
+
+			So(ioutil.WriteFile(filename, []byte("id.int32()\nid.int64()\n"), 0644), ShouldBeNil)
+			_, err = ParseSQLTypeMap(filename, pgStop)
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("SQL options are validated", t, func() {
+		imp := NewMockMongoImport()
+		imp.InputOptions.Type = SQLInsert
+		So(imp.validateSettings([]string{}), ShouldBeNil)
+		So(imp.InputOptions.SQLDialect, ShouldEqual, sqlDialectMySQL)
+
+		imp = NewMockMongoImport()
+		imp.InputOptions.Type = SQLInsert
+		imp.InputOptions.HeaderLine = true
+		So(imp.validateSettings([]string{}), ShouldNotBeNil)
+
+		imp = NewMockMongoImport()
+		imp.InputOptions.Type = CSV
+		imp.InputOptions.HeaderLine = true
+		imp.InputOptions.SQLTable = "users"
+		So(imp.validateSettings([]string{}), ShouldNotBeNil)
+	})
+}
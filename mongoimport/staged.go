@@ -0,0 +1,173 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// stagingSuffix is appended to the target collection's name to name the
+// collection that a --staged import writes to.
+const stagingSuffix = ".__import_tmp"
+
+// importCollection returns the name of the collection that documents are
+// written to: the staging collection for a --staged import, and the target
+// collection otherwise.
+func (imp *MongoImport) importCollection() string {
+	if imp.IngestOptions.Staged {
+		return imp.ToolOptions.Collection + stagingSuffix
+	}
+	return imp.ToolOptions.Collection
+}
+
+// prepareStagedImport checks that the target collection may be replaced, and
+// creates an empty staging collection with the same options as the target.
+// Any staging collection left behind by an earlier import is dropped first.
+// It returns whether the target collection exists.
+func (imp *MongoImport) prepareStagedImport(session *mongo.Client) (bool, error) {
+	database := session.Database(imp.ToolOptions.DB)
+	targetInfo, err := db.GetCollectionInfo(database.Collection(imp.ToolOptions.Collection))
+	if err != nil {
+		return false, fmt.Errorf("error getting collection info for %v.%v: %v",
+			imp.ToolOptions.DB, imp.ToolOptions.Collection, err)
+	}
+	if targetInfo != nil {
+		if targetInfo.IsView() {
+			return false, fmt.Errorf("cannot use --staged to replace view %v.%v",
+				imp.ToolOptions.DB, imp.ToolOptions.Collection)
+		}
+		if !imp.IngestOptions.DropTarget {
+			return false, fmt.Errorf("collection %v.%v already exists; use --dropTarget to replace it",
+				imp.ToolOptions.DB, imp.ToolOptions.Collection)
+		}
+	}
+
+	staging := database.Collection(imp.importCollection())
+	if err = staging.Drop(context.Background()); err != nil {
+		return false, fmt.Errorf("error dropping staging collection %v.%v: %v",
+			imp.ToolOptions.DB, staging.Name(), err)
+	}
+
+	createCmd := bson.D{{"create", staging.Name()}}
+	if targetInfo != nil {
+		for option, value := range targetInfo.Options {
+			createCmd = append(createCmd, bson.E{option, value})
+		}
+	}
+	log.Logvf(log.Always, "importing into staging collection %v.%v", imp.ToolOptions.DB, staging.Name())
+	if err = database.RunCommand(context.Background(), createCmd).Err(); err != nil {
+		return false, fmt.Errorf("error creating staging collection %v.%v: %v",
+			imp.ToolOptions.DB, staging.Name(), err)
+	}
+	return targetInfo != nil, nil
+}
+
+// finishStagedImport builds the target collection's indexes on the staging
+// collection and then renames it over the target in a single operation, so
+// readers of the target never see a partially imported collection.
+func (imp *MongoImport) finishStagedImport(session *mongo.Client, targetExists bool) error {
+	database := session.Database(imp.ToolOptions.DB)
+	stagingName := imp.importCollection()
+
+	if targetExists {
+		indexes, err := imp.targetIndexes(database.Collection(imp.ToolOptions.Collection))
+		if err != nil {
+			return err
+		}
+		if len(indexes) > 0 {
+			log.Logvf(log.Always, "building %v index(es) on staging collection %v.%v",
+				len(indexes), imp.ToolOptions.DB, stagingName)
+			createIndexesCmd := bson.D{
+				{"createIndexes", stagingName},
+				{"indexes", indexes},
+			}
+			if err = database.RunCommand(context.Background(), createIndexesCmd).Err(); err != nil {
+				return fmt.Errorf("error building indexes on staging collection %v.%v: %v",
+					imp.ToolOptions.DB, stagingName, err)
+			}
+		}
+	}
+
+	log.Logvf(log.Always, "renaming %v.%v to %v.%v",
+		imp.ToolOptions.DB, stagingName, imp.ToolOptions.DB, imp.ToolOptions.Collection)
+	renameCmd := bson.D{
+		{"renameCollection", imp.ToolOptions.DB + "." + stagingName},
+		{"to", imp.ToolOptions.DB + "." + imp.ToolOptions.Collection},
+		{"dropTarget", imp.IngestOptions.DropTarget},
+	}
+	if err := session.Database("admin").RunCommand(context.Background(), renameCmd).Err(); err != nil {
+		return fmt.Errorf("error renaming staging collection %v.%v: %v", imp.ToolOptions.DB, stagingName, err)
+	}
+	return nil
+}
+
+// abortStagedImport drops the staging collection after a failed import,
+// leaving the target collection untouched.
+func (imp *MongoImport) abortStagedImport(session *mongo.Client) {
+	stagingName := imp.importCollection()
+	log.Logvf(log.Always, "dropping staging collection %v.%v; %v.%v was not modified",
+		imp.ToolOptions.DB, stagingName, imp.ToolOptions.DB, imp.ToolOptions.Collection)
+	staging := session.Database(imp.ToolOptions.DB).Collection(stagingName)
+	if err := staging.Drop(context.Background()); err != nil {
+		log.Logvf(log.Always, "error dropping staging collection %v.%v: %v", imp.ToolOptions.DB, stagingName, err)
+	}
+}
+
+// targetIndexes returns the specifications of the collection's indexes other
+// than the _id index, which every collection already has.
+func (imp *MongoImport) targetIndexes(coll *mongo.Collection) ([]bson.D, error) {
+	cursor, err := db.GetIndexes(coll)
+	if err != nil {
+		return nil, fmt.Errorf("error listing indexes for %v.%v: %v", imp.ToolOptions.DB, coll.Name(), err)
+	}
+	defer cursor.Close(context.Background())
+
+	var indexes []bson.D
+	for cursor.Next(context.Background()) {
+		var index bson.D
+		if err = cursor.Decode(&index); err != nil {
+			return nil, fmt.Errorf("error reading indexes for %v.%v: %v", imp.ToolOptions.DB, coll.Name(), err)
+		}
+		if indexName(index) == "_id_" {
+			continue
+		}
+		indexes = append(indexes, withoutIndexNamespace(index))
+	}
+	if err = cursor.Err(); err != nil {
+		return nil, fmt.Errorf("error reading indexes for %v.%v: %v", imp.ToolOptions.DB, coll.Name(), err)
+	}
+	return indexes, nil
+}
+
+func indexName(index bson.D) string {
+	for _, elem := range index {
+		if elem.Key == "name" {
+			name, _ := elem.Value.(string)
+			return name
+		}
+	}
+	return ""
+}
+
+// withoutIndexNamespace removes the "ns" field that older servers include in
+// index specifications, since it names the target rather than the staging
+// collection.
+func withoutIndexNamespace(index bson.D) bson.D {
+	spec := make(bson.D, 0, len(index))
+	for _, elem := range index {
+		if elem.Key != "ns" {
+			spec = append(spec, elem)
+		}
+	}
+	return spec
+}
@@ -0,0 +1,238 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// pauseWindow is a daily period of local time, given by --pauseWindow, that
+// the import is paused during or, if include is set, only runs during.
+type pauseWindow struct {
+	spec string
+	// start and end are offsets from midnight; a window whose end is before
+	// its start runs past midnight
+	start, end time.Duration
+	include    bool
+}
+
+// parsePauseWindow parses a window of the form <HH:MM>-<HH:MM>[ exclude|include].
+func parsePauseWindow(spec string) (pauseWindow, error) {
+	w := pauseWindow{spec: spec}
+	fields := strings.Fields(spec)
+	if len(fields) == 2 {
+		switch fields[1] {
+		case "exclude":
+		case "include":
+			w.include = true
+		default:
+			return pauseWindow{}, fmt.Errorf("invalid --pauseWindow '%v': must end with 'exclude' or 'include'", spec)
+		}
+	} else if len(fields) != 1 {
+		return pauseWindow{}, fmt.Errorf("invalid --pauseWindow '%v': must be of the form <HH:MM>-<HH:MM>[ exclude|include]", spec)
+	}
+
+	bounds := strings.Split(fields[0], "-")
+	if len(bounds) != 2 {
+		return pauseWindow{}, fmt.Errorf("invalid --pauseWindow '%v': must be of the form <HH:MM>-<HH:MM>[ exclude|include]", spec)
+	}
+	var err error
+	if w.start, err = parseTimeOfDay(bounds[0]); err != nil {
+		return pauseWindow{}, fmt.Errorf("invalid --pauseWindow '%v': %v", spec, err)
+	}
+	if w.end, err = parseTimeOfDay(bounds[1]); err != nil {
+		return pauseWindow{}, fmt.Errorf("invalid --pauseWindow '%v': %v", spec, err)
+	}
+	if w.start == w.end {
+		return pauseWindow{}, fmt.Errorf("invalid --pauseWindow '%v': start and end must differ", spec)
+	}
+	return w, nil
+}
+
+// parseTimeOfDay returns the offset from midnight of a time of the form HH:MM.
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("'%v' is not a time of the form HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// contains returns whether the time of day at offset from midnight is within
+// the window.
+func (w pauseWindow) contains(offset time.Duration) bool {
+	if w.start < w.end {
+		return offset >= w.start && offset < w.end
+	}
+	return offset >= w.start || offset < w.end
+}
+
+// throttle paces the documents passed on to be inserted to at most rateLimit
+// per second, if set, and holds them back while the import is paused by its
+// windows.
+type throttle struct {
+	rateLimit int
+	windows   []pauseWindow
+
+	// now and sleep are replaced in tests; sleep returns false if dying is
+	// closed before d has passed.
+	now   func() time.Time
+	sleep func(d time.Duration, dying <-chan struct{}) bool
+}
+
+// newThrottle returns a throttle for --rateLimit and --pauseWindow, or nil if
+// neither is set.
+func newThrottle(rateLimit int, windowSpecs []string) (*throttle, error) {
+	if rateLimit < 0 {
+		return nil, fmt.Errorf("--rateLimit must not be negative")
+	}
+	if rateLimit == 0 && len(windowSpecs) == 0 {
+		return nil, nil
+	}
+	th := &throttle{
+		rateLimit: rateLimit,
+		now:       time.Now,
+		sleep:     sleepUnlessDying,
+	}
+	for _, spec := range windowSpecs {
+		w, err := parsePauseWindow(spec)
+		if err != nil {
+			return nil, err
+		}
+		th.windows = append(th.windows, w)
+	}
+
+	// whether the import is paused only changes at the bounds of a window,
+	// so it can run at some time of day if it can run at one of them
+	for _, offset := range th.bounds() {
+		if !th.pausedAt(offset) {
+			return th, nil
+		}
+	}
+	if len(th.windows) > 0 {
+		return nil, fmt.Errorf("invalid --pauseWindow: the import would be paused at all times of day")
+	}
+	return th, nil
+}
+
+// sleepUnlessDying waits for d, returning false if dying is closed first.
+func sleepUnlessDying(d time.Duration, dying <-chan struct{}) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-dying:
+		return false
+	}
+}
+
+// bounds returns the offsets from midnight at which a window starts or ends.
+func (th *throttle) bounds() []time.Duration {
+	bounds := make([]time.Duration, 0, 2*len(th.windows))
+	for _, w := range th.windows {
+		bounds = append(bounds, w.start, w.end)
+	}
+	return bounds
+}
+
+// pausedAt returns whether the import is paused at the time of day at offset
+// from midnight: when it is within an excluding window, or outside every
+// including window if there are any.
+func (th *throttle) pausedAt(offset time.Duration) bool {
+	var included, hasIncludes bool
+	for _, w := range th.windows {
+		if !w.include {
+			if w.contains(offset) {
+				return true
+			}
+			continue
+		}
+		hasIncludes = true
+		included = included || w.contains(offset)
+	}
+	return hasIncludes && !included
+}
+
+// pausedUntil returns whether the import is paused at t, and if so the time
+// it resumes at.
+func (th *throttle) pausedUntil(t time.Time) (time.Time, bool) {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if !th.pausedAt(t.Sub(midnight)) {
+		return time.Time{}, false
+	}
+
+	// step through the following bounds of the windows, for up to a day,
+	// until one that the import is not paused at
+	resume := t
+	for i := 0; i <= len(th.windows)*2; i++ {
+		var next time.Time
+		for _, offset := range th.bounds() {
+			at := midnight.Add(offset)
+			for !at.After(resume) {
+				at = at.AddDate(0, 0, 1)
+			}
+			if next.IsZero() || at.Before(next) {
+				next = at
+			}
+		}
+		resume = next
+		day := time.Date(resume.Year(), resume.Month(), resume.Day(), 0, 0, 0, 0, resume.Location())
+		if !th.pausedAt(resume.Sub(day)) {
+			break
+		}
+	}
+	return resume, true
+}
+
+// stream reads documents from in and sends them to out, which it closes once
+// in is closed, waiting as needed to keep to the rate limit and outside the
+// pause windows. It returns early if dying is closed.
+func (th *throttle) stream(in <-chan bson.D, out chan<- bson.D, dying <-chan struct{}) error {
+	defer close(out)
+	start := th.now()
+	var sent int64
+	for document := range in {
+		now := th.now()
+		if resume, paused := th.pausedUntil(now); paused {
+			log.Logvf(log.Always, "pausing import until %v", resume.Format("2006-01-02 15:04 MST"))
+			if !th.sleep(resume.Sub(now), dying) {
+				return nil
+			}
+			log.Logv(log.Always, "resuming import")
+			now = th.now()
+			// don't make up for the time spent paused
+			start, sent = now, 0
+		}
+
+		if th.rateLimit > 0 {
+			due := start.Add(time.Duration(sent) * time.Second / time.Duration(th.rateLimit))
+			if wait := due.Sub(now); wait > 0 {
+				if !th.sleep(wait, dying) {
+					return nil
+				}
+			} else if wait < -time.Second {
+				// the input fell behind the rate limit, so don't let it
+				// burst to catch up
+				start, sent = now, 0
+			}
+			sent++
+		}
+
+		select {
+		case out <- document:
+		case <-dying:
+			return nil
+		}
+	}
+	return nil
+}
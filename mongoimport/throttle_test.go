@@ -0,0 +1,135 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParsePauseWindow(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Pause windows should be parsed", t, func() {
+		w, err := parsePauseWindow("09:00-17:30")
+		So(err, ShouldBeNil)
+		So(w.start, ShouldEqual, 9*time.Hour)
+		So(w.end, ShouldEqual, 17*time.Hour+30*time.Minute)
+		So(w.include, ShouldBeFalse)
+		So(w.contains(9*time.Hour), ShouldBeTrue)
+		So(w.contains(17*time.Hour+30*time.Minute), ShouldBeFalse)
+
+		w, err = parsePauseWindow("22:00-02:00 include")
+		So(err, ShouldBeNil)
+		So(w.include, ShouldBeTrue)
+		So(w.contains(23*time.Hour), ShouldBeTrue)
+		So(w.contains(time.Hour), ShouldBeTrue)
+		So(w.contains(12*time.Hour), ShouldBeFalse)
+
+		Convey("and invalid ones rejected", func() {
+			for _, spec := range []string{"", "09:00", "9-17", "09:00-25:00", "09:00-09:00", "09:00-17:00 during", "09:00-17:00 exclude now"} {
+				_, err := parsePauseWindow(spec)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestNewThrottle(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("A throttle is only needed with --rateLimit or --pauseWindow", t, func() {
+		th, err := newThrottle(0, nil)
+		So(err, ShouldBeNil)
+		So(th, ShouldBeNil)
+
+		_, err = newThrottle(-1, nil)
+		So(err, ShouldNotBeNil)
+
+		Convey("and windows that always pause the import are rejected", func() {
+			_, err = newThrottle(0, []string{"00:00-12:00", "12:00-00:00"})
+			So(err, ShouldNotBeNil)
+			_, err = newThrottle(0, []string{"02:00-04:00 include", "01:00-05:00"})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestThrottlePausedUntil(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2020, time.March, day, hour, min, 0, 0, time.UTC)
+	}
+
+	Convey("With business hours excluded", t, func() {
+		th, err := newThrottle(0, []string{"09:00-12:00", "12:00-17:00 exclude"})
+		So(err, ShouldBeNil)
+
+		_, paused := th.pausedUntil(at(2, 8, 59))
+		So(paused, ShouldBeFalse)
+
+		resume, paused := th.pausedUntil(at(2, 10, 0))
+		So(paused, ShouldBeTrue)
+		So(resume, ShouldResemble, at(2, 17, 0))
+	})
+
+	Convey("With only a nightly window included", t, func() {
+		th, err := newThrottle(0, []string{"23:00-02:00 include"})
+		So(err, ShouldBeNil)
+
+		_, paused := th.pausedUntil(at(2, 1, 0))
+		So(paused, ShouldBeFalse)
+
+		resume, paused := th.pausedUntil(at(2, 2, 0))
+		So(paused, ShouldBeTrue)
+		So(resume, ShouldResemble, at(2, 23, 0))
+	})
+}
+
+func TestThrottleStream(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a throttle on a fake clock", t, func() {
+		now := time.Date(2020, time.March, 2, 8, 0, 0, 0, time.UTC)
+		var slept []time.Duration
+		th, err := newThrottle(2, []string{"08:00-08:01"})
+		So(err, ShouldBeNil)
+		th.now = func() time.Time { return now }
+		th.sleep = func(d time.Duration, _ <-chan struct{}) bool {
+			slept = append(slept, d)
+			now = now.Add(d)
+			return true
+		}
+
+		in := make(chan bson.D, 4)
+		out := make(chan bson.D, 4)
+		for i := 0; i < 4; i++ {
+			in <- bson.D{{Key: "n", Value: i}}
+		}
+		close(in)
+
+		Convey("documents should wait out the window, then keep to the rate", func() {
+			So(th.stream(in, out, make(chan struct{})), ShouldBeNil)
+			var count int
+			for range out {
+				count++
+			}
+			So(count, ShouldEqual, 4)
+			So(slept, ShouldResemble, []time.Duration{
+				time.Minute,
+				500 * time.Millisecond,
+				500 * time.Millisecond,
+				500 * time.Millisecond,
+			})
+		})
+	})
+}
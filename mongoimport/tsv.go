@@ -50,6 +50,12 @@ type TSVInputReader struct {
 
 	// useArrayIndexFields is whether field names include array indexes
 	useArrayIndexFields bool
+
+	// progress follows how far into the input the documents reach, if set by --stateFile
+	progress *importProgress
+
+	// consumed is the number of bytes of input read so far
+	consumed int64
 }
 
 // TSVConverter implements the Converter interface for TSV input.
@@ -85,6 +91,7 @@ func (r *TSVInputReader) ReadAndValidateHeader() (err error) {
 	if err != nil {
 		return err
 	}
+	r.consumed += int64(len(header))
 	var headerFields []string
 	for _, field := range strings.Split(header, tokenSeparator) {
 		headerFields = append(headerFields, strings.TrimRight(field, "\r\n"))
@@ -100,6 +107,7 @@ func (r *TSVInputReader) ReadAndValidateTypedHeader(parseGrace ParseGrace) (err
 	if err != nil {
 		return err
 	}
+	r.consumed += int64(len(header))
 	var headerFields []string
 	for _, field := range strings.Split(header, tokenSeparator) {
 		headerFields = append(headerFields, strings.TrimRight(field, "\r\n"))
@@ -123,6 +131,7 @@ func (r *TSVInputReader) StreamDocument(ordered bool, readDocs chan bson.D) (ret
 		var err error
 		for {
 			r.tsvRecord, err = r.tsvReader.ReadString(entryDelimiter)
+			r.consumed += int64(len(r.tsvRecord))
 			if err != nil {
 				close(tsvRecordChan)
 				if err == io.EOF {
@@ -133,7 +142,7 @@ func (r *TSVInputReader) StreamDocument(ordered bool, readDocs chan bson.D) (ret
 				}
 				return
 			}
-			tsvRecordChan <- TSVConverter{
+			var converter Converter = TSVConverter{
 				colSpecs:            r.colSpecs,
 				data:                r.tsvRecord,
 				index:               r.numProcessed,
@@ -142,6 +151,10 @@ func (r *TSVInputReader) StreamDocument(ordered bool, readDocs chan bson.D) (ret
 				rejectWriter:        r.tsvRejectWriter,
 			}
 			r.numProcessed++
+			if r.progress != nil {
+				converter = trackedConverter{converter, r.progress, r.numProcessed, r.consumed}
+			}
+			tsvRecordChan <- converter
 		}
 	}()
 
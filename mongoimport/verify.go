@@ -0,0 +1,362 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Checks accepted by --validateAfter.
+const (
+	validateCount = "count"
+	validateHash  = "hash"
+	validateFull  = "full"
+)
+
+// maxVerifyExamples is the most documents that a verification report
+// describes by _id.
+const maxVerifyExamples = 10
+
+// verifyReport is the result of --validateAfter, as written to
+// --validateReport.
+type verifyReport struct {
+	Check       string `json:"check"`
+	Namespace   string `json:"namespace"`
+	Passed      bool   `json:"passed"`
+	CountBefore int64  `json:"countBefore"`
+	Imported    uint64 `json:"imported"`
+	Failed      uint64 `json:"failed"`
+	CountAfter  int64  `json:"countAfter"`
+
+	// the documents of the input file compared with the target, for the
+	// hash and full checks
+	Compared  int64 `json:"compared,omitempty"`
+	Missing   int64 `json:"missing,omitempty"`
+	Different int64 `json:"different,omitempty"`
+	// WithoutID counts the documents that could not be compared, since
+	// they have no _id in the input file
+	WithoutID int64    `json:"withoutId,omitempty"`
+	Examples  []string `json:"examples,omitempty"`
+}
+
+// countMatches returns whether the target gained as many documents as were
+// imported.
+func (r *verifyReport) countMatches() bool {
+	return r.CountAfter == r.CountBefore+int64(r.Imported)
+}
+
+// record counts a document that is missing from the target, or different
+// there.
+func (r *verifyReport) record(id interface{}, missing bool) {
+	difference := "different in the target"
+	if missing {
+		r.Missing++
+		difference = "missing from the target"
+	} else {
+		r.Different++
+	}
+	if len(r.Examples) < maxVerifyExamples {
+		r.Examples = append(r.Examples, fmt.Sprintf("document with _id %v is %v", formatID(id), difference))
+	}
+}
+
+// formatID returns an _id as Extended JSON.
+func formatID(id interface{}) string {
+	out, err := bson.MarshalExtJSON(bson.D{{Key: "_id", Value: id}}, false, false)
+	if err != nil {
+		return fmt.Sprintf("%v", id)
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(string(out), `{"_id":`), "}")
+}
+
+// summary describes the result in a line.
+func (r *verifyReport) summary() string {
+	var problems []string
+	if !r.countMatches() {
+		problems = append(problems, fmt.Sprintf("expected %v documents in %v (%v before and %v imported) but found %v",
+			r.CountBefore+int64(r.Imported), r.Namespace, r.CountBefore, r.Imported, r.CountAfter))
+	}
+	if r.Missing+r.Different > 0 {
+		problems = append(problems, fmt.Sprintf("of %v documents compared, %v are missing from the target and %v are different",
+			r.Compared, r.Missing, r.Different))
+	}
+	if len(problems) == 0 {
+		if r.Check == validateCount {
+			return fmt.Sprintf("%v holds the %v documents imported", r.Namespace, r.Imported)
+		}
+		return fmt.Sprintf("%v holds the %v documents imported, and %v documents compared are the same", r.Namespace, r.Imported, r.Compared)
+	}
+	return strings.Join(problems, "; ")
+}
+
+// validateVerifySettings checks the options for --validateAfter, which can
+// only tell what the target should hold after inserting documents from a file.
+func (imp *MongoImport) validateVerifySettings() error {
+	check := imp.IngestOptions.ValidateAfter
+	if check == "" {
+		if imp.IngestOptions.ValidateReport != "" {
+			return fmt.Errorf("--validateReport can only be used with --validateAfter")
+		}
+		return nil
+	}
+	switch {
+	case check != validateCount && check != validateHash && check != validateFull:
+		return fmt.Errorf("invalid --validateAfter argument: %v", check)
+	case imp.IngestOptions.Mode != modeInsert || imp.InputOptions.Type == ChangeStream:
+		return fmt.Errorf("--validateAfter can only be used with --mode=%v", modeInsert)
+	case imp.ToolOptions.WriteConcern != nil && !imp.ToolOptions.WriteConcern.Acknowledged():
+		return fmt.Errorf("--validateAfter cannot be used with an unacknowledged write concern")
+	case check == validateCount:
+		return nil
+	case imp.InputOptions.File == "":
+		return fmt.Errorf("--validateAfter=%v requires --file, since the input is read again", check)
+	case imp.idStrategy != nil && imp.idStrategy.random():
+		return fmt.Errorf("--validateAfter=%v cannot be used with --idStrategy=%v, since the _ids assigned are not known", check, imp.idStrategy.kind)
+	case check == validateHash && imp.IngestOptions.ValidateSampleSize <= 0:
+		return fmt.Errorf("--validateSampleSize must be positive")
+	}
+	return nil
+}
+
+// verifyImport checks the target collection according to --validateAfter,
+// once processed documents were imported and failed could not be, logs the
+// result and writes it to --validateReport. It returns an error if the check
+// fails.
+func (imp *MongoImport) verifyImport(processed, failed uint64) error {
+	session, err := imp.SessionProvider.GetSession()
+	if err != nil {
+		return err
+	}
+	collection := session.Database(imp.ToolOptions.DB).Collection(imp.ToolOptions.Collection)
+
+	report := &verifyReport{
+		Check:       imp.IngestOptions.ValidateAfter,
+		Namespace:   imp.ToolOptions.DB + "." + imp.ToolOptions.Collection,
+		CountBefore: imp.countBefore,
+		Imported:    processed,
+		Failed:      failed,
+	}
+	log.Logvf(log.Always, "checking %v with --validateAfter=%v", report.Namespace, report.Check)
+	if report.CountAfter, err = collection.CountDocuments(context.Background(), bson.D{}); err != nil {
+		return fmt.Errorf("error counting documents for --validateAfter: %v", err)
+	}
+	if report.Check != validateCount {
+		interval := 1
+		if report.Check == validateHash {
+			interval = sampleInterval(processed+failed, imp.IngestOptions.ValidateSampleSize)
+		}
+		if err = imp.compareWithInput(collection, interval, report); err != nil {
+			return fmt.Errorf("error comparing documents for --validateAfter: %v", err)
+		}
+	}
+	report.Passed = report.countMatches() && report.Missing+report.Different == 0
+
+	log.Logvf(log.Always, "validation %v: %v", map[bool]string{true: "passed", false: "failed"}[report.Passed], report.summary())
+	for _, example := range report.Examples {
+		log.Logvf(log.Always, "\t%v", example)
+	}
+	if report.WithoutID > 0 {
+		log.Logvf(log.Always, "%v document(s) without an _id in the input were not compared", report.WithoutID)
+	}
+	if err = writeVerifyReport(imp.IngestOptions.ValidateReport, report); err != nil {
+		return err
+	}
+	if !report.Passed {
+		return fmt.Errorf("validation of %v failed: %v", report.Namespace, report.summary())
+	}
+	return nil
+}
+
+// sampleInterval returns n such that comparing every nth of total documents
+// compares about size of them.
+func sampleInterval(total uint64, size int) int {
+	if size <= 0 || total <= uint64(size) {
+		return 1
+	}
+	return int((total + uint64(size) - 1) / uint64(size))
+}
+
+// compareWithInput reads the input file again and compares every interval'th
+// document, as it was imported, with the document of the same _id in
+// collection.
+func (imp *MongoImport) compareWithInput(collection *mongo.Collection, interval int, report *verifyReport) error {
+	source, _, err := imp.getSourceReader()
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	inputReader, err := imp.getInputReader(source)
+	if err != nil {
+		return err
+	}
+	if err = imp.readHeader(inputReader); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	errs := make(chan error, 2)
+	stages := 1
+	docs := make(chan bson.D, workerBufferSize)
+	if imp.reshaper != nil {
+		rows := make(chan bson.D, workerBufferSize)
+		go func() {
+			errs <- inputReader.StreamDocument(true, rows)
+		}()
+		go func() {
+			errs <- imp.reshaper.stream(rows, docs, done)
+		}()
+		stages++
+	} else {
+		go func() {
+			errs <- inputReader.StreamDocument(true, docs)
+		}()
+	}
+
+	// documents are read to the end even after an error, so that the
+	// readers are not left blocked
+	var compareErr error
+	batch := make([]bson.D, 0, imp.IngestOptions.BulkBufferSize)
+	read := 0
+	for document := range docs {
+		read++
+		if compareErr != nil || (read-1)%interval != 0 {
+			continue
+		}
+		if imp.idStrategy != nil {
+			if document, err = imp.idStrategy.assign(document); err != nil {
+				// such documents were not imported
+				continue
+			}
+		}
+		if _, ok := idOf(document); !ok {
+			report.WithoutID++
+			continue
+		}
+		batch = append(batch, document)
+		if len(batch) == cap(batch) {
+			compareErr = compareDocuments(collection, batch, report)
+			batch = batch[:0]
+		}
+	}
+	for i := 0; i < stages; i++ {
+		if err = <-errs; err != nil && compareErr == nil {
+			compareErr = err
+		}
+	}
+	if compareErr != nil {
+		return compareErr
+	}
+	return compareDocuments(collection, batch, report)
+}
+
+// idOf returns the _id of document.
+func idOf(document bson.D) (interface{}, bool) {
+	for _, elem := range document {
+		if elem.Key == "_id" {
+			return elem.Value, true
+		}
+	}
+	return nil, false
+}
+
+// storedForm returns document as the server stores it, with its _id first.
+func storedForm(document bson.D) bson.D {
+	if len(document) == 0 || document[0].Key == "_id" {
+		return document
+	}
+	stored := make(bson.D, 0, len(document))
+	for _, elem := range document {
+		if elem.Key == "_id" {
+			stored = append(stored, elem)
+		}
+	}
+	for _, elem := range document {
+		if elem.Key != "_id" {
+			stored = append(stored, elem)
+		}
+	}
+	return stored
+}
+
+// compareDocuments looks up the documents of batch in collection by _id, and
+// records each that is missing or different in report.
+func compareDocuments(collection *mongo.Collection, batch []bson.D, report *verifyReport) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	ids := make(bson.A, len(batch))
+	for i, document := range batch {
+		ids[i], _ = idOf(document)
+	}
+	cursor, err := collection.Find(context.Background(), bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(context.Background())
+
+	found := make(map[string]bson.Raw, len(batch))
+	for cursor.Next(context.Background()) {
+		id := cursor.Current.Lookup("_id")
+		found[string(byte(id.Type))+string(id.Value)] = append(bson.Raw(nil), cursor.Current...)
+	}
+	if err = cursor.Err(); err != nil {
+		return err
+	}
+	return diffImported(batch, found, report)
+}
+
+// diffImported compares each document of batch with the document of found,
+// keyed by the type and value of its _id, that has the same _id.
+func diffImported(batch []bson.D, found map[string]bson.Raw, report *verifyReport) error {
+	for _, document := range batch {
+		expected, err := bson.Marshal(storedForm(document))
+		if err != nil {
+			return fmt.Errorf("error encoding document: %v", err)
+		}
+		id := bson.Raw(expected).Lookup("_id")
+		report.Compared++
+		stored, ok := found[string(byte(id.Type))+string(id.Value)]
+		switch {
+		case !ok:
+			report.record(idValue(document), true)
+		case !bytes.Equal(expected, stored):
+			report.record(idValue(document), false)
+		}
+	}
+	return nil
+}
+
+func idValue(document bson.D) interface{} {
+	id, _ := idOf(document)
+	return id
+}
+
+// writeVerifyReport writes report as JSON to path, if set.
+func writeVerifyReport(path string, report *verifyReport) error {
+	if path == "" {
+		return nil
+	}
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(util.ToUniversalPath(path), append(out, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing --validateReport: %v", err)
+	}
+	return nil
+}
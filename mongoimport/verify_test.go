@@ -0,0 +1,173 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+func TestValidateVerifySettings(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With --validateAfter", t, func() {
+		imp := NewMockMongoImport()
+		imp.IngestOptions.Mode = modeInsert
+		imp.IngestOptions.ValidateAfter = validateHash
+		imp.IngestOptions.ValidateSampleSize = 1000
+		imp.InputOptions.File = "testdata/test.json"
+
+		Convey("an insert from a file is valid", func() {
+			So(imp.validateVerifySettings(), ShouldBeNil)
+		})
+
+		Convey("other modes and change streams are rejected", func() {
+			imp.IngestOptions.Mode = modeUpsert
+			So(imp.validateVerifySettings(), ShouldNotBeNil)
+			imp.IngestOptions.Mode = modeInsert
+			imp.InputOptions.Type = ChangeStream
+			So(imp.validateVerifySettings(), ShouldNotBeNil)
+		})
+
+		Convey("an unacknowledged write concern is rejected", func() {
+			imp.ToolOptions.WriteConcern = writeconcern.New(writeconcern.W(0))
+			So(imp.validateVerifySettings(), ShouldNotBeNil)
+		})
+
+		Convey("comparing documents requires a file", func() {
+			imp.InputOptions.File = ""
+			So(imp.validateVerifySettings(), ShouldNotBeNil)
+			imp.IngestOptions.ValidateAfter = validateCount
+			So(imp.validateVerifySettings(), ShouldBeNil)
+		})
+
+		Convey("comparing documents cannot be done with random _ids", func() {
+			imp.idStrategy = &idStrategy{kind: idStrategyUUID}
+			So(imp.validateVerifySettings(), ShouldNotBeNil)
+		})
+
+		Convey("the sample size must be positive", func() {
+			imp.IngestOptions.ValidateSampleSize = 0
+			So(imp.validateVerifySettings(), ShouldNotBeNil)
+		})
+	})
+
+	Convey("--validateReport requires --validateAfter", t, func() {
+		imp := NewMockMongoImport()
+		imp.IngestOptions.ValidateReport = "report.json"
+		So(imp.validateVerifySettings(), ShouldNotBeNil)
+	})
+}
+
+func TestSampleInterval(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("The sample interval spreads about the sample size through the input", t, func() {
+		So(sampleInterval(0, 1000), ShouldEqual, 1)
+		So(sampleInterval(1000, 1000), ShouldEqual, 1)
+		So(sampleInterval(1001, 1000), ShouldEqual, 2)
+		So(sampleInterval(10000, 1000), ShouldEqual, 10)
+		So(sampleInterval(10001, 1000), ShouldEqual, 11)
+	})
+}
+
+func TestDiffImported(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Documents of the input are compared with the stored documents by _id", t, func() {
+		found := make(map[string]bson.Raw)
+		for _, doc := range []bson.D{
+			{{Key: "_id", Value: int32(1)}, {Key: "a", Value: "x"}},
+			{{Key: "_id", Value: int32(3)}, {Key: "a", Value: "changed"}},
+			{{Key: "_id", Value: int64(4)}, {Key: "a", Value: "w"}},
+		} {
+			raw, err := bson.Marshal(doc)
+			So(err, ShouldBeNil)
+			id := bson.Raw(raw).Lookup("_id")
+			found[string(byte(id.Type))+string(id.Value)] = raw
+		}
+
+		report := &verifyReport{}
+		So(diffImported([]bson.D{
+			// the server stores the _id first
+			{{Key: "a", Value: "x"}, {Key: "_id", Value: int32(1)}},
+			{{Key: "_id", Value: int32(2)}, {Key: "a", Value: "y"}},
+			{{Key: "_id", Value: int32(3)}, {Key: "a", Value: "z"}},
+			{{Key: "_id", Value: int32(4)}, {Key: "a", Value: "w"}},
+		}, found, report), ShouldBeNil)
+		So(report.Compared, ShouldEqual, 4)
+		So(report.Missing, ShouldEqual, 2)
+		So(report.Different, ShouldEqual, 1)
+		So(report.Examples, ShouldResemble, []string{
+			`document with _id 2 is missing from the target`,
+			`document with _id 3 is different in the target`,
+			`document with _id 4 is missing from the target`,
+		})
+	})
+}
+
+func TestVerifyImport(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.IntegrationTestType)
+
+	Convey("With a CSV file imported with --validateAfter=full", t, func() {
+		dir, err := ioutil.TempDir("", "mongoimport-validate")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		imp, err := NewMongoImport()
+		So(err, ShouldBeNil)
+		imp.IngestOptions.Mode = modeInsert
+		imp.IngestOptions.Drop = true
+		imp.IngestOptions.ValidateAfter = validateFull
+		imp.IngestOptions.ValidateReport = filepath.Join(dir, "report.json")
+		imp.InputOptions.Type = CSV
+		imp.InputOptions.File = "testdata/test_blanks.csv"
+		fields := "_id,b,c"
+		imp.InputOptions.Fields = &fields
+		So(imp.validateSettings(nil), ShouldBeNil)
+
+		numProcessed, numFailed, err := imp.ImportDocuments()
+		So(err, ShouldBeNil)
+		So(numProcessed, ShouldEqual, 3)
+		So(numFailed, ShouldEqual, 0)
+
+		out, err := ioutil.ReadFile(imp.IngestOptions.ValidateReport)
+		So(err, ShouldBeNil)
+		var report verifyReport
+		So(json.Unmarshal(out, &report), ShouldBeNil)
+		So(report.Passed, ShouldBeTrue)
+		So(report.CountAfter, ShouldEqual, 3)
+		So(report.Compared, ShouldEqual, 3)
+
+		Convey("a document changed in the target fails the check", func() {
+			sessionProvider, err := db.NewSessionProvider(*getBasicToolOptions())
+			So(err, ShouldBeNil)
+			session, err := sessionProvider.GetSession()
+			So(err, ShouldBeNil)
+			collection := session.Database(testDb).Collection(testCollection)
+			_, err = collection.UpdateOne(nil, bson.D{{Key: "_id", Value: int32(5)}},
+				bson.D{{Key: "$set", Value: bson.D{{Key: "c", Value: "changed"}}}})
+			So(err, ShouldBeNil)
+
+			So(imp.verifyImport(numProcessed, numFailed), ShouldNotBeNil)
+			out, err := ioutil.ReadFile(imp.IngestOptions.ValidateReport)
+			So(err, ShouldBeNil)
+			So(json.Unmarshal(out, &report), ShouldBeNil)
+			So(report.Passed, ShouldBeFalse)
+			So(report.Different, ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,209 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Policies of --onCollationMismatch, for collections whose collation in the
+// dump is not supported by the target or differs from that of the existing
+// collection. Without a policy, an existing collection is restored into as
+// with ignore, and an unsupported collation fails the collection.
+const (
+	CollationMismatchFail     = "fail"
+	CollationMismatchIgnore   = "ignore"
+	CollationMismatchRecreate = "recreate"
+)
+
+// collationOf returns the default collation in collection options, or nil if
+// it is the simple collation.
+func collationOf(options bson.D) bson.D {
+	collation, err := bsonutil.FindSubdocumentByKey("collation", &options)
+	if err != nil || len(collation) == 0 {
+		return nil
+	}
+	if locale, err := bsonutil.FindValueByKey("locale", &collation); err == nil && locale == "simple" {
+		return nil
+	}
+	return collation
+}
+
+// canonicalCollation returns collation with its fields sorted, numbers as
+// float64 and without the ICU version, which differs between servers that
+// otherwise collate alike.
+func canonicalCollation(collation bson.D) bson.D {
+	canonical := make(bson.D, 0, len(collation))
+	for _, elem := range collation {
+		switch value := elem.Value.(type) {
+		case int32:
+			elem.Value = float64(value)
+		case int64:
+			elem.Value = float64(value)
+		}
+		if elem.Key != "version" {
+			canonical = append(canonical, elem)
+		}
+	}
+	sort.Slice(canonical, func(i, j int) bool { return canonical[i].Key < canonical[j].Key })
+	return canonical
+}
+
+// sameCollation returns whether two collations, nil for the simple
+// collation, compare strings alike.
+func sameCollation(a, b bson.D) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	aBytes, errA := bson.Marshal(canonicalCollation(a))
+	bBytes, errB := bson.Marshal(canonicalCollation(b))
+	return errA == nil && errB == nil && bytes.Equal(aBytes, bBytes)
+}
+
+// formatCollation returns a collation as extended JSON.
+func formatCollation(collation bson.D) string {
+	if collation == nil {
+		return "simple"
+	}
+	out, err := bson.MarshalExtJSON(collation, false, false)
+	if err != nil {
+		return fmt.Sprintf("%v", collation)
+	}
+	return string(out)
+}
+
+// collationErrorCodes are the server error codes of a create command whose
+// collation is rejected: BadValue and FailedToParse for collations or locales
+// the server does not support, and InvalidOptions for servers without
+// collations.
+var collationErrorCodes = map[int32]bool{
+	2:  true, // BadValue
+	9:  true, // FailedToParse
+	72: true, // InvalidOptions
+}
+
+// isCollationError returns whether err, returned when creating a collection
+// with a collation, is the target rejecting its collation.
+func isCollationError(err error) bool {
+	var commandErr mongo.CommandError
+	return errors.As(err, &commandErr) && collationErrorCodes[commandErr.Code]
+}
+
+// withoutCollation returns a copy of options without the default collation,
+// including that of the _id index.
+func withoutCollation(options bson.D) bson.D {
+	stripped := make(bson.D, 0, len(options))
+	for _, elem := range options {
+		switch elem.Key {
+		case "collation":
+			continue
+		case "idIndex":
+			if index, ok := elem.Value.(IndexDocument); ok {
+				indexOptions := make(bson.M, len(index.Options))
+				for key, value := range index.Options {
+					if key != "collation" {
+						indexOptions[key] = value
+					}
+				}
+				index.Options = indexOptions
+				elem.Value = index
+			}
+		}
+		stripped = append(stripped, elem)
+	}
+	return stripped
+}
+
+// withoutIndexCollation removes collation, the collection's default
+// collation that the target does not support, from the options of indexes.
+func withoutIndexCollation(indexes []IndexDocument, collation bson.D) {
+	for _, index := range indexes {
+		indexCollation, ok := index.Options["collation"].(bson.D)
+		if ok && sameCollation(indexCollation, collation) {
+			delete(index.Options, "collation")
+		}
+	}
+}
+
+// existingCollation returns the default collation of the intent's existing
+// collection, or nil if it is the simple collation.
+func (restore *MongoRestore) existingCollation(intent *intents.Intent) (bson.D, error) {
+	session, err := restore.SessionProvider.GetSession()
+	if err != nil {
+		return nil, fmt.Errorf("error establishing connection: %v", err)
+	}
+	cursor, err := session.Database(intent.DB).ListCollections(nil, bson.D{{Key: "name", Value: intent.C}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(nil)
+	if !cursor.Next(nil) {
+		return nil, cursor.Err()
+	}
+	var spec struct {
+		Options bson.D `bson:"options"`
+	}
+	if err = cursor.Decode(&spec); err != nil {
+		return nil, err
+	}
+	return collationOf(spec.Options), nil
+}
+
+// checkExistingCollation compares the collation of the intent's collection in
+// the dump with that of the existing collection, applying
+// --onCollationMismatch if they differ. It returns whether the existing
+// collection should be dropped and created again with the collation of the
+// dump.
+func (restore *MongoRestore) checkExistingCollation(intent *intents.Intent, options bson.D) (bool, error) {
+	existing, err := restore.existingCollation(intent)
+	if err != nil {
+		return false, fmt.Errorf("error reading the collation of %v: %v", intent.Namespace(), err)
+	}
+	dumped := collationOf(options)
+	if sameCollation(dumped, existing) {
+		return false, nil
+	}
+	mismatch := fmt.Sprintf("collation mismatch for %v: the dump has collation %v but the existing collection has %v",
+		intent.Namespace(), formatCollation(dumped), formatCollation(existing))
+	switch restore.OutputOptions.OnCollationMismatch {
+	case CollationMismatchIgnore:
+		log.Logvf(log.Always, "%v; restoring into the existing collection, whose collation applies", mismatch)
+		return false, nil
+	case CollationMismatchRecreate:
+		log.Logvf(log.Always, "%v; dropping it to create it with the collation of the dump", mismatch)
+		return true, nil
+	case "":
+		log.Logvf(log.Always, "%v; restoring into the existing collection, whose collation applies; "+
+			"use --onCollationMismatch=fail or --onCollationMismatch=recreate to stop or replace it instead", mismatch)
+		return false, nil
+	}
+	return false, fmt.Errorf("%v; use --onCollationMismatch=ignore to restore into it anyway, "+
+		"or --onCollationMismatch=recreate or --drop to replace it", mismatch)
+}
+
+// handleUnsupportedCollation applies --onCollationMismatch to a collection
+// whose creation failed with createErr as the target rejected its
+// collation. It returns the options to create the collection with instead.
+func (restore *MongoRestore) handleUnsupportedCollation(intent *intents.Intent, options bson.D, createErr error) (bson.D, error) {
+	mismatch := fmt.Sprintf("collation mismatch for %v: the target does not support the collation %v of the dump: %v",
+		intent.Namespace(), formatCollation(collationOf(options)), createErr)
+	if policy := restore.OutputOptions.OnCollationMismatch; policy == CollationMismatchFail || policy == "" {
+		return nil, fmt.Errorf("%v; use --onCollationMismatch=ignore to create the collection "+
+			"with the simple collation instead", mismatch)
+	}
+	log.Logvf(log.Always, "%v; creating the collection with the simple collation instead", mismatch)
+	return withoutCollation(options), nil
+}
@@ -0,0 +1,87 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestCollationComparison(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	french := bson.D{
+		{Key: "locale", Value: "fr"},
+		{Key: "strength", Value: int32(2)},
+		{Key: "version", Value: "57.1"},
+	}
+
+	Convey("The simple collation is reported as nil", t, func() {
+		So(collationOf(bson.D{{Key: "capped", Value: false}}), ShouldBeNil)
+		So(collationOf(bson.D{{Key: "collation", Value: bson.D{{Key: "locale", Value: "simple"}}}}), ShouldBeNil)
+		So(collationOf(bson.D{{Key: "collation", Value: french}}), ShouldResemble, french)
+	})
+
+	Convey("Collations are compared regardless of field order, number types and ICU version", t, func() {
+		reordered := bson.D{
+			{Key: "strength", Value: float64(2)},
+			{Key: "locale", Value: "fr"},
+			{Key: "version", Value: "60.2"},
+		}
+		So(sameCollation(french, reordered), ShouldBeTrue)
+		So(sameCollation(nil, nil), ShouldBeTrue)
+		So(sameCollation(french, nil), ShouldBeFalse)
+		So(sameCollation(french, bson.D{{Key: "locale", Value: "fr"}, {Key: "strength", Value: int32(3)}}), ShouldBeFalse)
+		So(formatCollation(nil), ShouldEqual, "simple")
+	})
+
+	Convey("Collation errors are recognized", t, func() {
+		So(isCollationError(fmt.Errorf("error running create command: %w",
+			mongo.CommandError{Code: 2, Name: "BadValue", Message: "Field 'locale' is invalid in: { locale: \"xx\" }"})), ShouldBeTrue)
+		So(isCollationError(fmt.Errorf("error running create command: %w",
+			mongo.CommandError{Code: 13, Name: "Unauthorized", Message: "not authorized on test to execute command"})), ShouldBeFalse)
+		So(isCollationError(errors.New("error running create command: unsupported collation")), ShouldBeFalse)
+	})
+}
+
+func TestWithoutCollation(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	french := bson.D{{Key: "locale", Value: "fr"}}
+
+	Convey("Stripping the collation removes it from the options and indexes", t, func() {
+		idIndex := IndexDocument{
+			Key:     bson.D{{Key: "_id", Value: int32(1)}},
+			Options: bson.M{"name": "_id_", "collation": french},
+		}
+		options := bson.D{
+			{Key: "collation", Value: french},
+			{Key: "idIndex", Value: idIndex},
+			{Key: "validationLevel", Value: "strict"},
+		}
+		stripped := withoutCollation(options)
+		So(collationOf(stripped), ShouldBeNil)
+		So(stripped, ShouldHaveLength, 2)
+		So(stripped[0].Value.(IndexDocument).Options, ShouldResemble, bson.M{"name": "_id_"})
+		// the options of the dump are left alone
+		So(idIndex.Options, ShouldContainKey, "collation")
+
+		indexes := []IndexDocument{
+			{Key: bson.D{{Key: "a", Value: int32(1)}}, Options: bson.M{"name": "a_1", "collation": french}},
+			{Key: bson.D{{Key: "b", Value: int32(1)}}, Options: bson.M{"name": "b_1", "collation": bson.D{{Key: "locale", Value: "de"}}}},
+		}
+		withoutIndexCollation(indexes, french)
+		So(indexes[0].Options, ShouldNotContainKey, "collation")
+		So(indexes[1].Options, ShouldContainKey, "collation")
+	})
+}
@@ -0,0 +1,115 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"fmt"
+
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Ways --truncateTarget empties an existing collection.
+const (
+	TruncateMethodDelete   = "delete"
+	TruncateMethodRecreate = "recreate"
+)
+
+// targetCollection captures the options and indexes of an existing
+// collection, so that it can be created again as it was.
+type targetCollection struct {
+	Options bson.D
+	Indexes []IndexDocument
+}
+
+// withoutIDIndex returns the indexes other than the _id index, which is
+// created with the collection.
+func withoutIDIndex(indexes []IndexDocument) []IndexDocument {
+	var others []IndexDocument
+	for _, index := range indexes {
+		if name, _ := index.Options["name"].(string); name != "_id_" {
+			others = append(others, index)
+		}
+	}
+	return others
+}
+
+// captureTargetCollection returns the options and indexes of the intent's
+// existing collection.
+func (restore *MongoRestore) captureTargetCollection(intent *intents.Intent) (*targetCollection, error) {
+	session, err := restore.SessionProvider.GetSession()
+	if err != nil {
+		return nil, fmt.Errorf("error establishing connection: %v", err)
+	}
+	cursor, err := session.Database(intent.DB).ListCollections(nil, bson.D{{Key: "name", Value: intent.C}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(nil)
+	if !cursor.Next(nil) {
+		if err = cursor.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("collection %v does not exist", intent.Namespace())
+	}
+	var spec struct {
+		Type    string `bson:"type"`
+		Options bson.D `bson:"options"`
+	}
+	if err = cursor.Decode(&spec); err != nil {
+		return nil, err
+	}
+	if spec.Type != "" && spec.Type != "collection" {
+		return nil, fmt.Errorf("%v is a %v, not a collection", intent.Namespace(), spec.Type)
+	}
+	indexes, err := restore.existingIndexes(intent)
+	if err != nil {
+		return nil, fmt.Errorf("error listing indexes of %v: %v", intent.Namespace(), err)
+	}
+	return &targetCollection{Options: spec.Options, Indexes: withoutIDIndex(indexes)}, nil
+}
+
+// truncateTarget empties the intent's existing collection before its
+// documents are restored, for --truncateTarget. The collection either has
+// its documents deleted or is dropped and created again with the options
+// and indexes it had, which is faster for large collections.
+func (restore *MongoRestore) truncateTarget(intent *intents.Intent) error {
+	if restore.OutputOptions.TruncateMethod != TruncateMethodRecreate {
+		log.Logvf(log.Info, "deleting the documents of %v before restoring", intent.Namespace())
+		session, err := restore.SessionProvider.GetSession()
+		if err != nil {
+			return fmt.Errorf("error establishing connection: %v", err)
+		}
+		result, err := session.Database(intent.DB).Collection(intent.C).DeleteMany(nil, bson.D{})
+		if err != nil {
+			return fmt.Errorf("error deleting the documents of %v: %v", intent.Namespace(), err)
+		}
+		log.Logvf(log.Always, "deleted %v documents of %v before restoring", result.DeletedCount, intent.Namespace())
+		return nil
+	}
+
+	target, err := restore.captureTargetCollection(intent)
+	if err != nil {
+		return fmt.Errorf("error reading %v to recreate it: %v", intent.Namespace(), err)
+	}
+	log.Logvf(log.Always, "recreating %v with its options and %v indexes before restoring",
+		intent.Namespace(), len(target.Indexes))
+	if err = restore.DropCollection(intent); err != nil {
+		return err
+	}
+	if err = restore.CreateCollection(intent, target.Options, ""); err != nil {
+		return fmt.Errorf("error recreating collection %v: %v", intent.Namespace(), err)
+	}
+	if len(target.Indexes) == 0 {
+		return nil
+	}
+	if err = restore.CreateIndexes(intent.DB, intent.C, target.Indexes, collationOf(target.Options) != nil); err != nil {
+		return fmt.Errorf("error recreating indexes of %v: %v", intent.Namespace(), err)
+	}
+	return nil
+}
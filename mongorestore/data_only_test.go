@@ -0,0 +1,28 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestTruncateTargetIndexes(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("The _id index is not recreated with the collection's other indexes", t, func() {
+		indexes := []IndexDocument{
+			{Options: bson.M{"name": "_id_"}, Key: bson.D{{Key: "_id", Value: int32(1)}}},
+			{Options: bson.M{"name": "custom"}, Key: bson.D{{Key: "a", Value: int32(1)}}},
+		}
+		So(withoutIDIndex(indexes), ShouldResemble, indexes[1:])
+		So(withoutIDIndex(indexes[:1]), ShouldBeEmpty)
+	})
+}
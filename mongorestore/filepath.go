@@ -32,6 +32,33 @@ const (
 	MetadataFileType
 )
 
+// dumpReportFileName is the run report mongodump writes to the root of a dump
+// directory, which holds no data to restore.
+const dumpReportFileName = "dump-report.json"
+
+// diagnosticsDirName is the folder of diagnostic data that mongodump
+// --supportBundle writes to the root of a dump directory.
+const diagnosticsDirName = "diagnostics"
+
+// isDiagnosticsDir returns true if dir is a folder written by mongodump
+// --supportBundle rather than the dump of a database named "diagnostics",
+// which cannot contain a buildInfo.json file.
+func isDiagnosticsDir(dir archive.DirLike) bool {
+	if dir.Name() != diagnosticsDirName {
+		return false
+	}
+	entries, err := dir.ReadDir()
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && entry.Name() == "buildInfo.json" {
+			return true
+		}
+	}
+	return false
+}
+
 type errorWriter struct{}
 
 func (errorWriter) Write([]byte) (int, error) {
@@ -315,6 +342,10 @@ func (restore *MongoRestore) CreateAllIntents(dir archive.DirLike) error {
 	}
 	for _, entry := range entries {
 		if entry.IsDir() {
+			if isDiagnosticsDir(entry) {
+				log.Logvf(log.DebugLow, "skipping mongodump diagnostics %v", entry.Path())
+				continue
+			}
 			if err = util.ValidateDBName(entry.Name()); err != nil {
 				return fmt.Errorf("invalid database name '%v': %v", entry.Name(), err)
 			}
@@ -362,6 +393,8 @@ func (restore *MongoRestore) CreateAllIntents(dir archive.DirLike) error {
 					oplogIntent.BSONFile = &realBSONFile{path: entry.Path(), intent: oplogIntent, gzip: restore.InputOptions.Gzip}
 				}
 				restore.manager.Put(oplogIntent)
+			} else if entry.Name() == dumpReportFileName {
+				log.Logvf(log.DebugLow, "skipping mongodump report %v", entry.Path())
 			} else {
 				log.Logvf(log.Always, `don't know what to do with file "%v", skipping...`, entry.Path())
 			}
@@ -454,6 +487,18 @@ func (restore *MongoRestore) CreateIntentsForDB(db string, dir archive.DirLike)
 					log.Logvf(log.DebugLow, "skipping restoring %v.%v, it is excluded", db, collection)
 					skip = true
 				}
+				// system collections other than those handled above are
+				// skipped unless selected, when a selection is given
+				if !skip && isOptInSystemCollection(db, collection) {
+					if restore.shouldRestoreSystemCollection(collection) {
+						log.Logvf(log.Always, "warning: restoring system collection %v.%v; its documents "+
+							"are inserted directly and may conflict with the target server's own state", db, collection)
+					} else {
+						log.Logvf(log.Always, "skipping restore of system collection %v.%v; use %v to restore it",
+							db, collection, RestoreSystemCollectionsOption)
+						skip = true
+					}
+				}
 				destNS := restore.renamer.Get(sourceNS)
 				destDB, destC := util.SplitNamespace(destNS)
 				intent := &intents.Intent{
@@ -498,6 +543,11 @@ func (restore *MongoRestore) CreateIntentsForDB(db string, dir archive.DirLike)
 					log.Logvf(log.DebugLow, "skipping restore of system.profile metadata")
 					continue
 				}
+				if isOptInSystemCollection(db, collection) && !restore.shouldRestoreSystemCollection(collection) {
+					log.Logvf(log.Always, "skipping restore of system collection %v.%v metadata; use %v to restore it",
+						db, collection, RestoreSystemCollectionsOption)
+					continue
+				}
 				if !restore.includer.Has(sourceNS) {
 					log.Logvf(log.DebugLow, "skipping restoring %v.%v metadata, it is not included", db, collection)
 					continue
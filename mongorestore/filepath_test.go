@@ -8,6 +8,9 @@ package mongorestore
 
 import (
 	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -507,3 +510,57 @@ func TestCreateIntentsForLongCollectionName(t *testing.T) {
 		})
 	})
 }
+
+func TestCreateIntentsForSystemCollections(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a dump directory containing system collections", t, func() {
+		dir, err := ioutil.TempDir("", "mongorestore_system")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		for _, name := range []string{"c1.bson", "system.js.bson", "system.views.bson", "system.views.metadata.json"} {
+			So(ioutil.WriteFile(filepath.Join(dir, name), nil, 0644), ShouldBeNil)
+		}
+
+		restoredCollections := func(mr *MongoRestore) []string {
+			ddl, err := newActualPath(dir)
+			So(err, ShouldBeNil)
+			So(mr.CreateIntentsForDB("myDB", ddl), ShouldBeNil)
+			mr.manager.Finalize(intents.Legacy)
+			var collections []string
+			for intent := mr.manager.Pop(); intent != nil; intent = mr.manager.Pop() {
+				collections = append(collections, intent.C)
+			}
+			return collections
+		}
+
+		Convey("all system collections should be restored by default", func() {
+			So(restoredCollections(newMongoRestore()), ShouldResemble, []string{"c1", "system.js", "system.views"})
+		})
+
+		Convey("system collections named by --restoreSystemCollections should be restored", func() {
+			mr := newMongoRestore()
+			mr.systemCollections, err = parseSystemCollections("system.views")
+			So(err, ShouldBeNil)
+			So(restoredCollections(mr), ShouldResemble, []string{"c1", "system.views"})
+		})
+
+		Convey("no system collections should be restored given 'none'", func() {
+			mr := newMongoRestore()
+			mr.systemCollections, err = parseSystemCollections("none")
+			So(err, ShouldBeNil)
+			So(restoredCollections(mr), ShouldResemble, []string{"c1"})
+		})
+	})
+
+	Convey("--restoreSystemCollections should only accept restorable system collections", t, func() {
+		collections, err := parseSystemCollections("system.js, system.views")
+		So(err, ShouldBeNil)
+		So(collections, ShouldResemble, map[string]bool{"system.js": true, "system.views": true})
+
+		_, err = parseSystemCollections("system.js,users")
+		So(err, ShouldNotBeNil)
+		_, err = parseSystemCollections("system.profile")
+		So(err, ShouldNotBeNil)
+	})
+}
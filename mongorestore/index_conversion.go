@@ -0,0 +1,186 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+)
+
+// indexConversion rewrites index specs from dumps of old server versions
+// that the server being restored to would reject.
+type indexConversion struct {
+	name string
+	// disabled, if set, returns whether the restore's options turn the
+	// conversion off.
+	disabled func(opts *OutputOptions) bool
+	// convert rewrites index in place for a server of the given version, and
+	// returns a description of each change made.
+	convert func(index *IndexDocument, serverVersion db.Version) (changes []string)
+}
+
+// indexConversions are applied in order to each index restored with
+// --convertLegacyIndexes.
+var indexConversions = []indexConversion{
+	{name: "legacy key values", convert: convertLegacyKeyValues},
+	{name: "index version", convert: convertIndexVersion, disabled: keepsIndexVersion},
+	{name: "geoHaystack", convert: convertGeoHaystack},
+	{name: "text language", convert: convertTextLanguage},
+	{name: "unknown options", convert: convertUnknownOptions},
+}
+
+// convertIndex applies each of the index conversions to index, logging the
+// changes made.
+func (restore *MongoRestore) convertIndex(index *IndexDocument, ns string) {
+	for _, conversion := range indexConversions {
+		if conversion.disabled != nil && conversion.disabled(restore.OutputOptions) {
+			continue
+		}
+		for _, change := range conversion.convert(index, restore.serverVersion) {
+			log.Logvf(log.Always, "convertLegacyIndexes: %v: %v on index '%v' of collection '%v'",
+				conversion.name, change, index.Options["name"], ns)
+		}
+	}
+}
+
+// convertLegacyKeyValues rewrites key values that servers before 3.4 treated
+// as 1, such as 0, true or "".
+func convertLegacyKeyValues(index *IndexDocument, _ db.Version) []string {
+	original := bsonutil.CreateExtJSONString(index.Key)
+	if !bsonutil.ConvertLegacyIndexKeys(index.Key) {
+		return nil
+	}
+	return []string{fmt.Sprintf("converted key '%v' to '%v'", original, bsonutil.CreateExtJSONString(index.Key))}
+}
+
+// convertIndexVersion rewrites index versions 0 and 1 to 2, as servers since
+// 3.2 cannot build version 0 indexes and some index types require version 2.
+// The version is only kept when restoring with --keepIndexVersion.
+func convertIndexVersion(index *IndexDocument, _ db.Version) []string {
+	v, ok := index.Options["v"]
+	if !ok {
+		return nil
+	}
+	version, ok := bsonutil.Bson2Float64(v)
+	if !ok || version >= 2 {
+		return nil
+	}
+	index.Options["v"] = int32(2)
+	return []string{fmt.Sprintf("converted index version %v to 2", v)}
+}
+
+// keepsIndexVersion returns whether --keepIndexVersion is set.
+func keepsIndexVersion(opts *OutputOptions) bool {
+	return opts.KeepIndexVersion
+}
+
+// convertGeoHaystack rewrites geoHaystack indexes, which servers since 5.0
+// cannot build, as 2d indexes on the same fields.
+func convertGeoHaystack(index *IndexDocument, serverVersion db.Version) []string {
+	if serverVersion.LT(db.Version{5, 0, 0}) {
+		return nil
+	}
+	var changes []string
+	for i, elem := range index.Key {
+		if elem.Value == "geoHaystack" {
+			index.Key[i].Value = "2d"
+			changes = append(changes, fmt.Sprintf("converted geoHaystack key '%v' to 2d", elem.Key))
+		}
+	}
+	if len(changes) > 0 {
+		if _, ok := index.Options["bucketSize"]; ok {
+			delete(index.Options, "bucketSize")
+			changes = append(changes, "removed option 'bucketSize'")
+		}
+	}
+	return changes
+}
+
+// textLanguages maps the languages supported by text indexes, by name and
+// by ISO 639-1 code, to their names.
+var textLanguages = map[string]string{
+	"none":       "none",
+	"danish":     "danish",
+	"da":         "danish",
+	"dutch":      "dutch",
+	"nl":         "dutch",
+	"english":    "english",
+	"en":         "english",
+	"finnish":    "finnish",
+	"fi":         "finnish",
+	"french":     "french",
+	"fr":         "french",
+	"german":     "german",
+	"de":         "german",
+	"hungarian":  "hungarian",
+	"hu":         "hungarian",
+	"italian":    "italian",
+	"it":         "italian",
+	"norwegian":  "norwegian",
+	"nb":         "norwegian",
+	"portuguese": "portuguese",
+	"pt":         "portuguese",
+	"romanian":   "romanian",
+	"ro":         "romanian",
+	"russian":    "russian",
+	"ru":         "russian",
+	"spanish":    "spanish",
+	"es":         "spanish",
+	"swedish":    "swedish",
+	"sv":         "swedish",
+	"turkish":    "turkish",
+	"tr":         "turkish",
+}
+
+// convertTextLanguage rewrites the language fields of text indexes: a
+// default language given in another case is rewritten by name, one that is
+// not supported at all becomes "none", and an empty language override is
+// removed.
+func convertTextLanguage(index *IndexDocument, _ db.Version) []string {
+	isText := false
+	for _, elem := range index.Key {
+		if elem.Value == "text" {
+			isText = true
+			break
+		}
+	}
+	if !isText {
+		return nil
+	}
+
+	var changes []string
+	if language, ok := index.Options["default_language"].(string); ok && textLanguages[language] == "" {
+		converted, supported := textLanguages[strings.ToLower(language)]
+		if !supported {
+			converted = "none"
+		}
+		index.Options["default_language"] = converted
+		changes = append(changes, fmt.Sprintf("converted default_language '%v' to '%v'", language, converted))
+	}
+	if override, ok := index.Options["language_override"].(string); ok && override == "" {
+		delete(index.Options, "language_override")
+		changes = append(changes, "removed empty option 'language_override'")
+	}
+	return changes
+}
+
+// convertUnknownOptions removes options that are not index options. Servers
+// since 4.1.9 are asked to ignore them instead.
+func convertUnknownOptions(index *IndexDocument, serverVersion db.Version) []string {
+	if serverVersion.GTE(db.Version{4, 1, 9}) {
+		return nil
+	}
+	var changes []string
+	for _, option := range bsonutil.ConvertLegacyIndexOptions(index.Options) {
+		changes = append(changes, fmt.Sprintf("removed option '%v'", option))
+	}
+	return changes
+}
@@ -0,0 +1,100 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestIndexConversions(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	modern := db.Version{5, 0, 0}
+	old := db.Version{4, 0, 0}
+
+	Convey("Legacy key values should be converted", t, func() {
+		index := &IndexDocument{Key: bson.D{{Key: "a", Value: true}}, Options: bson.M{"name": "a_1"}}
+		So(convertLegacyKeyValues(index, modern), ShouldHaveLength, 1)
+		So(index.Key, ShouldResemble, bson.D{{Key: "a", Value: int32(1)}})
+		So(convertLegacyKeyValues(index, modern), ShouldBeEmpty)
+	})
+
+	Convey("Index versions before 2 should be converted to 2", t, func() {
+		index := &IndexDocument{Options: bson.M{"v": int32(1)}}
+		So(convertIndexVersion(index, modern), ShouldResemble, []string{"converted index version 1 to 2"})
+		So(index.Options["v"], ShouldEqual, int32(2))
+		So(convertIndexVersion(index, modern), ShouldBeEmpty)
+		So(convertIndexVersion(&IndexDocument{Options: bson.M{}}, modern), ShouldBeEmpty)
+	})
+
+	Convey("geoHaystack indexes should become 2d indexes on 5.0 and later", t, func() {
+		newIndex := func() *IndexDocument {
+			return &IndexDocument{
+				Key:     bson.D{{Key: "pos", Value: "geoHaystack"}, {Key: "type", Value: int32(1)}},
+				Options: bson.M{"bucketSize": 1.0},
+			}
+		}
+		index := newIndex()
+		So(convertGeoHaystack(index, old), ShouldBeEmpty)
+		So(convertGeoHaystack(index, modern), ShouldHaveLength, 2)
+		So(index.Key, ShouldResemble, bson.D{{Key: "pos", Value: "2d"}, {Key: "type", Value: int32(1)}})
+		So(index.Options, ShouldNotContainKey, "bucketSize")
+	})
+
+	Convey("Text index languages should be converted", t, func() {
+		textIndex := func(options bson.M) *IndexDocument {
+			return &IndexDocument{Key: bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: int32(1)}}, Options: options}
+		}
+		index := textIndex(bson.M{"default_language": "English", "language_override": ""})
+		So(convertTextLanguage(index, modern), ShouldHaveLength, 2)
+		So(index.Options["default_language"], ShouldEqual, "english")
+		So(index.Options, ShouldNotContainKey, "language_override")
+
+		index = textIndex(bson.M{"default_language": "klingon"})
+		So(convertTextLanguage(index, modern), ShouldHaveLength, 1)
+		So(index.Options["default_language"], ShouldEqual, "none")
+
+		So(convertTextLanguage(textIndex(bson.M{"default_language": "fr"}), modern), ShouldBeEmpty)
+		So(convertTextLanguage(&IndexDocument{Key: bson.D{{Key: "a", Value: int32(1)}},
+			Options: bson.M{"default_language": "klingon"}}, modern), ShouldBeEmpty)
+	})
+
+	Convey("Unknown options should only be removed before 4.1.9", t, func() {
+		index := &IndexDocument{Options: bson.M{"name": "a_1", "safe": true, "dropDups": true}}
+		So(convertUnknownOptions(index, modern), ShouldBeEmpty)
+		So(convertUnknownOptions(index, old), ShouldResemble, []string{"removed option 'dropDups'", "removed option 'safe'"})
+		So(index.Options, ShouldResemble, bson.M{"name": "a_1"})
+	})
+
+	Convey("Indexes that are the same after conversion should be restored once", t, func() {
+		restore := &MongoRestore{serverVersion: modern, OutputOptions: &OutputOptions{}}
+		indexes := []IndexDocument{
+			{Key: bson.D{{Key: "a", Value: int32(1)}}, Options: bson.M{"name": "a_1"}},
+			{Key: bson.D{{Key: "a", Value: ""}}, Options: bson.M{"name": "a_"}},
+			{Key: bson.D{{Key: "pos", Value: "geoHaystack"}}, Options: bson.M{"name": "pos_geoHaystack", "v": int32(1)}},
+		}
+		converted := restore.convertLegacyIndexes(indexes, "test.c")
+		So(converted, ShouldHaveLength, 2)
+		So(converted[1].Key, ShouldResemble, bson.D{{Key: "pos", Value: "2d"}})
+		So(converted[1].Options["v"], ShouldEqual, int32(2))
+	})
+
+	Convey("Index versions should be kept with --keepIndexVersion", t, func() {
+		restore := &MongoRestore{serverVersion: modern, OutputOptions: &OutputOptions{KeepIndexVersion: true}}
+		indexes := []IndexDocument{
+			{Key: bson.D{{Key: "a", Value: int32(1)}}, Options: bson.M{"name": "a_1", "v": int32(1)}},
+		}
+		converted := restore.convertLegacyIndexes(indexes, "test.c")
+		So(converted, ShouldHaveLength, 1)
+		So(converted[0].Options["v"], ShouldEqual, int32(1))
+	})
+}
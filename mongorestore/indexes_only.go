@@ -0,0 +1,154 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// indexKeyString returns a string identifying an index key pattern, with
+// numeric directions compared by value so that e.g. 1 and 1.0 are equal.
+func indexKeyString(key bson.D) string {
+	parts := make([]string, len(key))
+	for i, elem := range key {
+		value := elem.Value
+		switch v := value.(type) {
+		case int32:
+			value = float64(v)
+		case int64:
+			value = float64(v)
+		case int:
+			value = float64(v)
+		}
+		parts[i] = fmt.Sprintf("%v:%v", elem.Key, value)
+	}
+	return strings.Join(parts, ",")
+}
+
+// missingIndexes splits the indexes of the dump into those that exist
+// already, by name or by key pattern, and those that are missing.
+func missingIndexes(dumped, existing []IndexDocument) (missing []IndexDocument, present []string) {
+	names := make(map[string]bool, len(existing))
+	keys := make(map[string]string, len(existing))
+	for _, index := range existing {
+		name, _ := index.Options["name"].(string)
+		names[name] = true
+		keys[indexKeyString(index.Key)] = name
+	}
+	for _, index := range dumped {
+		name, _ := index.Options["name"].(string)
+		if names[name] {
+			present = append(present, name)
+		} else if existingName, ok := keys[indexKeyString(index.Key)]; ok {
+			present = append(present, fmt.Sprintf("%v (as %v)", name, existingName))
+		} else {
+			missing = append(missing, index)
+		}
+	}
+	return missing, present
+}
+
+// existingIndexes returns the indexes of the intent's existing collection.
+func (restore *MongoRestore) existingIndexes(intent *intents.Intent) ([]IndexDocument, error) {
+	session, err := restore.SessionProvider.GetSession()
+	if err != nil {
+		return nil, fmt.Errorf("error establishing connection: %v", err)
+	}
+	cursor, err := session.Database(intent.DB).Collection(intent.C).Indexes().List(nil)
+	if err != nil {
+		return nil, err
+	}
+	var indexes []IndexDocument
+	if err = cursor.All(nil, &indexes); err != nil {
+		return nil, err
+	}
+	return indexes, nil
+}
+
+// dumpedIndexes returns the indexes of the intent's collection in the dump,
+// read from its metadata file or, without one, from a system.indexes dump.
+func (restore *MongoRestore) dumpedIndexes(intent *intents.Intent) ([]IndexDocument, error) {
+	if intent.MetadataFile == nil {
+		return restore.dbCollectionIndexes[intent.DB][intent.C], nil
+	}
+	if err := intent.MetadataFile.Open(); err != nil {
+		return nil, err
+	}
+	defer intent.MetadataFile.Close()
+	metadataJSON, err := ioutil.ReadAll(intent.MetadataFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading metadata from %v: %w", intent.MetadataLocation, err)
+	}
+	metadata, err := restore.MetadataFromJSON(metadataJSON)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing metadata from %v: %w", intent.MetadataLocation, err)
+	}
+	if metadata == nil {
+		return nil, nil
+	}
+	return metadata.Indexes, nil
+}
+
+// restoreIndexesOnly creates the indexes of the intent's collection in the
+// dump that its existing collection is missing, for --indexesOnly. No
+// documents are restored, and collections that do not exist are skipped.
+func (restore *MongoRestore) restoreIndexesOnly(intent *intents.Intent) Result {
+	exists, err := restore.CollectionExists(intent)
+	if err != nil {
+		return Result{Err: fmt.Errorf("error reading database: %w", err)}
+	}
+	if !exists {
+		log.Logvf(log.Always, "collection %v does not exist, skipping its indexes", intent.Namespace())
+		return Result{}
+	}
+
+	dumped, err := restore.dumpedIndexes(intent)
+	if err != nil {
+		return Result{Err: err}
+	}
+	existing, err := restore.existingIndexes(intent)
+	if err != nil {
+		return Result{Err: fmt.Errorf("error listing indexes of %v: %w", intent.Namespace(), err)}
+	}
+	missing, present := missingIndexes(dumped, existing)
+
+	var created []string
+	if len(missing) > 0 {
+		if restore.OutputOptions.ConvertLegacyIndexes {
+			missing = restore.convertLegacyIndexes(missing, intent.Namespace())
+		}
+		if restore.OutputOptions.FixDottedHashedIndexes {
+			fixDottedHashedIndexes(missing)
+		}
+		// indexes without a collation of their own need the simple collation
+		// on a collection with a default collation
+		collation, err := restore.existingCollation(intent)
+		if err != nil {
+			return Result{Err: fmt.Errorf("error reading the collation of %v: %w", intent.Namespace(), err)}
+		}
+		for _, index := range missing {
+			created = append(created, index.Options["name"].(string))
+		}
+		indexStart := time.Now()
+		err = restore.CreateIndexes(intent.DB, intent.C, missing, collation != nil)
+		restore.summary.recordIndexBuild(intent.Namespace(), time.Since(indexStart))
+		if err != nil {
+			return Result{Err: fmt.Errorf("error creating indexes for %v: %w", intent.Namespace(), err)}
+		}
+	}
+
+	log.Logvf(log.Always, "indexes of %v: %v created [%v], %v already existed [%v]", intent.Namespace(),
+		len(created), strings.Join(created, ", "), len(present), strings.Join(present, ", "))
+	return Result{}
+}
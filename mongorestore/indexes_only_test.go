@@ -0,0 +1,67 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMissingIndexes(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	index := func(name string, key bson.D) IndexDocument {
+		return IndexDocument{Options: bson.M{"name": name}, Key: key}
+	}
+
+	Convey("With indexes in the dump and on the existing collection", t, func() {
+		dumped := []IndexDocument{
+			index("_id_", bson.D{{Key: "_id", Value: int32(1)}}),
+			index("a_1", bson.D{{Key: "a", Value: int32(1)}}),
+			index("b_1_c_-1", bson.D{{Key: "b", Value: int32(1)}, {Key: "c", Value: int32(-1)}}),
+			index("c_1_b_-1", bson.D{{Key: "c", Value: int32(1)}, {Key: "b", Value: int32(-1)}}),
+			index("text", bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: int32(1)}}),
+		}
+		existing := []IndexDocument{
+			index("_id_", bson.D{{Key: "_id", Value: int32(1)}}),
+			index("a_1", bson.D{{Key: "a", Value: int32(1)}}),
+			// the same key pattern under another name, with other number types
+			index("bc", bson.D{{Key: "b", Value: 1.0}, {Key: "c", Value: int64(-1)}}),
+		}
+
+		Convey("indexes are matched by name or by key pattern", func() {
+			missing, present := missingIndexes(dumped, existing)
+			So(present, ShouldResemble, []string{"_id_", "a_1", "b_1_c_-1 (as bc)"})
+			So(missing, ShouldHaveLength, 2)
+			So(missing[0].Options["name"], ShouldEqual, "c_1_b_-1")
+			So(missing[1].Options["name"], ShouldEqual, "text")
+		})
+
+		Convey("all indexes are missing from a collection without indexes", func() {
+			missing, present := missingIndexes(dumped, nil)
+			So(present, ShouldBeEmpty)
+			So(missing, ShouldResemble, dumped)
+		})
+	})
+}
+
+func TestIndexesOnlySkipsUsersAndRoles(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("A full restore with --indexesOnly should not restore users and roles", t, func() {
+		restore := &MongoRestore{
+			ToolOptions:   &options.ToolOptions{Namespace: &options.Namespace{}},
+			InputOptions:  &InputOptions{RestoreDBUsersAndRoles: true},
+			OutputOptions: &OutputOptions{IndexesOnly: true},
+		}
+		So(restore.ShouldRestoreUsersAndRoles(), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,217 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// lagCheckInterval is how often the replication lag of the target is checked
+// with --maxLagSeconds.
+const lagCheckInterval = 2 * time.Second
+
+// replSetMember is a member in the output of replSetGetStatus.
+type replSetMember struct {
+	Name       string    `bson:"name"`
+	State      int       `bson:"state"`
+	Health     float64   `bson:"health"`
+	OptimeDate time.Time `bson:"optimeDate"`
+}
+
+// Replica set member states, see replSetGetStatus.
+const (
+	replSetStatePrimary   = 1
+	replSetStateSecondary = 2
+)
+
+// replicationLag returns how far the furthest behind healthy secondary, other
+// than the delayed ones, is behind the primary, and its name. It returns
+// false if there is no primary.
+func replicationLag(members []replSetMember, delayed map[string]bool) (time.Duration, string, bool) {
+	var primary *replSetMember
+	for i := range members {
+		if members[i].State == replSetStatePrimary {
+			primary = &members[i]
+		}
+	}
+	if primary == nil {
+		return 0, "", false
+	}
+
+	var lag time.Duration
+	var behind string
+	for _, member := range members {
+		if member.State != replSetStateSecondary || member.Health != 1 || delayed[member.Name] {
+			continue
+		}
+		if memberLag := primary.OptimeDate.Sub(member.OptimeDate); memberLag > lag {
+			lag, behind = memberLag, member.Name
+		}
+	}
+	return lag, behind, true
+}
+
+// lagMonitor pauses insertions while the replication lag of the target
+// exceeds --maxLagSeconds, and resumes them once it falls to half of that,
+// so that a restore does not starve replication. A nil lagMonitor never
+// pauses.
+type lagMonitor struct {
+	maxLag  time.Duration
+	client  *mongo.Client
+	delayed map[string]bool
+
+	mu sync.Mutex
+	// resumed is closed unless insertions are paused
+	resumed chan struct{}
+	paused  bool
+
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// startLagMonitor checks the replication lag of the target, and keeps
+// checking it every lagCheckInterval until the monitor is stopped.
+func (restore *MongoRestore) startLagMonitor() (*lagMonitor, error) {
+	if restore.isMongos {
+		return nil, fmt.Errorf("--maxLagSeconds requires connecting to a replica set, not a mongos")
+	}
+	client, err := restore.SessionProvider.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	m := &lagMonitor{
+		maxLag:  time.Duration(restore.OutputOptions.MaxLagSeconds) * time.Second,
+		client:  client,
+		resumed: make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	close(m.resumed)
+
+	if m.delayed, err = delayedMembers(client); err != nil {
+		log.Logvf(log.Always, "warning: could not read the replica set config to ignore delayed members "+
+			"for --maxLagSeconds: %v", err)
+	}
+	if err = m.check(); err != nil {
+		return nil, fmt.Errorf("error checking replication lag for --maxLagSeconds: %v", err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(lagCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stopped:
+				return
+			case <-ticker.C:
+				if err := m.check(); err != nil {
+					log.Logvf(log.Info, "error checking replication lag: %v", err)
+				}
+			}
+		}
+	}()
+	return m, nil
+}
+
+// delayedMembers returns the names of the delayed members of the replica set,
+// whose lag is intended.
+func delayedMembers(client *mongo.Client) (map[string]bool, error) {
+	var config struct {
+		Config struct {
+			Members []struct {
+				Host               string `bson:"host"`
+				SecondaryDelaySecs int64  `bson:"secondaryDelaySecs"`
+				SlaveDelay         int64  `bson:"slaveDelay"`
+			} `bson:"members"`
+		} `bson:"config"`
+	}
+	err := client.Database("admin").RunCommand(nil, bson.D{{Key: "replSetGetConfig", Value: 1}}).Decode(&config)
+	if err != nil {
+		return nil, err
+	}
+	delayed := map[string]bool{}
+	for _, member := range config.Config.Members {
+		if member.SecondaryDelaySecs > 0 || member.SlaveDelay > 0 {
+			delayed[member.Host] = true
+		}
+	}
+	return delayed, nil
+}
+
+// check reads the replication lag of the target, and pauses or resumes
+// insertions accordingly.
+func (m *lagMonitor) check() error {
+	var status struct {
+		Members []replSetMember `bson:"members"`
+	}
+	err := m.client.Database("admin").RunCommand(nil, bson.D{{Key: "replSetGetStatus", Value: 1}}).Decode(&status)
+	if err != nil {
+		return err
+	}
+	lag, behind, ok := replicationLag(status.Members, m.delayed)
+	if !ok {
+		return fmt.Errorf("the replica set has no primary")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case !m.paused && lag > m.maxLag:
+		log.Logvf(log.Always, "pausing inserts: %v is %v behind the primary, more than --maxLagSeconds %v",
+			behind, lag, m.maxLag.Seconds())
+		m.paused = true
+		m.resumed = make(chan struct{})
+	case m.paused && lag <= m.maxLag/2:
+		log.Logvf(log.Always, "resuming inserts: replication lag is down to %v", lag)
+		m.resume()
+	}
+	return nil
+}
+
+// resume lets paused insertions continue. The caller must hold m.mu.
+func (m *lagMonitor) resume() {
+	if m.paused {
+		m.paused = false
+		close(m.resumed)
+	}
+}
+
+// wait blocks while insertions are paused, until ctx is done or the monitor
+// is stopped.
+func (m *lagMonitor) wait(ctx context.Context) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	resumed := m.resumed
+	m.mu.Unlock()
+	select {
+	case <-resumed:
+	case <-ctx.Done():
+	case <-m.stopped:
+	}
+}
+
+// stop stops checking the replication lag, and lets any paused insertions
+// continue.
+func (m *lagMonitor) stop() {
+	if m == nil {
+		return
+	}
+	m.stopOnce.Do(func() {
+		close(m.stopped)
+		m.mu.Lock()
+		m.resume()
+		m.mu.Unlock()
+	})
+}
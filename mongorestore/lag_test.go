@@ -0,0 +1,92 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReplicationLag(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	now := time.Date(2020, 10, 19, 8, 30, 0, 0, time.UTC)
+	member := func(name string, state int, health float64, behind time.Duration) replSetMember {
+		return replSetMember{Name: name, State: state, Health: health, OptimeDate: now.Add(-behind)}
+	}
+
+	Convey("The lag is that of the furthest behind healthy secondary", t, func() {
+		members := []replSetMember{
+			member("a:27017", replSetStatePrimary, 1, 0),
+			member("b:27017", replSetStateSecondary, 1, 3*time.Second),
+			member("c:27017", replSetStateSecondary, 1, 12*time.Second),
+			// down, recovering and delayed members are ignored
+			member("d:27017", replSetStateSecondary, 0, time.Hour),
+			member("e:27017", 3, 1, time.Hour),
+			member("f:27017", replSetStateSecondary, 1, time.Hour),
+		}
+		lag, behind, ok := replicationLag(members, map[string]bool{"f:27017": true})
+		So(ok, ShouldBeTrue)
+		So(lag, ShouldEqual, 12*time.Second)
+		So(behind, ShouldEqual, "c:27017")
+	})
+
+	Convey("There is no lag without secondaries, and no lag to measure without a primary", t, func() {
+		lag, _, ok := replicationLag([]replSetMember{member("a:27017", replSetStatePrimary, 1, 0)}, nil)
+		So(ok, ShouldBeTrue)
+		So(lag, ShouldEqual, 0)
+
+		_, _, ok = replicationLag([]replSetMember{member("b:27017", replSetStateSecondary, 1, 0)}, nil)
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestLagMonitorWait(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a paused lag monitor", t, func() {
+		m := &lagMonitor{paused: true, resumed: make(chan struct{}), stopped: make(chan struct{})}
+
+		waited := func() bool {
+			done := make(chan struct{})
+			go func() {
+				m.wait(context.Background())
+				close(done)
+			}()
+			select {
+			case <-done:
+				return true
+			case <-time.After(50 * time.Millisecond):
+				return false
+			}
+		}
+
+		Convey("insertions wait until they are resumed", func() {
+			So(waited(), ShouldBeFalse)
+			m.mu.Lock()
+			m.resume()
+			m.mu.Unlock()
+			So(waited(), ShouldBeTrue)
+		})
+
+		Convey("stopping the monitor lets insertions continue", func() {
+			m.stop()
+			So(waited(), ShouldBeTrue)
+			m.stop()
+		})
+
+		Convey("without a monitor insertions never wait", func() {
+			var none *lagMonitor
+			none.wait(context.Background())
+			none.stop()
+		})
+	})
+}
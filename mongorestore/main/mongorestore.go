@@ -8,7 +8,11 @@
 package main
 
 import (
+	"github.com/mongodb/mongo-tools/common/completion"
+	"github.com/mongodb/mongo-tools/common/exitcode"
+	"github.com/mongodb/mongo-tools/common/healthcheck"
 	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/runmanifest"
 	"github.com/mongodb/mongo-tools/common/signals"
 	"github.com/mongodb/mongo-tools/common/util"
 	"github.com/mongodb/mongo-tools/mongorestore"
@@ -27,7 +31,7 @@ func main() {
 	if err != nil {
 		log.Logvf(log.Always, "error parsing command line options: %s", err.Error())
 		log.Logvf(log.Always, util.ShortUsage("mongorestore"))
-		os.Exit(util.ExitFailure)
+		os.Exit(util.ExitValidationFailure)
 	}
 
 	// print help or version info, if specified
@@ -39,10 +43,42 @@ func main() {
 		return
 	}
 
+	// print the effective config, if specified
+	if opts.PrintEffectiveConfig() {
+		return
+	}
+
+	// generate shell completions, if requested
+	if _, ok := opts.CompletionArgs(); ok {
+		os.Exit(completion.Main(opts.ToolOptions))
+	}
+
+	// check the connection, credentials and privileges without running
+	if opts.HealthCheck {
+		os.Exit(healthcheck.Main(*opts.ToolOptions, opts.HealthCheckRequirements()))
+	}
+
+	run, err := runmanifest.Begin(opts.RunManifest, "mongorestore", util.SanitizeURI(opts.URI.ConnectionString), map[string]interface{}{
+		"namespace": opts.Namespace,
+		"input":     opts.InputOptions,
+		"ns":        opts.NSOptions,
+		"output":    opts.OutputOptions,
+		"target":    opts.TargetDirectory,
+	})
+	if err == runmanifest.ErrAlreadyApplied {
+		log.Logvf(log.Always, "%v", err)
+		return
+	}
+	if err != nil {
+		log.Logvf(log.Always, "Failed: %v", err)
+		os.Exit(util.ExitFailure)
+	}
+
 	restore, err := mongorestore.New(opts)
 	if err != nil {
 		log.Logvf(log.Always, err.Error())
-		os.Exit(util.ExitFailure)
+		run.Abandon()
+		os.Exit(exitcode.Of(err))
 	}
 	defer restore.Close()
 
@@ -50,18 +86,48 @@ func main() {
 	defer close(finishedChan)
 
 	result := restore.Restore()
+	if finishErr := run.Finish(result.Err); finishErr != nil {
+		log.Logvf(log.Always, "error recording run: %v", finishErr)
+	}
 	if result.Err != nil {
 		log.Logvf(log.Always, "Failed: %v", result.Err)
 	}
 
 	if restore.ToolOptions.WriteConcern.Acknowledged() {
 		log.Logvf(log.Always, "%v document(s) restored successfully. %v document(s) failed to restore.", result.Successes, result.Failures)
+		if result.Skipped > 0 {
+			log.Logvf(log.Always, "%v document(s) larger than --maxDocSize were skipped.", result.Skipped)
+		}
 	} else {
 		log.Logvf(log.Always, "done")
 	}
 
+	summary := restore.Summary()
+	if len(summary.Namespaces()) > 0 {
+		log.Logvf(log.Always, "restore summary:\n%v", summary.Grid())
+	}
+	if restore.OutputOptions.SummaryJSON != "" {
+		if err = summary.WriteJSON(restore.OutputOptions.SummaryJSON); err != nil {
+			log.Logvf(log.Always, "error writing restore summary: %v", err)
+			os.Exit(util.ExitFailure)
+		}
+	}
+	if result.Err != nil && restore.OutputOptions.FailuresFile != "" &&
+		(len(summary.Failures()) > 0 || len(summary.NotRestored()) > 0) {
+		if err = summary.WriteFailures(restore.OutputOptions.FailuresFile); err != nil {
+			log.Logvf(log.Always, "error writing restore failures: %v", err)
+		} else {
+			log.Logvf(log.Always, "wrote the namespaces that were not restored to %v", restore.OutputOptions.FailuresFile)
+		}
+	}
+
 	if result.Err != nil {
-		os.Exit(util.ExitFailure)
+		// documents and namespaces restored before the error are not rolled
+		// back
+		if result.Successes > 0 || summary.Completed() > 0 {
+			result.Err = exitcode.Partial(result.Err)
+		}
+		os.Exit(exitcode.Of(result.Err))
 	}
 	os.Exit(util.ExitSuccess)
 }
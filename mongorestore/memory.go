@@ -0,0 +1,82 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"context"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// memoryBudget limits the total size of the documents that have been read
+// but not yet inserted, across all collections being restored, so that the
+// file readers wait for insertions to catch up. A nil memoryBudget is
+// unlimited.
+//
+// The documents buffered by insertion workers that are waiting for more
+// input may hold at most half of the budget, as each worker flushes its
+// batch early once it reaches its share of that half. The other half always
+// remains available to the readers, so that a restore cannot stall with the
+// whole budget held by partial batches.
+type memoryBudget struct {
+	limit    int64
+	batchCap int64
+	sem      *semaphore.Weighted
+}
+
+// newMemoryBudget returns a budget of limit bytes shared by the given number
+// of insertion workers.
+func newMemoryBudget(limit int64, workers int) *memoryBudget {
+	if workers < 1 {
+		workers = 1
+	}
+	batchCap := limit / 2 / int64(workers)
+	if batchCap < 1 {
+		batchCap = 1
+	}
+	return &memoryBudget{limit: limit, batchCap: batchCap, sem: semaphore.NewWeighted(limit)}
+}
+
+// cost returns the part of the budget taken up by a document of the given
+// size. A document larger than the half of the budget left to the readers
+// takes up all of that half, so that it can still be read.
+func (b *memoryBudget) cost(size int) int64 {
+	if b == nil {
+		return 0
+	}
+	half := b.limit / 2
+	if half < 1 {
+		half = 1
+	}
+	if cost := int64(size); cost < half {
+		return cost
+	}
+	return half
+}
+
+// reserve waits until cost bytes of the budget are available and takes them.
+// It returns an error only if ctx is done first.
+func (b *memoryBudget) reserve(ctx context.Context, cost int64) error {
+	if b == nil || cost == 0 {
+		return nil
+	}
+	return b.sem.Acquire(ctx, cost)
+}
+
+// release returns cost bytes to the budget.
+func (b *memoryBudget) release(cost int64) {
+	if b == nil || cost == 0 {
+		return
+	}
+	b.sem.Release(cost)
+}
+
+// batchFull reports whether an insertion worker buffering pending bytes of
+// the budget should flush its batch early.
+func (b *memoryBudget) batchFull(pending int64) bool {
+	return b != nil && pending >= b.batchCap
+}
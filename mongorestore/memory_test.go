@@ -0,0 +1,53 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a memory budget of 1000 bytes shared by 5 insertion workers", t, func() {
+		budget := newMemoryBudget(1000, 5)
+
+		Convey("documents cost their size, up to half of the budget", func() {
+			So(budget.cost(100), ShouldEqual, 100)
+			So(budget.cost(4000), ShouldEqual, 500)
+		})
+
+		Convey("each worker flushes once its batch holds its share of half of the budget", func() {
+			So(budget.batchFull(99), ShouldBeFalse)
+			So(budget.batchFull(100), ShouldBeTrue)
+		})
+
+		Convey("readers wait until enough of the budget is released", func() {
+			So(budget.reserve(context.Background(), 800), ShouldBeNil)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			So(budget.reserve(ctx, 300), ShouldNotBeNil)
+
+			budget.release(800)
+			So(budget.reserve(context.Background(), 300), ShouldBeNil)
+		})
+	})
+
+	Convey("Without a memory budget nothing is limited", t, func() {
+		var budget *memoryBudget
+		So(budget.cost(1<<30), ShouldEqual, 0)
+		So(budget.reserve(context.Background(), budget.cost(1<<30)), ShouldBeNil)
+		So(budget.batchFull(1<<30), ShouldBeFalse)
+		budget.release(0)
+	})
+}
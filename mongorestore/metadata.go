@@ -36,12 +36,35 @@ type authVersionPair struct {
 
 // Metadata holds information about a collection's options and indexes.
 type Metadata struct {
-	Options        bson.D          `bson:"options,omitempty"`
-	Indexes        []IndexDocument `bson:"indexes"`
-	UUID           string          `bson:"uuid"`
-	CollectionName string          `bson:"collectionName"`
+	Options        bson.D             `bson:"options,omitempty"`
+	Indexes        []IndexDocument    `bson:"indexes"`
+	UUID           string             `bson:"uuid"`
+	CollectionName string             `bson:"collectionName"`
+	ShardKey       *ShardKey          `bson:"shardKey,omitempty"`
+	Chunks         *ChunkDistribution `bson:"chunks,omitempty"`
+	Zones          []ZoneRange        `bson:"zones,omitempty"`
 }
 
+// ShardKey holds the shard key of a sharded collection, as written to the
+// metadata by mongodump --dumpShardKeys.
+type ShardKey struct {
+	Key    bson.D `bson:"key"`
+	Unique bool   `bson:"unique,omitempty"`
+}
+
+// String returns the shard key pattern as relaxed extended JSON.
+func (shardKey *ShardKey) String() string {
+	out, err := bson.MarshalExtJSON(shardKey.Key, false, false)
+	if err != nil {
+		return fmt.Sprintf("%v", shardKey.Key)
+	}
+	return string(out)
+}
+
+// alreadyInitializedErrorCode is returned by enableSharding on some server
+// versions when sharding is already enabled for the database.
+const alreadyInitializedErrorCode = 23
+
 // IndexDocument holds information about a collection's index.
 type IndexDocument struct {
 	Options                 bson.M `bson:",inline"`
@@ -260,6 +283,41 @@ func (restore *MongoRestore) CreateCollection(intent *intents.Intent, options bs
 
 }
 
+// ShardCollection enables sharding for the intent's database and shards its
+// collection with the given shard key. The collection must still be empty.
+// If the collection has a non-simple default collation, the shard key index
+// is created with the simple collation, as the server requires.
+func (restore *MongoRestore) ShardCollection(intent *intents.Intent, shardKey *ShardKey, hasNonSimpleCollation bool) error {
+	session, err := restore.SessionProvider.GetSession()
+	if err != nil {
+		return fmt.Errorf("error establishing connection: %v", err)
+	}
+	admin := session.Database("admin")
+
+	err = admin.RunCommand(nil, bson.D{{Key: "enableSharding", Value: intent.DB}}).Err()
+	if cmdErr, ok := err.(mongo.CommandError); ok && cmdErr.Code == alreadyInitializedErrorCode {
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("error enabling sharding for database %v: %v", intent.DB, err)
+	}
+
+	command := bson.D{
+		{Key: "shardCollection", Value: intent.Namespace()},
+		{Key: "key", Value: shardKey.Key},
+	}
+	if shardKey.Unique {
+		command = append(command, bson.E{Key: "unique", Value: true})
+	}
+	if hasNonSimpleCollation {
+		command = append(command, bson.E{Key: "collation", Value: bson.D{{Key: "locale", Value: "simple"}}})
+	}
+	if err = admin.RunCommand(nil, command).Err(); err != nil {
+		return fmt.Errorf("error running shardCollection command: %v", err)
+	}
+	return nil
+}
+
 // UpdateAutoIndexId updates {autoIndexId: false} to {autoIndexId: true} if the server version is
 // >= 4.0 and the database is not `local`.
 func (restore *MongoRestore) UpdateAutoIndexId(options bson.D) {
@@ -281,7 +339,7 @@ func (restore *MongoRestore) createCollectionWithCommand(session *mongo.Client,
 	// If there is no error, the result doesnt matter
 	singleRes := session.Database(intent.DB).RunCommand(nil, command, nil)
 	if err := singleRes.Err(); err != nil {
-		return fmt.Errorf("error running create command: %v", err)
+		return fmt.Errorf("error running create command: %w", err)
 	}
 
 	res := bson.M{}
@@ -297,10 +355,11 @@ func (restore *MongoRestore) createCollectionWithApplyOps(session *mongo.Client,
 	restore.UpdateAutoIndexId(options)
 
 	command := createCollectionCommand(intent, options)
-	uuid, err := hex.DecodeString(uuidHex)
+	uuid, err := parseCollectionUUID(uuidHex)
 	if err != nil {
 		return fmt.Errorf("Couldn't restore UUID because UUID was invalid: %s", err)
 	}
+	log.Logvf(log.DebugLow, "creating collection %v with UUID %v", intent.Namespace(), uuidHex)
 
 	createOp := struct {
 		Operation string            `bson:"op"`
@@ -311,12 +370,25 @@ func (restore *MongoRestore) createCollectionWithApplyOps(session *mongo.Client,
 		Operation: "c",
 		Namespace: intent.DB + ".$cmd",
 		Object:    command,
-		UI:        &primitive.Binary{Subtype: 0x04, Data: uuid},
+		UI:        uuid,
 	}
 
 	return restore.ApplyOps(session, []interface{}{createOp})
 }
 
+// parseCollectionUUID parses a collection UUID from the hex string stored in
+// metadata files.
+func parseCollectionUUID(uuidHex string) (*primitive.Binary, error) {
+	uuid, err := hex.DecodeString(uuidHex)
+	if err != nil {
+		return nil, err
+	}
+	if len(uuid) != 16 {
+		return nil, fmt.Errorf("expected 16 bytes but found %v", len(uuid))
+	}
+	return &primitive.Binary{Subtype: 0x04, Data: uuid}, nil
+}
+
 func createCollectionCommand(intent *intents.Intent, options bson.D) bson.D {
 	return append(bson.D{{"create", intent.C}}, options...)
 }
@@ -598,7 +670,8 @@ func (restore *MongoRestore) ValidateAuthVersions() error {
 // ShouldRestoreUsersAndRoles returns true if mongorestore should go through
 // through the process of restoring collections pertaining to authentication.
 func (restore *MongoRestore) ShouldRestoreUsersAndRoles() bool {
-	if restore.SkipUsersAndRoles {
+	// --indexesOnly restores no documents, users and roles included
+	if restore.SkipUsersAndRoles || restore.OutputOptions.IndexesOnly {
 		return false
 	}
 	// If the user has done anything that would indicate the restoration
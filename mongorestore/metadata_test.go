@@ -231,3 +231,77 @@ func readCollationTestData(filename string) (bson.D, error) {
 	}
 	return data, nil
 }
+
+func TestMetadataShardKey(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	restore := &MongoRestore{}
+
+	Convey("Metadata written with --dumpShardKeys includes the shard key", t, func() {
+		meta, err := restore.MetadataFromJSON([]byte(`{"indexes":[],"collectionName":"users",` +
+			`"shardKey":{"key":{"tenant":1,"_id":"hashed"},"unique":true}}`))
+		So(err, ShouldBeNil)
+		So(meta.ShardKey, ShouldNotBeNil)
+		So(meta.ShardKey.Key, ShouldResemble, bson.D{{"tenant", int32(1)}, {"_id", "hashed"}})
+		So(meta.ShardKey.Unique, ShouldBeTrue)
+		So(meta.ShardKey.String(), ShouldEqual, `{"tenant":1,"_id":"hashed"}`)
+	})
+
+	Convey("Metadata of unsharded collections has no shard key", t, func() {
+		meta, err := restore.MetadataFromJSON([]byte(`{"indexes":[],"collectionName":"users"}`))
+		So(err, ShouldBeNil)
+		So(meta.ShardKey, ShouldBeNil)
+	})
+}
+
+func TestMetadataChunkDistribution(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	restore := &MongoRestore{}
+
+	Convey("Metadata written with --dumpChunkDistribution gives the split points and zones", t, func() {
+		meta, err := restore.MetadataFromJSON([]byte(`{"indexes":[],"collectionName":"users",` +
+			`"shardKey":{"key":{"x":1}},` +
+			`"chunks":{"count":3,"shards":[{"shard":"shard0","chunks":1},{"shard":"shard1","chunks":2}],"ranges":[` +
+			`{"min":{"x":{"$minKey":1}},"max":{"x":0},"shard":"shard1"},` +
+			`{"min":{"x":0},"max":{"x":100},"shard":"shard0"},` +
+			`{"min":{"x":100},"max":{"x":{"$maxKey":1}},"shard":"shard1"}]},` +
+			`"zones":[{"zone":"EU","min":{"x":0},"max":{"x":100},"shards":["shard0"]}]}`))
+		So(err, ShouldBeNil)
+		So(meta.Chunks, ShouldNotBeNil)
+		So(meta.Chunks.Ranges, ShouldHaveLength, 3)
+		So(meta.Chunks.Ranges[1].Shard, ShouldEqual, "shard0")
+		So(splitPoints(meta.Chunks.Ranges), ShouldResemble, []bson.D{{{"x", int32(0)}}, {{"x", int32(100)}}})
+		So(meta.Zones, ShouldResemble, []ZoneRange{
+			{Zone: "EU", Min: bson.D{{"x", int32(0)}}, Max: bson.D{{"x", int32(100)}}, Shards: []string{"shard0"}},
+		})
+	})
+
+	Convey("A collection with a single chunk has no split points", t, func() {
+		So(splitPoints([]ChunkRange{{Shard: "shard0"}}), ShouldBeEmpty)
+		So(splitPoints(nil), ShouldBeEmpty)
+	})
+}
+
+func TestParseCollectionUUID(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	restore := &MongoRestore{}
+
+	Convey("A UUID from metadata should be parsed as a binary UUID", t, func() {
+		meta, err := restore.MetadataFromJSON([]byte(`{"indexes":[],"uuid":"699f503df64b4aa8a484a8052046fa3a"}`))
+		So(err, ShouldBeNil)
+		uuid, err := parseCollectionUUID(meta.UUID)
+		So(err, ShouldBeNil)
+		So(uuid.Subtype, ShouldEqual, 0x04)
+		So(uuid.Data, ShouldHaveLength, 16)
+		So(fmt.Sprintf("%x", uuid.Data), ShouldEqual, meta.UUID)
+	})
+
+	Convey("Invalid UUIDs should be rejected", t, func() {
+		_, err := parseCollectionUUID("not hex")
+		So(err, ShouldNotBeNil)
+		_, err = parseCollectionUUID("699f503d")
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -20,10 +20,12 @@ import (
 	"github.com/mongodb/mongo-tools/common/archive"
 	"github.com/mongodb/mongo-tools/common/auth"
 	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/exitcode"
 	"github.com/mongodb/mongo-tools/common/intents"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/text"
 	"github.com/mongodb/mongo-tools/common/util"
 	"github.com/mongodb/mongo-tools/mongorestore/ns"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -87,6 +89,23 @@ type MongoRestore struct {
 
 	// Server version for version-specific behavior
 	serverVersion db.Version
+
+	// per-namespace results reported once the restore finishes
+	summary *RestoreSummary
+
+	// system collections selected with --restoreSystemCollections
+	systemCollections map[string]bool
+
+	// limit on the documents buffered for insertion, set with --maxMemory
+	memoryBudget *memoryBudget
+
+	// pauses insertions while the replication lag is high, with --maxLagSeconds;
+	// guarded by lagMonitorMutex, as HandleInterrupt may stop it at any time
+	lagMonitor      *lagMonitor
+	lagMonitorMutex sync.Mutex
+
+	// handling of documents larger than --maxDocSize, if set
+	oversize *oversizeHandler
 }
 
 type collectionIndexes map[string][]IndexDocument
@@ -95,7 +114,7 @@ type collectionIndexes map[string][]IndexDocument
 func New(opts Options) (*MongoRestore, error) {
 	provider, err := db.NewSessionProvider(*opts.ToolOptions)
 	if err != nil {
-		return nil, fmt.Errorf("error connecting to host: %v", err)
+		return nil, fmt.Errorf("error connecting to host: %w", err)
 	}
 
 	serverVersion, err := provider.ServerVersionArray()
@@ -117,6 +136,7 @@ func New(opts Options) (*MongoRestore, error) {
 		ProgressManager: progressManager,
 		serverVersion:   serverVersion,
 		terminate:       false,
+		summary:         newRestoreSummary(),
 	}
 	return restore, nil
 }
@@ -144,6 +164,9 @@ func SupportsCollectionUUID(sp *db.SessionProvider) (bool, error) {
 // Close ends any connections and cleans up other internal state.
 func (restore *MongoRestore) Close() {
 	restore.SessionProvider.Close()
+	if err := restore.oversize.Close(); err != nil {
+		log.Logvf(log.Always, "error closing --oversizeLog: %v", err)
+	}
 	barWriter, ok := restore.ProgressManager.(*progress.BarWriter)
 	if ok { // should always be ok
 		barWriter.Stop()
@@ -191,6 +214,11 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 	}
 	if restore.isMongos {
 		log.Logv(log.DebugLow, "restoring to a sharded system")
+	} else if restore.OutputOptions.CreateShardedCollections {
+		return fmt.Errorf("cannot use --createShardedCollections unless connected to a mongos")
+	}
+	if restore.OutputOptions.PreSplitChunks && !restore.OutputOptions.CreateShardedCollections {
+		return fmt.Errorf("cannot use --preSplitChunks without --createShardedCollections")
 	}
 
 	if restore.InputOptions.OplogLimit != "" {
@@ -218,6 +246,9 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 	}
 
 	log.Logvf(log.DebugLow, "connected to node type: %v", nodeType)
+	if err = restore.validateTransactionOptions(nodeType); err != nil {
+		return err
+	}
 
 	// deprecations with --nsInclude --nsExclude
 	if restore.ToolOptions.Namespace.DB != "" || restore.ToolOptions.Namespace.Collection != "" {
@@ -243,6 +274,11 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 		}
 	}
 
+	restore.systemCollections, err = parseSystemCollections(restore.OutputOptions.RestoreSystemCollections)
+	if err != nil {
+		return fmt.Errorf("invalid %v: %v", RestoreSystemCollectionsOption, err)
+	}
+
 	includes := restore.NSOptions.NSInclude
 	if restore.ToolOptions.Namespace.DB != "" && restore.ToolOptions.Namespace.Collection != "" {
 		includes = append(includes, ns.Escape(restore.ToolOptions.Namespace.DB)+"."+
@@ -294,10 +330,74 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 		restore.OutputOptions.NumInsertionWorkers = 1
 	}
 
+	if restore.OutputOptions.MaxMemory != "" {
+		limit, err := text.ParseByteAmount(restore.OutputOptions.MaxMemory)
+		if err != nil {
+			return fmt.Errorf("invalid --maxMemory: %v", err)
+		}
+		workers := restore.OutputOptions.NumParallelCollections * restore.OutputOptions.NumInsertionWorkers
+		restore.memoryBudget = newMemoryBudget(limit, workers)
+	}
+
+	if restore.OutputOptions.MaxLagSeconds < 0 {
+		return fmt.Errorf("--maxLagSeconds must not be negative")
+	}
+
+	if restore.OutputOptions.MaxDocSize != "" {
+		maxSize, err := text.ParseByteAmount(restore.OutputOptions.MaxDocSize)
+		if err != nil {
+			return fmt.Errorf("invalid --maxDocSize: %v", err)
+		}
+		if maxSize > db.MaxBSONSize {
+			return fmt.Errorf("--maxDocSize cannot be larger than the maximum document size of %v bytes", db.MaxBSONSize)
+		}
+		restore.oversize = &oversizeHandler{
+			maxSize: int(maxSize),
+			action:  restore.OutputOptions.OversizeAction,
+			logPath: restore.OutputOptions.OversizeLog,
+		}
+	} else if restore.OutputOptions.OversizeLog != "" {
+		return fmt.Errorf("cannot specify --oversizeLog without --maxDocSize")
+	} else if action := restore.OutputOptions.OversizeAction; action != "" && action != OversizeSkip {
+		return fmt.Errorf("cannot specify --oversizeAction without --maxDocSize")
+	}
+
+	if restore.OutputOptions.IndexesOnly {
+		switch {
+		case restore.OutputOptions.NoIndexRestore:
+			return fmt.Errorf("cannot specify both --indexesOnly and --noIndexRestore")
+		case restore.OutputOptions.Drop:
+			return fmt.Errorf("cannot specify --drop with --indexesOnly, which only adds indexes to existing collections")
+		case restore.InputOptions.OplogReplay:
+			return fmt.Errorf("cannot specify --oplogReplay with --indexesOnly")
+		case restore.InputOptions.Archive != "":
+			return fmt.Errorf("cannot specify --archive with --indexesOnly; restore indexes from a dump directory")
+		}
+	}
+
+	if restore.OutputOptions.DataOnly {
+		switch {
+		case restore.OutputOptions.Drop:
+			return fmt.Errorf("cannot specify --drop with --dataOnly; use --truncateTarget to empty existing collections")
+		case restore.OutputOptions.IndexesOnly:
+			return fmt.Errorf("cannot specify both --dataOnly and --indexesOnly")
+		case restore.OutputOptions.CreateShardedCollections:
+			return fmt.Errorf("cannot specify --createShardedCollections with --dataOnly")
+		}
+	} else if restore.OutputOptions.TruncateTarget {
+		return fmt.Errorf("cannot specify --truncateTarget without --dataOnly")
+	}
+
 	if restore.OutputOptions.PreserveUUID {
 		if !restore.OutputOptions.Drop {
 			return fmt.Errorf("cannot specify --preserveUUID without --drop")
 		}
+		// mongos does not accept applyOps, so collections can only be created
+		// with their original UUIDs by restoring to each shard and the config
+		// server directly.
+		if restore.isMongos {
+			return fmt.Errorf("cannot specify --preserveUUID when connected to a mongos; restore to each shard and the config server directly")
+		}
 
 		ok, err := SupportsCollectionUUID(restore.SessionProvider)
 		if err != nil {
@@ -331,7 +431,7 @@ func (restore *MongoRestore) Restore() Result {
 	err := restore.ParseAndValidateOptions()
 	if err != nil {
 		log.Logvf(log.DebugLow, "got error from options parsing: %v", err)
-		return Result{Err: err}
+		return Result{Err: exitcode.Validation(err)}
 	}
 
 	// Build up all intents to be restored
@@ -479,6 +579,17 @@ func (restore *MongoRestore) Restore() Result {
 		return Result{}
 	}
 
+	if restore.OutputOptions.MaxLagSeconds > 0 {
+		monitor, err := restore.startLagMonitor()
+		if err != nil {
+			return Result{Err: err}
+		}
+		defer monitor.stop()
+		restore.lagMonitorMutex.Lock()
+		restore.lagMonitor = monitor
+		restore.lagMonitorMutex.Unlock()
+	}
+
 	demuxFinished := make(chan interface{})
 	var demuxErr error
 	if restore.InputOptions.Archive != "" {
@@ -547,6 +658,19 @@ func (restore *MongoRestore) Restore() Result {
 		return Result{Err: fmt.Errorf("restore error: %v", err)}
 	}
 
+	// record the regular collections to restore, so that any not restored
+	// can be reported
+	for _, intent := range restore.manager.Intents() {
+		if intent.IsSpecialCollection() || intent.IsOplog() {
+			continue
+		}
+		source := intent.Namespace()
+		if sources := restore.manager.SourceNamespaces(source); len(sources) > 0 {
+			source = sources[0]
+		}
+		restore.summary.expect(intent.Namespace(), source)
+	}
+
 	// Restore the regular collections
 	if restore.InputOptions.Archive != "" {
 		restore.manager.UsePrioritizer(restore.archive.Demux.NewPrioritizer(restore.manager))
@@ -622,4 +746,7 @@ func (restore *MongoRestore) getArchiveReader() (rc io.ReadCloser, err error) {
 
 func (restore *MongoRestore) HandleInterrupt() {
 	restore.terminate = true
+	restore.lagMonitorMutex.Lock()
+	defer restore.lagMonitorMutex.Unlock()
+	restore.lagMonitor.stop()
 }
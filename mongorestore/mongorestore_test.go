@@ -10,12 +10,16 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/exitcode"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/testtype"
@@ -1535,3 +1539,112 @@ func TestCreateIndexes(t *testing.T) {
 		})
 	})
 }
+
+func TestRestoreSummary(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With results recorded for two namespaces", t, func() {
+		summary := newRestoreSummary()
+		summary.recordResult("db.b", Result{Successes: 10, Failures: 1, Skipped: 2, Bytes: 2048}, 2*time.Second)
+		summary.recordResult("db.a", Result{Successes: 5, Bytes: 1024}, time.Second)
+		summary.recordIndexBuild("db.a", 500*time.Millisecond)
+
+		Convey("namespaces should be sorted and the totals summed", func() {
+			namespaces := summary.Namespaces()
+			So(len(namespaces), ShouldEqual, 2)
+			So(namespaces[0].Namespace, ShouldEqual, "db.a")
+			So(namespaces[0].IndexBuildTime, ShouldEqual, 500*time.Millisecond)
+			So(namespaces[1].DocumentsPerSecond(), ShouldEqual, 5)
+			So(namespaces[1].BytesPerSecond(), ShouldEqual, 1024)
+
+			total := summary.Total()
+			So(total.Documents, ShouldEqual, 15)
+			So(total.Failures, ShouldEqual, 1)
+			So(total.Skipped, ShouldEqual, 2)
+			So(total.Bytes, ShouldEqual, 3072)
+		})
+
+		Convey("the grid should have a row per namespace and a total row", func() {
+			grid := summary.Grid()
+			So(grid, ShouldContainSubstring, "db.a")
+			So(grid, ShouldContainSubstring, "db.b")
+			So(grid, ShouldContainSubstring, "total")
+		})
+
+		Convey("the JSON summary should report durations in seconds", func() {
+			f, err := ioutil.TempFile("", "summary")
+			So(err, ShouldBeNil)
+			f.Close()
+			defer os.Remove(f.Name())
+
+			So(summary.WriteJSON(f.Name()), ShouldBeNil)
+			data, err := ioutil.ReadFile(f.Name())
+			So(err, ShouldBeNil)
+
+			var report struct {
+				Namespaces []map[string]interface{} `json:"namespaces"`
+				Total      map[string]interface{}   `json:"total"`
+			}
+			So(json.Unmarshal(data, &report), ShouldBeNil)
+			So(len(report.Namespaces), ShouldEqual, 2)
+			So(report.Namespaces[1]["durationSeconds"], ShouldEqual, 2)
+			So(report.Namespaces[0]["indexBuildSeconds"], ShouldEqual, 0.5)
+			So(report.Total["documents"], ShouldEqual, 15)
+			So(report.Total["skipped"], ShouldEqual, 2)
+		})
+	})
+
+	Convey("A nil summary should ignore results", t, func() {
+		var summary *RestoreSummary
+		summary.recordResult("db.a", Result{Successes: 1}, time.Second)
+		So(summary.Namespaces(), ShouldBeEmpty)
+	})
+}
+
+func TestRestoreFailures(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With some namespaces restored, one failed and one not attempted", t, func() {
+		summary := newRestoreSummary()
+		summary.expect("db.ok", "db.ok")
+		summary.expect("db.renamed", "src.orig*")
+		summary.expect("db.later", "db.later")
+		summary.recordResult("db.ok", Result{Successes: 3}, time.Second)
+		summary.recordResult("db.renamed", Result{Successes: 7, Failures: 2,
+			Err: fmt.Errorf("error restoring: %w", exitcode.Connection(errors.New("connection reset")))}, time.Second)
+
+		Convey("the failed and pending namespaces should be reported", func() {
+			So(summary.Completed(), ShouldEqual, 1)
+			So(summary.NotRestored(), ShouldResemble, []string{"db.later"})
+			failures := summary.Failures()
+			So(failures, ShouldHaveLength, 1)
+			So(failures[0].Namespace, ShouldEqual, "db.renamed")
+			So(failures[0].SourceNamespace, ShouldEqual, "src.orig*")
+			So(failures[0].ErrorClass, ShouldEqual, "connection")
+			So(failures[0].LastAppliedPosition, ShouldEqual, 9)
+		})
+
+		Convey("the failures file should list --nsInclude arguments for a rerun", func() {
+			f, err := ioutil.TempFile("", "failures")
+			So(err, ShouldBeNil)
+			f.Close()
+			defer os.Remove(f.Name())
+
+			So(summary.WriteFailures(f.Name()), ShouldBeNil)
+			data, err := ioutil.ReadFile(f.Name())
+			So(err, ShouldBeNil)
+
+			var report struct {
+				Failed      []map[string]interface{} `json:"failed"`
+				NotRestored []string                 `json:"notRestored"`
+				NSInclude   []string                 `json:"nsInclude"`
+			}
+			So(json.Unmarshal(data, &report), ShouldBeNil)
+			So(report.Failed, ShouldHaveLength, 1)
+			So(report.Failed[0]["error"], ShouldEqual, "error restoring: connection reset")
+			So(report.Failed[0]["lastAppliedPosition"], ShouldEqual, 9)
+			So(report.NotRestored, ShouldResemble, []string{"db.later"})
+			So(report.NSInclude, ShouldResemble, []string{"db.later", `src.orig\*`})
+		})
+	})
+}
@@ -8,7 +8,6 @@ package mongorestore
 
 import (
 	"fmt"
-	"strconv"
 	"strings"
 
 	"github.com/mongodb/mongo-tools/common/db"
@@ -252,7 +251,7 @@ Loop:
 func (restore *MongoRestore) ApplyOps(session *mongo.Client, entries []interface{}) error {
 	singleRes := session.Database("admin").RunCommand(nil, bson.D{{"applyOps", entries}})
 	if err := singleRes.Err(); err != nil {
-		return fmt.Errorf("applyOps: %v", err)
+		return fmt.Errorf("applyOps: %w", err)
 	}
 	res := bson.M{}
 	singleRes.Decode(&res)
@@ -273,36 +272,10 @@ func (restore *MongoRestore) TimestampBeforeLimit(ts primitive.Timestamp) bool {
 	return util.TimestampGreaterThan(restore.oplogLimit, ts)
 }
 
-// ParseTimestampFlag takes in a string the form of <time_t>:<ordinal>,
-// where <time_t> is the seconds since the UNIX epoch, and <ordinal> represents
-// a counter of operations in the oplog that occurred in the specified second.
-// It parses this timestamp string and returns a bson.MongoTimestamp type.
+// ParseTimestampFlag takes in a string the form of <time_t>:<ordinal> and
+// returns the corresponding timestamp. See util.ParseTimestampFlag.
 func ParseTimestampFlag(ts string) (primitive.Timestamp, error) {
-	var seconds, increment int
-	timestampFields := strings.Split(ts, ":")
-	if len(timestampFields) > 2 {
-		return primitive.Timestamp{}, fmt.Errorf("too many : characters")
-	}
-
-	seconds, err := strconv.Atoi(timestampFields[0])
-	if err != nil {
-		return primitive.Timestamp{}, fmt.Errorf("error parsing timestamp seconds: %v", err)
-	}
-
-	// parse the increment field if it exists
-	if len(timestampFields) == 2 {
-		if len(timestampFields[1]) > 0 {
-			increment, err = strconv.Atoi(timestampFields[1])
-			if err != nil {
-				return primitive.Timestamp{}, fmt.Errorf("error parsing timestamp increment: %v", err)
-			}
-		} else {
-			// handle the case where the user writes "<time_t>:" with no ordinal
-			increment = 0
-		}
-	}
-
-	return primitive.Timestamp{T: uint32(seconds), I: uint32(increment)}, nil
+	return util.ParseTimestampFlag(ts)
 }
 
 // Server versions 3.6.0-3.6.8 and 4.0.0-4.0.2 require a 'ui' field
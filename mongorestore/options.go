@@ -8,8 +8,10 @@ package mongorestore
 
 import (
 	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/healthcheck"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/runmanifest"
 	"github.com/mongodb/mongo-tools/common/util"
 
 	"fmt"
@@ -33,6 +35,7 @@ type Options struct {
 	*InputOptions
 	*NSOptions
 	*OutputOptions
+	RunManifest     *runmanifest.Options
 	TargetDirectory string
 }
 
@@ -71,6 +74,9 @@ const (
 	DryRunOption                   = "--dryRun"
 	WriteConcernOption             = "--writeConcern"
 	NoIndexRestoreOption           = "--noIndexRestore"
+	IndexesOnlyOption              = "--indexesOnly"
+	DataOnlyOption                 = "--dataOnly"
+	TruncateTargetOption           = "--truncateTarget"
 	ConvertLegacyIndexesOption     = "--convertLegacyIndexes"
 	NoOptionsRestoreOption         = "--noOptionsRestore"
 	KeepIndexVersionOption         = "--keepIndexVersion"
@@ -83,7 +89,12 @@ const (
 	TempUsersCollOption            = "--tempUsersColl"
 	TempRolesCollOption            = "--tempRolesColl"
 	BulkBufferSizeOption           = "--batchSize"
+	UseTransactionsOption          = "--useTransactions"
+	TransactionBatchSizeOption     = "--transactionBatchSize"
 	FixDottedHashedIndexesOption   = "--fixDottedHashIndex"
+	SummaryJSONOption              = "--summaryJson"
+	FailuresFileOption             = "--failuresFile"
+	RestoreSystemCollectionsOption = "--restoreSystemCollections"
 )
 
 // OutputOptions defines the set of options for restoring dump data.
@@ -94,7 +105,11 @@ type OutputOptions struct {
 	// By default mongorestore uses a write concern of 'majority'.
 	WriteConcern             string `long:"writeConcern" value-name:"<write-concern>" default-mask:"-" description:"write concern options e.g. --writeConcern majority, --writeConcern '{w: 3, wtimeout: 500, fsync: true, j: true}'"`
 	NoIndexRestore           bool   `long:"noIndexRestore" description:"don't restore indexes"`
-	ConvertLegacyIndexes     bool   `long:"convertLegacyIndexes" description:"Removes invalid index options and rewrites legacy option values (e.g. true becomes 1)."`
+	IndexesOnly              bool   `long:"indexesOnly" description:"restore no documents, only create the indexes in the metadata of each collection that its existing collection is missing, e.g. after restoring with --noIndexRestore, logging which indexes were created and which already existed; collections that do not exist are skipped"`
+	ConvertLegacyIndexes     bool   `long:"convertLegacyIndexes" description:"Rewrites index specs from old versions that newer servers reject, logging each change: converts legacy key values (e.g. true becomes 1), index versions 0 and 1, geoHaystack indexes (to 2d, on 5.0+) and unsupported text index languages, and removes invalid index options."`
+	DataOnly                 bool   `long:"dataOnly" description:"restore only documents: existing collections keep their options and indexes, and collections that do not exist are created without the options and indexes in the metadata"`
+	TruncateTarget           bool   `long:"truncateTarget" description:"with --dataOnly, empty each existing collection before restoring its documents, according to --truncateMethod, so that indexes added on the target are kept across periodic refreshes"`
+	TruncateMethod           string `long:"truncateMethod" value-name:"<method>" choice:"delete" choice:"recreate" default:"delete" description:"how --truncateTarget empties a collection: delete its documents, or drop it and create it again with the options and indexes it had, which is faster for large collections (defaults to 'delete')"`
 	NoOptionsRestore         bool   `long:"noOptionsRestore" description:"don't restore collection options"`
 	KeepIndexVersion         bool   `long:"keepIndexVersion" description:"don't update index version"`
 	MaintainInsertionOrder   bool   `long:"maintainInsertionOrder" description:"restore the documents in the order of their appearance in the input source. By default the insertions will be performed in an arbitrary order. Setting this flag also enables the behavior of --stopOnError and restricts NumInsertionWorkersPerCollection to 1."`
@@ -102,11 +117,24 @@ type OutputOptions struct {
 	NumInsertionWorkers      int    `long:"numInsertionWorkersPerCollection" description:"number of insert operations to run concurrently per collection" default:"1" default-mask:"-"`
 	StopOnError              bool   `long:"stopOnError" description:"halt after encountering any error during insertion. By default, mongorestore will attempt to continue through document validation and DuplicateKey errors, but with this option enabled, the tool will stop instead. A small number of documents may be inserted after encountering an error even with this option enabled; use --maintainInsertionOrder to halt immediately after an error"`
 	BypassDocumentValidation bool   `long:"bypassDocumentValidation" description:"bypass document validation"`
-	PreserveUUID             bool   `long:"preserveUUID" description:"preserve original collection UUIDs (off by default, requires drop)"`
+	PreserveUUID             bool   `long:"preserveUUID" description:"preserve original collection UUIDs (off by default, requires drop; not supported through mongos, restore to each shard and config server directly)"`
 	TempUsersColl            string `long:"tempUsersColl" default:"tempusers" hidden:"true"`
 	TempRolesColl            string `long:"tempRolesColl" default:"temproles" hidden:"true"`
 	BulkBufferSize           int    `long:"batchSize" default:"1000" hidden:"true"`
+	UseTransactions          bool   `long:"useTransactions" description:"insert each batch of documents in a multi-document transaction, so that a batch that fails is rolled back as a whole and the restore of its collection stops, even without --stopOnError; requires a replica set on 4.0+ or a sharded cluster on 4.2+"`
+	TransactionBatchSize     int    `long:"transactionBatchSize" value-name:"<count>" default:"100" default-mask:"-" description:"most documents to insert in each transaction with --useTransactions; each transaction also holds at most 8MB of documents (defaults to 100)"`
+	MaxMemory                string `long:"maxMemory" value-name:"<size>" description:"limit the total size of the documents read but not yet inserted across all collections, e.g. 512MB or 2GB; reading waits for insertions to catch up once the limit is reached (unlimited by default)"`
+	MaxLagSeconds            int    `long:"maxLagSeconds" value-name:"<seconds>" description:"check the replication lag of the secondaries of the target replica set every 2 seconds, and pause inserting documents while any secondary other than a delayed one is more than this many seconds behind the primary, until the lag falls to half of it, so that the restore does not starve replication (not checked by default)"`
+	MaxDocSize               string `long:"maxDocSize" value-name:"<size>" description:"handle documents larger than the given size, e.g. 16MB, according to --oversizeAction instead of inserting them, so that they do not abort the restore of their collection"`
+	OversizeAction           string `long:"oversizeAction" value-name:"<action>" choice:"skip" choice:"truncate" choice:"fail" default:"skip" description:"what to do with documents larger than --maxDocSize: skip them, truncate them by dropping trailing fields other than _id, or fail the collection (defaults to 'skip')"`
+	OversizeLog              string `long:"oversizeLog" value-name:"<filename>" description:"append a JSON line for each document larger than --maxDocSize to the given file, with its namespace, offset in the collection's BSON data, size, _id and the action taken"`
+	OnCollationMismatch      string `long:"onCollationMismatch" value-name:"<policy>" choice:"fail" choice:"ignore" choice:"recreate" description:"what to do when the collation of a collection in the dump is not supported by the target, or differs from that of the existing collection: fail the collection before restoring any documents, ignore it by creating the collection with the simple collation or restoring into the existing collection anyway, or recreate the existing collection with the collation of the dump (by default, an unsupported collation fails the collection and a differing existing collection is restored into with a warning)"`
 	FixDottedHashedIndexes   bool   `long:"fixDottedHashIndex" description:"when enabled, all the hashed indexes on dotted fields will be created as single field ascending indexes on the destination"`
+	CreateShardedCollections bool   `long:"createShardedCollections" description:"shard each new collection with the shard key recorded in its metadata by mongodump --dumpShardKeys before restoring its documents (requires a mongos)"`
+	PreSplitChunks           bool   `long:"preSplitChunks" description:"after sharding a collection with --createShardedCollections, split it at the chunk boundaries recorded in its metadata by mongodump --dumpChunkDistribution, move each chunk to the shard of the same name if there is one, and assign the recorded zone ranges to the shards of the same name, before restoring its documents"`
+	SummaryJSON              string `long:"summaryJson" value-name:"<filename>" description:"also write the per-namespace restore summary to the given file as JSON"`
+	FailuresFile             string `long:"failuresFile" value-name:"<filename>" default:"restore-failures.json" description:"if any namespace fails or is not restored, write them to the given file as JSON, with the error for each failure and the --nsInclude arguments to restore just those namespaces again (defaults to 'restore-failures.json')"`
+	RestoreSystemCollections string `long:"restoreSystemCollections" value-name:"<collection-list>" description:"comma-separated list of the system collections outside the admin database to restore from the dump, e.g. 'system.js,system.views', or 'none'; other system collections are skipped (defaults to all of them)"`
 }
 
 // Name returns a human-readable group name for output options.
@@ -154,6 +182,9 @@ func ParseOptions(rawArgs []string, versionStr, gitCommit string) (Options, erro
 	outputOpts := &OutputOptions{}
 	opts.AddOptions(outputOpts)
 
+	runManifestOpts := &runmanifest.Options{}
+	opts.AddOptions(runManifestOpts)
+
 	extraArgs, err := opts.ParseArgs(rawArgs)
 	if err != nil {
 		return Options{}, err
@@ -183,7 +214,7 @@ func ParseOptions(rawArgs []string, versionStr, gitCommit string) (Options, erro
 	}
 	opts.WriteConcern = wc
 
-	return Options{opts, inputOpts, nsOpts, outputOpts, targetDir}, nil
+	return Options{opts, inputOpts, nsOpts, outputOpts, runManifestOpts, targetDir}, nil
 }
 
 // getTargetDirFromArgs handles the logic and error cases of figuring out
@@ -211,3 +242,30 @@ func getTargetDirFromArgs(extraArgs []string, dirFlag string) (string, error) {
 		return "", nil
 	}
 }
+
+// HealthCheckRequirements returns the privileges needed to restore with opts,
+// which are checked by --healthCheck. Namespaces selected with --nsInclude or
+// renamed with --nsTo are checked as if every database were restored.
+func (opts Options) HealthCheckRequirements() []healthcheck.Requirement {
+	target := healthcheck.Resource{DB: opts.ToolOptions.Namespace.DB, Collection: opts.ToolOptions.Namespace.Collection}
+	if len(opts.NSOptions.NSInclude) > 0 || len(opts.NSOptions.NSTo) > 0 {
+		target = healthcheck.Resource{}
+	}
+	actions := []string{"insert", "createCollection", "createIndex"}
+	if opts.OutputOptions.Drop {
+		actions = append(actions, "dropCollection")
+	}
+	requirements := []healthcheck.Requirement{{
+		Resource: target,
+		Actions:  actions,
+		Purpose:  "restore the collections and their indexes",
+	}}
+	if opts.InputOptions.OplogReplay {
+		requirements = append(requirements, healthcheck.Requirement{
+			Resource: healthcheck.Resource{Cluster: true},
+			Actions:  []string{"applyOps"},
+			Purpose:  "replay the oplog for --oplogReplay",
+		})
+	}
+	return requirements
+}
@@ -0,0 +1,201 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// Actions taken by --oversizeAction for documents larger than --maxDocSize.
+const (
+	OversizeSkip     = "skip"
+	OversizeTruncate = "truncate"
+	OversizeFail     = "fail"
+)
+
+// maxOversizeDocumentSize is the largest document that can be read from a
+// dump when --maxDocSize is set, so that it can be skipped or truncated.
+// Larger sizes are taken to be corrupt data.
+const maxOversizeDocumentSize = 4 * db.MaxBSONSize
+
+// oversizeHandler decides what to do with documents larger than maxSize, and
+// records each of them in the oversize log, if there is one. It is safe for
+// concurrent use by the collections being restored.
+type oversizeHandler struct {
+	maxSize int
+	action  string
+
+	logPath string
+	mu      sync.Mutex
+	logFile *os.File
+}
+
+// oversizeEntry is a single line of the oversize log.
+type oversizeEntry struct {
+	Namespace string `json:"namespace"`
+	// Offset is the position of the document in the collection's BSON data,
+	// after decompression.
+	Offset int64 `json:"offset"`
+	Size   int   `json:"size"`
+	// ID is the document's _id, as canonical extended JSON.
+	ID     json.RawMessage `json:"_id,omitempty"`
+	Action string          `json:"action"`
+	// TruncatedSize is the size of the document inserted, if truncated.
+	TruncatedSize int `json:"truncatedSize,omitempty"`
+}
+
+// handle returns the document to insert in place of doc, which is read from
+// the given offset of ns, or nil if nothing should be inserted. It returns
+// an error if doc is too large and the action is to fail.
+func (h *oversizeHandler) handle(ns string, offset int64, doc bson.Raw) (bson.Raw, error) {
+	if h == nil || len(doc) <= h.maxSize {
+		return doc, nil
+	}
+	entry := oversizeEntry{
+		Namespace: ns,
+		Offset:    offset,
+		Size:      len(doc),
+		Action:    h.action,
+	}
+	id := "without _id"
+	if value, err := doc.LookupErr("_id"); err == nil {
+		if entry.ID, err = idExtJSON(value); err != nil {
+			return nil, fmt.Errorf("error encoding _id of document at offset %v of %v: %v", offset, ns, err)
+		}
+		id = string(entry.ID)
+	}
+
+	var replacement bson.Raw
+	switch h.action {
+	case OversizeFail:
+		return nil, fmt.Errorf("document %v at offset %v of %v is %v bytes, larger than --maxDocSize of %v bytes",
+			id, offset, ns, len(doc), h.maxSize)
+	case OversizeTruncate:
+		var err error
+		replacement, err = truncateDocument(doc, h.maxSize)
+		if err != nil {
+			return nil, fmt.Errorf("error truncating document %v at offset %v of %v: %v", id, offset, ns, err)
+		}
+		entry.TruncatedSize = len(replacement)
+		log.Logvf(log.Always, "truncated document %v at offset %v of %v from %v to %v bytes",
+			id, offset, ns, len(doc), len(replacement))
+	default:
+		log.Logvf(log.Always, "skipped document %v at offset %v of %v: %v bytes is larger than --maxDocSize",
+			id, offset, ns, len(doc))
+	}
+	if err := h.writeLog(entry); err != nil {
+		return nil, err
+	}
+	return replacement, nil
+}
+
+// idExtJSON returns the canonical extended JSON of an _id value.
+func idExtJSON(value bson.RawValue) (json.RawMessage, error) {
+	out, err := bson.MarshalExtJSON(bson.D{{Key: "_id", Value: value}}, true, false)
+	if err != nil {
+		return nil, err
+	}
+	var wrapper struct {
+		ID json.RawMessage `json:"_id"`
+	}
+	if err = json.Unmarshal(out, &wrapper); err != nil {
+		return nil, err
+	}
+	return wrapper.ID, nil
+}
+
+// writeLog appends entry to the oversize log, creating it if needed.
+func (h *oversizeHandler) writeLog(entry oversizeEntry) error {
+	if h.logPath == "" {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.logFile == nil {
+		f, err := os.OpenFile(h.logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("error opening --oversizeLog: %v", err)
+		}
+		h.logFile = f
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err = h.logFile.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error writing to --oversizeLog: %v", err)
+	}
+	return nil
+}
+
+// Close closes the oversize log, if it was opened.
+func (h *oversizeHandler) Close() error {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.logFile == nil {
+		return nil
+	}
+	err := h.logFile.Close()
+	h.logFile = nil
+	return err
+}
+
+// truncateDocument returns doc with trailing fields dropped until it is no
+// larger than maxSize. The _id is always kept, so that the truncated
+// document can be found and repaired.
+func truncateDocument(doc bson.Raw, maxSize int) (bson.Raw, error) {
+	elems, err := doc.Elements()
+	if err != nil {
+		return nil, err
+	}
+
+	// a document is its 4 byte length, its elements and a trailing 0
+	size := 5
+	var kept []bson.RawElement
+	if id, err := doc.LookupErr("_id"); err == nil {
+		for _, elem := range elems {
+			if elem.Key() == "_id" {
+				kept = append(kept, elem)
+				size += len(elem)
+			}
+		}
+		if size > maxSize {
+			return nil, fmt.Errorf("_id %v alone is larger than --maxDocSize", id)
+		}
+	}
+	for _, elem := range elems {
+		if elem.Key() == "_id" {
+			continue
+		}
+		if size+len(elem) > maxSize {
+			break
+		}
+		kept = append(kept, elem)
+		size += len(elem)
+	}
+
+	idx, truncated := bsoncore.AppendDocumentStart(make([]byte, 0, size))
+	for _, elem := range kept {
+		truncated = append(truncated, elem...)
+	}
+	truncated, err = bsoncore.AppendDocumentEnd(truncated, idx)
+	if err != nil {
+		return nil, err
+	}
+	return bson.Raw(truncated), nil
+}
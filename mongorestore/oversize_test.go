@@ -0,0 +1,119 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestOversizeHandler(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	small, _ := bson.Marshal(bson.D{{Key: "_id", Value: int32(1)}})
+	large, _ := bson.Marshal(bson.D{
+		{Key: "a", Value: strings.Repeat("x", 20)},
+		{Key: "_id", Value: int32(2)},
+		{Key: "b", Value: strings.Repeat("y", 100)},
+	})
+
+	Convey("Without --maxDocSize every document is inserted", t, func() {
+		var h *oversizeHandler
+		doc, err := h.handle("test.c", 0, large)
+		So(err, ShouldBeNil)
+		So(doc, ShouldResemble, bson.Raw(large))
+	})
+
+	Convey("With a --maxDocSize of 64 bytes", t, func() {
+		dir, err := ioutil.TempDir("", "oversize")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		logPath := filepath.Join(dir, "oversize.log")
+		h := &oversizeHandler{maxSize: 64, action: OversizeSkip, logPath: logPath}
+
+		Convey("smaller documents are inserted", func() {
+			doc, err := h.handle("test.c", 0, small)
+			So(err, ShouldBeNil)
+			So(doc, ShouldResemble, bson.Raw(small))
+		})
+
+		Convey("larger documents are skipped and logged with their offsets", func() {
+			doc, err := h.handle("test.c", 12, large)
+			So(err, ShouldBeNil)
+			So(doc, ShouldBeNil)
+			So(h.Close(), ShouldBeNil)
+
+			data, err := ioutil.ReadFile(logPath)
+			So(err, ShouldBeNil)
+			var entry oversizeEntry
+			So(json.Unmarshal(data, &entry), ShouldBeNil)
+			So(entry, ShouldResemble, oversizeEntry{
+				Namespace: "test.c",
+				Offset:    12,
+				Size:      len(large),
+				ID:        json.RawMessage(`{"$numberInt":"2"}`),
+				Action:    OversizeSkip,
+			})
+		})
+
+		Convey("larger documents are truncated, keeping the _id", func() {
+			h.action = OversizeTruncate
+			doc, err := h.handle("test.c", 0, large)
+			So(err, ShouldBeNil)
+			So(len(doc), ShouldBeLessThanOrEqualTo, 64)
+
+			var truncated bson.D
+			So(bson.Unmarshal(doc, &truncated), ShouldBeNil)
+			So(truncated, ShouldResemble, bson.D{
+				{Key: "_id", Value: int32(2)},
+				{Key: "a", Value: strings.Repeat("x", 20)},
+			})
+		})
+
+		Convey("larger documents fail the collection", func() {
+			h.action = OversizeFail
+			_, err := h.handle("test.c", 0, large)
+			So(err, ShouldNotBeNil)
+			_, err = os.Stat(logPath)
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+	})
+}
+
+func TestOversizeLogID(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("The _id of an oversize document is logged as canonical extended JSON", t, func() {
+		for _, id := range []interface{}{
+			"a\"b",
+			primitive.NewObjectID(),
+			primitive.Regex{Pattern: "^a", Options: "i"},
+			primitive.Binary{Subtype: 4, Data: []byte{1, 2, 3}},
+			bson.D{{Key: "a", Value: 1.5}},
+		} {
+			doc, err := bson.Marshal(bson.D{{Key: "_id", Value: id}})
+			So(err, ShouldBeNil)
+			encoded, err := idExtJSON(bson.Raw(doc).Lookup("_id"))
+			So(err, ShouldBeNil)
+
+			var decoded struct {
+				ID interface{} `bson:"_id"`
+			}
+			So(bson.UnmarshalExtJSON([]byte(`{"_id":`+string(encoded)+`}`), true, &decoded), ShouldBeNil)
+			So(decoded.ID, ShouldResemble, id)
+		}
+	})
+}
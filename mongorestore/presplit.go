@@ -0,0 +1,140 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"fmt"
+
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ChunkRange is a chunk of a sharded collection and the shard that owned it,
+// as written to the metadata by mongodump --dumpChunkDistribution.
+type ChunkRange struct {
+	Min   bson.D `bson:"min"`
+	Max   bson.D `bson:"max"`
+	Shard string `bson:"shard"`
+}
+
+// ChunkDistribution holds the chunk ranges of a sharded collection in shard
+// key order.
+type ChunkDistribution struct {
+	Ranges []ChunkRange `bson:"ranges"`
+}
+
+// ZoneRange is a range of a sharded collection assigned to a zone, along
+// with the shards that were tagged with that zone.
+type ZoneRange struct {
+	Zone   string   `bson:"zone"`
+	Min    bson.D   `bson:"min"`
+	Max    bson.D   `bson:"max"`
+	Shards []string `bson:"shards"`
+}
+
+// splitPoints returns the lower bound of every chunk but the first, which
+// is where the collection has to be split to recreate the chunks.
+func splitPoints(chunks []ChunkRange) []bson.D {
+	var points []bson.D
+	for i := 1; i < len(chunks); i++ {
+		points = append(points, chunks[i].Min)
+	}
+	return points
+}
+
+// PreSplitCollection recreates the recorded chunk distribution of the newly
+// sharded collection of the intent: it splits the collection at the chunk
+// boundaries, moves each chunk to the shard of the same name if the target
+// cluster has one, and assigns the zone ranges to the shards of the same
+// name. The collection must still be empty. Each step that fails is logged
+// and skipped, since the documents can be restored without it.
+func (restore *MongoRestore) PreSplitCollection(intent *intents.Intent, chunks *ChunkDistribution, zones []ZoneRange) error {
+	session, err := restore.SessionProvider.GetSession()
+	if err != nil {
+		return fmt.Errorf("error establishing connection: %v", err)
+	}
+	admin := session.Database("admin")
+
+	shards, err := listShards(admin)
+	if err != nil {
+		return fmt.Errorf("error listing shards: %v", err)
+	}
+
+	if chunks != nil {
+		points := splitPoints(chunks.Ranges)
+		log.Logvf(log.Info, "splitting %v at %v chunk boundaries", intent.Namespace(), len(points))
+		for _, point := range points {
+			command := bson.D{{Key: "split", Value: intent.Namespace()}, {Key: "middle", Value: point}}
+			if err = admin.RunCommand(nil, command).Err(); err != nil {
+				log.Logvf(log.Always, "warning: could not split %v at %v: %v", intent.Namespace(), point, err)
+			}
+		}
+
+		for _, chunk := range chunks.Ranges {
+			if !shards[chunk.Shard] {
+				log.Logvf(log.DebugLow, "not moving chunk of %v to %v, which is not a shard of the target", intent.Namespace(), chunk.Shard)
+				continue
+			}
+			command := bson.D{
+				{Key: "moveChunk", Value: intent.Namespace()},
+				{Key: "bounds", Value: bson.A{chunk.Min, chunk.Max}},
+				{Key: "to", Value: chunk.Shard},
+			}
+			if err = admin.RunCommand(nil, command).Err(); err != nil {
+				log.Logvf(log.Always, "warning: could not move chunk %v of %v to %v: %v", chunk.Min, intent.Namespace(), chunk.Shard, err)
+			}
+		}
+	}
+
+	for _, zone := range zones {
+		tagged := 0
+		for _, shard := range zone.Shards {
+			if !shards[shard] {
+				continue
+			}
+			command := bson.D{{Key: "addShardToZone", Value: shard}, {Key: "zone", Value: zone.Zone}}
+			if err = admin.RunCommand(nil, command).Err(); err != nil {
+				log.Logvf(log.Always, "warning: could not add shard %v to zone %v: %v", shard, zone.Zone, err)
+				continue
+			}
+			tagged++
+		}
+		if tagged == 0 {
+			log.Logvf(log.Always, "warning: not assigning range %v of %v to zone %v, which has no shards in the target", zone.Min, intent.Namespace(), zone.Zone)
+			continue
+		}
+		command := bson.D{
+			{Key: "updateZoneKeyRange", Value: intent.Namespace()},
+			{Key: "min", Value: zone.Min},
+			{Key: "max", Value: zone.Max},
+			{Key: "zone", Value: zone.Zone},
+		}
+		if err = admin.RunCommand(nil, command).Err(); err != nil {
+			log.Logvf(log.Always, "warning: could not assign range %v of %v to zone %v: %v", zone.Min, intent.Namespace(), zone.Zone, err)
+		}
+	}
+	return nil
+}
+
+// listShards returns the names of the shards of the cluster.
+func listShards(admin *mongo.Database) (map[string]bool, error) {
+	var result struct {
+		Shards []struct {
+			ID string `bson:"_id"`
+		} `bson:"shards"`
+	}
+	if err := admin.RunCommand(nil, bson.D{{Key: "listShards", Value: 1}}).Decode(&result); err != nil {
+		return nil, err
+	}
+	shards := make(map[string]bool, len(result.Shards))
+	for _, shard := range result.Shards {
+		shards[shard.ID] = true
+	}
+	return shards, nil
+}
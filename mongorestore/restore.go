@@ -7,6 +7,8 @@
 package mongorestore
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"strings"
@@ -29,14 +31,21 @@ const insertBufferFactor = 16
 type Result struct {
 	Successes int64
 	Failures  int64
-	Err       error
+	// Skipped counts the documents larger than --maxDocSize that were skipped
+	Skipped int64
+	Bytes   int64
+	Err     error
 }
 
 // log pretty-prints the result, associated with restoring the given namespace
 func (result *Result) log(ns string) {
-	log.Logvf(log.Always, "finished restoring %v (%v %v, %v %v)",
+	skipped := ""
+	if result.Skipped > 0 {
+		skipped = fmt.Sprintf(", %v skipped", result.Skipped)
+	}
+	log.Logvf(log.Always, "finished restoring %v (%v %v, %v %v%v)",
 		ns, result.Successes, util.Pluralize(int(result.Successes), "document", "documents"),
-		result.Failures, util.Pluralize(int(result.Failures), "failure", "failures"))
+		result.Failures, util.Pluralize(int(result.Failures), "failure", "failures"), skipped)
 }
 
 // combineWith sums the successes and failures from both results and the overwrites the existing Err with the Err from
@@ -44,6 +53,8 @@ func (result *Result) log(ns string) {
 func (result *Result) combineWith(other Result) {
 	result.Successes += other.Successes
 	result.Failures += other.Failures
+	result.Skipped += other.Skipped
+	result.Bytes += other.Bytes
 	result.Err = other.Err
 }
 
@@ -62,11 +73,14 @@ func NewResultFromBulkResult(result *mongo.BulkWriteResult, err error) Result {
 	var nFailure int64
 
 	// if a write concern error is encountered, the failure count may be inaccurate.
+	var txnErr *transactionError
 	if bwe, ok := err.(mongo.BulkWriteException); ok {
 		nFailure = int64(len(bwe.WriteErrors))
+	} else if errors.As(err, &txnErr) {
+		nFailure = int64(txnErr.Documents)
 	}
 
-	return Result{nSuccess, nFailure, err}
+	return Result{Successes: nSuccess, Failures: nFailure, Err: err}
 }
 
 // RestoreIntents iterates through all of the intents stored in the IntentManager, and restores them.
@@ -95,11 +109,13 @@ func (restore *MongoRestore) RestoreIntents() Result {
 						}
 						fileNeedsIOBuffer.TakeIOBuffer(ioBuf)
 					}
+					start := time.Now()
 					result := restore.RestoreIntent(intent)
+					restore.summary.recordResult(intent.Namespace(), result, time.Since(start))
 					result.log(intent.Namespace())
 					workerResult.combineWith(result)
 					if result.Err != nil {
-						resultChan <- workerResult.withErr(fmt.Errorf("%v: %v", intent.Namespace(), result.Err))
+						resultChan <- workerResult.withErr(fmt.Errorf("%v: %w", intent.Namespace(), result.Err))
 						return
 					}
 					restore.manager.Finish(intent)
@@ -130,11 +146,13 @@ func (restore *MongoRestore) RestoreIntents() Result {
 		if intent == nil {
 			break
 		}
+		start := time.Now()
 		result := restore.RestoreIntent(intent)
+		restore.summary.recordResult(intent.Namespace(), result, time.Since(start))
 		result.log(intent.Namespace())
 		totalResult.combineWith(result)
 		if result.Err != nil {
-			return totalResult.withErr(fmt.Errorf("%v: %v", intent.Namespace(), result.Err))
+			return totalResult.withErr(fmt.Errorf("%v: %w", intent.Namespace(), result.Err))
 		}
 		restore.manager.Finish(intent)
 	}
@@ -143,12 +161,20 @@ func (restore *MongoRestore) RestoreIntents() Result {
 
 // RestoreIntent attempts to restore a given intent into MongoDB.
 func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) Result {
+	if restore.OutputOptions.IndexesOnly {
+		return restore.restoreIndexesOnly(intent)
+	}
+
 	collectionExists, err := restore.CollectionExists(intent)
 	if err != nil {
-		return Result{Err: fmt.Errorf("error reading database: %v", err)}
+		return Result{Err: fmt.Errorf("error reading database: %w", err)}
 	}
 
-	if !restore.OutputOptions.Drop && collectionExists {
+	if restore.OutputOptions.TruncateTarget && collectionExists {
+		if err = restore.truncateTarget(intent); err != nil {
+			return Result{Err: err}
+		}
+	} else if !restore.OutputOptions.Drop && collectionExists {
 		log.Logvf(log.Always, "restoring to existing collection %v without dropping", intent.Namespace())
 	}
 
@@ -172,6 +198,9 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) Result {
 	var options bson.D
 	var indexes []IndexDocument
 	var uuid string
+	var shardKey *ShardKey
+	var chunks *ChunkDistribution
+	var zones []ZoneRange
 
 	// get indexes from system.indexes dump if we have it but don't have metadata files
 	if intent.MetadataFile == nil {
@@ -196,15 +225,17 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) Result {
 		log.Logvf(log.Always, "reading metadata for %v from %v", intent.Namespace(), intent.MetadataLocation)
 		metadataJSON, err := ioutil.ReadAll(intent.MetadataFile)
 		if err != nil {
-			return Result{Err: fmt.Errorf("error reading metadata from %v: %v", intent.MetadataLocation, err)}
+			return Result{Err: fmt.Errorf("error reading metadata from %v: %w", intent.MetadataLocation, err)}
 		}
 		metadata, err := restore.MetadataFromJSON(metadataJSON)
 		if err != nil {
-			return Result{Err: fmt.Errorf("error parsing metadata from %v: %v", intent.MetadataLocation, err)}
+			return Result{Err: fmt.Errorf("error parsing metadata from %v: %w", intent.MetadataLocation, err)}
 		}
 		if metadata != nil {
 			options = metadata.Options
 			indexes = metadata.Indexes
+			shardKey = metadata.ShardKey
+			chunks, zones = metadata.Chunks, metadata.Zones
 			if restore.OutputOptions.PreserveUUID {
 				if metadata.UUID == "" {
 					log.Logvf(log.Always, "--preserveUUID used but no UUID found in %v, generating new UUID for %v", intent.MetadataLocation, intent.Namespace())
@@ -253,15 +284,60 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) Result {
 			options = nil
 		}
 	}
+	if restore.OutputOptions.DataOnly {
+		log.Logvf(log.DebugLow, "not restoring the collection options and indexes of %v with --dataOnly", intent.Namespace())
+		logMessageSuffix = "with no collection options"
+		options = nil
+		indexes = nil
+		shardKey = nil
+		hasNonSimpleCollation = false
+	}
+	// the collation is only known from the metadata file
+	if collectionExists && intent.MetadataFile != nil && !restore.OutputOptions.NoOptionsRestore && !restore.OutputOptions.DataOnly {
+		recreate, err := restore.checkExistingCollation(intent, options)
+		if err != nil {
+			return Result{Err: err}
+		}
+		if recreate {
+			if err = restore.DropCollection(intent); err != nil {
+				return Result{Err: err}
+			}
+			collectionExists = false
+		}
+	}
 	if !collectionExists {
 		log.Logvf(log.Info, "creating collection %v %s", intent.Namespace(), logMessageSuffix)
 		log.Logvf(log.DebugHigh, "using collection options: %#v", options)
 		err = restore.CreateCollection(intent, options, uuid)
+		if collation := collationOf(options); err != nil && collation != nil && isCollationError(err) {
+			if options, err = restore.handleUnsupportedCollation(intent, options, err); err != nil {
+				return Result{Err: err}
+			}
+			withoutIndexCollation(indexes, collation)
+			hasNonSimpleCollation = false
+			err = restore.CreateCollection(intent, options, uuid)
+		}
 		if err != nil {
-			return Result{Err: fmt.Errorf("error creating collection %v: %v", intent.Namespace(), err)}
+			return Result{Err: fmt.Errorf("error creating collection %v: %w", intent.Namespace(), err)}
 		}
 		restore.addToKnownCollections(intent)
+		if restore.OutputOptions.CreateShardedCollections && shardKey != nil {
+			log.Logvf(log.Always, "sharding collection %v with shard key %v", intent.Namespace(), shardKey)
+			err = restore.ShardCollection(intent, shardKey, hasNonSimpleCollation)
+			if err != nil {
+				return Result{Err: fmt.Errorf("error sharding collection %v: %w", intent.Namespace(), err)}
+			}
+			if restore.OutputOptions.PreSplitChunks && (chunks != nil || len(zones) > 0) {
+				log.Logvf(log.Always, "pre-splitting collection %v", intent.Namespace())
+				if err = restore.PreSplitCollection(intent, chunks, zones); err != nil {
+					return Result{Err: fmt.Errorf("error pre-splitting collection %v: %w", intent.Namespace(), err)}
+				}
+			}
+		}
 	} else {
+		if restore.OutputOptions.CreateShardedCollections && shardKey != nil {
+			log.Logvf(log.Always, "not sharding existing collection %v", intent.Namespace())
+		}
 		log.Logvf(log.Info, "collection %v already exists - skipping collection create", intent.Namespace())
 	}
 
@@ -275,12 +351,18 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) Result {
 
 		log.Logvf(log.Always, "restoring %v from %v", intent.Namespace(), intent.Location)
 
-		bsonSource := db.NewDecodedBSONSource(db.NewBSONSource(intent.BSONFile))
+		rawSource := db.NewBSONSource(intent.BSONFile)
+		if restore.oversize != nil {
+			// documents larger than the server accepts are read so that
+			// they can be skipped or truncated
+			rawSource.SetMaxBSONSize(maxOversizeDocumentSize)
+		}
+		bsonSource := db.NewDecodedBSONSource(rawSource)
 		defer bsonSource.Close()
 
 		result = restore.RestoreCollectionToDB(intent.DB, intent.C, bsonSource, intent.BSONFile, intent.Size)
 		if result.Err != nil {
-			result.Err = fmt.Errorf("error restoring from %v: %v", intent.Location, result.Err)
+			result.Err = fmt.Errorf("error restoring from %v: %w", intent.Location, result.Err)
 			return result
 		}
 	}
@@ -294,9 +376,11 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) Result {
 		if restore.OutputOptions.FixDottedHashedIndexes {
 			fixDottedHashedIndexes(indexes)
 		}
+		indexStart := time.Now()
 		err = restore.CreateIndexes(intent.DB, intent.C, indexes, hasNonSimpleCollation)
+		restore.summary.recordIndexBuild(intent.Namespace(), time.Since(indexStart))
 		if err != nil {
-			result.Err = fmt.Errorf("error creating indexes for %v: %v", intent.Namespace(), err)
+			result.Err = fmt.Errorf("error creating indexes for %v: %w", intent.Namespace(), err)
 			return result
 		}
 	} else {
@@ -310,7 +394,7 @@ func (restore *MongoRestore) convertLegacyIndexes(indexes []IndexDocument, ns st
 	var indexKeys []bson.D
 	var indexesConverted []IndexDocument
 	for _, index := range indexes {
-		bsonutil.ConvertLegacyIndexKeys(index.Key, ns)
+		restore.convertIndex(&index, ns)
 
 		foundIdenticalIndex := false
 		for _, keys := range indexKeys {
@@ -321,18 +405,11 @@ func (restore *MongoRestore) convertLegacyIndexes(indexes []IndexDocument, ns st
 		}
 
 		if foundIdenticalIndex {
-			log.Logvf(log.Always, "index %v contains duplicate key with an existing index after ConvertLegacyIndexKeys, Skipping...", index.Options["name"])
+			log.Logvf(log.Always, "index %v contains duplicate key with an existing index after converting it, Skipping...", index.Options["name"])
 			continue
 		}
 
 		indexKeys = append(indexKeys, index.Key)
-
-		// It is preferable to use the ignoreUnknownIndexOptions on the createIndex command to
-		// force the server to remove unknown options. But ignoreUnknownIndexOptions was only added in 4.1.9.
-		// So for pre 3.4 indexes being added to servers < 4.1.9 we must strip the options here.
-		if restore.serverVersion.LT(db.Version{4, 1, 9}) {
-			bsonutil.ConvertLegacyIndexOptions(index.Options)
-		}
 		indexesConverted = append(indexesConverted, index)
 	}
 	return indexesConverted
@@ -366,12 +443,19 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 	var termErr error
 	session, err := restore.SessionProvider.GetSession()
 	if err != nil {
-		return Result{Err: fmt.Errorf("error establishing connection: %v", err)}
+		return Result{Err: fmt.Errorf("error establishing connection: %w", err)}
 	}
 
 	collection := session.Database(dbName).Collection(colName)
 
 	documentCount := int64(0)
+	documentBytes := int64(0)
+	// offset is the position of the next document in the BSON data, and
+	// oversizeSkipped counts the documents skipped for --maxDocSize
+	offset := int64(0)
+	oversizeSkipped := int64(0)
+	var oversizeErr error
+	ns := fmt.Sprintf("%v.%v", dbName, colName)
 	watchProgressor := progress.NewCounter(fileSize)
 	if restore.ProgressManager != nil {
 		name := fmt.Sprintf("%v.%v", dbName, colName)
@@ -384,6 +468,12 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 	docChan := make(chan bson.Raw, insertBufferFactor)
 	resultChan := make(chan Result, maxInsertWorkers)
 
+	// done stops the reader once every insert job has finished, so that the
+	// memory budget held by documents no longer being inserted is returned
+	budget := restore.memoryBudget
+	done, stopReading := context.WithCancel(context.Background())
+	defer stopReading()
+
 	// stream documents for this collection on docChan
 	go func() {
 		for {
@@ -399,10 +489,33 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 				return
 			}
 
+			docOffset := offset
+			offset += int64(len(doc))
+			if doc, oversizeErr = restore.oversize.handle(ns, docOffset, doc); oversizeErr != nil {
+				close(docChan)
+				return
+			}
+			if doc == nil {
+				oversizeSkipped++
+				continue
+			}
+
+			cost := budget.cost(len(doc))
+			if budget.reserve(done, cost) != nil {
+				close(docChan)
+				return
+			}
 			rawBytes := make([]byte, len(doc))
 			copy(rawBytes, doc)
-			docChan <- bson.Raw(rawBytes)
+			select {
+			case docChan <- bson.Raw(rawBytes):
+			case <-done.Done():
+				budget.release(cost)
+				close(docChan)
+				return
+			}
 			documentCount++
+			documentBytes += int64(len(rawBytes))
 		}
 		close(docChan)
 	}()
@@ -413,10 +526,32 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 		go func() {
 			var result Result
 
-			bulk := db.NewUnorderedBufferedBulkInserter(collection, restore.OutputOptions.BulkBufferSize).
-				SetOrdered(restore.OutputOptions.MaintainInsertionOrder)
-			bulk.SetBypassDocumentValidation(restore.OutputOptions.BypassDocumentValidation)
+			// with --useTransactions, a batch that fails was rolled back as
+			// a whole, so its error is never one to continue through
+			var bulk documentInserter
+			batchSize, stopOnError := restore.OutputOptions.BulkBufferSize, restore.OutputOptions.StopOnError
+			if restore.OutputOptions.UseTransactions {
+				bulk = restore.newTransactionInserter(session, collection)
+				batchSize, stopOnError = restore.OutputOptions.TransactionBatchSize, true
+			} else {
+				inserter := db.NewUnorderedBufferedBulkInserter(collection, restore.OutputOptions.BulkBufferSize).
+					SetOrdered(restore.OutputOptions.MaintainInsertionOrder)
+				inserter.SetBypassDocumentValidation(restore.OutputOptions.BypassDocumentValidation)
+				bulk = inserter
+			}
+
+			// the memory budget held by buffered documents is returned
+			// whenever they are flushed
+			var pendingCost int64
+			pendingDocs := 0
+			defer func() { budget.release(pendingCost) }()
 			for rawDoc := range docChan {
+				if pendingDocs == 0 {
+					// hold off starting a batch while the secondaries catch up
+					restore.lagMonitor.wait(done)
+				}
+				pendingCost += budget.cost(len(rawDoc))
+				pendingDocs++
 				if restore.objCheck {
 					result.Err = bson.Unmarshal(rawDoc, &bson.D{})
 					if result.Err != nil {
@@ -425,7 +560,16 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 					}
 				}
 				result.combineWith(NewResultFromBulkResult(bulk.InsertRaw(rawDoc)))
-				result.Err = db.FilterError(restore.OutputOptions.StopOnError, result.Err)
+				flushed := pendingDocs >= batchSize
+				if !flushed && budget.batchFull(pendingCost) {
+					result.combineWith(NewResultFromBulkResult(bulk.Flush()))
+					flushed = true
+				}
+				if flushed {
+					budget.release(pendingCost)
+					pendingCost, pendingDocs = 0, 0
+				}
+				result.Err = db.FilterError(stopOnError, result.Err)
 				if result.Err != nil {
 					resultChan <- result
 					return
@@ -434,7 +578,7 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 			}
 			// flush the remaining docs
 			result.combineWith(NewResultFromBulkResult(bulk.Flush()))
-			resultChan <- result.withErr(db.FilterError(restore.OutputOptions.StopOnError, result.Err))
+			resultChan <- result.withErr(db.FilterError(stopOnError, result.Err))
 			return
 		}()
 
@@ -446,7 +590,7 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 	var finalErr error
 
 	// wait until all insert jobs finish
-	for done := 0; done < maxInsertWorkers; done++ {
+	for finished := 0; finished < maxInsertWorkers; finished++ {
 		totalResult.combineWith(<-resultChan)
 		if finalErr == nil && totalResult.Err != nil {
 			finalErr = totalResult.Err
@@ -454,10 +598,23 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 		}
 	}
 
+	// documents left unread after an insert job failed no longer hold any of
+	// the memory budget
+	stopReading()
+	for rawDoc := range docChan {
+		budget.release(budget.cost(len(rawDoc)))
+	}
+
+	// the reader has closed docChan by the time every insert job is done
+	totalResult.Bytes = documentBytes
+	totalResult.Skipped = oversizeSkipped
+
 	if finalErr != nil {
 		totalResult.Err = finalErr
+	} else if oversizeErr != nil {
+		totalResult.Err = oversizeErr
 	} else if err = bsonSource.Err(); err != nil {
-		totalResult.Err = fmt.Errorf("reading bson input: %v", err)
+		totalResult.Err = fmt.Errorf("reading bson input: %w", err)
 	} else if termErr != nil {
 		totalResult.Err = termErr
 	}
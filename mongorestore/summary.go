@@ -0,0 +1,321 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/exitcode"
+	"github.com/mongodb/mongo-tools/common/text"
+	"github.com/mongodb/mongo-tools/mongorestore/ns"
+)
+
+// NamespaceSummary records the outcome of restoring a single namespace, or
+// the totals over all namespaces.
+type NamespaceSummary struct {
+	Namespace      string
+	Documents      int64
+	Failures       int64
+	Skipped        int64
+	Bytes          int64
+	Duration       time.Duration
+	IndexBuildTime time.Duration
+}
+
+// DocumentsPerSecond returns the average rate at which documents were restored.
+func (s NamespaceSummary) DocumentsPerSecond() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.Documents) / s.Duration.Seconds()
+}
+
+// BytesPerSecond returns the average rate at which BSON data was restored.
+func (s NamespaceSummary) BytesPerSecond() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.Bytes) / s.Duration.Seconds()
+}
+
+// MarshalJSON reports durations in seconds and includes the average rates.
+func (s NamespaceSummary) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Namespace          string  `json:"namespace,omitempty"`
+		Documents          int64   `json:"documents"`
+		Failures           int64   `json:"failures"`
+		Skipped            int64   `json:"skipped"`
+		Bytes              int64   `json:"bytes"`
+		DurationSeconds    float64 `json:"durationSeconds"`
+		DocumentsPerSecond float64 `json:"documentsPerSecond"`
+		BytesPerSecond     float64 `json:"bytesPerSecond"`
+		IndexBuildSeconds  float64 `json:"indexBuildSeconds"`
+	}{
+		Namespace:          s.Namespace,
+		Documents:          s.Documents,
+		Failures:           s.Failures,
+		Skipped:            s.Skipped,
+		Bytes:              s.Bytes,
+		DurationSeconds:    s.Duration.Seconds(),
+		DocumentsPerSecond: s.DocumentsPerSecond(),
+		BytesPerSecond:     s.BytesPerSecond(),
+		IndexBuildSeconds:  s.IndexBuildTime.Seconds(),
+	})
+}
+
+// NamespaceFailure records why restoring a namespace failed and how far it
+// got, so that the namespace can be restored again.
+type NamespaceFailure struct {
+	// Namespace is the namespace restored to, and SourceNamespace the
+	// namespace in the dump, as selected by --nsInclude.
+	Namespace       string `json:"namespace"`
+	SourceNamespace string `json:"sourceNamespace"`
+	// ErrorClass is the kind of error, as named by exitcode.Class.
+	ErrorClass string `json:"errorClass"`
+	Error      string `json:"error"`
+	// LastAppliedPosition is the number of documents of the namespace that
+	// were inserted, rejected or skipped before it failed. Documents are only
+	// inserted in the order they were dumped with --maintainInsertionOrder.
+	LastAppliedPosition int64 `json:"lastAppliedPosition"`
+}
+
+// RestoreSummary collects a NamespaceSummary for each restored namespace.
+// It is safe for concurrent use, and its methods do nothing on a nil summary.
+type RestoreSummary struct {
+	mu          sync.Mutex
+	started     time.Time
+	finished    time.Time
+	byNamespace map[string]*NamespaceSummary
+
+	// pending maps each namespace still to be restored to its source
+	// namespace.
+	pending   map[string]string
+	failures  []NamespaceFailure
+	completed int
+}
+
+func newRestoreSummary() *RestoreSummary {
+	return &RestoreSummary{
+		started:     time.Now(),
+		byNamespace: make(map[string]*NamespaceSummary),
+		pending:     make(map[string]string),
+	}
+}
+
+// expect records that ns is to be restored from the source namespace, so
+// that it is reported if it is not.
+func (s *RestoreSummary) expect(ns, source string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[ns] = source
+}
+
+func (s *RestoreSummary) namespace(ns string) *NamespaceSummary {
+	summary, ok := s.byNamespace[ns]
+	if !ok {
+		summary = &NamespaceSummary{Namespace: ns}
+		s.byNamespace[ns] = summary
+	}
+	return summary
+}
+
+// recordResult adds the outcome of restoring ns, which took the given time.
+func (s *RestoreSummary) recordResult(ns string, result Result, d time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	summary := s.namespace(ns)
+	summary.Documents += result.Successes
+	summary.Failures += result.Failures
+	summary.Skipped += result.Skipped
+	summary.Bytes += result.Bytes
+	summary.Duration += d
+	s.finished = time.Now()
+
+	source, ok := s.pending[ns]
+	if !ok {
+		source = ns
+	}
+	delete(s.pending, ns)
+	if result.Err == nil {
+		s.completed++
+		return
+	}
+	s.failures = append(s.failures, NamespaceFailure{
+		Namespace:           ns,
+		SourceNamespace:     source,
+		ErrorClass:          exitcode.Class(result.Err),
+		Error:               result.Err.Error(),
+		LastAppliedPosition: result.Successes + result.Failures + result.Skipped,
+	})
+}
+
+// recordIndexBuild adds time spent building the indexes of ns.
+func (s *RestoreSummary) recordIndexBuild(ns string, d time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.namespace(ns).IndexBuildTime += d
+}
+
+// Namespaces returns the summaries of all restored namespaces, sorted by name.
+func (s *RestoreSummary) Namespaces() []NamespaceSummary {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	summaries := make([]NamespaceSummary, 0, len(s.byNamespace))
+	for _, summary := range s.byNamespace {
+		summaries = append(summaries, *summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Namespace < summaries[j].Namespace
+	})
+	return summaries
+}
+
+// Total returns the sum over all restored namespaces. Its duration is the
+// wall-clock time of the restore, since namespaces are restored in parallel.
+func (s *RestoreSummary) Total() NamespaceSummary {
+	var total NamespaceSummary
+	for _, summary := range s.Namespaces() {
+		total.Documents += summary.Documents
+		total.Failures += summary.Failures
+		total.Skipped += summary.Skipped
+		total.Bytes += summary.Bytes
+		total.IndexBuildTime += summary.IndexBuildTime
+	}
+	if s != nil && !s.finished.IsZero() {
+		total.Duration = s.finished.Sub(s.started)
+	}
+	return total
+}
+
+// Grid returns a table of the namespace summaries followed by the totals.
+func (s *RestoreSummary) Grid() string {
+	buf := &bytes.Buffer{}
+	out := &text.GridWriter{ColumnPadding: 2}
+	out.WriteCells("namespace", "documents", "failures", "skipped", "bytes", "duration", "docs/sec", "bytes/sec", "index build")
+	out.EndRow()
+	writeRow := func(name string, summary NamespaceSummary) {
+		out.WriteCells(name,
+			fmt.Sprintf("%v", summary.Documents),
+			fmt.Sprintf("%v", summary.Failures),
+			fmt.Sprintf("%v", summary.Skipped),
+			text.FormatByteAmount(summary.Bytes),
+			summary.Duration.Round(time.Millisecond).String(),
+			fmt.Sprintf("%.1f", summary.DocumentsPerSecond()),
+			text.FormatByteAmount(int64(summary.BytesPerSecond())),
+			summary.IndexBuildTime.Round(time.Millisecond).String())
+		out.EndRow()
+	}
+	for _, summary := range s.Namespaces() {
+		writeRow(summary.Namespace, summary)
+	}
+	writeRow("total", s.Total())
+	out.Flush(buf)
+	return buf.String()
+}
+
+// WriteJSON writes the namespace summaries and totals to filename.
+func (s *RestoreSummary) WriteJSON(filename string) error {
+	data, err := json.MarshalIndent(struct {
+		Namespaces []NamespaceSummary `json:"namespaces"`
+		Total      NamespaceSummary   `json:"total"`
+	}{s.Namespaces(), s.Total()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0644)
+}
+
+// Completed returns the number of namespaces restored without error.
+func (s *RestoreSummary) Completed() int {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.completed
+}
+
+// Failures returns the namespaces that failed to restore, sorted by name.
+func (s *RestoreSummary) Failures() []NamespaceFailure {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	failures := make([]NamespaceFailure, len(s.failures))
+	copy(failures, s.failures)
+	sort.Slice(failures, func(i, j int) bool {
+		return failures[i].Namespace < failures[j].Namespace
+	})
+	return failures
+}
+
+// NotRestored returns the source namespaces that were to be restored but
+// were not, or were still being restored when the restore stopped, sorted
+// by name.
+func (s *RestoreSummary) NotRestored() []string {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sources := make([]string, 0, len(s.pending))
+	for _, source := range s.pending {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	return sources
+}
+
+// WriteFailures writes the namespaces that failed or were not restored to
+// filename as JSON, along with the --nsInclude arguments that select just
+// those namespaces from the dump, so that they can be restored again.
+func (s *RestoreSummary) WriteFailures(filename string) error {
+	failures := s.Failures()
+	notRestored := s.NotRestored()
+	nsInclude := make([]string, 0, len(failures)+len(notRestored))
+	for _, failure := range failures {
+		nsInclude = append(nsInclude, ns.Escape(failure.SourceNamespace))
+	}
+	for _, source := range notRestored {
+		nsInclude = append(nsInclude, ns.Escape(source))
+	}
+	sort.Strings(nsInclude)
+
+	data, err := json.MarshalIndent(struct {
+		Failed      []NamespaceFailure `json:"failed"`
+		NotRestored []string           `json:"notRestored"`
+		NSInclude   []string           `json:"nsInclude"`
+	}{failures, notRestored, nsInclude}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0644)
+}
+
+// Summary returns the per-namespace results of the restore.
+func (restore *MongoRestore) Summary() *RestoreSummary {
+	return restore.summary
+}
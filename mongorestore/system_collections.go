@@ -0,0 +1,67 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"fmt"
+	"strings"
+)
+
+// noSystemCollections is the argument to --restoreSystemCollections that
+// skips every system collection.
+const noSystemCollections = "none"
+
+// parseSystemCollections parses the comma-separated argument to
+// --restoreSystemCollections into a set of collection names. It returns nil,
+// selecting every system collection, if the argument is empty.
+func parseSystemCollections(list string) (map[string]bool, error) {
+	list = strings.TrimSpace(list)
+	if list == "" {
+		return nil, nil
+	}
+	collections := map[string]bool{}
+	if list == noSystemCollections {
+		return collections, nil
+	}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !strings.HasPrefix(name, "system.") {
+			return nil, fmt.Errorf("%v is not a system collection", name)
+		}
+		// these have dedicated handling and cannot be opted into
+		if name == "system.profile" || name == "system.indexes" {
+			return nil, fmt.Errorf("%v cannot be restored", name)
+		}
+		collections[name] = true
+	}
+	return collections, nil
+}
+
+// isOptInSystemCollection returns true for system collections that are
+// skipped when --restoreSystemCollections does not name them. The system collections of
+// the admin database hold users, roles and the auth schema, and are governed by
+// the options for restoring users and roles instead. system.profile and
+// system.indexes are handled separately.
+func isOptInSystemCollection(db, collection string) bool {
+	if db == "admin" || !strings.HasPrefix(collection, "system.") {
+		return false
+	}
+	return collection != "system.profile" && collection != "system.indexes"
+}
+
+// shouldRestoreSystemCollection returns true if the given system collection
+// was selected with --restoreSystemCollections, or if the option was not
+// given.
+func (restore *MongoRestore) shouldRestoreSystemCollection(collection string) bool {
+	if restore.systemCollections == nil {
+		return true
+	}
+	return restore.systemCollections[collection]
+}
@@ -0,0 +1,143 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	mopt "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxTransactionBatchBytes is the most document data inserted in one
+// transaction with --useTransactions. It leaves room below the 16MB that a
+// transaction's writes must fit in on 4.0, where they are recorded in a single
+// oplog entry.
+const maxTransactionBatchBytes = 8 * 1024 * 1024
+
+// documentInserter buffers documents and inserts them in batches, returning
+// the result of each batch that it inserts.
+type documentInserter interface {
+	InsertRaw(rawBytes []byte) (*mongo.BulkWriteResult, error)
+	Flush() (*mongo.BulkWriteResult, error)
+}
+
+// transactionError is returned when the transaction inserting a batch of
+// documents fails, so that none of them were inserted.
+type transactionError struct {
+	Documents int
+	Err       error
+}
+
+func (e *transactionError) Error() string {
+	return fmt.Sprintf("transaction inserting %v documents was rolled back: %v", e.Documents, e.Err)
+}
+
+func (e *transactionError) Unwrap() error {
+	return e.Err
+}
+
+// validateTransactionOptions checks that --useTransactions can be used with
+// the connected deployment.
+func (restore *MongoRestore) validateTransactionOptions(nodeType db.NodeType) error {
+	if !restore.OutputOptions.UseTransactions {
+		return nil
+	}
+	if restore.OutputOptions.TransactionBatchSize <= 0 {
+		return fmt.Errorf("--transactionBatchSize must be positive")
+	}
+	switch nodeType {
+	case db.ReplSet:
+		if restore.serverVersion.LT(db.Version{4, 0, 0}) {
+			return fmt.Errorf("--useTransactions requires MongoDB 4.0 or later on a replica set")
+		}
+	case db.Mongos:
+		if restore.serverVersion.LT(db.Version{4, 2, 0}) {
+			return fmt.Errorf("--useTransactions requires MongoDB 4.2 or later on a sharded cluster")
+		}
+	default:
+		return fmt.Errorf("--useTransactions requires a replica set or sharded cluster")
+	}
+	return nil
+}
+
+// transactionInserter inserts each batch of documents in a multi-document
+// transaction, so that a batch is either inserted as a whole or not at all.
+// Batches hold up to batchSize documents and maxTransactionBatchBytes of
+// data.
+type transactionInserter struct {
+	client     *mongo.Client
+	collection *mongo.Collection
+	batchSize  int
+	insertOpts *mopt.InsertManyOptions
+
+	docs  []interface{}
+	bytes int
+}
+
+// newTransactionInserter returns a transactionInserter that inserts into
+// collection, with the insertion order and document validation of the
+// restore.
+func (restore *MongoRestore) newTransactionInserter(client *mongo.Client, collection *mongo.Collection) *transactionInserter {
+	return &transactionInserter{
+		client:     client,
+		collection: collection,
+		batchSize:  restore.OutputOptions.TransactionBatchSize,
+		insertOpts: mopt.InsertMany().
+			SetOrdered(restore.OutputOptions.MaintainInsertionOrder).
+			SetBypassDocumentValidation(restore.OutputOptions.BypassDocumentValidation),
+	}
+}
+
+// InsertRaw adds a document to the batch, first inserting the batch if the
+// document would make it too large, and inserting it once it is full.
+func (ti *transactionInserter) InsertRaw(rawBytes []byte) (*mongo.BulkWriteResult, error) {
+	var result *mongo.BulkWriteResult
+	if len(ti.docs) > 0 && ti.bytes+len(rawBytes) > maxTransactionBatchBytes {
+		var err error
+		if result, err = ti.Flush(); err != nil {
+			return result, err
+		}
+	}
+	ti.docs = append(ti.docs, bson.Raw(rawBytes))
+	ti.bytes += len(rawBytes)
+	if len(ti.docs) < ti.batchSize {
+		return result, nil
+	}
+	flushed, err := ti.Flush()
+	if result != nil && flushed != nil {
+		flushed.InsertedCount += result.InsertedCount
+	}
+	return flushed, err
+}
+
+// Flush inserts the documents of the batch in a transaction, which the
+// driver retries if it fails with a transient error.
+func (ti *transactionInserter) Flush() (*mongo.BulkWriteResult, error) {
+	if len(ti.docs) == 0 {
+		return nil, nil
+	}
+	docs := ti.docs
+	ti.docs, ti.bytes = nil, 0
+
+	session, err := ti.client.StartSession()
+	if err != nil {
+		return &mongo.BulkWriteResult{}, &transactionError{Documents: len(docs), Err: err}
+	}
+	defer session.EndSession(context.Background())
+
+	_, err = session.WithTransaction(context.Background(), func(sc mongo.SessionContext) (interface{}, error) {
+		return ti.collection.InsertMany(sc, docs, ti.insertOpts)
+	})
+	if err != nil {
+		return &mongo.BulkWriteResult{}, &transactionError{Documents: len(docs), Err: err}
+	}
+	return &mongo.BulkWriteResult{InsertedCount: int64(len(docs))}, nil
+}
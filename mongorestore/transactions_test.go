@@ -0,0 +1,140 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/mongodb/mongo-tools/common/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestValidateTransactionOptions(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With --useTransactions", t, func() {
+		restore := &MongoRestore{
+			OutputOptions: &OutputOptions{UseTransactions: true, TransactionBatchSize: 100},
+			serverVersion: db.Version{4, 0, 0},
+		}
+
+		Convey("a replica set on 4.0 is supported", func() {
+			So(restore.validateTransactionOptions(db.ReplSet), ShouldBeNil)
+		})
+
+		Convey("a sharded cluster requires 4.2", func() {
+			So(restore.validateTransactionOptions(db.Mongos), ShouldNotBeNil)
+			restore.serverVersion = db.Version{4, 2, 0}
+			So(restore.validateTransactionOptions(db.Mongos), ShouldBeNil)
+		})
+
+		Convey("a standalone is rejected", func() {
+			restore.serverVersion = db.Version{4, 4, 0}
+			So(restore.validateTransactionOptions(db.Standalone), ShouldNotBeNil)
+		})
+
+		Convey("the batch size must be positive", func() {
+			restore.OutputOptions.TransactionBatchSize = 0
+			So(restore.validateTransactionOptions(db.ReplSet), ShouldNotBeNil)
+		})
+	})
+
+	Convey("Without --useTransactions any deployment is supported", t, func() {
+		restore := &MongoRestore{OutputOptions: &OutputOptions{}}
+		So(restore.validateTransactionOptions(db.Standalone), ShouldBeNil)
+	})
+}
+
+func TestTransactionErrorResult(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Every document of a rolled back transaction is a failure", t, func() {
+		cause := fmt.Errorf("E11000 duplicate key error")
+		err := &transactionError{Documents: 25, Err: cause}
+		result := NewResultFromBulkResult(&mongo.BulkWriteResult{}, err)
+		So(result.Successes, ShouldEqual, 0)
+		So(result.Failures, ShouldEqual, 25)
+		So(errors.Is(result.Err, cause), ShouldBeTrue)
+		So(db.FilterError(false, result.Err), ShouldNotBeNil)
+	})
+}
+
+func TestRestoreWithTransactions(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.IntegrationTestType)
+	ctx := context.Background()
+
+	sessionProvider, _, err := testutil.GetBareSessionProvider()
+	if err != nil {
+		t.Fatalf("No cluster available: %v", err)
+	}
+	session, err := sessionProvider.GetSession()
+	if err != nil {
+		t.Fatalf("No client available")
+	}
+	if ok, _ := sessionProvider.IsReplicaSet(); !ok {
+		t.SkipNow()
+	}
+
+	Convey("With --useTransactions and a batch size of 10", t, func() {
+		c1 := session.Database("db1").Collection("c1")
+		So(c1.Drop(ctx), ShouldBeNil)
+		defer c1.Drop(ctx)
+
+		restore, err := getRestoreWithArgs(
+			UseTransactionsOption,
+			TransactionBatchSizeOption, "10",
+			NumInsertionWorkersOption, "1",
+			MaintainInsertionOrderOption,
+		)
+		So(err, ShouldBeNil)
+		restore.ToolOptions.Namespace.DB = "db1"
+		restore.ToolOptions.Namespace.Collection = "c1"
+		restore.TargetDirectory = "testdata/testdirs/db1/c1.bson"
+
+		Convey("every batch is inserted", func() {
+			result := restore.Restore()
+			So(result.Err, ShouldBeNil)
+			So(result.Successes, ShouldEqual, 100)
+
+			count, err := c1.CountDocuments(ctx, bson.D{})
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 100)
+		})
+
+		Convey("a batch with a duplicate key is rolled back as a whole", func() {
+			// the 15th document of the dump is in the second batch
+			bsonFile, err := os.Open("testdata/testdirs/db1/c1.bson")
+			So(err, ShouldBeNil)
+			source := db.NewDecodedBSONSource(db.NewBSONSource(bsonFile))
+			var doc bson.Raw
+			for i := 0; i < 15; i++ {
+				doc = source.LoadNext()
+				So(doc, ShouldNotBeNil)
+			}
+			source.Close()
+			_, err = c1.InsertOne(ctx, bson.D{{Key: "_id", Value: doc.Lookup("_id")}})
+			So(err, ShouldBeNil)
+
+			result := restore.Restore()
+			So(result.Err, ShouldNotBeNil)
+			So(result.Successes, ShouldEqual, 10)
+			So(result.Failures, ShouldEqual, 10)
+
+			count, err := c1.CountDocuments(ctx, bson.D{})
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 11)
+		})
+	})
+}
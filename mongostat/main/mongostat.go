@@ -8,10 +8,17 @@
 package main
 
 import (
+	"io"
+	"io/ioutil"
 	"os"
+	"runtime"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/mongodb/mongo-tools/common/completion"
+	"github.com/mongodb/mongo-tools/common/exitcode"
+	"github.com/mongodb/mongo-tools/common/healthcheck"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/password"
 	"github.com/mongodb/mongo-tools/common/signals"
@@ -39,12 +46,16 @@ func optionKeyNames(option string) map[string]string {
 }
 
 // optionCustomHeaders interprets the CLI options Columns and AppendColumns
-// into a list of custom headers.
+// into a list of custom headers, in the order given, each listed once.
 func optionCustomHeaders(option string) (headers []string) {
+	seen := make(map[string]bool)
 	columns := strings.Split(option, ",")
 	for _, column := range columns {
 		naming := strings.Split(column, "=")
-		headers = append(headers, naming[0])
+		if !seen[naming[0]] {
+			seen[naming[0]] = true
+			headers = append(headers, naming[0])
+		}
 	}
 	return
 }
@@ -60,7 +71,7 @@ func main() {
 	if err != nil {
 		log.Logvf(log.Always, "error parsing command line options: %s", err.Error())
 		log.Logvf(log.Always, util.ShortUsage("mongostat"))
-		os.Exit(util.ExitFailure)
+		os.Exit(util.ExitValidationFailure)
 	}
 
 	log.SetVerbosity(opts.Verbosity)
@@ -76,6 +87,21 @@ func main() {
 		return
 	}
 
+	// print the effective config, if specified
+	if opts.PrintEffectiveConfig() {
+		return
+	}
+
+	// generate shell completions, if requested
+	if _, ok := opts.CompletionArgs(); ok {
+		os.Exit(completion.Main(opts.ToolOptions))
+	}
+
+	// check the connection, credentials and privileges without running
+	if opts.HealthCheck {
+		os.Exit(healthcheck.Main(*opts.ToolOptions, opts.HealthCheckRequirements()))
+	}
+
 	// verify uri options and log them
 	opts.URI.LogUnsupportedOptions()
 
@@ -83,31 +109,168 @@ func main() {
 		// add logic to have different error if using uri
 		if opts.URI != nil && opts.URI.ConnectionString != "" {
 			log.Logvf(log.Always, "authSource is required when authenticating against a non $external database")
-			os.Exit(util.ExitFailure)
+			os.Exit(util.ExitValidationFailure)
 		}
 
 		log.Logvf(log.Always, "--authenticationDatabase is required when authenticating against a non $external database")
-		os.Exit(util.ExitFailure)
+		os.Exit(util.ExitValidationFailure)
 	}
 
 	if opts.Interactive && opts.Json {
 		log.Logvf(log.Always, "cannot use output formats --json and --interactive together")
-		os.Exit(util.ExitFailure)
+		os.Exit(util.ExitValidationFailure)
+	}
+
+	if opts.CSV && (opts.Json || opts.Interactive || opts.Transpose || opts.Prometheus != "") {
+		log.Logvf(log.Always, "cannot use --csv with --json, --interactive, --transpose or --prometheus")
+		os.Exit(util.ExitValidationFailure)
+	}
+
+	if opts.GraphiteOnly && opts.Graphite == "" {
+		log.Logvf(log.Always, "--graphiteOnly can only be used when --graphite is also specified")
+		os.Exit(util.ExitValidationFailure)
+	}
+
+	if opts.GraphiteOnly && opts.Interactive {
+		log.Logvf(log.Always, "cannot use --graphiteOnly with --interactive")
+		os.Exit(util.ExitValidationFailure)
+	}
+
+	var replSetName string
+	var replSetMembers []string
+	if opts.ReplSet != "" {
+		if opts.Discover {
+			log.Logvf(log.Always, "cannot use --replSet and --discover together")
+			os.Exit(util.ExitValidationFailure)
+		}
+		replSetName, replSetMembers, err = mongostat.ParseReplSetSeedList(opts.ReplSet)
+		if err != nil {
+			log.Logvf(log.Always, "invalid --replSet: %v", err)
+			os.Exit(util.ExitValidationFailure)
+		}
+	}
+
+	if opts.DiffOnly && opts.GaugesOnly {
+		log.Logvf(log.Always, "cannot use --diffOnly and --gaugesOnly together")
+		os.Exit(util.ExitValidationFailure)
+	}
+
+	if opts.Transpose && (opts.Json || opts.Interactive) {
+		log.Logvf(log.Always, "cannot use --transpose with --json or --interactive")
+		os.Exit(util.ExitValidationFailure)
+	}
+
+	if opts.Prometheus != "" && (opts.Json || opts.Interactive || opts.Transpose) {
+		log.Logvf(log.Always, "cannot use --prometheus with --json, --interactive or --transpose")
+		os.Exit(util.ExitValidationFailure)
+	}
+
+	if opts.OnlyChanged && opts.Interactive {
+		log.Logvf(log.Always, "cannot use --onlyChanged with --interactive")
+		os.Exit(util.ExitValidationFailure)
 	}
 
 	if opts.Deprecated && !opts.Json {
 		log.Logvf(log.Always, "--useDeprecatedJsonKeys can only be used when --json is also specified")
-		os.Exit(util.ExitFailure)
+		os.Exit(util.ExitValidationFailure)
+	}
+
+	if opts.JsonIncludesRaw && !opts.Json {
+		log.Logvf(log.Always, "--jsonIncludesRaw can only be used when --json is also specified")
+		os.Exit(util.ExitValidationFailure)
 	}
 
 	if opts.Columns != "" && opts.AppendColumns != "" {
 		log.Logvf(log.Always, "-O cannot be used if -o is also specified")
-		os.Exit(util.ExitFailure)
+		os.Exit(util.ExitValidationFailure)
+	}
+
+	if opts.Sys {
+		if runtime.GOOS != "linux" {
+			log.Logvf(log.Always, "--sys is only supported on Linux")
+			os.Exit(util.ExitValidationFailure)
+		}
+		if opts.Discover || opts.ReplSet != "" || strings.Contains(opts.Host, ",") {
+			log.Logvf(log.Always, "--sys can only be used when monitoring a single host")
+			os.Exit(util.ExitValidationFailure)
+		}
+	}
+
+	if opts.RetryInterval < 0 {
+		log.Logvf(log.Always, "invalid value for --retryInterval: %v", opts.RetryInterval)
+		os.Exit(util.ExitValidationFailure)
+	}
+
+	if opts.Duration < 0 {
+		log.Logvf(log.Always, "invalid value for --duration: %v", opts.Duration)
+		os.Exit(util.ExitValidationFailure)
+	}
+
+	var location *time.Location
+	switch {
+	case opts.UTC && opts.TimeZone != "":
+		log.Logvf(log.Always, "cannot use --utc and --timeZone together")
+		os.Exit(util.ExitValidationFailure)
+	case opts.UTC:
+		location = time.UTC
+	case opts.TimeZone != "":
+		location, err = time.LoadLocation(opts.TimeZone)
+		if err != nil {
+			log.Logvf(log.Always, "invalid --timeZone: %v", err)
+			os.Exit(util.ExitValidationFailure)
+		}
 	}
 
 	if opts.HumanReadable != "true" && opts.HumanReadable != "false" {
 		log.Logvf(log.Always, "--humanReadable must be set to either 'true' or 'false'")
-		os.Exit(util.ExitFailure)
+		os.Exit(util.ExitValidationFailure)
+	}
+
+	var changeThreshold float64
+	if opts.OnlyChanged {
+		changeThreshold, err = mongostat.ParsePercentage(opts.ChangeThreshold)
+		if err != nil {
+			log.Logvf(log.Always, "invalid --changeThreshold: %v", err)
+			os.Exit(util.ExitValidationFailure)
+		}
+	}
+
+	if (opts.AnomalyLog == "") != (len(opts.AnomalyThresholds) == 0) {
+		log.Logvf(log.Always, "--anomalyLog and --anomalyThreshold must be specified together")
+		os.Exit(util.ExitValidationFailure)
+	}
+
+	var anomalyThresholds []*stat_consumer.AnomalyThreshold
+	for _, spec := range opts.AnomalyThresholds {
+		threshold, err := stat_consumer.ParseAnomalyThreshold(spec)
+		if err != nil {
+			log.Logvf(log.Always, "invalid --anomalyThreshold: %v", err)
+			os.Exit(util.ExitValidationFailure)
+		}
+		anomalyThresholds = append(anomalyThresholds, threshold)
+	}
+
+	var sparkline *stat_consumer.Sparkline
+	if opts.Sparkline != "" {
+		sparkline, err = stat_consumer.ParseSparkline(opts.Sparkline)
+		if err != nil {
+			log.Logvf(log.Always, "invalid --sparkline: %v", err)
+			os.Exit(util.ExitValidationFailure)
+		}
+	}
+
+	if opts.HeaderInterval < 0 {
+		log.Logvf(log.Always, "--headerInterval must not be negative")
+		os.Exit(util.ExitValidationFailure)
+	}
+
+	var headerMap map[string]string
+	if opts.HeaderMap != "" {
+		headerMap, err = mongostat.ParseHeaderMap(opts.HeaderMap)
+		if err != nil {
+			log.Logvf(log.Always, "invalid --headerMap: %v", err)
+			os.Exit(util.ExitValidationFailure)
+		}
 	}
 
 	// we have to check this here, otherwise the user will be prompted
@@ -126,10 +289,31 @@ func main() {
 		factory = stat_consumer.FormatterConstructors["json"]
 	} else if opts.Interactive {
 		factory = stat_consumer.FormatterConstructors["interactive"]
+	} else if opts.Transpose {
+		factory = stat_consumer.FormatterConstructors["transposed"]
+	} else if opts.Prometheus != "" {
+		factory = stat_consumer.FormatterConstructors["prometheus"]
+	} else if opts.CSV {
+		factory = stat_consumer.FormatterConstructors["csv"]
 	} else {
 		factory = stat_consumer.FormatterConstructors[""]
 	}
-	formatter := factory(opts.RowCount, !opts.NoHeaders)
+	formatter := factory(opts.RowCount, !opts.NoHeaders && !opts.NoHeadersAlias)
+	if grid, ok := formatter.(*stat_consumer.GridLineFormatter); ok {
+		grid.SetHeaderInterval(opts.HeaderInterval)
+	}
+	if transposed, ok := formatter.(*stat_consumer.TransposedLineFormatter); ok {
+		// only a terminal can redraw the previous grid
+		if info, err := os.Stdout.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			transposed.SetInPlace(true)
+		}
+	}
+	if exporter, ok := formatter.(*stat_consumer.PrometheusLineFormatter); ok {
+		if err := exporter.Serve(opts.Prometheus); err != nil {
+			log.Logvf(log.Always, "%v", err)
+			os.Exit(util.ExitFailure)
+		}
+	}
 
 	cliFlags := 0
 	if opts.Columns == "" {
@@ -141,7 +325,15 @@ func main() {
 		if opts.All {
 			cliFlags |= line.FlagAll
 		}
-		if strings.Contains(opts.Host, ",") {
+		if opts.Sys {
+			cliFlags |= line.FlagSys
+		}
+		if opts.Json {
+			cliFlags |= line.FlagJSON
+		}
+		// each CSV row names its host, so that runs against several hosts
+		// can be told apart
+		if strings.Contains(opts.Host, ",") || opts.ReplSet != "" || opts.CSV {
 			cliFlags |= line.FlagHosts
 		}
 	}
@@ -152,45 +344,147 @@ func main() {
 	} else if opts.AppendColumns != "" {
 		customHeaders = optionCustomHeaders(opts.AppendColumns)
 	}
+	if opts.Prometheus != "" && opts.Columns == "" {
+		// every field is served, along with any custom fields given with -O
+		cliFlags = 0
+		var allHeaders []string
+		for key := range line.StatHeaders {
+			allHeaders = append(allHeaders, key)
+		}
+		sort.Strings(allHeaders)
+		for _, key := range customHeaders {
+			if _, ok := line.StatHeaders[key]; !ok {
+				allHeaders = append(allHeaders, key)
+			}
+		}
+		customHeaders = allHeaders
+	}
 
+	// columns are named by the chosen key map, then by any names given with
+	// -o or -O, and then by --headerMap
 	var keyNames map[string]string
 	if opts.Deprecated {
 		keyNames = line.DeprecatedKeyMap()
-	} else if opts.Columns == "" {
-		keyNames = line.DefaultKeyMap()
 	} else {
-		keyNames = optionKeyNames(opts.Columns)
+		keyNames = line.DefaultKeyMap()
+	}
+	for _, option := range []string{opts.Columns, opts.AppendColumns} {
+		if option == "" {
+			continue
+		}
+		for k, v := range optionKeyNames(option) {
+			if _, ok := keyNames[k]; !ok || k != v {
+				keyNames[k] = v
+			}
+		}
 	}
-	if opts.AppendColumns != "" {
-		addKN := optionKeyNames(opts.AppendColumns)
-		for k, v := range addKN {
-			keyNames[k] = v
+	for k, v := range headerMap {
+		if _, ok := keyNames[k]; !ok {
+			log.Logvf(log.Always, "invalid --headerMap: '%v' is neither a default field nor one given with -o or -O", k)
+			os.Exit(util.ExitValidationFailure)
 		}
+		keyNames[k] = v
 	}
 
 	readerConfig := &status.ReaderConfig{
 		HumanReadable: opts.HumanReadable == "true",
+		IncludeRaw:    opts.JsonIncludesRaw || opts.Prometheus != "",
+		Location:      location,
+		// JSON output keeps its key names, and CSV output its header row, so
+		// amounts keep their own units
+		ScaleUnits: opts.HumanReadable == "true" && !opts.Json && !opts.CSV && opts.Prometheus == "",
 	}
 	if opts.Json {
 		readerConfig.TimeFormat = "15:04:05"
 	}
 
+	var output io.Writer = os.Stdout
+	if opts.GraphiteOnly {
+		output = ioutil.Discard
+	}
 	consumer := stat_consumer.NewStatConsumer(cliFlags, customHeaders,
-		keyNames, readerConfig, formatter, os.Stdout)
+		keyNames, readerConfig, formatter, output)
+	if opts.DiffOnly {
+		consumer.ShowOnlyKind(line.KindRate)
+	} else if opts.GaugesOnly {
+		consumer.ShowOnlyKind(line.KindGauge)
+	}
+	if opts.OnlyChanged {
+		consumer.ReportOnlyChanged(changeThreshold)
+	}
+	if opts.Duration > 0 {
+		consumer.StopAfter(opts.Duration)
+	}
+	if sparkline != nil {
+		consumer.ShowSparkline(sparkline)
+	}
+	if opts.AnomalyLog != "" {
+		anomalyLog, err := os.OpenFile(opts.AnomalyLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			log.Logvf(log.Always, "error opening --anomalyLog: %v", err)
+			os.Exit(util.ExitFailure)
+		}
+		defer anomalyLog.Close()
+		consumer.LogAnomalies(anomalyLog, anomalyThresholds)
+	}
+	if opts.SQLite != "" {
+		store, err := stat_consumer.OpenSampleStore(opts.SQLite)
+		if err != nil {
+			log.Logvf(log.Always, "error opening --sqlite database: %v", err)
+			os.Exit(util.ExitFailure)
+		}
+		defer store.Close()
+		consumer.StoreSamples(store)
+	}
+	if opts.Graphite != "" {
+		sink, err := stat_consumer.DialGraphite(opts.Graphite, opts.GraphitePrefix)
+		if err != nil {
+			log.Logvf(log.Always, "%v", err)
+			os.Exit(util.ExitFailure)
+		}
+		defer sink.Close()
+		consumer.PushToGraphite(sink)
+	}
+	if opts.StatsD != "" {
+		sink, err := stat_consumer.DialStatsD(opts.StatsD, opts.StatsDPrefix, opts.StatsDHostTag)
+		if err != nil {
+			log.Logvf(log.Always, "%v", err)
+			os.Exit(util.ExitFailure)
+		}
+		defer sink.Close()
+		consumer.EmitToStatsD(sink)
+	}
+	if opts.OTLPEndpoint != "" {
+		exporter, err := stat_consumer.NewOTLPExporter(opts.OTLPEndpoint)
+		if err != nil {
+			log.Logvf(log.Always, "%v", err)
+			os.Exit(util.ExitValidationFailure)
+		}
+		consumer.ExportToOTLP(exporter)
+	}
 	seedHosts := util.CreateConnectionAddrs(opts.Host, opts.Port)
+	if opts.ReplSet != "" {
+		seedHosts = replSetMembers
+	}
 	var cluster mongostat.ClusterMonitor
-	if opts.Discover || len(seedHosts) > 1 {
-		cluster = &mongostat.AsyncClusterMonitor{
+	if opts.Discover || opts.ReplSet != "" || len(seedHosts) > 1 {
+		async := &mongostat.AsyncClusterMonitor{
 			ReportChan:    make(chan *status.ServerStatus),
 			ErrorChan:     make(chan *status.NodeError),
 			LastStatLines: map[string]*line.StatLine{},
 			Consumer:      consumer,
+			OnError:       opts.OnError,
+		}
+		if opts.ReplSet != "" {
+			async.WatchReplSet(replSetName, replSetMembers)
 		}
+		cluster = async
 	} else {
 		cluster = &mongostat.SyncClusterMonitor{
 			ReportChan: make(chan *status.ServerStatus),
 			ErrorChan:  make(chan *status.NodeError),
 			Consumer:   consumer,
+			OnError:    opts.OnError,
 		}
 	}
 
@@ -212,7 +506,7 @@ func main() {
 	for _, v := range seedHosts {
 		if err := stat.AddNewNode(v); err != nil {
 			log.Logv(log.Always, err.Error())
-			os.Exit(util.ExitFailure)
+			os.Exit(exitcode.Of(err))
 		}
 	}
 
@@ -224,6 +518,6 @@ func main() {
 	formatter.Finish()
 	if err != nil {
 		log.Logvf(log.Always, "Failed: %v", err)
-		os.Exit(util.ExitFailure)
+		os.Exit(exitcode.Of(err))
 	}
 }
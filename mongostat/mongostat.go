@@ -12,17 +12,32 @@ import (
 	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/util"
 	"github.com/mongodb/mongo-tools/mongostat/stat_consumer"
 	"github.com/mongodb/mongo-tools/mongostat/stat_consumer/line"
 	"github.com/mongodb/mongo-tools/mongostat/status"
 	"go.mongodb.org/mongo-driver/bson"
 )
 
+// How the rows of hosts which could not be sampled are shown, see --onError.
+// The zero value shows the error.
+const (
+	OnErrorShow  = "error"
+	OnErrorKeep  = "keep"
+	OnErrorBlank = "blank"
+	OnErrorDrop  = "drop"
+)
+
+// sampleSequence numbers the samples of all nodes in the order they are
+// taken.
+var sampleSequence uint64
+
 // MongoStat is a container for the user-specified options and
 // internal cluster state used for running mongostat.
 type MongoStat struct {
@@ -68,6 +83,16 @@ type NodeMonitor struct {
 
 	// The most recent error encountered when collecting stats for this node.
 	Err error
+
+	// Whether to read host-level stats from /proc along with each sample.
+	SysStats bool
+
+	// How long to wait after failing to sample the node before trying again,
+	// if longer than the polling interval.
+	RetryInterval time.Duration
+
+	// Round-trip times of the node's recent serverStatus commands.
+	pings *status.LatencyWindow
 }
 
 // SyncClusterMonitor is an implementation of ClusterMonitor that writes output
@@ -82,6 +107,10 @@ type SyncClusterMonitor struct {
 
 	// Creates and consumes StatLines using ServerStatuses
 	Consumer *stat_consumer.StatConsumer
+
+	// How to show the host when it could not be sampled, one of the OnError
+	// modes
+	OnError string
 }
 
 // ClusterMonitor maintains an internal representation of a cluster's state,
@@ -117,6 +146,23 @@ type AsyncClusterMonitor struct {
 
 	// Creates and consumes StatLines using ServerStatuses
 	Consumer *stat_consumer.StatConsumer
+
+	// How to show hosts which could not be sampled, one of the OnError modes
+	OnError string
+
+	// Hosts whose latest sample failed while OnError is set to keep, blank
+	// or drop. Protected by mapLock.
+	failing map[string]bool
+
+	// Name of the replica set watched with WatchReplSet, or empty
+	ReplSet string
+
+	// The time at which each watched member last responded, the member
+	// known to be primary, and the members found to belong to another set.
+	// Protected by mapLock.
+	lastSeen     map[string]time.Time
+	primary      string
+	otherSetWarn map[string]bool
 }
 
 // Update refreshes the internal state of the cluster monitor with the data
@@ -135,23 +181,42 @@ func (cluster *SyncClusterMonitor) Update(stat *status.ServerStatus, err *status
 // in, it formats and then displays it to stdout.
 func (cluster *SyncClusterMonitor) Monitor(_ time.Duration) error {
 	receivedData := false
+	failing := false
+	var lastLine *line.StatLine
 	for {
 		var statLine *line.StatLine
 		var ok bool
 		select {
 		case stat := <-cluster.ReportChan:
+			if failing {
+				log.Logvf(log.Always, "%v: reconnected", stat.Host)
+				failing = false
+			}
 			statLine, ok = cluster.Consumer.Update(stat)
 			if !ok {
 				continue
 			}
+			lastLine = statLine
 		case err := <-cluster.ErrorChan:
 			if !receivedData {
 				return err
 			}
-			statLine = &line.StatLine{
-				Error:  err,
-				Fields: map[string]string{"host": err.Host},
+			if !isShown(cluster.OnError) {
+				statLine = &line.StatLine{
+					Error:  err,
+					Fields: map[string]string{"host": err.Host},
+				}
+				break
+			}
+			if !failing {
+				log.Logvf(log.Always, "%v: %v", err.Host, err)
+				failing = true
 			}
+			if statLine = failedLine(cluster.OnError, err.Host, lastLine); statLine == nil {
+				continue
+			}
+		case <-cluster.Consumer.Expired():
+			return nil
 		}
 		receivedData = true
 		if cluster.Consumer.FormatLines([]*line.StatLine{statLine}) {
@@ -160,22 +225,66 @@ func (cluster *SyncClusterMonitor) Monitor(_ time.Duration) error {
 	}
 }
 
+// isShown returns whether failed samples are shown as errors in the given
+// OnError mode.
+func isShown(onError string) bool {
+	return onError != OnErrorKeep && onError != OnErrorBlank && onError != OnErrorDrop
+}
+
+// failedLine returns the row to show for a host which could not be sampled
+// in the given OnError mode, keep, blank or drop, given its last row, if
+// any. It returns nil if the host is not to be shown.
+func failedLine(onError, host string, last *line.StatLine) *line.StatLine {
+	switch {
+	case onError == OnErrorDrop:
+		return nil
+	case onError == OnErrorKeep && last != nil && last.Error == nil:
+		return last.Stale()
+	}
+	return &line.StatLine{Fields: map[string]string{"host": host}}
+}
+
 // updateHostInfo updates the internal map with the given StatLine data.
 // Safe for concurrent access.
 func (cluster *AsyncClusterMonitor) updateHostInfo(stat *line.StatLine) {
 	cluster.mapLock.Lock()
 	defer cluster.mapLock.Unlock()
 	host := stat.Fields["host"]
+	if cluster.failing[host] {
+		log.Logvf(log.Always, "%v: reconnected", host)
+		delete(cluster.failing, host)
+	}
 	cluster.LastStatLines[host] = stat
 }
 
+// updateFailedHost records that a host could not be sampled, while OnError
+// is set to keep, blank or drop. Its last row is kept, to be shown in the
+// way OnError asks for. Safe for concurrent access.
+func (cluster *AsyncClusterMonitor) updateFailedHost(err *status.NodeError) {
+	cluster.mapLock.Lock()
+	defer cluster.mapLock.Unlock()
+	if cluster.failing == nil {
+		cluster.failing = map[string]bool{}
+	}
+	if !cluster.failing[err.Host] {
+		log.Logvf(log.Always, "%v: %v", err.Host, err)
+		cluster.failing[err.Host] = true
+	}
+}
+
 // printSnapshot formats and dumps the current state of all the stats collected.
 // returns whether the program should now exit
 func (cluster *AsyncClusterMonitor) printSnapshot() bool {
 	cluster.mapLock.RLock()
 	defer cluster.mapLock.RUnlock()
 	lines := make([]*line.StatLine, 0, len(cluster.LastStatLines))
-	for _, stat := range cluster.LastStatLines {
+	for host, stat := range cluster.LastStatLines {
+		if cluster.failing[host] {
+			// a fresh row every time, so that it is not taken as missing
+			if stat = failedLine(cluster.OnError, host, stat); stat == nil {
+				continue
+			}
+		}
 		lines = append(lines, stat)
 	}
 	if len(lines) == 0 {
@@ -184,6 +293,83 @@ func (cluster *AsyncClusterMonitor) printSnapshot() bool {
 	return cluster.Consumer.FormatLines(lines)
 }
 
+// WatchReplSet makes the cluster monitor show exactly the given members of
+// the named replica set. Each member keeps its row while it cannot be
+// polled, marked DOWN with the time it last responded, and changes of
+// primary are logged.
+func (cluster *AsyncClusterMonitor) WatchReplSet(name string, members []string) {
+	cluster.mapLock.Lock()
+	defer cluster.mapLock.Unlock()
+	cluster.ReplSet = name
+	cluster.lastSeen = map[string]time.Time{}
+	cluster.otherSetWarn = map[string]bool{}
+	for _, member := range members {
+		cluster.LastStatLines[member] = downLine(member, time.Time{}, fmt.Errorf("not polled yet"))
+	}
+}
+
+// downLine returns the row of a replica set member which could not be
+// polled, marked DOWN with the time it last responded.
+func downLine(host string, lastSeen time.Time, err error) *line.StatLine {
+	seen := "never seen"
+	if !lastSeen.IsZero() {
+		seen = "last seen " + lastSeen.Format("2006-01-02 15:04:05")
+	}
+	return &line.StatLine{
+		Error:  fmt.Errorf("DOWN (%v): %v", seen, err),
+		Fields: map[string]string{"host": host},
+	}
+}
+
+// trackMember records that a member of the watched replica set responded
+// with stat, and logs any change of primary it reveals.
+func (cluster *AsyncClusterMonitor) trackMember(stat *status.ServerStatus) {
+	cluster.mapLock.Lock()
+	defer cluster.mapLock.Unlock()
+	host := stat.Host
+	cluster.lastSeen[host] = stat.SampleTime
+	if l := cluster.LastStatLines[host]; l != nil && l.Error != nil {
+		// rates need a second sample before the member's row can be shown
+		cluster.LastStatLines[host] = &line.StatLine{
+			Error:  fmt.Errorf("waiting for a second sample"),
+			Fields: map[string]string{"host": host},
+		}
+	}
+	if stat.Repl == nil {
+		return
+	}
+	if stat.Repl.SetName != cluster.ReplSet && !cluster.otherSetWarn[host] {
+		log.Logvf(log.Always, "warning: %v is a member of replica set '%v', not '%v'",
+			host, stat.Repl.SetName, cluster.ReplSet)
+		cluster.otherSetWarn[host] = true
+	}
+	isPrimary := util.IsTruthy(stat.Repl.IsMaster)
+	switch {
+	case isPrimary && cluster.primary != host:
+		if cluster.primary == "" {
+			log.Logvf(log.Always, "primary of replica set %v is now %v", cluster.ReplSet, host)
+		} else {
+			log.Logvf(log.Always, "primary of replica set %v changed from %v to %v", cluster.ReplSet, cluster.primary, host)
+		}
+		cluster.primary = host
+	case !isPrimary && cluster.primary == host:
+		log.Logvf(log.Always, "%v is no longer primary of replica set %v", host, cluster.ReplSet)
+		cluster.primary = ""
+	}
+}
+
+// trackDownMember returns the row of a member of the watched replica set
+// which could not be polled, and logs if it was the primary.
+func (cluster *AsyncClusterMonitor) trackDownMember(err *status.NodeError) *line.StatLine {
+	cluster.mapLock.Lock()
+	defer cluster.mapLock.Unlock()
+	if cluster.primary == err.Host {
+		log.Logvf(log.Always, "primary %v of replica set %v is DOWN", err.Host, cluster.ReplSet)
+		cluster.primary = ""
+	}
+	return downLine(err.Host, cluster.lastSeen[err.Host], err)
+}
+
 // Update sends a new StatLine on the cluster's report channel.
 func (cluster *AsyncClusterMonitor) Update(stat *status.ServerStatus, err *status.NodeError) {
 	if err != nil {
@@ -196,23 +382,43 @@ func (cluster *AsyncClusterMonitor) Update(stat *status.ServerStatus, err *statu
 // The Async implementation of Monitor starts the goroutines that listen for incoming stat data,
 // and dump snapshots at a regular interval.
 func (cluster *AsyncClusterMonitor) Monitor(sleep time.Duration) error {
-	select {
-	case stat := <-cluster.ReportChan:
-		cluster.Consumer.Update(stat)
-	case err := <-cluster.ErrorChan:
-		// error out if the first result is an error
-		return err
+	// a watched replica set is shown even while its members are down
+	if cluster.ReplSet == "" {
+		select {
+		case stat := <-cluster.ReportChan:
+			cluster.Consumer.Update(stat)
+		case err := <-cluster.ErrorChan:
+			// error out if the first result is an error
+			return err
+		case <-cluster.Consumer.Expired():
+			return nil
+		}
 	}
 
 	go func() {
 		for {
 			select {
 			case stat := <-cluster.ReportChan:
+				if cluster.ReplSet != "" {
+					cluster.trackMember(stat)
+				}
 				statLine, ok := cluster.Consumer.Update(stat)
 				if ok {
 					cluster.updateHostInfo(statLine)
 				}
 			case err := <-cluster.ErrorChan:
+				var down *line.StatLine
+				if cluster.ReplSet != "" {
+					down = cluster.trackDownMember(err)
+				}
+				switch {
+				case !isShown(cluster.OnError):
+					cluster.updateFailedHost(err)
+					continue
+				case down != nil:
+					cluster.updateHostInfo(down)
+					continue
+				}
 				cluster.updateHostInfo(&line.StatLine{
 					Error:  err,
 					Fields: map[string]string{"host": err.Host},
@@ -221,12 +427,18 @@ func (cluster *AsyncClusterMonitor) Monitor(sleep time.Duration) error {
 		}
 	}()
 
-	for range time.Tick(sleep) {
-		if cluster.printSnapshot() {
-			break
+	ticker := time.NewTicker(sleep)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if cluster.printSnapshot() {
+				return nil
+			}
+		case <-cluster.Consumer.Expired():
+			return nil
 		}
 	}
-	return nil
 }
 
 // NewNodeMonitor copies the same connection settings from an instance of
@@ -255,6 +467,7 @@ func NewNodeMonitor(opts options.ToolOptions, fullHost string) (*NodeMonitor, er
 		sessionProvider: sessionProvider,
 		LastUpdate:      time.Now(),
 		Err:             nil,
+		pings:           status.NewLatencyWindow(),
 	}, nil
 }
 
@@ -283,7 +496,9 @@ func (node *NodeMonitor) Poll(discover chan string, checkShards bool) (*status.S
 	}
 	log.Logvf(log.DebugHigh, "got session on server: %v", node.host)
 
+	start := time.Now()
 	result := session.Database("admin").RunCommand(nil, bson.D{{"serverStatus", 1}, {"recordStats", 0}})
+	rtt := time.Since(start)
 	err = result.Err()
 	if err != nil {
 		log.Logvf(log.DebugLow, "got error calling serverStatus against server %v", node.host)
@@ -306,9 +521,17 @@ func (node *NodeMonitor) Poll(discover chan string, checkShards bool) (*status.S
 		return nil, fmt.Errorf("Error flattening serverStatus: %v\n", err)
 	}
 	stat.Flattened = status.Flatten(statMap)
+	stat.Raw = tempBson
 
 	node.Err = nil
 	stat.SampleTime = time.Now()
+	stat.Sequence = atomic.AddUint64(&sampleSequence, 1)
+	stat.Ping = node.pings.Add(rtt)
+	if node.SysStats {
+		if stat.Sys, err = status.ReadSysStats(); err != nil {
+			log.Logvf(log.DebugLow, "error reading system stats: %v", err)
+		}
+	}
 
 	if stat.Repl != nil && discover != nil {
 		for _, host := range stat.Repl.Hosts {
@@ -342,12 +565,26 @@ func (node *NodeMonitor) Poll(discover chan string, checkShards bool) (*status.S
 	return stat, nil
 }
 
+// skippedSamples returns how many samples were skipped because a poll that
+// was due at due ran until now, and when the next sample is due. Samples stay
+// on the schedule set by the first one, so the time spent polling does not
+// make them drift.
+func skippedSamples(due, now time.Time, interval time.Duration) (int, time.Time) {
+	skipped := 0
+	if now.After(due) {
+		skipped = int(now.Sub(due) / interval)
+	}
+	return skipped, due.Add(time.Duration(skipped+1) * interval)
+}
+
 // Watch continuously collects and processes stats for a single node on a
 // regular interval. At each interval, it triggers the node's Poll function
 // with the 'discover' channel.
 func (node *NodeMonitor) Watch(sleep time.Duration, discover chan string, cluster ClusterMonitor) {
 	var cycle uint64
-	for ticker := time.Tick(sleep); ; <-ticker {
+	ticker := time.NewTicker(sleep)
+	defer ticker.Stop()
+	for due := time.Now(); ; {
 		log.Logvf(log.DebugHigh, "polling server: %v", node.host)
 		stat, err := node.Poll(discover, cycle%10 == 0)
 
@@ -360,6 +597,33 @@ func (node *NodeMonitor) Watch(sleep time.Duration, discover chan string, cluste
 		}
 		cluster.Update(stat, nodeError)
 		cycle++
+
+		if err != nil && node.RetryInterval > sleep {
+			// wait before reconnecting, rather than failing again at every
+			// interval, and then sample on a new schedule
+			time.Sleep(node.RetryInterval)
+			select {
+			case <-ticker.C:
+			default:
+			}
+			due = time.Now()
+			continue
+		}
+
+		polled := due
+		now := time.Now()
+		var skipped int
+		if skipped, due = skippedSamples(polled, now, sleep); skipped > 0 {
+			log.Logvf(log.Always, "warning: skipped %v sample(s) of %v because polling took %v, longer than the %v interval",
+				skipped, node.host, now.Sub(polled), sleep)
+			// drop the tick that came due while polling, so that the next
+			// sample is taken on schedule rather than immediately
+			select {
+			case <-ticker.C:
+			default:
+			}
+		}
+		<-ticker.C
 	}
 }
 
@@ -394,6 +658,10 @@ func (mstat *MongoStat) AddNewNode(fullhost string) error {
 	if err != nil {
 		return err
 	}
+	if mstat.StatOptions != nil {
+		node.SysStats = mstat.StatOptions.Sys
+		node.RetryInterval = mstat.StatOptions.RetryInterval
+	}
 	mstat.Nodes[fullhost] = node
 	go node.Watch(mstat.SleepInterval, mstat.Discovered, mstat.Cluster)
 	return nil
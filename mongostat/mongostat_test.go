@@ -7,16 +7,24 @@
 package mongostat
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/mongodb/mongo-tools/mongostat/stat_consumer"
 	"github.com/mongodb/mongo-tools/mongostat/stat_consumer/line"
 	"github.com/mongodb/mongo-tools/mongostat/status"
 	. "github.com/smartystreets/goconvey/convey"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func readBSONFile(file string, t *testing.T) (stat *status.ServerStatus) {
@@ -102,6 +110,75 @@ func TestStatLine(t *testing.T) {
 	})
 }
 
+func TestStatLineMissingSections(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Columns whose serverStatus sections are missing show priv?", t, func() {
+		serverStatusOld := readBSONFile("test_data/server_status_old.bson", t)
+		serverStatusNew := readBSONFile("test_data/server_status_new.bson", t)
+
+		serverStatusNew.Network = nil
+
+		statsLine := line.NewStatLine(serverStatusOld, serverStatusNew, []string{"conn", "net_in", "net_out"},
+			&status.ReaderConfig{HumanReadable: true})
+		So(statsLine.Fields["conn"], ShouldEqual, "5")
+		So(statsLine.Fields["net_in"], ShouldEqual, status.PrivilegeMissing)
+		So(statsLine.Fields["net_out"], ShouldEqual, status.PrivilegeMissing)
+	})
+}
+
+func TestStatLineRawValues(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	serverStatusOld := readBSONFile("test_data/server_status_old.bson", t)
+	serverStatusNew := readBSONFile("test_data/server_status_new.bson", t)
+	serverStatusNew.ShardCursorType = nil
+	serverStatusOld.ShardCursorType = nil
+	headers := []string{"insert", "command", "locked_db", "qrw", "net_in", "conn", "set"}
+
+	Convey("Raw values are only read when requested", t, func() {
+		statsLine := line.NewStatLine(serverStatusOld, serverStatusNew, headers,
+			&status.ReaderConfig{HumanReadable: true})
+		So(statsLine.Raw, ShouldBeNil)
+	})
+
+	Convey("Raw values are machine readable numbers alongside the display strings", t, func() {
+		statsLine := line.NewStatLine(serverStatusOld, serverStatusNew, headers,
+			&status.ReaderConfig{HumanReadable: true, IncludeRaw: true})
+		So(statsLine.Fields["net_in"], ShouldEqual, "2.00k")
+		So(statsLine.Raw["net_in"], ShouldEqual, int64(2000))
+		So(statsLine.Raw["insert"], ShouldEqual, int64(10))
+		So(statsLine.Raw["qrw"], ShouldResemble, []interface{}{int64(3), int64(2)})
+		So(statsLine.Raw["conn"], ShouldEqual, int64(5))
+		So(statsLine.Raw["locked_db"], ShouldEqual, "test:50.0%")
+		So(statsLine.Raw["set"], ShouldBeNil)
+
+		Convey("and are output by the JSON formatter", func() {
+			formatter := stat_consumer.NewJSONLineFormatter(0, false)
+			out := formatter.FormatLines([]*line.StatLine{statsLine}, []string{"net_in", "qrw"},
+				map[string]string{"net_in": "net_in", "qrw": "qrw"})
+			So(out, ShouldContainSubstring, `"net_in":{"display":"2.00k","raw":2000}`)
+			So(out, ShouldContainSubstring, `"qrw":{"display":"3|2","raw":[3,2]}`)
+		})
+	})
+
+	Convey("Raw times are in the time zone the sample times are shown in", t, func() {
+		serverStatusNew.SampleTime = time.Date(2020, 1, 2, 14, 4, 5, 0, time.UTC)
+		statsLine := line.NewStatLine(serverStatusOld, serverStatusNew, []string{"time"},
+			&status.ReaderConfig{HumanReadable: true, IncludeRaw: true, Location: time.UTC})
+		So(statsLine.Raw["time"], ShouldEqual, "2020-01-02T14:04:05Z")
+	})
+
+	Convey("RawValue converts formatted fields", t, func() {
+		So(line.RawValue("*12"), ShouldEqual, int64(12))
+		So(line.RawValue("12.5"), ShouldEqual, 12.5)
+		So(line.RawValue("45.1%"), ShouldEqual, 45.1)
+		So(line.RawValue("0.860|42.000"), ShouldResemble, []interface{}{0.86, 42.0})
+		So(line.RawValue("PRI"), ShouldEqual, "PRI")
+		So(line.RawValue(""), ShouldBeNil)
+	})
+}
+
 func TestIsMongos(t *testing.T) {
 	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
 
@@ -126,3 +203,819 @@ func TestIsMongos(t *testing.T) {
 		So(runCheck("mongodb/bin/mongod"), ShouldBeFalse)
 	})
 }
+
+func TestReadEvents(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	newStat := func(isMaster bool, electionID primitive.ObjectID, rbid int32) *status.ServerStatus {
+		return &status.ServerStatus{Repl: &status.ReplStatus{
+			SetName:    "rs",
+			IsMaster:   isMaster,
+			Secondary:  !isMaster,
+			ElectionID: electionID,
+			RBID:       rbid,
+		}}
+	}
+	firstElection, secondElection := primitive.NewObjectID(), primitive.NewObjectID()
+
+	Convey("ReadEvents should report replica set events between samples", t, func() {
+		oldStat := newStat(false, firstElection, 1)
+		So(status.ReadEvents(nil, newStat(false, firstElection, 1), oldStat), ShouldEqual, "")
+		So(status.ReadEvents(nil, newStat(true, secondElection, 1), oldStat), ShouldEqual, "STATE:SEC->PRI,ELECTION")
+		So(status.ReadEvents(nil, newStat(false, firstElection, 2), oldStat), ShouldEqual, "ROLLBACK")
+		So(status.ReadEvents(nil, &status.ServerStatus{}, oldStat), ShouldEqual, "")
+	})
+}
+
+func TestStatLineChangedFrom(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	headers := []string{"host", "insert", "qrw", "net_in", "locked_db", "repl", "time"}
+	newLine := func(insert, qrw, netIn, lockedDB, repl, time string) *line.StatLine {
+		return &line.StatLine{
+			Fields: map[string]string{
+				"host":      "localhost:27017",
+				"insert":    insert,
+				"qrw":       qrw,
+				"net_in":    netIn,
+				"locked_db": lockedDB,
+				"repl":      repl,
+				"time":      time,
+			},
+		}
+	}
+	prev := newLine("100", "1|0", "2.00k", "test:10.0%", "PRI", "10:00:00")
+
+	Convey("With a 10% change threshold", t, func() {
+		Convey("a line without a previous line is always changed", func() {
+			So(prev.ChangedFrom(nil, headers, 0.1), ShouldBeTrue)
+		})
+		Convey("small movements and timestamps are not changes", func() {
+			l := newLine("105", "1|0", "2.10k", "test:10.5%", "PRI", "10:00:01")
+			So(l.ChangedFrom(prev, headers, 0.1), ShouldBeFalse)
+		})
+		Convey("a large movement in a single field is a change", func() {
+			So(newLine("*120", "1|0", "2.00k", "test:10.0%", "PRI", "10:00:01").ChangedFrom(prev, headers, 0.1), ShouldBeTrue)
+			So(newLine("100", "1|3", "2.00k", "test:10.0%", "PRI", "10:00:01").ChangedFrom(prev, headers, 0.1), ShouldBeTrue)
+			So(newLine("100", "1|0", "3.00k", "test:10.0%", "PRI", "10:00:01").ChangedFrom(prev, headers, 0.1), ShouldBeTrue)
+		})
+		Convey("non-numeric and labelled fields change when they differ", func() {
+			So(newLine("100", "1|0", "2.00k", "test:10.0%", "SEC", "10:00:01").ChangedFrom(prev, headers, 0.1), ShouldBeTrue)
+			So(newLine("100", "1|0", "2.00k", "admin:10.0%", "PRI", "10:00:01").ChangedFrom(prev, headers, 0.1), ShouldBeTrue)
+		})
+		Convey("lines with errors are always changed", func() {
+			l := newLine("100", "1|0", "2.00k", "test:10.0%", "PRI", "10:00:01")
+			l.Error = fmt.Errorf("no data received")
+			So(l.ChangedFrom(prev, headers, 0.1), ShouldBeTrue)
+		})
+	})
+}
+
+func TestAnomalyLog(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With an anomaly log and thresholds", t, func() {
+		threshold, err := stat_consumer.ParseAnomalyThreshold("conn>4")
+		So(err, ShouldBeNil)
+		So(threshold.Field, ShouldEqual, "conn")
+		So(threshold.Below, ShouldBeFalse)
+		So(threshold.Limit, ShouldEqual, 4)
+
+		out := &bytes.Buffer{}
+		newYork, err := time.LoadLocation("America/New_York")
+		So(err, ShouldBeNil)
+		consumer := stat_consumer.NewStatConsumer(0, []string{"conn", "net_in"}, nil,
+			&status.ReaderConfig{HumanReadable: true, Location: newYork}, nil, ioutil.Discard)
+		consumer.LogAnomalies(out, []*stat_consumer.AnomalyThreshold{threshold})
+
+		serverStatusOld := readBSONFile("test_data/server_status_old.bson", t)
+		serverStatusNew := readBSONFile("test_data/server_status_new.bson", t)
+		serverStatusOld.Raw, _ = bson.Marshal(bson.M{"sample": 1})
+		serverStatusNew.Raw, _ = bson.Marshal(bson.M{"sample": 2})
+
+		Convey("a sample which trips a threshold is logged with its predecessor", func() {
+			consumer.Update(serverStatusOld)
+			So(out.Len(), ShouldEqual, 0)
+			consumer.Update(serverStatusNew)
+
+			var entry struct {
+				Time       string                   `json:"time"`
+				Host       string                   `json:"host"`
+				Thresholds []string                 `json:"thresholds"`
+				Samples    []map[string]interface{} `json:"samples"`
+			}
+			So(json.Unmarshal(out.Bytes(), &entry), ShouldBeNil)
+			So(entry.Time, ShouldEqual, serverStatusNew.SampleTime.In(newYork).Format("2006-01-02T15:04:05.000Z07:00"))
+			So(entry.Thresholds, ShouldResemble, []string{"conn>4"})
+			So(len(entry.Samples), ShouldEqual, 2)
+			So(entry.Samples[0]["sample"], ShouldEqual, 1)
+			So(entry.Samples[1]["sample"], ShouldEqual, 2)
+		})
+
+		Convey("a sample within the thresholds is not logged", func() {
+			threshold, err = stat_consumer.ParseAnomalyThreshold("net_in<1k")
+			So(err, ShouldBeNil)
+			consumer.LogAnomalies(out, []*stat_consumer.AnomalyThreshold{threshold})
+			consumer.Update(serverStatusOld)
+			consumer.Update(serverStatusNew)
+			So(out.Len(), ShouldEqual, 0)
+		})
+	})
+
+	Convey("Invalid thresholds should fail to parse", t, func() {
+		for _, spec := range []string{"conn", ">5", "conn>", "conn>many"} {
+			_, err := stat_consumer.ParseAnomalyThreshold(spec)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestSparkline(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Sparklines should parse", t, func() {
+		sparkline, err := stat_consumer.ParseSparkline("qrw:5")
+		So(err, ShouldBeNil)
+		So(sparkline.Field, ShouldEqual, "qrw")
+		So(sparkline.Samples, ShouldEqual, 5)
+
+		sparkline, err = stat_consumer.ParseSparkline("ping")
+		So(err, ShouldBeNil)
+		So(sparkline.Samples, ShouldEqual, 20)
+
+		for _, spec := range []string{"", ":5", "ping:1", "ping:many"} {
+			_, err := stat_consumer.ParseSparkline(spec)
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("With a sparkline of a field that is not displayed", t, func() {
+		sparkline, err := stat_consumer.ParseSparkline("qrw:3")
+		So(err, ShouldBeNil)
+		out := &bytes.Buffer{}
+		keyNames := map[string]string{"conn": "conn"}
+		consumer := stat_consumer.NewStatConsumer(0, []string{"conn"}, keyNames,
+			&status.ReaderConfig{}, stat_consumer.NewGridLineFormatter(0, true), out)
+		consumer.ShowSparkline(sparkline)
+		So(keyNames[stat_consumer.SparklineKey], ShouldEqual, "qrw trend")
+
+		sample := func(queued int64) *status.ServerStatus {
+			return &status.ServerStatus{
+				Host: "localhost",
+				GlobalLock: &status.GlobalLockStats{
+					CurrentQueue: &status.QueueStats{Readers: queued, Writers: 1},
+				},
+			}
+		}
+
+		consumer.Update(sample(0))
+		var l *line.StatLine
+		for _, queued := range []int64{1, 5, 9, 3} {
+			l, _ = consumer.Update(sample(queued))
+		}
+
+		Convey("it draws the field's values over the last samples", func() {
+			So(l.Fields[stat_consumer.SparklineKey], ShouldEqual, "▃█▁|▁▁▁")
+			consumer.FormatLines([]*line.StatLine{l})
+			So(out.String(), ShouldContainSubstring, "qrw trend")
+			So(out.String(), ShouldContainSubstring, "▃█▁|▁▁▁")
+		})
+	})
+}
+
+func TestStopAfter(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a consumer limited to a duration", t, func() {
+		out := &bytes.Buffer{}
+		consumer := stat_consumer.NewStatConsumer(0, []string{"conn"}, map[string]string{"conn": "conn"},
+			&status.ReaderConfig{}, stat_consumer.NewGridLineFormatter(0, true), out)
+		lines := []*line.StatLine{{Fields: map[string]string{"host": "localhost", "conn": "5"}}}
+
+		Convey("lines are formatted before the deadline", func() {
+			consumer.StopAfter(time.Hour)
+			So(consumer.FormatLines(lines), ShouldBeFalse)
+			So(out.String(), ShouldContainSubstring, "conn")
+		})
+
+		Convey("nothing is formatted once the deadline has passed", func() {
+			consumer.StopAfter(0)
+			So(consumer.FormatLines(lines), ShouldBeTrue)
+			So(out.Len(), ShouldEqual, 0)
+		})
+
+		Convey("monitors stop at the deadline even without samples", func() {
+			consumer.StopAfter(10 * time.Millisecond)
+			syncCluster := &SyncClusterMonitor{
+				ReportChan: make(chan *status.ServerStatus),
+				ErrorChan:  make(chan *status.NodeError),
+				Consumer:   consumer,
+			}
+			So(syncCluster.Monitor(time.Second), ShouldBeNil)
+
+			consumer.StopAfter(10 * time.Millisecond)
+			asyncCluster := &AsyncClusterMonitor{
+				ReportChan:    make(chan *status.ServerStatus),
+				ErrorChan:     make(chan *status.NodeError),
+				LastStatLines: map[string]*line.StatLine{},
+				Consumer:      consumer,
+			}
+			So(asyncCluster.Monitor(time.Second), ShouldBeNil)
+		})
+	})
+}
+
+func TestHeaderKinds(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Fields are classified as labels, rates or gauges", t, func() {
+		So(line.HeaderKind("host"), ShouldEqual, line.KindLabel)
+		So(line.HeaderKind("insert"), ShouldEqual, line.KindRate)
+		So(line.HeaderKind("net_in"), ShouldEqual, line.KindRate)
+		So(line.HeaderKind("conn"), ShouldEqual, line.KindGauge)
+		So(line.HeaderKind("res"), ShouldEqual, line.KindGauge)
+		So(line.HeaderKind("opcounters.insert.rate()"), ShouldEqual, line.KindRate)
+		So(line.HeaderKind("asserts.user.diff()"), ShouldEqual, line.KindRate)
+		So(line.HeaderKind("connections.current"), ShouldEqual, line.KindGauge)
+	})
+
+	Convey("With a consumer showing only one kind of field", t, func() {
+		out := &bytes.Buffer{}
+		keyNames := map[string]string{"host": "host", "insert": "insert", "conn": "conn", "time": "time"}
+		consumer := stat_consumer.NewStatConsumer(0, []string{"host", "insert", "conn", "time"}, keyNames,
+			&status.ReaderConfig{}, stat_consumer.NewGridLineFormatter(0, true), out)
+		lines := []*line.StatLine{{Fields: map[string]string{"host": "localhost", "insert": "7", "conn": "5", "time": "10:00:00"}}}
+
+		Convey("only rates are displayed with the labels", func() {
+			consumer.ShowOnlyKind(line.KindRate)
+			consumer.FormatLines(lines)
+			So(out.String(), ShouldContainSubstring, "insert")
+			So(out.String(), ShouldContainSubstring, "localhost")
+			So(out.String(), ShouldContainSubstring, "10:00:00")
+			So(out.String(), ShouldNotContainSubstring, "conn")
+		})
+
+		Convey("only gauges are displayed with the labels", func() {
+			consumer.ShowOnlyKind(line.KindGauge)
+			consumer.FormatLines(lines)
+			So(out.String(), ShouldContainSubstring, "conn")
+			So(out.String(), ShouldContainSubstring, "localhost")
+			So(out.String(), ShouldNotContainSubstring, "insert")
+		})
+	})
+}
+
+func TestPrometheusLineFormatter(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	serverStatusOld := readBSONFile("test_data/server_status_old.bson", t)
+	serverStatusNew := readBSONFile("test_data/server_status_new.bson", t)
+	serverStatusNew.ShardCursorType = nil
+	serverStatusOld.ShardCursorType = nil
+	headers := []string{"host", "insert", "qrw", "net_in", "conn", "locked_db", "time"}
+
+	Convey("With the latest sample of each host", t, func() {
+		statsLine := line.NewStatLine(serverStatusOld, serverStatusNew, headers,
+			&status.ReaderConfig{HumanReadable: true, IncludeRaw: true})
+		failed := &line.StatLine{Fields: map[string]string{"host": "other:27017"}, Error: fmt.Errorf("timed out")}
+
+		formatter := stat_consumer.NewPrometheusLineFormatter(0, false).(*stat_consumer.PrometheusLineFormatter)
+		So(formatter.FormatLines([]*line.StatLine{statsLine, failed}, headers, nil), ShouldEqual, "")
+		out := &bytes.Buffer{}
+		formatter.WriteMetrics(out)
+		host := statsLine.Fields["host"]
+
+		Convey("numeric fields are served as gauges labeled by host", func() {
+			So(out.String(), ShouldContainSubstring, "# TYPE mongostat_net_in gauge\n")
+			So(out.String(), ShouldContainSubstring, fmt.Sprintf("mongostat_net_in{host=\"%v\"} 2000\n", host))
+			So(out.String(), ShouldContainSubstring, fmt.Sprintf("mongostat_insert{host=\"%v\"} 10\n", host))
+			So(out.String(), ShouldContainSubstring, fmt.Sprintf("mongostat_conn{host=\"%v\"} 5\n", host))
+		})
+
+		Convey("fields with several values are served as a gauge each", func() {
+			So(out.String(), ShouldContainSubstring, fmt.Sprintf("mongostat_qr{host=\"%v\"} 3\n", host))
+			So(out.String(), ShouldContainSubstring, fmt.Sprintf("mongostat_qw{host=\"%v\"} 2\n", host))
+		})
+
+		Convey("labels and non-numeric fields are not served as gauges", func() {
+			So(out.String(), ShouldNotContainSubstring, "mongostat_locked_db")
+			So(out.String(), ShouldNotContainSubstring, "mongostat_time")
+			So(out.String(), ShouldNotContainSubstring, "mongostat_host")
+		})
+
+		Convey("hosts whose sample failed are reported down", func() {
+			So(out.String(), ShouldContainSubstring, fmt.Sprintf("mongostat_up{host=\"%v\"} 1\n", host))
+			So(out.String(), ShouldContainSubstring, "mongostat_up{host=\"other:27017\"} 0\n")
+			So(out.String(), ShouldNotContainSubstring, "mongostat_conn{host=\"other:27017\"}")
+		})
+	})
+}
+
+func TestScaleUnits(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a consumer showing each column in a single unit", t, func() {
+		out := &bytes.Buffer{}
+		keyNames := map[string]string{"host": "host", "res": "res"}
+		consumer := stat_consumer.NewStatConsumer(0, []string{"host", "res"}, keyNames,
+			&status.ReaderConfig{HumanReadable: true, ScaleUnits: true},
+			stat_consumer.NewGridLineFormatter(0, true), out)
+
+		Convey("amounts read from a sample are kept for scaling", func() {
+			serverStatusOld := readBSONFile("test_data/server_status_old.bson", t)
+			serverStatusNew := readBSONFile("test_data/server_status_new.bson", t)
+			consumer.Update(serverStatusOld)
+			l, _ := consumer.Update(serverStatusNew)
+			So(l.Amounts["res"], ShouldEqual, serverStatusNew.Mem.Resident*1024*1024)
+		})
+
+		Convey("all hosts are shown in the unit of the largest amount", func() {
+			lines := []*line.StatLine{
+				{
+					Fields:  map[string]string{"host": "a", "res": "512M"},
+					Amounts: map[string]int64{"res": 512 << 20},
+				},
+				{
+					Fields:  map[string]string{"host": "b", "res": "2.25G"},
+					Amounts: map[string]int64{"res": 2304 << 20},
+				},
+			}
+			consumer.FormatLines(lines)
+			So(lines[0].Fields["res"], ShouldEqual, "0.50")
+			So(lines[1].Fields["res"], ShouldEqual, "2.25")
+			So(keyNames["res"], ShouldEqual, "res(G)")
+			So(out.String(), ShouldContainSubstring, "res(G)")
+
+			Convey("and the unit does not shrink for smaller amounts", func() {
+				smaller := []*line.StatLine{{
+					Fields:  map[string]string{"host": "a", "res": "100M"},
+					Amounts: map[string]int64{"res": 100 << 20},
+				}}
+				consumer.FormatLines(smaller)
+				So(smaller[0].Fields["res"], ShouldEqual, "0.10")
+				So(keyNames["res"], ShouldEqual, "res(G)")
+			})
+		})
+	})
+}
+
+func TestSkippedSamples(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Samples stay on schedule regardless of polling time", t, func() {
+		due := time.Date(2021, 3, 4, 12, 0, 0, 0, time.UTC)
+
+		skipped, next := skippedSamples(due, due.Add(300*time.Millisecond), time.Second)
+		So(skipped, ShouldEqual, 0)
+		So(next, ShouldResemble, due.Add(time.Second))
+
+		Convey("and samples due while polling are skipped", func() {
+			skipped, next := skippedSamples(due, due.Add(2500*time.Millisecond), time.Second)
+			So(skipped, ShouldEqual, 2)
+			So(next, ShouldResemble, due.Add(3*time.Second))
+		})
+	})
+}
+
+func TestHeaderOrder(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Default columns also given with -O are shown where -O places them", t, func() {
+		keyNames := line.DefaultKeyMap()
+		keyNames["metrics.document.inserted"] = "docs"
+		out := &bytes.Buffer{}
+		consumer := stat_consumer.NewStatConsumer(line.FlagAlways, []string{"metrics.document.inserted", "insert"},
+			keyNames, &status.ReaderConfig{}, stat_consumer.NewGridLineFormatter(0, true), out)
+		consumer.Update(readBSONFile("test_data/server_status_new.bson", t))
+		consumer.FormatLines([]*line.StatLine{{Fields: map[string]string{"host": "localhost"}}})
+		header := strings.Fields(strings.SplitN(out.String(), "\n", 2)[0])
+		So(header[0], ShouldEqual, "query")
+		So(header[len(header)-2:], ShouldResemble, []string{"docs", "insert"})
+	})
+}
+
+func TestHeaderInterval(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	lines := func() []*line.StatLine {
+		return []*line.StatLine{{Fields: map[string]string{"host": "localhost", "conn": "5"}}}
+	}
+	headers := func(formatter stat_consumer.LineFormatter, chunks int) (printed int) {
+		for i := 0; i < chunks; i++ {
+			if strings.Contains(formatter.FormatLines(lines(), []string{"conn"}, map[string]string{"conn": "connections"}), "connections") {
+				printed++
+			}
+		}
+		return
+	}
+
+	Convey("The column names are repeated every --headerInterval lines", t, func() {
+		formatter := stat_consumer.NewGridLineFormatter(0, true)
+		So(headers(formatter, 25), ShouldEqual, 3)
+
+		grid := stat_consumer.NewGridLineFormatter(0, true).(*stat_consumer.GridLineFormatter)
+		grid.SetHeaderInterval(4)
+		So(headers(grid, 9), ShouldEqual, 3)
+	})
+
+	Convey("With an interval of 0 they are printed only once", t, func() {
+		grid := stat_consumer.NewGridLineFormatter(0, true).(*stat_consumer.GridLineFormatter)
+		grid.SetHeaderInterval(0)
+		So(headers(grid, 25), ShouldEqual, 1)
+	})
+}
+
+func TestTransposedLineFormatter(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	keyNames := map[string]string{"host": "host", "conn": "conn", "res": "res"}
+	headerKeys := []string{"host", "conn", "res"}
+	samples := func() []*line.StatLine {
+		return []*line.StatLine{
+			{Fields: map[string]string{"host": "b:27017", "conn": "12", "res": "1.5G"}},
+			{Fields: map[string]string{"host": "a:27017", "conn": "3", "res": "800M"}},
+		}
+	}
+
+	Convey("With a transposed formatter", t, func() {
+		formatter := stat_consumer.NewTransposedLineFormatter(0, true).(*stat_consumer.TransposedLineFormatter)
+
+		Convey("each host is a column and each field a row", func() {
+			So(formatter.FormatLines(samples(), headerKeys, keyNames), ShouldEqual,
+				"      a:27017  b:27017\n"+
+					"conn        3       12\n"+
+					" res     800M     1.5G\n")
+			// later grids are set apart from the previous one
+			So(formatter.FormatLines(samples(), headerKeys, keyNames), ShouldStartWith, "\n ")
+		})
+
+		Convey("in place, each grid erases the previous one", func() {
+			formatter.SetInPlace(true)
+			So(formatter.FormatLines(samples(), headerKeys, keyNames), ShouldStartWith, " ")
+			So(formatter.FormatLines(samples(), headerKeys, keyNames), ShouldStartWith, "\x1b[3A\x1b[J ")
+		})
+
+		Convey("hosts that report errors are listed below the grid", func() {
+			lines := samples()
+			lines[0].Error = fmt.Errorf("connection refused")
+			out := formatter.FormatLines(lines, headerKeys, keyNames)
+			So(out, ShouldContainSubstring, "conn        3        -")
+			So(out, ShouldContainSubstring, "b:27017: connection refused")
+		})
+	})
+}
+
+func TestCSVLineFormatter(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	keyNames := map[string]string{"host": "host", "qrw": "qrw", "command": "command"}
+	headerKeys := []string{"host", "qrw", "command"}
+	samples := func() []*line.StatLine {
+		return []*line.StatLine{
+			{Fields: map[string]string{"host": "b:27017", "qrw": "0|1", "command": "5|0"}},
+			{Fields: map[string]string{"host": "a:27017", "qrw": "2|0", "command": "1"}},
+		}
+	}
+
+	Convey("With a CSV formatter", t, func() {
+		Convey("the header row is only written before the first rows", func() {
+			formatter := stat_consumer.NewCSVLineFormatter(0, true)
+			So(formatter.FormatLines(samples(), headerKeys, keyNames), ShouldEqual,
+				"host,qrw,command\n"+
+					"a:27017,2|0,1\n"+
+					"b:27017,0|1,5|0\n")
+			So(formatter.FormatLines(samples(), headerKeys, keyNames), ShouldEqual,
+				"a:27017,2|0,1\n"+
+					"b:27017,0|1,5|0\n")
+		})
+
+		Convey("no header row is written without headers", func() {
+			formatter := stat_consumer.NewCSVLineFormatter(0, false)
+			So(formatter.FormatLines(samples()[:1], headerKeys, keyNames), ShouldEqual, "b:27017,0|1,5|0\n")
+		})
+
+		Convey("hosts that report errors only fill in the host", func() {
+			formatter := stat_consumer.NewCSVLineFormatter(0, false)
+			lines := samples()
+			lines[0].Error = fmt.Errorf("connection refused")
+			So(formatter.FormatLines(lines, headerKeys, keyNames), ShouldEqual,
+				"a:27017,2|0,1\n"+
+					"b:27017,,\n")
+		})
+
+		Convey("renamed columns are quoted as needed", func() {
+			formatter := stat_consumer.NewCSVLineFormatter(0, true)
+			renamed := map[string]string{"host": "host", "qrw": "queued, r|w", "command": "command"}
+			So(formatter.FormatLines(samples()[1:], headerKeys, renamed), ShouldStartWith,
+				"host,\"queued, r|w\",command\n")
+		})
+	})
+}
+
+func TestGraphiteSink(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	serverStatusOld := readBSONFile("test_data/server_status_old.bson", t)
+	serverStatusNew := readBSONFile("test_data/server_status_new.bson", t)
+	serverStatusNew.ShardCursorType = nil
+	serverStatusOld.ShardCursorType = nil
+	headers := []string{"host", "insert", "qrw", "net_in", "locked_db", "time"}
+	keyNames := map[string]string{"host": "host", "insert": "insert", "qrw": "qrw", "net_in": "net_in",
+		"locked_db": "locked", "time": "time"}
+
+	Convey("With a Graphite server", t, func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		defer listener.Close()
+		received := make(chan string, 1)
+		go func() {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			data, _ := ioutil.ReadAll(conn)
+			received <- string(data)
+		}()
+
+		sink, err := stat_consumer.DialGraphite(listener.Addr().String(), "db.mongostat")
+		So(err, ShouldBeNil)
+		consumer := stat_consumer.NewStatConsumer(0, headers, keyNames,
+			&status.ReaderConfig{HumanReadable: true}, stat_consumer.NewJSONLineFormatter(0, false), ioutil.Discard)
+		consumer.PushToGraphite(sink)
+		consumer.Update(serverStatusOld)
+		consumer.Update(serverStatusNew)
+		So(sink.Close(), ShouldBeNil)
+
+		metrics := <-received
+		prefix := "db.mongostat." + strings.NewReplacer(".", "_", ":", "_").Replace(serverStatusNew.Host)
+		timestamp := serverStatusNew.SampleTime.Unix()
+
+		Convey("each numeric field of a sample is pushed under the host", func() {
+			So(metrics, ShouldContainSubstring, fmt.Sprintf("%v.insert 10 %v\n", prefix, timestamp))
+			So(metrics, ShouldContainSubstring, fmt.Sprintf("%v.net_in 2000 %v\n", prefix, timestamp))
+		})
+
+		Convey("fields with several values and dotted fields are hierarchies", func() {
+			So(metrics, ShouldContainSubstring, fmt.Sprintf("%v.qrw.r 3 %v\n", prefix, timestamp))
+			So(metrics, ShouldContainSubstring, fmt.Sprintf("%v.qrw.w 2 %v\n", prefix, timestamp))
+
+			custom := sink.FormatMetrics("db1.example.com:27017", serverStatusNew.SampleTime,
+				[]string{"metrics.document.inserted"}, map[string]string{"metrics.document.inserted": "metrics.document.inserted"},
+				map[string]interface{}{"metrics.document.inserted": int64(7)})
+			So(string(custom), ShouldEqual,
+				fmt.Sprintf("db.mongostat.db1_example_com_27017.metrics.document.inserted 7 %v\n", timestamp))
+		})
+
+		Convey("labels and non-numeric fields are not pushed", func() {
+			So(metrics, ShouldNotContainSubstring, ".locked ")
+			So(metrics, ShouldNotContainSubstring, ".time ")
+			So(metrics, ShouldNotContainSubstring, ".host ")
+		})
+	})
+}
+
+func TestStatsDSink(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	serverStatusOld := readBSONFile("test_data/server_status_old.bson", t)
+	serverStatusNew := readBSONFile("test_data/server_status_new.bson", t)
+	serverStatusNew.ShardCursorType = nil
+	serverStatusOld.ShardCursorType = nil
+	headers := []string{"host", "insert", "qrw", "conn", "time"}
+	keyNames := map[string]string{"host": "host", "insert": "ins", "qrw": "qrw", "conn": "conn", "time": "time"}
+
+	Convey("With a StatsD agent", t, func() {
+		agent, err := net.ListenPacket("udp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		defer agent.Close()
+
+		sink, err := stat_consumer.DialStatsD(agent.LocalAddr().String(), "db.mongostat", stat_consumer.StatsDHostTag)
+		So(err, ShouldBeNil)
+		defer sink.Close()
+		consumer := stat_consumer.NewStatConsumer(0, headers, keyNames,
+			&status.ReaderConfig{HumanReadable: true}, stat_consumer.NewJSONLineFormatter(0, false), ioutil.Discard)
+		consumer.EmitToStatsD(sink)
+		consumer.Update(serverStatusOld)
+		consumer.Update(serverStatusNew)
+
+		buf := make([]byte, 2048)
+		agent.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := agent.ReadFrom(buf)
+		So(err, ShouldBeNil)
+		metrics := strings.Split(string(buf[:n]), "\n")
+		tag := "|#host:" + serverStatusNew.Host
+		elapsed := serverStatusNew.SampleTime.Sub(serverStatusOld.SampleTime).Seconds()
+
+		Convey("rates are counted over the interval, and other fields are gauges", func() {
+			So(metrics, ShouldContain, fmt.Sprintf("db.mongostat.ins:%v|c%v", int64(10*elapsed), tag))
+			So(metrics, ShouldContain, "db.mongostat.conn:5|g"+tag)
+			So(metrics, ShouldContain, "db.mongostat.qrw.r:3|g"+tag)
+			So(metrics, ShouldContain, "db.mongostat.qrw.w:2|g"+tag)
+			So(metrics, ShouldHaveLength, 4)
+		})
+	})
+
+	Convey("Hosts can be named in the metric names instead of tagged", t, func() {
+		sink, err := stat_consumer.DialStatsD("127.0.0.1:8125", "mongostat", stat_consumer.StatsDHostName)
+		So(err, ShouldBeNil)
+		defer sink.Close()
+		raw := map[string]interface{}{"insert": int64(4), "metrics.document.inserted.diff()": int64(30)}
+		lines := sink.FormatMetrics("db1.example.com:27017", 10*time.Second,
+			[]string{"insert", "metrics.document.inserted.diff()"}, map[string]string{"insert": "insert", "metrics.document.inserted.diff()": "docs"}, raw)
+		So(lines, ShouldResemble, []string{
+			"mongostat.db1_example_com_27017.insert:40|c",
+			"mongostat.db1_example_com_27017.docs:30|c",
+		})
+	})
+}
+
+func TestOTLPExporter(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Samples exported over OTLP", t, func() {
+		var posted []byte
+		var path, contentType string
+		collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path = r.URL.Path
+			contentType = r.Header.Get("Content-Type")
+			posted, _ = ioutil.ReadAll(r.Body)
+		}))
+		defer collector.Close()
+
+		exporter, err := stat_consumer.NewOTLPExporter(collector.URL)
+		So(err, ShouldBeNil)
+		start := time.Date(2021, 3, 4, 12, 0, 0, 0, time.UTC)
+		raw := map[string]interface{}{"insert": int64(4), "conn": int64(5), "qrw": []interface{}{int64(3), int64(2)}, "host": "db1:27017"}
+		body, err := exporter.FormatMetrics("db1:27017", "rs0", start, start.Add(10*time.Second),
+			[]string{"host", "insert", "conn", "qrw"}, map[string]string{"insert": "insert", "conn": "conn", "qrw": "qrw"}, raw)
+		So(err, ShouldBeNil)
+		So(exporter.Send(body), ShouldBeNil)
+		So(path, ShouldEqual, "/v1/metrics")
+		So(contentType, ShouldEqual, "application/json")
+
+		var request struct {
+			ResourceMetrics []struct {
+				ScopeMetrics []struct {
+					Metrics []map[string]interface{}
+				}
+			}
+		}
+		So(json.Unmarshal(posted, &request), ShouldBeNil)
+		metrics := request.ResourceMetrics[0].ScopeMetrics[0].Metrics
+		names := []string{}
+		for _, metric := range metrics {
+			names = append(names, metric["name"].(string))
+		}
+		So(names, ShouldResemble, []string{"mongostat.insert", "mongostat.conn", "mongostat.qrw.r", "mongostat.qrw.w"})
+
+		Convey("rates are delta sums of the events since the previous sample", func() {
+			sum := metrics[0]["sum"].(map[string]interface{})
+			So(sum["aggregationTemporality"], ShouldEqual, 1)
+			So(sum["isMonotonic"], ShouldBeTrue)
+			point := sum["dataPoints"].([]interface{})[0].(map[string]interface{})
+			So(point["asInt"], ShouldEqual, "40")
+			So(point["startTimeUnixNano"], ShouldEqual, fmt.Sprint(start.UnixNano()))
+			So(point["attributes"], ShouldResemble, []interface{}{
+				map[string]interface{}{"key": "host", "value": map[string]interface{}{"stringValue": "db1:27017"}},
+				map[string]interface{}{"key": "replica_set", "value": map[string]interface{}{"stringValue": "rs0"}},
+			})
+		})
+
+		Convey("and other fields are gauges", func() {
+			gauge := metrics[1]["gauge"].(map[string]interface{})
+			point := gauge["dataPoints"].([]interface{})[0].(map[string]interface{})
+			So(point["asInt"], ShouldEqual, "5")
+			So(metrics[1]["sum"], ShouldBeNil)
+		})
+	})
+
+	Convey("OTLP endpoints default to the metrics path over HTTP", t, func() {
+		_, err := stat_consumer.NewOTLPExporter("localhost:4318")
+		So(err, ShouldBeNil)
+		_, err = stat_consumer.NewOTLPExporter("grpc://localhost:4317")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestParseReplSetSeedList(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("A seed list names a replica set and its members", t, func() {
+		name, members, err := ParseReplSetSeedList("rs0/db1:27017, db2:27018")
+		So(err, ShouldBeNil)
+		So(name, ShouldEqual, "rs0")
+		So(members, ShouldResemble, []string{"db1:27017", "db2:27018"})
+
+		for _, invalid := range []string{"db1:27017", "/db1:27017", "rs0/", "rs0/db1,,db2", "rs0/db1,db1"} {
+			_, _, err := ParseReplSetSeedList(invalid)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestWatchReplSet(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a watched replica set", t, func() {
+		cluster := &AsyncClusterMonitor{LastStatLines: map[string]*line.StatLine{}}
+		cluster.WatchReplSet("rs0", []string{"a:27017", "b:27017"})
+		sample := func(host string, primary bool, t time.Time) *status.ServerStatus {
+			return &status.ServerStatus{
+				Host:       host,
+				SampleTime: t,
+				Repl:       &status.ReplStatus{SetName: "rs0", IsMaster: primary, Secondary: !primary},
+			}
+		}
+		seen := time.Date(2021, 3, 4, 12, 0, 0, 0, time.Local)
+
+		Convey("every member has a row from the start", func() {
+			So(cluster.LastStatLines, ShouldHaveLength, 2)
+			So(cluster.LastStatLines["a:27017"].Error.Error(), ShouldStartWith, "DOWN (never seen)")
+		})
+
+		Convey("members which cannot be polled keep their rows, with the time they were last seen", func() {
+			cluster.trackMember(sample("a:27017", false, seen))
+			l := cluster.trackDownMember(status.NewNodeError("a:27017", fmt.Errorf("connection refused")))
+			So(l.Fields["host"], ShouldEqual, "a:27017")
+			So(l.Error.Error(), ShouldEqual, "DOWN (last seen 2021-03-04 12:00:00): connection refused")
+		})
+
+		Convey("the primary is tracked as it changes", func() {
+			cluster.trackMember(sample("a:27017", true, seen))
+			So(cluster.primary, ShouldEqual, "a:27017")
+			cluster.trackMember(sample("b:27017", true, seen))
+			So(cluster.primary, ShouldEqual, "b:27017")
+			cluster.trackDownMember(status.NewNodeError("b:27017", fmt.Errorf("connection refused")))
+			So(cluster.primary, ShouldEqual, "")
+		})
+	})
+}
+
+func TestOnError(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	last := &line.StatLine{Fields: map[string]string{"host": "db1:27017", "time": "12:00:01", "conn": "5"}, Printed: true}
+
+	Convey("Hosts which could not be sampled are shown as asked by --onError", t, func() {
+		So(isShown(""), ShouldBeTrue)
+		So(isShown(OnErrorShow), ShouldBeTrue)
+
+		Convey("keep shows a fresh copy of the last row, with its time marked", func() {
+			l := failedLine(OnErrorKeep, "db1:27017", last)
+			So(l.Printed, ShouldBeFalse)
+			So(l.Error, ShouldBeNil)
+			So(l.Fields, ShouldResemble, map[string]string{"host": "db1:27017", "time": "12:00:01*", "conn": "5"})
+			So(last.Fields["time"], ShouldEqual, "12:00:01")
+		})
+
+		Convey("keep and blank show only the host if there is no last row", func() {
+			So(failedLine(OnErrorKeep, "db1:27017", nil).Fields, ShouldResemble, map[string]string{"host": "db1:27017"})
+			So(failedLine(OnErrorBlank, "db1:27017", last).Fields, ShouldResemble, map[string]string{"host": "db1:27017"})
+		})
+
+		Convey("drop shows nothing", func() {
+			So(failedLine(OnErrorDrop, "db1:27017", last), ShouldBeNil)
+		})
+	})
+
+	Convey("Failing hosts keep their last row until they are sampled again", t, func() {
+		cluster := &AsyncClusterMonitor{LastStatLines: map[string]*line.StatLine{}, OnError: OnErrorKeep}
+		cluster.updateHostInfo(last)
+		cluster.updateFailedHost(status.NewNodeError("db1:27017", fmt.Errorf("connection refused")))
+		So(cluster.failing["db1:27017"], ShouldBeTrue)
+		So(cluster.LastStatLines["db1:27017"], ShouldEqual, last)
+
+		cluster.updateHostInfo(&line.StatLine{Fields: map[string]string{"host": "db1:27017"}})
+		So(cluster.failing["db1:27017"], ShouldBeFalse)
+	})
+}
+
+func TestRestartLine(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("The first sample after a restart is shown as a restart", t, func() {
+		consumer := stat_consumer.NewStatConsumer(line.FlagAlways, nil, line.DefaultKeyMap(),
+			&status.ReaderConfig{}, stat_consumer.NewGridLineFormatter(0, true), &bytes.Buffer{})
+		sample := func(uptimeMillis, inserts int64) *status.ServerStatus {
+			return &status.ServerStatus{
+				Host:         "localhost",
+				SampleTime:   time.Now(),
+				UptimeMillis: uptimeMillis,
+				Opcounters:   &status.OpcountStats{Insert: inserts},
+			}
+		}
+		consumer.Update(sample(60000, 1000))
+		l, ok := consumer.Update(sample(1000, 10))
+		So(ok, ShouldBeTrue)
+		So(l.Error, ShouldEqual, line.ErrRestarted)
+		So(l.Fields["host"], ShouldEqual, "localhost")
+
+		Convey("and rates are computed from it on", func() {
+			l, ok := consumer.Update(sample(2000, 20))
+			So(ok, ShouldBeTrue)
+			So(l.Error, ShouldBeNil)
+		})
+	})
+}
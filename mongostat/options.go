@@ -9,7 +9,10 @@ package mongostat
 import (
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/mongodb/mongo-tools/common/healthcheck"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/mongostat/stat_consumer"
 )
@@ -24,17 +27,57 @@ See http://docs.mongodb.com/database-tools/mongostat/ for more information.`
 
 // StatOptions defines the set of options to use for configuring mongostat.
 type StatOptions struct {
-	Columns       string `short:"o" value-name:"<field>[,<field>]*" description:"fields to show. For custom fields, use dot-syntax to index into serverStatus output, and optional methods .diff() and .rate() e.g. metrics.record.moves.diff()"`
-	AppendColumns string `short:"O" value-name:"<field>[,<field>]*" description:"like -o, but preloaded with default fields. Specified fields inserted after default output"`
-	HumanReadable string `long:"humanReadable" default:"true" description:"print sizes and time in human readable format (e.g. 1K 234M 2G). To use the more precise machine readable format, use --humanReadable=false"`
-	NoHeaders     bool   `long:"noheaders" description:"don't output column names"`
-	RowCount      int64  `long:"rowcount" value-name:"<count>" short:"n" description:"number of stats lines to print (0 for indefinite)"`
-	Discover      bool   `long:"discover" description:"discover nodes and display stats for all"`
-	Http          bool   `long:"http" description:"use HTTP instead of raw db connection"`
-	All           bool   `long:"all" description:"all optional fields"`
-	Json          bool   `long:"json" description:"output as JSON rather than a formatted table"`
-	Deprecated    bool   `long:"useDeprecatedJsonKeys" description:"use old key names; only valid with the json output option."`
-	Interactive   bool   `short:"i" long:"interactive" description:"display stats in a non-scrolling interface"`
+	Columns         string `short:"o" value-name:"<field>[,<field>]*" description:"fields to show. For custom fields, use dot-syntax to index into serverStatus output, and optional methods .diff() and .rate() e.g. metrics.record.moves.diff()"`
+	AppendColumns   string `short:"O" value-name:"<field>[,<field>]*" description:"like -o, but preloaded with default fields. Specified fields inserted after default output"`
+	HumanReadable   string `long:"humanReadable" default:"true" description:"print sizes and time in human readable format (e.g. 1K 234M 2G); outside of --json, each size column keeps the unit named in its header, e.g. res(G). To use the more precise machine readable format, use --humanReadable=false"`
+	NoHeaders       bool   `long:"noheaders" description:"don't output column names"`
+	NoHeadersAlias  bool   `long:"noHeaders" hidden:"true"`
+	HeaderInterval  int    `long:"headerInterval" value-name:"<lines>" default:"10" description:"number of lines printed between repetitions of the column names (0 to print them only at the start, and whenever the columns or hosts change)"`
+	HeaderMap       string `long:"headerMap" value-name:"<field>=<name>[,<field>=<name>]*" description:"rename the columns of the given fields, which may be default fields or fields given with -o or -O, e.g. 'insert=ins,query=qry'"`
+	RowCount        int64  `long:"rowcount" value-name:"<count>" short:"n" description:"number of stats lines to print (0 for indefinite)"`
+	Discover        bool   `long:"discover" description:"discover nodes and display stats for all"`
+	ReplSet         string `long:"replSet" value-name:"<setname>/<host>[,<host>]*" description:"display stats for exactly the given members of a replica set, e.g. 'rs0/db1:27017,db2:27017', rather than --host; unlike --discover, no other hosts are added, members which cannot be reached keep their rows, marked DOWN with the time they were last seen, and changes of primary are logged"`
+	Http            bool   `long:"http" description:"use HTTP instead of raw db connection"`
+	All             bool   `long:"all" description:"all optional fields"`
+	Json            bool   `long:"json" description:"output as JSON rather than a formatted table"`
+	JsonIncludesRaw bool   `long:"jsonIncludesRaw" description:"output each field as an object holding its machine readable 'raw' value, a number or array of numbers where possible, and its 'display' string; only valid with the json output option."`
+	Deprecated      bool   `long:"useDeprecatedJsonKeys" description:"use old key names; only valid with the json output option."`
+	CSV             bool   `long:"csv" description:"output a CSV row per host for every sample, after a single header row, with the fields given with -o or the default fields and the host; useful for loading into a spreadsheet or pandas"`
+	Interactive     bool   `short:"i" long:"interactive" description:"display stats in a non-scrolling interface"`
+	Transpose       bool   `long:"transpose" description:"print one column per host and one row per field, redrawn in place when printing to a terminal; easier to read than wide rows when monitoring a few hosts with --all"`
+	DiffOnly        bool   `long:"diffOnly" description:"only display rates, i.e. fields computed from the difference between two samples such as opcounters, network traffic and custom fields using .diff() or .rate(), along with the host and time"`
+	GaugesOnly      bool   `long:"gaugesOnly" description:"only display gauges, i.e. fields read from a single sample such as memory sizes, connections and queues, along with the host and time"`
+	OnlyChanged     bool   `long:"onlyChanged" description:"only print rows for hosts whose displayed metrics changed by more than --changeThreshold since they were last printed"`
+	ChangeThreshold string `long:"changeThreshold" value-name:"<percent>" default:"10%" description:"minimum change in any displayed metric, relative to its last printed value, for --onlyChanged to print a host's row"`
+
+	AnomalyLog        string   `long:"anomalyLog" value-name:"<filename>" description:"append the raw serverStatus of any sample that trips an --anomalyThreshold, and of the two samples preceding it, to the given file as extended JSON"`
+	AnomalyThresholds []string `long:"anomalyThreshold" value-name:"<field>[<|>]<value>" description:"limit on a displayed field that marks a sample as anomalous for --anomalyLog, e.g. 'conn>500' or 'dirty>20%' (may be specified multiple times)"`
+
+	SQLite string `long:"sqlite" value-name:"<filename>" description:"append the machine readable value of each displayed field of every sample to a table named 'samples', with columns host, timestamp (UTC), field and value, in the given SQLite database, which is created if needed"`
+
+	Graphite       string `long:"graphite" value-name:"<host>:<port>" description:"push the machine readable value of each displayed field of every sample to the Graphite server listening for plaintext metrics at the given address, e.g. graphite:2003, as <prefix>.<host>.<field>, where the field is named by its column header, e.g. mongostat.db1_example_com_27017.qrw.r"`
+	GraphitePrefix string `long:"graphitePrefix" value-name:"<prefix>" default:"mongostat" description:"prefix of the metric names pushed to --graphite (defaults to 'mongostat')"`
+	GraphiteOnly   bool   `long:"graphiteOnly" description:"push samples to --graphite without printing them"`
+
+	StatsD        string `long:"statsd" value-name:"<host>:<port>" description:"emit the machine readable value of each displayed field of every sample to the StatsD agent at the given address, e.g. localhost:8125, over UDP: rates such as opcounters as counters of the events since the previous sample, and other fields as gauges, named <prefix>.<field> after the column header, e.g. mongostat.qrw.r"`
+	StatsDPrefix  string `long:"statsdPrefix" value-name:"<prefix>" default:"mongostat" description:"prefix of the metric names emitted to --statsd (defaults to 'mongostat')"`
+	StatsDHostTag string `long:"statsdHostTag" value-name:"<mode>" choice:"tag" choice:"name" choice:"none" default:"tag" description:"how metrics emitted to --statsd identify their host: with a 'host' tag in the DogStatsD format understood by Datadog and Telegraf agents, in the metric name after the prefix, or not at all (defaults to 'tag')"`
+
+	OTLPEndpoint string `long:"otlpEndpoint" value-name:"<url>" description:"export the machine readable value of each displayed field of every sample to the OpenTelemetry collector receiving OTLP over HTTP at the given URL, e.g. http://localhost:4318: rates such as opcounters as delta sums of the events since the previous sample, and other fields as gauges, named mongostat.<field> after the column header, e.g. mongostat.qrw.r, with 'host' and 'replica_set' attributes"`
+
+	Prometheus string `long:"prometheus" value-name:"<address>" description:"serve the machine readable value of every field of the latest sample of each host, or only of the fields given with -o, as Prometheus gauges labeled by host at /metrics on the given address, e.g. :9216, rather than printing them"`
+
+	Sparkline string `long:"sparkline" value-name:"<field>[:<samples>]" description:"add a column drawing the given field's values over the last <samples> samples (default 20) of each host as a sparkline, e.g. 'ping' or 'qrw:30'; fields with several values, such as qrw, get a sparkline for each"`
+
+	Sys bool `long:"sys" description:"add run queue length, busiest disk utilization, swap-in rate and NUMA miss rate columns read from /proc and /sys; only meaningful when mongostat runs on the same Linux host as the monitored server"`
+
+	TimeZone string `long:"timeZone" value-name:"<zone>" description:"report sample times in the given IANA time zone, e.g. America/New_York, rather than the local time zone"`
+	UTC      bool   `long:"utc" description:"report sample times in UTC"`
+
+	OnError       string        `long:"onError" value-name:"<mode>" choice:"error" choice:"keep" choice:"blank" choice:"drop" default:"error" description:"how to show a host which could not be sampled: print the error every interval, keep its last row with its time marked by a trailing '*', print a blank row, or drop its row; with keep, blank and drop the error is only logged when the host first fails (defaults to 'error')"`
+	RetryInterval time.Duration `long:"retryInterval" value-name:"<duration>" description:"after failing to sample a host, wait the given duration, e.g. 5s, before trying to reconnect to it, rather than retrying at every polling interval"`
+
+	Duration time.Duration `long:"duration" value-name:"<duration>" description:"stop after running for the given wall-clock duration, e.g. 90s or 10m (0 for indefinite); may be combined with --rowcount"`
 }
 
 // Name returns a human-readable group name for mongostat options.
@@ -90,3 +133,75 @@ func ParseOptions(rawArgs []string, versionStr, gitCommit string) (Options, erro
 
 	return Options{opts, statOpts, sleepInterval}, nil
 }
+
+// ParsePercentage parses a percentage such as "10%" or "10" into the
+// corresponding fraction, e.g. 0.1.
+func ParsePercentage(value string) (float64, error) {
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "%"), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid percentage: %v", value)
+	}
+	if percent < 0 {
+		return 0, fmt.Errorf("percentage must not be negative: %v", value)
+	}
+	return percent / 100, nil
+}
+
+// ParseHeaderMap parses the value of --headerMap, a comma-separated list of
+// <field>=<name> pairs, into a map from each field to the name of its column.
+func ParseHeaderMap(value string) (map[string]string, error) {
+	names := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		i := strings.Index(pair, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("expected <field>=<name> but got '%v'", pair)
+		}
+		field, name := strings.TrimSpace(pair[:i]), strings.TrimSpace(pair[i+1:])
+		if field == "" || name == "" {
+			return nil, fmt.Errorf("expected <field>=<name> but got '%v'", pair)
+		}
+		if _, ok := names[field]; ok {
+			return nil, fmt.Errorf("field '%v' is renamed more than once", field)
+		}
+		names[field] = name
+	}
+	return names, nil
+}
+
+// ParseReplSetSeedList parses the value of --replSet, a replica set name and
+// a comma-separated list of its members separated by a slash, into the name
+// and the members.
+func ParseReplSetSeedList(value string) (string, []string, error) {
+	i := strings.Index(value, "/")
+	if i < 0 {
+		return "", nil, fmt.Errorf("expected <setname>/<host>[,<host>]* but got '%v'", value)
+	}
+	name := strings.TrimSpace(value[:i])
+	if name == "" {
+		return "", nil, fmt.Errorf("missing replica set name in '%v'", value)
+	}
+	var members []string
+	seen := make(map[string]bool)
+	for _, member := range strings.Split(value[i+1:], ",") {
+		member = strings.TrimSpace(member)
+		if member == "" {
+			return "", nil, fmt.Errorf("empty member in '%v'", value)
+		}
+		if seen[member] {
+			return "", nil, fmt.Errorf("member '%v' is given more than once", member)
+		}
+		seen[member] = true
+		members = append(members, member)
+	}
+	return name, members, nil
+}
+
+// HealthCheckRequirements returns the privileges needed to monitor a server,
+// which are checked by --healthCheck.
+func (opts Options) HealthCheckRequirements() []healthcheck.Requirement {
+	return []healthcheck.Requirement{{
+		Resource: healthcheck.Resource{Cluster: true},
+		Actions:  []string{"serverStatus"},
+		Purpose:  "read server statistics",
+	}}
+}
@@ -185,3 +185,24 @@ func TestPositionalArgumentParsing(t *testing.T) {
 		}
 	})
 }
+
+func TestParseHeaderMap(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("--headerMap renames the columns of the given fields", t, func() {
+		names, err := ParseHeaderMap("insert=ins, query=qry,metrics.document.inserted.rate()=docs")
+		So(err, ShouldBeNil)
+		So(names, ShouldResemble, map[string]string{
+			"insert":                           "ins",
+			"query":                            "qry",
+			"metrics.document.inserted.rate()": "docs",
+		})
+	})
+
+	Convey("Malformed or repeated renames are rejected", t, func() {
+		for _, value := range []string{"insert", "insert=", "=ins", "insert=ins,,query=qry", "insert=ins,insert=i"} {
+			_, err := ParseHeaderMap(value)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
@@ -0,0 +1,85 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// +build cgo
+
+package mongostat
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/mongodb/mongo-tools/mongostat/stat_consumer"
+	"github.com/mongodb/mongo-tools/mongostat/status"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSampleStore(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With samples stored in a SQLite database", t, func() {
+		dir, err := ioutil.TempDir("", "mongostat_sqlite")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "samples.db")
+
+		store, err := stat_consumer.OpenSampleStore(path)
+		So(err, ShouldBeNil)
+		consumer := stat_consumer.NewStatConsumer(0, []string{"host", "conn", "qrw", "time"}, nil,
+			&status.ReaderConfig{HumanReadable: true}, nil, ioutil.Discard)
+		consumer.StoreSamples(store)
+
+		sampleTime := time.Date(2020, time.March, 2, 10, 0, 0, 0, time.UTC)
+		sample := func(conns int64) *status.ServerStatus {
+			sampleTime = sampleTime.Add(time.Second)
+			return &status.ServerStatus{
+				Host:        "localhost",
+				SampleTime:  sampleTime,
+				Connections: &status.ConnectionStats{Current: conns},
+				GlobalLock: &status.GlobalLockStats{
+					CurrentQueue: &status.QueueStats{Readers: 2, Writers: 3},
+				},
+			}
+		}
+		consumer.Update(sample(1000))
+		consumer.Update(sample(2000))
+		consumer.Update(sample(3000))
+		So(store.Close(), ShouldBeNil)
+
+		Convey("each field of each sample after the first is a row", func() {
+			db, err := sql.Open("sqlite3", path)
+			So(err, ShouldBeNil)
+			defer db.Close()
+
+			rows, err := db.Query("SELECT host, timestamp, field, value FROM samples ORDER BY timestamp, field")
+			So(err, ShouldBeNil)
+			defer rows.Close()
+			var stored []string
+			for rows.Next() {
+				var host, timestamp, field string
+				var value interface{}
+				So(rows.Scan(&host, &timestamp, &field, &value), ShouldBeNil)
+				if b, ok := value.([]byte); ok {
+					value = string(b)
+				}
+				stored = append(stored, fmt.Sprintf("%v %v %v %v", host, timestamp, field, value))
+			}
+			So(rows.Err(), ShouldBeNil)
+			So(stored, ShouldResemble, []string{
+				"localhost 2020-03-02T10:00:02.000Z conn 2000",
+				"localhost 2020-03-02T10:00:02.000Z qrw [2,3]",
+				"localhost 2020-03-02T10:00:03.000Z conn 3000",
+				"localhost 2020-03-02T10:00:03.000Z qrw [2,3]",
+			})
+		})
+	})
+}
@@ -0,0 +1,137 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package stat_consumer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongo-tools/mongostat/stat_consumer/line"
+	"github.com/mongodb/mongo-tools/mongostat/status"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// anomalyContextSamples is the number of samples preceding an anomalous one
+// that are written to the anomaly log with it.
+const anomalyContextSamples = 2
+
+// AnomalyThreshold is a limit on a displayed field, such as "conn>500" or
+// "dirty>20%", which marks a sample as anomalous when it is crossed.
+type AnomalyThreshold struct {
+	Field string
+	Below bool
+	Limit float64
+
+	spec string
+}
+
+// ParseAnomalyThreshold parses a threshold of the form <field>><value> or
+// <field><<value>. The value may use the same unit suffixes as the displayed
+// field, e.g. "net_in>10m".
+func ParseAnomalyThreshold(spec string) (*AnomalyThreshold, error) {
+	i := strings.IndexAny(spec, "<>")
+	if i <= 0 || i == len(spec)-1 {
+		return nil, fmt.Errorf("invalid threshold '%v': must be of the form <field>><value> or <field><<value>", spec)
+	}
+	limit, ok := line.ParseFieldNumber(strings.TrimSpace(spec[i+1:]))
+	if !ok {
+		return nil, fmt.Errorf("invalid threshold '%v': '%v' is not a number", spec, spec[i+1:])
+	}
+	return &AnomalyThreshold{
+		Field: strings.TrimSpace(spec[:i]),
+		Below: spec[i] == '<',
+		Limit: limit,
+		spec:  spec,
+	}, nil
+}
+
+func (t *AnomalyThreshold) String() string {
+	return t.spec
+}
+
+// trippedBy returns true if any numeric part of the threshold's field in l
+// crosses the limit.
+func (t *AnomalyThreshold) trippedBy(l *line.StatLine) bool {
+	for _, v := range l.NumericValues(t.Field) {
+		if (t.Below && v < t.Limit) || (!t.Below && v > t.Limit) {
+			return true
+		}
+	}
+	return false
+}
+
+// anomaly is a single entry in the anomaly log.
+type anomaly struct {
+	// Time is the time of the sample in the --timeZone
+	Time       string     `bson:"time"`
+	Host       string     `bson:"host"`
+	Thresholds []string   `bson:"thresholds"`
+	Fields     bson.M     `bson:"fields"`
+	Samples    []bson.Raw `bson:"samples"`
+}
+
+// rememberSample keeps the most recent samples for each host, so that an
+// anomalous sample can be logged along with the ones preceding it.
+func (sc *StatConsumer) rememberSample(stat *status.ServerStatus) []*status.ServerStatus {
+	recent := append(sc.recentStats[stat.Host], stat)
+	if len(recent) > anomalyContextSamples+1 {
+		recent = recent[len(recent)-anomalyContextSamples-1:]
+	}
+	sc.recentStats[stat.Host] = recent
+	return recent
+}
+
+// anomalyTimeFormat is the format of the time of anomaly log entries, which
+// includes the offset of the time zone.
+const anomalyTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// anomalyTime formats the time of a sample for the anomaly log, in the time
+// zone the samples are shown in.
+func (sc *StatConsumer) anomalyTime(t time.Time) string {
+	if sc.readerConfig.Location != nil {
+		t = t.In(sc.readerConfig.Location)
+	}
+	return t.Format(anomalyTimeFormat)
+}
+
+// logAnomaly writes an entry to the anomaly log if l trips any of the
+// configured thresholds. The entry holds the raw serverStatus of the sample
+// and of the samples preceding it.
+func (sc *StatConsumer) logAnomaly(l *line.StatLine, recent []*status.ServerStatus) error {
+	var tripped []string
+	for _, t := range sc.anomalyThresholds {
+		if t.trippedBy(l) {
+			tripped = append(tripped, t.String())
+		}
+	}
+	if len(tripped) == 0 {
+		return nil
+	}
+
+	entry := anomaly{
+		Time:       sc.anomalyTime(recent[len(recent)-1].SampleTime),
+		Host:       l.Fields["host"],
+		Thresholds: tripped,
+		Fields:     bson.M{},
+	}
+	for k, v := range l.Fields {
+		entry.Fields[k] = v
+	}
+	for _, stat := range recent {
+		if stat.Raw != nil {
+			entry.Samples = append(entry.Samples, stat.Raw)
+		}
+	}
+
+	out, err := bson.MarshalExtJSON(entry, false, false)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(sc.anomalyLog, "%s\n", out)
+	return err
+}
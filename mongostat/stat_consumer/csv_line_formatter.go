@@ -0,0 +1,86 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package stat_consumer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"sort"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/mongostat/stat_consumer/line"
+)
+
+// CSVLineFormatter formats the StatLines as CSV rows, one per host, with a
+// header row written once before the first rows. The columns never change,
+// so the StatLines must be read without ReaderConfig.ScaleUnits.
+type CSVLineFormatter struct {
+	*limitableFormatter
+
+	// If true, enables printing of the header row
+	includeHeader bool
+
+	// Whether the header row has been written
+	wroteHeader bool
+}
+
+func NewCSVLineFormatter(maxRows int64, includeHeader bool) LineFormatter {
+	return &CSVLineFormatter{
+		limitableFormatter: &limitableFormatter{maxRows: maxRows},
+		includeHeader:      includeHeader,
+	}
+}
+
+func init() {
+	FormatterConstructors["csv"] = NewCSVLineFormatter
+}
+
+func (clf *CSVLineFormatter) Finish() {
+}
+
+// FormatLines formats the StatLines as CSV rows. A host whose sample failed
+// gets a row holding only its host, and the error is logged.
+func (clf *CSVLineFormatter) FormatLines(lines []*line.StatLine, headerKeys []string, keyNames map[string]string) string {
+	buf := &bytes.Buffer{}
+	out := csv.NewWriter(buf)
+
+	if clf.includeHeader && !clf.wroteHeader {
+		headers := make([]string, len(headerKeys))
+		for i, key := range headerKeys {
+			headers[i] = keyNames[key]
+		}
+		out.Write(headers)
+	}
+	clf.wroteHeader = true
+
+	// Sort the stat lines by hostname, so that the rows of each snapshot
+	// are in the same order
+	sort.Sort(line.StatLines(lines))
+
+	for _, l := range lines {
+		if l.Printed && l.Error == nil {
+			l.Error = fmt.Errorf("no data received")
+		}
+		l.Printed = true
+
+		row := make([]string, len(headerKeys))
+		for i, key := range headerKeys {
+			if l.Error == nil || key == "host" {
+				row[i] = l.Fields[key]
+			}
+		}
+		if l.Error != nil {
+			log.Logvf(log.Always, "%v: %v", l.Fields["host"], l.Error)
+		}
+		out.Write(row)
+	}
+	out.Flush()
+
+	clf.increment()
+	return buf.String()
+}
@@ -0,0 +1,120 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package stat_consumer
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/mongodb/mongo-tools/mongostat/stat_consumer/line"
+	"github.com/mongodb/mongo-tools/mongostat/status"
+)
+
+// graphiteTimeout bounds connecting and writing to Graphite, so that a slow
+// Graphite server does not hold up sampling.
+const graphiteTimeout = 5 * time.Second
+
+// GraphiteSink pushes the machine readable value of each displayed field of
+// every sample to a Graphite server, in its plaintext protocol, as metrics
+// named <prefix>.<host>.<field>.
+type GraphiteSink struct {
+	addr   string
+	prefix string
+	conn   net.Conn
+}
+
+// DialGraphite connects to the Graphite server listening for plaintext
+// metrics at addr, e.g. graphite:2003.
+func DialGraphite(addr, prefix string) (*GraphiteSink, error) {
+	sink := &GraphiteSink{addr: addr, prefix: metricNode(prefix, true)}
+	if err := sink.dial(); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+func (g *GraphiteSink) dial() error {
+	conn, err := net.DialTimeout("tcp", g.addr, graphiteTimeout)
+	if err != nil {
+		return fmt.Errorf("error connecting to Graphite at %v: %v", g.addr, err)
+	}
+	g.conn = conn
+	return nil
+}
+
+// Close closes the connection to Graphite.
+func (g *GraphiteSink) Close() error {
+	if g.conn == nil {
+		return nil
+	}
+	return g.conn.Close()
+}
+
+// FormatMetrics returns the lines of the plaintext protocol for the numeric
+// raw values of a host's fields, sampled at t. Labels such as the host are
+// not metrics, and fields without a numeric value are left out.
+func (g *GraphiteSink) FormatMetrics(host string, t time.Time, keys []string, keyNames map[string]string, raw map[string]interface{}) []byte {
+	buf := &bytes.Buffer{}
+	prefix := metricNode(host, false)
+	if g.prefix != "" {
+		prefix = g.prefix + "." + prefix
+	}
+	for _, key := range keys {
+		if line.HeaderKind(key) == line.KindLabel || key == SparklineKey {
+			continue
+		}
+		values, ok := raw[key].([]interface{})
+		if !ok {
+			values = []interface{}{raw[key]}
+		}
+		header := keyNames[key]
+		if header == "" {
+			header = key
+		}
+		for i, name := range dottedMetricNames(key, header, len(values)) {
+			switch values[i].(type) {
+			case int64, float64:
+				fmt.Fprintf(buf, "%v.%v %v %v\n", prefix, name, values[i], t.Unix())
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+// Send writes metrics to Graphite, reconnecting first if the previous write
+// failed.
+func (g *GraphiteSink) Send(metrics []byte) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	if g.conn == nil {
+		if err := g.dial(); err != nil {
+			return err
+		}
+	}
+	g.conn.SetWriteDeadline(time.Now().Add(graphiteTimeout))
+	if _, err := g.conn.Write(metrics); err != nil {
+		g.conn.Close()
+		g.conn = nil
+		return err
+	}
+	return nil
+}
+
+// PushToGraphite pushes the raw values of the displayed fields of each
+// sample to sink.
+func (sc *StatConsumer) PushToGraphite(sink *GraphiteSink) {
+	sc.graphite = sink
+}
+
+// pushSample pushes the raw values of l, read from newStat, to Graphite.
+func (sc *StatConsumer) pushSample(l *line.StatLine, oldStat, newStat *status.ServerStatus) error {
+	raw := sc.rawValues(l, oldStat, newStat)
+	return sc.graphite.Send(sc.graphite.FormatMetrics(newStat.Host, newStat.SampleTime, sc.fieldKeys(), sc.keyNames, raw))
+}
@@ -27,14 +27,23 @@ type GridLineFormatter struct {
 	// Counter for periodic headers
 	index int
 
+	// Number of chunks before the header is re-printed, or 0 to print it
+	// only when the hosts or columns change
+	headerInterval int
+
 	// Tracks number of hosts so we can reprint headers when it changes
 	prevLineCount int
+
+	// Tracks the column names so we can reprint headers when they change,
+	// e.g. when a column's unit grows
+	prevHeader string
 }
 
 func NewGridLineFormatter(maxRows int64, includeHeader bool) LineFormatter {
 	return &GridLineFormatter{
 		limitableFormatter: &limitableFormatter{maxRows: maxRows},
 		includeHeader:      includeHeader,
+		headerInterval:     defaultHeaderInterval,
 		GridWriter:         &text.GridWriter{ColumnPadding: 1},
 	}
 }
@@ -43,8 +52,14 @@ func init() {
 	FormatterConstructors[""] = NewGridLineFormatter
 }
 
-// headerInterval is the number of chunks before the header is re-printed in GridLineFormatter
-const headerInterval = 10
+// defaultHeaderInterval is the number of chunks before the header is re-printed in GridLineFormatter
+const defaultHeaderInterval = 10
+
+// SetHeaderInterval sets the number of chunks before the header is
+// re-printed, or 0 to print it only when the hosts or columns change.
+func (glf *GridLineFormatter) SetHeaderInterval(interval int) {
+	glf.headerInterval = interval
+}
 
 func (glf *GridLineFormatter) Finish() {
 }
@@ -58,9 +73,11 @@ func (glf *GridLineFormatter) FormatLines(lines []*line.StatLine, headerKeys []s
 	sort.Sort(line.StatLines(lines))
 
 	// Print the columns that are enabled
+	headers := make([]string, 0, len(headerKeys))
 	for _, key := range headerKeys {
 		header := keyNames[key]
 		glf.WriteCell(header)
+		headers = append(headers, header)
 	}
 	glf.EndRow()
 
@@ -88,10 +105,12 @@ func (glf *GridLineFormatter) FormatLines(lines []*line.StatLine, headerKeys []s
 
 	gridLine := buf.String()
 
-	if glf.prevLineCount != len(lines) {
+	header := strings.Join(headers, " ")
+	if glf.prevLineCount != len(lines) || glf.prevHeader != header {
 		glf.index = 0
 	}
 	glf.prevLineCount = len(lines)
+	glf.prevHeader = header
 
 	if !glf.includeHeader || glf.index != 0 {
 		// Strip out the first line of the formatted output,
@@ -103,7 +122,7 @@ func (glf *GridLineFormatter) FormatLines(lines []*line.StatLine, headerKeys []s
 		}
 	}
 	glf.index++
-	if glf.index == headerInterval {
+	if glf.index == glf.headerInterval {
 		glf.index = 0
 	}
 
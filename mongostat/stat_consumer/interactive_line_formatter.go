@@ -13,6 +13,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"unicode/utf8"
 
 	"github.com/mongodb/mongo-tools/mongostat/stat_consumer/line"
 	"github.com/nsf/termbox-go"
@@ -109,7 +110,7 @@ func (ilf *InteractiveLineFormatter) FormatLines(lines []*line.StatLine, headerK
 			cell.text = newText
 			cell.feed = false
 			cell.header = j == 0 && ilf.includeHeader
-			if w := len(cell.text); w > column.width {
+			if w := utf8.RuneCountInString(cell.text); w > column.width {
 				column.width = w
 			}
 		}
@@ -200,8 +201,10 @@ Redraw: 'r' to fix broken-looking output`
 
 func writeString(x, y int, text string, fg, bg termbox.Attribute) {
 	for i, str := range strings.Split(text, "\n") {
-		for j, ch := range str {
+		j := 0
+		for _, ch := range str {
 			termbox.SetCell(x+j, y+i, ch, fg, bg)
+			j++
 		}
 	}
 }
@@ -232,7 +235,7 @@ func (ilf *InteractiveLineFormatter) update() {
 				fgAttr |= termbox.AttrUnderline
 				fgAttr |= termbox.AttrBold
 			}
-			padding := column.width - len(cell.text)
+			padding := column.width - utf8.RuneCountInString(cell.text)
 			if cell.feed && padding < 0 {
 				padding = 0
 			}
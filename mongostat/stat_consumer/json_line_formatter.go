@@ -52,6 +52,13 @@ func (jlf *JSONLineFormatter) FormatLines(lines []*line.StatLine, headerKeys []s
 		}
 
 		for _, key := range headerKeys {
+			if l.Raw != nil {
+				lineJson[keyNames[key]] = map[string]interface{}{
+					"raw":     l.Raw[key],
+					"display": l.Fields[key],
+				}
+				continue
+			}
 			lineJson[keyNames[key]] = l.Fields[key]
 		}
 		jsonFormat[l.Fields["host"]] = lineJson
@@ -7,12 +7,24 @@
 package line
 
 import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/text"
 	"github.com/mongodb/mongo-tools/mongostat/status"
 )
 
 // StatLine is a wrapper for all metrics reported by mongostat for monitored hosts
 type StatLine struct {
-	Fields  map[string]string
+	Fields map[string]string
+	// Raw holds the machine readable value of each field, as returned by
+	// RawValue, if ReaderConfig.IncludeRaw is set
+	Raw map[string]interface{}
+	// Amounts holds the machine readable amount of each field in UnitColumns,
+	// if ReaderConfig.ScaleUnits is set, for it to be shown in the column's unit
+	Amounts map[string]int64
 	Error   error
 	Printed bool
 }
@@ -31,17 +43,62 @@ func (slice StatLines) Swap(i, j int) {
 	slice[i], slice[j] = slice[j], slice[i]
 }
 
+// ErrRestarted is the Error of the line of a sample taken after its host
+// restarted, whose counters cannot be diffed with the previous sample.
+var ErrRestarted = errors.New("--restart--")
+
+// NewRestartLine returns the line shown in place of the first sample of host
+// after it restarted.
+func NewRestartLine(host string) *StatLine {
+	return &StatLine{
+		Error:  ErrRestarted,
+		Fields: map[string]string{"host": host},
+	}
+}
+
+// Stale returns a copy of l to show again in place of a sample of its host
+// which could not be taken, with its time marked by a trailing '*'.
+func (l *StatLine) Stale() *StatLine {
+	fields := make(map[string]string, len(l.Fields))
+	for key, value := range l.Fields {
+		fields[key] = value
+	}
+	if t, ok := fields["time"]; ok {
+		fields["time"] = t + "*"
+	}
+	return &StatLine{Fields: fields, Raw: l.Raw, Amounts: l.Amounts}
+}
+
 // NewStatLine constructs a StatLine object from two ServerStatus objects
 func NewStatLine(oldStat, newStat *status.ServerStatus, headerKeys []string, c *status.ReaderConfig) *StatLine {
 	line := &StatLine{
 		Fields: make(map[string]string),
 	}
+	// raw values are read without human readable units, in the same time
+	// zone and format
+	rawConfig := &status.ReaderConfig{Location: c.Location, TimeFormat: c.TimeFormat}
+	if c.IncludeRaw {
+		line.Raw = make(map[string]interface{})
+	}
 	for _, key := range headerKeys {
-		_, ok := StatHeaders[key]
-		if ok {
-			line.Fields[key] = StatHeaders[key].ReadField(c, newStat, oldStat)
-		} else {
-			line.Fields[key] = status.InterpretField(key, newStat, oldStat)
+		if status.MissingSections(newStat, key) != nil {
+			line.Fields[key] = status.PrivilegeMissing
+			if line.Raw != nil {
+				line.Raw[key] = nil
+			}
+			continue
+		}
+		line.Fields[key] = readField(key, c, newStat, oldStat)
+		if line.Raw != nil {
+			line.Raw[key] = RawValue(readField(key, rawConfig, newStat, oldStat))
+		}
+		if _, ok := UnitColumns[key]; ok && c.ScaleUnits && c.HumanReadable {
+			if amount, err := strconv.ParseInt(readField(key, rawConfig, newStat, oldStat), 10, 64); err == nil {
+				if line.Amounts == nil {
+					line.Amounts = make(map[string]int64)
+				}
+				line.Amounts[key] = amount
+			}
 		}
 	}
 	// We always need host and storage_engine, even if they aren't being displayed
@@ -49,3 +106,161 @@ func NewStatLine(oldStat, newStat *status.ServerStatus, headerKeys []string, c *
 	line.Fields["storage_engine"] = StatHeaders["storage_engine"].ReadField(c, newStat, oldStat)
 	return line
 }
+
+func readField(key string, c *status.ReaderConfig, newStat, oldStat *status.ServerStatus) string {
+	if header, ok := StatHeaders[key]; ok {
+		return header.ReadField(c, newStat, oldStat)
+	}
+	return status.InterpretField(key, newStat, oldStat)
+}
+
+// UnitColumns are the columns whose human readable amounts can be shown in
+// a single unit, with the scale for each.
+var UnitColumns = map[string]func() *text.UnitScale{
+	"hs_bytes":      text.NewShortByteScale,
+	"cache_balance": text.NewShortByteScale,
+	"mapped":        text.NewShortByteScale,
+	"vsize":         text.NewShortByteScale,
+	"res":           text.NewShortByteScale,
+	"nonmapped":     text.NewShortByteScale,
+	"net_in":        text.NewBitScale,
+	"net_out":       text.NewBitScale,
+}
+
+// RawValue converts a field read in machine readable form to a number, or to
+// a slice of numbers for fields with several "|"-separated values. A "*"
+// prefix, marking replicated operations, and a "%" suffix are dropped. Fields
+// which are not numeric, such as "db:12.0%" in locked_db, are returned as they
+// are, and empty fields as nil.
+func RawValue(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	parts := strings.Split(s, "|")
+	values := make([]interface{}, len(parts))
+	for i, part := range parts {
+		part = strings.TrimSuffix(strings.TrimPrefix(part, "*"), "%")
+		if n, err := strconv.ParseInt(part, 10, 64); err == nil {
+			values[i] = n
+		} else if f, err := strconv.ParseFloat(part, 64); err == nil {
+			values[i] = f
+		} else {
+			return s
+		}
+	}
+	if len(values) == 1 {
+		return values[0]
+	}
+	return values
+}
+
+// unchangingKeys are fields which are never considered when deciding whether
+// a host's metrics have changed between two lines.
+var unchangingKeys = map[string]bool{
+	"host": true,
+	"time": true,
+}
+
+// unitMultipliers maps the unit suffixes used by the human readable
+// formatters to their multipliers.
+var unitMultipliers = map[byte]float64{
+	'b': 1, 'k': 1e3, 'm': 1e6, 'g': 1e9,
+	'B': 1, 'K': 1 << 10, 'M': 1 << 20, 'G': 1 << 30,
+}
+
+// ParseFieldNumber parses a single formatted numeric value such as "*12",
+// "3.00k", "1.2G" or "45.1%".
+func ParseFieldNumber(s string) (float64, bool) {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "*"), "%")
+	multiplier := 1.0
+	if len(s) > 0 {
+		if m, ok := unitMultipliers[s[len(s)-1]]; ok {
+			multiplier = m
+			s = s[:len(s)-1]
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	return f * multiplier, true
+}
+
+// fieldChanged returns true if the formatted field moved from oldVal to newVal
+// by more than threshold, relative to oldVal. Fields with several
+// "|"-separated values are changed if any of their parts changed, and fields
+// which are not numeric are changed if they differ at all.
+func fieldChanged(oldVal, newVal string, threshold float64) bool {
+	if oldVal == newVal {
+		return false
+	}
+	// fields like locked_db are prefixed with a label, e.g. "test:12.0%"
+	if i := strings.LastIndex(newVal, ":"); i >= 0 {
+		j := strings.LastIndex(oldVal, ":")
+		if j < 0 || oldVal[:j] != newVal[:i] {
+			return true
+		}
+		oldVal, newVal = oldVal[j+1:], newVal[i+1:]
+	}
+	oldParts := strings.Split(oldVal, "|")
+	newParts := strings.Split(newVal, "|")
+	if len(oldParts) != len(newParts) {
+		return true
+	}
+	for i := range newParts {
+		o, okOld := ParseFieldNumber(oldParts[i])
+		n, okNew := ParseFieldNumber(newParts[i])
+		if !okOld || !okNew {
+			if oldParts[i] != newParts[i] {
+				return true
+			}
+			continue
+		}
+		if o == 0 {
+			if n != 0 {
+				return true
+			}
+			continue
+		}
+		if math.Abs(n-o)/math.Abs(o) > threshold {
+			return true
+		}
+	}
+	return false
+}
+
+// ChangedFrom returns true if any of the fields in headerKeys differs between
+// prev and the receiver by more than threshold, a fraction of the previous
+// value. Lines carrying an error, or without a previous line to compare
+// against, are always considered changed.
+func (l *StatLine) ChangedFrom(prev *StatLine, headerKeys []string, threshold float64) bool {
+	if prev == nil || l.Error != nil || prev.Error != nil {
+		return true
+	}
+	for _, key := range headerKeys {
+		if unchangingKeys[key] {
+			continue
+		}
+		if fieldChanged(prev.Fields[key], l.Fields[key], threshold) {
+			return true
+		}
+	}
+	return false
+}
+
+// NumericValues returns the numeric values of the formatted field key, one for
+// each "|"-separated part, ignoring any label prefix such as "test:" in
+// locked_db. Parts which are not numeric are skipped.
+func (l *StatLine) NumericValues(key string) []float64 {
+	val := l.Fields[key]
+	if i := strings.LastIndex(val, ":"); i >= 0 {
+		val = val[i+1:]
+	}
+	var values []float64
+	for _, part := range strings.Split(val, "|") {
+		if f, ok := ParseFieldNumber(part); ok {
+			values = append(values, f)
+		}
+	}
+	return values
+}
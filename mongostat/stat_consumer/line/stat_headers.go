@@ -7,6 +7,8 @@
 package line
 
 import (
+	"strings"
+
 	"github.com/mongodb/mongo-tools/mongostat/status"
 )
 
@@ -20,6 +22,8 @@ const (
 	FlagAll                  // only active if mongostat was run with --all option
 	FlagMMAP                 // only active if node has mmap-specific fields
 	FlagWT                   // only active if node has wiredtiger-specific fields
+	FlagSys                  // only active if mongostat was run with --sys option
+	FlagJSON                 // only active if mongostat was run with --json option
 )
 
 // StatHeader describes a single column for mongostat's terminal output,
@@ -28,6 +32,28 @@ type StatHeader struct {
 	// ReadField produces a particular field according to the StatHeader instance.
 	// Some fields are based on a diff, so both latest ServerStatuses are taken.
 	ReadField func(c *status.ReaderConfig, newStat, oldStat *status.ServerStatus) string
+
+	// Kind classifies the field as a label, a rate or a gauge.
+	Kind int
+}
+
+// Kinds of fields, so that only rates or only gauges can be displayed.
+const (
+	KindLabel = iota // identifies the sample, e.g. its host or time
+	KindRate         // a difference between two samples, e.g. an opcounter
+	KindGauge        // a value at the time of the sample, e.g. the resident size
+)
+
+// HeaderKind returns the kind of the field with the given key. Custom fields
+// are rates if they use the .diff() or .rate() methods, and gauges otherwise.
+func HeaderKind(key string) int {
+	if header, ok := StatHeaders[key]; ok {
+		return header.Kind
+	}
+	if strings.HasSuffix(key, ".diff()") || strings.HasSuffix(key, ".rate()") {
+		return KindRate
+	}
+	return KindGauge
 }
 
 // StatHeaders are the complete set of data metrics supported by mongostat.
@@ -43,6 +69,11 @@ var (
 		"command":        {"command", "Command opcounter (diff)", "command"},
 		"dirty":          {"dirty", "Cache dirty (percentage)", "% dirty"},
 		"used":           {"used", "Cache used (percentage)", "% used"},
+		"hs_bytes":       {"hs_bytes", "History store on-disk (size)", "hs bytes"},
+		"hs_score":       {"hs_score", "History store score (percentage)", "hs score"},
+		"hs_read":        {"hs_read", "History store reads per second (diff)", "hs read"},
+		"hs_write":       {"hs_write", "History store writes per second (diff)", "hs write"},
+		"cache_balance":  {"cache_balance", "Bytes read into the cache less bytes written from and evicted from it, per second (diff)", "cache-balance"},
 		"flushes":        {"flushes", "Number of flushes (diff)", "flushes"},
 		"mapped":         {"mapped", "Mapped (size)", "mapped"},
 		"vsize":          {"vsize", "Virtual (size)", "vsize"},
@@ -57,38 +88,59 @@ var (
 		"net_in":         {"net_in", "Network input (size)", "netIn"},
 		"net_out":        {"net_out", "Network output (size)", "netOut"},
 		"conn":           {"conn", "Current connection count", "conn"},
+		"ping":           {"ping", "Round-trip time of the serverStatus command, latest|rolling p95", "ping"},
+		"runq":           {"runq", "Run queue length of the local host", "runq"},
+		"disk_util":      {"disk_util", "Busiest local disk utilization, '(device):(percentage)'", "disk util"},
+		"swap_in":        {"swap_in", "Pages swapped in on the local host (diff)", "swapIn"},
+		"numa_miss":      {"numa_miss", "Pages allocated off their preferred NUMA node on the local host (diff)", "numaMiss"},
 		"set":            {"set", "FlagReplica set name", "set"},
 		"repl":           {"repl", "FlagReplica set type", "repl"},
+		"events":         {"events", "Replica set state changes, elections and rollbacks since the previous sample", "events"},
 		"time":           {"time", "Time of sample", "time"},
+		"seq":            {"seq", "Sample sequence number, increasing across all hosts", "seq"},
+		"interval":       {"interval", "Actual time since the previous sample of the host, in seconds", "interval"},
 	}
 	StatHeaders = map[string]StatHeader{
-		"host":           {status.ReadHost},
-		"storage_engine": {status.ReadStorageEngine},
-		"insert":         {status.ReadInsert},
-		"query":          {status.ReadQuery},
-		"update":         {status.ReadUpdate},
-		"delete":         {status.ReadDelete},
-		"getmore":        {status.ReadGetMore},
-		"command":        {status.ReadCommand},
-		"dirty":          {status.ReadDirty},
-		"used":           {status.ReadUsed},
-		"flushes":        {status.ReadFlushes},
-		"mapped":         {status.ReadMapped},
-		"vsize":          {status.ReadVSize},
-		"res":            {status.ReadRes},
-		"nonmapped":      {status.ReadNonMapped},
-		"faults":         {status.ReadFaults},
-		"lrw":            {status.ReadLRW},
-		"lrwt":           {status.ReadLRWT},
-		"locked_db":      {status.ReadLockedDB},
-		"qrw":            {status.ReadQRW},
-		"arw":            {status.ReadARW},
-		"net_in":         {status.ReadNetIn},
-		"net_out":        {status.ReadNetOut},
-		"conn":           {status.ReadConn},
-		"set":            {status.ReadSet},
-		"repl":           {status.ReadRepl},
-		"time":           {status.ReadTime},
+		"host":           {status.ReadHost, KindLabel},
+		"storage_engine": {status.ReadStorageEngine, KindLabel},
+		"insert":         {status.ReadInsert, KindRate},
+		"query":          {status.ReadQuery, KindRate},
+		"update":         {status.ReadUpdate, KindRate},
+		"delete":         {status.ReadDelete, KindRate},
+		"getmore":        {status.ReadGetMore, KindRate},
+		"command":        {status.ReadCommand, KindRate},
+		"dirty":          {status.ReadDirty, KindGauge},
+		"used":           {status.ReadUsed, KindGauge},
+		"hs_bytes":       {status.ReadHSBytes, KindGauge},
+		"hs_score":       {status.ReadHSScore, KindGauge},
+		"hs_read":        {status.ReadHSRead, KindRate},
+		"hs_write":       {status.ReadHSWrite, KindRate},
+		"cache_balance":  {status.ReadCacheBalance, KindRate},
+		"flushes":        {status.ReadFlushes, KindRate},
+		"mapped":         {status.ReadMapped, KindGauge},
+		"vsize":          {status.ReadVSize, KindGauge},
+		"res":            {status.ReadRes, KindGauge},
+		"nonmapped":      {status.ReadNonMapped, KindGauge},
+		"faults":         {status.ReadFaults, KindRate},
+		"lrw":            {status.ReadLRW, KindRate},
+		"lrwt":           {status.ReadLRWT, KindRate},
+		"locked_db":      {status.ReadLockedDB, KindRate},
+		"qrw":            {status.ReadQRW, KindGauge},
+		"arw":            {status.ReadARW, KindGauge},
+		"net_in":         {status.ReadNetIn, KindRate},
+		"net_out":        {status.ReadNetOut, KindRate},
+		"conn":           {status.ReadConn, KindGauge},
+		"ping":           {status.ReadPing, KindGauge},
+		"runq":           {status.ReadRunQueue, KindGauge},
+		"disk_util":      {status.ReadDiskUtil, KindGauge},
+		"swap_in":        {status.ReadSwapIn, KindRate},
+		"numa_miss":      {status.ReadNUMAMiss, KindRate},
+		"set":            {status.ReadSet, KindLabel},
+		"repl":           {status.ReadRepl, KindLabel},
+		"events":         {status.ReadEvents, KindRate},
+		"time":           {status.ReadTime, KindLabel},
+		"seq":            {status.ReadSequence, KindLabel},
+		"interval":       {status.ReadInterval, KindLabel},
 	}
 	CondHeaders = []struct {
 		Key  string
@@ -103,6 +155,11 @@ var (
 		{"command", FlagAlways},
 		{"dirty", FlagWT},
 		{"used", FlagWT},
+		{"hs_bytes", FlagWT},
+		{"hs_score", FlagWT},
+		{"hs_read", FlagWT},
+		{"hs_write", FlagWT},
+		{"cache_balance", FlagWT | FlagAll},
 		{"flushes", FlagAlways},
 		{"mapped", FlagMMAP},
 		{"vsize", FlagAlways},
@@ -117,9 +174,17 @@ var (
 		{"net_in", FlagAlways},
 		{"net_out", FlagAlways},
 		{"conn", FlagAlways},
+		{"ping", FlagAll},
+		{"runq", FlagSys},
+		{"disk_util", FlagSys},
+		{"swap_in", FlagSys},
+		{"numa_miss", FlagSys},
 		{"set", FlagRepl},
 		{"repl", FlagRepl},
+		{"events", FlagRepl},
 		{"time", FlagAlways},
+		{"seq", FlagJSON},
+		{"interval", FlagJSON},
 	}
 )
 
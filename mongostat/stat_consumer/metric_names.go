@@ -0,0 +1,79 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package stat_consumer
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// dottedPartNames names the metrics of fields holding several values, such
+// as "qr|qw", below the metric of the field, in the dotted metric paths of
+// Graphite, StatsD and OTLP. Opcounters on a secondary also hold the
+// replicated operations, see dottedMetricNames.
+var dottedPartNames = map[string][]string{
+	"qrw":  {"r", "w"},
+	"arw":  {"r", "w"},
+	"lrw":  {"r", "w"},
+	"lrwt": {"r", "w"},
+	"ping": {"latest", "p95"},
+}
+
+var invalidMetricNodeChars = regexp.MustCompile(`[^a-zA-Z0-9_.\-]+`)
+
+// metricNode returns name as a node of a dotted metric path, or as several
+// nodes if it is dotted and dots is set.
+func metricNode(name string, dots bool) string {
+	if !dots {
+		name = strings.Replace(name, ".", "_", -1)
+	}
+	return strings.Trim(invalidMetricNodeChars.ReplaceAllString(name, "_"), "._")
+}
+
+// dottedMetricNames returns the metric paths, relative to the host, of the
+// n values of the field with the given key, displayed under the given
+// header name. Dotted header names, such as those of custom fields, are
+// kept as hierarchies.
+func dottedMetricNames(key, header string, n int) []string {
+	base := metricNode(header, true)
+	names := make([]string, n)
+	parts := dottedPartNames[key]
+	for i := range names {
+		switch {
+		case n == 1:
+			names[i] = base
+		case len(parts) == n:
+			names[i] = base + "." + parts[i]
+		case n == 2 && i == 1:
+			names[i] = base + "_repl"
+		case i == 0:
+			names[i] = base
+		default:
+			names[i] = fmt.Sprintf("%v_%v", base, i)
+		}
+	}
+	return names
+}
+
+// intervalCount returns the number of events counted by the raw value of a
+// rate field over the elapsed time. Custom fields read with .diff() are
+// counts already; other rates are per second.
+func intervalCount(key string, value interface{}, elapsed time.Duration) interface{} {
+	if strings.HasSuffix(key, ".diff()") {
+		return value
+	}
+	switch v := value.(type) {
+	case int64:
+		return int64(math.Round(float64(v) * elapsed.Seconds()))
+	case float64:
+		return v * elapsed.Seconds()
+	}
+	return value
+}
@@ -0,0 +1,230 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package stat_consumer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongo-tools/mongostat/stat_consumer/line"
+	"github.com/mongodb/mongo-tools/mongostat/status"
+)
+
+// otlpTimeout bounds each export to the OpenTelemetry collector, so that a
+// slow collector does not hold up sampling.
+const otlpTimeout = 5 * time.Second
+
+// otlpMetricsPath is where OTLP/HTTP receivers accept metrics.
+const otlpMetricsPath = "/v1/metrics"
+
+// otlpDeltaTemporality is AGGREGATION_TEMPORALITY_DELTA, meaning that each
+// point of a sum counts the events since the previous one.
+const otlpDeltaTemporality = 1
+
+// The OTLP/HTTP JSON encoding of ExportMetricsServiceRequest, reduced to
+// what mongostat exports. 64-bit integers are encoded as strings.
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetric struct {
+	Name  string     `json:"name"`
+	Gauge *otlpGauge `json:"gauge,omitempty"`
+	Sum   *otlpSum   `json:"sum,omitempty"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+}
+
+type otlpDataPoint struct {
+	Attributes        []otlpAttribute `json:"attributes"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	AsInt             string          `json:"asInt,omitempty"`
+	AsDouble          *float64        `json:"asDouble,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func otlpStringAttribute(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: value}}
+}
+
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// OTLPExporter exports the machine readable value of each displayed field of
+// every sample to an OpenTelemetry collector, over OTLP/HTTP in its JSON
+// encoding: rates as delta sums of the events since the previous sample,
+// and other fields as gauges, with attributes naming the host and its
+// replica set.
+type OTLPExporter struct {
+	endpoint string
+	client   *http.Client
+}
+
+// NewOTLPExporter returns an exporter to the OTLP/HTTP receiver at endpoint,
+// e.g. http://localhost:4318. Metrics are posted to /v1/metrics unless
+// endpoint has a path of its own.
+func NewOTLPExporter(endpoint string) (*OTLPExporter, error) {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP endpoint %v: %v", endpoint, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %v: the scheme must be http or https", endpoint)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %v: missing host", endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = otlpMetricsPath
+	}
+	return &OTLPExporter{
+		endpoint: u.String(),
+		client:   &http.Client{Timeout: otlpTimeout},
+	}, nil
+}
+
+// FormatMetrics returns the OTLP/HTTP request body exporting the numeric raw
+// values of a host's fields, sampled at t, with rates counted since start.
+// Labels such as the host are attributes rather than metrics, and fields
+// without a numeric value are left out.
+func (o *OTLPExporter) FormatMetrics(host, replSet string, start, t time.Time, keys []string, keyNames map[string]string, raw map[string]interface{}) ([]byte, error) {
+	attributes := []otlpAttribute{otlpStringAttribute("host", host)}
+	if replSet != "" {
+		attributes = append(attributes, otlpStringAttribute("replica_set", replSet))
+	}
+	elapsed := t.Sub(start)
+
+	var metrics []otlpMetric
+	for _, key := range keys {
+		kind := line.HeaderKind(key)
+		if kind == line.KindLabel || key == SparklineKey {
+			continue
+		}
+		values, ok := raw[key].([]interface{})
+		if !ok {
+			values = []interface{}{raw[key]}
+		}
+		header := keyNames[key]
+		if header == "" {
+			header = key
+		}
+		for i, name := range dottedMetricNames(key, header, len(values)) {
+			value := values[i]
+			if kind == line.KindRate {
+				value = intervalCount(key, value, elapsed)
+			}
+			point := otlpDataPoint{Attributes: attributes, TimeUnixNano: otlpTime(t)}
+			switch v := value.(type) {
+			case int64:
+				point.AsInt = strconv.FormatInt(v, 10)
+			case float64:
+				point.AsDouble = &v
+			default:
+				continue
+			}
+			metric := otlpMetric{Name: "mongostat." + name}
+			if kind == line.KindRate {
+				point.StartTimeUnixNano = otlpTime(start)
+				metric.Sum = &otlpSum{
+					DataPoints:             []otlpDataPoint{point},
+					AggregationTemporality: otlpDeltaTemporality,
+					IsMonotonic:            true,
+				}
+			} else {
+				metric.Gauge = &otlpGauge{DataPoints: []otlpDataPoint{point}}
+			}
+			metrics = append(metrics, metric)
+		}
+	}
+
+	return json.Marshal(otlpRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource: otlpResource{Attributes: []otlpAttribute{otlpStringAttribute("service.name", "mongostat")}},
+		ScopeMetrics: []otlpScopeMetrics{{
+			Scope:   otlpScope{Name: "mongostat"},
+			Metrics: metrics,
+		}},
+	}}})
+}
+
+// Send posts a request body returned by FormatMetrics to the collector.
+func (o *OTLPExporter) Send(body []byte) error {
+	resp, err := o.client.Post(o.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%v from %v: %s", resp.Status, o.endpoint, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// ExportToOTLP exports the raw values of the displayed fields of each sample
+// to exporter.
+func (sc *StatConsumer) ExportToOTLP(exporter *OTLPExporter) {
+	sc.otlp = exporter
+}
+
+// exportSample exports the raw values of l, read from oldStat and newStat,
+// to the OpenTelemetry collector.
+func (sc *StatConsumer) exportSample(l *line.StatLine, oldStat, newStat *status.ServerStatus) error {
+	raw := sc.rawValues(l, oldStat, newStat)
+	body, err := sc.otlp.FormatMetrics(newStat.Host, status.ReadSet(nil, newStat, nil),
+		oldStat.SampleTime, newStat.SampleTime, sc.fieldKeys(), sc.keyNames, raw)
+	if err != nil {
+		return err
+	}
+	return sc.otlp.Send(body)
+}
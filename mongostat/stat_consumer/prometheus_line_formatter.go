@@ -0,0 +1,223 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package stat_consumer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/prometheus"
+	"github.com/mongodb/mongo-tools/mongostat/stat_consumer/line"
+)
+
+// prometheusPartNames names the metrics of fields holding several values,
+// such as "qr|qw". Opcounters on a secondary also hold the replicated
+// operations, see prometheusMetricNames.
+var prometheusPartNames = map[string][]string{
+	"qrw":  {"qr", "qw"},
+	"arw":  {"ar", "aw"},
+	"lrw":  {"lr", "lw"},
+	"lrwt": {"lrt", "lwt"},
+	"ping": {"ping", "ping_p95"},
+}
+
+var invalidMetricChars = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// prometheusMetricNames returns the names of the metrics of the n values of
+// the field with the given key.
+func prometheusMetricNames(key string, n int) []string {
+	base := strings.Trim(invalidMetricChars.ReplaceAllString(key, "_"), "_")
+	names := make([]string, n)
+	parts := prometheusPartNames[key]
+	for i := range names {
+		switch {
+		case n == 1:
+			names[i] = "mongostat_" + base
+		case len(parts) == n:
+			names[i] = "mongostat_" + parts[i]
+		case n == 2 && i == 1:
+			names[i] = "mongostat_" + base + "_repl"
+		case i == 0:
+			names[i] = "mongostat_" + base
+		default:
+			names[i] = fmt.Sprintf("mongostat_%v_%v", base, i)
+		}
+	}
+	return names
+}
+
+// PrometheusLineFormatter keeps the latest StatLine of each host and serves
+// their fields as Prometheus gauges labeled by host, rather than printing
+// them. Only fields with numeric raw values are served, so the StatLines
+// must be read with ReaderConfig.IncludeRaw set.
+type PrometheusLineFormatter struct {
+	*limitableFormatter
+
+	mu         sync.Mutex
+	lines      map[string]*line.StatLine
+	sampled    map[string]time.Time
+	headerKeys []string
+}
+
+func NewPrometheusLineFormatter(maxRows int64, _ bool) LineFormatter {
+	return &PrometheusLineFormatter{
+		limitableFormatter: &limitableFormatter{maxRows: maxRows},
+		lines:              make(map[string]*line.StatLine),
+		sampled:            make(map[string]time.Time),
+	}
+}
+
+func init() {
+	FormatterConstructors["prometheus"] = NewPrometheusLineFormatter
+}
+
+func (plf *PrometheusLineFormatter) Finish() {
+}
+
+// FormatLines records the StatLines to be served, and returns nothing to
+// print
+func (plf *PrometheusLineFormatter) FormatLines(lines []*line.StatLine, headerKeys []string, _ map[string]string) string {
+	plf.mu.Lock()
+	defer plf.mu.Unlock()
+	now := time.Now()
+	for _, l := range lines {
+		if l.Printed && l.Error == nil {
+			l.Error = fmt.Errorf("no data received")
+		}
+		l.Printed = true
+		host := l.Fields["host"]
+		plf.lines[host] = l
+		if l.Error == nil {
+			plf.sampled[host] = now
+		}
+	}
+	plf.headerKeys = headerKeys
+	plf.increment()
+	return ""
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (plf *PrometheusLineFormatter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", prometheus.ContentType)
+	out := bufio.NewWriter(w)
+	plf.WriteMetrics(out)
+	out.Flush()
+}
+
+// WriteMetrics writes the metrics of the latest StatLine of each host.
+func (plf *PrometheusLineFormatter) WriteMetrics(out io.Writer) {
+	plf.mu.Lock()
+	defer plf.mu.Unlock()
+
+	hosts := make([]string, 0, len(plf.lines))
+	for host := range plf.lines {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	helps := line.LongKeyMap()
+	for _, key := range plf.headerKeys {
+		if line.HeaderKind(key) == line.KindLabel {
+			continue
+		}
+		// the samples of each metric of the field, in order
+		var names []string
+		samples := map[string][]string{}
+		for _, host := range hosts {
+			l := plf.lines[host]
+			if l.Error != nil {
+				continue
+			}
+			values, ok := l.Raw[key].([]interface{})
+			if !ok {
+				values = []interface{}{l.Raw[key]}
+			}
+			for i, name := range prometheusMetricNames(key, len(values)) {
+				switch values[i].(type) {
+				case int64, float64:
+				default:
+					continue
+				}
+				if _, ok := samples[name]; !ok {
+					names = append(names, name)
+				}
+				samples[name] = append(samples[name],
+					fmt.Sprintf("%v{host=\"%v\"} %v", name, prometheus.EscapeLabelValue(host), values[i]))
+			}
+		}
+		for _, name := range names {
+			help := helps[key]
+			if help == "" {
+				help = key
+			}
+			fmt.Fprintf(out, "# HELP %v %v\n", name, help)
+			fmt.Fprintf(out, "# TYPE %v gauge\n", name)
+			for _, sample := range samples[name] {
+				fmt.Fprintln(out, sample)
+			}
+		}
+	}
+
+	fmt.Fprintln(out, "# HELP mongostat_up Whether the latest sample of the host succeeded.")
+	fmt.Fprintln(out, "# TYPE mongostat_up gauge")
+	for _, host := range hosts {
+		up := 1
+		if plf.lines[host].Error != nil {
+			up = 0
+		}
+		fmt.Fprintf(out, "mongostat_up{host=\"%v\"} %v\n", prometheus.EscapeLabelValue(host), up)
+	}
+
+	fmt.Fprintln(out, "# HELP mongostat_info The storage engine and replica set of the host.")
+	fmt.Fprintln(out, "# TYPE mongostat_info gauge")
+	for _, host := range hosts {
+		l := plf.lines[host]
+		if l.Error != nil {
+			continue
+		}
+		fmt.Fprintf(out, "mongostat_info{host=\"%v\",storage_engine=\"%v\",set=\"%v\",repl=\"%v\"} 1\n",
+			prometheus.EscapeLabelValue(host), prometheus.EscapeLabelValue(l.Fields["storage_engine"]),
+			prometheus.EscapeLabelValue(l.Fields["set"]), prometheus.EscapeLabelValue(l.Fields["repl"]))
+	}
+
+	fmt.Fprintln(out, "# HELP mongostat_last_sample_timestamp_seconds When the host was last sampled successfully.")
+	fmt.Fprintln(out, "# TYPE mongostat_last_sample_timestamp_seconds gauge")
+	for _, host := range hosts {
+		if sampled, ok := plf.sampled[host]; ok {
+			fmt.Fprintf(out, "mongostat_last_sample_timestamp_seconds{host=\"%v\"} %v\n",
+				prometheus.EscapeLabelValue(host), float64(sampled.UnixNano())/1e9)
+		}
+	}
+}
+
+// Serve listens on addr and serves the metrics at /metrics in the
+// background. Errors listening are returned, so that a wrong --prometheus
+// address fails before polling starts.
+func (plf *PrometheusLineFormatter) Serve(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("error listening on --prometheus address %v: %v", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", plf)
+	log.Logvf(log.Info, "serving Prometheus metrics at http://%v/metrics", listener.Addr())
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			log.Logvf(log.Always, "error serving Prometheus metrics: %v", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,186 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package stat_consumer
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/mongostat/stat_consumer/line"
+)
+
+// SparklineKey is the key of the column holding the sparkline.
+const SparklineKey = "sparkline"
+
+// defaultSparklineSamples is the number of samples a sparkline covers unless
+// another number is given.
+const defaultSparklineSamples = 20
+
+// sparkBlocks are the characters a sparkline is drawn with, from the lowest
+// value in its window to the highest.
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// Sparkline draws the recent values of a field for each host, such as
+// "ping:30", as a line of block characters scaled between the lowest and
+// highest value shown. Fields with several "|"-separated values, such as
+// qrw, get one sparkline for each value.
+type Sparkline struct {
+	Field   string
+	Samples int
+
+	// history holds the numeric values of the field in each of a host's
+	// most recent samples, oldest first
+	history map[string][][]float64
+}
+
+// ParseSparkline parses a sparkline of the form <field>[:<samples>].
+func ParseSparkline(spec string) (*Sparkline, error) {
+	field, samples := spec, defaultSparklineSamples
+	if i := strings.LastIndex(spec, ":"); i >= 0 {
+		field = spec[:i]
+		n, err := strconv.Atoi(spec[i+1:])
+		if err != nil || n < 2 {
+			return nil, fmt.Errorf("invalid sparkline '%v': the number of samples must be an integer of at least 2", spec)
+		}
+		samples = n
+	}
+	field = strings.TrimSpace(field)
+	if field == "" {
+		return nil, fmt.Errorf("invalid sparkline '%v': must be of the form <field>[:<samples>]", spec)
+	}
+	return &Sparkline{
+		Field:   field,
+		Samples: samples,
+		history: make(map[string][][]float64),
+	}, nil
+}
+
+// HeaderName returns the name of the sparkline's column.
+func (s *Sparkline) HeaderName() string {
+	return s.Field + " trend"
+}
+
+// update records the value of the field in l, and sets the sparkline of the
+// host's recent values as the SparklineKey field of l.
+func (s *Sparkline) update(l *line.StatLine) {
+	host := l.Fields["host"]
+	recent := append(s.history[host], l.NumericValues(s.Field))
+	if len(recent) > s.Samples {
+		recent = recent[len(recent)-s.Samples:]
+	}
+	s.history[host] = recent
+
+	parts := 0
+	for _, values := range recent {
+		if len(values) > parts {
+			parts = len(values)
+		}
+	}
+	lines := make([]string, parts)
+	raw := make([][]float64, parts)
+	for part := range lines {
+		window := make([]float64, 0, len(recent))
+		present := make([]bool, 0, len(recent))
+		for _, values := range recent {
+			if part < len(values) {
+				window = append(window, values[part])
+				raw[part] = append(raw[part], values[part])
+			} else {
+				window = append(window, 0)
+			}
+			present = append(present, part < len(values))
+		}
+		lines[part] = drawSparkline(window, present)
+	}
+	l.Fields[SparklineKey] = strings.Join(lines, "|")
+	if l.Raw != nil {
+		if parts == 1 {
+			l.Raw[SparklineKey] = raw[0]
+		} else {
+			l.Raw[SparklineKey] = raw
+		}
+	}
+}
+
+// drawSparkline draws values scaled between the lowest and highest of them,
+// leaving a space for each value that is not present. A window of equal
+// values is drawn at the lowest level.
+func drawSparkline(values []float64, present []bool) string {
+	var low, high float64
+	first := true
+	for i, v := range values {
+		if !present[i] {
+			continue
+		}
+		if first || v < low {
+			low = v
+		}
+		if first || v > high {
+			high = v
+		}
+		first = false
+	}
+
+	var sb strings.Builder
+	for i, v := range values {
+		if !present[i] {
+			sb.WriteRune(' ')
+			continue
+		}
+		level := 0
+		if high > low {
+			level = int(math.Round((v - low) / (high - low) * float64(len(sparkBlocks)-1)))
+		}
+		sb.WriteRune(sparkBlocks[level])
+	}
+	return sb.String()
+}
+
+// ShowSparkline adds a column holding a sparkline of the recent values of a
+// field to the output. The field need not be displayed itself.
+func (sc *StatConsumer) ShowSparkline(s *Sparkline) {
+	sc.sparkline = s
+	sc.customHeaders = append(sc.customHeaders, SparklineKey)
+	if sc.flags == 0 {
+		sc.headers = sc.customHeaders
+	}
+	if sc.keyNames != nil {
+		sc.keyNames[SparklineKey] = s.HeaderName()
+	}
+}
+
+// fieldKeys returns the displayed columns other than the sparkline, which
+// are those read from each sample.
+func (sc *StatConsumer) fieldKeys() []string {
+	if sc.sparkline == nil {
+		return sc.headers
+	}
+	keys := make([]string, 0, len(sc.headers))
+	for _, key := range sc.headers {
+		if key != SparklineKey {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// readKeys returns the fields to read from each sample: the displayed
+// columns, and the field drawn by the sparkline.
+func (sc *StatConsumer) readKeys() []string {
+	keys := sc.fieldKeys()
+	if sc.sparkline == nil {
+		return keys
+	}
+	for _, key := range keys {
+		if key == sc.sparkline.Field {
+			return keys
+		}
+	}
+	return append(keys, sc.sparkline.Field)
+}
@@ -0,0 +1,144 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package stat_consumer
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mongodb/mongo-tools/mongostat/stat_consumer/line"
+	"github.com/mongodb/mongo-tools/mongostat/status"
+)
+
+// sampleSchema creates the table that SampleStore appends to, holding one row
+// for each field of each sample, and an index for querying a host's samples
+// over time.
+const sampleSchema = `
+CREATE TABLE IF NOT EXISTS samples (
+	host      TEXT NOT NULL,
+	timestamp TEXT NOT NULL,
+	field     TEXT NOT NULL,
+	value
+);
+CREATE INDEX IF NOT EXISTS samples_host_timestamp ON samples (host, timestamp);
+`
+
+// sampleTimeFormat is the format of the timestamp column, which SQLite's date
+// and time functions understand and which sorts in time order.
+const sampleTimeFormat = "2006-01-02T15:04:05.000Z"
+
+// errSQLiteUnsupported is returned for --sqlite by builds without cgo.
+var errSQLiteUnsupported = errors.New("--sqlite is not supported by this build of mongostat, which was built without cgo")
+
+// SampleStore appends the machine readable value of every field of each
+// sample to the samples table of a SQLite database, for later querying.
+type SampleStore struct {
+	db *sql.DB
+}
+
+// OpenSampleStore opens the SQLite database at path, creating it and its
+// samples table if needed.
+func OpenSampleStore(path string) (*SampleStore, error) {
+	if !sqliteSupported {
+		return nil, errSQLiteUnsupported
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	// writes are serialized by SQLite anyway
+	db.SetMaxOpenConns(1)
+	if _, err = db.Exec(sampleSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating samples table in %v: %v", path, err)
+	}
+	return &SampleStore{db: db}, nil
+}
+
+// Close closes the database.
+func (s *SampleStore) Close() error {
+	return s.db.Close()
+}
+
+// sampleValue returns the value stored for a field's raw value: numbers as
+// they are, several "|"-separated values as a JSON array, and other values as
+// text.
+func sampleValue(raw interface{}) (interface{}, error) {
+	switch v := raw.(type) {
+	case int64, float64, string:
+		return v, nil
+	}
+	encoded, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	return string(encoded), nil
+}
+
+// Append stores the raw values of a host's fields, sampled at t, in a single
+// transaction. Fields without a value are not stored.
+func (s *SampleStore) Append(host string, t time.Time, raw map[string]interface{}) error {
+	fields := make([]string, 0, len(raw))
+	for field, value := range raw {
+		if value != nil && field != "host" && field != "time" && field != SparklineKey {
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	sort.Strings(fields)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	insert, err := tx.Prepare("INSERT INTO samples (host, timestamp, field, value) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer insert.Close()
+	timestamp := t.UTC().Format(sampleTimeFormat)
+	for _, field := range fields {
+		value, err := sampleValue(raw[field])
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err = insert.Exec(host, timestamp, field, value); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// StoreSamples appends the raw values of the fields read from each sample to
+// store.
+func (sc *StatConsumer) StoreSamples(store *SampleStore) {
+	sc.sampleStore = store
+}
+
+// storeSample appends the raw values of l, read from newStat, to the sample
+// store.
+func (sc *StatConsumer) storeSample(l *line.StatLine, oldStat, newStat *status.ServerStatus) error {
+	return sc.sampleStore.Append(newStat.Host, newStat.SampleTime, sc.rawValues(l, oldStat, newStat))
+}
+
+// rawValues returns the raw values of the fields of l, read from oldStat and
+// newStat, reading them again if the line was read without them.
+func (sc *StatConsumer) rawValues(l *line.StatLine, oldStat, newStat *status.ServerStatus) map[string]interface{} {
+	if l.Raw != nil {
+		return l.Raw
+	}
+	return line.NewStatLine(oldStat, newStat, sc.fieldKeys(), &status.ReaderConfig{IncludeRaw: true}).Raw
+}
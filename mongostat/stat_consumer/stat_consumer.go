@@ -10,7 +10,10 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"time"
 
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/text"
 	"github.com/mongodb/mongo-tools/common/util"
 	"github.com/mongodb/mongo-tools/mongostat/stat_consumer/line"
 	"github.com/mongodb/mongo-tools/mongostat/status"
@@ -27,6 +30,48 @@ type StatConsumer struct {
 	keyNames               map[string]string
 	writer                 io.Writer
 	flags                  int
+
+	// when onlyChanged is set, lines are only formatted for hosts whose
+	// metrics moved by more than changeThreshold since they were last printed
+	onlyChanged     bool
+	changeThreshold float64
+	lastPrinted     map[string]*line.StatLine
+
+	// when anomalyLog is set, samples which trip any of anomalyThresholds are
+	// written to it along with the samples preceding them
+	anomalyLog        io.Writer
+	anomalyThresholds []*AnomalyThreshold
+	recentStats       map[string][]*status.ServerStatus
+
+	// when sparkline is set, a column draws the recent values of its field
+	sparkline *Sparkline
+
+	// when sampleStore is set, the raw values of each sample are appended
+	// to it
+	sampleStore *SampleStore
+
+	// when graphite is set, the raw values of each sample are pushed to it
+	graphite *GraphiteSink
+
+	// when statsd is set, the raw values of each sample are emitted to it
+	statsd *StatsDSink
+
+	// when otlp is set, the raw values of each sample are exported to it
+	otlp *OTLPExporter
+
+	// when readerConfig.ScaleUnits is set, each unit column is shown in the
+	// unit of its scale, and its header names the unit
+	unitScales   map[string]*text.UnitScale
+	unitKeyNames map[string]string
+
+	// no lines are formatted after the deadline, if one is set, and expired
+	// receives once it has passed
+	deadline time.Time
+	expired  <-chan time.Time
+
+	// when onlyKind is set to line.KindRate or line.KindGauge, only columns
+	// of that kind are displayed, along with labels such as the host
+	onlyKind int
 }
 
 // NewStatConsumer creates a new StatConsumer with no previous records
@@ -43,6 +88,10 @@ func NewStatConsumer(flags int, customHeaders []string, keyNames map[string]stri
 	if flags == 0 {
 		sc.headers = customHeaders
 	}
+	if readerConfig.ScaleUnits {
+		sc.unitScales = make(map[string]*text.UnitScale)
+		sc.unitKeyNames = make(map[string]string)
+	}
 	return sc
 }
 
@@ -50,8 +99,46 @@ func NewStatConsumer(flags int, customHeaders []string, keyNames map[string]stri
 func (sc *StatConsumer) Update(newStat *status.ServerStatus) (l *line.StatLine, seen bool) {
 	oldStat, seen := sc.oldStats[newStat.Host]
 	sc.oldStats[newStat.Host] = newStat
+	var recent []*status.ServerStatus
+	if sc.anomalyLog != nil {
+		recent = sc.rememberSample(newStat)
+	}
+	if seen && status.Restarted(newStat, oldStat) {
+		// the counters started over, so rates are computed from this sample
+		// on rather than being negative
+		log.Logvf(log.Info, "%v restarted", newStat.Host)
+		return line.NewRestartLine(newStat.Host), true
+	}
 	if seen {
-		l = line.NewStatLine(oldStat, newStat, sc.headers, sc.readerConfig)
+		l = line.NewStatLine(oldStat, newStat, sc.readKeys(), sc.readerConfig)
+		if sc.sparkline != nil {
+			sc.sparkline.update(l)
+		}
+		if sc.anomalyLog != nil {
+			if err := sc.logAnomaly(l, recent); err != nil {
+				log.Logvf(log.Always, "error writing to anomaly log: %v", err)
+			}
+		}
+		if sc.sampleStore != nil {
+			if err := sc.storeSample(l, oldStat, newStat); err != nil {
+				log.Logvf(log.Always, "error writing to --sqlite database: %v", err)
+			}
+		}
+		if sc.graphite != nil {
+			if err := sc.pushSample(l, oldStat, newStat); err != nil {
+				log.Logvf(log.Always, "error pushing to --graphite: %v", err)
+			}
+		}
+		if sc.statsd != nil {
+			if err := sc.emitSample(l, oldStat, newStat); err != nil {
+				log.Logvf(log.Always, "error emitting to --statsd: %v", err)
+			}
+		}
+		if sc.otlp != nil {
+			if err := sc.exportSample(l, oldStat, newStat); err != nil {
+				log.Logvf(log.Always, "error exporting to --otlpEndpoint: %v", err)
+			}
+		}
 		return
 	}
 
@@ -68,21 +155,115 @@ func (sc *StatConsumer) Update(newStat *status.ServerStatus) (l *line.StatLine,
 			sc.flags |= line.FlagLocks
 		}
 
-		// Modify headers
+		// Modify headers; default columns that are also custom columns are
+		// shown where the custom columns place them
+		custom := make(map[string]bool, len(sc.customHeaders))
+		for _, key := range sc.customHeaders {
+			custom[key] = true
+		}
 		sc.headers = []string{}
 		for _, desc := range line.CondHeaders {
-			if desc.Flag&sc.flags == desc.Flag {
+			if desc.Flag&sc.flags == desc.Flag && !custom[desc.Key] && sc.showsKind(desc.Key) {
 				sc.headers = append(sc.headers, desc.Key)
 			}
 		}
 		sc.headers = append(sc.headers, sc.customHeaders...)
 	}
+	if summary := status.PrivilegeSummary(newStat.Host, newStat, sc.readKeys()); summary != "" {
+		log.Logv(log.Always, summary)
+	}
 	return
 }
 
+// ReportOnlyChanged restricts the output of FormatLines to hosts whose
+// displayed metrics changed by more than threshold, a fraction of the value
+// last printed for that host.
+func (sc *StatConsumer) ReportOnlyChanged(threshold float64) {
+	sc.onlyChanged = true
+	sc.changeThreshold = threshold
+	sc.lastPrinted = make(map[string]*line.StatLine)
+}
+
+// LogAnomalies writes samples whose StatLines trip any of the thresholds to
+// w, along with the raw serverStatus of the samples preceding them.
+func (sc *StatConsumer) LogAnomalies(w io.Writer, thresholds []*AnomalyThreshold) {
+	sc.anomalyLog = w
+	sc.anomalyThresholds = thresholds
+	sc.recentStats = make(map[string][]*status.ServerStatus)
+}
+
+// changedLines returns the subset of lines that should be printed when only
+// changed hosts are being reported, and remembers them for the next round.
+func (sc *StatConsumer) changedLines(lines []*line.StatLine) []*line.StatLine {
+	changed := make([]*line.StatLine, 0, len(lines))
+	for _, l := range lines {
+		host := l.Fields["host"]
+		// lines that were already printed are stale, and must reach the
+		// formatter so that it can report that no data was received
+		if !l.Printed && !l.ChangedFrom(sc.lastPrinted[host], sc.fieldKeys(), sc.changeThreshold) {
+			continue
+		}
+		sc.lastPrinted[host] = l
+		changed = append(changed, l)
+	}
+	return changed
+}
+
+// ShowOnlyKind restricts the displayed columns to those of the given kind,
+// line.KindRate or line.KindGauge, and labels such as the host and time.
+func (sc *StatConsumer) ShowOnlyKind(kind int) {
+	sc.onlyKind = kind
+	var customHeaders []string
+	for _, key := range sc.customHeaders {
+		if sc.showsKind(key) {
+			customHeaders = append(customHeaders, key)
+		}
+	}
+	sc.customHeaders = customHeaders
+	if sc.flags == 0 {
+		sc.headers = customHeaders
+	}
+}
+
+// showsKind returns whether the column with the given key is displayed
+// under ShowOnlyKind.
+func (sc *StatConsumer) showsKind(key string) bool {
+	if sc.onlyKind == line.KindLabel || key == SparklineKey {
+		return true
+	}
+	kind := line.HeaderKind(key)
+	return kind == line.KindLabel || kind == sc.onlyKind
+}
+
+// StopAfter makes FormatLines report that no more data should be received
+// once the given duration has elapsed, and Expired receive then.
+func (sc *StatConsumer) StopAfter(d time.Duration) {
+	sc.deadline = time.Now().Add(d)
+	sc.expired = time.After(d)
+}
+
+// Expired returns a channel that receives once the duration given to
+// StopAfter has elapsed, so that polling stops even while no lines are
+// formatted. It returns nil, which never receives, if there is no deadline.
+func (sc *StatConsumer) Expired() <-chan time.Time {
+	return sc.expired
+}
+
 // FormatLines consumes StatLines, formats them, and sends them to its writer
 // It returns true if the formatter should no longer receive data
 func (sc *StatConsumer) FormatLines(lines []*line.StatLine) bool {
+	if !sc.deadline.IsZero() && !time.Now().Before(sc.deadline) {
+		return true
+	}
+	if sc.unitScales != nil {
+		sc.scaleUnits(lines)
+	}
+	if sc.onlyChanged {
+		lines = sc.changedLines(lines)
+		if len(lines) == 0 {
+			return sc.formatter.IsFinished()
+		}
+	}
 	str := sc.formatter.FormatLines(lines, sc.headers, sc.keyNames)
 	_, err := fmt.Fprintf(sc.writer, "%s", str)
 	if err != nil {
@@ -0,0 +1,141 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package stat_consumer
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongo-tools/mongostat/stat_consumer/line"
+	"github.com/mongodb/mongo-tools/mongostat/status"
+)
+
+// statsdMaxPacketSize bounds the size of each UDP packet sent to StatsD, so
+// that packets are not fragmented on common networks.
+const statsdMaxPacketSize = 1432
+
+// How StatsDSink identifies the host of each metric: with a "host" tag in
+// the DogStatsD format understood by Datadog and Telegraf agents, in the
+// metric name, or not at all.
+const (
+	StatsDHostTag  = "tag"
+	StatsDHostName = "name"
+	StatsDHostNone = "none"
+)
+
+// StatsDSink emits the machine readable value of each displayed field of
+// every sample to a StatsD agent over UDP: rates as counters of the events
+// since the previous sample, and other fields as gauges.
+type StatsDSink struct {
+	conn    net.Conn
+	prefix  string
+	hostTag string
+}
+
+// DialStatsD returns a sink emitting metrics to the StatsD agent at addr,
+// e.g. localhost:8125, named <prefix>.<field> and identifying their host as
+// given by hostTag.
+func DialStatsD(addr, prefix, hostTag string) (*StatsDSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to StatsD at %v: %v", addr, err)
+	}
+	return &StatsDSink{conn: conn, prefix: metricNode(prefix, true), hostTag: hostTag}, nil
+}
+
+// Close closes the connection to StatsD.
+func (s *StatsDSink) Close() error {
+	return s.conn.Close()
+}
+
+// FormatMetrics returns a line of the StatsD protocol for each numeric raw
+// value of a host's fields, sampled elapsed after the previous sample.
+// Labels such as the host are not metrics, and fields without a numeric value
+// are left out.
+func (s *StatsDSink) FormatMetrics(host string, elapsed time.Duration, keys []string, keyNames map[string]string, raw map[string]interface{}) []string {
+	prefix := s.prefix
+	suffix := ""
+	switch s.hostTag {
+	case StatsDHostTag:
+		suffix = "|#host:" + strings.NewReplacer(",", "_", "|", "_", "#", "_").Replace(host)
+	case StatsDHostName:
+		if prefix != "" {
+			prefix += "."
+		}
+		prefix += metricNode(host, false)
+	}
+	if prefix != "" {
+		prefix += "."
+	}
+
+	var lines []string
+	for _, key := range keys {
+		kind := line.HeaderKind(key)
+		if kind == line.KindLabel || key == SparklineKey {
+			continue
+		}
+		values, ok := raw[key].([]interface{})
+		if !ok {
+			values = []interface{}{raw[key]}
+		}
+		header := keyNames[key]
+		if header == "" {
+			header = key
+		}
+		for i, name := range dottedMetricNames(key, header, len(values)) {
+			switch values[i].(type) {
+			case int64, float64:
+			default:
+				continue
+			}
+			if kind == line.KindRate {
+				lines = append(lines, fmt.Sprintf("%v%v:%v|c%v", prefix, name, intervalCount(key, values[i], elapsed), suffix))
+			} else {
+				lines = append(lines, fmt.Sprintf("%v%v:%v|g%v", prefix, name, values[i], suffix))
+			}
+		}
+	}
+	return lines
+}
+
+// Send emits the metric lines to StatsD, in as few packets as fit them.
+func (s *StatsDSink) Send(lines []string) error {
+	var packet []byte
+	for _, l := range lines {
+		if len(packet) > 0 && len(packet)+1+len(l) > statsdMaxPacketSize {
+			if _, err := s.conn.Write(packet); err != nil {
+				return err
+			}
+			packet = packet[:0]
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, l...)
+	}
+	if len(packet) > 0 {
+		_, err := s.conn.Write(packet)
+		return err
+	}
+	return nil
+}
+
+// EmitToStatsD emits the raw values of the displayed fields of each sample
+// to sink.
+func (sc *StatConsumer) EmitToStatsD(sink *StatsDSink) {
+	sc.statsd = sink
+}
+
+// emitSample emits the raw values of l, read from oldStat and newStat, to
+// StatsD.
+func (sc *StatConsumer) emitSample(l *line.StatLine, oldStat, newStat *status.ServerStatus) error {
+	raw := sc.rawValues(l, oldStat, newStat)
+	elapsed := newStat.SampleTime.Sub(oldStat.SampleTime)
+	return sc.statsd.Send(sc.statsd.FormatMetrics(newStat.Host, elapsed, sc.fieldKeys(), sc.keyNames, raw))
+}
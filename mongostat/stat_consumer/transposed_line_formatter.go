@@ -0,0 +1,121 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package stat_consumer
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/text"
+	"github.com/mongodb/mongo-tools/mongostat/stat_consumer/line"
+)
+
+// TransposedLineFormatter uses a text.GridWriter to format the StatLines as a
+// grid with one column per host and one row per field, which is easier to
+// read than wide rows when monitoring a few hosts with many fields
+type TransposedLineFormatter struct {
+	*limitableFormatter
+	*text.GridWriter
+
+	// If true, enables printing of the hosts above their columns
+	includeHeader bool
+
+	// If true, each grid is drawn over the previous one using terminal
+	// escape sequences rather than printed below it
+	inPlace bool
+
+	// Number of lines of the previous grid, which an in-place grid erases
+	prevLineCount int
+}
+
+func NewTransposedLineFormatter(maxRows int64, includeHeader bool) LineFormatter {
+	return &TransposedLineFormatter{
+		limitableFormatter: &limitableFormatter{maxRows: maxRows},
+		includeHeader:      includeHeader,
+		GridWriter:         &text.GridWriter{ColumnPadding: 2},
+	}
+}
+
+func init() {
+	FormatterConstructors["transposed"] = NewTransposedLineFormatter
+}
+
+// SetInPlace sets whether each grid is drawn over the previous one, which
+// requires the output to be a terminal.
+func (tlf *TransposedLineFormatter) SetInPlace(inPlace bool) {
+	tlf.inPlace = inPlace
+}
+
+func (tlf *TransposedLineFormatter) Finish() {
+}
+
+// FormatLines formats the StatLines as a grid with a column for each host
+func (tlf *TransposedLineFormatter) FormatLines(lines []*line.StatLine, headerKeys []string, keyNames map[string]string) string {
+	buf := &bytes.Buffer{}
+
+	// Sort the stat lines by hostname, so that the hosts keep their columns
+	sort.Sort(line.StatLines(lines))
+
+	var errors []string
+	for _, l := range lines {
+		if l.Printed && l.Error == nil {
+			l.Error = fmt.Errorf("no data received")
+		}
+		l.Printed = true
+		if l.Error != nil {
+			errors = append(errors, fmt.Sprintf("%v: %v", l.Fields["host"], l.Error))
+		}
+	}
+
+	// the hosts head their columns, so they are not a row of their own
+	if tlf.includeHeader {
+		tlf.WriteCell("")
+		for _, l := range lines {
+			tlf.WriteCell(l.Fields["host"])
+		}
+		tlf.EndRow()
+	}
+	for _, key := range headerKeys {
+		if key == "host" {
+			continue
+		}
+		tlf.WriteCell(keyNames[key])
+		for _, l := range lines {
+			if l.Error != nil {
+				tlf.WriteCell("-")
+			} else {
+				tlf.WriteCell(l.Fields[key])
+			}
+		}
+		tlf.EndRow()
+	}
+	for _, err := range errors {
+		tlf.Feed(err)
+	}
+	tlf.Flush(buf)
+
+	// clear the flushed data
+	tlf.Reset()
+
+	grid := buf.String()
+	lineCount := strings.Count(grid, "\n")
+	if tlf.inPlace {
+		if tlf.prevLineCount > 0 {
+			// move the cursor up to the start of the previous grid and erase
+			// it, in case the new grid is shorter
+			grid = fmt.Sprintf("\x1b[%dA\x1b[J%s", tlf.prevLineCount, grid)
+		}
+	} else if tlf.prevLineCount > 0 {
+		// add an extra newline to tell each grid apart
+		grid = "\n" + grid
+	}
+	tlf.prevLineCount = lineCount
+	tlf.increment()
+	return grid
+}
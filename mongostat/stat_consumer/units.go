@@ -0,0 +1,45 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package stat_consumer
+
+import (
+	"fmt"
+
+	"github.com/mongodb/mongo-tools/mongostat/stat_consumer/line"
+)
+
+// scaleUnits shows the amounts in each unit column of lines in a single unit,
+// the one needed by the largest amount seen in the column this session, and
+// names the unit in the column's header.
+func (sc *StatConsumer) scaleUnits(lines []*line.StatLine) {
+	for _, l := range lines {
+		for key, amount := range l.Amounts {
+			scale, ok := sc.unitScales[key]
+			if !ok {
+				scale = line.UnitColumns[key]()
+				sc.unitScales[key] = scale
+			}
+			scale.Fit(amount)
+		}
+	}
+	for _, l := range lines {
+		for key, amount := range l.Amounts {
+			l.Fields[key] = sc.unitScales[key].Format(amount)
+		}
+	}
+	if sc.keyNames == nil {
+		return
+	}
+	for key, scale := range sc.unitScales {
+		name, ok := sc.unitKeyNames[key]
+		if !ok {
+			name = sc.keyNames[key]
+			sc.unitKeyNames[key] = name
+		}
+		sc.keyNames[key] = fmt.Sprintf("%v(%v)", name, scale.Unit())
+	}
+}
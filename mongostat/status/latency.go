@@ -0,0 +1,79 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package status
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// latencyWindowSize is the number of recent samples of a host that the
+// rolling p95 round-trip time is computed over.
+const latencyWindowSize = 60
+
+// Latency holds the round-trip time of the command that collected a sample,
+// and the 95th percentile round-trip time over the host's recent samples.
+type Latency struct {
+	RTT time.Duration
+	P95 time.Duration
+}
+
+// LatencyWindow keeps the round-trip times of a host's most recent samples.
+type LatencyWindow struct {
+	samples []time.Duration
+	next    int
+}
+
+// NewLatencyWindow returns an empty LatencyWindow.
+func NewLatencyWindow() *LatencyWindow {
+	return &LatencyWindow{samples: make([]time.Duration, 0, latencyWindowSize)}
+}
+
+// Add records the round-trip time of a sample, replacing the oldest one once
+// the window is full, and returns the latency to report for the sample.
+func (w *LatencyWindow) Add(rtt time.Duration) *Latency {
+	if len(w.samples) < latencyWindowSize {
+		w.samples = append(w.samples, rtt)
+	} else {
+		w.samples[w.next] = rtt
+		w.next = (w.next + 1) % latencyWindowSize
+	}
+
+	sorted := make([]time.Duration, len(w.samples))
+	copy(sorted, w.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	// nearest-rank percentile
+	rank := (95*len(sorted) + 99) / 100
+	return &Latency{RTT: rtt, P95: sorted[rank-1]}
+}
+
+// formatLatency formats a round-trip time in milliseconds. Human-readable
+// output uses fewer digits and switches to seconds for slow responses.
+func formatLatency(human bool, d time.Duration) string {
+	ms := float64(d) / float64(time.Millisecond)
+	if !human {
+		return fmt.Sprintf("%.3f", ms)
+	}
+	switch {
+	case ms < 10:
+		return fmt.Sprintf("%.1fms", ms)
+	case ms < 10000:
+		return fmt.Sprintf("%.0fms", ms)
+	}
+	return fmt.Sprintf("%.1fs", ms/1000)
+}
+
+// ReadPing reports the round-trip time of the command that collected the
+// sample and the rolling p95 for the host, as '(latest)|(p95)'.
+func ReadPing(c *ReaderConfig, newStat, _ *ServerStatus) string {
+	if newStat.Ping == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v|%v", formatLatency(c.HumanReadable, newStat.Ping.RTT),
+		formatLatency(c.HumanReadable, newStat.Ping.P95))
+}
@@ -0,0 +1,59 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package status
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLatencyWindow(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a latency window", t, func() {
+		window := NewLatencyWindow()
+
+		Convey("the p95 of a single sample is that sample", func() {
+			So(*window.Add(3 * time.Millisecond), ShouldResemble, Latency{RTT: 3 * time.Millisecond, P95: 3 * time.Millisecond})
+		})
+
+		Convey("the p95 ignores the slowest 5% of samples", func() {
+			var latency *Latency
+			for i := 1; i <= 40; i++ {
+				latency = window.Add(time.Duration(i) * time.Millisecond)
+			}
+			So(latency.RTT, ShouldEqual, 40*time.Millisecond)
+			So(latency.P95, ShouldEqual, 38*time.Millisecond)
+		})
+
+		Convey("old samples are dropped once the window is full", func() {
+			window.Add(time.Second)
+			var latency *Latency
+			for i := 0; i < latencyWindowSize; i++ {
+				latency = window.Add(time.Millisecond)
+			}
+			So(latency.P95, ShouldEqual, time.Millisecond)
+		})
+	})
+}
+
+func TestReadPing(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("The ping column shows the latest and p95 round-trip times", t, func() {
+		stat := &ServerStatus{Ping: &Latency{RTT: 860 * time.Microsecond, P95: 42 * time.Millisecond}}
+		So(ReadPing(&ReaderConfig{HumanReadable: true}, stat, nil), ShouldEqual, "0.9ms|42ms")
+		So(ReadPing(&ReaderConfig{}, stat, nil), ShouldEqual, "0.860|42.000")
+
+		stat.Ping.P95 = 12 * time.Second
+		So(ReadPing(&ReaderConfig{HumanReadable: true}, stat, nil), ShouldEqual, "0.9ms|12.0s")
+		So(ReadPing(&ReaderConfig{}, &ServerStatus{}, nil), ShouldEqual, "")
+	})
+}
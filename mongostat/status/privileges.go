@@ -0,0 +1,93 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package status
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PrivilegeMissing is shown in place of a column whose serverStatus sections
+// are missing from a sample.
+const PrivilegeMissing = "priv?"
+
+// RequiredPrivilege describes the privilege that grants access to the
+// serverStatus sections that columns are read from.
+const RequiredPrivilege = "the serverStatus action on the cluster resource, e.g. with the clusterMonitor role"
+
+// sectionPresent reports whether each serverStatus section that every
+// mongod and mongos reports was decoded from a sample.
+var sectionPresent = map[string]func(*ServerStatus) bool{
+	"opcounters":  func(stat *ServerStatus) bool { return stat.Opcounters != nil },
+	"mem":         func(stat *ServerStatus) bool { return stat.Mem != nil },
+	"extra_info":  func(stat *ServerStatus) bool { return stat.ExtraInfo != nil },
+	"network":     func(stat *ServerStatus) bool { return stat.Network != nil },
+	"connections": func(stat *ServerStatus) bool { return stat.Connections != nil },
+}
+
+// columnSections maps columns to the sections of sectionPresent they are read
+// from. If one of them is missing from a sample, the user is most likely not
+// authorized to see it.
+var columnSections = map[string][]string{
+	"insert":    {"opcounters"},
+	"query":     {"opcounters"},
+	"update":    {"opcounters"},
+	"delete":    {"opcounters"},
+	"getmore":   {"opcounters"},
+	"command":   {"opcounters"},
+	"vsize":     {"mem"},
+	"res":       {"mem"},
+	"mapped":    {"mem"},
+	"nonmapped": {"mem"},
+	"faults":    {"extra_info"},
+	"net_in":    {"network"},
+	"net_out":   {"network"},
+	"conn":      {"connections"},
+}
+
+// MissingSections returns the serverStatus sections that column is read from
+// and that are missing from stat, or nil if none are.
+func MissingSections(stat *ServerStatus, column string) []string {
+	var missing []string
+	for _, section := range columnSections[column] {
+		if !sectionPresent[section](stat) {
+			missing = append(missing, section)
+		}
+	}
+	return missing
+}
+
+// PrivilegeSummary describes the columns that cannot be shown for host
+// because their serverStatus sections are missing from stat, and which
+// privileges would enable them. It returns "" if every column can be shown.
+func PrivilegeSummary(host string, stat *ServerStatus, columns []string) string {
+	// group the disabled columns by the sections they are missing
+	bySections := map[string][]string{}
+	for _, column := range columns {
+		if missing := MissingSections(stat, column); missing != nil {
+			key := strings.Join(missing, ", ")
+			bySections[key] = append(bySections[key], column)
+		}
+	}
+	if len(bySections) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(bySections))
+	for key := range bySections {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	lines := []string{fmt.Sprintf("%v: some columns are shown as '%v' because serverStatus sections are missing, "+
+		"which usually means the user is not authorized to see them:", host, PrivilegeMissing)}
+	for _, key := range keys {
+		lines = append(lines, fmt.Sprintf("\t%v (missing %v)", strings.Join(bySections[key], ", "), key))
+	}
+	lines = append(lines, fmt.Sprintf("to enable them, grant %v", RequiredPrivilege))
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,43 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package status
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPrivilegeSummary(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a sample missing some serverStatus sections", t, func() {
+		stat := &ServerStatus{Opcounters: &OpcountStats{}, Mem: &MemStats{}}
+		columns := []string{"insert", "res", "net_in", "net_out", "conn", "time"}
+
+		Convey("columns read from the missing sections are reported", func() {
+			So(MissingSections(stat, "insert"), ShouldBeNil)
+			So(MissingSections(stat, "time"), ShouldBeNil)
+			So(MissingSections(stat, "net_in"), ShouldResemble, []string{"network"})
+		})
+
+		Convey("the summary groups columns by the sections they are missing", func() {
+			summary := PrivilegeSummary("localhost:27017", stat, columns)
+			So(summary, ShouldContainSubstring, "localhost:27017")
+			So(summary, ShouldContainSubstring, "\tconn (missing connections)")
+			So(summary, ShouldContainSubstring, "\tnet_in, net_out (missing network)")
+			So(summary, ShouldContainSubstring, "clusterMonitor")
+			So(summary, ShouldNotContainSubstring, "insert")
+		})
+	})
+
+	Convey("A sample with every section has no summary", t, func() {
+		stat := &ServerStatus{Connections: &ConnectionStats{}, Network: &NetworkStats{}}
+		So(PrivilegeSummary("localhost", stat, []string{"conn", "net_in", "time"}), ShouldEqual, "")
+	})
+}
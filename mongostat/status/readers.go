@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"regexp"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/mongodb/mongo-tools/common/text"
@@ -19,6 +20,13 @@ import (
 type ReaderConfig struct {
 	HumanReadable bool
 	TimeFormat    string
+	// Location is the time zone sample times are reported in, local if nil
+	Location *time.Location
+	// IncludeRaw also reads every field in machine readable form
+	IncludeRaw bool
+	// ScaleUnits shows the human readable amounts of each column in a single
+	// unit, named in the header, rather than in the unit that suits each value
+	ScaleUnits bool
 }
 
 type LockUsage struct {
@@ -48,6 +56,13 @@ func formatBits(should bool, amt int64) string {
 	return fmt.Sprintf("%v", amt)
 }
 
+func formatByteAmount(should bool, amt int64) string {
+	if should {
+		return text.FormatShortByteAmount(amt)
+	}
+	return fmt.Sprintf("%v", amt)
+}
+
 func formatMegabyteAmount(should bool, amt int64) string {
 	if should {
 		return text.FormatMegabyteAmount(amt)
@@ -168,6 +183,25 @@ func IsReplSet(stat *ServerStatus) (res bool) {
 	return
 }
 
+// Restarted returns whether the server restarted between two samples, so
+// that their counters cannot be diffed: its uptime or any of its
+// opcounters went backwards.
+func Restarted(newStat, oldStat *ServerStatus) bool {
+	if newStat.UptimeMillis > 0 && oldStat.UptimeMillis > 0 {
+		if newStat.UptimeMillis < oldStat.UptimeMillis {
+			return true
+		}
+	} else if newStat.Uptime < oldStat.Uptime {
+		return true
+	}
+	o, n := oldStat.Opcounters, newStat.Opcounters
+	if o == nil || n == nil {
+		return false
+	}
+	return n.Insert < o.Insert || n.Query < o.Query || n.Update < o.Update ||
+		n.Delete < o.Delete || n.GetMore < o.GetMore || n.Command < o.Command
+}
+
 func IsMMAP(stat *ServerStatus) bool {
 	return getStorageEngine(stat) == "mmapv1"
 }
@@ -247,6 +281,59 @@ func ReadUsed(c *ReaderConfig, newStat, _ *ServerStatus) (val string) {
 	return
 }
 
+func ReadHSBytes(c *ReaderConfig, newStat, _ *ServerStatus) (val string) {
+	if newStat.WiredTiger != nil {
+		val = formatByteAmount(c.HumanReadable, newStat.WiredTiger.Cache.HistoryStore().OnDiskBytes)
+	}
+	return
+}
+
+func ReadHSScore(_ *ReaderConfig, newStat, _ *ServerStatus) (val string) {
+	if newStat.WiredTiger != nil {
+		val = fmt.Sprintf("%d", newStat.WiredTiger.Cache.HistoryStore().Score)
+	}
+	return
+}
+
+func diffHistoryStore(newStat, oldStat *ServerStatus, f func(HistoryStoreStats) int64) (val string) {
+	if newStat.WiredTiger != nil && oldStat != nil && oldStat.WiredTiger != nil {
+		sampleSecs := newStat.SampleTime.Sub(oldStat.SampleTime).Seconds()
+		if sampleSecs > 0 {
+			val = fmt.Sprintf("%d", diff(f(newStat.WiredTiger.Cache.HistoryStore()), f(oldStat.WiredTiger.Cache.HistoryStore()), sampleSecs))
+		}
+	}
+	return
+}
+
+func ReadHSRead(_ *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return diffHistoryStore(newStat, oldStat, func(hs HistoryStoreStats) int64 { return hs.Reads })
+}
+
+func ReadHSWrite(_ *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return diffHistoryStore(newStat, oldStat, func(hs HistoryStoreStats) int64 { return hs.Writes })
+}
+
+// ReadCacheBalance reads the rate at which bytes are read into the cache, less
+// the rate at which they are written from it and evicted. A positive balance
+// means the cache is filling faster than it is evicted from, which leads to
+// application threads being drafted into eviction.
+func ReadCacheBalance(c *ReaderConfig, newStat, oldStat *ServerStatus) (val string) {
+	if newStat.WiredTiger != nil && oldStat != nil && oldStat.WiredTiger != nil {
+		sampleSecs := newStat.SampleTime.Sub(oldStat.SampleTime).Seconds()
+		if sampleSecs > 0 {
+			newCache, oldCache := &newStat.WiredTiger.Cache, &oldStat.WiredTiger.Cache
+			balance := diff(newCache.BytesReadInto-newCache.BytesWrittenFrom-newCache.BytesEvicted,
+				oldCache.BytesReadInto-oldCache.BytesWrittenFrom-oldCache.BytesEvicted, sampleSecs)
+			if balance < 0 && c.HumanReadable {
+				val = "-" + formatByteAmount(true, -balance)
+			} else {
+				val = formatByteAmount(c.HumanReadable, balance)
+			}
+		}
+	}
+	return
+}
+
 func ReadFlushes(_ *ReaderConfig, newStat, oldStat *ServerStatus) string {
 	var val int64
 	if newStat.WiredTiger != nil && oldStat.WiredTiger != nil {
@@ -466,14 +553,56 @@ func ReadRepl(_ *ReaderConfig, newStat, _ *ServerStatus) string {
 	}
 }
 
+// ReadEvents reports replica set events between two samples: a change of
+// member state, a new election, or a rollback.
+func ReadEvents(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	if newStat.Repl == nil || oldStat.Repl == nil {
+		return ""
+	}
+	var events []string
+	if newState, oldState := ReadRepl(c, newStat, nil), ReadRepl(c, oldStat, nil); newState != oldState {
+		events = append(events, fmt.Sprintf("STATE:%v->%v", oldState, newState))
+	}
+	if newStat.Repl.ElectionID != nil && oldStat.Repl.ElectionID != nil &&
+		newStat.Repl.ElectionID != oldStat.Repl.ElectionID {
+		events = append(events, "ELECTION")
+	}
+	newRBID, newOK := numberToInt64(newStat.Repl.RBID)
+	oldRBID, oldOK := numberToInt64(oldStat.Repl.RBID)
+	if newOK && oldOK && newRBID != oldRBID {
+		events = append(events, "ROLLBACK")
+	}
+	return strings.Join(events, ",")
+}
+
 func ReadTime(c *ReaderConfig, newStat, _ *ServerStatus) string {
+	sampleTime := newStat.SampleTime
+	if c.Location != nil {
+		sampleTime = sampleTime.In(c.Location)
+	}
 	if c.TimeFormat != "" {
-		return newStat.SampleTime.Format(c.TimeFormat)
+		return sampleTime.Format(c.TimeFormat)
 	}
 	if c.HumanReadable {
-		return newStat.SampleTime.Format(time.StampMilli)
+		return sampleTime.Format(time.StampMilli)
+	}
+	return sampleTime.Format(time.RFC3339)
+}
+
+// ReadSequence reports the sequence number of the sample, which increases
+// across the samples of all hosts, so that outputs can be merged in order.
+func ReadSequence(_ *ReaderConfig, newStat, _ *ServerStatus) string {
+	return fmt.Sprintf("%d", newStat.Sequence)
+}
+
+// ReadInterval reports the actual time between the previous sample of the
+// host and this one, which is longer than the polling interval if samples
+// were skipped.
+func ReadInterval(_ *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	if oldStat == nil || oldStat.SampleTime.IsZero() {
+		return ""
 	}
-	return newStat.SampleTime.Format(time.RFC3339)
+	return fmt.Sprintf("%.3f", newStat.SampleTime.Sub(oldStat.SampleTime).Seconds())
 }
 
 func ReadStatField(field string, stat *ServerStatus) string {
@@ -0,0 +1,131 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package status
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReadTime(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone database not available: %v", err)
+	}
+	stat := &ServerStatus{
+		SampleTime: time.Date(2020, time.January, 2, 15, 4, 5, 0, time.FixedZone("CET", 3600)),
+		Sequence:   42,
+	}
+
+	Convey("Sample times are reported in the configured time zone", t, func() {
+		So(ReadTime(&ReaderConfig{Location: time.UTC}, stat, nil), ShouldEqual, "2020-01-02T14:04:05Z")
+		So(ReadTime(&ReaderConfig{Location: newYork}, stat, nil), ShouldEqual, "2020-01-02T09:04:05-05:00")
+		So(ReadTime(&ReaderConfig{Location: time.UTC, TimeFormat: "15:04:05"}, stat, nil), ShouldEqual, "14:04:05")
+		So(ReadTime(&ReaderConfig{HumanReadable: true, Location: newYork}, stat, nil), ShouldEqual, "Jan  2 09:04:05.000")
+	})
+
+	Convey("The sample sequence number is reported", t, func() {
+		So(ReadSequence(&ReaderConfig{}, stat, nil), ShouldEqual, "42")
+	})
+
+	Convey("The actual interval since the previous sample is reported", t, func() {
+		previous := &ServerStatus{SampleTime: stat.SampleTime.Add(-2003 * time.Millisecond)}
+		So(ReadInterval(&ReaderConfig{}, stat, previous), ShouldEqual, "2.003")
+		So(ReadInterval(&ReaderConfig{}, stat, &ServerStatus{}), ShouldEqual, "")
+	})
+}
+
+func TestReadHistoryStore(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	sampleTime := time.Date(2020, time.January, 2, 15, 4, 5, 0, time.UTC)
+	oldStat := &ServerStatus{
+		SampleTime: sampleTime,
+		WiredTiger: &WiredTiger{Cache: CacheStats{HSReads: 100, HSWrites: 40}},
+	}
+	newStat := &ServerStatus{
+		SampleTime: sampleTime.Add(2 * time.Second),
+		WiredTiger: &WiredTiger{Cache: CacheStats{HSOnDiskBytes: 3 * 1024 * 1024, HSScore: 12, HSReads: 300, HSWrites: 50}},
+	}
+
+	Convey("History store statistics are reported, with reads and writes per second", t, func() {
+		So(ReadHSBytes(&ReaderConfig{}, newStat, oldStat), ShouldEqual, "3145728")
+		So(ReadHSBytes(&ReaderConfig{HumanReadable: true}, newStat, oldStat), ShouldEqual, "3.00M")
+		So(ReadHSScore(&ReaderConfig{}, newStat, oldStat), ShouldEqual, "12")
+		So(ReadHSRead(&ReaderConfig{}, newStat, oldStat), ShouldEqual, "100")
+		So(ReadHSWrite(&ReaderConfig{}, newStat, oldStat), ShouldEqual, "5")
+	})
+
+	Convey("Cache overflow statistics are reported for servers before 4.4", t, func() {
+		overflow := &ServerStatus{
+			SampleTime: newStat.SampleTime,
+			WiredTiger: &WiredTiger{Cache: CacheStats{OverflowOnDiskBytes: 1024, OverflowScore: 7}},
+		}
+		So(ReadHSBytes(&ReaderConfig{}, overflow, nil), ShouldEqual, "1024")
+		So(ReadHSScore(&ReaderConfig{}, overflow, nil), ShouldEqual, "7")
+	})
+
+	Convey("Nothing is reported without WiredTiger statistics or a previous sample", t, func() {
+		So(ReadHSBytes(&ReaderConfig{}, &ServerStatus{}, nil), ShouldEqual, "")
+		So(ReadHSRead(&ReaderConfig{}, newStat, nil), ShouldEqual, "")
+		So(ReadHSWrite(&ReaderConfig{}, newStat, &ServerStatus{}), ShouldEqual, "")
+	})
+}
+
+func TestReadCacheBalance(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	sampleTime := time.Date(2020, time.January, 2, 15, 4, 5, 0, time.UTC)
+	oldStat := &ServerStatus{
+		SampleTime: sampleTime,
+		WiredTiger: &WiredTiger{Cache: CacheStats{BytesReadInto: 10 << 20, BytesWrittenFrom: 2 << 20, BytesEvicted: 4 << 20}},
+	}
+	filling := &ServerStatus{
+		SampleTime: sampleTime.Add(2 * time.Second),
+		WiredTiger: &WiredTiger{Cache: CacheStats{BytesReadInto: 20 << 20, BytesWrittenFrom: 3 << 20, BytesEvicted: 5 << 20}},
+	}
+	evicting := &ServerStatus{
+		SampleTime: sampleTime.Add(2 * time.Second),
+		WiredTiger: &WiredTiger{Cache: CacheStats{BytesReadInto: 11 << 20, BytesWrittenFrom: 3 << 20, BytesEvicted: 9 << 20}},
+	}
+
+	Convey("The cache balance is the bytes read into the cache less those written and evicted, per second", t, func() {
+		So(ReadCacheBalance(&ReaderConfig{}, filling, oldStat), ShouldEqual, "4194304")
+		So(ReadCacheBalance(&ReaderConfig{HumanReadable: true}, filling, oldStat), ShouldEqual, "4.00M")
+		So(ReadCacheBalance(&ReaderConfig{}, evicting, oldStat), ShouldEqual, "-2621440")
+		So(ReadCacheBalance(&ReaderConfig{HumanReadable: true}, evicting, oldStat), ShouldEqual, "-2.50M")
+	})
+
+	Convey("Nothing is reported without WiredTiger statistics or a previous sample", t, func() {
+		So(ReadCacheBalance(&ReaderConfig{}, filling, nil), ShouldEqual, "")
+		So(ReadCacheBalance(&ReaderConfig{}, filling, &ServerStatus{}), ShouldEqual, "")
+	})
+}
+
+func TestRestarted(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	sample := func(uptimeMillis, inserts int64) *ServerStatus {
+		return &ServerStatus{UptimeMillis: uptimeMillis, Opcounters: &OpcountStats{Insert: inserts}}
+	}
+
+	Convey("A restart is detected from the uptime or the opcounters going backwards", t, func() {
+		So(Restarted(sample(2000, 10), sample(1000, 5)), ShouldBeFalse)
+		So(Restarted(sample(500, 10), sample(1000, 5)), ShouldBeTrue)
+		So(Restarted(sample(2000, 3), sample(1000, 5)), ShouldBeTrue)
+
+		Convey("and from the uptime in seconds if the uptime in milliseconds is not reported", func() {
+			So(Restarted(&ServerStatus{Uptime: 3}, &ServerStatus{Uptime: 60}), ShouldBeTrue)
+			So(Restarted(&ServerStatus{Uptime: 61}, &ServerStatus{Uptime: 60}), ShouldBeFalse)
+		})
+	})
+}
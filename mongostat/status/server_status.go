@@ -6,11 +6,19 @@
 
 package status
 
-import "time"
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
 
 type ServerStatus struct {
 	SampleTime         time.Time              `bson:""`
 	Flattened          map[string]interface{} `bson:""`
+	Raw                bson.Raw               `bson:"-"`
+	Sys                *SysStats              `bson:"-"`
+	Ping               *Latency               `bson:"-"`
+	Sequence           uint64                 `bson:"-"`
 	Host               string                 `bson:"host"`
 	Version            string                 `bson:"version"`
 	Process            string                 `bson:"process"`
@@ -62,6 +70,43 @@ type CacheStats struct {
 	TrackedDirtyBytes  int64 `bson:"tracked dirty bytes in the cache"`
 	CurrentCachedBytes int64 `bson:"bytes currently in the cache"`
 	MaxBytesConfigured int64 `bson:"maximum bytes configured"`
+
+	// cache traffic, from which the rate the cache fills at is derived
+	BytesReadInto    int64 `bson:"bytes read into cache"`
+	BytesWrittenFrom int64 `bson:"bytes written from cache"`
+	BytesEvicted     int64 `bson:"bytes evicted from cache"`
+
+	// history store statistics, reported since 4.4
+	HSOnDiskBytes int64 `bson:"history store table on-disk size"`
+	HSScore       int64 `bson:"history store score"`
+	HSReads       int64 `bson:"history store table reads"`
+	HSWrites      int64 `bson:"history store table insert calls"`
+
+	// cache overflow statistics, reported before the history store replaced
+	// the cache overflow table in 4.4
+	OverflowOnDiskBytes int64 `bson:"cache overflow table on-disk size"`
+	OverflowScore       int64 `bson:"cache overflow score"`
+	OverflowReads       int64 `bson:"pages read into cache requiring cache overflow entries"`
+	OverflowWrites      int64 `bson:"cache overflow table insert calls"`
+}
+
+// HistoryStoreStats stores statistics for the table that WiredTiger moves
+// older versions of data to under cache pressure.
+type HistoryStoreStats struct {
+	OnDiskBytes int64
+	Score       int64
+	Reads       int64
+	Writes      int64
+}
+
+// HistoryStore returns the history store statistics, or the cache overflow
+// statistics of servers before 4.4.
+func (c *CacheStats) HistoryStore() HistoryStoreStats {
+	hs := HistoryStoreStats{OnDiskBytes: c.HSOnDiskBytes, Score: c.HSScore, Reads: c.HSReads, Writes: c.HSWrites}
+	if hs == (HistoryStoreStats{}) {
+		hs = HistoryStoreStats{OnDiskBytes: c.OverflowOnDiskBytes, Score: c.OverflowScore, Reads: c.OverflowReads, Writes: c.OverflowWrites}
+	}
+	return hs
 }
 
 // TransactionStats stores transaction checkpoints in WiredTiger.
@@ -79,6 +124,8 @@ type ReplStatus struct {
 	Hosts        []string    `bson:"hosts"`
 	Passives     []string    `bson:"passives"`
 	Me           string      `bson:"me"`
+	ElectionID   interface{} `bson:"electionId"`
+	RBID         interface{} `bson:"rbid"`
 }
 
 // DBRecordStats stores data related to memory operations across databases.
@@ -0,0 +1,191 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package status
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SysStats holds host-level counters read from /proc when a sample is taken.
+// They describe the host mongostat runs on, so they are only meaningful when
+// that is also the host of the monitored server.
+type SysStats struct {
+	// RunQueue is the number of runnable processes.
+	RunQueue int64
+	// DiskIOTicks is the number of milliseconds each block device has spent
+	// doing I/O.
+	DiskIOTicks map[string]int64
+	// SwapIns is the number of pages swapped in since boot.
+	SwapIns int64
+	// NUMAMisses is the number of pages allocated on a NUMA node other than
+	// the preferred one, summed over every node. It is nil if the host does
+	// not expose NUMA statistics.
+	NUMAMisses *int64
+}
+
+// ReadSysStats reads the current host-level counters from /proc, and the
+// NUMA counters from /sys.
+func ReadSysStats() (*SysStats, error) {
+	return readSysStats("/proc", "/sys/devices/system/node")
+}
+
+func readSysStats(procDir, nodeDir string) (*SysStats, error) {
+	stats := &SysStats{DiskIOTicks: map[string]int64{}}
+
+	err := scanProcFile(filepath.Join(procDir, "stat"), func(fields []string) {
+		if len(fields) == 2 && fields[0] == "procs_running" {
+			stats.RunQueue, _ = strconv.ParseInt(fields[1], 10, 64)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = scanProcFile(filepath.Join(procDir, "vmstat"), func(fields []string) {
+		if len(fields) == 2 && fields[0] == "pswpin" {
+			stats.SwapIns, _ = strconv.ParseInt(fields[1], 10, 64)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the 13th field of each line is the time spent doing I/O, in ms
+	err = scanProcFile(filepath.Join(procDir, "diskstats"), func(fields []string) {
+		if len(fields) < 13 || isVirtualDisk(fields[2]) {
+			return
+		}
+		if ticks, err := strconv.ParseInt(fields[12], 10, 64); err == nil {
+			stats.DiskIOTicks[fields[2]] = ticks
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if stats.NUMAMisses, err = readNUMAMisses(nodeDir); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// readNUMAMisses sums numa_miss over the numastat file of every NUMA node.
+// Hosts without NUMA support have no node directories, and yield nil.
+func readNUMAMisses(nodeDir string) (*int64, error) {
+	paths, err := filepath.Glob(filepath.Join(nodeDir, "node[0-9]*", "numastat"))
+	if err != nil || len(paths) == 0 {
+		return nil, err
+	}
+	var misses int64
+	for _, path := range paths {
+		err = scanProcFile(path, func(fields []string) {
+			if len(fields) == 2 && fields[0] == "numa_miss" {
+				nodeMisses, _ := strconv.ParseInt(fields[1], 10, 64)
+				misses += nodeMisses
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &misses, nil
+}
+
+// isVirtualDisk returns true for block devices that are not backed by a disk.
+func isVirtualDisk(name string) bool {
+	for _, prefix := range []string{"loop", "ram", "zram", "sr"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func scanProcFile(path string, scanLine func(fields []string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		scanLine(strings.Fields(scanner.Text()))
+	}
+	if err = scanner.Err(); err != nil {
+		return fmt.Errorf("error reading %v: %v", path, err)
+	}
+	return nil
+}
+
+func ReadRunQueue(_ *ReaderConfig, newStat, _ *ServerStatus) string {
+	if newStat.Sys == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d", newStat.Sys.RunQueue)
+}
+
+// ReadDiskUtil reports the busiest block device and the percentage of the
+// sample interval it spent doing I/O.
+func ReadDiskUtil(_ *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	if newStat.Sys == nil || oldStat.Sys == nil {
+		return ""
+	}
+	sampleMillis := newStat.SampleTime.Sub(oldStat.SampleTime).Seconds() * 1000
+	if sampleMillis <= 0 {
+		return ""
+	}
+
+	devices := make([]string, 0, len(newStat.Sys.DiskIOTicks))
+	for device := range newStat.Sys.DiskIOTicks {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+
+	busiest, maxUtil := "", -1.0
+	for _, device := range devices {
+		oldTicks, ok := oldStat.Sys.DiskIOTicks[device]
+		if !ok {
+			continue
+		}
+		busy := float64(newStat.Sys.DiskIOTicks[device]-oldTicks) / sampleMillis * 100
+		if busy > maxUtil {
+			busiest, maxUtil = device, busy
+		}
+	}
+	if busiest == "" {
+		return ""
+	}
+	if maxUtil > 100 {
+		maxUtil = 100
+	}
+	return fmt.Sprintf("%s:%.1f%%", busiest, maxUtil)
+}
+
+func ReadSwapIn(_ *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	if newStat.Sys == nil || oldStat.Sys == nil {
+		return ""
+	}
+	sampleSecs := float64(newStat.SampleTime.Sub(oldStat.SampleTime).Seconds())
+	return fmt.Sprintf("%d", diff(newStat.Sys.SwapIns, oldStat.Sys.SwapIns, sampleSecs))
+}
+
+// ReadNUMAMiss reports the rate of page allocations that missed their
+// preferred NUMA node, across every node of the local host.
+func ReadNUMAMiss(_ *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	if newStat.Sys == nil || oldStat.Sys == nil || newStat.Sys.NUMAMisses == nil || oldStat.Sys.NUMAMisses == nil {
+		return ""
+	}
+	sampleSecs := float64(newStat.SampleTime.Sub(oldStat.SampleTime).Seconds())
+	return fmt.Sprintf("%d", diff(*newStat.Sys.NUMAMisses, *oldStat.Sys.NUMAMisses, sampleSecs))
+}
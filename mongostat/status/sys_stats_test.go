@@ -0,0 +1,82 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package status
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSysStats(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a fake /proc", t, func() {
+		procDir, err := ioutil.TempDir("", "mongostat_proc")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(procDir)
+
+		files := map[string]string{
+			"stat":   "cpu  1 2 3 4\nprocs_running 3\nprocs_blocked 0\n",
+			"vmstat": "nr_free_pages 100\npswpin 42\npswpout 7\n",
+			"diskstats": "   7       0 loop0 1 0 2 0 0 0 0 0 0 900 900\n" +
+				"   8       0 sda 10 0 20 5 30 0 40 6 0 250 11\n" +
+				"   8      16 sdb 10 0 20 5 30 0 40 6 0 100 11\n",
+		}
+		for name, contents := range files {
+			So(ioutil.WriteFile(filepath.Join(procDir, name), []byte(contents), 0644), ShouldBeNil)
+		}
+		nodeDir := filepath.Join(procDir, "node")
+		for node, misses := range map[string]string{"node0": "5", "node1": "7"} {
+			So(os.MkdirAll(filepath.Join(nodeDir, node), 0755), ShouldBeNil)
+			contents := "numa_hit 100\nnuma_miss " + misses + "\nnuma_foreign 3\n"
+			So(ioutil.WriteFile(filepath.Join(nodeDir, node, "numastat"), []byte(contents), 0644), ShouldBeNil)
+		}
+
+		Convey("the counters should be parsed, skipping virtual disks", func() {
+			stats, err := readSysStats(procDir, nodeDir)
+			So(err, ShouldBeNil)
+			So(stats.RunQueue, ShouldEqual, 3)
+			So(stats.SwapIns, ShouldEqual, 42)
+			So(stats.DiskIOTicks, ShouldResemble, map[string]int64{"sda": 250, "sdb": 100})
+			So(stats.NUMAMisses, ShouldNotBeNil)
+			So(*stats.NUMAMisses, ShouldEqual, 12)
+		})
+
+		Convey("a host without NUMA nodes should have no NUMA counters", func() {
+			stats, err := readSysStats(procDir, filepath.Join(procDir, "missing"))
+			So(err, ShouldBeNil)
+			So(stats.NUMAMisses, ShouldBeNil)
+		})
+
+		Convey("the columns should be computed from two samples", func() {
+			now := time.Now()
+			oldMisses, newMisses := int64(100), int64(160)
+			oldStat := &ServerStatus{SampleTime: now, Sys: &SysStats{
+				RunQueue: 1, SwapIns: 10, DiskIOTicks: map[string]int64{"sda": 0, "sdb": 0}, NUMAMisses: &oldMisses,
+			}}
+			newStat := &ServerStatus{SampleTime: now.Add(time.Second), Sys: &SysStats{
+				RunQueue: 4, SwapIns: 30, DiskIOTicks: map[string]int64{"sda": 250, "sdb": 500}, NUMAMisses: &newMisses,
+			}}
+			So(ReadRunQueue(nil, newStat, oldStat), ShouldEqual, "4")
+			So(ReadSwapIn(nil, newStat, oldStat), ShouldEqual, "20")
+			So(ReadDiskUtil(nil, newStat, oldStat), ShouldEqual, "sdb:50.0%")
+			So(ReadNUMAMiss(nil, newStat, oldStat), ShouldEqual, "60")
+
+			oldStat.Sys.NUMAMisses = nil
+			So(ReadNUMAMiss(nil, newStat, oldStat), ShouldEqual, "")
+
+			newStat.Sys = nil
+			So(ReadDiskUtil(nil, newStat, oldStat), ShouldEqual, "")
+		})
+	})
+}
@@ -0,0 +1,245 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongotop
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/log"
+)
+
+// alertMetrics are the per-namespace deltas that an --alert condition can
+// test, named like the columns of the --sqlite deltas table. Counts are not
+// reported with --locks.
+var alertMetrics = map[string]func(deltaRow) (int64, bool){
+	"total_ms":    func(r deltaRow) (int64, bool) { return r.totalMs, true },
+	"read_ms":     func(r deltaRow) (int64, bool) { return r.readMs, true },
+	"write_ms":    func(r deltaRow) (int64, bool) { return r.writeMs, true },
+	"total_count": func(r deltaRow) (int64, bool) { return countOf(r.totalCount) },
+	"read_count":  func(r deltaRow) (int64, bool) { return countOf(r.readCount) },
+	"write_count": func(r deltaRow) (int64, bool) { return countOf(r.writeCount) },
+}
+
+func countOf(count interface{}) (int64, bool) {
+	n, ok := count.(int64)
+	return n, ok
+}
+
+// alertConditionRE matches a condition such as write_ms>500.
+var alertConditionRE = regexp.MustCompile(`^([a-z_]+)\s*(>=|<=|>|<)\s*(\d+)$`)
+
+// alertCondition compares a metric of a namespace's deltas with a value.
+type alertCondition struct {
+	metric string
+	op     string
+	value  int64
+}
+
+// holds returns whether the condition holds for row, which it does not if
+// row lacks the metric.
+func (c alertCondition) holds(row deltaRow) bool {
+	n, ok := alertMetrics[c.metric](row)
+	if !ok {
+		return false
+	}
+	switch c.op {
+	case ">":
+		return n > c.value
+	case ">=":
+		return n >= c.value
+	case "<":
+		return n < c.value
+	default:
+		return n <= c.value
+	}
+}
+
+// Alert is a threshold given with --alert: every one of its conditions must
+// hold for the deltas of a namespace matching its pattern for it to be
+// breached.
+type Alert struct {
+	// Spec is the --alert argument the alert was parsed from
+	Spec string
+	// Namespace is a pattern, as matched by path.Match, or "" to match every
+	// namespace
+	Namespace  string
+	conditions []alertCondition
+}
+
+// ParseAlert parses an --alert argument, a comma-separated list of an
+// optional ns=<pattern> and one or more conditions, e.g.
+// 'ns=orders.*,write_ms>500'.
+func ParseAlert(spec string) (*Alert, error) {
+	alert := &Alert{Spec: spec}
+	for _, term := range strings.Split(spec, ",") {
+		term = strings.TrimSpace(term)
+		if strings.HasPrefix(term, "ns=") {
+			if alert.Namespace != "" {
+				return nil, fmt.Errorf("more than one namespace pattern in '%v'", spec)
+			}
+			alert.Namespace = strings.TrimPrefix(term, "ns=")
+			if _, err := path.Match(alert.Namespace, ""); err != nil || alert.Namespace == "" {
+				return nil, fmt.Errorf("invalid namespace pattern '%v'", alert.Namespace)
+			}
+			continue
+		}
+		match := alertConditionRE.FindStringSubmatch(term)
+		if match == nil {
+			return nil, fmt.Errorf("expected ns=<pattern> or <metric><op><value> but got '%v'", term)
+		}
+		if _, ok := alertMetrics[match[1]]; !ok {
+			return nil, fmt.Errorf("unknown metric '%v'; expected one of %v", match[1], strings.Join(alertMetricNames(), ", "))
+		}
+		value, err := strconv.ParseInt(match[3], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value in '%v': %v", term, err)
+		}
+		alert.conditions = append(alert.conditions, alertCondition{metric: match[1], op: match[2], value: value})
+	}
+	if len(alert.conditions) == 0 {
+		return nil, fmt.Errorf("no condition in '%v'", spec)
+	}
+	return alert, nil
+}
+
+func alertMetricNames() []string {
+	names := make([]string, 0, len(alertMetrics))
+	for name := range alertMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// UsesCounts returns whether the alert tests a count, which is not reported
+// with --locks.
+func (a *Alert) UsesCounts() bool {
+	for _, c := range a.conditions {
+		if strings.HasSuffix(c.metric, "_count") {
+			return true
+		}
+	}
+	return false
+}
+
+// breachedBy returns whether the alert is breached by row.
+func (a *Alert) breachedBy(row deltaRow) bool {
+	if a.Namespace != "" {
+		if matched, _ := path.Match(a.Namespace, row.namespace); !matched {
+			return false
+		}
+	}
+	for _, c := range a.conditions {
+		if !c.holds(row) {
+			return false
+		}
+	}
+	return true
+}
+
+// alertBreach is an alert that has been breached by a namespace for the
+// required number of consecutive intervals.
+type alertBreach struct {
+	alert *Alert
+	row   deltaRow
+}
+
+// alertWatcher tracks for how many consecutive intervals each alert has
+// been breached by each namespace.
+type alertWatcher struct {
+	alerts    []*Alert
+	intervals int
+	// alert index -> namespace -> consecutive intervals breached
+	streaks []map[string]int
+}
+
+func newAlertWatcher(alerts []*Alert, intervals int) *alertWatcher {
+	if intervals < 1 {
+		intervals = 1
+	}
+	return &alertWatcher{alerts: alerts, intervals: intervals, streaks: make([]map[string]int, len(alerts))}
+}
+
+// check records the deltas of diff and returns the alerts that have now been
+// breached for the required number of consecutive intervals. An alert is only
+// returned again for a namespace once the namespace has stopped breaching it.
+func (w *alertWatcher) check(diff FormattableDiff) []alertBreach {
+	var breaches []alertBreach
+	rows := deltaRows(diff)
+	for i, alert := range w.alerts {
+		streaks := make(map[string]int)
+		for _, row := range rows {
+			if !alert.breachedBy(row) {
+				continue
+			}
+			streaks[row.namespace] = w.streaks[i][row.namespace] + 1
+			if streaks[row.namespace] == w.intervals {
+				breaches = append(breaches, alertBreach{alert: alert, row: row})
+			}
+		}
+		w.streaks[i] = streaks
+	}
+	return breaches
+}
+
+// description describes the breach in a line.
+func (b alertBreach) description(intervals int) string {
+	values := make([]string, 0, len(alertMetrics))
+	for _, name := range alertMetricNames() {
+		if n, ok := alertMetrics[name](b.row); ok {
+			values = append(values, fmt.Sprintf("%v=%v", name, n))
+		}
+	}
+	return fmt.Sprintf("alert '%v' breached by %v for %v consecutive interval(s): %v",
+		b.alert.Spec, b.row.namespace, intervals, strings.Join(values, " "))
+}
+
+// environment returns the variables describing the breach to --alertExec.
+func (b alertBreach) environment(host string, intervals int) []string {
+	env := []string{
+		"MONGOTOP_ALERT=" + b.alert.Spec,
+		"MONGOTOP_NAMESPACE=" + b.row.namespace,
+		"MONGOTOP_HOST=" + host,
+		fmt.Sprintf("MONGOTOP_INTERVALS=%v", intervals),
+	}
+	for _, name := range alertMetricNames() {
+		if n, ok := alertMetrics[name](b.row); ok {
+			env = append(env, fmt.Sprintf("MONGOTOP_%v=%v", strings.ToUpper(name), n))
+		}
+	}
+	return env
+}
+
+// checkAlerts evaluates the alerts against diff, logging each breach and
+// running --alertExec for it. With --alertExit it returns an error for the
+// first breach.
+func (mt *MongoTop) checkAlerts(diff FormattableDiff) error {
+	intervals := mt.alertWatcher.intervals
+	for _, breach := range mt.alertWatcher.check(diff) {
+		log.Logvf(log.Always, "%v", breach.description(intervals))
+		if mt.OutputOptions.AlertExec != "" {
+			cmd := exec.Command(mt.OutputOptions.AlertExec)
+			cmd.Env = append(os.Environ(), breach.environment(mt.host(), intervals)...)
+			cmd.Stdout = os.Stderr
+			cmd.Stderr = os.Stderr
+			if err := cmd.Run(); err != nil {
+				log.Logvf(log.Always, "error running --alertExec: %v", err)
+			}
+		}
+		if mt.OutputOptions.AlertExit {
+			return fmt.Errorf("alert '%v' breached by %v", breach.alert.Spec, breach.row.namespace)
+		}
+	}
+	return nil
+}
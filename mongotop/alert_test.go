@@ -0,0 +1,102 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongotop
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseAlert(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Alerts should parse", t, func() {
+		alert, err := ParseAlert("ns=orders.*, write_ms>500,write_count >= 10")
+		So(err, ShouldBeNil)
+		So(alert.Namespace, ShouldEqual, "orders.*")
+		So(alert.conditions, ShouldResemble, []alertCondition{
+			{metric: "write_ms", op: ">", value: 500},
+			{metric: "write_count", op: ">=", value: 10},
+		})
+		So(alert.UsesCounts(), ShouldBeTrue)
+
+		alert, err = ParseAlert("total_ms<=5")
+		So(err, ShouldBeNil)
+		So(alert.Namespace, ShouldEqual, "")
+		So(alert.UsesCounts(), ShouldBeFalse)
+	})
+
+	Convey("Malformed alerts are rejected", t, func() {
+		for _, spec := range []string{"", "ns=orders.*", "ns=a,ns=b,read_ms>1", "ns=[,read_ms>1",
+			"latency>5", "read_ms=5", "read_ms>-1", "read_ms>x"} {
+			_, err := ParseAlert(spec)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
+
+func TestAlertWatcher(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	// each namespace of the diff has the given write time, and as much read time
+	diff := func(writeMicros map[string]int) FormattableDiff {
+		totals := make(map[string]int, len(writeMicros))
+		previous := make(map[string]int, len(writeMicros))
+		for ns, micros := range writeMicros {
+			totals[ns] = 2 * micros
+			previous[ns] = 0
+		}
+		return topSample(totals).Diff(topSample(previous))
+	}
+	namespaces := func(breaches []alertBreach) []string {
+		var names []string
+		for _, b := range breaches {
+			names = append(names, b.row.namespace)
+		}
+		return names
+	}
+
+	Convey("With an alert on the writes of some namespaces", t, func() {
+		alert, err := ParseAlert("ns=orders.*,write_ms>500")
+		So(err, ShouldBeNil)
+
+		Convey("matching namespaces over the threshold breach it", func() {
+			w := newAlertWatcher([]*Alert{alert}, 1)
+			breaches := w.check(diff(map[string]int{"orders.a": 600000, "orders.b": 100000, "users.a": 900000}))
+			So(namespaces(breaches), ShouldResemble, []string{"orders.a"})
+			So(breaches[0].description(1), ShouldEqual, "alert 'ns=orders.*,write_ms>500' breached by orders.a "+
+				"for 1 consecutive interval(s): read_count=600 read_ms=600 total_count=1200 total_ms=1200 write_count=600 write_ms=600")
+			So(breaches[0].environment("localhost:27017", 1), ShouldContain, "MONGOTOP_WRITE_MS=600")
+		})
+
+		Convey("with --alertIntervals, it must be breached for consecutive intervals", func() {
+			w := newAlertWatcher([]*Alert{alert}, 2)
+			over := diff(map[string]int{"orders.a": 600000})
+			under := diff(map[string]int{"orders.a": 1000})
+			So(w.check(over), ShouldBeEmpty)
+			So(w.check(under), ShouldBeEmpty)
+			So(w.check(over), ShouldBeEmpty)
+			So(namespaces(w.check(over)), ShouldResemble, []string{"orders.a"})
+
+			Convey("and is reported again only once it stopped being breached", func() {
+				So(w.check(over), ShouldBeEmpty)
+				So(w.check(under), ShouldBeEmpty)
+				So(w.check(over), ShouldBeEmpty)
+				So(w.check(over), ShouldHaveLength, 1)
+			})
+		})
+	})
+
+	Convey("Alerts on counts are not breached without counts", t, func() {
+		alert, err := ParseAlert("read_count>=0")
+		So(err, ShouldBeNil)
+		w := newAlertWatcher([]*Alert{alert}, 1)
+		So(w.check(ServerStatusDiff{Totals: map[string]LockDelta{"test": {Read: 3, Write: 4}}}), ShouldBeEmpty)
+	})
+}
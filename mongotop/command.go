@@ -23,11 +23,14 @@ type FormattableDiff interface {
 	JSON() string
 	// Generate a table-like representation which can be printed to a terminal
 	Grid() string
+	// Report whether any namespace or database was active between the samples
+	HasActivity() bool
 }
 
 // ServerStatus represents the results of the "serverStatus" command.
 type ServerStatus struct {
-	Locks map[string]LockStats `bson:"locks,omitempty"`
+	Locks        map[string]LockStats `bson:"locks,omitempty"`
+	UptimeMillis int64                `bson:"uptimeMillis"`
 }
 
 // LockStats contains information on time spent acquiring and holding a lock.
@@ -50,6 +53,13 @@ type ServerStatusDiff struct {
 	// namespace -> lock times
 	Totals map[string]LockDelta `json:"totals"`
 	Time   time.Time            `json:"time"`
+
+	// Restarted is set, and Totals left empty, if the server restarted
+	// between the samples
+	Restarted bool `json:"restarted,omitempty"`
+
+	// Footer adds min, max and total rows to the grid
+	Footer bool `json:"-"`
 }
 
 // LockDelta represents the differences in read/write lock times between two samples.
@@ -63,11 +73,41 @@ type TopDiff struct {
 	// namespace -> totals
 	Totals map[string]NSTopInfo `json:"totals"`
 	Time   time.Time            `json:"time"`
+
+	// namespace -> totals since the baseline sample, if one is in use
+	Cumulative map[string]NSTopInfo `json:"cumulative,omitempty"`
+
+	// namespace -> annotation, for namespaces whose counters could not be
+	// diffed normally (see AnnotationDropped and AnnotationReset)
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Restarted is set, and Totals left empty, if the server restarted
+	// between the samples
+	Restarted bool `json:"restarted,omitempty"`
+
+	// Footer adds min, max and total rows to the grid
+	Footer bool `json:"-"`
 }
 
+const (
+	// AnnotationDropped marks a namespace that was present in the previous
+	// sample but not in the current one, e.g. because it was dropped or renamed.
+	AnnotationDropped = "dropped"
+	// AnnotationReset marks a namespace whose counters went backwards between
+	// samples, e.g. because it was dropped and recreated. Its deltas are the
+	// counters accumulated since the reset.
+	AnnotationReset = "reset"
+	// AnnotationRestarted marks a diff whose samples were taken before and
+	// after the server restarted, whose deltas are discarded.
+	AnnotationRestarted = "server restarted"
+)
+
 // Top holds raw output of the "top" command.
 type Top struct {
-	Totals map[string]NSTopInfo `bson:"totals"`
+	Totals map[string]NSTopInfo `bson:"totals" json:"totals"`
+
+	// how long the server had been up when the sample was taken, if known
+	Uptime time.Duration `bson:"-" json:"uptime,omitempty"`
 }
 
 // NSTopInfo holds information about a single namespace.
@@ -100,6 +140,58 @@ func (a sortableTotals) Less(i, j int) bool {
 func (a sortableTotals) Len() int      { return len(a) }
 func (a sortableTotals) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
 
+// gridSummary accumulates the min, max and total of each numeric column of
+// the rows displayed in a grid.
+type gridSummary struct {
+	min, max, total []int64
+	rows            int
+}
+
+// add accumulates a displayed row's values, one for each numeric column.
+func (s *gridSummary) add(values ...int64) {
+	if s.rows == 0 {
+		s.min = append([]int64(nil), values...)
+		s.max = append([]int64(nil), values...)
+		s.total = make([]int64, len(values))
+	}
+	for i, v := range values {
+		if v < s.min[i] {
+			s.min[i] = v
+		}
+		if v > s.max[i] {
+			s.max[i] = v
+		}
+		s.total[i] += v
+	}
+	s.rows++
+}
+
+// write writes the min, max and total rows to out, with trailing empty
+// cells to fill the rest of each row. It writes nothing if no rows were
+// displayed.
+func (s *gridSummary) write(out *text.GridWriter, trailing int) {
+	if s.rows == 0 {
+		return
+	}
+	for _, row := range []struct {
+		label  string
+		values []int64
+	}{
+		{"(min)", s.min},
+		{"(max)", s.max},
+		{"(total)", s.total},
+	} {
+		out.WriteCell(row.label)
+		for _, v := range row.values {
+			out.WriteCell(fmt.Sprintf("%vms", v))
+		}
+		for i := 0; i < trailing; i++ {
+			out.WriteCell("")
+		}
+		out.EndRow()
+	}
+}
+
 // Diff takes an older Top sample, and produces a TopDiff
 // representing the deltas of each metric between the two samples.
 func (top Top) Diff(previous Top) TopDiff {
@@ -111,35 +203,118 @@ func (top Top) Diff(previous Top) TopDiff {
 
 	// For each namespace we are tracking, subtract the times and counts
 	// for total/read/write and build a new map containing the diffs.
+	// Namespaces which disappeared or whose counters went backwards are
+	// annotated rather than being omitted or reported with negative deltas.
 	prevTotals := previous.Totals
 	curTotals := top.Totals
 	for ns, prevNSInfo := range prevTotals {
-		if curNSInfo, ok := curTotals[ns]; ok {
-			diff.Totals[ns] = NSTopInfo{
-				Total: TopField{
-					Time:  (curNSInfo.Total.Time - prevNSInfo.Total.Time) / 1000,
-					Count: curNSInfo.Total.Count - prevNSInfo.Total.Count,
-				},
-				Read: TopField{
-					Time:  (curNSInfo.Read.Time - prevNSInfo.Read.Time) / 1000,
-					Count: curNSInfo.Read.Count - prevNSInfo.Read.Count,
-				},
-				Write: TopField{
-					Time:  (curNSInfo.Write.Time - prevNSInfo.Write.Time) / 1000,
-					Count: curNSInfo.Write.Count - prevNSInfo.Write.Count,
-				},
-			}
+		curNSInfo, ok := curTotals[ns]
+		switch {
+		case !ok:
+			diff.Totals[ns] = NSTopInfo{}
+			diff.annotate(ns, AnnotationDropped)
+		case curNSInfo.resetSince(prevNSInfo):
+			diff.Totals[ns] = curNSInfo.since(NSTopInfo{})
+			diff.annotate(ns, AnnotationReset)
+		default:
+			diff.Totals[ns] = curNSInfo.since(prevNSInfo)
 		}
 	}
 	return diff
 }
 
+// restartedSince returns whether the server restarted after the earlier
+// sample was taken: its uptime went backwards or, if the uptime of either
+// sample is unknown, the counters of every one of several namespaces found
+// in both samples went backwards.
+func (top Top) restartedSince(earlier Top) bool {
+	if top.Uptime > 0 && earlier.Uptime > 0 {
+		return top.Uptime < earlier.Uptime
+	}
+	resets := 0
+	for ns, info := range top.Totals {
+		earlierInfo, ok := earlier.Totals[ns]
+		if !ok {
+			continue
+		}
+		if info.Total.Time >= earlierInfo.Total.Time && info.Total.Count >= earlierInfo.Total.Count {
+			return false
+		}
+		resets++
+	}
+	return resets > 1
+}
+
+// annotate records an annotation for ns.
+func (td *TopDiff) annotate(ns, annotation string) {
+	if td.Annotations == nil {
+		td.Annotations = map[string]string{}
+	}
+	td.Annotations[ns] = annotation
+}
+
+// resetSince returns whether the counters of the namespace went backwards
+// after the earlier sample was taken, e.g. because it was dropped and
+// recreated.
+func (info NSTopInfo) resetSince(earlier NSTopInfo) bool {
+	return info.Total.Time < earlier.Total.Time || info.Total.Count < earlier.Total.Count
+}
+
+// since returns the deltas between info and an earlier sample of the same
+// namespace, with times converted to milliseconds.
+func (info NSTopInfo) since(earlier NSTopInfo) NSTopInfo {
+	return NSTopInfo{
+		Total: TopField{
+			Time:  (info.Total.Time - earlier.Total.Time) / 1000,
+			Count: info.Total.Count - earlier.Total.Count,
+		},
+		Read: TopField{
+			Time:  (info.Read.Time - earlier.Read.Time) / 1000,
+			Count: info.Read.Count - earlier.Read.Count,
+		},
+		Write: TopField{
+			Time:  (info.Write.Time - earlier.Write.Time) / 1000,
+			Count: info.Write.Count - earlier.Write.Count,
+		},
+	}
+}
+
+// Since takes a baseline Top sample, and produces a TopDiff representing
+// the deltas of each metric accumulated since the baseline. Unlike Diff,
+// namespaces which did not exist in the baseline are included. A namespace
+// whose counters were reset since the baseline is annotated, and its deltas
+// are the counters accumulated since the reset.
+func (top Top) Since(baseline Top) TopDiff {
+	diff := TopDiff{
+		Totals: map[string]NSTopInfo{},
+		Time:   time.Now(),
+	}
+	for ns, curNSInfo := range top.Totals {
+		baseNSInfo := baseline.Totals[ns]
+		if curNSInfo.resetSince(baseNSInfo) {
+			diff.Totals[ns] = curNSInfo.since(NSTopInfo{})
+			diff.annotate(ns, AnnotationReset)
+			continue
+		}
+		diff.Totals[ns] = curNSInfo.since(baseNSInfo)
+	}
+	return diff
+}
+
 // Grid returns a tabular representation of the TopDiff.
 func (td TopDiff) Grid() string {
 	buf := &bytes.Buffer{}
 	out := &text.GridWriter{ColumnPadding: 4}
-	out.WriteCells("ns", "total", "read", "write", time.Now().Format("2006-01-02T15:04:05Z07:00"))
+	out.WriteCells("ns", "total", "read", "write")
+	if td.Cumulative != nil {
+		out.WriteCells("cum total", "cum read", "cum write")
+	}
+	out.WriteCell(time.Now().Format("2006-01-02T15:04:05Z07:00"))
 	out.EndRow()
+	if td.Restarted {
+		out.WriteCell(fmt.Sprintf("[%v]", AnnotationRestarted))
+		out.EndRow()
+	}
 
 	//Sort by total time
 	totals := make(sortableTotals, 0, len(td.Totals))
@@ -148,22 +323,51 @@ func (td TopDiff) Grid() string {
 	}
 
 	sort.Sort(sort.Reverse(totals))
+	var summary gridSummary
 	for i, st := range totals {
 		diff := td.Totals[st.Name]
-		out.WriteCells(st.Name,
+		values := []int64{int64(diff.Total.Time), int64(diff.Read.Time), int64(diff.Write.Time)}
+		name := st.Name
+		if annotation, ok := td.Annotations[st.Name]; ok {
+			name = fmt.Sprintf("%v [%v]", name, annotation)
+		}
+		out.WriteCells(name,
 			fmt.Sprintf("%vms", diff.Total.Time),
 			fmt.Sprintf("%vms", diff.Read.Time),
-			fmt.Sprintf("%vms", diff.Write.Time),
-			"")
+			fmt.Sprintf("%vms", diff.Write.Time))
+		if td.Cumulative != nil {
+			cum := td.Cumulative[st.Name]
+			out.WriteCells(
+				fmt.Sprintf("%vms", cum.Total.Time),
+				fmt.Sprintf("%vms", cum.Read.Time),
+				fmt.Sprintf("%vms", cum.Write.Time))
+			values = append(values, int64(cum.Total.Time), int64(cum.Read.Time), int64(cum.Write.Time))
+		}
+		out.WriteCell("")
 		out.EndRow()
+		summary.add(values...)
 		if i >= 9 {
 			break
 		}
 	}
+	if td.Footer {
+		summary.write(out, 1)
+	}
 	out.Flush(buf)
 	return buf.String()
 }
 
+// HasActivity returns true if any namespace performed an operation
+// between the two samples.
+func (td TopDiff) HasActivity() bool {
+	for _, diff := range td.Totals {
+		if diff.Total.Count != 0 || diff.Total.Time != 0 {
+			return true
+		}
+	}
+	return false
+}
+
 // JSON returns a JSON representation of the TopDiff.
 func (td TopDiff) JSON() string {
 	bytes, err := json.Marshal(td)
@@ -182,12 +386,27 @@ func (ssd ServerStatusDiff) JSON() string {
 	return string(bytes)
 }
 
+// HasActivity returns true if any database held a lock between the two
+// samples.
+func (ssd ServerStatusDiff) HasActivity() bool {
+	for _, diff := range ssd.Totals {
+		if diff.Read != 0 || diff.Write != 0 {
+			return true
+		}
+	}
+	return false
+}
+
 // Grid returns a tabular representation of the ServerStatusDiff.
 func (ssd ServerStatusDiff) Grid() string {
 	buf := &bytes.Buffer{}
 	out := &text.GridWriter{ColumnPadding: 4}
 	out.WriteCells("db", "total", "read", "write", time.Now().Format("2006-01-02T15:04:05Z07:00"))
 	out.EndRow()
+	if ssd.Restarted {
+		out.WriteCell(fmt.Sprintf("[%v]", AnnotationRestarted))
+		out.EndRow()
+	}
 
 	//Sort by total time
 	totals := make(sortableTotals, 0, len(ssd.Totals))
@@ -196,6 +415,7 @@ func (ssd ServerStatusDiff) Grid() string {
 	}
 
 	sort.Sort(sort.Reverse(totals))
+	var summary gridSummary
 	for i, st := range totals {
 		diff := ssd.Totals[st.Name]
 		out.WriteCells(st.Name,
@@ -204,10 +424,14 @@ func (ssd ServerStatusDiff) Grid() string {
 			fmt.Sprintf("%vms", diff.Write),
 			"")
 		out.EndRow()
+		summary.add(diff.Read+diff.Write, diff.Read, diff.Write)
 		if i >= 9 {
 			break
 		}
 	}
+	if ssd.Footer {
+		summary.write(out, 1)
+	}
 
 	out.Flush(buf)
 	return buf.String()
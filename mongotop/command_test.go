@@ -0,0 +1,201 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongotop
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func topSample(totals map[string]int) Top {
+	top := Top{Totals: map[string]NSTopInfo{}}
+	for ns, micros := range totals {
+		top.Totals[ns] = NSTopInfo{
+			Total: TopField{Time: micros, Count: micros / 1000},
+			Read:  TopField{Time: micros / 2, Count: micros / 2000},
+			Write: TopField{Time: micros / 2, Count: micros / 2000},
+		}
+	}
+	return top
+}
+
+func TestTopSince(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a baseline top sample", t, func() {
+		baseline := topSample(map[string]int{"test.a": 10000, "test.b": 4000})
+		current := topSample(map[string]int{"test.a": 30000, "test.b": 4000, "test.c": 8000})
+
+		Convey("cumulative deltas are computed in milliseconds", func() {
+			cum := current.Since(baseline).Totals
+			So(cum["test.a"].Total.Time, ShouldEqual, 20)
+			So(cum["test.a"].Read.Time, ShouldEqual, 10)
+			So(cum["test.a"].Write.Time, ShouldEqual, 10)
+			So(cum["test.b"].Total.Time, ShouldEqual, 0)
+		})
+
+		Convey("namespaces created after the baseline are included", func() {
+			cum := current.Since(baseline).Totals
+			So(cum["test.c"].Total.Time, ShouldEqual, 8)
+			So(cum["test.c"].Total.Count, ShouldEqual, 8)
+		})
+
+		Convey("namespaces whose counters were reset report the raw counters", func() {
+			reset := topSample(map[string]int{"test.a": 6000, "test.b": 5000})
+			since := reset.Since(baseline)
+			So(since.Totals["test.a"].Total.Time, ShouldEqual, 6)
+			So(since.Totals["test.a"].Read.Time, ShouldEqual, 3)
+			So(since.Annotations, ShouldResemble, map[string]string{"test.a": AnnotationReset})
+			So(since.Totals["test.b"].Total.Time, ShouldEqual, 1)
+		})
+	})
+}
+
+func TestHasActivity(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("A top diff has activity only if some namespace changed", t, func() {
+		previous := topSample(map[string]int{"test.a": 10000, "test.b": 4000})
+		So(previous.Diff(previous).HasActivity(), ShouldBeFalse)
+		So(topSample(map[string]int{"test.a": 10000, "test.b": 6000}).Diff(previous).HasActivity(), ShouldBeTrue)
+	})
+
+	Convey("A lock diff has activity only if some database held a lock", t, func() {
+		So(ServerStatusDiff{Totals: map[string]LockDelta{"test": {}}}.HasActivity(), ShouldBeFalse)
+		So(ServerStatusDiff{Totals: map[string]LockDelta{"test": {Write: 3}}}.HasActivity(), ShouldBeTrue)
+	})
+}
+
+func TestTopDiffAnnotations(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a namespace dropped and one recreated between samples", t, func() {
+		previous := topSample(map[string]int{"test.a": 10000, "test.b": 20000, "test.c": 4000})
+		current := topSample(map[string]int{"test.a": 12000, "test.b": 6000})
+		diff := current.Diff(previous)
+
+		Convey("the dropped namespace is kept and annotated", func() {
+			So(diff.Totals, ShouldContainKey, "test.c")
+			So(diff.Totals["test.c"], ShouldResemble, NSTopInfo{})
+			So(diff.Annotations["test.c"], ShouldEqual, AnnotationDropped)
+		})
+
+		Convey("the reset namespace reports the counters since the reset", func() {
+			So(diff.Totals["test.b"].Total.Time, ShouldEqual, 6)
+			So(diff.Totals["test.b"].Total.Count, ShouldEqual, 6)
+			So(diff.Annotations["test.b"], ShouldEqual, AnnotationReset)
+		})
+
+		Convey("other namespaces are not annotated", func() {
+			So(diff.Totals["test.a"].Total.Time, ShouldEqual, 2)
+			So(diff.Annotations, ShouldNotContainKey, "test.a")
+		})
+
+		Convey("annotations are shown in the grid and the JSON output", func() {
+			So(diff.Grid(), ShouldContainSubstring, "test.c [dropped]")
+			So(diff.Grid(), ShouldContainSubstring, "test.b [reset]")
+			So(diff.JSON(), ShouldContainSubstring, `"annotations":{"test.b":"reset","test.c":"dropped"}`)
+		})
+	})
+
+	Convey("A diff without drops or resets has no annotations", t, func() {
+		previous := topSample(map[string]int{"test.a": 10000})
+		So(previous.Diff(previous).JSON(), ShouldNotContainSubstring, "annotations")
+	})
+}
+
+func TestServerRestart(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("A restart is detected from the uptime going backwards", t, func() {
+		previous := topSample(map[string]int{"test.a": 10000})
+		previous.Uptime = time.Hour
+		current := topSample(map[string]int{"test.a": 12000})
+		current.Uptime = time.Hour + time.Second
+		So(current.restartedSince(previous), ShouldBeFalse)
+
+		current.Uptime = time.Second
+		So(current.restartedSince(previous), ShouldBeTrue)
+	})
+
+	Convey("Without uptimes, a restart is detected from the counters of several namespaces going backwards", t, func() {
+		previous := topSample(map[string]int{"test.a": 10000, "test.b": 20000, "test.c": 4000})
+		So(topSample(map[string]int{"test.a": 100, "test.b": 200}).restartedSince(previous), ShouldBeTrue)
+
+		Convey("but not from a single recreated namespace", func() {
+			So(topSample(map[string]int{"test.a": 100}).restartedSince(previous), ShouldBeFalse)
+			So(topSample(map[string]int{"test.a": 100, "test.b": 30000}).restartedSince(previous), ShouldBeFalse)
+		})
+	})
+
+	Convey("A restart is shown in the grid and the JSON output", t, func() {
+		diff := TopDiff{Totals: map[string]NSTopInfo{}, Restarted: true}
+		So(diff.Grid(), ShouldContainSubstring, "[server restarted]")
+		So(diff.JSON(), ShouldContainSubstring, `"restarted":true`)
+		So(ServerStatusDiff{Totals: map[string]LockDelta{}, Restarted: true}.Grid(), ShouldContainSubstring, "[server restarted]")
+		So(TopDiff{Totals: map[string]NSTopInfo{}}.JSON(), ShouldNotContainSubstring, "restarted")
+	})
+}
+
+// gridRow returns the cells of the grid row starting with label.
+func gridRow(grid, label string) []string {
+	for _, row := range strings.Split(grid, "\n") {
+		if cells := strings.Fields(row); len(cells) > 0 && cells[0] == label {
+			return cells[1:]
+		}
+	}
+	return nil
+}
+
+func TestGridFooter(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a top diff of several namespaces", t, func() {
+		previous := topSample(map[string]int{"test.a": 10000, "test.b": 4000, "test.c": 2000})
+		current := topSample(map[string]int{"test.a": 40000, "test.b": 14000, "test.c": 4000})
+		diff := current.Diff(previous)
+
+		Convey("the footer is only shown when requested", func() {
+			So(diff.Grid(), ShouldNotContainSubstring, "(total)")
+		})
+
+		Convey("the footer holds the min, max and total of each column", func() {
+			diff.Footer = true
+			grid := diff.Grid()
+			So(gridRow(grid, "(min)"), ShouldResemble, []string{"2ms", "1ms", "1ms"})
+			So(gridRow(grid, "(max)"), ShouldResemble, []string{"30ms", "15ms", "15ms"})
+			So(gridRow(grid, "(total)"), ShouldResemble, []string{"42ms", "21ms", "21ms"})
+		})
+	})
+
+	Convey("Only the displayed namespaces are summarized", t, func() {
+		before, after := map[string]int{}, map[string]int{}
+		for i := 1; i <= 12; i++ {
+			ns := fmt.Sprintf("test.c%02d", i)
+			before[ns], after[ns] = 0, i*2000
+		}
+		diff := topSample(after).Diff(topSample(before))
+		diff.Footer = true
+		// the ten busiest namespaces took 6ms to 24ms
+		So(gridRow(diff.Grid(), "(min)")[0], ShouldEqual, "6ms")
+		So(gridRow(diff.Grid(), "(total)")[0], ShouldEqual, "150ms")
+	})
+
+	Convey("A lock diff's footer summarizes the displayed databases", t, func() {
+		diff := ServerStatusDiff{
+			Totals: map[string]LockDelta{"a": {Read: 3, Write: 1}, "b": {Read: 2}},
+			Footer: true,
+		}
+		So(gridRow(diff.Grid(), "(max)"), ShouldResemble, []string{"4ms", "3ms", "1ms"})
+		So(gridRow(diff.Grid(), "(total)"), ShouldResemble, []string{"6ms", "5ms", "1ms"})
+	})
+}
@@ -0,0 +1,102 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongotop
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/log"
+)
+
+// JSONSchemaVersion is the version of the envelope that wraps each sample
+// printed with --json. It is incremented whenever a field is removed or
+// changes meaning.
+const JSONSchemaVersion = 1
+
+// sourceCommands names the command or aggregation stage each source reads
+// its statistics from, as reported in the JSON output.
+var sourceCommands = map[string]string{
+	SourceTop:       "top",
+	SourceCollStats: "$collStats",
+	SourceOpMetrics: "$operationMetrics",
+}
+
+// serverStatusCommand is reported as the source of --locks output.
+const serverStatusCommand = "serverStatus"
+
+// JSONOutput is the envelope that wraps each sample printed with --json, so
+// that consumers can tell which mode produced the data.
+type JSONOutput struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Host          string `json:"host"`
+	// Source is the command the statistics were read from: top, $collStats,
+	// $operationMetrics or serverStatus.
+	Source string `json:"source"`
+	// NumCores is omitted if the server does not report it to the user.
+	NumCores int `json:"numCores,omitempty"`
+	// IntervalSecs is the time elapsed between the two samples diffed.
+	IntervalSecs float64 `json:"intervalSecs"`
+	// Data is the diff: a TopDiff, or a ServerStatusDiff with --locks.
+	Data json.RawMessage `json:"data"`
+}
+
+// hostInfo holds the fields of the "hostInfo" command used by mongotop.
+type hostInfo struct {
+	System struct {
+		NumCores int `bson:"numCores"`
+	} `bson:"system"`
+}
+
+// jsonOutput returns diff wrapped in its JSONOutput envelope.
+func (mt *MongoTop) jsonOutput(diff FormattableDiff) string {
+	bytes, err := json.Marshal(JSONOutput{
+		SchemaVersion: JSONSchemaVersion,
+		Host:          mt.host(),
+		Source:        mt.sourceCommand(),
+		NumCores:      mt.readNumCores(),
+		IntervalSecs:  mt.interval.Seconds(),
+		Data:          json.RawMessage(diff.JSON()),
+	})
+	if err != nil {
+		panic(err)
+	}
+	return string(bytes)
+}
+
+// sourceCommand returns the command the current statistics are read from.
+func (mt *MongoTop) sourceCommand() string {
+	if mt.OutputOptions.Locks {
+		return serverStatusCommand
+	}
+	return sourceCommands[mt.source]
+}
+
+// host returns the hosts mongotop is connected to.
+func (mt *MongoTop) host() string {
+	if mt.Options == nil || mt.Options.URI == nil {
+		return ""
+	}
+	if cs := mt.Options.URI.ParsedConnString(); cs != nil {
+		return strings.Join(cs.Hosts, ",")
+	}
+	return ""
+}
+
+// readNumCores returns the number of cores of the server, which is read once
+// with the hostInfo command. It returns 0 if hostInfo fails, e.g. because the
+// user lacks the hostInfo privilege.
+func (mt *MongoTop) readNumCores() int {
+	if mt.numCores == nil {
+		var info hostInfo
+		if err := mt.SessionProvider.RunString("hostInfo", &info, "admin"); err != nil {
+			log.Logvf(log.DebugLow, "cannot read the number of cores from hostInfo: %v", err)
+		}
+		mt.numCores = &info.System.NumCores
+	}
+	return *mt.numCores
+}
@@ -0,0 +1,58 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongotop
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestJSONOutput(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	uri, err := options.NewURI("mongodb://host1:27017,host2:27018/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	numCores := 8
+	mt := &MongoTop{
+		Options:       &options.ToolOptions{URI: uri},
+		OutputOptions: &Output{},
+		source:        SourceCollStats,
+		interval:      1500 * time.Millisecond,
+		numCores:      &numCores,
+	}
+
+	Convey("JSON output should wrap each diff in an envelope", t, func() {
+		diff := TopDiff{Totals: map[string]NSTopInfo{"test.a": {Total: TopField{Time: 3, Count: 1}}}}
+		var out map[string]interface{}
+		So(json.Unmarshal([]byte(mt.jsonOutput(diff)), &out), ShouldBeNil)
+		So(out["schemaVersion"], ShouldEqual, JSONSchemaVersion)
+		So(out["host"], ShouldEqual, "host1:27017,host2:27018")
+		So(out["source"], ShouldEqual, "$collStats")
+		So(out["numCores"], ShouldEqual, 8)
+		So(out["intervalSecs"], ShouldEqual, 1.5)
+
+		var data map[string]interface{}
+		So(json.Unmarshal([]byte(diff.JSON()), &data), ShouldBeNil)
+		So(out["data"], ShouldResemble, data)
+	})
+
+	Convey("--locks output should report serverStatus as its source", t, func() {
+		mt.OutputOptions.Locks = true
+		numCores = 0
+		var out map[string]interface{}
+		So(json.Unmarshal([]byte(mt.jsonOutput(ServerStatusDiff{})), &out), ShouldBeNil)
+		So(out["source"], ShouldEqual, serverStatusCommand)
+		So(out, ShouldNotContainKey, "numCores")
+	})
+}
@@ -11,7 +11,10 @@ import (
 	"os"
 	"time"
 
+	"github.com/mongodb/mongo-tools/common/completion"
 	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/exitcode"
+	"github.com/mongodb/mongo-tools/common/healthcheck"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/signals"
 	"github.com/mongodb/mongo-tools/common/util"
@@ -30,7 +33,7 @@ func main() {
 	if err != nil {
 		log.Logvf(log.Always, "error parsing command line options: %s", err.Error())
 		log.Logvf(log.Always, util.ShortUsage("mongotop"))
-		os.Exit(util.ExitFailure)
+		os.Exit(util.ExitValidationFailure)
 	}
 
 	// print help, if specified
@@ -43,6 +46,21 @@ func main() {
 		return
 	}
 
+	// print the effective config, if specified
+	if opts.PrintEffectiveConfig() {
+		return
+	}
+
+	// generate shell completions, if requested
+	if _, ok := opts.CompletionArgs(); ok {
+		os.Exit(completion.Main(opts.ToolOptions))
+	}
+
+	// check the connection, credentials and privileges without running
+	if opts.HealthCheck {
+		os.Exit(healthcheck.Main(*opts.ToolOptions, opts.HealthCheckRequirements()))
+	}
+
 	log.SetVerbosity(opts.Verbosity)
 	signals.Handle()
 
@@ -51,16 +69,58 @@ func main() {
 
 	if opts.RowCount < 0 {
 		log.Logvf(log.Always, "invalid value for --rowcount: %v", opts.RowCount)
-		os.Exit(util.ExitFailure)
+		os.Exit(util.ExitValidationFailure)
+	}
+
+	if opts.ExitIfIdle < 0 {
+		log.Logvf(log.Always, "invalid value for --exitIfIdle: %v", opts.ExitIfIdle)
+		os.Exit(util.ExitValidationFailure)
+	}
+
+	if opts.Baseline != "" && opts.Locks {
+		log.Logvf(log.Always, "cannot use --baseline with --locks")
+		os.Exit(util.ExitValidationFailure)
+	}
+
+	if opts.Footer && opts.Json {
+		log.Logvf(log.Always, "cannot use --footer with --json")
+		os.Exit(util.ExitValidationFailure)
+	}
+
+	if opts.Source != "" && opts.Locks {
+		log.Logvf(log.Always, "cannot use --source with --locks")
+		os.Exit(util.ExitValidationFailure)
+	}
+
+	var alerts []*mongotop.Alert
+	for _, spec := range opts.Alerts {
+		alert, err := mongotop.ParseAlert(spec)
+		if err != nil {
+			log.Logvf(log.Always, "invalid --alert: %v", err)
+			os.Exit(util.ExitValidationFailure)
+		}
+		if opts.Locks && alert.UsesCounts() {
+			log.Logvf(log.Always, "invalid --alert: counts are not reported with --locks: %v", spec)
+			os.Exit(util.ExitValidationFailure)
+		}
+		alerts = append(alerts, alert)
+	}
+	if len(alerts) == 0 && (opts.AlertExec != "" || opts.AlertExit) {
+		log.Logvf(log.Always, "--alertExec and --alertExit require --alert")
+		os.Exit(util.ExitValidationFailure)
+	}
+	if opts.AlertIntervals < 1 {
+		log.Logvf(log.Always, "invalid value for --alertIntervals: %v", opts.AlertIntervals)
+		os.Exit(util.ExitValidationFailure)
 	}
 
 	if opts.Auth.Username != "" && opts.Auth.Source == "" && !opts.Auth.RequiresExternalDB() {
 		if opts.URI != nil && opts.URI.ConnectionString != "" {
 			log.Logvf(log.Always, "authSource is required when authenticating against a non $external database")
-			os.Exit(util.ExitFailure)
+			os.Exit(util.ExitValidationFailure)
 		}
 		log.Logvf(log.Always, "--authenticationDatabase is required when authenticating against a non $external database")
-		os.Exit(util.ExitFailure)
+		os.Exit(util.ExitValidationFailure)
 	}
 
 	if opts.ReplicaSetName == "" {
@@ -71,18 +131,20 @@ func main() {
 	sessionProvider, err := db.NewSessionProvider(*opts.ToolOptions)
 	if err != nil {
 		log.Logvf(log.Always, "error connecting to host: %v", err)
-		os.Exit(util.ExitFailure)
+		os.Exit(exitcode.Of(err))
 	}
+	defer sessionProvider.Close()
 
-	// fail fast if connecting to a mongos
+	// fail fast if connecting to a mongos with a source it does not support;
+	// otherwise the top command falls back to $collStats
 	isMongos, err := sessionProvider.IsMongos()
 	if err != nil {
 		log.Logvf(log.Always, "Failed: %v", err)
-		os.Exit(util.ExitFailure)
+		os.Exit(exitcode.Of(err))
 	}
-	if isMongos {
-		log.Logvf(log.Always, "cannot run mongotop against a mongos")
-		os.Exit(util.ExitFailure)
+	if isMongos && (opts.Locks || opts.Source == mongotop.SourceTop) {
+		log.Logvf(log.Always, "cannot run mongotop against a mongos with --locks or --source=top")
+		os.Exit(util.ExitValidationFailure)
 	}
 
 	// instantiate a mongotop instance
@@ -91,11 +153,12 @@ func main() {
 		OutputOptions:   opts.Output,
 		SessionProvider: sessionProvider,
 		Sleeptime:       time.Duration(opts.SleepTime) * time.Second,
+		Alerts:          alerts,
 	}
 
 	// kick it off
 	if err := top.Run(); err != nil {
 		log.Logvf(log.Always, "Failed: %v", err)
-		os.Exit(util.ExitFailure)
+		os.Exit(exitcode.Of(err))
 	}
 }
@@ -8,15 +8,18 @@
 package mongotop
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/util"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/x/bsonx"
 )
 
 // MongoTop is a container for the user-specified options and
@@ -34,46 +37,104 @@ type MongoTop struct {
 	// Length of time to sleep between each polling.
 	Sleeptime time.Duration
 
+	// Thresholds parsed from --alert, which each diff is checked against
+	Alerts []*Alert
+
 	previousServerStatus *ServerStatus
 	previousTop          *Top
+
+	// sample that cumulative deltas are computed against, if --baseline is set
+	baseline *Top
+
+	// source of usage statistics currently in use, see sourceChain
+	source string
+
+	// when the previous sample was taken, and the time elapsed between the
+	// two samples of the latest diff
+	previousSampleTime time.Time
+	interval           time.Duration
+
+	// number of cores reported by hostInfo, once it has been read
+	numCores *int
+
+	// set once serverStatus turns out to be unavailable, so that restarts are
+	// detected from the counters alone
+	noUptime bool
+
+	// each diff is appended to deltaStore, if --sqlite is set
+	deltaStore *DeltaStore
+
+	// tracks the --alert thresholds breached by each diff
+	alertWatcher *alertWatcher
+
+	// accumulates each diff into the counters served by --prometheus
+	metricsExporter *metricsExporter
+
+	// limits the namespaces reported to those listed in --nsFile, which is
+	// read again when a signal is received on nsReload
+	nsFilter *namespaceFilter
+	nsReload chan os.Signal
 }
 
 func (mt *MongoTop) runDiff() (outDiff FormattableDiff, err error) {
 	if mt.OutputOptions.Locks {
 		return mt.runServerStatusDiff()
 	}
-	return mt.runTopDiff()
+	if mt.source == "" {
+		mt.source = mt.OutputOptions.Source
+		if mt.source == "" {
+			mt.source = sourceChain[0]
+		}
+	}
+	for {
+		outDiff, err = mt.runTopDiff()
+		if err == nil || mt.OutputOptions.Source != "" || !sourceUnavailable(err) {
+			return outDiff, err
+		}
+		next := nextSource(mt.source)
+		if next == "" {
+			return nil, fmt.Errorf("no source of usage statistics is available "+
+				"(the top command requires the clusterMonitor role): %v", err)
+		}
+		log.Logvf(log.Always, "cannot use %v (%v), falling back to %v",
+			sourceDescriptions[mt.source], err, sourceDescriptions[next])
+		mt.source = next
+	}
 }
 
 func (mt *MongoTop) runTopDiff() (outDiff FormattableDiff, err error) {
-	commandName := "top"
-	dest := &bsonx.Doc{}
-	err = mt.SessionProvider.RunString(commandName, dest, "admin")
+	currentTop, err := mt.sample()
 	if err != nil {
 		mt.previousTop = nil
 		return nil, err
 	}
-	// Remove 'note' field that prevents easy decoding, then round-trip
-	// again to simplify unpacking into the nested data structure
-	totals, err := dest.LookupErr("totals")
-	if err != nil {
-		return nil, err
+	currentTop.Uptime = mt.readUptime()
+	if mt.baseline != nil && currentTop.restartedSince(*mt.baseline) {
+		log.Logvf(log.Always, "the server restarted since the baseline sample; starting a new baseline")
+		mt.baseline = nil
 	}
-	recoded, err := totals.Document().Delete("note").MarshalBSON()
-	if err != nil {
-		return nil, err
-	}
-	topinfo := make(map[string]NSTopInfo)
-	err = bson.Unmarshal(recoded, &topinfo)
-	if err != nil {
-		return nil, err
+	if mt.OutputOptions.Baseline != "" && mt.baseline == nil {
+		if err = saveBaseline(mt.OutputOptions.Baseline, currentTop); err != nil {
+			return nil, err
+		}
+		mt.baseline = &currentTop
 	}
-	currentTop := Top{Totals: topinfo}
-	if mt.previousTop != nil {
+	now := time.Now()
+	if mt.previousTop != nil && currentTop.restartedSince(*mt.previousTop) {
+		// the counters started over, so deltas are computed from this sample
+		mt.interval = now.Sub(mt.previousSampleTime)
+		outDiff = TopDiff{Totals: map[string]NSTopInfo{}, Time: now, Restarted: true}
+	} else if mt.previousTop != nil {
+		mt.interval = now.Sub(mt.previousSampleTime)
 		topDiff := currentTop.Diff(*mt.previousTop)
+		topDiff.Footer = mt.OutputOptions.Footer
+		if mt.baseline != nil {
+			topDiff.Cumulative = currentTop.Since(*mt.baseline).Totals
+		}
 		outDiff = topDiff
 	}
 	mt.previousTop = &currentTop
+	mt.previousSampleTime = now
 	return outDiff, nil
 }
 
@@ -94,19 +155,156 @@ func (mt *MongoTop) runServerStatusDiff() (outDiff FormattableDiff, err error) {
 			return nil, fmt.Errorf("server does not support reporting lock information")
 		}
 	}
-	if mt.previousServerStatus != nil {
+	now := time.Now()
+	if mt.previousServerStatus != nil && currentServerStatus.UptimeMillis < mt.previousServerStatus.UptimeMillis {
+		// the counters started over, so deltas are computed from this sample
+		mt.interval = now.Sub(mt.previousSampleTime)
+		outDiff = ServerStatusDiff{Totals: map[string]LockDelta{}, Time: now, Restarted: true}
+	} else if mt.previousServerStatus != nil {
+		mt.interval = now.Sub(mt.previousSampleTime)
 		serverStatusDiff := currentServerStatus.Diff(*mt.previousServerStatus)
+		serverStatusDiff.Footer = mt.OutputOptions.Footer
 		outDiff = serverStatusDiff
 	}
 	mt.previousServerStatus = &currentServerStatus
+	mt.previousSampleTime = now
 	return outDiff, nil
 }
 
+// readUptime returns how long the server has been up, as reported by
+// serverStatus, to detect restarts between samples. It returns 0 if
+// serverStatus fails, and stops trying if the user may not run it.
+func (mt *MongoTop) readUptime() time.Duration {
+	if mt.noUptime {
+		return 0
+	}
+	var status struct {
+		UptimeMillis int64 `bson:"uptimeMillis"`
+	}
+	if err := mt.SessionProvider.RunString("serverStatus", &status, "admin"); err != nil {
+		log.Logvf(log.DebugLow, "cannot read the uptime from serverStatus: %v", err)
+		mt.noUptime = sourceUnavailable(err)
+		return 0
+	}
+	return time.Duration(status.UptimeMillis) * time.Millisecond
+}
+
+// loadBaseline reads a Top sample previously recorded with saveBaseline.
+// It returns nil if the file does not exist yet.
+func loadBaseline(filename string) (*Top, error) {
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading baseline file: %v", err)
+	}
+	baseline := &Top{}
+	if err = json.Unmarshal(data, baseline); err != nil {
+		return nil, fmt.Errorf("error parsing baseline file %v: %v", filename, err)
+	}
+	return baseline, nil
+}
+
+// saveBaseline records a Top sample to be used as the baseline by later runs.
+func saveBaseline(filename string, top Top) error {
+	data, err := json.Marshal(top)
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(filename, data, 0644); err != nil {
+		return fmt.Errorf("error writing baseline file: %v", err)
+	}
+	log.Logvf(log.Info, "recorded baseline sample to %v", filename)
+	return nil
+}
+
+// nextBoundary returns the first multiple of interval since the Unix epoch
+// after now.
+func nextBoundary(now time.Time, interval time.Duration) time.Time {
+	nanos := now.UnixNano()
+	return time.Unix(0, nanos-nanos%int64(interval)+int64(interval))
+}
+
+// sleep waits until the next sample is due, either for the polling interval
+// or, with --align, until the next wall-clock multiple of it.
+func (mt *MongoTop) sleep() {
+	if mt.OutputOptions.Align {
+		time.Sleep(time.Until(nextBoundary(time.Now(), mt.Sleeptime)))
+		return
+	}
+	time.Sleep(mt.Sleeptime)
+}
+
+// filterNamespaces returns diff limited to the namespaces listed in
+// --nsFile, which is read again first if SIGHUP was received since the
+// previous diff. Samples are never filtered, so the next diff of a namespace
+// added to the file is computed against the previous sample.
+func (mt *MongoTop) filterNamespaces(diff FormattableDiff) FormattableDiff {
+	select {
+	case <-mt.nsReload:
+		if err := mt.nsFilter.reload(); err != nil {
+			log.Logvf(log.Always, "keeping the previous namespaces: %v", err)
+		} else {
+			log.Logvf(log.Always, "reloaded %v namespace patterns from %v",
+				len(mt.nsFilter.patterns), mt.OutputOptions.NSFile)
+		}
+	default:
+	}
+	return mt.nsFilter.apply(diff)
+}
+
 // Run executes the mongotop program.
 func (mt *MongoTop) Run() error {
 	hasData := false
 	numPrinted := 0
 
+	if mt.OutputOptions.Baseline != "" {
+		baseline, err := loadBaseline(mt.OutputOptions.Baseline)
+		if err != nil {
+			return err
+		}
+		mt.baseline = baseline
+	}
+
+	if mt.OutputOptions.SQLite != "" {
+		store, err := OpenDeltaStore(mt.OutputOptions.SQLite)
+		if err != nil {
+			return fmt.Errorf("error opening --sqlite database: %v", err)
+		}
+		defer store.Close()
+		mt.deltaStore = store
+	}
+
+	if mt.OutputOptions.Prometheus != "" {
+		mt.metricsExporter = newMetricsExporter()
+		if err := servePrometheus(mt.OutputOptions.Prometheus, mt.metricsExporter); err != nil {
+			return err
+		}
+	}
+
+	if mt.OutputOptions.NSFile != "" {
+		filter, err := newNamespaceFilter(mt.OutputOptions.NSFile)
+		if err != nil {
+			return err
+		}
+		mt.nsFilter = filter
+		mt.nsReload = make(chan os.Signal, 1)
+		signal.Notify(mt.nsReload, syscall.SIGHUP)
+		defer signal.Stop(mt.nsReload)
+	}
+
+	if len(mt.Alerts) > 0 {
+		mt.alertWatcher = newAlertWatcher(mt.Alerts, mt.OutputOptions.AlertIntervals)
+	}
+
+	// the first sample is aligned too, so that every interval starts on a
+	// boundary
+	if mt.OutputOptions.Align {
+		mt.sleep()
+	}
+
+	var lastActive time.Time
 	for {
 		if mt.OutputOptions.RowCount > 0 && numPrinted > mt.OutputOptions.RowCount {
 			return nil
@@ -121,7 +319,7 @@ func (mt *MongoTop) Run() error {
 			}
 
 			log.Logvf(log.Always, "Error: %v\n", err)
-			time.Sleep(mt.Sleeptime)
+			mt.sleep()
 		}
 
 		// if this is the first time and the connection is successful, print
@@ -130,15 +328,41 @@ func (mt *MongoTop) Run() error {
 			log.Logvf(log.Always, "connected to: %v\n", util.SanitizeURI(mt.Options.URI.ConnectionString))
 		}
 
+		if !hasData {
+			lastActive = time.Now()
+		}
 		hasData = true
 
+		if diff != nil && mt.nsFilter != nil {
+			diff = mt.filterNamespaces(diff)
+		}
 		if diff != nil {
 			if mt.OutputOptions.Json {
-				fmt.Println(diff.JSON())
+				fmt.Println(mt.jsonOutput(diff))
 			} else {
 				fmt.Println(diff.Grid())
 			}
+			if mt.deltaStore != nil {
+				if err = mt.deltaStore.Append(diff, time.Now(), mt.host(), mt.sourceCommand(), mt.interval); err != nil {
+					log.Logvf(log.Always, "error writing to --sqlite database: %v", err)
+				}
+			}
+			if mt.metricsExporter != nil {
+				mt.metricsExporter.Add(diff, time.Now())
+			}
+			if mt.alertWatcher != nil {
+				if err = mt.checkAlerts(diff); err != nil {
+					return err
+				}
+			}
+
+			if diff.HasActivity() {
+				lastActive = time.Now()
+			} else if mt.OutputOptions.ExitIfIdle > 0 && time.Since(lastActive) >= mt.OutputOptions.ExitIfIdle {
+				log.Logvf(log.Info, "no activity for %v, exiting", mt.OutputOptions.ExitIfIdle)
+				return nil
+			}
 		}
-		time.Sleep(mt.Sleeptime)
+		mt.sleep()
 	}
 }
@@ -0,0 +1,30 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongotop
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNextBoundary(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Aligned samples are taken at wall-clock multiples of the interval", t, func() {
+		now := time.Date(2021, 3, 4, 12, 0, 27, 400000000, time.UTC)
+		So(nextBoundary(now, 10*time.Second).Equal(time.Date(2021, 3, 4, 12, 0, 30, 0, time.UTC)), ShouldBeTrue)
+		So(nextBoundary(now, time.Minute).Equal(time.Date(2021, 3, 4, 12, 1, 0, 0, time.UTC)), ShouldBeTrue)
+
+		Convey("and a sample due exactly on a boundary waits for the next one", func() {
+			onBoundary := time.Date(2021, 3, 4, 12, 0, 30, 0, time.UTC)
+			So(nextBoundary(onBoundary, 10*time.Second).Equal(onBoundary.Add(10*time.Second)), ShouldBeTrue)
+		})
+	})
+}
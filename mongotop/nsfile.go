@@ -0,0 +1,124 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongotop
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// namespaceFilter limits the namespaces reported to those matching the
+// patterns listed in the --nsFile file, which can be reloaded while
+// mongotop runs.
+type namespaceFilter struct {
+	filename string
+	patterns []string
+}
+
+// readNamespaceFile reads the patterns listed in filename, one per line, as
+// matched by path.Match, e.g. "orders.*". Blank lines and lines starting
+// with '#' are ignored.
+func readNamespaceFile(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening namespace file: %v", err)
+	}
+	defer file.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		pattern := strings.TrimSpace(scanner.Text())
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid namespace pattern '%v' on line %v of %v", pattern, lineNum, filename)
+		}
+		patterns = append(patterns, pattern)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading namespace file: %v", err)
+	}
+	return patterns, nil
+}
+
+// newNamespaceFilter returns a filter for the patterns listed in filename.
+func newNamespaceFilter(filename string) (*namespaceFilter, error) {
+	patterns, err := readNamespaceFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &namespaceFilter{filename: filename, patterns: patterns}, nil
+}
+
+// reload reads the file again. The previous patterns are kept if it cannot
+// be read.
+func (f *namespaceFilter) reload() error {
+	patterns, err := readNamespaceFile(f.filename)
+	if err != nil {
+		return err
+	}
+	f.patterns = patterns
+	return nil
+}
+
+// matches returns whether ns matches any of the patterns.
+func (f *namespaceFilter) matches(ns string) bool {
+	for _, pattern := range f.patterns {
+		if matched, _ := path.Match(pattern, ns); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// apply returns a copy of diff without the namespaces, or databases with
+// --locks, that match none of the patterns.
+func (f *namespaceFilter) apply(diff FormattableDiff) FormattableDiff {
+	switch d := diff.(type) {
+	case TopDiff:
+		d.Totals = f.filterTopInfo(d.Totals)
+		d.Cumulative = f.filterTopInfo(d.Cumulative)
+		if d.Annotations != nil {
+			annotations := map[string]string{}
+			for ns, annotation := range d.Annotations {
+				if f.matches(ns) {
+					annotations[ns] = annotation
+				}
+			}
+			d.Annotations = annotations
+		}
+		return d
+	case ServerStatusDiff:
+		totals := map[string]LockDelta{}
+		for ns, delta := range d.Totals {
+			if f.matches(ns) {
+				totals[ns] = delta
+			}
+		}
+		d.Totals = totals
+		return d
+	}
+	return diff
+}
+
+func (f *namespaceFilter) filterTopInfo(totals map[string]NSTopInfo) map[string]NSTopInfo {
+	if totals == nil {
+		return nil
+	}
+	filtered := map[string]NSTopInfo{}
+	for ns, info := range totals {
+		if f.matches(ns) {
+			filtered[ns] = info
+		}
+	}
+	return filtered
+}
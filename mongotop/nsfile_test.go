@@ -0,0 +1,74 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongotop
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNamespaceFilter(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a namespace file", t, func() {
+		dir, err := ioutil.TempDir("", "mongotop_nsfile")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		filename := filepath.Join(dir, "namespaces.txt")
+		So(ioutil.WriteFile(filename, []byte("# tracked namespaces\norders.*\n\n  app.users  \n"), 0644), ShouldBeNil)
+
+		filter, err := newNamespaceFilter(filename)
+		So(err, ShouldBeNil)
+		So(filter.patterns, ShouldResemble, []string{"orders.*", "app.users"})
+
+		Convey("only the matching namespaces of a diff are kept", func() {
+			diff := TopDiff{
+				Totals: map[string]NSTopInfo{
+					"orders.items": {Total: TopField{Time: 5}},
+					"app.users":    {Total: TopField{Time: 3}},
+					"app.sessions": {Total: TopField{Time: 8}},
+				},
+				Annotations: map[string]string{"app.sessions": AnnotationReset},
+			}
+			filtered := filter.apply(diff).(TopDiff)
+			So(filtered.Totals, ShouldHaveLength, 2)
+			So(filtered.Totals, ShouldContainKey, "orders.items")
+			So(filtered.Totals, ShouldContainKey, "app.users")
+			So(filtered.Cumulative, ShouldBeNil)
+			So(filtered.Annotations, ShouldBeEmpty)
+			// the diff itself is left untouched
+			So(diff.Totals, ShouldHaveLength, 3)
+
+			locks := filter.apply(ServerStatusDiff{Totals: map[string]LockDelta{
+				"orders.items": {Read: 1}, "admin": {Write: 2},
+			}}).(ServerStatusDiff)
+			So(locks.Totals, ShouldResemble, map[string]LockDelta{"orders.items": {Read: 1}})
+		})
+
+		Convey("reloading picks up changes to the file", func() {
+			So(ioutil.WriteFile(filename, []byte("app.*\n"), 0644), ShouldBeNil)
+			So(filter.reload(), ShouldBeNil)
+			So(filter.matches("app.sessions"), ShouldBeTrue)
+			So(filter.matches("orders.items"), ShouldBeFalse)
+		})
+
+		Convey("the previous patterns are kept if the file is invalid", func() {
+			So(ioutil.WriteFile(filename, []byte("app.[\n"), 0644), ShouldBeNil)
+			So(filter.reload(), ShouldNotBeNil)
+			So(filter.patterns, ShouldResemble, []string{"orders.*", "app.users"})
+
+			So(os.Remove(filename), ShouldBeNil)
+			So(filter.reload(), ShouldNotBeNil)
+			So(filter.matches("app.users"), ShouldBeTrue)
+		})
+	})
+}
@@ -9,7 +9,9 @@ package mongotop
 import (
 	"fmt"
 	"strconv"
+	"time"
 
+	"github.com/mongodb/mongo-tools/common/healthcheck"
 	"github.com/mongodb/mongo-tools/common/options"
 )
 
@@ -29,9 +31,28 @@ type Options struct {
 
 // Output defines the set of options to use in displaying data from the server.
 type Output struct {
-	Locks    bool `long:"locks" description:"report on use of per-database locks"`
-	RowCount int  `long:"rowcount" value-name:"<count>" short:"n" description:"number of stats lines to print (0 for indefinite)"`
-	Json     bool `long:"json" description:"format output as JSON"`
+	Locks    bool   `long:"locks" description:"report on use of per-database locks"`
+	RowCount int    `long:"rowcount" value-name:"<count>" short:"n" description:"number of stats lines to print (0 for indefinite)"`
+	Json     bool   `long:"json" description:"format output as JSON, one object per sample with the fields schemaVersion, host, source, numCores, intervalSecs and data"`
+	Source   string `long:"source" value-name:"<source>" choice:"top" choice:"collstats" choice:"opmetrics" description:"source of usage statistics: top, collstats ($collStats latencyStats of every collection) or opmetrics ($operationMetrics per database). By default, top is used and mongotop falls back to the others in turn if it is not permitted or not supported"`
+	Baseline string `long:"baseline" value-name:"<filename>" description:"file holding a baseline top sample; it is recorded from the first sample if it does not exist, and cumulative deltas since the baseline are reported alongside interval deltas"`
+
+	SQLite string `long:"sqlite" value-name:"<filename>" description:"append each interval's per-namespace deltas to a table named 'deltas', with columns timestamp (UTC), host, source, interval_secs, namespace, total_ms, read_ms, write_ms, total_count, read_count and write_count, in the given SQLite database, which is created if needed"`
+
+	Footer bool `long:"footer" description:"add rows with the min, max and total of each column across the displayed namespaces"`
+
+	NSFile string `long:"nsFile" value-name:"<filename>" description:"only report the namespaces, or databases with --locks, matching the patterns listed in the given file, one per line, e.g. 'orders.*'; blank lines and lines starting with '#' are ignored. The file is read again on SIGHUP, without losing the previous sample"`
+
+	Align bool `long:"align" description:"take samples at wall-clock multiples of the polling interval, e.g. at :00, :10, :20 seconds with an interval of 10, rather than drifting by the time spent sampling"`
+
+	ExitIfIdle time.Duration `long:"exitIfIdle" value-name:"<duration>" description:"exit successfully once no namespace has shown any activity for the given duration, e.g. 30s or 5m (0 to run indefinitely)"`
+
+	Prometheus string `long:"prometheus" value-name:"<address>" description:"serve per-namespace read, write and total time and operation counters, accumulated from each interval's deltas, as Prometheus metrics at /metrics on the given address, e.g. :9217"`
+
+	Alerts         []string `long:"alert" value-name:"[ns=<pattern>,]<metric><op><value>[,...]" description:"threshold on the deltas of each interval, breached by a namespace matching the pattern (every namespace by default) for which all conditions hold, e.g. 'ns=orders.*,write_ms>500'; metrics are total_ms, read_ms, write_ms, total_count, read_count and write_count, and operators >, >=, < and <=. Breaches are logged. May be repeated"`
+	AlertIntervals int      `long:"alertIntervals" value-name:"<count>" default:"1" description:"number of consecutive intervals a namespace must breach an --alert for before it is reported; it is reported again only after it stops breaching it"`
+	AlertExec      string   `long:"alertExec" value-name:"<program>" description:"run the given program for each --alert breach, with the alert, namespace, host and deltas in the environment variables MONGOTOP_ALERT, MONGOTOP_NAMESPACE, MONGOTOP_HOST, MONGOTOP_INTERVALS and MONGOTOP_<METRIC>, e.g. MONGOTOP_WRITE_MS; mongotop waits for it to finish"`
+	AlertExit      bool     `long:"alertExit" description:"exit with a nonzero status at the first --alert breach"`
 }
 
 // Name returns a human-readable group name for output options.
@@ -70,3 +91,36 @@ func ParseOptions(rawArgs []string, versionStr, gitCommit string) (Options, erro
 
 	return Options{opts, outputOpts, sleeptime}, nil
 }
+
+// HealthCheckRequirements returns the privileges needed to read usage
+// statistics from the source given in opts, which are checked by
+// --healthCheck. With no --source, only the top command is checked, although
+// mongotop falls back to the other sources if it is not permitted.
+func (opts Options) HealthCheckRequirements() []healthcheck.Requirement {
+	switch {
+	case opts.Output.Locks:
+		return []healthcheck.Requirement{{
+			Resource: healthcheck.Resource{Cluster: true},
+			Actions:  []string{"serverStatus"},
+			Purpose:  "read lock statistics for --locks",
+		}}
+	case opts.Output.Source == SourceCollStats:
+		return []healthcheck.Requirement{{
+			Resource: healthcheck.Resource{Cluster: true},
+			Actions:  []string{"listDatabases"},
+			Purpose:  "list the databases to read $collStats from",
+		}, {
+			Resource: healthcheck.Resource{},
+			Actions:  []string{"listCollections", "collStats"},
+			Purpose:  "read $collStats latencyStats of every collection",
+		}}
+	case opts.Output.Source == SourceOpMetrics:
+		// $operationMetrics has no privilege action of its own to check
+		return nil
+	}
+	return []healthcheck.Requirement{{
+		Resource: healthcheck.Resource{Cluster: true},
+		Actions:  []string{"top"},
+		Purpose:  "run the top command",
+	}}
+}
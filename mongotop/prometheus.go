@@ -0,0 +1,142 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongotop
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/prometheus"
+)
+
+// namespaceCounters holds the time and operations accumulated for a
+// namespace across every interval since mongotop started. Counts are only
+// reported if the source reports them, which --locks does not.
+type namespaceCounters struct {
+	totalMs, readMs, writeMs          int64
+	totalCount, readCount, writeCount int64
+	hasCounts                         bool
+}
+
+// metricsExporter accumulates the deltas of each interval into per-namespace
+// counters and serves them as Prometheus metrics, for --prometheus.
+type metricsExporter struct {
+	mu         sync.Mutex
+	namespaces map[string]*namespaceCounters
+	polls      int64
+	lastPoll   time.Time
+}
+
+func newMetricsExporter() *metricsExporter {
+	return &metricsExporter{namespaces: make(map[string]*namespaceCounters)}
+}
+
+// Add adds the deltas of diff, taken at t, to the counters.
+func (e *metricsExporter) Add(diff FormattableDiff, t time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, row := range deltaRows(diff) {
+		counters, ok := e.namespaces[row.namespace]
+		if !ok {
+			counters = &namespaceCounters{}
+			e.namespaces[row.namespace] = counters
+		}
+		counters.totalMs += row.totalMs
+		counters.readMs += row.readMs
+		counters.writeMs += row.writeMs
+		if row.totalCount != nil {
+			counters.totalCount += row.totalCount.(int64)
+			counters.readCount += row.readCount.(int64)
+			counters.writeCount += row.writeCount.(int64)
+			counters.hasCounts = true
+		}
+	}
+	e.polls++
+	e.lastPoll = t
+}
+
+// ServeHTTP writes the counters in the Prometheus text exposition format.
+func (e *metricsExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", prometheus.ContentType)
+	out := bufio.NewWriter(w)
+	e.writeMetrics(out)
+	out.Flush()
+}
+
+func (e *metricsExporter) writeMetrics(out *bufio.Writer) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	names := make([]string, 0, len(e.namespaces))
+	for ns := range e.namespaces {
+		names = append(names, ns)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(out, "# HELP mongotop_time_seconds_total Time the server spent on operations on the namespace.")
+	fmt.Fprintln(out, "# TYPE mongotop_time_seconds_total counter")
+	for _, ns := range names {
+		c := e.namespaces[ns]
+		for _, sample := range []struct {
+			op string
+			ms int64
+		}{{"read", c.readMs}, {"write", c.writeMs}, {"total", c.totalMs}} {
+			fmt.Fprintf(out, "mongotop_time_seconds_total{namespace=\"%v\",op=\"%v\"} %v\n",
+				prometheus.EscapeLabelValue(ns), sample.op, float64(sample.ms)/1000)
+		}
+	}
+
+	fmt.Fprintln(out, "# HELP mongotop_operations_total Number of operations on the namespace.")
+	fmt.Fprintln(out, "# TYPE mongotop_operations_total counter")
+	for _, ns := range names {
+		c := e.namespaces[ns]
+		if !c.hasCounts {
+			continue
+		}
+		for _, sample := range []struct {
+			op    string
+			count int64
+		}{{"read", c.readCount}, {"write", c.writeCount}, {"total", c.totalCount}} {
+			fmt.Fprintf(out, "mongotop_operations_total{namespace=\"%v\",op=\"%v\"} %v\n",
+				prometheus.EscapeLabelValue(ns), sample.op, sample.count)
+		}
+	}
+
+	fmt.Fprintln(out, "# HELP mongotop_polls_total Number of intervals accumulated into the counters.")
+	fmt.Fprintln(out, "# TYPE mongotop_polls_total counter")
+	fmt.Fprintf(out, "mongotop_polls_total %v\n", e.polls)
+	if !e.lastPoll.IsZero() {
+		fmt.Fprintln(out, "# HELP mongotop_last_poll_timestamp_seconds When the counters were last updated.")
+		fmt.Fprintln(out, "# TYPE mongotop_last_poll_timestamp_seconds gauge")
+		fmt.Fprintf(out, "mongotop_last_poll_timestamp_seconds %v\n", float64(e.lastPoll.UnixNano())/1e9)
+	}
+}
+
+// servePrometheus listens on addr and serves the exporter's metrics at
+// /metrics in the background. Errors listening are returned, so that a
+// wrong --prometheus address fails before polling starts.
+func servePrometheus(addr string, exporter *metricsExporter) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("error listening on --prometheus address %v: %v", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exporter)
+	log.Logvf(log.Info, "serving Prometheus metrics at http://%v/metrics", listener.Addr())
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			log.Logvf(log.Always, "error serving Prometheus metrics: %v", err)
+		}
+	}()
+	return nil
+}
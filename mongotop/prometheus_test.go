@@ -0,0 +1,66 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongotop
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/prometheus"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMetricsExporter(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With deltas accumulated by a metrics exporter", t, func() {
+		exporter := newMetricsExporter()
+		previous := topSample(map[string]int{"test.a": 10000, `test."b"`: 0})
+		current := topSample(map[string]int{"test.a": 30000, `test."b"`: 0})
+		at := time.Unix(1583143200, 0)
+		exporter.Add(current.Diff(previous), at)
+		exporter.Add(current.Diff(previous), at.Add(time.Second))
+		exporter.Add(ServerStatusDiff{Totals: map[string]LockDelta{"test": {Read: 3, Write: 4}}}, at.Add(2*time.Second))
+
+		Convey("the counters are served in the text exposition format", func() {
+			recorder := httptest.NewRecorder()
+			exporter.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+			So(recorder.Header().Get("Content-Type"), ShouldEqual, prometheus.ContentType)
+			body, err := ioutil.ReadAll(recorder.Body)
+			So(err, ShouldBeNil)
+			So(string(body), ShouldEqual, `# HELP mongotop_time_seconds_total Time the server spent on operations on the namespace.
+# TYPE mongotop_time_seconds_total counter
+mongotop_time_seconds_total{namespace="test",op="read"} 0.003
+mongotop_time_seconds_total{namespace="test",op="write"} 0.004
+mongotop_time_seconds_total{namespace="test",op="total"} 0.007
+mongotop_time_seconds_total{namespace="test.\"b\"",op="read"} 0
+mongotop_time_seconds_total{namespace="test.\"b\"",op="write"} 0
+mongotop_time_seconds_total{namespace="test.\"b\"",op="total"} 0
+mongotop_time_seconds_total{namespace="test.a",op="read"} 0.02
+mongotop_time_seconds_total{namespace="test.a",op="write"} 0.02
+mongotop_time_seconds_total{namespace="test.a",op="total"} 0.04
+# HELP mongotop_operations_total Number of operations on the namespace.
+# TYPE mongotop_operations_total counter
+mongotop_operations_total{namespace="test.\"b\"",op="read"} 0
+mongotop_operations_total{namespace="test.\"b\"",op="write"} 0
+mongotop_operations_total{namespace="test.\"b\"",op="total"} 0
+mongotop_operations_total{namespace="test.a",op="read"} 20
+mongotop_operations_total{namespace="test.a",op="write"} 20
+mongotop_operations_total{namespace="test.a",op="total"} 40
+# HELP mongotop_polls_total Number of intervals accumulated into the counters.
+# TYPE mongotop_polls_total counter
+mongotop_polls_total 3
+# HELP mongotop_last_poll_timestamp_seconds When the counters were last updated.
+# TYPE mongotop_last_poll_timestamp_seconds gauge
+mongotop_last_poll_timestamp_seconds 1.583143202e+09
+`)
+		})
+	})
+}
@@ -0,0 +1,226 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongotop
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/bsonx"
+)
+
+// Sources of per-namespace usage statistics accepted by --source.
+const (
+	SourceTop       = "top"
+	SourceCollStats = "collstats"
+	SourceOpMetrics = "opmetrics"
+)
+
+// sourceChain is the order in which sources are tried when --source is not
+// set. Each source is only used if the ones before it are unavailable.
+var sourceChain = []string{SourceTop, SourceCollStats, SourceOpMetrics}
+
+var sourceDescriptions = map[string]string{
+	SourceTop:       "the top command",
+	SourceCollStats: "$collStats latencyStats",
+	SourceOpMetrics: "$operationMetrics (per-database CPU time; read and write times are not reported)",
+}
+
+// unavailableErrorCodes are server error codes meaning that a source cannot
+// be used with this server or user, rather than that a sample failed.
+var unavailableErrorCodes = map[int32]bool{
+	13:    true, // Unauthorized
+	20:    true, // IllegalOperation
+	59:    true, // CommandNotFound
+	115:   true, // CommandNotSupported
+	40324: true, // unrecognized pipeline stage
+}
+
+// nsNotFoundErrorCode is returned by $collStats for a collection dropped
+// between listing it and reading its statistics.
+const nsNotFoundErrorCode = 26
+
+// sourceUnavailable returns whether err means that a source cannot be used,
+// so that the next source in the chain should be tried.
+func sourceUnavailable(err error) bool {
+	cmdErr, ok := err.(mongo.CommandError)
+	return ok && unavailableErrorCodes[cmdErr.Code]
+}
+
+// nextSource returns the source after source in the chain, or "" if there
+// is none.
+func nextSource(source string) string {
+	for i, s := range sourceChain {
+		if s == source && i+1 < len(sourceChain) {
+			return sourceChain[i+1]
+		}
+	}
+	return ""
+}
+
+// sample reads the cumulative usage statistics of each namespace from the
+// current source.
+func (mt *MongoTop) sample() (Top, error) {
+	switch mt.source {
+	case SourceCollStats:
+		return mt.sampleCollStats()
+	case SourceOpMetrics:
+		return mt.sampleOperationMetrics()
+	}
+	return mt.sampleTop()
+}
+
+func (mt *MongoTop) sampleTop() (Top, error) {
+	dest := &bsonx.Doc{}
+	err := mt.SessionProvider.RunString("top", dest, "admin")
+	if err != nil {
+		return Top{}, err
+	}
+	// Remove 'note' field that prevents easy decoding, then round-trip
+	// again to simplify unpacking into the nested data structure
+	totals, err := dest.LookupErr("totals")
+	if err != nil {
+		return Top{}, err
+	}
+	recoded, err := totals.Document().Delete("note").MarshalBSON()
+	if err != nil {
+		return Top{}, err
+	}
+	topinfo := make(map[string]NSTopInfo)
+	err = bson.Unmarshal(recoded, &topinfo)
+	if err != nil {
+		return Top{}, err
+	}
+	return Top{Totals: topinfo}, nil
+}
+
+// latencyStat holds the cumulative latency, in microseconds, and count of
+// one kind of operation, as reported by $collStats.
+type latencyStat struct {
+	Latency int64 `bson:"latency"`
+	Ops     int64 `bson:"ops"`
+}
+
+// collStatsSample holds the fields of a $collStats result used by mongotop.
+// Against a mongos there is one result per shard.
+type collStatsSample struct {
+	LatencyStats struct {
+		Reads    latencyStat `bson:"reads"`
+		Writes   latencyStat `bson:"writes"`
+		Commands latencyStat `bson:"commands"`
+	} `bson:"latencyStats"`
+}
+
+// topInfo converts the latency statistics to the fields reported by top.
+// Commands only count towards the total, as they do for top.
+func (s collStatsSample) topInfo() NSTopInfo {
+	stats := s.LatencyStats
+	return NSTopInfo{
+		Total: TopField{
+			Time:  int(stats.Reads.Latency + stats.Writes.Latency + stats.Commands.Latency),
+			Count: int(stats.Reads.Ops + stats.Writes.Ops + stats.Commands.Ops),
+		},
+		Read:  TopField{Time: int(stats.Reads.Latency), Count: int(stats.Reads.Ops)},
+		Write: TopField{Time: int(stats.Writes.Latency), Count: int(stats.Writes.Ops)},
+	}
+}
+
+// add accumulates info into the totals for ns.
+func (top Top) add(ns string, info NSTopInfo) {
+	cur := top.Totals[ns]
+	cur.Total.Time += info.Total.Time
+	cur.Total.Count += info.Total.Count
+	cur.Read.Time += info.Read.Time
+	cur.Read.Count += info.Read.Count
+	cur.Write.Time += info.Write.Time
+	cur.Write.Count += info.Write.Count
+	top.Totals[ns] = cur
+}
+
+// sampleCollStats runs $collStats on every collection the user can list,
+// which costs one aggregation per collection for each sample.
+func (mt *MongoTop) sampleCollStats() (Top, error) {
+	top := Top{Totals: map[string]NSTopInfo{}}
+	dbNames, err := mt.SessionProvider.DatabaseNames()
+	if err != nil {
+		return Top{}, err
+	}
+	pipeline := mongo.Pipeline{{{Key: "$collStats", Value: bson.M{"latencyStats": bson.M{}}}}}
+	for _, dbName := range dbNames {
+		database := mt.SessionProvider.DB(dbName)
+		collNames, err := database.ListCollectionNames(context.Background(), bson.M{"type": "collection"})
+		if err != nil {
+			return Top{}, err
+		}
+		for _, collName := range collNames {
+			cursor, err := database.Collection(collName).Aggregate(context.Background(), pipeline)
+			if err != nil {
+				if cmdErr, ok := err.(mongo.CommandError); ok && cmdErr.Code == nsNotFoundErrorCode {
+					continue
+				}
+				return Top{}, err
+			}
+			var results []collStatsSample
+			if err = cursor.All(context.Background(), &results); err != nil {
+				return Top{}, err
+			}
+			for _, result := range results {
+				top.add(dbName+"."+collName, result.topInfo())
+			}
+		}
+	}
+	return top, nil
+}
+
+// readMetrics holds the read units of an $operationMetrics result.
+type readMetrics struct {
+	DocUnitsRead      int64 `bson:"docUnitsRead"`
+	IdxEntryUnitsRead int64 `bson:"idxEntryUnitsRead"`
+}
+
+// operationMetricsSample holds the fields of an $operationMetrics result,
+// which covers a whole database, used by mongotop.
+type operationMetricsSample struct {
+	DB                string      `bson:"db"`
+	PrimaryMetrics    readMetrics `bson:"primaryMetrics"`
+	SecondaryMetrics  readMetrics `bson:"secondaryMetrics"`
+	CPUNanos          int64       `bson:"cpuNanos"`
+	TotalUnitsWritten int64       `bson:"totalUnitsWritten"`
+}
+
+// topInfo converts the resource consumption of a database to the fields
+// reported by top. Counts are in read and write units, and only the total
+// has a time, the CPU time spent on the database.
+func (s operationMetricsSample) topInfo() NSTopInfo {
+	reads := s.PrimaryMetrics.DocUnitsRead + s.PrimaryMetrics.IdxEntryUnitsRead +
+		s.SecondaryMetrics.DocUnitsRead + s.SecondaryMetrics.IdxEntryUnitsRead
+	return NSTopInfo{
+		Total: TopField{Time: int(s.CPUNanos / 1000), Count: int(reads + s.TotalUnitsWritten)},
+		Read:  TopField{Count: int(reads)},
+		Write: TopField{Count: int(s.TotalUnitsWritten)},
+	}
+}
+
+// sampleOperationMetrics runs $operationMetrics, which requires the server
+// to be started with profileOperationResourceConsumptionMetrics enabled.
+func (mt *MongoTop) sampleOperationMetrics() (Top, error) {
+	pipeline := mongo.Pipeline{{{Key: "$operationMetrics", Value: bson.M{}}}}
+	cursor, err := mt.SessionProvider.DB("admin").Aggregate(context.Background(), pipeline)
+	if err != nil {
+		return Top{}, err
+	}
+	var results []operationMetricsSample
+	if err = cursor.All(context.Background(), &results); err != nil {
+		return Top{}, err
+	}
+	top := Top{Totals: map[string]NSTopInfo{}}
+	for _, result := range results {
+		top.add(result.DB, result.topInfo())
+	}
+	return top, nil
+}
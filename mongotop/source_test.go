@@ -0,0 +1,78 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongotop
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestSourceChain(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Sources fall back in order", t, func() {
+		So(nextSource(SourceTop), ShouldEqual, SourceCollStats)
+		So(nextSource(SourceCollStats), ShouldEqual, SourceOpMetrics)
+		So(nextSource(SourceOpMetrics), ShouldEqual, "")
+	})
+
+	Convey("Only errors meaning a source cannot be used fall back", t, func() {
+		So(sourceUnavailable(mongo.CommandError{Code: 13, Name: "Unauthorized"}), ShouldBeTrue)
+		So(sourceUnavailable(mongo.CommandError{Code: 59, Name: "CommandNotFound"}), ShouldBeTrue)
+		So(sourceUnavailable(mongo.CommandError{Code: 91, Name: "ShutdownInProgress"}), ShouldBeFalse)
+		So(sourceUnavailable(errors.New("connection refused")), ShouldBeFalse)
+	})
+
+	Convey("Options only accept known sources", t, func() {
+		opts, err := ParseOptions([]string{"--source", "collstats"}, "", "")
+		So(err, ShouldBeNil)
+		So(opts.Source, ShouldEqual, SourceCollStats)
+
+		_, err = ParseOptions([]string{"--source", "profiler"}, "", "")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestSourceSamples(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("$collStats latency statistics convert to top fields", t, func() {
+		var sample collStatsSample
+		sample.LatencyStats.Reads = latencyStat{Latency: 3000, Ops: 3}
+		sample.LatencyStats.Writes = latencyStat{Latency: 5000, Ops: 2}
+		sample.LatencyStats.Commands = latencyStat{Latency: 1000, Ops: 1}
+
+		top := Top{Totals: map[string]NSTopInfo{}}
+		top.add("test.a", sample.topInfo())
+		So(top.Totals["test.a"].Total, ShouldResemble, TopField{Time: 9000, Count: 6})
+		So(top.Totals["test.a"].Read, ShouldResemble, TopField{Time: 3000, Count: 3})
+		So(top.Totals["test.a"].Write, ShouldResemble, TopField{Time: 5000, Count: 2})
+
+		Convey("and results from several shards are summed", func() {
+			top.add("test.a", sample.topInfo())
+			So(top.Totals["test.a"].Total, ShouldResemble, TopField{Time: 18000, Count: 12})
+		})
+	})
+
+	Convey("$operationMetrics convert to per-database top fields", t, func() {
+		sample := operationMetricsSample{
+			DB:                "test",
+			PrimaryMetrics:    readMetrics{DocUnitsRead: 4, IdxEntryUnitsRead: 2},
+			SecondaryMetrics:  readMetrics{DocUnitsRead: 1},
+			CPUNanos:          7500000,
+			TotalUnitsWritten: 3,
+		}
+		info := sample.topInfo()
+		So(info.Total, ShouldResemble, TopField{Time: 7500, Count: 10})
+		So(info.Read, ShouldResemble, TopField{Count: 7})
+		So(info.Write, ShouldResemble, TopField{Count: 3})
+	})
+}
@@ -0,0 +1,150 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongotop
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// deltaSchema creates the table that DeltaStore appends to, holding one row
+// for each namespace of each interval, and an index for querying a
+// namespace's deltas over time. Times are in milliseconds; counts are null
+// for --locks, which does not report them.
+const deltaSchema = `
+CREATE TABLE IF NOT EXISTS deltas (
+	timestamp     TEXT NOT NULL,
+	host          TEXT NOT NULL,
+	source        TEXT NOT NULL,
+	interval_secs REAL NOT NULL,
+	namespace     TEXT NOT NULL,
+	total_ms      INTEGER NOT NULL,
+	read_ms       INTEGER NOT NULL,
+	write_ms      INTEGER NOT NULL,
+	total_count   INTEGER,
+	read_count    INTEGER,
+	write_count   INTEGER,
+	annotation    TEXT
+);
+CREATE INDEX IF NOT EXISTS deltas_namespace_timestamp ON deltas (namespace, timestamp);
+`
+
+// deltaTimeFormat is the format of the timestamp column, which SQLite's date
+// and time functions understand and which sorts in time order.
+const deltaTimeFormat = "2006-01-02T15:04:05.000Z"
+
+// errSQLiteUnsupported is returned for --sqlite by builds without cgo.
+var errSQLiteUnsupported = errors.New("--sqlite is not supported by this build of mongotop, which was built without cgo")
+
+// DeltaStore appends the per-namespace deltas of each interval to the deltas
+// table of a SQLite database, for later querying.
+type DeltaStore struct {
+	db *sql.DB
+}
+
+// OpenDeltaStore opens the SQLite database at path, creating it and its
+// deltas table if needed.
+func OpenDeltaStore(path string) (*DeltaStore, error) {
+	if !sqliteSupported {
+		return nil, errSQLiteUnsupported
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	// writes are serialized by SQLite anyway
+	db.SetMaxOpenConns(1)
+	if _, err = db.Exec(deltaSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating deltas table in %v: %v", path, err)
+	}
+	return &DeltaStore{db: db}, nil
+}
+
+// Close closes the database.
+func (s *DeltaStore) Close() error {
+	return s.db.Close()
+}
+
+// deltaRow is a row of the deltas table, less the columns shared by every
+// namespace of an interval. Counts are nil if the source does not report
+// them.
+type deltaRow struct {
+	namespace                         string
+	totalMs, readMs, writeMs          int64
+	totalCount, readCount, writeCount interface{}
+	annotation                        interface{}
+}
+
+// deltaRows returns the rows of diff, sorted by namespace.
+func deltaRows(diff FormattableDiff) []deltaRow {
+	var rows []deltaRow
+	switch d := diff.(type) {
+	case TopDiff:
+		for ns, info := range d.Totals {
+			row := deltaRow{
+				namespace:  ns,
+				totalMs:    int64(info.Total.Time),
+				readMs:     int64(info.Read.Time),
+				writeMs:    int64(info.Write.Time),
+				totalCount: int64(info.Total.Count),
+				readCount:  int64(info.Read.Count),
+				writeCount: int64(info.Write.Count),
+			}
+			if annotation, ok := d.Annotations[ns]; ok {
+				row.annotation = annotation
+			}
+			rows = append(rows, row)
+		}
+	case ServerStatusDiff:
+		for db, delta := range d.Totals {
+			rows = append(rows, deltaRow{
+				namespace: db,
+				totalMs:   delta.Read + delta.Write,
+				readMs:    delta.Read,
+				writeMs:   delta.Write,
+			})
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].namespace < rows[j].namespace })
+	return rows
+}
+
+// Append stores the rows of diff, read from source on host over interval,
+// in a single transaction.
+func (s *DeltaStore) Append(diff FormattableDiff, t time.Time, host, source string, interval time.Duration) error {
+	rows := deltaRows(diff)
+	if len(rows) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	insert, err := tx.Prepare(`INSERT INTO deltas (timestamp, host, source, interval_secs, namespace,
+		total_ms, read_ms, write_ms, total_count, read_count, write_count, annotation)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer insert.Close()
+	timestamp := t.UTC().Format(deltaTimeFormat)
+	for _, row := range rows {
+		_, err = insert.Exec(timestamp, host, source, interval.Seconds(), row.namespace,
+			row.totalMs, row.readMs, row.writeMs, row.totalCount, row.readCount, row.writeCount, row.annotation)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,18 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// +build cgo
+
+package mongotop
+
+import (
+	// registers the sqlite3 driver with database/sql
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteSupported is whether --sqlite can be used. The sqlite3 driver needs
+// cgo, so builds without it leave the driver out.
+const sqliteSupported = true
@@ -0,0 +1,72 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// +build cgo
+
+package mongotop
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDeltaStore(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With deltas stored in a SQLite database", t, func() {
+		dir, err := ioutil.TempDir("", "mongotop_sqlite")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "deltas.db")
+
+		store, err := OpenDeltaStore(path)
+		So(err, ShouldBeNil)
+		at := time.Date(2020, time.March, 2, 10, 0, 0, 0, time.UTC)
+
+		previous := topSample(map[string]int{"test.a": 10000, "test.b": 4000})
+		current := topSample(map[string]int{"test.a": 30000})
+		So(store.Append(current.Diff(previous), at, "localhost:27017", "top", time.Second), ShouldBeNil)
+
+		locks := ServerStatusDiff{Totals: map[string]LockDelta{"test": {Read: 3, Write: 4}}}
+		So(store.Append(locks, at.Add(time.Second), "localhost:27017", "serverStatus", time.Second), ShouldBeNil)
+		So(store.Close(), ShouldBeNil)
+
+		Convey("each namespace of each interval is a row", func() {
+			db, err := sql.Open("sqlite3", path)
+			So(err, ShouldBeNil)
+			defer db.Close()
+
+			rows, err := db.Query(`SELECT timestamp, source, namespace, total_ms, read_ms, write_ms,
+				total_count, annotation FROM deltas ORDER BY timestamp, namespace`)
+			So(err, ShouldBeNil)
+			defer rows.Close()
+			var stored []string
+			for rows.Next() {
+				var timestamp, source, namespace string
+				var totalMs, readMs, writeMs int64
+				var totalCount sql.NullInt64
+				var annotation sql.NullString
+				So(rows.Scan(&timestamp, &source, &namespace, &totalMs, &readMs, &writeMs, &totalCount, &annotation), ShouldBeNil)
+				stored = append(stored, fmt.Sprintf("%v %v %v %v/%v/%v %v %v", timestamp, source, namespace,
+					totalMs, readMs, writeMs, totalCount.Int64, annotation.String))
+			}
+			So(rows.Err(), ShouldBeNil)
+			So(stored, ShouldResemble, []string{
+				"2020-03-02T10:00:00.000Z top test.a 20/10/10 20 ",
+				"2020-03-02T10:00:00.000Z top test.b 0/0/0 0 dropped",
+				"2020-03-02T10:00:01.000Z serverStatus test 7/3/4 0 ",
+			})
+		})
+	})
+}
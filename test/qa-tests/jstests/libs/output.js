@@ -1,5 +1,10 @@
 const exitCodeSuccess = 0;
 const exitCodeFailure = 1;
+const exitCodeValidationFailure = 2;
+const exitCodeConnectionFailure = 3;
+const exitCodeAuthFailure = 4;
+const exitCodePartialSuccess = 5;
+const exitCodeAborted = 6;
 
 // shellRowRegex matches all lines of shell output
 const shellRowRegex = /^sh\d+\|\s+/;
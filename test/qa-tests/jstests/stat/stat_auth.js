@@ -28,5 +28,5 @@
   assert.eq(x, exitCodeSuccess, "mongostat should exit successfully with foobar:foobar");
 
   x = runMongoProgram.apply(null, args.concat("--password", "wrong"));
-  assert.eq(x, exitCodeFailure, "mongostat should exit with an error exit code with foobar:wrong");
+  assert.eq(x, exitCodeAuthFailure, "mongostat should exit with an auth failure exit code with foobar:wrong");
 }());
@@ -13,7 +13,7 @@
   var x, rows;
   x = runMongoProgram.apply(this, ["mongostat", "--port", port,
     "-o", "host,conn,time", "-O", "metrics.record.moves"].concat(commonToolArgs));
-  assert.eq(x, exitCodeFailure, "mongostat should fail with both -o and -O options");
+  assert.eq(x, exitCodeValidationFailure, "mongostat should fail with both -o and -O options");
   clearRawMongoProgramOutput();
 
   // basic -o --humanReadable=false
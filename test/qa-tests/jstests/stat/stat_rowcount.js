@@ -28,19 +28,19 @@
 
   pid = startMongoProgramNoConnect.apply(null, ["mongostat", "--port", toolTest.port].concat(commonToolArgs));
   assert.strContains.soon('sh'+pid+'|  ', rawMongoProgramOutput, "should produce some output");
-  assert.eq(exitCodeFailure, stopMongoProgramByPid(pid), "stopping should cause mongostat exit with a 'failure' code");
+  assert.eq(exitCodeAborted, stopMongoProgramByPid(pid), "stopping should cause mongostat exit with an 'aborted' code");
 
   x = runMongoProgram.apply(this, ["mongostat", "--port", toolTest.port - 1, "--rowcount", 1].concat(commonToolArgs));
-  assert.neq(exitCodeSuccess, x, "can't connect causes an error exit code");
+  assert.eq(exitCodeConnectionFailure, x, "can't connect causes a connection failure exit code");
 
   x = runMongoProgram.apply(null, ["mongostat", "--rowcount", "-1"].concat(commonToolArgs));
-  assert.eq(exitCodeFailure, x, "mongostat --rowcount specified with bad input: negative value");
+  assert.eq(exitCodeValidationFailure, x, "mongostat --rowcount specified with bad input: negative value");
 
   x = runMongoProgram.apply(null, ["mongostat", "--rowcount", "foobar"].concat(commonToolArgs));
-  assert.eq(exitCodeFailure, x, "mongostat --rowcount specified with bad input: non-numeric value");
+  assert.eq(exitCodeValidationFailure, x, "mongostat --rowcount specified with bad input: non-numeric value");
 
   x = runMongoProgram.apply(null, ["mongostat", "--host", "badreplset/127.0.0.1:" + toolTest.port, "--rowcount", 1].concat(commonToolArgs));
-  assert.eq(exitCodeFailure, x, "--host used with a replica set string for nodes not in a replica set");
+  assert.eq(exitCodeConnectionFailure, x, "--host used with a replica set string for nodes not in a replica set");
 
   pid = startMongoProgramNoConnect.apply(null, ["mongostat", "--host", "127.0.0.1:" + toolTest.port].concat(commonToolArgs));
   assert.strContains.soon('sh'+pid+'|  ', rawMongoProgramOutput, "should produce some output");
@@ -53,5 +53,5 @@
   const rows = allDefaultStatRows();
   assert.eq(rows.length, 0, "should stop showing new stat lines, showed " + JSON.stringify(rows) + " instead.");
 
-  assert.eq(exitCodeFailure, stopMongoProgramByPid(pid), "mongostat should return a failure code when server goes down");
+  assert.eq(exitCodeAborted, stopMongoProgramByPid(pid), "mongostat should keep running until stopped when server goes down");
 }());
@@ -36,6 +36,8 @@ load('jstests/top/util/mongotop_common.js');
       parsedOutput = JSON.parse(extractJSON(ret.getOutput()));
       return typeof parsedOutput;
     }, 'invalid JSON 1');
+    assert.eq(parsedOutput.schemaVersion, 1, 'unexpected schema version');
+    parsedOutput = parsedOutput.data;
 
     // ensure only the active namespaces reports a non-zero value
     for (var namespace in parsedOutput.totals) {